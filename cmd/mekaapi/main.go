@@ -0,0 +1,335 @@
+// Command mekaapi reports the exported API of packages, and the compatibility
+// of two reports, so forks can see what a module upgrade changes before
+// merging it.
+//
+//	mekaapi ./mekabuild ./mekabuild/abci > api.txt
+//	mekaapi -diff old-api.txt api.txt
+//
+// A report has one line per exported declaration, struct field and interface
+// method, keyed by its name, and marks deprecated declarations. The diff
+// classifies removed and changed declarations as incompatible, and added
+// declarations and new deprecations as compatible, like apidiff, but from
+// the source alone, so it works without the module's dependencies. It can't
+// tell compatible type changes, e.g. to a type alias, from incompatible ones,
+// so those are reported as changes to review. The exit status is 1 if there
+// are incompatible changes.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+func main() {
+	incompatible, err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if incompatible {
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) (incompatible bool, err error) {
+	fs := flag.NewFlagSet("mekaapi", flag.ContinueOnError)
+	diff := fs.Bool("diff", false, "compare two reports, old and new, rather than reporting packages")
+	if err := fs.Parse(args); err != nil {
+		return false, err
+	}
+
+	if *diff {
+		if fs.NArg() != 2 {
+			return false, errors.New("-diff takes two reports, old and new")
+		}
+		return diffReports(fs.Arg(0), fs.Arg(1), stdout)
+	}
+
+	if fs.NArg() == 0 {
+		return false, errors.New("no package directories")
+	}
+	var lines []string
+	for _, dir := range fs.Args() {
+		pkgLines, err := report(dir)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", dir, err)
+		}
+		lines = append(lines, pkgLines...)
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintln(stdout, line)
+	}
+	return false, nil
+}
+
+// deprecatedSuffix marks deprecated declarations in reports.
+const deprecatedSuffix = " // deprecated"
+
+// report returns the report lines of the package in dir, each formatted as
+// "pkg: key: type", e.g. "mekabuild: func New: func(...) (*Builder, error)".
+func report(dir string) ([]string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for name, pkg := range pkgs {
+		if name == "main" {
+			continue
+		}
+		prefix := path.Clean(strings.TrimPrefix(dir, "./"))
+		r := &reporter{fset: fset, prefix: prefix}
+		r.pkg(doc.New(pkg, prefix, 0))
+		if r.err != nil {
+			return nil, r.err
+		}
+		lines = append(lines, r.lines...)
+	}
+	return lines, nil
+}
+
+type reporter struct {
+	fset   *token.FileSet
+	prefix string
+	lines  []string
+	err    error
+}
+
+func (r *reporter) add(key, typ, docText string) {
+	line := fmt.Sprintf("%s: %s: %s", r.prefix, key, typ)
+	if isDeprecated(docText) {
+		line += deprecatedSuffix
+	}
+	r.lines = append(r.lines, line)
+}
+
+func (r *reporter) pkg(p *doc.Package) {
+	r.values(p.Consts)
+	r.values(p.Vars)
+	r.funcs("", p.Funcs)
+	for _, t := range p.Types {
+		r.typ(t)
+		r.values(t.Consts)
+		r.values(t.Vars)
+		r.funcs("", t.Funcs)
+		r.funcs(t.Name, t.Methods)
+	}
+}
+
+func (r *reporter) values(values []*doc.Value) {
+	for _, v := range values {
+		typ := ""
+		for _, spec := range v.Decl.Specs {
+			vs := spec.(*ast.ValueSpec)
+			docText := v.Doc
+			if vs.Doc != nil {
+				docText = vs.Doc.Text()
+			}
+			switch {
+			case vs.Type != nil:
+				typ = r.node(vs.Type)
+			case len(vs.Values) > 0:
+				typ = "(inferred)"
+			} // else an iota constant, of the previous spec's type
+			for _, name := range vs.Names {
+				if name.IsExported() {
+					r.add(v.Decl.Tok.String()+" "+name.Name, typ, docText)
+				}
+			}
+		}
+	}
+}
+
+func (r *reporter) funcs(recv string, funcs []*doc.Func) {
+	for _, f := range funcs {
+		key, typ := "func "+f.Name, r.node(f.Decl.Type)
+		if recv != "" {
+			// The receiver determines the method sets the method is in.
+			key = "method " + recv + "." + f.Name
+			typ = "(" + r.node(f.Decl.Recv.List[0].Type) + ") " + typ
+		}
+		r.add(key, typ, f.Doc)
+	}
+}
+
+func (r *reporter) typ(t *doc.Type) {
+	for _, spec := range t.Decl.Specs {
+		ts := spec.(*ast.TypeSpec)
+		if ts.Name.Name != t.Name {
+			continue
+		}
+		key := "type " + t.Name
+		alias := ""
+		if ts.Assign.IsValid() {
+			alias = "= "
+		}
+
+		switch typ := ts.Type.(type) {
+		case *ast.StructType:
+			r.add(key, alias+"struct", t.Doc)
+			for _, field := range typ.Fields.List {
+				docText := ""
+				if field.Doc != nil {
+					docText = field.Doc.Text()
+				}
+				for _, name := range fieldNames(field) {
+					if ast.IsExported(name) {
+						r.add("field "+t.Name+"."+name, r.node(field.Type), docText)
+					}
+				}
+			}
+		case *ast.InterfaceType:
+			r.add(key, alias+"interface", t.Doc)
+			for _, method := range typ.Methods.List {
+				docText := ""
+				if method.Doc != nil {
+					docText = method.Doc.Text()
+				}
+				for _, name := range fieldNames(method) {
+					if ast.IsExported(name) {
+						r.add("method "+t.Name+"."+name, r.node(method.Type), docText)
+					} else if len(method.Names) == 0 {
+						r.add("embed "+t.Name+"."+name, "embedded", docText)
+					}
+				}
+			}
+		default:
+			r.add(key, alias+r.node(ts.Type), t.Doc)
+		}
+	}
+}
+
+// fieldNames returns the names of a field, or the type name of an embedded
+// field.
+func fieldNames(field *ast.Field) []string {
+	if len(field.Names) == 0 {
+		typ := field.Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		switch typ := typ.(type) {
+		case *ast.Ident:
+			return []string{typ.Name}
+		case *ast.SelectorExpr:
+			return []string{typ.Sel.Name}
+		}
+		return nil
+	}
+	names := make([]string, 0, len(field.Names))
+	for _, name := range field.Names {
+		names = append(names, name.Name)
+	}
+	return names
+}
+
+// node prints n on a single line.
+func (r *reporter) node(n interface{}) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, r.fset, n); err != nil && r.err == nil {
+		r.err = err
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+// isDeprecated returns true if the doc comment has a "Deprecated: " paragraph.
+func isDeprecated(docText string) bool {
+	for _, paragraph := range strings.Split(docText, "\n\n") {
+		if strings.HasPrefix(strings.TrimSpace(paragraph), "Deprecated: ") {
+			return true
+		}
+	}
+	return false
+}
+
+// diffReports prints the differences between two reports, and returns true if
+// any are incompatible.
+func diffReports(oldPath, newPath string, stdout io.Writer) (bool, error) {
+	oldDecls, err := readReport(oldPath)
+	if err != nil {
+		return false, err
+	}
+	newDecls, err := readReport(newPath)
+	if err != nil {
+		return false, err
+	}
+
+	var incompatible, compatible, deprecated []string
+	for key, o := range oldDecls {
+		n, ok := newDecls[key]
+		switch {
+		case !ok:
+			incompatible = append(incompatible, "removed "+o)
+		case strings.TrimSuffix(o, deprecatedSuffix) != strings.TrimSuffix(n, deprecatedSuffix):
+			incompatible = append(incompatible, fmt.Sprintf("changed %s\n    to %s", o, n))
+		case !strings.HasSuffix(o, deprecatedSuffix) && strings.HasSuffix(n, deprecatedSuffix):
+			deprecated = append(deprecated, "deprecated "+strings.TrimSuffix(n, deprecatedSuffix))
+		}
+	}
+	for key, n := range newDecls {
+		if _, ok := oldDecls[key]; !ok {
+			compatible = append(compatible, "added "+n)
+		}
+	}
+
+	for _, section := range []struct {
+		title string
+		lines []string
+	}{
+		{"Incompatible changes", incompatible},
+		{"Compatible changes", compatible},
+		{"Deprecations", deprecated},
+	} {
+		if len(section.lines) == 0 {
+			continue
+		}
+		sort.Strings(section.lines)
+		fmt.Fprintf(stdout, "%s:\n", section.title)
+		for _, line := range section.lines {
+			fmt.Fprintf(stdout, "- %s\n", line)
+		}
+	}
+	return len(incompatible) > 0, nil
+}
+
+// readReport reads a report into a map of "pkg: key" to line.
+func readReport(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	decls := map[string]string{}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ": ", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%s:%d: malformed line %q", name, n, line)
+		}
+		decls[parts[0]+": "+parts[1]] = line
+	}
+	return decls, s.Err()
+}
@@ -0,0 +1,100 @@
+// Command mekasignerd is a signing daemon for the builder client. It holds the
+// validator key and signs builder payloads on behalf of an unprivileged
+// builder client, over a unix socket. See package signerd for detail.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+	"github.com/meka-dev/mekatek-go/mekabuild/signerd"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("mekasignerd", flag.ContinueOnError)
+	var (
+		keyFile   = fs.String("key", "priv_validator_key.json", "Tendermint private validator key file")
+		socket    = fs.String("socket", "mekasignerd.sock", "unix socket to listen on")
+		tokenFile = fs.String("token-file", "", "file containing the bearer token clients must present")
+		chainID   = fs.String("chain-id", "", "only sign build requests for this chain, if set")
+		buildRate = fs.Int("build-rate", mekabuild.DefaultSigningLimits.BuildRequestsPerMinute, "maximum build request signatures per minute, 0 for unlimited")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *tokenFile == "" {
+		return errors.New("-token-file is required")
+	}
+
+	token, err := os.ReadFile(*tokenFile)
+	if err != nil {
+		return fmt.Errorf("read token file: %w", err)
+	}
+
+	key, err := signerd.LoadPrivValidatorKey(*keyFile)
+	if err != nil {
+		return fmt.Errorf("load key: %w", err)
+	}
+
+	limits := mekabuild.DefaultSigningLimits
+	limits.BuildRequestsPerMinute = *buildRate
+	guard, err := signerd.NewGuard(key, signerd.GuardConfig{
+		ChainID:          *chainID,
+		ValidatorAddress: key.Address,
+		Limits:           limits,
+	})
+	if err != nil {
+		return fmt.Errorf("create guard: %w", err)
+	}
+
+	server, err := signerd.NewServer(guard, strings.TrimSpace(string(token)))
+	if err != nil {
+		return fmt.Errorf("create server: %w", err)
+	}
+
+	os.Remove(*socket) // stale socket from a previous run
+
+	ln, err := net.Listen("unix", *socket)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	if err := os.Chmod(*socket, 0o600); err != nil {
+		ln.Close()
+		return fmt.Errorf("restrict socket permissions: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	s := &http.Server{Handler: server}
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	log.Printf("signing for %s on %s", key.Address, *socket)
+
+	if err := s.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+// Command mekawindow models whether builder requests fit a chain's proposal
+// window, from historical mempool sizes, network round-trip times and the
+// consensus timeouts, and recommends a builder timeout and compression. See
+// mekabuild.SimulateProposalWindow for the model.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mekawindow", flag.ContinueOnError)
+	var (
+		mempoolFile    = fs.String("mempool", "", "file with one mempool size in bytes per line, e.g. per recent height (required)")
+		rtts           = fs.String("rtt", "", "comma-separated round-trip times to the builder API, e.g. 40ms,55ms,120ms (required)")
+		timeoutPropose = fs.Duration("timeout-propose", 3*time.Second, "consensus timeout_propose of the chain")
+		margin         = fs.Duration("margin", mekabuild.DefaultPropagationMargin, "part of timeout-propose needed to propagate the block")
+		upload         = fs.Float64("upload", 12.5e6, "upload bandwidth to the builder API, in bytes per second")
+		download       = fs.Float64("download", 0, "download bandwidth from the builder API, in bytes per second, 0 for the upload bandwidth")
+		auction        = fs.Duration("auction", 300*time.Millisecond, "time the builder API holds the auction")
+		sign           = fs.Duration("sign", 5*time.Millisecond, "time to sign a build request")
+		percentiles    = fs.String("percentiles", "50,90,99", "comma-separated percentiles to estimate")
+		sampleFile     = fs.String("sample", "", "file with one base64 tx per line, to measure compression on, instead of using typical profiles")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *mempoolFile == "" || *rtts == "" {
+		return errors.New("-mempool and -rtt are required")
+	}
+
+	s := mekabuild.ProposalWindowScenario{
+		TimeoutPropose:         *timeoutPropose,
+		PropagationMargin:      *margin,
+		UploadBytesPerSecond:   *upload,
+		DownloadBytesPerSecond: *download,
+		AuctionTime:            *auction,
+		SignTime:               *sign,
+	}
+
+	var err error
+	if s.MempoolBytes, err = readSizes(*mempoolFile); err != nil {
+		return fmt.Errorf("read mempool sizes: %w", err)
+	}
+	for _, f := range strings.Split(*rtts, ",") {
+		rtt, err := time.ParseDuration(strings.TrimSpace(f))
+		if err != nil {
+			return fmt.Errorf("parse -rtt: %w", err)
+		}
+		s.RTTs = append(s.RTTs, rtt)
+	}
+	for _, f := range strings.Split(*percentiles, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return fmt.Errorf("parse -percentiles: %w", err)
+		}
+		s.Percentiles = append(s.Percentiles, p)
+	}
+	if *sampleFile != "" {
+		if s.Compressions, err = measureCompressions(*sampleFile); err != nil {
+			return fmt.Errorf("measure compression: %w", err)
+		}
+	}
+
+	report, err := mekabuild.SimulateProposalWindow(s)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "PERCENTILE\tCOMPRESSION\tMEMPOOL BYTES\tRTT\tDURATION\tFITS\n")
+	for _, e := range report.Estimates {
+		fmt.Fprintf(tw, "p%g\t%s\t%d\t%s\t%s\t%v\n", e.Percentile, e.Compression, e.MempoolBytes, e.RTT, e.Duration.Round(time.Millisecond), e.Fits)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "\nwindow: %s\n", report.Window)
+	fmt.Fprintf(stdout, "recommended compression: %s\n", report.Compression)
+	fmt.Fprintf(stdout, "recommended timeout: %s\n", report.Timeout.Round(time.Millisecond))
+	if !report.Fits {
+		fmt.Fprintf(stdout, "warning: builds don't fit the window at every percentile, consider a fallback, see mekabuild.SetFallback\n")
+	}
+	return nil
+}
+
+// readSizes reads one size per line, ignoring blank lines and # comments.
+func readSizes(name string) ([]int64, error) {
+	var sizes []int64
+	err := readLines(name, func(line string) error {
+		n, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return err
+		}
+		sizes = append(sizes, n)
+		return nil
+	})
+	return sizes, err
+}
+
+// measureCompressions measures the compressions supported by the builder on
+// the txs in the file.
+func measureCompressions(name string) ([]mekabuild.CompressionProfile, error) {
+	var txs [][]byte
+	err := readLines(name, func(line string) error {
+		tx, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return err
+		}
+		txs = append(txs, tx)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := mekabuild.GzipCompressor(gzip.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	profiles := []mekabuild.CompressionProfile{{Name: "none", Ratio: 1}}
+	for _, c := range []struct {
+		name       string
+		compressor mekabuild.Compressor
+	}{
+		{"gzip", gz},
+		{"snappy", mekabuild.SnappyCompressor},
+	} {
+		p, err := mekabuild.MeasureCompression(c.name, c.compressor, txs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+func readLines(name string, fn func(line string) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 64<<20) // txs can be large
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+	}
+	return s.Err()
+}
@@ -0,0 +1,166 @@
+// Command mininode is a runnable, minimal model of a Tendermint node that
+// integrates with the builder API via the mekabuild package. It starts an
+// in-process mock builder API, proposes a few blocks against it, falls back to
+// its own mempool when the builder fails, and prints per-endpoint metrics.
+//
+// It serves as executable documentation for integrators, and as a smoke test
+// for API changes.
+//
+// The builder is consulted in dry-run mode when MEKATEK_BUILDER_API_DRY_RUN
+// is true: builds are performed, but the node always proposes its own txs.
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func main() {
+	if err := run(context.Background(), os.Stdout, 5); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, stdout io.Writer, heights int) error {
+	const chainID = "mininode-1"
+
+	key, err := newKey("MININODE")
+	if err != nil {
+		return fmt.Errorf("generate key: %w", err)
+	}
+
+	api := &mockAPI{publicKeys: map[string]ed25519.PublicKey{key.addr: key.public}, failEvery: 3}
+	server := httptest.NewServer(mekabuild.GunzipRequestMiddleware(api))
+	defer server.Close()
+
+	apiURL, err := url.Parse(server.URL)
+	if err != nil {
+		return fmt.Errorf("parse API URL: %w", err)
+	}
+
+	client := &http.Client{Transport: mekabuild.UserAgentDecorator("mininode/0.0.0")(http.DefaultTransport)}
+	builder, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithHTTPClient(client), mekabuild.WithEndpoints(apiURL))
+	if err != nil {
+		return fmt.Errorf("create builder: %w", err)
+	}
+	dryRun := mekabuild.DryRunMode()
+
+	for height := int64(1); height <= int64(heights); height++ {
+		mempool := [][]byte{[]byte(fmt.Sprintf("tx-%d-a", height)), []byte(fmt.Sprintf("tx-%d-b", height))}
+		txs, source := propose(ctx, builder, chainID, key.addr, height, mempool, dryRun)
+		fmt.Fprintf(stdout, "height %d: proposed %d txs from %s\n", height, len(txs), source)
+	}
+
+	for _, s := range builder.EndpointStats() {
+		fmt.Fprintf(stdout, "endpoint %s: %d ok, %d failed, mean latency %s\n", s.Endpoint, s.Successes, s.Failures, s.MeanLatency())
+	}
+
+	return nil
+}
+
+// propose models the patched Tendermint proposal path: ask the builder for a
+// block, and fall back to the local mempool on any error, or in dry-run mode.
+func propose(ctx context.Context, builder *mekabuild.Builder, chainID, addr string, height int64, mempool [][]byte, dryRun bool) ([][]byte, string) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	resp, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{
+		ChainID:          chainID,
+		Height:           height,
+		ValidatorAddress: addr,
+		MaxBytes:         1 << 20,
+		MaxGas:           -1,
+		Txs:              mempool,
+	})
+	switch {
+	case err != nil:
+		return mempool, fmt.Sprintf("mempool (builder error: %v)", err)
+	case dryRun:
+		return mempool, fmt.Sprintf("mempool (dry run, builder offered %q)", resp.ValidatorPayment)
+	default:
+		return resp.Txs, fmt.Sprintf("builder (payment %q)", resp.ValidatorPayment)
+	}
+}
+
+//
+//
+//
+
+type key struct {
+	addr    string
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+func newKey(addr string) (*key, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &key{addr: addr, public: public, private: private}, nil
+}
+
+func (k *key) SignBuildBlockRequest(r *mekabuild.BuildBlockRequest) error {
+	msg, err := r.SignBytes()
+	if err != nil {
+		return err
+	}
+	sig, err := k.private.Sign(nil, msg, crypto.Hash(0))
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// mockAPI is a minimal builder API. It verifies signatures, prepends a payment
+// tx to the validator's txs, and fails every failEvery-th request so that the
+// fallback path is exercised.
+type mockAPI struct {
+	publicKeys map[string]ed25519.PublicKey
+	failEvery  int
+	count      int
+}
+
+func (a *mockAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v0/build" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if a.count++; a.failEvery > 0 && a.count%a.failEvery == 0 {
+		http.Error(w, `{"error":"injected failure"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	var req mekabuild.BuildBlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	publicKey, ok := a.publicKeys[req.ValidatorAddress]
+	msg, err := req.SignBytes()
+	if !ok || err != nil || !ed25519.Verify(publicKey, msg, req.Signature) {
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+
+	json.NewEncoder(w).Encode(mekabuild.BuildBlockResponse{
+		Txs:              append([][]byte{[]byte("payment-tx")}, req.Txs...),
+		ValidatorPayment: fmt.Sprintf("%d ucoin", 100*req.Height),
+	})
+}
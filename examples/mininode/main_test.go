@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	var stdout bytes.Buffer
+	if err := run(context.Background(), &stdout, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	output := stdout.String()
+	for _, want := range []string{
+		"height 1: proposed 3 txs from builder",
+		"height 3: proposed 2 txs from mempool (builder error",
+		"2 ok, 1 failed",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q\n%s", want, output)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package mekabid provides a client for searchers submitting bundles and bids
+// to Mekatek's builder API. It's the other side of the marketplace from the
+// mekabuild package, which is used by validators.
+//
+// Bundles and bids are signed by the searcher's account key over a stable
+// byte representation, analogous to mekabuild.BuildBlockRequestSignBytes.
+// The sign bytes are domain-separated from every payload signed by
+// validators, so searcher and validator signatures can never be confused.
+package mekabid
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+// Bundle is an ordered list of transactions that a searcher wants included,
+// atomically and in order, in the block at the target height. Any payment is
+// made by transactions in the bundle itself.
+type Bundle struct {
+	ChainID         string   `json:"chain_id"`
+	Height          int64    `json:"height"`
+	SearcherAddress string   `json:"searcher_address"`
+	Txs             [][]byte `json:"txs"`
+
+	// KeyType and PublicKey identify the searcher key that signed the
+	// bundle. KeyType is e.g. mekabuild.KeyTypeSecp256k1. The zero value
+	// means mekabuild.KeyTypeEd25519.
+	KeyType   string `json:"key_type,omitempty"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+// SignBytes returns the bytes that should be signed for the bundle.
+func (b *Bundle) SignBytes() []byte {
+	return BundleSignBytes(b.ChainID, b.Height, b.SearcherAddress, mekabuild.HashTxs(b.Txs...))
+}
+
+// BundleSignBytes returns a stable byte representation of a Bundle
+// represented by the provided parameters.
+func BundleSignBytes(chainID string, height int64, searcherAddr string, txsHash []byte) []byte {
+	// XXX: Changing the order or the set of fields that are signed will cause
+	// verification failures unless both the signer and verifier are updated.
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`searcher-bundle`))
+	mustEncode(&sb, uint64(len([]byte(chainID))))
+	mustEncode(&sb, []byte(chainID))
+	mustEncode(&sb, height)
+	mustEncode(&sb, uint64(len([]byte(searcherAddr))))
+	mustEncode(&sb, []byte(searcherAddr))
+	mustEncode(&sb, uint64(len(txsHash)))
+	mustEncode(&sb, txsHash)
+	return sb.Bytes()
+}
+
+// Bid is a bundle with a payment commitment. The searcher commits to paying
+// the given amount if the bundle is included at the target height, and the
+// builder API ranks bids by it.
+type Bid struct {
+	Bundle
+
+	// Payment is the committed payment, as a Cosmos SDK coins string, e.g.
+	// "1000uatom". See mekabuild.ParseCoins.
+	Payment string `json:"payment"`
+}
+
+// SignBytes returns the bytes that should be signed for the bid. They cover
+// the payment, as well as the bundle.
+func (b *Bid) SignBytes() []byte {
+	return BidSignBytes(b.ChainID, b.Height, b.SearcherAddress, mekabuild.HashTxs(b.Txs...), b.Payment)
+}
+
+// BidSignBytes returns a stable byte representation of a Bid represented by
+// the provided parameters.
+func BidSignBytes(chainID string, height int64, searcherAddr string, txsHash []byte, payment string) []byte {
+	// XXX: As with BundleSignBytes, tread carefully.
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`searcher-bid`))
+	mustEncode(&sb, uint64(len([]byte(chainID))))
+	mustEncode(&sb, []byte(chainID))
+	mustEncode(&sb, height)
+	mustEncode(&sb, uint64(len([]byte(searcherAddr))))
+	mustEncode(&sb, []byte(searcherAddr))
+	mustEncode(&sb, uint64(len(txsHash)))
+	mustEncode(&sb, txsHash)
+	mustEncode(&sb, uint64(len([]byte(payment))))
+	mustEncode(&sb, []byte(payment))
+	return sb.Bytes()
+}
+
+// Signer signs bundles and bids with a searcher's account key.
+type Signer interface {
+	// KeyType returns the type of the key, e.g. mekabuild.KeyTypeEd25519.
+	KeyType() string
+
+	// PublicKey returns the public key, in the format expected by
+	// mekabuild.VerifySignature for the key type.
+	PublicKey() []byte
+
+	// Sign returns a signature over msg.
+	Sign(msg []byte) ([]byte, error)
+}
+
+// NewEd25519Signer returns a Signer using the given ed25519 private key.
+func NewEd25519Signer(privateKey ed25519.PrivateKey) Signer {
+	return ed25519Signer(privateKey)
+}
+
+type ed25519Signer ed25519.PrivateKey
+
+func (s ed25519Signer) KeyType() string { return mekabuild.KeyTypeEd25519 }
+
+func (s ed25519Signer) PublicKey() []byte {
+	return []byte(ed25519.PrivateKey(s).Public().(ed25519.PublicKey))
+}
+
+func (s ed25519Signer) Sign(msg []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.PrivateKey(s), msg), nil
+}
+
+// ErrBadSignature is returned when a bundle or bid signature doesn't verify.
+var ErrBadSignature = errors.New("bad signature")
+
+// VerifyBundle verifies the bundle's signature against its public key. It's
+// intended for use by builder API implementations, which must separately
+// check that the public key controls the searcher address.
+func VerifyBundle(b *Bundle) error {
+	return verify(b.KeyType, b.PublicKey, b.SignBytes(), b.Signature)
+}
+
+// VerifyBid verifies the bid's signature against its public key, and that its
+// payment is well formed. As with VerifyBundle, the public key must be
+// separately checked against the searcher address.
+func VerifyBid(b *Bid) error {
+	if err := validatePayment(b.Payment); err != nil {
+		return err
+	}
+	return verify(b.KeyType, b.PublicKey, b.SignBytes(), b.Signature)
+}
+
+func verify(keyType string, publicKey, msg, sig []byte) error {
+	ok, err := mekabuild.VerifySignature(keyType, publicKey, msg, sig)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func validatePayment(payment string) error {
+	coins, err := mekabuild.ParseCoins(payment)
+	if err != nil {
+		return fmt.Errorf("payment: %w", err)
+	}
+	if len(coins) == 0 {
+		return errors.New("payment: must be positive")
+	}
+	return nil
+}
+
+func mustEncode(w io.Writer, v interface{}) {
+	if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+		panic(fmt.Errorf("encode %T (%v): %w", v, v, err))
+	}
+}
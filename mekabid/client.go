@@ -0,0 +1,163 @@
+package mekabid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+// Client submits bundles and bids to the builder API on behalf of a searcher.
+type Client struct {
+	client       *http.Client
+	apiURL       *url.URL
+	signer       Signer
+	chainID      string
+	searcherAddr string
+}
+
+// NewClient returns a usable client. The provided HTTP client is used to make
+// requests to the provided builder API URL, typically
+// mekabuild.GetBuilderAPIURL(). Bundles and bids are signed by s, which must
+// hold the key of the given searcher address.
+func NewClient(cli *http.Client, apiURL *url.URL, s Signer, chainID, searcherAddr string) *Client {
+	return &Client{
+		client:       cli,
+		apiURL:       apiURL,
+		signer:       s,
+		chainID:      chainID,
+		searcherAddr: searcherAddr,
+	}
+}
+
+// SubmitResponse is returned by the bundle and bid endpoints of the builder
+// API.
+type SubmitResponse struct {
+	// ID identifies the submission, e.g. for support requests.
+	ID string `json:"id"`
+}
+
+// SubmitBundle signs and submits an ordered list of txs, to be included
+// atomically at the given height.
+func (c *Client) SubmitBundle(ctx context.Context, height int64, txs [][]byte) (*SubmitResponse, error) {
+	b, err := c.newBundle(height, txs)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.Signature, err = c.signer.Sign(b.SignBytes()); err != nil {
+		return nil, fmt.Errorf("sign bundle: %w", err)
+	}
+
+	var resp SubmitResponse
+	if err := c.post(ctx, "/v0/bundle", b, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SubmitBid signs and submits an ordered list of txs, to be included
+// atomically at the given height, with a commitment to pay the given amount,
+// e.g. "1000uatom", if they are.
+func (c *Client) SubmitBid(ctx context.Context, height int64, txs [][]byte, payment string) (*SubmitResponse, error) {
+	if err := validatePayment(payment); err != nil {
+		return nil, err
+	}
+
+	b, err := c.newBundle(height, txs)
+	if err != nil {
+		return nil, err
+	}
+
+	bid := &Bid{Bundle: *b, Payment: payment}
+	if bid.Signature, err = c.signer.Sign(bid.SignBytes()); err != nil {
+		return nil, fmt.Errorf("sign bid: %w", err)
+	}
+
+	var resp SubmitResponse
+	if err := c.post(ctx, "/v0/bid", bid, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AuctionStatus queries the builder API for the state of the auction at the
+// given height, so searchers can check it's open before submitting.
+func (c *Client) AuctionStatus(ctx context.Context, height int64) (*mekabuild.AuctionStatusResponse, error) {
+	if height <= 0 {
+		return nil, fmt.Errorf("height must be positive, have %d", height)
+	}
+
+	req := &mekabuild.AuctionStatusRequest{ChainID: c.chainID, Height: height}
+
+	var resp mekabuild.AuctionStatusResponse
+	if err := c.post(ctx, "/v0/auction_status", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) newBundle(height int64, txs [][]byte) (*Bundle, error) {
+	if height <= 0 {
+		return nil, fmt.Errorf("height must be positive, have %d", height)
+	}
+	if len(txs) == 0 {
+		return nil, errors.New("bundle must have at least one tx")
+	}
+	return &Bundle{
+		ChainID:         c.chainID,
+		Height:          height,
+		SearcherAddress: c.searcherAddr,
+		Txs:             txs,
+		KeyType:         c.signer.KeyType(),
+		PublicKey:       c.signer.PublicKey(),
+	}, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	u := *c.apiURL
+	u.Path = path
+
+	r, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	r.Header.Set("content-type", "application/json")
+	r.Header.Set("zenith-chain-id", c.chainID)
+
+	res, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("execute request: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var resp struct {
+			Error string `json:"error"`
+		}
+
+		if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+			resp.Error = fmt.Errorf("unmarshal error: %w", err).Error()
+		}
+
+		return &mekabuild.StatusError{Code: res.StatusCode, Message: resp.Error}
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package mekabid_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabid"
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx     = context.Background()
+		chainID = "test-chain-id"
+		_, priv = mustGenerateKey(t)
+		signer  = mekabid.NewEd25519Signer(priv)
+		bundles = make(chan *mekabid.Bundle, 1)
+		bids    = make(chan *mekabid.Bid, 1)
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		switch r.URL.Path {
+		case "/v0/bundle":
+			var b mekabid.Bundle
+			if err = json.NewDecoder(r.Body).Decode(&b); err == nil {
+				if err = mekabid.VerifyBundle(&b); err == nil {
+					bundles <- &b
+				}
+			}
+		case "/v0/bid":
+			var b mekabid.Bid
+			if err = json.NewDecoder(r.Body).Decode(&b); err == nil {
+				if err = mekabid.VerifyBid(&b); err == nil {
+					bids <- &b
+				}
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(mekabid.SubmitResponse{ID: r.URL.Path})
+	}))
+	t.Cleanup(server.Close)
+
+	apiURL, _ := url.Parse(server.URL)
+	client := mekabid.NewClient(&http.Client{}, apiURL, signer, chainID, "searcher")
+	txs := [][]byte{[]byte("tx-1"), []byte("tx-2")}
+
+	if _, err := client.SubmitBundle(ctx, 10, txs); err != nil {
+		t.Fatalf("submit bundle: %v", err)
+	}
+
+	b := <-bundles
+	if want, have := int64(10), b.Height; want != have {
+		t.Errorf("bundle height: want %d, have %d", want, have)
+	}
+	if want, have := "searcher", b.SearcherAddress; want != have {
+		t.Errorf("bundle searcher: want %q, have %q", want, have)
+	}
+
+	resp, err := client.SubmitBid(ctx, 11, txs, "1000uatom")
+	if err != nil {
+		t.Fatalf("submit bid: %v", err)
+	}
+
+	if want, have := "/v0/bid", resp.ID; want != have {
+		t.Errorf("bid ID: want %q, have %q", want, have)
+	}
+
+	if want, have := "1000uatom", (<-bids).Payment; want != have {
+		t.Errorf("bid payment: want %q, have %q", want, have)
+	}
+
+	if _, err := client.SubmitBid(ctx, 11, txs, "a lot"); !errors.Is(err, mekabuild.ErrInvalidCoins) {
+		t.Errorf("bad payment: want %v, have %v", mekabuild.ErrInvalidCoins, err)
+	}
+
+	if _, err := client.SubmitBundle(ctx, 0, txs); err == nil {
+		t.Errorf("zero height: want error, have none")
+	}
+}
+
+func TestVerifyBid(t *testing.T) {
+	t.Parallel()
+
+	_, priv := mustGenerateKey(t)
+	signer := mekabid.NewEd25519Signer(priv)
+
+	newBid := func() *mekabid.Bid {
+		bid := &mekabid.Bid{
+			Bundle: mekabid.Bundle{
+				ChainID:         "test-chain-id",
+				Height:          1,
+				SearcherAddress: "searcher",
+				Txs:             [][]byte{[]byte("tx")},
+				PublicKey:       signer.PublicKey(),
+			},
+			Payment: "5uatom",
+		}
+		bid.Signature, _ = signer.Sign(bid.SignBytes())
+		return bid
+	}
+
+	if err := mekabid.VerifyBid(newBid()); err != nil {
+		t.Fatalf("valid bid: %v", err)
+	}
+
+	for name, tamper := range map[string]func(*mekabid.Bid){
+		"payment": func(b *mekabid.Bid) { b.Payment = "1uatom" },
+		"height":  func(b *mekabid.Bid) { b.Height++ },
+		"txs":     func(b *mekabid.Bid) { b.Txs = append(b.Txs, []byte("tx")) },
+		"chain":   func(b *mekabid.Bid) { b.ChainID = "other" },
+	} {
+		bid := newBid()
+		tamper(bid)
+		if err := mekabid.VerifyBid(bid); !errors.Is(err, mekabid.ErrBadSignature) {
+			t.Errorf("%s: want %v, have %v", name, mekabid.ErrBadSignature, err)
+		}
+	}
+
+	// A bid signature must not verify as a bundle signature, or vice versa.
+	bid := newBid()
+	if err := mekabid.VerifyBundle(&bid.Bundle); !errors.Is(err, mekabid.ErrBadSignature) {
+		t.Errorf("bid as bundle: want %v, have %v", mekabid.ErrBadSignature, err)
+	}
+
+	if mekabuild.IsValidatorSignBytes(bid.SignBytes()) || mekabuild.IsValidatorSignBytes(bid.Bundle.SignBytes()) {
+		t.Errorf("searcher sign bytes must not be accepted as validator sign bytes")
+	}
+
+	if !bytes.HasPrefix(bid.SignBytes(), []byte("searcher-bid")) {
+		t.Errorf("bid sign bytes aren't domain separated")
+	}
+}
+
+func mustGenerateKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, priv
+}
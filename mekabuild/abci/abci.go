@@ -0,0 +1,170 @@
+// Package abci adapts the builder client to ABCI++ PrepareProposal, for chains
+// running ABCI 1.0 or later, e.g. Tendermint 0.37 and CometBFT. Rather than
+// patching Tendermint's block executor, the app's PrepareProposal handler
+// delegates to the builder, and gets back the txs of the proposed block.
+//
+// The package mirrors the fields of the ABCI types it uses, so it doesn't
+// depend on Tendermint. Apps convert between their ABCI types and these ones,
+// e.g. for the Cosmos SDK:
+//
+//	prepare, err := abci.NewPrepareProposalHandler(abci.Config{
+//		Builder: builder,
+//		ChainID: chainID,
+//		MaxGas:  maxGas,
+//	})
+//	...
+//	app.SetPrepareProposal(func(ctx sdk.Context, req abcitypes.RequestPrepareProposal) abcitypes.ResponsePrepareProposal {
+//		resp := prepare(ctx, &abci.RequestPrepareProposal{
+//			MaxTxBytes:      req.MaxTxBytes,
+//			Txs:             req.Txs,
+//			Height:          req.Height,
+//			ProposerAddress: req.ProposerAddress,
+//		})
+//		return abcitypes.ResponsePrepareProposal{Txs: resp.Txs}
+//	})
+//
+// On the receiving side, a ProposalVerifier checks proposed blocks against the
+// builder attestation in their first tx, for chains which enforce builder
+// commitments, like payment inclusion, in ProcessProposal.
+package abci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+// RequestPrepareProposal mirrors the fields of the ABCI++
+// RequestPrepareProposal used by the handler.
+type RequestPrepareProposal struct {
+	// MaxTxBytes bounds the total size of the txs of the proposal.
+	MaxTxBytes int64
+
+	// Txs are the txs in the mempool, in mempool order.
+	Txs [][]byte
+
+	Height int64
+
+	// ProposerAddress is the consensus address of the proposer, i.e. this
+	// node's validator.
+	ProposerAddress []byte
+}
+
+// ResponsePrepareProposal mirrors the ABCI++ ResponsePrepareProposal.
+type ResponsePrepareProposal struct {
+	Txs [][]byte
+}
+
+// PrepareProposalHandler returns the txs of the block to propose. It never
+// fails: when the builder fails, it falls back to a locally assembled block,
+// since an error from PrepareProposal halts the node.
+type PrepareProposalHandler func(ctx context.Context, req *RequestPrepareProposal) *ResponsePrepareProposal
+
+// Config configures a PrepareProposalHandler.
+type Config struct {
+	// Builder builds the blocks, typically a *mekabuild.Builder, but also
+	// e.g. a *mekabuild.BuilderSet or *mekabuild.DryRunBuilder.
+	Builder mekabuild.BlockBuilder
+
+	// ChainID is the chain of the blocks.
+	ChainID string
+
+	// ValidatorAddress is the consensus address of the validator. If it's
+	// empty, the proposer address of each request is used.
+	ValidatorAddress string
+
+	// MaxGas is the block gas limit of the chain's consensus params, which
+	// isn't part of the ABCI request. Zero or -1 means unlimited.
+	MaxGas int64
+
+	// Fallback assembles the block when the builder fails, or returns a
+	// block which exceeds MaxTxBytes. Nil means the default Tendermint
+	// behavior, mempool txs in mempool order, up to MaxTxBytes, see
+	// mekabuild.NewMempoolFallback. A fallback error yields an empty block.
+	Fallback mekabuild.Fallback
+
+	// Logger logs fallbacks. Nil means no logging.
+	Logger mekabuild.Logger
+}
+
+// ErrBlockTooLarge is passed to the fallback when the builder returns a block
+// whose txs exceed MaxTxBytes, which Tendermint would reject.
+var ErrBlockTooLarge = errors.New("block exceeds max tx bytes")
+
+// NewPrepareProposalHandler returns a PrepareProposal handler calling BuildBlock
+// on the configured builder, with the limits of each request.
+func NewPrepareProposalHandler(c Config) (PrepareProposalHandler, error) {
+	if c.Builder == nil {
+		return nil, errors.New("builder is required")
+	}
+	if c.ChainID == "" {
+		return nil, errors.New("chain ID is required")
+	}
+	if c.Fallback == nil {
+		c.Fallback = mekabuild.NewMempoolFallback(mekabuild.MempoolOrder)
+	}
+	if c.Logger == nil {
+		c.Logger = nopLogger{}
+	}
+
+	return func(ctx context.Context, req *RequestPrepareProposal) *ResponsePrepareProposal {
+		breq := &mekabuild.BuildBlockRequest{
+			ChainID:          c.ChainID,
+			Height:           req.Height,
+			ValidatorAddress: c.ValidatorAddress,
+			MaxBytes:         req.MaxTxBytes,
+			MaxGas:           c.MaxGas,
+			Txs:              req.Txs,
+		}
+		if breq.ValidatorAddress == "" {
+			breq.ValidatorAddress = fmt.Sprintf("%X", req.ProposerAddress)
+		}
+		if breq.MaxGas < 0 {
+			breq.MaxGas = 0
+		}
+
+		// BuildBlock signs and may modify the request, so the fallback
+		// gets a pristine copy.
+		orig := *breq
+		orig.Txs = append([][]byte(nil), req.Txs...)
+
+		resp, err := c.Builder.BuildBlock(ctx, breq)
+		if err == nil {
+			err = checkSize(resp.Txs, req.MaxTxBytes)
+		}
+		if err == nil {
+			return &ResponsePrepareProposal{Txs: resp.Txs}
+		}
+
+		c.Logger.Errorf("prepare proposal: builder failed, falling back: chain_id=%s height=%d err=%v", c.ChainID, req.Height, err)
+		resp, ferr := c.Fallback.AssembleBlock(&orig, err)
+		if ferr == nil {
+			ferr = checkSize(resp.Txs, req.MaxTxBytes)
+		}
+		if ferr != nil {
+			c.Logger.Errorf("prepare proposal: fallback failed, proposing an empty block: chain_id=%s height=%d err=%v", c.ChainID, req.Height, ferr)
+			return &ResponsePrepareProposal{}
+		}
+		return &ResponsePrepareProposal{Txs: resp.Txs}
+	}, nil
+}
+
+// checkSize returns ErrBlockTooLarge if txs exceed maxTxBytes.
+func checkSize(txs [][]byte, maxTxBytes int64) error {
+	var size int64
+	for _, tx := range txs {
+		size += int64(len(tx))
+	}
+	if maxTxBytes > 0 && size > maxTxBytes {
+		return fmt.Errorf("%w: %d > %d", ErrBlockTooLarge, size, maxTxBytes)
+	}
+	return nil
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
@@ -0,0 +1,121 @@
+package abci_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+	"github.com/meka-dev/mekatek-go/mekabuild/abci"
+	"github.com/meka-dev/mekatek-go/mekabuild/mekatest"
+	"github.com/meka-dev/mekatek-go/mekabuild/signerd"
+)
+
+func TestPrepareProposalHandler(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		proposer  = bytes.Repeat([]byte{0xab}, 20)
+		addr      = fmt.Sprintf("%X", proposer)
+		api       = mekatest.NewAPI()
+		server    = mekatest.NewServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		txs       = [][]byte{[]byte("tx-1"), []byte("tx-2"), []byte("tx-3")}
+	)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.AddPublicKey(chainID, addr, public)
+
+	builder, err := mekabuild.New(&signerd.KeySigner{Address: addr, PrivateKey: private}, chainID, addr, mekabuild.WithEndpoints(apiURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prepare, err := abci.NewPrepareProposalHandler(abci.Config{Builder: builder, ChainID: chainID, MaxGas: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := prepare(ctx, &abci.RequestPrepareProposal{MaxTxBytes: 100, Txs: txs, Height: 1, ProposerAddress: proposer})
+	if want, have := txs, resp.Txs; !reflect.DeepEqual(want, have) {
+		t.Errorf("txs: want %q, have %q", want, have)
+	}
+	builds := api.Builds()
+	if len(builds) != 1 {
+		t.Fatalf("builds: want 1, have %d", len(builds))
+	}
+	if b := builds[0]; b.ChainID != chainID || b.Height != 1 || b.ValidatorAddress != addr || b.MaxBytes != 100 || b.MaxGas != 0 {
+		t.Errorf("build request: have %+v", b)
+	}
+
+	// Failures fall back to mempool txs, up to the max tx bytes.
+	api.FailNext(1, http.StatusInternalServerError)
+	resp = prepare(ctx, &abci.RequestPrepareProposal{MaxTxBytes: 8, Txs: txs, Height: 2, ProposerAddress: proposer})
+	if want, have := txs[:2], resp.Txs; !reflect.DeepEqual(want, have) {
+		t.Errorf("fallback txs: want %q, have %q", want, have)
+	}
+}
+
+func TestPrepareProposalHandlerTooLarge(t *testing.T) {
+	t.Parallel()
+
+	var (
+		txs     = [][]byte{[]byte("tx-1"), []byte("tx-2")}
+		builder = blockBuilderFunc(func(ctx context.Context, req *mekabuild.BuildBlockRequest) (*mekabuild.BuildBlockResponse, error) {
+			return &mekabuild.BuildBlockResponse{Txs: append(req.Txs, []byte("bundle"))}, nil
+		})
+		causes   = make(chan error, 1)
+		fallback = mekabuild.FallbackFunc(func(req *mekabuild.BuildBlockRequest, cause error) (*mekabuild.BuildBlockResponse, error) {
+			causes <- cause
+			if len(req.Txs) != 2 {
+				return nil, fmt.Errorf("fallback request has %d txs", len(req.Txs))
+			}
+			return &mekabuild.BuildBlockResponse{Txs: req.Txs[:1]}, nil
+		})
+	)
+
+	prepare, err := abci.NewPrepareProposalHandler(abci.Config{Builder: builder, ChainID: "chain-id", ValidatorAddress: "validator", Fallback: fallback})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := prepare(context.Background(), &abci.RequestPrepareProposal{MaxTxBytes: 10, Txs: txs, Height: 1})
+	if want, have := txs[:1], resp.Txs; !reflect.DeepEqual(want, have) {
+		t.Errorf("txs: want %q, have %q", want, have)
+	}
+	if cause := <-causes; !errors.Is(cause, abci.ErrBlockTooLarge) {
+		t.Errorf("cause: want %v, have %v", abci.ErrBlockTooLarge, cause)
+	}
+
+	// Fallback failures propose an empty block.
+	prepare, err = abci.NewPrepareProposalHandler(abci.Config{
+		Builder:          builder,
+		ChainID:          "chain-id",
+		ValidatorAddress: "validator",
+		Fallback: mekabuild.FallbackFunc(func(*mekabuild.BuildBlockRequest, error) (*mekabuild.BuildBlockResponse, error) {
+			return nil, errors.New("no")
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := prepare(context.Background(), &abci.RequestPrepareProposal{MaxTxBytes: 10, Txs: txs, Height: 2}); len(resp.Txs) != 0 {
+		t.Errorf("txs: want none, have %q", resp.Txs)
+	}
+}
+
+type blockBuilderFunc func(ctx context.Context, req *mekabuild.BuildBlockRequest) (*mekabuild.BuildBlockResponse, error)
+
+func (f blockBuilderFunc) BuildBlock(ctx context.Context, req *mekabuild.BuildBlockRequest) (*mekabuild.BuildBlockResponse, error) {
+	return f(ctx, req)
+}
@@ -0,0 +1,189 @@
+package abci
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+// RequestProcessProposal mirrors the fields of the ABCI++
+// RequestProcessProposal used by the verifier.
+type RequestProcessProposal struct {
+	// Txs are the txs of the proposed block.
+	Txs [][]byte
+
+	Height int64
+
+	// ProposerAddress is the consensus address of the proposer.
+	ProposerAddress []byte
+}
+
+// VerifierConfig configures a ProposalVerifier.
+type VerifierConfig struct {
+	// ChainID is the chain of the blocks.
+	ChainID string
+
+	// BuilderPublicKeys are the public keys of the builder API trusted to
+	// attest blocks. More than one key allows rotating them.
+	BuilderPublicKeys []ed25519.PublicKey
+
+	// RequireAttestation rejects blocks without a builder attestation.
+	// Otherwise, such blocks are accepted, e.g. blocks assembled by the
+	// proposer's fallback.
+	RequireAttestation bool
+
+	// VerifyPayment checks that the block pays the attested validator
+	// payment, e.g. that it includes the builder's payment tx to the
+	// proposer. It's called with the attested txs, without the attestation
+	// tx nor, for top-of-block builds, the proposer's own txs. Nil means
+	// payments aren't checked.
+	VerifyPayment func(a *mekabuild.BuilderAttestation, txs [][]byte) error
+}
+
+var (
+	// ErrAttestationRequired is the error of verdicts of blocks without a
+	// builder attestation, if it's required.
+	ErrAttestationRequired = errors.New("builder attestation required")
+
+	// ErrAttestationMismatch is the error of verdicts of blocks whose
+	// attestation is for another chain, height, or proposer.
+	ErrAttestationMismatch = errors.New("builder attestation doesn't match the proposal")
+
+	// ErrPaymentNotIncluded wraps the errors of VerifierConfig.VerifyPayment.
+	ErrPaymentNotIncluded = errors.New("attested payment not included")
+)
+
+// ProposalVerdict is the outcome of verifying a proposed block.
+type ProposalVerdict struct {
+	// Attestation is the builder attestation of the block, or nil if the
+	// first tx isn't an attestation tx.
+	Attestation *mekabuild.BuilderAttestation
+
+	// Txs are the txs of the block following the attestation tx, i.e. the
+	// txs to execute, or all txs if the block isn't attested.
+	Txs [][]byte
+
+	// TxsHash is the hash of the attested txs of Txs, i.e. all of them or,
+	// for top-of-block builds, the builder's segment, recomputed with the
+	// attested txs hash version, or nil if the block isn't attested.
+	TxsHash []byte
+
+	// Err is the reason the block should be rejected, or nil. It wraps
+	// ErrAttestationRequired, ErrAttestationMismatch,
+	// mekabuild.ErrBadAttestation, or ErrPaymentNotIncluded.
+	Err error
+}
+
+// Accept returns true if the block should be accepted.
+func (v *ProposalVerdict) Accept() bool {
+	return v.Err == nil
+}
+
+// ProposalVerifier verifies proposed blocks against their builder attestation,
+// for chains which enforce builder commitments in ProcessProposal, e.g.
+//
+//	app.SetProcessProposal(func(ctx sdk.Context, req abcitypes.RequestProcessProposal) abcitypes.ResponseProcessProposal {
+//		v := verifier.Verify(&abci.RequestProcessProposal{
+//			Txs:             req.Txs,
+//			Height:          req.Height,
+//			ProposerAddress: req.ProposerAddress,
+//		})
+//		if !v.Accept() {
+//			return abcitypes.ResponseProcessProposal{Status: abcitypes.ResponseProcessProposal_REJECT}
+//		}
+//		return abcitypes.ResponseProcessProposal{Status: abcitypes.ResponseProcessProposal_ACCEPT}
+//	})
+//
+// Verification is deterministic, as ProcessProposal must be.
+type ProposalVerifier struct {
+	c VerifierConfig
+}
+
+// NewProposalVerifier returns a verifier with the given config.
+func NewProposalVerifier(c VerifierConfig) (*ProposalVerifier, error) {
+	if c.ChainID == "" {
+		return nil, errors.New("chain ID is required")
+	}
+	if len(c.BuilderPublicKeys) == 0 {
+		return nil, errors.New("at least one builder public key is required")
+	}
+	for _, k := range c.BuilderPublicKeys {
+		if len(k) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 public key size %d", len(k))
+		}
+	}
+	return &ProposalVerifier{c: c}, nil
+}
+
+// Verify returns the verdict of the proposed block: it checks that the
+// attestation in its first tx is signed by a trusted builder key, that it's
+// for the chain, height and proposer of the block, and that its txs hash
+// matches the attested txs among the remaining ones, and then verifies the
+// payment.
+func (v *ProposalVerifier) Verify(req *RequestProcessProposal) *ProposalVerdict {
+	a, txs, err := mekabuild.SplitAttestation(req.Txs)
+	if err != nil {
+		return &ProposalVerdict{Txs: req.Txs, Err: fmt.Errorf("%w: %v", mekabuild.ErrBadAttestation, err)}
+	}
+
+	verdict := &ProposalVerdict{Attestation: a, Txs: txs}
+	if a == nil {
+		if v.c.RequireAttestation {
+			verdict.Err = ErrAttestationRequired
+		}
+		return verdict
+	}
+
+	attested, err := a.AttestedTxs(txs)
+	if err != nil {
+		verdict.Err = err
+		return verdict
+	}
+	if verdict.TxsHash, err = mekabuild.HashTxsVersion(a.TxsHashVersion, attested...); err != nil {
+		verdict.Err = fmt.Errorf("%w: %v", mekabuild.ErrBadAttestation, err)
+		return verdict
+	}
+
+	if err := v.checkProposal(a, req); err != nil {
+		verdict.Err = err
+		return verdict
+	}
+
+	err = mekabuild.ErrBadAttestation
+	for _, k := range v.c.BuilderPublicKeys {
+		if err = mekabuild.VerifyBuilderAttestation(a, txs, k); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		verdict.Err = err
+		return verdict
+	}
+
+	if v.c.VerifyPayment != nil {
+		if err := v.c.VerifyPayment(a, attested); err != nil {
+			verdict.Err = fmt.Errorf("%w: %s: %v", ErrPaymentNotIncluded, a.ValidatorPayment, err)
+		}
+	}
+	return verdict
+}
+
+// checkProposal returns ErrAttestationMismatch if the attestation isn't for the
+// chain, height and proposer of the proposal.
+func (v *ProposalVerifier) checkProposal(a *mekabuild.BuilderAttestation, req *RequestProcessProposal) error {
+	if a.ChainID != v.c.ChainID {
+		return fmt.Errorf("%w: chain ID %q, attested %q", ErrAttestationMismatch, v.c.ChainID, a.ChainID)
+	}
+	if a.Height != req.Height {
+		return fmt.Errorf("%w: height %d, attested %d", ErrAttestationMismatch, req.Height, a.Height)
+	}
+	if len(req.ProposerAddress) > 0 {
+		attested, err := mekabuild.NormalizeValidatorAddress(a.ValidatorAddress)
+		if err != nil || attested != fmt.Sprintf("%X", req.ProposerAddress) {
+			return fmt.Errorf("%w: proposer %X, attested %s", ErrAttestationMismatch, req.ProposerAddress, a.ValidatorAddress)
+		}
+	}
+	return nil
+}
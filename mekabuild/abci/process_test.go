@@ -0,0 +1,121 @@
+package abci_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+	"github.com/meka-dev/mekatek-go/mekabuild/abci"
+	"github.com/meka-dev/mekatek-go/mekabuild/mekatest"
+	"github.com/meka-dev/mekatek-go/mekabuild/signerd"
+)
+
+func TestProposalVerifier(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		proposer  = bytes.Repeat([]byte{0xab}, 20)
+		addr      = fmt.Sprintf("%X", proposer)
+		api       = mekatest.NewAPI()
+		server    = mekatest.NewServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		txs       = [][]byte{[]byte("tx-1"), []byte("tx-2")}
+	)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.AddPublicKey(chainID, addr, public)
+
+	builderPublic, builderPrivate, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.SetBuilderKey(builderPrivate)
+	api.SetAttestations(true)
+
+	builder, err := mekabuild.New(&signerd.KeySigner{Address: addr, PrivateKey: private}, chainID, addr, mekabuild.WithEndpoints(apiURL), mekabuild.WithBuilderPublicKey(builderPublic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prepare, err := abci.NewPrepareProposalHandler(abci.Config{Builder: builder, ChainID: chainID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposal := prepare(ctx, &abci.RequestPrepareProposal{MaxTxBytes: 1000, Txs: txs, Height: 1, ProposerAddress: proposer}).Txs
+
+	var paid []string
+	verifier, err := abci.NewProposalVerifier(abci.VerifierConfig{
+		ChainID:           chainID,
+		BuilderPublicKeys: []ed25519.PublicKey{builderPublic},
+		VerifyPayment: func(a *mekabuild.BuilderAttestation, txs [][]byte) error {
+			paid = append(paid, a.ValidatorPayment)
+			if len(txs) != 2 {
+				return errors.New("no payment tx")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := verifier.Verify(&abci.RequestProcessProposal{Txs: proposal, Height: 1, ProposerAddress: proposer})
+	if !v.Accept() {
+		t.Fatalf("verdict: want accept, have %v", v.Err)
+	}
+	if v.Attestation == nil || !bytes.Equal(v.TxsHash, mekabuild.HashTxs(txs...)) || len(v.Txs) != len(txs) {
+		t.Errorf("verdict: have %+v", v)
+	}
+	if len(paid) != 1 || paid[0] == "" {
+		t.Errorf("verified payments: have %q", paid)
+	}
+
+	for _, test := range []struct {
+		name string
+		req  *abci.RequestProcessProposal
+		want error
+	}{
+		{"height", &abci.RequestProcessProposal{Txs: proposal, Height: 2, ProposerAddress: proposer}, abci.ErrAttestationMismatch},
+		{"proposer", &abci.RequestProcessProposal{Txs: proposal, Height: 1, ProposerAddress: bytes.Repeat([]byte{0xcd}, 20)}, abci.ErrAttestationMismatch},
+		{"txs", &abci.RequestProcessProposal{Txs: append(proposal[:2:2], []byte("tx-3")), Height: 1}, mekabuild.ErrBadAttestation},
+		{"truncated", &abci.RequestProcessProposal{Txs: proposal[:2], Height: 1}, mekabuild.ErrBadAttestation},
+		{"malformed", &abci.RequestProcessProposal{Txs: [][]byte{append(mekabuild.AttestationTxPrefix, '{')}, Height: 1}, mekabuild.ErrBadAttestation},
+	} {
+		if v := verifier.Verify(test.req); !errors.Is(v.Err, test.want) {
+			t.Errorf("%s: want %v, have %v", test.name, test.want, v.Err)
+		}
+	}
+
+	// Unattested blocks are accepted, unless attestations are required.
+	if v := verifier.Verify(&abci.RequestProcessProposal{Txs: txs, Height: 1}); !v.Accept() || v.Attestation != nil {
+		t.Errorf("unattested: want accept, have %+v", v)
+	}
+	strict, err := abci.NewProposalVerifier(abci.VerifierConfig{ChainID: chainID, BuilderPublicKeys: []ed25519.PublicKey{builderPublic}, RequireAttestation: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := strict.Verify(&abci.RequestProcessProposal{Txs: txs, Height: 1}); !errors.Is(v.Err, abci.ErrAttestationRequired) {
+		t.Errorf("required: want %v, have %v", abci.ErrAttestationRequired, v.Err)
+	}
+
+	unpaid, err := abci.NewProposalVerifier(abci.VerifierConfig{
+		ChainID:           chainID,
+		BuilderPublicKeys: []ed25519.PublicKey{builderPublic},
+		VerifyPayment:     func(*mekabuild.BuilderAttestation, [][]byte) error { return errors.New("no payment tx") },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := unpaid.Verify(&abci.RequestProcessProposal{Txs: proposal, Height: 1}); !errors.Is(v.Err, abci.ErrPaymentNotIncluded) {
+		t.Errorf("payment: want %v, have %v", abci.ErrPaymentNotIncluded, v.Err)
+	}
+}
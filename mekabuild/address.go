@@ -0,0 +1,255 @@
+package mekabuild
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AddressKind describes how a validator address is encoded.
+type AddressKind int
+
+const (
+	// AddressKindUnknown is an address that isn't recognized as any of the
+	// other kinds. It's passed to the builder API as-is.
+	AddressKindUnknown AddressKind = iota
+
+	// AddressKindHex is a 20 byte consensus address, hex encoded. This is how
+	// Tendermint represents validator addresses, and what the builder API
+	// expects.
+	AddressKindHex
+
+	// AddressKindConsensus is a Bech32 consensus address, with a human
+	// readable part like "cosmosvalcons". It's converted to AddressKindHex.
+	AddressKindConsensus
+
+	// AddressKindOperator is a Bech32 validator operator address, with a
+	// human readable part like "cosmosvaloper". It identifies the operator,
+	// not the consensus key, and can't be converted without chain state.
+	AddressKindOperator
+
+	// AddressKindAccount is any other Bech32 address, typically an account.
+	AddressKindAccount
+)
+
+// String implements fmt.Stringer.
+func (k AddressKind) String() string {
+	switch k {
+	case AddressKindHex:
+		return "hex"
+	case AddressKindConsensus:
+		return "consensus"
+	case AddressKindOperator:
+		return "operator"
+	case AddressKindAccount:
+		return "account"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrAddressKind is returned when a validator address is encoded in a way
+// that can't identify a validator's consensus key.
+var ErrAddressKind = errors.New("validator address must be a consensus address")
+
+// consensusAddressSize is the length of a Tendermint consensus address.
+const consensusAddressSize = 20
+
+// DetectAddressKind returns the kind of the given validator address.
+func DetectAddressKind(addr string) AddressKind {
+	if len(addr) == 2*consensusAddressSize {
+		if _, err := hex.DecodeString(addr); err == nil {
+			return AddressKindHex
+		}
+	}
+
+	hrp, _, err := bech32Decode(addr)
+	if err != nil {
+		return AddressKindUnknown
+	}
+
+	switch {
+	case strings.HasSuffix(hrp, "valcons"):
+		return AddressKindConsensus
+	case strings.HasSuffix(hrp, "valoper"):
+		return AddressKindOperator
+	default:
+		return AddressKindAccount
+	}
+}
+
+// NormalizeValidatorAddress returns the validator address in the form expected
+// by the builder API. Hex addresses are uppercased, and Bech32 consensus
+// addresses are converted to hex. Operator and account addresses return an
+// error wrapping ErrAddressKind. Unrecognized addresses are returned as-is.
+func NormalizeValidatorAddress(addr string) (string, error) {
+	switch kind := DetectAddressKind(addr); kind {
+	case AddressKindHex:
+		return strings.ToUpper(addr), nil
+	case AddressKindConsensus:
+		return ConsensusAddressFromBech32(addr)
+	case AddressKindOperator, AddressKindAccount:
+		return "", fmt.Errorf("%w: %q is an %s address", ErrAddressKind, addr, kind)
+	default:
+		return addr, nil
+	}
+}
+
+// ConsensusAddressFromBech32 converts a Bech32 consensus address, like
+// "cosmosvalcons1...", to an uppercase hex consensus address.
+func ConsensusAddressFromBech32(addr string) (string, error) {
+	hrp, data, err := bech32Decode(addr)
+	if err != nil {
+		return "", fmt.Errorf("decode %q: %w", addr, err)
+	}
+
+	if !strings.HasSuffix(hrp, "valcons") {
+		return "", fmt.Errorf("%w: %q has prefix %q", ErrAddressKind, addr, hrp)
+	}
+
+	if len(data) != consensusAddressSize {
+		return "", fmt.Errorf("consensus address must be %d bytes, have %d", consensusAddressSize, len(data))
+	}
+
+	return strings.ToUpper(hex.EncodeToString(data)), nil
+}
+
+// ConsensusAddressToBech32 converts a hex consensus address to Bech32, using
+// the given human readable part, like "cosmosvalcons".
+func ConsensusAddressToBech32(hrp, addr string) (string, error) {
+	data, err := hex.DecodeString(addr)
+	if err != nil {
+		return "", fmt.Errorf("decode %q: %w", addr, err)
+	}
+
+	if len(data) != consensusAddressSize {
+		return "", fmt.Errorf("consensus address must be %d bytes, have %d", consensusAddressSize, len(data))
+	}
+
+	return bech32Encode(hrp, data)
+}
+
+//
+//
+//
+
+// bech32Charset and the functions below implement Bech32 as per BIP-173.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case")
+	}
+	s = strings.ToLower(s)
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, errors.New("invalid separator position")
+	}
+
+	hrp, rest := s[:sep], s[sep+1:]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, errors.New("invalid human readable part")
+		}
+	}
+
+	values := make([]byte, len(rest))
+	for i := 0; i < len(rest); i++ {
+		idx := strings.IndexByte(bech32Charset, rest[i])
+		if idx < 0 {
+			return "", nil, fmt.Errorf("invalid character %q", rest[i])
+		}
+		values[i] = byte(idx)
+	}
+
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("invalid checksum")
+	}
+
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return hrp, data, nil
+}
+
+func bech32Encode(hrp string, data []byte) (string, error) {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	hrp = strings.ToLower(hrp)
+	polymod := bech32Polymod(append(append(bech32HRPExpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	for i := 0; i < 6; i++ {
+		values = append(values, byte(polymod>>uint(5*(5-i)))&31)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range values {
+		sb.WriteByte(bech32Charset[v])
+	}
+	return sb.String(), nil
+}
+
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var (
+		acc  uint32
+		bits uint
+		mask = uint32(1)<<to - 1
+		out  = make([]byte, 0, len(data)*int(from)/int(to)+1)
+	)
+	for _, v := range data {
+		if uint32(v)>>from != 0 {
+			return nil, errors.New("invalid data range")
+		}
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&mask))
+		}
+	}
+
+	switch {
+	case pad && bits > 0:
+		out = append(out, byte(acc<<(to-bits)&mask))
+	case !pad && (bits >= from || acc<<(to-bits)&mask != 0):
+		return nil, errors.New("invalid padding")
+	}
+
+	return out, nil
+}
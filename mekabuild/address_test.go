@@ -0,0 +1,91 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestNormalizeValidatorAddress(t *testing.T) {
+	const (
+		hexAddr    = "0123456789ABCDEF0123456789ABCDEF01234567"
+		bech32Addr = "cosmosvalcons1qy352euf40x77qfrg4ncn27dauqjx3t8cp02hv"
+	)
+
+	operatorAddr, err := mekabuild.ConsensusAddressToBech32("cosmosvaloper", hexAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accountAddr, err := mekabuild.ConsensusAddressToBech32("cosmos", hexAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		addr string
+		kind mekabuild.AddressKind
+		want string
+		err  error
+	}{
+		{hexAddr, mekabuild.AddressKindHex, hexAddr, nil},
+		{"0123456789abcdef0123456789abcdef01234567", mekabuild.AddressKindHex, hexAddr, nil},
+		{bech32Addr, mekabuild.AddressKindConsensus, hexAddr, nil},
+		{operatorAddr, mekabuild.AddressKindOperator, "", mekabuild.ErrAddressKind},
+		{accountAddr, mekabuild.AddressKindAccount, "", mekabuild.ErrAddressKind},
+		{bech32Addr[:len(bech32Addr)-1] + "q", mekabuild.AddressKindUnknown, bech32Addr[:len(bech32Addr)-1] + "q", nil},
+		{"validator", mekabuild.AddressKindUnknown, "validator", nil},
+	} {
+		t.Run(tc.addr, func(t *testing.T) {
+			if want, have := tc.kind, mekabuild.DetectAddressKind(tc.addr); want != have {
+				t.Errorf("kind: want %s, have %s", want, have)
+			}
+
+			have, err := mekabuild.NormalizeValidatorAddress(tc.addr)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("error: want %v, have %v", tc.err, err)
+			}
+			if want := tc.want; want != have {
+				t.Errorf("address: want %q, have %q", want, have)
+			}
+		})
+	}
+
+	roundTrip, err := mekabuild.ConsensusAddressToBech32("cosmosvalcons", hexAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := bech32Addr, roundTrip; want != have {
+		t.Errorf("round trip: want %q, have %q", want, have)
+	}
+}
+
+func TestBuilderOperatorAddress(t *testing.T) {
+	t.Parallel()
+
+	operatorAddr, err := mekabuild.ConsensusAddressToBech32("cosmosvaloper", "0123456789ABCDEF0123456789ABCDEF01234567")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ctx       = context.Background()
+		key       = newMockKey(t, operatorAddr, nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-id", operatorAddr)
+	)
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: "chain-id", ValidatorAddress: operatorAddr}); !errors.Is(err, mekabuild.ErrAddressKind) {
+		t.Errorf("BuildBlock: want %v, have %v", mekabuild.ErrAddressKind, err)
+	}
+
+	if _, err := builder.Apply(ctx, "payment"); !errors.Is(err, mekabuild.ErrAddressKind) {
+		t.Errorf("Apply: want %v, have %v", mekabuild.ErrAddressKind, err)
+	}
+}
@@ -0,0 +1,203 @@
+package mekabuild
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// AttestationTxPrefix marks the first tx of a block built by the builder API
+// as a builder attestation, so validators can verify the proposed block in
+// ProcessProposal, see BuilderAttestation. It isn't a valid chain tx, so chains
+// which accept attestations must remove it before executing the block, like
+// other txs injected by PrepareProposal.
+var AttestationTxPrefix = []byte("mekatek-attestation/v0:")
+
+// BuilderAttestation is the builder API's signed commitment to the txs of a
+// block and the payment to its proposer. It's embedded in the first tx of the
+// block, and covers the remaining txs, or, for top-of-block builds, the
+// builder's segment of them, see AttestedTxs.
+type BuilderAttestation struct {
+	ChainID          string `json:"chain_id"`
+	Height           int64  `json:"height"`
+	ValidatorAddress string `json:"validator_address"`
+
+	// TxsHash is the hash of the attested txs of the block, with
+	// TxsHashVersion.
+	TxsHash        []byte         `json:"txs_hash"`
+	TxsHashVersion TxsHashVersion `json:"txs_hash_version,omitempty"`
+
+	// TopOfBlock is the number of attested txs following the attestation
+	// tx, for top-of-block builds, whose remaining txs are appended by the
+	// validator. Zero means every tx is attested.
+	TopOfBlock int `json:"top_of_block,omitempty"`
+
+	ValidatorPayment string `json:"validator_payment,omitempty"`
+	AuctionID        string `json:"auction_id,omitempty"`
+
+	// Signature is the builder API's signature over
+	// BuilderAttestationSignBytes.
+	Signature []byte `json:"signature"`
+}
+
+// BuilderAttestationSignBytes returns the bytes signed by the builder API to
+// attest a block for the given parameters. Unlike request sign bytes, they
+// always include the txs hash version.
+func BuilderAttestationSignBytes(chainID string, height int64, validatorAddr string, version TxsHashVersion, txsHash []byte, payment string) []byte {
+	// XXX: As with BuildBlockResponseSignBytes, changing the order or the set
+	// of fields requires updating both the builder API and every verifier.
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`builder-attestation`))
+	mustEncode(&sb, uint64(len([]byte(chainID))))
+	mustEncode(&sb, []byte(chainID))
+	mustEncode(&sb, height)
+	mustEncode(&sb, uint64(len([]byte(validatorAddr))))
+	mustEncode(&sb, []byte(validatorAddr))
+	mustEncode(&sb, uint64(version))
+	mustEncode(&sb, uint64(len(txsHash)))
+	mustEncode(&sb, txsHash)
+	mustEncode(&sb, uint64(len([]byte(payment))))
+	mustEncode(&sb, []byte(payment))
+	return sb.Bytes()
+}
+
+// SignBytes returns the bytes signed by the builder API for the attestation.
+// The auction ID and the top-of-block segment length are bound, if set.
+func (a *BuilderAttestation) SignBytes() []byte {
+	signBytes := bindAuctionID(a.AuctionID, BuilderAttestationSignBytes(a.ChainID, a.Height, a.ValidatorAddress, a.TxsHashVersion, a.TxsHash, a.ValidatorPayment))
+	if a.TopOfBlock > 0 {
+		var sb bytes.Buffer
+		mustEncode(&sb, []byte(`top-of-block-`))
+		mustEncode(&sb, uint64(a.TopOfBlock))
+		mustEncode(&sb, signBytes)
+		signBytes = sb.Bytes()
+	}
+	return signBytes
+}
+
+// AttestedTxs returns the txs covered by the attestation, given txs, the txs
+// of the block following the attestation tx: the first TopOfBlock txs, or all
+// of them. It returns an error wrapping ErrBadAttestation if the block has
+// fewer txs than attested.
+func (a *BuilderAttestation) AttestedTxs(txs [][]byte) ([][]byte, error) {
+	switch {
+	case a.TopOfBlock < 0 || a.TopOfBlock > len(txs):
+		return nil, fmt.Errorf("%w: %d txs, attested %d", ErrBadAttestation, len(txs), a.TopOfBlock)
+	case a.TopOfBlock > 0:
+		return txs[:a.TopOfBlock], nil
+	default:
+		return txs, nil
+	}
+}
+
+// Tx encodes the attestation as a tx, i.e. AttestationTxPrefix followed by the
+// JSON encoded attestation.
+func (a *BuilderAttestation) Tx() ([]byte, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, fmt.Errorf("encode attestation: %w", err)
+	}
+	return append(append([]byte(nil), AttestationTxPrefix...), data...), nil
+}
+
+// ParseAttestationTx decodes the attestation in tx. It returns ErrNoAttestation
+// if tx isn't an attestation tx.
+func ParseAttestationTx(tx []byte) (*BuilderAttestation, error) {
+	if !bytes.HasPrefix(tx, AttestationTxPrefix) {
+		return nil, ErrNoAttestation
+	}
+	var a BuilderAttestation
+	if err := json.Unmarshal(tx[len(AttestationTxPrefix):], &a); err != nil {
+		return nil, fmt.Errorf("decode attestation: %w", err)
+	}
+	return &a, nil
+}
+
+// SplitAttestation returns the attestation in the first of txs, and the
+// remaining txs. If the first tx isn't an attestation tx, it returns a nil
+// attestation and txs unchanged.
+func SplitAttestation(txs [][]byte) (*BuilderAttestation, [][]byte, error) {
+	if len(txs) == 0 {
+		return nil, txs, nil
+	}
+	a, err := ParseAttestationTx(txs[0])
+	switch {
+	case errors.Is(err, ErrNoAttestation):
+		return nil, txs, nil
+	case err != nil:
+		return nil, nil, err
+	}
+	return a, txs[1:], nil
+}
+
+// AttestBuildBlockResponse prepends a builder attestation to the txs of resp,
+// signed with the builder API's key. It must precede SignBuildBlockResponse,
+// whose signature covers the attestation tx. For top-of-block builds, only the
+// txs of resp are attested, since the validator appends its own. It's
+// intended for use by builder API implementations.
+func AttestBuildBlockResponse(req *BuildBlockRequest, resp *BuildBlockResponse, privateKey ed25519.PrivateKey) error {
+	txsHash, err := HashTxsVersion(req.TxsHashVersion, resp.Txs...)
+	if err != nil {
+		return err
+	}
+
+	a := &BuilderAttestation{
+		ChainID:          req.ChainID,
+		Height:           req.Height,
+		ValidatorAddress: req.ValidatorAddress,
+		TxsHash:          txsHash,
+		TxsHashVersion:   req.TxsHashVersion,
+		ValidatorPayment: resp.ValidatorPayment,
+		AuctionID:        resp.AuctionID,
+	}
+	if req.Mode == BuildModeTopOfBlock {
+		a.TopOfBlock = len(resp.Txs)
+	}
+	a.Signature = ed25519.Sign(privateKey, a.SignBytes())
+
+	tx, err := a.Tx()
+	if err != nil {
+		return err
+	}
+	resp.Txs = append([][]byte{tx}, resp.Txs...)
+	return nil
+}
+
+// VerifyBuilderAttestation verifies the attestation against the public key of
+// the builder API, and checks that the attested txs of txs, the txs of the
+// block following the attestation tx, match its txs hash. It returns an error
+// wrapping ErrBadAttestation if they don't.
+func VerifyBuilderAttestation(a *BuilderAttestation, txs [][]byte, publicKey ed25519.PublicKey) error {
+	if len(a.Signature) == 0 {
+		return fmt.Errorf("%w: attestation is unsigned", ErrBadAttestation)
+	}
+	if !ed25519.Verify(publicKey, a.SignBytes(), a.Signature) {
+		return fmt.Errorf("%w: bad signature", ErrBadAttestation)
+	}
+
+	attested, err := a.AttestedTxs(txs)
+	if err != nil {
+		return err
+	}
+	txsHash, err := HashTxsVersion(a.TxsHashVersion, attested...)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(txsHash, a.TxsHash) {
+		return fmt.Errorf("%w: txs hash %X, attested %X", ErrBadAttestation, txsHash, a.TxsHash)
+	}
+	return nil
+}
+
+var (
+	// ErrNoAttestation is returned by ParseAttestationTx for txs which
+	// aren't attestation txs.
+	ErrNoAttestation = errors.New("not an attestation tx")
+
+	// ErrBadAttestation is returned when a builder attestation doesn't
+	// verify, or doesn't match the block.
+	ErrBadAttestation = errors.New("bad builder attestation")
+)
@@ -0,0 +1,55 @@
+package mekabuild_test
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderAttestation(t *testing.T) {
+	t.Parallel()
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		req  = &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: "ABCD", TxsHashVersion: mekabuild.TxsHashMerkle}
+		resp = &mekabuild.BuildBlockResponse{Txs: [][]byte{[]byte("tx-1"), []byte("tx-2")}, ValidatorPayment: "1uatom", AuctionID: "auction-1"}
+	)
+	if err := mekabuild.AttestBuildBlockResponse(req, resp, private); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 3, len(resp.Txs); want != have {
+		t.Fatalf("txs: want %d, have %d", want, have)
+	}
+
+	a, txs, err := mekabuild.SplitAttestation(resp.Txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == nil || a.ValidatorPayment != "1uatom" || a.AuctionID != "auction-1" || a.TxsHashVersion != mekabuild.TxsHashMerkle {
+		t.Fatalf("attestation: have %+v", a)
+	}
+	if err := mekabuild.VerifyBuilderAttestation(a, txs, public); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+
+	if err := mekabuild.VerifyBuilderAttestation(a, txs[1:], public); !errors.Is(err, mekabuild.ErrBadAttestation) {
+		t.Errorf("other txs: want %v, have %v", mekabuild.ErrBadAttestation, err)
+	}
+	a.ValidatorPayment = "2uatom"
+	if err := mekabuild.VerifyBuilderAttestation(a, txs, public); !errors.Is(err, mekabuild.ErrBadAttestation) {
+		t.Errorf("other payment: want %v, have %v", mekabuild.ErrBadAttestation, err)
+	}
+
+	if a, have, err := mekabuild.SplitAttestation(txs); a != nil || len(have) != len(txs) || err != nil {
+		t.Errorf("unattested: have %v, %d txs, %v", a, len(have), err)
+	}
+	if _, err := mekabuild.ParseAttestationTx([]byte("tx")); !errors.Is(err, mekabuild.ErrNoAttestation) {
+		t.Errorf("parse: want %v, have %v", mekabuild.ErrNoAttestation, err)
+	}
+}
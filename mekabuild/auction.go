@@ -0,0 +1,66 @@
+package mekabuild
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AuctionStatusRequest is sent to the auction status endpoint of the builder
+// API, to query the auction for a specific height.
+type AuctionStatusRequest struct {
+	ChainID string `json:"chain_id"`
+	Height  int64  `json:"height"`
+}
+
+// AuctionStatusResponse is returned by the auction status endpoint of the
+// builder API. It describes the state of the auction for a height.
+type AuctionStatusResponse struct {
+	ChainID string `json:"chain_id"`
+	Height  int64  `json:"height"`
+
+	// Open is true while the auction accepts bids and bundles.
+	Open bool `json:"open"`
+
+	// CloseTimeMillis is when the auction closes, or closed, in Unix
+	// milliseconds, or 0 if it isn't scheduled yet.
+	CloseTimeMillis int64 `json:"close_time_ms,omitempty"`
+
+	// Participation stats, as of the time of the response.
+	Searchers  int64 `json:"searchers"`
+	Bids       int64 `json:"bids"`
+	Bundles    int64 `json:"bundles"`
+	TopPayment Coins `json:"top_payment,omitempty"`
+}
+
+// CloseTime returns when the auction closes, or the zero time if it isn't
+// scheduled yet.
+func (r *AuctionStatusResponse) CloseTime() time.Time {
+	if r.CloseTimeMillis == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, r.CloseTimeMillis*int64(time.Millisecond))
+}
+
+var auctionStatusEndpoint = Endpoint{Path: "/v0/auction_status"}
+
+// AuctionStatus queries the builder API for the state of the auction at the
+// given height. An empty chain ID means the builder's chain.
+func (b *Builder) AuctionStatus(ctx context.Context, chainID string, height int64) (*AuctionStatusResponse, error) {
+	if chainID == "" {
+		chainID = b.chainID
+	}
+
+	if height <= 0 {
+		return nil, fmt.Errorf("height must be positive, have %d", height)
+	}
+
+	req := &AuctionStatusRequest{ChainID: chainID, Height: height}
+
+	var resp AuctionStatusResponse
+	if err := b.Call(ctx, auctionStatusEndpoint, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
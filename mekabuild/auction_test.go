@@ -0,0 +1,73 @@
+package mekabuild_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderAuctionStatus(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx     = context.Background()
+		chainID = "test-chain-id"
+		closeAt = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		server  = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req mekabuild.AuctionStatusRequest
+			if r.URL.Path != "/v0/auction_status" || json.NewDecoder(r.Body).Decode(&req) != nil {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(mekabuild.AuctionStatusResponse{
+				ChainID:         req.ChainID,
+				Height:          req.Height,
+				Open:            req.Height > 10,
+				CloseTimeMillis: closeAt.UnixNano() / int64(time.Millisecond),
+				Searchers:       2,
+				Bids:            3,
+			})
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, nil, chainID, "")
+	)
+
+	status, err := builder.AuctionStatus(ctx, "", 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := chainID, status.ChainID; want != have {
+		t.Errorf("chain ID: want %q, have %q", want, have)
+	}
+	if want, have := true, status.Open; want != have {
+		t.Errorf("open: want %v, have %v", want, have)
+	}
+	if want, have := closeAt, status.CloseTime(); !want.Equal(have) {
+		t.Errorf("close time: want %s, have %s", want, have)
+	}
+	if want, have := int64(3), status.Bids; want != have {
+		t.Errorf("bids: want %d, have %d", want, have)
+	}
+
+	status, err = builder.AuctionStatus(ctx, "other-chain", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := "other-chain", status.ChainID; want != have {
+		t.Errorf("chain ID: want %q, have %q", want, have)
+	}
+	if want, have := false, status.Open; want != have {
+		t.Errorf("open: want %v, have %v", want, have)
+	}
+
+	if _, err := builder.AuctionStatus(ctx, "", 0); err == nil {
+		t.Errorf("zero height: want error, have none")
+	}
+}
@@ -0,0 +1,265 @@
+package mekabuild
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Some builder API deployments, e.g. private relays, restrict access beyond
+// verifying request signatures, with an API key, a client TLS certificate, or
+// both. Credentials provide them, and are consulted on every request, so they
+// can be rotated without restarting the validator.
+
+// APIKeyHeader is the HTTP header carrying the API key.
+const APIKeyHeader = "mekatek-api-key"
+
+// Credentials authenticate the builder to the builder API. Implementations
+// must be safe for concurrent use.
+type Credentials interface {
+	// APIKey returns the API key sent with every request, or an empty
+	// string for none.
+	APIKey() (string, error)
+
+	// ClientCertificate returns the certificate presented in TLS
+	// handshakes, or nil for none.
+	ClientCertificate() (*tls.Certificate, error)
+}
+
+// StaticCredentials are fixed credentials. Either field may be empty.
+type StaticCredentials struct {
+	Key         string
+	Certificate *tls.Certificate
+}
+
+// APIKey implements Credentials.
+func (c StaticCredentials) APIKey() (string, error) { return c.Key, nil }
+
+// ClientCertificate implements Credentials.
+func (c StaticCredentials) ClientCertificate() (*tls.Certificate, error) { return c.Certificate, nil }
+
+// SetCredentials configures the builder to authenticate with c. If c provides
+// a client certificate, the builder's HTTP client is copied, with a transport
+// that presents it, so the client passed to NewBuilder or WithHTTPClient isn't
+// modified. That requires the transport to be an *http.Transport, so
+// credentials must be set before decorating the client, e.g. with
+// WithUserAgent. Replacing the client isn't safe while requests are in flight,
+// so credentials with a client certificate should be set before the builder is
+// used, and rotated by the Credentials implementation, e.g. FileCredentials.
+// A nil c removes the API key, but not the client certificate.
+func (b *Builder) SetCredentials(c Credentials) error {
+	if c != nil {
+		cert, err := c.ClientCertificate()
+		if err != nil {
+			return fmt.Errorf("load client certificate: %w", err)
+		}
+		if cert != nil {
+			if err := b.presentClientCertificate(c); err != nil {
+				return err
+			}
+		}
+	}
+	b.credentials.Store(credentialsBox{c})
+	return nil
+}
+
+// WithCredentials configures the builder to authenticate with c. See
+// SetCredentials.
+func WithCredentials(c Credentials) Option {
+	return func(b *Builder) error {
+		return b.SetCredentials(c)
+	}
+}
+
+func (b *Builder) getCredentials() Credentials {
+	box, _ := b.credentials.Load().(credentialsBox)
+	return box.Credentials
+}
+
+type credentialsBox struct{ Credentials }
+
+// presentClientCertificate replaces the builder's HTTP client with a copy
+// whose transport presents the client certificate provided by c.
+func (b *Builder) presentClientCertificate(c Credentials) error {
+	var t *http.Transport
+	switch rt := b.client.Transport.(type) {
+	case nil:
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		t = rt.Clone()
+	default:
+		return fmt.Errorf("can't configure client certificates on transport %T", rt)
+	}
+
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		cert, err := c.ClientCertificate()
+		if err != nil {
+			return nil, err
+		}
+		if cert == nil {
+			return &tls.Certificate{}, nil // no certificate, see tls.Config
+		}
+		return cert, nil
+	}
+
+	cli := *b.client
+	cli.Transport = t
+	b.client = &cli
+	return nil
+}
+
+// setAPIKey sets the API key header, if the builder has credentials.
+func (b *Builder) setAPIKey(hdr http.Header) error {
+	c := b.getCredentials()
+	if c == nil {
+		return nil
+	}
+	key, err := c.APIKey()
+	if err != nil {
+		return fmt.Errorf("load API key: %w", err)
+	}
+	if key != "" {
+		hdr.Set(APIKeyHeader, key)
+	}
+	return nil
+}
+
+// DefaultCredentialsCheckInterval is how often FileCredentials check their
+// files for changes, unless configured otherwise.
+const DefaultCredentialsCheckInterval = 10 * time.Second
+
+// FileCredentials are credentials read from files, and reloaded when the files
+// change, e.g. when a certificate is renewed by cert-manager or certbot, or a
+// key is rotated by a secrets manager. Files are checked for changes on use,
+// at most once per CheckInterval.
+//
+// If reloading fails, e.g. because a certificate was replaced before its key,
+// the previous credentials remain in use, and reloading is tried again at the
+// next check. See Err.
+type FileCredentials struct {
+	// CheckInterval is the minimum interval between checks for changes.
+	// Zero means files are checked on every use. It must be set before
+	// the credentials are used.
+	CheckInterval time.Duration
+
+	certFile, keyFile, apiKeyFile string
+
+	mtx     sync.Mutex
+	checked time.Time
+	modTime [3]time.Time // of the cert, key, and API key files
+	cert    *tls.Certificate
+	apiKey  string
+	err     error
+}
+
+var _ Credentials = (*FileCredentials)(nil)
+
+// NewFileCredentials reads credentials from the given files. The certificate
+// and key files are PEM encoded, and either both or neither must be given.
+// The API key file contains the API key, surrounding whitespace is ignored.
+// Empty file names mean the corresponding credential isn't used.
+func NewFileCredentials(certFile, keyFile, apiKeyFile string) (*FileCredentials, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("certificate and key files must be given together")
+	}
+	c := &FileCredentials{
+		CheckInterval: DefaultCredentialsCheckInterval,
+		certFile:      certFile,
+		keyFile:       keyFile,
+		apiKeyFile:    apiKeyFile,
+	}
+	if err := c.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// APIKey implements Credentials.
+func (c *FileCredentials) APIKey() (string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.maybeReload()
+	return c.apiKey, nil
+}
+
+// ClientCertificate implements Credentials.
+func (c *FileCredentials) ClientCertificate() (*tls.Certificate, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.maybeReload()
+	return c.cert, nil
+}
+
+// Err returns the error of the last failed reload, or nil if the credentials
+// in use are up to date with the files.
+func (c *FileCredentials) Err() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.err
+}
+
+func (c *FileCredentials) maybeReload() {
+	now := time.Now()
+	if now.Sub(c.checked) < c.CheckInterval {
+		return
+	}
+	c.err = c.reload(now)
+}
+
+// reload reads the files whose modification time changed since they were last
+// read. Credentials are only replaced if every changed file reads cleanly.
+func (c *FileCredentials) reload(now time.Time) error {
+	c.checked = now
+
+	var (
+		files   = [3]string{c.certFile, c.keyFile, c.apiKeyFile}
+		modTime [3]time.Time
+		changed bool
+	)
+	for i, name := range files {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		modTime[i] = fi.ModTime()
+		changed = changed || !modTime[i].Equal(c.modTime[i])
+	}
+	if !changed {
+		return nil
+	}
+
+	var (
+		cert   *tls.Certificate
+		apiKey string
+	)
+	if c.certFile != "" {
+		loaded, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return fmt.Errorf("load client certificate: %w", err)
+		}
+		cert = &loaded
+	}
+	if c.apiKeyFile != "" {
+		data, err := os.ReadFile(c.apiKeyFile)
+		if err != nil {
+			return fmt.Errorf("load API key: %w", err)
+		}
+		if apiKey = string(bytes.TrimSpace(data)); apiKey == "" {
+			return fmt.Errorf("load API key: %s is empty", c.apiKeyFile)
+		}
+	}
+
+	c.cert, c.apiKey, c.modTime = cert, apiKey, modTime
+	return nil
+}
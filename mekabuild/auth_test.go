@@ -0,0 +1,188 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestAPIKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx    = context.Background()
+		key    = newMockKey(t, "validator", nil)
+		keys   = make(chan string, 1)
+		server = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keys <- r.Header.Get(mekabuild.APIKeyHeader)
+			w.Write([]byte(`{}`))
+		}))
+		apiURL, _  = url.Parse(server.URL)
+		apiKeyFile = filepath.Join(t.TempDir(), "api-key")
+		modTime    = time.Now()
+		writeKey   = func(apiKey string) {
+			t.Helper()
+			if err := os.WriteFile(apiKeyFile, []byte(apiKey), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			modTime = modTime.Add(time.Minute) // coarse filesystem timestamps
+			if err := os.Chtimes(apiKeyFile, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	)
+
+	writeKey("key-1\n")
+	creds, err := mekabuild.NewFileCredentials("", "", apiKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds.CheckInterval = 0
+
+	builder, err := mekabuild.New(key, "chain-id", key.addr, mekabuild.WithEndpoints(apiURL), mekabuild.WithCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"key-1", "key-2", "key-2"} {
+		if want == "key-2" {
+			writeKey(want)
+		}
+		if _, err := builder.Ping(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if have := <-keys; want != have {
+			t.Errorf("API key: want %q, have %q", want, have)
+		}
+	}
+
+	writeKey("  ")
+	if _, err := builder.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "key-2", <-keys; want != have {
+		t.Errorf("after failed reload: want %q, have %q", want, have)
+	}
+	if creds.Err() == nil {
+		t.Errorf("failed reload: want error, have none")
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx    = context.Background()
+		key    = newMockKey(t, "validator", nil)
+		caCert = newCertificate(t, nil)
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{}`))
+		}))
+		dir = t.TempDir()
+	)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert.Leaf)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	apiURL, _ := url.Parse(server.URL)
+
+	anonymous, err := mekabuild.New(key, "chain-id", key.addr, mekabuild.WithHTTPClient(server.Client()), mekabuild.WithEndpoints(apiURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := anonymous.Ping(ctx); err == nil {
+		t.Fatalf("without client certificate: want error, have none")
+	}
+
+	clientCert := newCertificate(t, caCert)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	keyDER, err := x509.MarshalPKCS8PrivateKey(clientCert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCert.Certificate[0]}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	creds, err := mekabuild.NewFileCredentials(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := server.Client()
+	builder, err := mekabuild.New(key, "chain-id", key.addr,
+		mekabuild.WithHTTPClient(client),
+		mekabuild.WithCredentials(creds),
+		mekabuild.WithEndpoints(apiURL),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.Ping(ctx); err != nil {
+		t.Errorf("with client certificate: %v", err)
+	}
+	if client.Transport.(*http.Transport).TLSClientConfig.GetClientCertificate != nil {
+		t.Errorf("client passed to WithHTTPClient was modified")
+	}
+
+	if _, err := mekabuild.New(key, "chain-id", key.addr,
+		mekabuild.WithUserAgent("test"),
+		mekabuild.WithCredentials(creds),
+	); err == nil {
+		t.Errorf("decorated transport: want error, have none")
+	}
+}
+
+// newCertificate returns a certificate signed by parent, or a self-signed CA
+// certificate if parent is nil.
+func newCertificate(t *testing.T, parent *tls.Certificate) *tls.Certificate {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "validator"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	var (
+		signer     interface{} = priv
+		parentCert             = tmpl
+	)
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		signer, parentCert = parent.PrivateKey, parent.Leaf
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &priv.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv, Leaf: leaf}
+}
@@ -0,0 +1,75 @@
+package mekabuild
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCircuitOpen is returned by BuildBlock while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// SetCircuitBreaker configures the builder to stop sending build requests for
+// the cooldown duration after threshold consecutive failures, and fail fast
+// with ErrCircuitOpen instead. That way a slow or failing builder API doesn't
+// consume the entire proposal timeout at every height. After the cooldown,
+// requests are sent again, and a single failure reopens the circuit.
+//
+// A threshold of zero, the default, disables the circuit breaker.
+func (b *Builder) SetCircuitBreaker(threshold int, cooldown time.Duration) error {
+	if threshold < 0 {
+		return fmt.Errorf("threshold must not be negative, have %d", threshold)
+	}
+	if cooldown < 0 {
+		return fmt.Errorf("cooldown must not be negative, have %s", cooldown)
+	}
+	atomic.StoreInt64(&b.breakerCooldown, int64(cooldown))
+	atomic.StoreInt32(&b.breakerThreshold, int32(threshold))
+	return nil
+}
+
+// WithCircuitBreaker configures the builder's circuit breaker. See
+// SetCircuitBreaker.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(b *Builder) error {
+		return b.SetCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// CircuitOpen returns true if the circuit breaker is open, i.e. build requests
+// currently fail fast.
+func (b *Builder) CircuitOpen() bool {
+	return b.now().UnixNano() < atomic.LoadInt64(&b.breakerOpenUntil)
+}
+
+// breakerAllow returns ErrCircuitOpen if the circuit breaker is open.
+func (b *Builder) breakerAllow() error {
+	if atomic.LoadInt32(&b.breakerThreshold) == 0 {
+		return nil
+	}
+	if until := atomic.LoadInt64(&b.breakerOpenUntil); b.now().UnixNano() < until {
+		return fmt.Errorf("%w until %s", ErrCircuitOpen, time.Unix(0, until).UTC().Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// breakerRecord records the outcome of a build request sent to the builder
+// API, opening the circuit after too many consecutive failures.
+func (b *Builder) breakerRecord(err error) {
+	threshold := atomic.LoadInt32(&b.breakerThreshold)
+	if threshold == 0 {
+		return
+	}
+
+	if err == nil {
+		atomic.StoreInt32(&b.breakerFailures, 0)
+		return
+	}
+
+	if failures := atomic.AddInt32(&b.breakerFailures, 1); failures >= threshold {
+		cooldown := time.Duration(atomic.LoadInt64(&b.breakerCooldown))
+		atomic.StoreInt64(&b.breakerOpenUntil, b.now().Add(cooldown).UnixNano())
+		b.getLogger().Errorf("circuit breaker opened: chain_id=%s failures=%d cooldown=%s err=%v", b.chainID, failures, cooldown, err)
+	}
+}
@@ -0,0 +1,78 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx      = context.Background()
+		chainID  = "chain-id"
+		key      = newMockKey(t, "validator", nil)
+		api      = newMockAPI()
+		failing  = int32(1)
+		requests int32
+		server   = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			if atomic.LoadInt32(&failing) == 1 {
+				http.Error(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+				return
+			}
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		cooldown  = 100 * time.Millisecond
+		newReq    = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, ValidatorAddress: key.addr}
+		}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithCircuitBreaker(2, cooldown),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := builder.BuildBlock(ctx, newReq()); err == nil || errors.Is(err, mekabuild.ErrCircuitOpen) {
+			t.Fatalf("request %d: want API error, have %v", i+1, err)
+		}
+	}
+
+	if _, err := builder.BuildBlock(ctx, newReq()); !errors.Is(err, mekabuild.ErrCircuitOpen) {
+		t.Fatalf("request 3: want %v, have %v", mekabuild.ErrCircuitOpen, err)
+	}
+
+	if want, have := int32(2), atomic.LoadInt32(&requests); want != have {
+		t.Errorf("API requests: want %d, have %d", want, have)
+	}
+
+	if h := builder.Health(); !h.CircuitOpen || h.Ready {
+		t.Errorf("health: want circuit open and not ready, have %+v", h)
+	}
+
+	time.Sleep(cooldown)
+	atomic.StoreInt32(&failing, 0)
+
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Fatalf("after cooldown: %v", err)
+	}
+
+	if builder.CircuitOpen() {
+		t.Errorf("circuit open after successful request")
+	}
+}
@@ -0,0 +1,68 @@
+package mekabuild
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DeadlineBudget derives the timeout of each call to the builder API from the
+// time remaining on the caller's context, rather than a fixed duration. That
+// keeps the builder client safe across chains with very different proposal
+// timeouts, e.g. by allowing 80% of the remaining time, leaving the rest to
+// fall back to a locally assembled block.
+type DeadlineBudget struct {
+	// Fraction of the remaining time allowed for each call, in (0, 1].
+	Fraction float64
+
+	// Max caps the timeout, and applies when the caller's context has no
+	// deadline. Zero means no cap.
+	Max time.Duration
+}
+
+// SetDeadlineBudget configures the builder's deadline budget. A zero budget,
+// the default, disables it. If a timeout is also set via SetTimeout, the
+// shorter of the two applies.
+func (b *Builder) SetDeadlineBudget(db DeadlineBudget) error {
+	if db != (DeadlineBudget{}) && (db.Fraction <= 0 || db.Fraction > 1) {
+		return fmt.Errorf("fraction must be in (0, 1], have %v", db.Fraction)
+	}
+	if db.Max < 0 {
+		return fmt.Errorf("max must not be negative, have %s", db.Max)
+	}
+	b.deadlineBudget.Store(db)
+	return nil
+}
+
+// WithDeadlineBudget configures the builder's deadline budget. See
+// SetDeadlineBudget.
+func WithDeadlineBudget(fraction float64, max time.Duration) Option {
+	return func(b *Builder) error {
+		return b.SetDeadlineBudget(DeadlineBudget{Fraction: fraction, Max: max})
+	}
+}
+
+// callTimeout returns the timeout for a call to the builder API made with ctx,
+// considering the static timeout and the deadline budget, or 0 for none. The
+// caller's deadline applies regardless.
+func (b *Builder) callTimeout(ctx context.Context) time.Duration {
+	timeout := time.Duration(atomic.LoadInt64(&b.timeout))
+
+	db, _ := b.deadlineBudget.Load().(DeadlineBudget)
+	if db == (DeadlineBudget{}) {
+		return timeout
+	}
+
+	budget := db.Max
+	if deadline, ok := ctx.Deadline(); ok {
+		if d := time.Duration(float64(b.until(deadline)) * db.Fraction); budget == 0 || d < budget {
+			budget = d
+		}
+	}
+
+	if budget > 0 && (timeout == 0 || budget < timeout) {
+		return budget
+	}
+	return timeout
+}
@@ -0,0 +1,77 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderDeadlineBudget(t *testing.T) {
+	t.Parallel()
+
+	var (
+		release = make(chan struct{})
+		server  = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		key       = newMockKey(t, "validator", nil)
+	)
+	defer server.Close()
+	defer close(release)
+
+	for _, tc := range []struct {
+		name     string
+		fraction float64
+		max      time.Duration
+		deadline time.Duration
+		want     time.Duration
+	}{
+		{"fraction", 0.5, 0, 400 * time.Millisecond, 200 * time.Millisecond},
+		{"capped", 0.5, 100 * time.Millisecond, 400 * time.Millisecond, 100 * time.Millisecond},
+		{"no deadline", 0.5, 100 * time.Millisecond, 0, 100 * time.Millisecond},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			builder, err := mekabuild.New(key, "chain-id", key.addr,
+				mekabuild.WithEndpoints(apiURL),
+				mekabuild.WithDeadlineBudget(tc.fraction, tc.max),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			if tc.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.deadline)
+				defer cancel()
+			}
+
+			begin := time.Now()
+			_, err = builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: "chain-id", ValidatorAddress: key.addr})
+			took := time.Since(begin)
+
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("want %v, have %v", context.DeadlineExceeded, err)
+			}
+
+			if took < tc.want || took > tc.want+150*time.Millisecond {
+				t.Errorf("took %s, want about %s", took, tc.want)
+			}
+
+			if ctx.Err() != nil {
+				t.Errorf("caller's context expired, so the budget wasn't applied")
+			}
+		})
+	}
+
+	if _, err := mekabuild.New(key, "chain-id", key.addr, mekabuild.WithDeadlineBudget(1.5, 0)); err == nil {
+		t.Errorf("fraction above 1: want error, have none")
+	}
+}
@@ -1,14 +1,21 @@
 package mekabuild
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Builder provides an interface to the builder API for validators. It's
@@ -17,14 +24,95 @@ import (
 //
 // Builders, like all types and functions in this package, are constructed and
 // managed within Tendermint, and shouldn't need to be used directly.
+//
+// Builders are safe for concurrent use, including the Set methods, which may
+// be called while requests are in flight. Calls to the signer are serialized,
+// as private validators typically aren't safe for concurrent use. Requests
+// passed to BuildBlock are normalized and signed in place, so a request must
+// not be shared between concurrent calls.
 type Builder struct {
-	baseurl       *url.URL
-	client        *http.Client
-	signer        Signer
-	chainID       string
-	validatorAddr string
+	capabilities uint64 // atomic, first for 64-bit alignment
+	nonce        uint64 // atomic
+	timeout      int64  // atomic, nanoseconds
+	cacheTTL     int64  // atomic, nanoseconds
+
+	breakerCooldown  int64  // atomic, nanoseconds
+	breakerOpenUntil int64  // atomic, Unix nanoseconds
+	peerPublishedAt  int64  // atomic, Unix nanoseconds
+	statsPersistedAt int64  // atomic, Unix nanoseconds
+	skippedBuilds    uint64 // atomic, builds skipped while disabled or paused
+	pausedUntil      int64  // atomic, Unix nanoseconds
+
+	telemetryInterval int64 // atomic, nanoseconds
+	telemetrySentAt   int64 // atomic, Unix nanoseconds
+
+	endpoints      atomic.Value // []*url.URL
+	client         *http.Client
+	signer         Signer
+	chainID        string
+	validatorAddr  string
+	addrErr        error
+	stats          *statsRegistry
+	negotiated     *capabilityRegistry
+	inflight       inflightGroup
+	store          atomic.Value // storeBox
+	peerExchange   atomic.Value // peerExchangeBox
+	peerStats      atomic.Value // *statsRegistry
+	retryPolicy    atomic.Value // RetryPolicy
+	queue          atomic.Value // queueBox
+	rateLimiter    atomic.Value // rateLimiterBox
+	credentials    atomic.Value // credentialsBox
+	metrics        atomic.Value // metricsBox
+	logger         atomic.Value // loggerBox
+	fallback       atomic.Value // fallbackBox
+	builderKey     atomic.Value // ed25519.PublicKey
+	deadlineBudget atomic.Value // DeadlineBudget
+	lastBuild      atomic.Value // BuildEvent
+	registration   atomic.Value // string
+	domainTag      atomic.Value // string
+	consumerChain  atomic.Value // ConsumerChain
+	disabled       atomic.Value // disabledBox
+	topOfBlock     atomic.Value // topOfBlockBox
+	submitBudget   atomic.Value // submitBudgetBox
+	responseLimits atomic.Value // responseLimitsBox
+	duplicateTxs   atomic.Value // DuplicateTxsPolicy
+	telemetry      telemetryStats
+	clock          atomic.Value // clockBox
+	codec          atomic.Value // codecBox
+	compressor     atomic.Value // compressorBox
+	formatRegistry atomic.Value // formatRegistryBox
+	formats        atomic.Value // []string
+	forcedFormat   atomic.Value // string
+	tracer         atomic.Value // tracerBox
+	apiVersion     atomic.Value // APIVersion
+	apiVersions    atomic.Value // []APIVersion
+	autoRegister   atomic.Value // string, payment address
+	registerMtx    sync.Mutex
+	signMtx        sync.Mutex // serializes calls to the signer
+	presigned      presignCache
+	confirmed      confirmCache
+	errorLog       errorLog
+	random         atomic.Value // randomBox
+	denomResolver  atomic.Value // denomResolverBox
+	denomTraces    denomTraceCache
+	uploadProgress atomic.Value        // uploadProgressBox
+	policy         atomic.Value        // policyBox
+	txFilter       atomic.Value        // txFilterBox
+	ledger         atomic.Value        // ledgerBox
+	recorder       atomic.Value        // recorderBox
+	resolution     *EndpointResolution // set by New, if the URL came from ResolveEndpoint
 
 	disableCompression int32 // atomic
+	compressionLevel   int32 // atomic
+	bufferSize         int32 // atomic
+	expectContinue     int32 // atomic
+	signatureScheme    int32 // atomic
+	breakerThreshold   int32 // atomic
+	breakerFailures    int32 // atomic
+	uploadAbort        int32 // atomic
+	readOnly           int32 // atomic
+	confirmBuilds      int32 // atomic
+	replayProtection   int32 // atomic
 }
 
 // NewBuilder returns a usable builder. The provided HTTP client is used to make
@@ -34,19 +122,58 @@ type Builder struct {
 // the (Mekatek-patched) Tendermint private validator.
 //
 // The validator address should be the public address of the calling validator
-// as represented on chain, which is normally uppercase hex encoded.
+// as represented on chain, which is normally uppercase hex encoded. Bech32
+// consensus addresses are converted to hex. Operator and account addresses
+// can't identify a validator's consensus key, and cause every request made by
+// the builder to fail with an error wrapping ErrAddressKind.
+//
+// Deprecated: Use New with WithHTTPClient and WithEndpoints, which accepts
+// options and reports configuration errors up front. NewBuilder keeps working
+// until its removal, see DeprecatedAPIs.
 func NewBuilder(cli *http.Client, apiURL *url.URL, s Signer, chainID, validatorAddr string) *Builder {
-	return &Builder{
-		baseurl:       apiURL,
+	reportDeprecatedAPI("NewBuilder")
+	return newBuilder(cli, apiURL, s, chainID, validatorAddr)
+}
+
+func newBuilder(cli *http.Client, apiURL *url.URL, s Signer, chainID, validatorAddr string) *Builder {
+	normalizedAddr, addrErr := NormalizeValidatorAddress(validatorAddr)
+	if addrErr != nil {
+		normalizedAddr = validatorAddr
+	}
+
+	b := &Builder{
 		client:        cli,
 		signer:        s,
 		chainID:       chainID,
-		validatorAddr: validatorAddr,
+		validatorAddr: normalizedAddr,
+		addrErr:       addrErr,
+		stats:         newStatsRegistry(),
+		negotiated:    newCapabilityRegistry(),
+
+		capabilities:     uint64(defaultCapabilities),
+		compressionLevel: gzip.DefaultCompression,
+	}
+	b.endpoints.Store([]*url.URL{apiURL})
+	return b
+}
+
+// SetTimeout bounds each call to the builder API, including retries, to the
+// given duration. Zero, the default, means calls are only bound by the
+// caller's context.
+func (b *Builder) SetTimeout(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("timeout must not be negative, have %s", d)
 	}
+	atomic.StoreInt64(&b.timeout, int64(d))
+	return nil
 }
 
 // SetCompression enables or disables compression of HTTP request data from the
 // builder client to the builder API. By default, compression is enabled.
+//
+// Uncompressed requests are sent with identity encoding and a Content-Length,
+// which is fully supported, and useful behind proxies that strip or mangle
+// compressed request bodies.
 func (b *Builder) SetCompression(enabled bool) {
 	if enabled {
 		atomic.StoreInt32(&b.disableCompression, 0)
@@ -55,62 +182,633 @@ func (b *Builder) SetCompression(enabled bool) {
 	}
 }
 
-// BuildBlock submits a build request to the builder API.
-func (b *Builder) BuildBlock(ctx context.Context, req *BuildBlockRequest) (*BuildBlockResponse, error) {
-	if err := b.signer.SignBuildBlockRequest(req); err != nil {
-		return nil, fmt.Errorf("sign request: %w", err)
+// SetCompressionLevel sets the gzip compression level used for request data,
+// trading encoding speed for size. Valid levels are gzip.HuffmanOnly through
+// gzip.BestCompression. By default, gzip.DefaultCompression is used. Small
+// requests, and requests from validators with fast links, typically benefit
+// from gzip.BestSpeed. See SetCompressor for other algorithms.
+func (b *Builder) SetCompressionLevel(level int) error {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return fmt.Errorf("invalid gzip compression level %d", level)
+	}
+	atomic.StoreInt32(&b.compressionLevel, int32(level))
+	return nil
+}
+
+// SetBufferSize sets the size of the buffer between the JSON encoder and the
+// compressor for request data. Larger buffers reduce the number of writes to
+// the compressor when encoding large blocks. A size of 0, the default, means
+// request data is written unbuffered.
+func (b *Builder) SetBufferSize(n int) error {
+	if n < 0 || n > math.MaxInt32 {
+		return fmt.Errorf("invalid buffer size %d", n)
+	}
+	atomic.StoreInt32(&b.bufferSize, int32(n))
+	return nil
+}
+
+// SetExpectContinue enables or disables the Expect: 100-continue header on
+// requests to the builder API. When enabled, the API can reject a request
+// based on its headers, e.g. for an unregistered or rate-limited validator,
+// before the client uploads a potentially large body. Combine it with
+// SignatureSchemeHeader or SignatureSchemeBoth, so the validator address is
+// available in the headers.
+//
+// The HTTP client's transport must have a non-zero ExpectContinueTimeout for
+// this to have any effect, as is the case for http.DefaultTransport. It's
+// disabled by default, as some proxies mishandle it.
+func (b *Builder) SetExpectContinue(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&b.expectContinue, 1)
+	} else {
+		atomic.StoreInt32(&b.expectContinue, 0)
+	}
+}
+
+// SetStore configures the builder to persist endpoint statistics and audit
+// records to the store. Previously persisted statistics are loaded, and merged
+// with any collected so far. By default, nothing is persisted.
+func (b *Builder) SetStore(s Store) error {
+	data, err := s.Get(StoreNamespaceStats, storeKeyEndpoints)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		// first run
+	case err != nil:
+		return fmt.Errorf("load endpoint stats: %w", err)
+	default:
+		var stats []EndpointStats
+		if err := json.Unmarshal(data, &stats); err != nil {
+			return fmt.Errorf("decode endpoint stats: %w", err)
+		}
+		b.stats.merge(stats)
 	}
 
-	var resp BuildBlockResponse
-	if err := b.do(ctx, "/v0/build", req, &resp); err != nil {
+	b.store.Store(storeBox{s})
+	return nil
+}
+
+// SetSignatureScheme controls how request signatures are transmitted to the
+// builder API. By default, signatures are sent in the request body.
+func (b *Builder) SetSignatureScheme(scheme SignatureScheme) {
+	atomic.StoreInt32(&b.signatureScheme, int32(scheme))
+}
+
+// BuildBlock submits a build request to the builder API. If the request fails,
+// and a fallback is configured via SetFallback, the block is assembled locally.
+func (b *Builder) BuildBlock(ctx context.Context, req *BuildBlockRequest) (resp *BuildBlockResponse, err error) {
+	ctx, span := b.startSpan(ctx, SpanBuildBlock,
+		Attribute{AttributeChainID, req.ChainID},
+		Attribute{AttributeHeight, req.Height},
+		Attribute{AttributeTxCount, int64(len(req.Txs))},
+	)
+	defer func() {
+		if resp != nil {
+			span.SetAttributes(Attribute{AttributeFallback, resp.Fallback})
+		}
+		endSpan(span, err)
+	}()
+
+	if ttl, s := time.Duration(atomic.LoadInt64(&b.cacheTTL)), b.getStore(); ttl > 0 && s != nil {
+		resp, err = b.buildBlockCached(ctx, s, ttl, req)
+	} else {
+		resp, err = b.buildBlock(ctx, req)
+	}
+	if err != nil && !errors.Is(err, ErrReadOnly) {
+		return b.assembleFallback(req, err)
+	}
+	return resp, err
+}
+
+// buildBlock sends the build request to the builder API. If the validator
+// isn't registered, and auto registration is enabled, it registers and retries
+// once.
+func (b *Builder) buildBlock(ctx context.Context, req *BuildBlockRequest) (*BuildBlockResponse, error) {
+	orig := *req // before it's normalized and signed
+
+	resp, err := b.buildBlockOnce(ctx, req)
+	if err == nil || !IsNotRegistered(err) {
+		return resp, err
+	}
+
+	b.registration.Store(RegistrationUnregistered)
+
+	paymentAddress, _ := b.autoRegister.Load().(string)
+	if paymentAddress == "" {
+		return nil, err
+	}
+
+	if rerr := b.reregister(ctx, paymentAddress); rerr != nil {
+		return nil, fmt.Errorf("%v; auto register: %w", err, rerr)
+	}
+
+	return b.buildBlockOnce(ctx, &orig)
+}
+
+func (b *Builder) buildBlockOnce(ctx context.Context, req *BuildBlockRequest) (*BuildBlockResponse, error) {
+	if err := b.checkEnabled(req); err != nil {
+		return nil, err
+	}
+
+	ctx, req, hdr, err := b.prepareBuild(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		begin = b.now()
+		resp  BuildBlockResponse
+	)
+	attempts := &buildAttempts{b: b, req: req, hdr: hdr}
+	endpoint, err := b.doAttempts(ctx, "/v0/build", attempts.next, &resp)
+	req = attempts.req // as last sent
+	recordEndpoint(ctx, endpoint)
+	if err == nil {
+		err = b.verifyResponse(req, &resp)
+	}
+	if err == nil {
+		err = b.checkDuplicateTxs(req, &resp)
+	}
+	if err == nil {
+		err = b.filterResponse(req, &resp)
+	}
+	if err == nil {
+		err = b.enforceResponseLimits(req, &resp)
+	}
+	if err == nil && atomic.LoadInt32(&b.confirmBuilds) != 0 {
+		err = b.ConfirmBuild(ctx, req, &resp)
+	}
+	if err == nil {
+		err = b.mergeTopOfBlock(req, &resp)
+	}
+	b.breakerRecord(err)
+	b.audit(begin, endpoint, req, &resp, err)
+	b.recordBuild(b.newBuildEvent(begin, req.Height, endpoint, err))
+	if err != nil {
+		b.getLogger().Errorf("build block failed: chain_id=%s height=%d endpoint=%s took=%s err=%v", req.ChainID, req.Height, endpoint, b.since(begin), err)
 		return nil, err
 	}
 
+	b.getLogger().Infof("build block succeeded: chain_id=%s height=%d endpoint=%s took=%s txs_in=%d txs_out=%d payment=%q", req.ChainID, req.Height, endpoint, b.since(begin), len(req.Txs), len(resp.Txs), resp.ValidatorPayment)
+	b.observePayment(req, &resp)
+
 	return &resp, nil
 }
 
-func (b *Builder) do(ctx context.Context, path string, req, resp interface{}) error {
-	u := b.baseurl
-	u.Path = path
-	uri := u.String()
+// prepareBuild signs the build request, and returns the context, request body
+// and headers that should be used to send it.
+func (b *Builder) prepareBuild(ctx context.Context, req *BuildBlockRequest) (context.Context, *BuildBlockRequest, http.Header, error) {
+	if b.addrErr != nil {
+		return nil, nil, nil, b.addrErr
+	}
 
-	compress := atomic.LoadInt32(&b.disableCompression) != 0
+	if err := b.checkWritable("build block"); err != nil {
+		return nil, nil, nil, err
+	}
 
-	pr, pw := io.Pipe()
-	go func() {
-		switch {
-		case compress: // normal path
-			zw := gzip.NewWriter(pw)
-			enc := json.NewEncoder(zw)
-			if err := enc.Encode(req); err != nil {
-				pw.CloseWithError(err)
-				return
+	if err := b.breakerAllow(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	addr, err := NormalizeValidatorAddress(req.ValidatorAddress)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	req.ValidatorAddress = addr
+
+	b.applyPolicy(req)
+	b.filterRequest(req)
+	b.applySubmitBudget(ctx, req)
+
+	if err := injectTxs(ctx, req); err != nil {
+		return nil, nil, nil, fmt.Errorf("inject txs: %w", err)
+	}
+	if err := b.checkMandatoryTxs(req); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := b.setDomainTag(req); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := b.setConsumerChain(req); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := b.setBuildMode(req); err != nil {
+		return nil, nil, nil, err
+	}
+
+	presigned, err := b.presign(req)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("presign request: %w", err)
+	}
+	if !presigned {
+		if err := b.signBuild(req); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if req.Hint == nil {
+		req.Hint = b.auctionHint(ctx)
+	}
+
+	if req.FeeMarket == nil {
+		req.FeeMarket = feeMarketFrom(ctx)
+	}
+	if req.FeeMarket != nil {
+		if err := req.FeeMarket.Validate(); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid fee market: %w", err)
+		}
+	}
+
+	hdr := http.Header{}
+	setConsensusHeaders(ctx, hdr)
+	req = b.applySignatureScheme(req, hdr)
+
+	ctx = WithPriority(ctx, priorityFrom(ctx, PriorityProposal))
+
+	return ctx, req, hdr, nil
+}
+
+// signBuild sets the request's replay protection, if enabled, and signs it
+// with the builder's signer.
+func (b *Builder) signBuild(req *BuildBlockRequest) error {
+	b.setReplayProtection(req)
+	if err := b.signRequest(req); err != nil {
+		return fmt.Errorf("sign request: %w", err)
+	}
+	return b.checkCosigners(req)
+}
+
+// applySignatureScheme moves the request signature to hdr, or copies it there,
+// according to the signature scheme, and returns the request body to send.
+func (b *Builder) applySignatureScheme(req *BuildBlockRequest, hdr http.Header) *BuildBlockRequest {
+	scheme := SignatureScheme(atomic.LoadInt32(&b.signatureScheme))
+	if scheme.header() {
+		setSignatureHeaders(hdr, req.ValidatorAddress, req.Signature)
+	}
+	if !scheme.body() {
+		body := *req
+		body.Signature = nil
+		req = &body
+	}
+	return req
+}
+
+// signRequest signs the request with the builder's signer.
+func (b *Builder) signRequest(req *BuildBlockRequest) error {
+	if err := b.checkWritable("sign request"); err != nil {
+		return err
+	}
+	b.signMtx.Lock()
+	defer b.signMtx.Unlock()
+	return b.signer.SignBuildBlockRequest(req)
+}
+
+// signChallenge signs the challenge with the builder's signer.
+func (b *Builder) signChallenge(cs ChallengeSigner, challenge []byte) ([]byte, error) {
+	if err := b.checkWritable("sign challenge"); err != nil {
+		return nil, err
+	}
+	b.signMtx.Lock()
+	defer b.signMtx.Unlock()
+	return cs.SignChallenge(challenge)
+}
+
+func (b *Builder) observePayment(req *BuildBlockRequest, resp *BuildBlockResponse) {
+	if m := b.getMetrics(); m != nil {
+		m.ObservePayment(req.ChainID, req.Height, resp.ValidatorPayment)
+	}
+	b.recordReceipt(resp)
+}
+
+func (b *Builder) newBuildEvent(begin time.Time, height int64, endpoint string, err error) BuildEvent {
+	ev := BuildEvent{Time: begin, Height: height, Endpoint: endpoint, Duration: b.since(begin)}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	return ev
+}
+
+// audit records the outcome of a build request, if a store is configured.
+func (b *Builder) audit(begin time.Time, endpoint string, req *BuildBlockRequest, resp *BuildBlockResponse, err error) {
+	var (
+		store    = b.getStore()
+		recorder = b.getRecorder()
+	)
+	if store == nil && recorder == nil {
+		return
+	}
+
+	rec := AuditRecord{Time: begin.UTC(), Duration: b.since(begin), Endpoint: endpoint, Request: req}
+	if err == nil {
+		rec.Response = resp
+	} else {
+		rec.Error = err.Error()
+	}
+	if store != nil {
+		putAuditRecord(store, rec) // best effort
+	}
+	if recorder != nil {
+		if err := recorder.Record(rec); err != nil {
+			b.getLogger().Errorf("record build request failed: chain_id=%s height=%d err=%v", req.ChainID, req.Height, err)
+		}
+	}
+}
+
+func (b *Builder) auctionHint(ctx context.Context) *AuctionHint {
+	var hint AuctionHint
+	if rtt := b.stats.rtt(endpointName(b.orderedEndpoints()[0])); rtt > 0 {
+		hint.RTTMillis = rtt.Milliseconds()
+	}
+	budget := b.callTimeout(ctx)
+	if deadline, ok := ctx.Deadline(); ok && (budget == 0 || b.until(deadline) < budget) {
+		budget = b.until(deadline)
+	}
+	if budget > 0 {
+		hint.TimeBudgetMillis = budget.Milliseconds()
+	}
+	return &hint
+}
+
+// do sends the request to the builder API, failing over between endpoints and
+// retrying according to the retry policy. It returns the last endpoint tried.
+// Paths are v0 routes, which are mapped to the negotiated API version.
+func (b *Builder) do(ctx context.Context, path string, req, resp interface{}, hdr http.Header) (string, error) {
+	return b.doAttempts(ctx, path, func(int) (interface{}, http.Header, error) { return req, hdr, nil }, resp)
+}
+
+// attemptFunc returns the request body and headers of an attempt. Attempts
+// are numbered from 1, across retries and failovers.
+type attemptFunc func(attempt int) (interface{}, http.Header, error)
+
+// doAttempts is like do, but gets the request of every attempt from next, so
+// that requests can be signed afresh for every attempt.
+func (b *Builder) doAttempts(ctx context.Context, path string, next attemptFunc, resp interface{}) (string, error) {
+	if timeout := b.callTimeout(ctx); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	requestID, err := b.newRequestID()
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		policy = b.getRetryPolicy()
+		sent   int
+		send   = func(u *url.URL) error {
+			sent++
+			req, hdr, err := next(sent)
+			if err != nil {
+				return err
+			}
+			hdr = hdr.Clone()
+			if hdr == nil {
+				hdr = http.Header{}
+			}
+			hdr.Set(RequestIDHeader, requestID)
+			return b.attempt(ctx, u, path, req, resp, hdr, policy.PerAttemptTimeout)
+		}
+	)
+	for attempt := 1; ; attempt++ {
+		var (
+			endpoint string
+			err      error
+		)
+		for i, u := range b.orderedEndpoints() {
+			if i > 0 {
+				b.getLogger().Infof("failing over: chain_id=%s path=%s request_id=%s from=%s to=%s err=%v", b.chainID, path, requestID, endpoint, endpointName(u), err)
+			}
+			endpoint = endpointName(u)
+			err = send(u)
+			if connectionLost(ctx, err) {
+				b.getLogger().Infof("connection lost, retrying immediately: chain_id=%s path=%s request_id=%s endpoint=%s err=%v", b.chainID, path, requestID, endpoint, err)
+				err = send(u)
 			}
-			if err := zw.Flush(); err != nil {
-				pw.CloseWithError(err)
-				return
+			if err == nil || !retryable(ctx, err) {
+				return endpoint, err
 			}
+		}
+
+		if attempt >= policy.MaxAttempts {
+			return endpoint, err
+		}
+
+		backoff := policy.backoff(attempt, b.randomFloat())
+		if deadline, ok := ctx.Deadline(); ok && b.until(deadline) < backoff {
+			b.getLogger().Infof("not retrying, deadline too close: chain_id=%s path=%s request_id=%s attempt=%d backoff=%s err=%v", b.chainID, path, requestID, attempt, backoff, err)
+			return endpoint, err // no time left for another attempt
+		}
+
+		b.getLogger().Infof("retrying: chain_id=%s path=%s request_id=%s attempt=%d backoff=%s err=%v", b.chainID, path, requestID, attempt, backoff, err)
+
+		select {
+		case <-b.getClock().After(backoff):
+		case <-ctx.Done():
+			return endpoint, err
+		}
+	}
+}
 
-		case !compress: // usually for tests
-			enc := json.NewEncoder(pw)
-			if err := enc.Encode(req); err != nil {
-				pw.CloseWithError(err)
-				return
+func (b *Builder) attempt(ctx context.Context, base *url.URL, path string, req, resp interface{}, hdr http.Header, timeout time.Duration) error {
+	parent := ctx // to tell the caller giving up from the attempt timing out
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if err := b.rateLimit(path); err != nil {
+		return err
+	}
+
+	if q := b.getRequestQueue(); q != nil {
+		release, err := q.acquire(ctx, priorityFrom(ctx, PriorityBackground))
+		if err != nil {
+			return fmt.Errorf("wait for request slot: %w", err)
+		}
+		defer release()
+	}
+
+	path = b.versionedPath(path)
+	u := *base
+	u.Path = path
+
+	ctx, span := b.startSpan(ctx, SpanRequest,
+		Attribute{AttributeChainID, b.chainID},
+		Attribute{AttributeEndpoint, endpointName(&u)},
+		Attribute{AttributePath, path},
+		Attribute{AttributeRequestID, hdr.Get(RequestIDHeader)},
+	)
+	if t := b.getTracer(); t != nil {
+		hdr = hdr.Clone()
+		t.Inject(ctx, hdr)
+	}
+
+	var (
+		connectMtx   sync.Mutex
+		connectStart = map[string]time.Time{} // dials may race, e.g. dual-stack
+	)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		ConnectStart: func(_, addr string) {
+			connectMtx.Lock()
+			defer connectMtx.Unlock()
+			connectStart[addr] = b.now()
+		},
+		ConnectDone: func(_, addr string, err error) {
+			connectMtx.Lock()
+			defer connectMtx.Unlock()
+			if start, ok := connectStart[addr]; ok && err == nil {
+				b.stats.observeRTT(endpointName(&u), b.since(start))
 			}
+		},
+	})
+
+	var (
+		begin = b.now()
+		t     transfer
+		err   = b.post(ctx, &u, req, resp, hdr, &t)
+		took  = b.since(begin)
+	)
+
+	b.stats.observe(endpointName(&u), took, err, retryable(parent, err), b.now())
+	if err != nil {
+		b.errorLog.add(ErrorSummary{Time: b.now().UTC(), Endpoint: endpointName(&u), Path: path, Error: err.Error()})
+	}
+	span.SetAttributes(
+		Attribute{AttributeStatusCode, int64(t.statusCode)},
+		Attribute{AttributePayloadBytes, atomic.LoadInt64(&t.raw)},
+		Attribute{AttributeWireBytes, atomic.LoadInt64(&t.wire)},
+	)
+	endSpan(span, err)
+	b.getLogger().Debugf("request: chain_id=%s endpoint=%s path=%s request_id=%s status=%d took=%s err=%v", b.chainID, endpointName(&u), path, hdr.Get(RequestIDHeader), t.statusCode, took, err)
+
+	if m := b.getMetrics(); m != nil {
+		m.ObserveRequest(RequestMetrics{
+			ChainID:         b.chainID,
+			Endpoint:        endpointName(&u),
+			Path:            path,
+			Duration:        took,
+			Err:             err,
+			RequestBytes:    atomic.LoadInt64(&t.raw),
+			WireBytes:       atomic.LoadInt64(&t.wire),
+			ResponseBytes:   atomic.LoadInt64(&t.response),
+			StatusCode:      t.statusCode,
+			CompressedBytes: t.compressed(),
+		})
+	}
+
+	b.persistStats()
+	b.publishPeerReport()
+
+	return err
+}
+
+func (b *Builder) getStore() Store {
+	box, _ := b.store.Load().(storeBox)
+	return box.Store
+}
+
+type storeBox struct{ Store }
+
+const storeKeyEndpoints = "endpoints"
+
+// statsPersistInterval is the minimum interval between writes of the endpoint
+// statistics to the store.
+const statsPersistInterval = 10 * time.Second
+
+// persistStats writes the endpoint statistics to the store, if one is set and
+// they were last written more than statsPersistInterval ago. It's best effort,
+// and writes in the background, so requests aren't slowed down by the store.
+func (b *Builder) persistStats() {
+	store := b.getStore()
+	if store == nil {
+		return
+	}
+
+	var (
+		now  = b.now()
+		last = atomic.LoadInt64(&b.statsPersistedAt)
+	)
+	if last != 0 && now.Sub(time.Unix(0, last)) < statsPersistInterval {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&b.statsPersistedAt, last, now.UnixNano()) {
+		return // another request is persisting
+	}
+
+	go func() {
+		data, err := json.Marshal(b.stats.ranked())
+		if err == nil {
+			err = store.Put(StoreNamespaceStats, storeKeyEndpoints, data)
+		}
+		if err != nil {
+			b.getLogger().Debugf("persist endpoint stats failed: chain_id=%s err=%v", b.chainID, err)
 		}
-		pw.Close()
 	}()
+}
+
+func putAuditRecord(s Store, rec AuditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s-%020d-%d", rec.Request.ChainID, rec.Request.Height, rec.Time.UnixNano())
+	return s.Put(StoreNamespaceAudit, key, data)
+}
+
+func (b *Builder) post(ctx context.Context, u *url.URL, req, resp interface{}, hdr http.Header, t *transfer) error {
+	var (
+		endpoint   = endpointName(u)
+		format     = b.requestFormat(endpoint, req)
+		codec      = format.Codec
+		compressor = format.Compressor
+		bufferSize = int(atomic.LoadInt32(&b.bufferSize))
+	)
 
-	r, err := http.NewRequestWithContext(ctx, "POST", uri, pr)
+	t.compress = compressor != nil
+	tracking := b.trackingUploads()
+
+	body, err := requestBody(codec, req, compressor, bufferSize, tracking, t)
+	if err != nil {
+		return err
+	}
+
+	r, err := http.NewRequestWithContext(ctx, methodFrom(ctx), u.String(), body)
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
 
-	r.Header.Set("content-type", "application/json")
+	if tracking {
+		b.trackUpload(ctx, r)
+	}
+
+	for k, vs := range hdr {
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+
+	r.Header.Set("content-type", codec.ContentType())
+	if codec != JSONCodec {
+		r.Header.Set("accept", codec.ContentType()+", "+JSONCodec.ContentType())
+	}
 	r.Header.Set("zenith-chain-id", b.chainID)
+	b.setTimeoutHeader(ctx, r.Header)
+	if err := b.setAPIKey(r.Header); err != nil {
+		return err
+	}
+	r.Header.Set(AcceptVersionHeader, b.acceptVersionHeader())
+	if caps := Capabilities(atomic.LoadUint64(&b.capabilities)); caps != 0 {
+		r.Header.Set(CapabilitiesHeader, caps.String())
+	}
 
-	if compress {
-		r.Header.Set("content-encoding", "gzip")
+	if compressor != nil {
+		r.Header.Set("content-encoding", compressor.Encoding())
+	}
+
+	if atomic.LoadInt32(&b.expectContinue) != 0 {
+		r.Header.Set("expect", "100-continue")
 	}
 
 	res, err := b.client.Do(r)
@@ -120,6 +818,21 @@ func (b *Builder) do(ctx context.Context, path string, req, resp interface{}) er
 
 	defer res.Body.Close()
 
+	t.statusCode = res.StatusCode
+	res.Body = &countingReader{res.Body, &t.response}
+
+	if header := res.Header.Get(CapabilitiesHeader); header != "" {
+		b.observeCapabilities(endpoint, header)
+	}
+
+	if header := res.Header.Get(APIVersionHeader); header != "" {
+		b.observeAPIVersion(header)
+	}
+
+	if deprecation := res.Header.Get("deprecation"); deprecation != "" {
+		reportDeprecatedEndpoint(res.Request.URL.Path, deprecation, res.Header.Get("sunset"), res.Header.Get("link"))
+	}
+
 	if res.StatusCode != http.StatusOK {
 		var resp struct {
 			Error string `json:"error"`
@@ -129,12 +842,102 @@ func (b *Builder) do(ctx context.Context, path string, req, resp interface{}) er
 			resp.Error = fmt.Errorf("unmarshal error: %w", err).Error()
 		}
 
-		return fmt.Errorf("response code %d (%s)", res.StatusCode, resp.Error)
+		return &StatusError{Code: res.StatusCode, Message: resp.Error}
+	}
+
+	if sd, ok := resp.(streamDecoder); ok {
+		return sd.decodeStream(res.Body)
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+	if err := responseCodec(res.Header.Get("content-type"), codec).Decode(res.Body, resp); err != nil {
 		return fmt.Errorf("unmarshal response: %w", err)
 	}
 
 	return nil
 }
+
+// streamDecoder is implemented by response types that consume a streamed
+// response body incrementally.
+type streamDecoder interface {
+	decodeStream(io.Reader) error
+}
+
+// StatusError is returned when the builder API responds with a non-200 status.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("response code %d (%s)", e.Code, e.Message)
+}
+
+// requestBody returns the encoded request body. Compressed bodies are streamed
+// as they're encoded, unless upfront is set. Uncompressed bodies are encoded up
+// front, so they're sent with a Content-Length, and can be resent by the HTTP
+// client if a reused connection fails. Some proxies reject chunked or
+// compressed request bodies.
+func requestBody(codec Codec, req interface{}, compressor Compressor, bufferSize int, upfront bool, t *transfer) (io.Reader, error) {
+	if compressor == nil || upfront {
+		if compressor == nil {
+			bufferSize = 0 // no point buffering writes to a buffer
+		}
+		buf := getBuffer()
+		defer putBuffer(buf)
+		if err := encodeRequest(buf, codec, req, compressor, bufferSize, &t.raw); err != nil {
+			return nil, err
+		}
+		atomic.StoreInt64(&t.wire, int64(buf.Len()))
+
+		// The body may be read by the HTTP client after post returns, so
+		// it's copied out of the pooled buffer, in a single allocation.
+		body := make([]byte, buf.Len())
+		copy(body, buf.Bytes())
+		return bytes.NewReader(body), nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(encodeRequest(&countingWriter{pw, &t.wire}, codec, req, compressor, bufferSize, &t.raw))
+	}()
+	return pr, nil
+}
+
+// encodeRequest writes the encoding of req to w, compressed unless compressor
+// is nil. The number of uncompressed bytes written is added to raw.
+func encodeRequest(w io.Writer, codec Codec, req interface{}, compressor Compressor, bufferSize int, raw *int64) error {
+	var zw io.WriteCloser
+	if compressor != nil {
+		var err error
+		if zw, err = compressor.NewWriter(w); err != nil {
+			return fmt.Errorf("create %s writer: %w", compressor.Encoding(), err)
+		}
+		w = zw
+	}
+
+	var bw *bufio.Writer
+	if bufferSize > 0 {
+		bw = getBufioWriter(w, bufferSize)
+		defer putBufioWriter(bw)
+		w = bw
+	}
+
+	if err := codec.Encode(&countingWriter{w, raw}, req); err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	if bw != nil {
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("flush buffer: %w", err)
+		}
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("close %s writer: %w", compressor.Encoding(), err)
+		}
+	}
+
+	return nil
+}
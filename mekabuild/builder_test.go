@@ -1,6 +1,8 @@
 package mekabuild_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto"
 	"crypto/ed25519"
@@ -8,12 +10,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	mathrand "math/rand"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/meka-dev/mekatek-go/mekabuild"
+	"github.com/meka-dev/mekatek-go/mekabuild/mekatest"
 )
 
 func TestBuilderBuild(t *testing.T) {
@@ -30,7 +36,7 @@ func TestBuilderBuild(t *testing.T) {
 		validatorAddr = keyBar.addr
 	)
 
-	api.addPublicKey(chainID, keyBar.addr, keyBar.PublicKey)
+	api.AddPublicKey(chainID, keyBar.addr, keyBar.PublicKey)
 
 	builder := mekabuild.NewBuilder(client, apiURL, signer, chainID, validatorAddr)
 	resp, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{
@@ -52,66 +58,378 @@ func TestBuilderBuild(t *testing.T) {
 	if want, have := fmt.Sprintf("2 %s coins", chainID), resp.ValidatorPayment; want != have {
 		t.Errorf("payment: want %q, have %q", want, have)
 	}
+
+	stats := builder.EndpointStats()
+	if want, have := 1, len(stats); want != have {
+		t.Fatalf("endpoint count: want %d, have %d", want, have)
+	}
+
+	if want, have := server.URL, stats[0].Endpoint; want != have {
+		t.Errorf("endpoint: want %q, have %q", want, have)
+	}
+
+	if want, have := uint64(1), stats[0].Successes; want != have {
+		t.Errorf("successes: want %d, have %d", want, have)
+	}
 }
 
-//
-//
-//
+func TestBuilderSignatureSchemes(t *testing.T) {
+	for _, scheme := range []mekabuild.SignatureScheme{
+		mekabuild.SignatureSchemeBody,
+		mekabuild.SignatureSchemeHeader,
+		mekabuild.SignatureSchemeBoth,
+	} {
+		var (
+			ctx       = context.Background()
+			chainID   = "test-chain-id"
+			key       = newMockKey(t, "foo", rand.Reader)
+			api       = newMockAPI()
+			server    = newTestServer(t, mekabuild.SignatureHeaderMiddleware(api))
+			apiURL, _ = url.Parse(server.URL)
+		)
+
+		api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+		builder := mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		builder.SetSignatureScheme(scheme)
 
-type mockAPI struct {
-	publicKeys map[string][]byte
-	validators map[string]*mockValidator
+		if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{
+			ChainID:          chainID,
+			Height:           1,
+			ValidatorAddress: key.addr,
+			Txs:              [][]byte{[]byte(`tx1`)},
+		}); err != nil {
+			t.Errorf("scheme %d: %v", scheme, err)
+		}
+	}
 }
 
-func newMockAPI() *mockAPI {
-	return &mockAPI{
-		publicKeys: map[string][]byte{},
-		validators: map[string]*mockValidator{},
+func TestBuilderConsensusState(t *testing.T) {
+	var (
+		ctx     = mekabuild.WithConsensusState(context.Background(), 2, 3*time.Second)
+		key     = newMockKey(t, "foo", rand.Reader)
+		headers = make(chan http.Header, 1)
+		server  = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers <- r.Header
+			fmt.Fprintln(w, `{}`)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-id", key.addr)
+	)
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: "chain-id"}); err != nil {
+		t.Fatal(err)
+	}
+
+	hdr := <-headers
+
+	if want, have := "2", hdr.Get(mekabuild.ConsensusRoundHeader); want != have {
+		t.Errorf("round: want %q, have %q", want, have)
+	}
+
+	if want, have := "3000", hdr.Get(mekabuild.TimeoutProposeHeader); want != have {
+		t.Errorf("timeout propose: want %q, have %q", want, have)
 	}
 }
 
-func (a *mockAPI) addPublicKey(chainID, addr string, publicKey []byte) {
-	a.publicKeys[makeID(chainID, addr)] = publicKey
+func TestBuilderFeeMarket(t *testing.T) {
+	var (
+		fm       = mekabuild.FeeMarket{MinGasPrices: "0.025uatom,0.1ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2", BaseFee: "0.01uatom"}
+		ctx      = mekabuild.WithFeeMarket(context.Background(), fm)
+		key      = newMockKey(t, "foo", rand.Reader)
+		requests = make(chan mekabuild.BuildBlockRequest, 1)
+		server   = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req mekabuild.BuildBlockRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			requests <- req
+			fmt.Fprintln(w, `{}`)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-id", key.addr)
+	)
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: "chain-id"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if req := <-requests; req.FeeMarket == nil || *req.FeeMarket != fm {
+		t.Errorf("fee market: want %+v, have %+v", fm, req.FeeMarket)
+	}
+
+	bad := &mekabuild.BuildBlockRequest{ChainID: "chain-id", FeeMarket: &mekabuild.FeeMarket{MinGasPrices: "uatom"}}
+	if _, err := builder.BuildBlock(ctx, bad); err == nil {
+		t.Errorf("invalid fee market: want error, have none")
+	}
 }
 
-func (a *mockAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/v0/build":
-		var req mekabuild.BuildBlockRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
-			return
+func TestBuilderExpectContinue(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		key     = newMockKey(t, "foo", rand.Reader)
+		expects = make(chan string, 1)
+		server  = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expects <- r.Header.Get("expect")
+			http.Error(w, `{"error":"validator not registered"}`, http.StatusForbidden) // reject before reading the body
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{Transport: http.DefaultTransport}, apiURL, key, "chain-id", key.addr)
+	)
+
+	defer server.Close()
+
+	builder.SetExpectContinue(true)
+
+	_, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{
+		ChainID:          "chain-id",
+		ValidatorAddress: key.addr,
+		Txs:              [][]byte{make([]byte, 1<<20)},
+	})
+	if err == nil || !strings.Contains(err.Error(), "validator not registered") {
+		t.Fatalf("want rejection, have %v", err)
+	}
+
+	if want, have := "100-continue", <-expects; want != have {
+		t.Errorf("expect header: want %q, have %q", want, have)
+	}
+}
+
+func TestBuilderIdentityEncoding(t *testing.T) {
+	type observed struct {
+		contentLength    int64
+		contentEncoding  string
+		transferEncoding []string
+	}
+
+	var (
+		ctx      = context.Background()
+		chainID  = "chain-id"
+		key      = newMockKey(t, "foo", rand.Reader)
+		api      = newMockAPI()
+		requests = make(chan observed, 1)
+		server   = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- observed{r.ContentLength, r.Header.Get("content-encoding"), r.TransferEncoding}
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		metrics   = &mockMetrics{}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	builder.SetCompression(false)
+	builder.SetMetrics(metrics)
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{
+		ChainID:          chainID,
+		ValidatorAddress: key.addr,
+		Txs:              [][]byte{bytes.Repeat([]byte("a"), 10000)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	o := <-requests
+	if o.contentLength <= 0 || len(o.transferEncoding) > 0 {
+		t.Errorf("want Content-Length, have %d (transfer encoding %v)", o.contentLength, o.transferEncoding)
+	}
+	if o.contentEncoding != "" {
+		t.Errorf("want no content encoding, have %q", o.contentEncoding)
+	}
+
+	r := metrics.requests[0]
+	if want, have := o.contentLength, r.WireBytes; want != have {
+		t.Errorf("wire bytes: want %d, have %d", want, have)
+	}
+	if want, have := r.RequestBytes, r.WireBytes; want != have {
+		t.Errorf("request bytes: want %d, have %d", want, have)
+	}
+	if want, have := int64(0), r.CompressedBytes; want != have {
+		t.Errorf("compressed bytes: want %d, have %d", want, have)
+	}
+}
+
+func BenchmarkBuilderCompression(b *testing.B) {
+	const noCompression = -100 // disables compression altogether
+
+	for _, payload := range []struct {
+		name  string
+		count int
+		size  int
+	}{
+		{"small", 10, 250},
+		{"large", 20, 256 << 10},
+	} {
+		txs := make([][]byte, payload.count)
+		for i := range txs {
+			txs[i] = make([]byte, payload.size)
+			mathrand.New(mathrand.NewSource(int64(i))).Read(txs[i][:payload.size/2]) // half incompressible, like wasm
 		}
 
-		id := makeID(req.ChainID, req.ValidatorAddress)
-		publicKey, ok := a.publicKeys[id]
-		if !ok {
-			http.Error(w, "validator not in valset", http.StatusBadRequest)
-			return
+		for _, level := range []int{noCompression, gzip.NoCompression, gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression} {
+			name := fmt.Sprintf("%s/level=%d", payload.name, level)
+			if level == noCompression {
+				name = payload.name + "/uncompressed"
+			}
+			b.Run(name, func(b *testing.B) {
+				var (
+					ctx     = context.Background()
+					chainID = "bench-chain-id"
+					key     = newMockKey(b, "bench", rand.Reader)
+					server  = httptest.NewServer(mekabuild.GunzipRequestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						io.Copy(io.Discard, r.Body)
+						fmt.Fprintln(w, `{"txs":[]}`)
+					})))
+					apiURL, _ = url.Parse(server.URL)
+					builder   = mekabuild.NewBuilder(server.Client(), apiURL, key, chainID, key.addr)
+				)
+				defer server.Close()
+
+				if level == noCompression {
+					builder.SetCompression(false)
+				} else if err := builder.SetCompressionLevel(level); err != nil {
+					b.Fatal(err)
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{
+						ChainID:          chainID,
+						Height:           int64(i),
+						ValidatorAddress: key.addr,
+						Txs:              txs,
+					}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
 		}
+	}
+}
 
-		msg := mekabuild.BuildBlockRequestSignBytes(
-			req.ChainID,
-			req.Height,
-			req.ValidatorAddress,
-			req.MaxBytes,
-			req.MaxGas,
-			mekabuild.HashTxs(req.Txs...),
-		)
-		if !verify(publicKey, msg, req.Signature) {
-			http.Error(w, "bad signature", http.StatusBadRequest)
-			return
+func TestBuilderRegister(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", rand.Reader)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	apply, err := builder.Apply(ctx, "payment-address")
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	if _, err := builder.Register(ctx, "payment-address", apply.Challenge, nil); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	if want, have := "payment-address", registeredAddress(api, chainID, key.addr); want != have {
+		t.Errorf("payment address: want %q, have %q", want, have)
+	}
+
+	if want, have := mekabuild.RegistrationRegistered, builder.Health().Registration; want != have {
+		t.Errorf("registration status: want %q, have %q", want, have)
+	}
+
+	if _, err := builder.Register(ctx, "payment-address", apply.Challenge, nil); err == nil {
+		t.Errorf("challenge reuse: want error, have none")
+	}
+}
+
+func TestBuilderAutoRegister(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", rand.Reader)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		req       = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}
 		}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	api.RequireRegistration(true)
+
+	if _, err := builder.BuildBlock(ctx, req()); !mekabuild.IsNotRegistered(err) {
+		t.Fatalf("without auto register: want not registered error, have %v", err)
+	}
+
+	if want, have := mekabuild.RegistrationUnregistered, builder.Health().Registration; want != have {
+		t.Errorf("registration status: want %q, have %q", want, have)
+	}
 
-		a.validators[id] = &mockValidator{chainID: req.ChainID, validatorAddr: req.ValidatorAddress}
+	builder.SetAutoRegister("payment-address")
 
-		json.NewEncoder(w).Encode(mekabuild.BuildBlockResponse{
-			Txs:              req.Txs,
-			ValidatorPayment: fmt.Sprintf("%d %s coins", len(req.Txs), req.ChainID),
-		})
+	if _, err := builder.BuildBlock(ctx, req()); err != nil {
+		t.Fatalf("with auto register: %v", err)
+	}
 
-	default:
-		http.Error(w, fmt.Sprintf("unknown mock API route %s", r.URL.Path), http.StatusNotFound)
+	status, err := builder.RegistrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := true, status.Registered; want != have {
+		t.Errorf("registered: want %v, have %v", want, have)
+	}
+	if want, have := "payment-address", status.PaymentAddress; want != have {
+		t.Errorf("payment address: want %q, have %q", want, have)
+	}
+}
+
+func TestBuilderUpdateRegistration(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", rand.Reader)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	api.RequireRegistration(true)
+
+	if _, err := builder.UpdateRegistration(ctx, "new-payment-address"); !mekabuild.IsNotRegistered(err) {
+		t.Fatalf("unregistered: want not registered error, have %v", err)
+	}
+
+	apply, err := builder.Apply(ctx, "old-payment-address")
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if _, err := builder.Register(ctx, "old-payment-address", apply.Challenge, nil); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	builder.SetAutoRegister("old-payment-address")
+
+	if _, err := builder.UpdateRegistration(ctx, "new-payment-address"); err != nil {
+		t.Fatalf("update registration: %v", err)
+	}
+	if want, have := "new-payment-address", registeredAddress(api, chainID, key.addr); want != have {
+		t.Errorf("payment address: want %q, have %q", want, have)
+	}
+
+	// Automatic registration uses the new address.
+	api.SetRegistered(chainID, key.addr, "")
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}); err != nil {
+		t.Fatalf("auto register: %v", err)
+	}
+	if want, have := "new-payment-address", registeredAddress(api, chainID, key.addr); want != have {
+		t.Errorf("auto registered payment address: want %q, have %q", want, have)
+	}
+
+	if _, err := builder.UpdateRegistration(ctx, ""); err == nil {
+		t.Errorf("empty payment address: want error, have none")
 	}
 }
 
@@ -119,20 +437,21 @@ func (a *mockAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 //
 //
 
-func newTestServer(t *testing.T, h http.Handler) *httptest.Server {
-	t.Helper()
-	server := httptest.NewServer(mekabuild.GunzipRequestMiddleware(h))
-	t.Cleanup(server.Close)
-	return server
+func newMockAPI() *mekatest.API {
+	return mekatest.NewAPI()
 }
 
-func makeID(chainID, addr string) string {
-	return chainID + ":" + addr
+//
+//
+//
+
+func newTestServer(t *testing.T, h http.Handler) *httptest.Server {
+	return mekatest.NewServer(t, h)
 }
 
-type mockValidator struct {
-	chainID       string
-	validatorAddr string
+func registeredAddress(api *mekatest.API, chainID, addr string) string {
+	paymentAddress, _ := api.Registered(chainID, addr)
+	return paymentAddress
 }
 
 type mockKey struct {
@@ -141,7 +460,7 @@ type mockKey struct {
 	ed25519.PrivateKey
 }
 
-func newMockKey(t *testing.T, addr string, rng io.Reader) *mockKey {
+func newMockKey(t testing.TB, addr string, rng io.Reader) *mockKey {
 	t.Helper()
 	public, private, err := ed25519.GenerateKey(rng)
 	if err != nil {
@@ -155,14 +474,10 @@ func newMockKey(t *testing.T, addr string, rng io.Reader) *mockKey {
 }
 
 func (k *mockKey) SignBuildBlockRequest(r *mekabuild.BuildBlockRequest) error {
-	msg := mekabuild.BuildBlockRequestSignBytes(
-		r.ChainID,
-		r.Height,
-		r.ValidatorAddress,
-		r.MaxBytes,
-		r.MaxGas,
-		mekabuild.HashTxs(r.Txs...),
-	)
+	msg, err := r.SignBytes()
+	if err != nil {
+		return err
+	}
 	sig, err := k.PrivateKey.Sign(nil, msg, crypto.Hash(0))
 	if err != nil {
 		return err
@@ -171,6 +486,28 @@ func (k *mockKey) SignBuildBlockRequest(r *mekabuild.BuildBlockRequest) error {
 	return nil
 }
 
+func (k *mockKey) SignChallenge(challenge []byte) ([]byte, error) {
+	return k.PrivateKey.Sign(nil, mekabuild.ChallengeSignBytes(challenge), crypto.Hash(0))
+}
+
+func (k *mockKey) SignConfirmRequest(r *mekabuild.ConfirmRequest) error {
+	sig, err := k.PrivateKey.Sign(nil, r.SignBytes(), crypto.Hash(0))
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+func (k *mockKey) SignPauseRequest(r *mekabuild.PauseRequest) error {
+	sig, err := k.PrivateKey.Sign(nil, r.SignBytes(), crypto.Hash(0))
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
 func verify(publicKey, msg, sig []byte) bool {
 	return ed25519.Verify(publicKey, msg, sig)
 }
@@ -0,0 +1,130 @@
+package mekabuild
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// ChainConfig configures the builder of one chain in a BuilderSet.
+type ChainConfig struct {
+	ChainID          string
+	Signer           Signer
+	ValidatorAddress string
+
+	// PaymentAddress enables auto registration, see WithAutoRegister.
+	// It's optional.
+	PaymentAddress string
+
+	// Options are applied after the set's shared options, so they can
+	// override them for this chain.
+	Options []Option
+}
+
+// ErrUnknownChain is returned by BuilderSet when there's no builder for a
+// chain ID.
+var ErrUnknownChain = errors.New("no builder for chain")
+
+// BuilderSet manages one Builder per chain ID, for validators running several
+// chains from one binary, e.g. Interchain Security consumer chains. Builders
+// share an HTTP client, and so its connection pool, and the set's options,
+// while each has its own signer, validator address and payment address.
+// Requests are routed to builders by chain ID. It's safe for concurrent use.
+type BuilderSet struct {
+	client *http.Client
+	opts   []Option
+
+	mtx      sync.RWMutex
+	builders map[string]*Builder
+}
+
+// NewBuilderSet returns an empty set. The client is shared by every builder.
+// If it's nil, a client returned by NewHTTPClient with the default transport
+// configuration is used. The options are applied to every builder, and must
+// not replace the client, e.g. with WithHTTPClient or WithTransportConfig.
+func NewBuilderSet(cli *http.Client, opts ...Option) (*BuilderSet, error) {
+	if cli == nil {
+		var err error
+		if cli, err = NewHTTPClient(TransportConfig{}); err != nil {
+			return nil, err
+		}
+	}
+	return &BuilderSet{
+		client:   cli,
+		opts:     opts,
+		builders: map[string]*Builder{},
+	}, nil
+}
+
+// Add creates the builder of a chain, see New, and adds it to the set. It
+// returns an error if the set already has a builder for the chain.
+func (s *BuilderSet) Add(c ChainConfig) (*Builder, error) {
+	if c.ChainID == "" {
+		return nil, errors.New("chain ID must not be empty")
+	}
+
+	opts := make([]Option, 0, 2+len(s.opts)+len(c.Options))
+	opts = append(opts, WithHTTPClient(s.client))
+	opts = append(opts, s.opts...)
+	if c.PaymentAddress != "" {
+		opts = append(opts, WithAutoRegister(c.PaymentAddress))
+	}
+	opts = append(opts, c.Options...)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, ok := s.builders[c.ChainID]; ok {
+		return nil, fmt.Errorf("builder for chain %s already exists", c.ChainID)
+	}
+
+	b, err := New(c.Signer, c.ChainID, c.ValidatorAddress, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("chain %s: %w", c.ChainID, err)
+	}
+	s.builders[c.ChainID] = b
+	return b, nil
+}
+
+// Remove removes the builder of a chain from the set, and returns true if
+// there was one.
+func (s *BuilderSet) Remove(chainID string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, ok := s.builders[chainID]
+	delete(s.builders, chainID)
+	return ok
+}
+
+// Builder returns the builder of a chain.
+func (s *BuilderSet) Builder(chainID string) (*Builder, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	b, ok := s.builders[chainID]
+	return b, ok
+}
+
+// ChainIDs returns the chain IDs of the builders in the set, sorted.
+func (s *BuilderSet) ChainIDs() []string {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	chainIDs := make([]string, 0, len(s.builders))
+	for chainID := range s.builders {
+		chainIDs = append(chainIDs, chainID)
+	}
+	sort.Strings(chainIDs)
+	return chainIDs
+}
+
+// BuildBlock routes the build request to the builder of its chain. It returns
+// an error wrapping ErrUnknownChain if there's none.
+func (s *BuilderSet) BuildBlock(ctx context.Context, req *BuildBlockRequest) (*BuildBlockResponse, error) {
+	b, ok := s.Builder(req.ChainID)
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownChain, req.ChainID)
+	}
+	return b.BuildBlock(ctx, req)
+}
@@ -0,0 +1,85 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+type countingTransport struct {
+	requests int64
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestBuilderSet(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		hub       = newMockKey(t, "hub", nil)
+		consumer  = newMockKey(t, "consumer", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		transport = &countingTransport{}
+	)
+	api.AddPublicKey("hub-1", hub.addr, hub.PublicKey)
+	api.AddPublicKey("consumer-1", consumer.addr, consumer.PublicKey)
+
+	set, err := mekabuild.NewBuilderSet(&http.Client{Transport: transport}, mekabuild.WithEndpoints(apiURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []mekabuild.ChainConfig{
+		{ChainID: "hub-1", Signer: hub, ValidatorAddress: hub.addr, PaymentAddress: "hub-payment"},
+		{ChainID: "consumer-1", Signer: consumer, ValidatorAddress: consumer.addr, PaymentAddress: "consumer-payment"},
+	} {
+		if _, err := set.Add(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := set.Add(mekabuild.ChainConfig{ChainID: "hub-1", Signer: hub, ValidatorAddress: hub.addr}); err == nil {
+		t.Errorf("duplicate chain: want error, have none")
+	}
+	if want, have := []string{"consumer-1", "hub-1"}, set.ChainIDs(); !reflect.DeepEqual(want, have) {
+		t.Errorf("chain IDs: want %v, have %v", want, have)
+	}
+
+	for _, req := range []*mekabuild.BuildBlockRequest{
+		{ChainID: "hub-1", Height: 1, ValidatorAddress: hub.addr, Txs: [][]byte{[]byte("tx")}},
+		{ChainID: "consumer-1", Height: 1, ValidatorAddress: consumer.addr, Txs: [][]byte{[]byte("tx")}},
+	} {
+		if _, err := set.BuildBlock(ctx, req); err != nil {
+			t.Fatalf("%s: %v", req.ChainID, err)
+		}
+	}
+
+	builds := api.Builds()
+	if len(builds) != 2 || builds[0].ValidatorAddress != hub.addr || builds[1].ValidatorAddress != consumer.addr {
+		t.Errorf("builds: want one per chain, signed by its validator, have %+v", builds)
+	}
+	if want, have := int64(2), atomic.LoadInt64(&transport.requests); want != have {
+		t.Errorf("shared client requests: want %d, have %d", want, have)
+	}
+
+	if _, err := set.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: "other-1", ValidatorAddress: hub.addr}); !errors.Is(err, mekabuild.ErrUnknownChain) {
+		t.Errorf("unknown chain: want %v, have %v", mekabuild.ErrUnknownChain, err)
+	}
+
+	if !set.Remove("consumer-1") || set.Remove("consumer-1") {
+		t.Errorf("remove: want true once")
+	}
+	if _, ok := set.Builder("consumer-1"); ok {
+		t.Errorf("removed builder is still in the set")
+	}
+}
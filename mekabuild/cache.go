@@ -0,0 +1,154 @@
+package mekabuild
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StoreNamespaceResponses holds cached build responses. See SetResponseCache.
+const StoreNamespaceResponses = "responses"
+
+// SetResponseCache configures the builder to cache successful build responses
+// in its store for the given duration, keyed by chain ID, height, validator
+// address and consensus round. Subsequent build requests with the same key
+// reuse the cached response, rather than triggering another auction.
+//
+// This allows horizontally scaled sentries, which may each forward the same
+// proposal, to share a single auction result, by sharing a Store. Concurrent
+// requests with the same key within one process are coalesced into a single
+// request to the builder API.
+//
+// Caching requires a store, see SetStore. A zero duration, the default,
+// disables caching.
+func (b *Builder) SetResponseCache(ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("cache duration must not be negative, have %s", ttl)
+	}
+	atomic.StoreInt64(&b.cacheTTL, int64(ttl))
+	return nil
+}
+
+type cachedResponse struct {
+	Time     time.Time           `json:"time"`
+	Response *BuildBlockResponse `json:"response"`
+}
+
+func responseCacheKey(ctx context.Context, req *BuildBlockRequest) string {
+	round := int32(-1)
+	if cs, ok := ctx.Value(consensusStateKey{}).(consensusState); ok {
+		round = cs.round
+	}
+	return fmt.Sprintf("%s-%020d-%s-%d", req.ChainID, req.Height, req.ValidatorAddress, round)
+}
+
+func getCachedResponse(s Store, key string, ttl time.Duration, now time.Time) (*BuildBlockResponse, error) {
+	data, err := s.Get(StoreNamespaceResponses, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var cr cachedResponse
+	if err := json.Unmarshal(data, &cr); err != nil {
+		return nil, fmt.Errorf("decode cached response: %w", err)
+	}
+
+	if now.Sub(cr.Time) > ttl || cr.Response == nil {
+		s.Delete(StoreNamespaceResponses, key) // best effort
+		return nil, ErrNotFound
+	}
+
+	return cr.Response, nil
+}
+
+func putCachedResponse(s Store, key string, resp *BuildBlockResponse, now time.Time) error {
+	data, err := json.Marshal(cachedResponse{Time: now.UTC(), Response: resp})
+	if err != nil {
+		return err
+	}
+	return s.Put(StoreNamespaceResponses, key, data)
+}
+
+// buildBlockCached serves the request from the response cache if possible,
+// and otherwise builds the block and caches the response.
+func (b *Builder) buildBlockCached(ctx context.Context, s Store, ttl time.Duration, req *BuildBlockRequest) (*BuildBlockResponse, error) {
+	addr, err := NormalizeValidatorAddress(req.ValidatorAddress)
+	if err != nil {
+		return nil, err
+	}
+	key := responseCacheKey(ctx, &BuildBlockRequest{ChainID: req.ChainID, Height: req.Height, ValidatorAddress: addr})
+
+	return b.inflight.do(ctx, key, func() (*BuildBlockResponse, error) {
+		resp, err := getCachedResponse(s, key, ttl, b.now())
+		switch {
+		case err == nil:
+			b.getLogger().Infof("build block served from cache: chain_id=%s height=%d txs_out=%d payment=%q", req.ChainID, req.Height, len(resp.Txs), resp.ValidatorPayment)
+			return resp, nil
+		case !errors.Is(err, ErrNotFound):
+			b.getLogger().Errorf("read cached response failed: chain_id=%s height=%d err=%v", req.ChainID, req.Height, err)
+		}
+
+		resp, err = b.buildBlock(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := putCachedResponse(s, key, resp, b.now()); err != nil {
+			b.getLogger().Errorf("cache response failed: chain_id=%s height=%d err=%v", req.ChainID, req.Height, err)
+		}
+		return resp, nil
+	})
+}
+
+// inflightGroup coalesces concurrent build requests with the same key.
+type inflightGroup struct {
+	mtx   sync.Mutex
+	calls map[string]*inflightCall
+}
+
+type inflightCall struct {
+	done chan struct{}
+	resp *BuildBlockResponse
+	err  error
+}
+
+// do calls fn, unless a call with the same key is in flight, in which case it
+// waits for that call's result. Each caller receives its own copy of the
+// response.
+func (g *inflightGroup) do(ctx context.Context, key string, fn func() (*BuildBlockResponse, error)) (*BuildBlockResponse, error) {
+	g.mtx.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*inflightCall{}
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &inflightCall{done: make(chan struct{})}
+		g.calls[key] = c
+	}
+	g.mtx.Unlock()
+
+	if !ok {
+		c.resp, c.err = fn()
+		close(c.done)
+
+		g.mtx.Lock()
+		delete(g.calls, key)
+		g.mtx.Unlock()
+	}
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	resp := *c.resp
+	return &resp, nil
+}
@@ -0,0 +1,83 @@
+package mekabuild_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderResponseCache(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx      = context.Background()
+		chainID  = "chain-id"
+		key      = newMockKey(t, "validator", nil)
+		api      = newMockAPI()
+		requests int64
+		server   = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&requests, 1)
+			time.Sleep(10 * time.Millisecond) // give concurrent requests time to coalesce
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		store     = mekabuild.NewMemoryStore()
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	newSentry := func() *mekabuild.Builder {
+		b := mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		if err := b.SetStore(store); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.SetResponseCache(time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	var (
+		first  = newSentry()
+		second = newSentry()
+		wg     sync.WaitGroup
+	)
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := first.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want, have := int64(1), atomic.LoadInt64(&requests); want != have {
+		t.Fatalf("after concurrent requests: want %d API request(s), have %d", want, have)
+	}
+
+	if _, err := second.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := int64(1), atomic.LoadInt64(&requests); want != have {
+		t.Fatalf("after second sentry: want %d API request(s), have %d", want, have)
+	}
+
+	roundCtx := mekabuild.WithConsensusState(ctx, 1, time.Second)
+	if _, err := second.BuildBlock(roundCtx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := int64(2), atomic.LoadInt64(&requests); want != have {
+		t.Fatalf("after new round: want %d API request(s), have %d", want, have)
+	}
+}
@@ -0,0 +1,150 @@
+package mekabuild
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Capabilities is a set of optional protocol features. The builder client
+// advertises the capabilities it supports on every request, and the builder
+// API responds with the capabilities it supports. The negotiated set is the
+// intersection of the two, and lets new features roll out gradually.
+type Capabilities uint64
+
+// Known capabilities.
+const (
+	CapabilityZstd                 Capabilities = 1 << iota // zstd content encoding
+	CapabilityProto                                         // protobuf request and response bodies
+	CapabilityBlinded                                       // blinded block flow
+	CapabilityIncrementalTemplates                          // incremental block templates
+	CapabilityReplayProtection                              // request nonces and timestamps
+	CapabilityPresigning                                    // presigned build requests
+	CapabilityMsgpack                                       // msgpack request and response bodies
+	CapabilityMandatoryTxs                                  // mandatory txs in build requests
+	CapabilitySnappy                                        // snappy content encoding
+	CapabilityThresholdSignatures                           // threshold signatures with cosigner sets
+	CapabilityConfirmation                                  // build confirmation with auction IDs
+	CapabilityDomainTags                                    // chain-specific domain tags in sign bytes
+	CapabilityConsumerChains                                // ICS consumer chains signed with provider chain keys
+	CapabilityTopOfBlock                                    // top-of-block build mode
+	CapabilityPause                                         // validator pause and resume
+)
+
+var capabilityNames = map[Capabilities]string{
+	CapabilityZstd:                 "zstd",
+	CapabilityProto:                "proto",
+	CapabilityBlinded:              "blinded",
+	CapabilityIncrementalTemplates: "incremental-templates",
+	CapabilityReplayProtection:     "replay-protection",
+	CapabilityPresigning:           "presigning",
+	CapabilityMsgpack:              "msgpack",
+	CapabilityMandatoryTxs:         "mandatory-txs",
+	CapabilitySnappy:               "snappy",
+	CapabilityThresholdSignatures:  "threshold-signatures",
+	CapabilityConfirmation:         "build-confirmation",
+	CapabilityDomainTags:           "domain-tags",
+	CapabilityConsumerChains:       "ics-consumer-chains",
+	CapabilityTopOfBlock:           "top-of-block",
+	CapabilityPause:                "validator-pause",
+}
+
+// CapabilitiesHeader is the HTTP header used to exchange capabilities, in
+// both requests and responses. Its value is a comma-separated list of
+// capability names.
+const CapabilitiesHeader = "mekatek-capabilities"
+
+// Has returns true if every capability in c2 is in c.
+func (c Capabilities) Has(c2 Capabilities) bool {
+	return c&c2 == c2
+}
+
+// String returns the comma-separated capability names. Unknown capabilities
+// are omitted.
+func (c Capabilities) String() string {
+	var names []string
+	for capability, name := range capabilityNames {
+		if c.Has(capability) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// ParseCapabilities parses a comma-separated list of capability names, as
+// produced by Capabilities.String. Unknown names are ignored, so that peers
+// can advertise capabilities this package doesn't know about yet.
+func ParseCapabilities(s string) Capabilities {
+	var c Capabilities
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		for capability, n := range capabilityNames {
+			if n == name {
+				c |= capability
+			}
+		}
+	}
+	return c
+}
+
+// SetCapabilities sets the capabilities advertised by the builder to the API.
+// It should only be used to disable capabilities that misbehave in a given
+// deployment. By default, every capability implemented by this package is
+// advertised.
+func (b *Builder) SetCapabilities(c Capabilities) {
+	atomic.StoreUint64(&b.capabilities, uint64(c))
+}
+
+// Capabilities returns the capabilities negotiated with the most preferred
+// builder API endpoint, which requests are sent to first. The ok return is
+// false if no negotiation has taken place with it yet, i.e. no response from
+// it has advertised its capabilities.
+func (b *Builder) Capabilities() (c Capabilities, ok bool) {
+	return b.negotiated.get(endpointName(b.orderedEndpoints()[0]))
+}
+
+func (b *Builder) observeCapabilities(endpoint, header string) {
+	local := Capabilities(atomic.LoadUint64(&b.capabilities))
+	remote := ParseCapabilities(header)
+	b.negotiated.set(endpoint, local&remote)
+}
+
+// endpointCapabilities returns the capabilities negotiated with the endpoint,
+// or none if negotiation hasn't taken place with it yet.
+func (b *Builder) endpointCapabilities(endpoint string) Capabilities {
+	c, _ := b.negotiated.get(endpoint)
+	return c
+}
+
+// capabilityRegistry keeps the capabilities negotiated with every endpoint,
+// as endpoints may be running different versions of the builder API.
+type capabilityRegistry struct {
+	mtx       sync.Mutex
+	endpoints map[string]Capabilities
+}
+
+func newCapabilityRegistry() *capabilityRegistry {
+	return &capabilityRegistry{
+		endpoints: map[string]Capabilities{},
+	}
+}
+
+func (r *capabilityRegistry) get(endpoint string) (Capabilities, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	c, ok := r.endpoints[endpoint]
+	return c, ok
+}
+
+func (r *capabilityRegistry) set(endpoint string, c Capabilities) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.endpoints[endpoint] = c
+}
+
+// defaultCapabilities are the capabilities implemented by this package.
+const defaultCapabilities = CapabilityProto | CapabilityReplayProtection | CapabilityPresigning | CapabilityMsgpack | CapabilityMandatoryTxs | CapabilitySnappy | CapabilityThresholdSignatures | CapabilityConfirmation | CapabilityDomainTags | CapabilityConsumerChains | CapabilityTopOfBlock | CapabilityPause
@@ -0,0 +1,103 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderCapabilities(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", rand.Reader)
+		api       = newMockAPI()
+		advertise = make(chan string, 1)
+		server    = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			advertise <- r.Header.Get(mekabuild.CapabilitiesHeader)
+			w.Header().Set(mekabuild.CapabilitiesHeader, "zstd, proto, something-new")
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	builder.SetCapabilities(mekabuild.CapabilityProto | mekabuild.CapabilityBlinded)
+
+	if _, ok := builder.Capabilities(); ok {
+		t.Fatalf("capabilities negotiated before first request")
+	}
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, ValidatorAddress: key.addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := "blinded,proto", <-advertise; want != have {
+		t.Errorf("advertised: want %q, have %q", want, have)
+	}
+
+	caps, ok := builder.Capabilities()
+	if !ok {
+		t.Fatalf("capabilities not negotiated")
+	}
+
+	if want, have := mekabuild.CapabilityProto, caps; want != have {
+		t.Errorf("negotiated: want %q, have %q", want, have)
+	}
+}
+
+func TestBuilderCapabilitiesPerEndpoint(t *testing.T) {
+	var (
+		ctx          = context.Background()
+		chainID      = "test-chain-id"
+		key          = newMockKey(t, "foo", rand.Reader)
+		primaryDown  int32
+		contentTypes = make(chan string, 10)
+		primary      = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.LoadInt32(&primaryDown) != 0 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			contentTypes <- "primary " + r.Header.Get("content-type")
+			w.Header().Set(mekabuild.CapabilitiesHeader, "proto")
+			mekabuild.JSONCodec.Encode(w, mekabuild.BuildBlockResponse{})
+		}))
+		secondary = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentTypes <- "secondary " + r.Header.Get("content-type")
+			mekabuild.JSONCodec.Encode(w, mekabuild.BuildBlockResponse{}) // doesn't support proto
+		}))
+		primaryURL, _   = url.Parse(primary.URL)
+		secondaryURL, _ = url.Parse(secondary.URL)
+		builder         = mekabuild.NewBuilder(&http.Client{}, primaryURL, key, chainID, key.addr)
+		build           = func(height int64, want string) {
+			t.Helper()
+			if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr}); err != nil {
+				t.Fatal(err)
+			}
+			if have := <-contentTypes; want != have {
+				t.Errorf("height %d: want %q, have %q", height, want, have)
+			}
+		}
+	)
+
+	builder.SetCodec(mekabuild.ProtoCodec)
+	if err := builder.SetEndpoints(primaryURL, secondaryURL); err != nil {
+		t.Fatal(err)
+	}
+
+	build(1, "primary application/json")       // not negotiated yet
+	build(2, "primary application/x-protobuf") // negotiated with the primary
+
+	atomic.StoreInt32(&primaryDown, 1)
+	build(3, "secondary application/json") // not negotiated with the secondary
+
+	if caps, ok := builder.Capabilities(); ok || caps != 0 {
+		t.Errorf("secondary preferred: want no capabilities negotiated, have %q, %v", caps, ok)
+	}
+}
@@ -0,0 +1,127 @@
+package mekabuild
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Clock is a source of time for the builder. It's used for timing, backoff,
+// failover cooldowns, the circuit breaker, caching, and replay protection.
+// Tests and simulations can provide a fake clock to make those deterministic.
+//
+// Context deadlines set by the builder, e.g. per-call timeouts, are enforced
+// by the context package, and always follow the system clock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the default Clock, backed by the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SetClock sets the builder's clock. A nil clock restores SystemClock.
+func (b *Builder) SetClock(c Clock) {
+	b.clock.Store(clockBox{c})
+}
+
+// WithClock sets the builder's clock. See SetClock.
+func WithClock(c Clock) Option {
+	return func(b *Builder) error {
+		b.SetClock(c)
+		return nil
+	}
+}
+
+type clockBox struct{ Clock }
+
+func (b *Builder) getClock() Clock {
+	if box, _ := b.clock.Load().(clockBox); box.Clock != nil {
+		return box.Clock
+	}
+	return SystemClock
+}
+
+func (b *Builder) now() time.Time {
+	return b.getClock().Now()
+}
+
+func (b *Builder) since(t time.Time) time.Duration {
+	return b.now().Sub(t)
+}
+
+func (b *Builder) until(t time.Time) time.Duration {
+	return t.Sub(b.now())
+}
+
+// SetRandom sets the builder's source of randomness, which is used for retry
+// jitter and request IDs. Reads from r are serialized, so r needn't be safe
+// for concurrent use, e.g. a math/rand.Rand with a fixed seed. A nil reader
+// restores the default, crypto/rand.Reader.
+func (b *Builder) SetRandom(r io.Reader) {
+	if r == nil {
+		r = rand.Reader
+	}
+	b.random.Store(randomBox{&lockedReader{r: r}})
+}
+
+// WithRandom sets the builder's source of randomness. See SetRandom.
+func WithRandom(r io.Reader) Option {
+	return func(b *Builder) error {
+		b.SetRandom(r)
+		return nil
+	}
+}
+
+type randomBox struct{ io.Reader }
+
+type lockedReader struct {
+	mtx sync.Mutex
+	r   io.Reader
+}
+
+func (lr *lockedReader) Read(p []byte) (int, error) {
+	lr.mtx.Lock()
+	defer lr.mtx.Unlock()
+	return io.ReadFull(lr.r, p)
+}
+
+func (b *Builder) getRandom() io.Reader {
+	if box, _ := b.random.Load().(randomBox); box.Reader != nil {
+		return box.Reader
+	}
+	return rand.Reader
+}
+
+// randomFloat returns a random number in [0, 1).
+func (b *Builder) randomFloat() float64 {
+	var buf [8]byte
+	if _, err := b.getRandom().Read(buf[:]); err != nil {
+		return 0.5 // no jitter
+	}
+	return float64(binary.LittleEndian.Uint64(buf[:])>>11) / (1 << 53)
+}
+
+// RequestIDHeader carries a random ID identifying a single call to the builder
+// API. It's the same for every attempt of a call, including retries and
+// failovers, and is logged by the builder, to correlate client and server
+// logs.
+const RequestIDHeader = "mekatek-request-id"
+
+// newRequestID returns a random request ID.
+func (b *Builder) newRequestID() (string, error) {
+	var buf [16]byte
+	if _, err := b.getRandom().Read(buf[:]); err != nil {
+		return "", fmt.Errorf("read random request ID: %w", err)
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
@@ -0,0 +1,124 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/rand"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderClockAndRandom(t *testing.T) {
+	t.Parallel()
+
+	run := func(seed int64) (requestIDs []string, backoffs []time.Duration) {
+		var (
+			ctx     = context.Background()
+			chainID = "test-chain-id"
+			key     = newMockKey(t, "foo", rand.Reader)
+			api     = newMockAPI()
+			clock   = newFakeClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+			mtx     sync.Mutex
+			server  = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mtx.Lock()
+				requestIDs = append(requestIDs, r.Header.Get(mekabuild.RequestIDHeader))
+				attempt := len(requestIDs)
+				mtx.Unlock()
+				if attempt < 3 {
+					http.Error(w, "injected failure", http.StatusServiceUnavailable)
+					return
+				}
+				api.ServeHTTP(w, r)
+			}))
+			apiURL, _ = url.Parse(server.URL)
+		)
+
+		api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+		builder, err := mekabuild.New(key, chainID, key.addr,
+			mekabuild.WithEndpoints(apiURL),
+			mekabuild.WithClock(clock),
+			mekabuild.WithRandom(mathrand.New(mathrand.NewSource(seed))),
+			mekabuild.WithRetry(mekabuild.RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Hour, Jitter: 0.5}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, ValidatorAddress: key.addr}); err != nil {
+			t.Fatal(err)
+		}
+
+		last := builder.Health().LastBuild
+		if want, have := clock.slept(), last.Duration; want != have {
+			t.Errorf("last build duration: want %s, have %s", want, have)
+		}
+
+		return requestIDs, clock.sleeps
+	}
+
+	ids1, backoffs1 := run(1)
+	ids2, backoffs2 := run(1)
+
+	if want, have := 3, len(ids1); want != have {
+		t.Fatalf("attempts: want %d, have %d", want, have)
+	}
+
+	for i := range ids1 {
+		if ids1[i] == "" || ids1[i] != ids1[0] {
+			t.Errorf("request ID: want %q for every attempt, have %q", ids1[0], ids1[i])
+		}
+		if want, have := ids1[i], ids2[i]; want != have {
+			t.Errorf("request ID with same seed: want %q, have %q", want, have)
+		}
+	}
+
+	if want, have := 2, len(backoffs1); want != have {
+		t.Fatalf("backoffs: want %d, have %d", want, have)
+	}
+
+	for i := range backoffs1 {
+		if want, have := backoffs1[i], backoffs2[i]; want != have {
+			t.Errorf("backoff %d with same seed: want %s, have %s", i, want, have)
+		}
+	}
+}
+
+// fakeClock is a Clock whose time only advances when it's waited on.
+type fakeClock struct {
+	mtx    sync.Mutex
+	start  time.Time
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock(start time.Time) *fakeClock {
+	return &fakeClock{start: start, now: start}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = c.now.Add(d)
+	c.sleeps = append(c.sleeps, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) slept() time.Duration {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now.Sub(c.start)
+}
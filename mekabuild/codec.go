@@ -0,0 +1,103 @@
+package mekabuild
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+)
+
+// Codec is a wire encoding for request and response bodies. The builder sends
+// requests with the Content-Type of its codec, and accepts responses in the
+// same encoding, or JSON.
+//
+// Codecs which only support some types can implement a Supports method,
+//
+//	Supports(v interface{}) bool
+//
+// in which case requests of other types are sent as JSON.
+type Codec interface {
+	// ContentType is the MIME type of the encoding, e.g. "application/json".
+	ContentType() string
+
+	// Capability is the capability the builder API must advertise before
+	// the codec is used, or 0 if it can always be used.
+	Capability() Capabilities
+
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+// ErrCodecUnsupported is returned by codecs asked to encode or decode a type
+// they don't support.
+var ErrCodecUnsupported = errors.New("type not supported by codec")
+
+// JSONCodec is the default codec. Every builder API supports it.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string      { return "application/json" }
+func (jsonCodec) Capability() Capabilities { return 0 }
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Decode decodes build responses in a streaming fashion, to limit the memory
+// used by very large blocks.
+func (jsonCodec) Decode(r io.Reader, v interface{}) error {
+	if m, ok := v.(*BuildBlockResponse); ok {
+		return decodeBuildBlockResponseJSON(r, m)
+	}
+	return json.NewDecoder(r).Decode(v)
+}
+
+// SetCodec sets the preferred wire encoding for requests to the builder API.
+// It's used once the builder API has advertised the codec's capability, and
+// for request types the codec supports. Otherwise, and by default, requests
+// are sent as JSON. A nil codec restores the default.
+func (b *Builder) SetCodec(c Codec) {
+	b.codec.Store(codecBox{c})
+}
+
+// WithCodec sets the preferred wire encoding. See SetCodec.
+func WithCodec(c Codec) Option {
+	return func(b *Builder) error {
+		b.SetCodec(c)
+		return nil
+	}
+}
+
+type codecBox struct{ Codec }
+
+// requestCodec returns the codec to encode req with, when sent to the endpoint.
+func (b *Builder) requestCodec(endpoint string, req interface{}) Codec {
+	box, _ := b.codec.Load().(codecBox)
+	c := box.Codec
+	if c == nil {
+		return JSONCodec
+	}
+
+	if capability := c.Capability(); capability != 0 {
+		if !b.endpointCapabilities(endpoint).Has(capability) {
+			return JSONCodec
+		}
+	}
+
+	if s, ok := c.(interface{ Supports(interface{}) bool }); ok && !s.Supports(req) {
+		return JSONCodec
+	}
+
+	return c
+}
+
+// responseCodec returns the codec for a response with the given Content-Type,
+// which is either the request codec, or JSON.
+func responseCodec(contentType string, requested Codec) Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && mediaType == requested.ContentType() {
+		return requested
+	}
+	return JSONCodec
+}
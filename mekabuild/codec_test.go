@@ -0,0 +1,190 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"net/http"
+	"net/url"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	req := &mekabuild.BuildBlockRequest{
+		ChainID:          "chain-id",
+		Height:           123456789,
+		ValidatorAddress: "ABCDEF",
+		MaxBytes:         22020096,
+		MaxGas:           -1,
+		Txs:              [][]byte{[]byte("tx-1"), bytes.Repeat([]byte{0xff}, 70000)},
+		TxsHashVersion:   mekabuild.TxsHashMerkle,
+		KeyType:          mekabuild.KeyTypeSecp256k1,
+		Nonce:            1 << 62,
+		Timestamp:        1654000000000,
+		Signature:        []byte("signature"),
+		Presign:          &mekabuild.Presignature{SessionKey: []byte("session-key"), Signature: []byte("presignature")},
+		Hint:             &mekabuild.AuctionHint{RTTMillis: 25, TimeBudgetMillis: 800},
+		FeeMarket:        &mekabuild.FeeMarket{MinGasPrices: "0.025uatom", BaseFee: "0.1uatom"},
+		Cosigners:        &mekabuild.CosignerSet{Threshold: 2, Total: 3, IDs: []int{1, 3}},
+		DomainTag:        "appchain/v1",
+		ProviderChainID:  "cosmoshub-4",
+		ConsumerID:       "21",
+		Mode:             mekabuild.BuildModeTopOfBlock,
+	}
+
+	resp := &mekabuild.BuildBlockResponse{
+		Txs:              [][]byte{[]byte("tx-1")},
+		ValidatorPayment: "1000uatom",
+		AuctionID:        "auction-1",
+		Receipt:          &mekabuild.PaymentReceipt{ChainID: "chain-id", Height: 1, ValidatorAddress: "validator", Amount: "1000", Denom: "uatom", PaymentTxHash: "ABCD", Signature: []byte("receipt-signature")},
+		Signature:        []byte("signature"),
+	}
+
+	for _, codec := range []mekabuild.Codec{mekabuild.JSONCodec, mekabuild.MsgpackCodec, mekabuild.ProtoCodec} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			for _, tc := range []struct {
+				in, out interface{}
+			}{
+				{req, &mekabuild.BuildBlockRequest{}},
+				{resp, &mekabuild.BuildBlockResponse{}},
+			} {
+				var buf bytes.Buffer
+				if err := codec.Encode(&buf, tc.in); err != nil {
+					t.Fatalf("encode %T: %v", tc.in, err)
+				}
+				if err := codec.Decode(&buf, tc.out); err != nil {
+					t.Fatalf("decode %T: %v", tc.out, err)
+				}
+				if !reflect.DeepEqual(tc.in, tc.out) {
+					t.Errorf("%T: want %+v, have %+v", tc.in, tc.in, tc.out)
+				}
+			}
+		})
+	}
+}
+
+func TestMsgpackCodecTypes(t *testing.T) {
+	t.Parallel()
+
+	type record struct {
+		Time    time.Time              `json:"time"`
+		Amount  *big.Int               `json:"amount"`
+		Skipped string                 `json:"-"`
+		Empty   string                 `json:"empty,omitempty"`
+		Negs    []int64                `json:"negs"`
+		Floats  []float64              `json:"floats"`
+		Extra   map[string]interface{} `json:"extra"`
+	}
+
+	amount, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	in := record{
+		Time:    time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC),
+		Amount:  amount,
+		Skipped: "skipped",
+		Negs:    []int64{-1, -33, -200, -40000, -3000000000},
+		Floats:  []float64{0.5, -1e300},
+		Extra:   map[string]interface{}{"n": 1.0, "s": "x", "l": []interface{}{true, nil}},
+	}
+
+	var buf bytes.Buffer
+	if err := mekabuild.MsgpackCodec.Encode(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+
+	var out record
+	if err := mekabuild.MsgpackCodec.Decode(&buf, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	in.Skipped = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("want %+v, have %+v", in, out)
+	}
+}
+
+// TestMsgpackCodecLengthHeaders isn't parallel, so that it measures only its
+// own allocations.
+func TestMsgpackCodecLengthHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body []byte
+		out  interface{}
+	}{
+		{"bin32", []byte{0xc6, 0x08, 0x00, 0x00, 0x00}, new([]byte)},
+		{"str32", []byte{0xdb, 0x08, 0x00, 0x00, 0x00}, new(string)},
+		{"array32", []byte{0xdd, 0x01, 0x00, 0x00, 0x00}, new([]string)},
+	} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if err := mekabuild.MsgpackCodec.Decode(bytes.NewReader(tc.body), tc.out); err == nil {
+			t.Errorf("%s: want error, have none", tc.name)
+		}
+		runtime.ReadMemStats(&after)
+
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("%s: allocated %d bytes for a %d byte body", tc.name, allocated, len(tc.body))
+		}
+	}
+}
+
+func TestBuilderCodecNegotiation(t *testing.T) {
+	t.Parallel()
+
+	for _, codec := range []mekabuild.Codec{mekabuild.MsgpackCodec, mekabuild.ProtoCodec} {
+		codec := codec
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			var (
+				ctx          = context.Background()
+				chainID      = "chain-id"
+				key          = newMockKey(t, "validator", nil)
+				contentTypes = make(chan string, 10)
+				server       = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set(mekabuild.CapabilitiesHeader, codec.Capability().String())
+					contentTypes <- r.Header.Get("content-type")
+
+					c := mekabuild.JSONCodec
+					if r.Header.Get("content-type") == codec.ContentType() {
+						c = codec
+					}
+
+					var req mekabuild.BuildBlockRequest
+					if err := c.Decode(r.Body, &req); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					if err := mekabuild.VerifyBuildBlockRequest(&req, key.PublicKey); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+
+					w.Header().Set("content-type", c.ContentType())
+					c.Encode(w, mekabuild.BuildBlockResponse{Txs: req.Txs, ValidatorPayment: "1uatom"})
+				}))
+				apiURL, _ = url.Parse(server.URL)
+				builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+			)
+
+			builder.SetCodec(codec)
+
+			for i, want := range []string{mekabuild.JSONCodec.ContentType(), codec.ContentType()} {
+				resp, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}})
+				if err != nil {
+					t.Fatalf("request %d: %v", i+1, err)
+				}
+				if want, have := "tx", string(resp.Txs[0]); want != have {
+					t.Errorf("request %d: tx: want %q, have %q", i+1, want, have)
+				}
+				if have := <-contentTypes; want != have {
+					t.Errorf("request %d: content type: want %q, have %q", i+1, want, have)
+				}
+			}
+		})
+	}
+}
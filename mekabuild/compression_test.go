@@ -0,0 +1,178 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestSnappyCompressor(t *testing.T) {
+	t.Parallel()
+
+	random := make([]byte, 100<<10)
+	mathrand.New(mathrand.NewSource(1)).Read(random)
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short", []byte("abc")},
+		{"repetitive", bytes.Repeat([]byte("build-block-request "), 10000)},
+		{"random", random},
+		{"mixed", append(append([]byte{}, random[:70<<10]...), bytes.Repeat([]byte{0}, 70<<10)...)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := mekabuild.SnappyCompressor.NewWriter(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(tc.data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := mekabuild.SnappyCompressor.NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(tc.data, have) {
+				t.Errorf("round trip mismatch: want %d bytes, have %d", len(tc.data), len(have))
+			}
+		})
+	}
+
+	for _, corrupt := range [][]byte{
+		{},
+		{0x05, 0x00, 'a'},              // literal shorter than declared length
+		{0x04, 0x01 << 2, 'a', 'b'},    // length mismatch
+		{0x08, 0x00, 'a', 0x0d, 0x05},  // copy offset beyond output
+		{0xff, 0xff, 0xff, 0xff, 0x7f}, // declared length over limit
+	} {
+		if _, err := mekabuild.SnappyCompressor.NewReader(bytes.NewReader(corrupt)); err == nil {
+			t.Errorf("%x: want error, have none", corrupt)
+		}
+	}
+}
+
+// TestSnappyCompressorLengthHeader isn't parallel, so that it measures only
+// its own allocations.
+func TestSnappyCompressorLengthHeader(t *testing.T) {
+	body := []byte{0x80, 0x80, 0x80, 0x40, 0x00} // declares 128 MiB, within the limit
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := mekabuild.SnappyCompressor.NewReader(bytes.NewReader(body)); err == nil {
+		t.Errorf("want error, have none")
+	}
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("allocated %d bytes for a %d byte body", allocated, len(body))
+	}
+}
+
+func TestBuilderCompressor(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx        = context.Background()
+		chainID    = "chain-id"
+		key        = newMockKey(t, "validator", nil)
+		api        = newMockAPI()
+		encodings  = make(chan string, 10)
+		advertised = make(chan string, 10)
+		server     = httptest.NewServer(mekabuild.DecompressRequestMiddleware(mekabuild.SnappyCompressor)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(mekabuild.CapabilitiesHeader, mekabuild.CapabilitySnappy.String())
+			encodings <- r.Header.Get("x-original-encoding")
+			advertised <- r.Header.Get(mekabuild.CapabilitiesHeader)
+			api.ServeHTTP(w, r)
+		})))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(recordEncoding(server.Client()), apiURL, key, chainID, key.addr)
+		newReq    = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+	defer server.Close()
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	builder.SetCompressor(mekabuild.SnappyCompressor)
+
+	for _, want := range []string{"gzip", "snappy"} { // snappy once negotiated
+		if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+			t.Fatal(err)
+		}
+		if have := <-encodings; want != have {
+			t.Errorf("content encoding: want %q, have %q", want, have)
+		}
+		<-advertised
+	}
+
+	passthrough := mekabuild.NewZstdCompressor(
+		func(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil },
+		func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil },
+	)
+	builder.SetCompressor(passthrough)
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "gzip", <-encodings; want != have {
+		t.Errorf("zstd without capability: want %q, have %q", want, have)
+	}
+
+	if want, have := true, strings.Contains(<-advertised, "zstd"); want != have {
+		t.Errorf("zstd advertised: want %v, have %v", want, have)
+	}
+}
+
+func TestDecompressRequestMiddlewareUnsupported(t *testing.T) {
+	t.Parallel()
+
+	h := mekabuild.DecompressRequestMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("handler invoked")
+	}))
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("data"))
+	r.Header.Set("content-encoding", "br")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if want, have := http.StatusUnsupportedMediaType, w.Code; want != have {
+		t.Errorf("status: want %d, have %d", want, have)
+	}
+}
+
+// recordEncoding copies the request content encoding to a header that
+// survives decompression middleware.
+func recordEncoding(c *http.Client) *http.Client {
+	rt := c.Transport
+	return &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		r.Header.Set("x-original-encoding", r.Header.Get("content-encoding"))
+		return rt.RoundTrip(r)
+	})}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
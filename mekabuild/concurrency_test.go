@@ -0,0 +1,113 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+// TestBuilderConcurrentUse exercises the builder from many goroutines at once,
+// while its configuration changes underneath. It's most useful with -race.
+func TestBuilderConcurrentUse(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", rand.Reader)
+		signer    = &exclusiveSigner{mockKey: key}
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, signer, chainID, key.addr)
+		builders  = 8
+		heights   = 20
+		done      = make(chan struct{})
+		wg        sync.WaitGroup
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	builder.SetStore(mekabuild.NewMemoryStore())
+	builder.SetMetrics(&mockMetrics{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			builder.SetCompression(i%2 == 0)
+			builder.SetCompressionLevel(i % 10)
+			builder.SetTimeout(time.Duration(10+i%5) * time.Second)
+			builder.SetRetryPolicy(mekabuild.RetryPolicy{MaxAttempts: 1 + i%3})
+			builder.SetEndpoints(apiURL)
+			builder.SetResponseCache(time.Duration(i%2) * time.Second)
+			builder.SetClock(mekabuild.SystemClock)
+			builder.SetRandom(nil)
+
+			_ = builder.Health()
+			_ = builder.EndpointStats()
+			_ = builder.Endpoints()
+			_, _ = builder.Capabilities()
+			_ = builder.CircuitOpen()
+		}
+	}()
+
+	var failures int32
+	var builds sync.WaitGroup
+	for g := 0; g < builders; g++ {
+		builds.Add(1)
+		go func(g int) {
+			defer builds.Done()
+			for h := 1; h <= heights; h++ {
+				if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{
+					ChainID:          chainID,
+					Height:           int64(h),
+					ValidatorAddress: key.addr,
+					Txs:              [][]byte{[]byte(fmt.Sprintf("tx-%d-%d", g, h))},
+				}); err != nil {
+					atomic.AddInt32(&failures, 1)
+					t.Errorf("build %d at height %d: %v", g, h, err)
+				}
+			}
+		}(g)
+	}
+
+	builds.Wait()
+	close(done)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&failures); n > 0 {
+		t.Errorf("%d builds failed", n)
+	}
+
+	if n := atomic.LoadInt32(&signer.overlaps); n > 0 {
+		t.Errorf("signer was called concurrently %d times", n)
+	}
+}
+
+// exclusiveSigner counts overlapping calls to the signer.
+type exclusiveSigner struct {
+	*mockKey
+	active   int32
+	overlaps int32
+}
+
+func (s *exclusiveSigner) SignBuildBlockRequest(r *mekabuild.BuildBlockRequest) error {
+	if atomic.AddInt32(&s.active, 1) > 1 {
+		atomic.AddInt32(&s.overlaps, 1)
+	}
+	defer atomic.AddInt32(&s.active, -1)
+	time.Sleep(100 * time.Microsecond) // widen the window for overlaps
+	return s.mockKey.SignBuildBlockRequest(r)
+}
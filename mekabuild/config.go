@@ -0,0 +1,469 @@
+package mekabuild
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigSection is the TOML table holding builder settings. It can be a
+// section of Tendermint's config.toml, or of a dedicated file.
+//
+//	[zenith]
+//	api_url = "https://api.mekatek.xyz"
+//	timeout = "2s"
+//	payment_address = "cosmos1..."
+//	domain_tag = ""
+//	compression = "gzip"
+//	retries = 2
+//	fallback = "mempool"
+//	dry_run = false
+//	telemetry = false
+const ConfigSection = "zenith"
+
+// Config is the builder configuration read by LoadConfig. Zero values mean
+// the builder's defaults.
+type Config struct {
+	// APIURL is the builder API URL. Like GetBuilderAPIURL, it's
+	// overridden by the MEKATEK_BUILDER_API_URL and ZENITH_API_URL
+	// environment variables, see Options.
+	APIURL string
+
+	// Timeout bounds each call to the builder API, see SetTimeout.
+	Timeout time.Duration
+
+	// PaymentAddress enables auto registration, see SetAutoRegister.
+	PaymentAddress string
+
+	// DomainTag is the chain-specific domain tag of signed requests, see
+	// SetDomainTag.
+	DomainTag string
+
+	// Compression is the request compression: "gzip", the default,
+	// "snappy", or "none".
+	Compression string
+
+	// Format forces the wire format of requests, e.g. "json" when
+	// middleboxes mangle other encodings, see ForceFormat. It must be
+	// registered in DefaultFormatRegistry, and overrides Compression.
+	Format string
+
+	// Retries is the number of retries after a failed attempt, with the
+	// backoff of DefaultRetryPolicy.
+	Retries int
+
+	// Fallback is the fallback policy when the builder API fails: "none",
+	// the default, "mempool", or "smallest-first", see NewMempoolFallback.
+	Fallback string
+
+	// DryRun is true if the integration should use a DryRunBuilder. It's
+	// not a builder option, see DryRunMode.
+	DryRun bool
+
+	// Telemetry opts in to sending aggregate usage statistics to the
+	// builder API every DefaultTelemetryInterval, see SetTelemetry. It's
+	// false unless explicitly enabled.
+	Telemetry bool
+
+	// Source is the file the config was read from, and Overrides the
+	// environment variables that overrode settings from the file.
+	Source    string
+	Overrides []string
+}
+
+// Environment variables overriding config settings, in addition to the
+// variables read by ResolveEndpoint and DryRunMode.
+var configEnv = []struct {
+	name, key string
+}{
+	{"MEKATEK_BUILDER_API_TIMEOUT", "timeout"},
+	{"MEKATEK_BUILDER_API_PAYMENT_ADDRESS", "payment_address"},
+	{"MEKATEK_BUILDER_API_COMPRESSION", "compression"},
+	{"MEKATEK_BUILDER_API_FORMAT", "format"},
+	{"MEKATEK_BUILDER_API_RETRIES", "retries"},
+	{"MEKATEK_BUILDER_API_FALLBACK", "fallback"},
+	{"MEKATEK_BUILDER_API_TELEMETRY", "telemetry"},
+}
+
+// LoadConfig reads the ConfigSection table of the TOML file at path, and
+// applies overrides from the environment: MEKATEK_BUILDER_API_TIMEOUT,
+// MEKATEK_BUILDER_API_PAYMENT_ADDRESS, MEKATEK_BUILDER_API_COMPRESSION,
+// MEKATEK_BUILDER_API_FORMAT, MEKATEK_BUILDER_API_RETRIES,
+// MEKATEK_BUILDER_API_FALLBACK, MEKATEK_BUILDER_API_TELEMETRY, and the dry
+// run variables of DryRunMode. A file without the table yields an empty
+// config.
+//
+// Only the subset of TOML used by flat tables of strings, integers, and
+// booleans is supported in the table. Other tables are skipped, so the file
+// can be Tendermint's config.toml. Unknown keys in the table are errors, to
+// catch typos.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := parseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c.Source = path
+	return c, nil
+}
+
+func parseConfig(r io.Reader) (*Config, error) {
+	values, err := readTOMLTable(r, ConfigSection)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Config
+	for _, env := range configEnv {
+		if s := os.Getenv(env.name); s != "" {
+			values[env.key] = tomlValue{raw: s, env: env.name}
+			c.Overrides = append(c.Overrides, env.name)
+		}
+	}
+	for _, v := range []string{"ZENITH_DRY_RUN", "MEKATEK_BUILDER_API_DRY_RUN"} {
+		if s := os.Getenv(v); s != "" {
+			values["dry_run"] = tomlValue{raw: s, env: v}
+			c.Overrides = append(c.Overrides, v)
+			break
+		}
+	}
+
+	for key, v := range values {
+		if err := c.set(key, v); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *Config) set(key string, v tomlValue) error {
+	var err error
+	switch key {
+	case "api_url":
+		c.APIURL, err = v.string()
+	case "payment_address":
+		c.PaymentAddress, err = v.string()
+	case "domain_tag":
+		c.DomainTag, err = v.string()
+	case "fallback":
+		c.Fallback, err = v.string()
+	case "format":
+		c.Format, err = v.string()
+	case "timeout":
+		var s string
+		if s, err = v.string(); err == nil {
+			c.Timeout, err = time.ParseDuration(s)
+		}
+	case "compression":
+		var enabled bool
+		if enabled, err = v.bool(); err == nil {
+			c.Compression = "none"
+			if enabled {
+				c.Compression = "gzip"
+			}
+		} else {
+			c.Compression, err = v.string()
+		}
+	case "retries":
+		c.Retries, err = v.int()
+	case "dry_run":
+		c.DryRun, err = v.bool()
+	case "telemetry":
+		c.Telemetry, err = v.bool()
+	default:
+		return fmt.Errorf("line %d: unknown key %q", v.line, key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", v.location(key), err)
+	}
+	return nil
+}
+
+// Validate checks that the settings are valid.
+func (c *Config) Validate() error {
+	if c.APIURL != "" {
+		if u, err := url.Parse(c.APIURL); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid api_url %q", c.APIURL)
+		}
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, have %s", c.Timeout)
+	}
+	if err := ValidateDomainTag(c.DomainTag); err != nil {
+		return fmt.Errorf("invalid domain_tag: %w", err)
+	}
+	switch c.Compression {
+	case "", "gzip", "snappy", "none":
+	default:
+		return fmt.Errorf("unknown compression %q", c.Compression)
+	}
+	if c.Format != "" {
+		if _, ok := DefaultFormatRegistry.Lookup(c.Format); !ok {
+			return fmt.Errorf("unknown format %q", c.Format)
+		}
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("retries must not be negative, have %d", c.Retries)
+	}
+	switch c.Fallback {
+	case "", "none", "mempool", "smallest-first":
+	default:
+		return fmt.Errorf("unknown fallback %q", c.Fallback)
+	}
+	return nil
+}
+
+// Options returns the builder options for the config, for use with New. The
+// API URL is only used if it isn't overridden by an environment variable read
+// by ResolveEndpoint, and its provenance is reported by EndpointResolution.
+func (c *Config) Options() ([]Option, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	var opts []Option
+	if c.APIURL != "" {
+		opts = append(opts, c.endpointOption())
+	}
+	if c.Timeout > 0 {
+		opts = append(opts, WithTimeout(c.Timeout))
+	}
+	if c.PaymentAddress != "" {
+		opts = append(opts, WithAutoRegister(c.PaymentAddress))
+	}
+	if c.DomainTag != "" {
+		opts = append(opts, WithDomainTag(c.DomainTag))
+	}
+	switch c.Compression {
+	case "gzip":
+		opts = append(opts, WithCompression(true, gzip.DefaultCompression))
+	case "snappy":
+		opts = append(opts, WithCompressor(SnappyCompressor))
+	case "none":
+		opts = append(opts, WithCompression(false, gzip.DefaultCompression))
+	}
+	if c.Format != "" {
+		opts = append(opts, WithForcedFormat(c.Format))
+	}
+	if c.Retries > 0 {
+		p := DefaultRetryPolicy
+		p.MaxAttempts = c.Retries + 1
+		opts = append(opts, WithRetry(p))
+	}
+	switch c.Fallback {
+	case "mempool":
+		opts = append(opts, withFallback(NewMempoolFallback(MempoolOrder)))
+	case "smallest-first":
+		opts = append(opts, withFallback(NewMempoolFallback(SmallestFirstOrder)))
+	}
+	if c.Telemetry {
+		opts = append(opts, WithTelemetry(DefaultTelemetryInterval))
+	}
+	return opts, nil
+}
+
+func (c *Config) endpointOption() Option {
+	source := "config"
+	if c.Source != "" {
+		source += ":" + c.Source
+	}
+	return func(b *Builder) error {
+		u, err := url.Parse(c.APIURL)
+		if err != nil {
+			return err
+		}
+
+		res := ResolveEndpoint()
+		if res.Source != EndpointSourceDefault {
+			if b.resolution != nil {
+				b.resolution.Ignored = append(b.resolution.Ignored, IgnoredSetting{source, redact(c.APIURL), "overridden by " + res.Source})
+			}
+			return nil
+		}
+
+		if err := b.SetEndpoints(u); err != nil {
+			return err
+		}
+		b.resolution = &EndpointResolution{URL: u, Source: source, Ignored: res.Ignored}
+		return nil
+	}
+}
+
+func withFallback(f Fallback) Option {
+	return func(b *Builder) error {
+		b.SetFallback(f)
+		return nil
+	}
+}
+
+//
+//
+//
+
+// tomlValue is a value in a TOML table, or an environment variable.
+type tomlValue struct {
+	raw    string // unparsed, or the unquoted string
+	quoted bool
+	line   int
+	env    string // set for environment variables
+}
+
+func (v tomlValue) location(key string) string {
+	if v.env != "" {
+		return "env:" + v.env
+	}
+	return fmt.Sprintf("line %d: %s", v.line, key)
+}
+
+func (v tomlValue) string() (string, error) {
+	if !v.quoted && v.env == "" {
+		return "", fmt.Errorf("want string, have %s", v.raw)
+	}
+	return v.raw, nil
+}
+
+func (v tomlValue) int() (int, error) {
+	if v.quoted {
+		return 0, fmt.Errorf("want integer, have string %q", v.raw)
+	}
+	return strconv.Atoi(strings.ReplaceAll(v.raw, "_", ""))
+}
+
+func (v tomlValue) bool() (bool, error) {
+	if v.quoted {
+		return false, fmt.Errorf("want boolean, have string %q", v.raw)
+	}
+	if v.env != "" {
+		return strconv.ParseBool(v.raw)
+	}
+	switch v.raw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("want boolean, have %s", v.raw)
+}
+
+// readTOMLTable returns the key/value pairs of the given top-level table.
+// Other tables are skipped without being parsed.
+func readTOMLTable(r io.Reader, table string) (map[string]tomlValue, error) {
+	var (
+		values  = map[string]tomlValue{}
+		s       = bufio.NewScanner(r)
+		inTable bool
+		lineNum int
+	)
+	for s.Scan() {
+		lineNum++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			header := line
+			if i := strings.IndexByte(header, '#'); i >= 0 {
+				header = strings.TrimSpace(header[:i])
+			}
+			inTable = header == "["+table+"]"
+			continue
+		}
+		if !inTable {
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: want key = value", lineNum)
+		}
+		key := strings.TrimSpace(line[:eq])
+		if !isBareTOMLKey(key) {
+			return nil, fmt.Errorf("line %d: unsupported key %q", lineNum, key)
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", lineNum, key)
+		}
+
+		v, err := parseTOMLValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", lineNum, key, err)
+		}
+		v.line = lineNum
+		values[key] = v
+	}
+	return values, s.Err()
+}
+
+// parseTOMLValue parses a single-line string, integer, or boolean value,
+// followed by an optional comment.
+func parseTOMLValue(s string) (tomlValue, error) {
+	var v tomlValue
+	switch {
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, `'''`):
+		return v, fmt.Errorf("multi-line strings are unsupported")
+	case strings.HasPrefix(s, `"`):
+		end := 1
+		for ; end < len(s) && s[end] != '"'; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(s) {
+			return v, fmt.Errorf("unterminated string")
+		}
+		unquoted, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return v, fmt.Errorf("invalid string %s", s[:end+1])
+		}
+		v.raw, v.quoted, s = unquoted, true, s[end+1:]
+	case strings.HasPrefix(s, `'`):
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return v, fmt.Errorf("unterminated string")
+		}
+		v.raw, v.quoted, s = s[1:end+1], true, s[end+2:]
+	default:
+		end := strings.IndexAny(s, " \t#")
+		if end < 0 {
+			end = len(s)
+		}
+		v.raw, s = s[:end], s[end:]
+		if v.raw == "" {
+			return v, fmt.Errorf("missing value")
+		}
+	}
+
+	if s = strings.TrimSpace(s); s != "" && s[0] != '#' {
+		return v, fmt.Errorf("unexpected %q after value", s)
+	}
+	return v, nil
+}
+
+func isBareTOMLKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
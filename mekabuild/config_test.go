@@ -0,0 +1,177 @@
+package mekabuild_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+const tendermintConfig = `# This is a TOML config file.
+proxy_app = "tcp://127.0.0.1:26658"
+moniker = "validator"
+
+[rpc]
+laddr = "tcp://127.0.0.1:26657"
+cors_allowed_origins = [
+  "*",
+]
+
+[zenith] # builder settings
+api_url = "https://relay.example.com"
+timeout = "1500ms"
+payment_address = 'cosmos1payment' # literal string
+compression = false
+retries = 2
+fallback = "mempool"
+
+[zenith.extra]
+unknown = 1
+
+[consensus]
+timeout_propose = "3s"
+`
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, v := range []string{
+		"ZENITH_API_URL",
+		"MEKATEK_BUILDER_API_URL",
+		"MEKATEK_BUILDER_API_SANDBOX",
+		"MEKATEK_BUILDER_API_TIMEOUT",
+		"MEKATEK_BUILDER_API_PAYMENT_ADDRESS",
+		"MEKATEK_BUILDER_API_COMPRESSION",
+		"MEKATEK_BUILDER_API_FORMAT",
+		"MEKATEK_BUILDER_API_RETRIES",
+		"MEKATEK_BUILDER_API_FALLBACK",
+		"ZENITH_DRY_RUN",
+		"MEKATEK_BUILDER_API_DRY_RUN",
+		"MEKATEK_BUILDER_API_TELEMETRY",
+	} {
+		setenv(t, v, "")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfig(t, tendermintConfig)
+
+	c, err := mekabuild.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &mekabuild.Config{
+		APIURL:         "https://relay.example.com",
+		Timeout:        1500 * time.Millisecond,
+		PaymentAddress: "cosmos1payment",
+		Compression:    "none",
+		Retries:        2,
+		Fallback:       "mempool",
+		Source:         path,
+	}
+	if !reflect.DeepEqual(want, c) {
+		t.Errorf("config: want %+v, have %+v", want, c)
+	}
+
+	setenv(t, "MEKATEK_BUILDER_API_TIMEOUT", "250ms")
+	setenv(t, "MEKATEK_BUILDER_API_COMPRESSION", "snappy")
+	setenv(t, "MEKATEK_BUILDER_API_DRY_RUN", "true")
+	if c, err = mekabuild.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	if c.Timeout != 250*time.Millisecond || c.Compression != "snappy" || !c.DryRun {
+		t.Errorf("env overrides: have %+v", c)
+	}
+	if want, have := []string{"MEKATEK_BUILDER_API_TIMEOUT", "MEKATEK_BUILDER_API_COMPRESSION", "MEKATEK_BUILDER_API_DRY_RUN"}, c.Overrides; !reflect.DeepEqual(want, have) {
+		t.Errorf("overrides: want %v, have %v", want, have)
+	}
+
+	setenv(t, "MEKATEK_BUILDER_API_RETRIES", "many")
+	if _, err := mekabuild.LoadConfig(path); err == nil || !strings.Contains(err.Error(), "MEKATEK_BUILDER_API_RETRIES") {
+		t.Errorf("invalid env override: want error naming the variable, have %v", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	clearConfigEnv(t)
+
+	for name, data := range map[string]string{
+		"unknown key":    "[zenith]\ntimeuot = \"1s\"\n",
+		"duplicate key":  "[zenith]\nretries = 1\nretries = 2\n",
+		"wrong type":     "[zenith]\nretries = \"2\"\n",
+		"bad duration":   "[zenith]\ntimeout = \"soon\"\n",
+		"bad fallback":   "[zenith]\nfallback = \"pray\"\n",
+		"trailing":       "[zenith]\napi_url = \"https://a.example.com\" \"b\"\n",
+		"unterminated":   "[zenith]\napi_url = \"https://a.example.com\n",
+		"relative url":   "[zenith]\napi_url = \"relay\"\n",
+		"missing equals": "[zenith]\nretries\n",
+		"bad domain tag": "[zenith]\ndomain_tag = \"my chain\"\n",
+		"unknown format": "[zenith]\nformat = \"xml\"\n",
+	} {
+		if _, err := mekabuild.LoadConfig(writeConfig(t, data)); err == nil {
+			t.Errorf("%s: want error, have none", name)
+		}
+	}
+
+	c, err := mekabuild.LoadConfig(writeConfig(t, "[other]\nretries = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Retries != 0 || c.APIURL != "" {
+		t.Errorf("no table: want empty config, have %+v", c)
+	}
+}
+
+func TestConfigOptions(t *testing.T) {
+	clearConfigEnv(t)
+
+	var (
+		key  = newMockKey(t, "validator", nil)
+		path = writeConfig(t, tendermintConfig)
+	)
+	c, err := mekabuild.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := c.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := mekabuild.New(key, "chain-id", key.addr, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := builder.EndpointResolution()
+	if want, have := "https://relay.example.com", res.URL.String(); want != have {
+		t.Errorf("URL: want %q, have %q", want, have)
+	}
+	if want, have := "config:"+path, res.Source; want != have {
+		t.Errorf("source: want %q, have %q", want, have)
+	}
+
+	setenv(t, "MEKATEK_BUILDER_API_URL", "https://env.example.com")
+	if builder, err = mekabuild.New(key, "chain-id", key.addr, opts...); err != nil {
+		t.Fatal(err)
+	}
+	res = builder.EndpointResolution()
+	if want, have := "env:MEKATEK_BUILDER_API_URL", res.Source; want != have {
+		t.Errorf("env override: source: want %q, have %q", want, have)
+	}
+	if len(res.Ignored) != 1 || res.Ignored[0].Source != "config:"+path {
+		t.Errorf("env override: ignored: have %+v", res.Ignored)
+	}
+}
@@ -0,0 +1,237 @@
+package mekabuild
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Build confirmation gives at-most-once settlement per height. A build
+// response identifies the auction outcome it reflects with an AuctionID. Once
+// the validator has decided to propose a response, it sends a cheap, signed
+// confirmation of that auction ID, and the builder API only settles confirmed
+// auctions, and at most one per chain, height and validator. If a build
+// request was retried, e.g. after a timeout, and the retry hit a different
+// auction outcome than a response that was already confirmed, the
+// confirmation fails with ErrAuctionConflict, rather than both outcomes being
+// settled.
+//
+// Confirmation requires CapabilityConfirmation, a builder API that returns
+// auction IDs, and a signer that implements ConfirmSigner. It's opt-in, see
+// SetConfirmBuilds and ConfirmBuild.
+
+// ConfirmRequest is sent to the confirmation endpoint of the builder API, to
+// confirm that the validator will use the build response of an auction. Like
+// BuildBlockRequest, it contains a Signature field that needs to be set by
+// signers.
+type ConfirmRequest struct {
+	ChainID          string `json:"chain_id"`
+	Height           int64  `json:"height"`
+	ValidatorAddress string `json:"validator_address"`
+	AuctionID        string `json:"auction_id"`
+	TxsHash          []byte `json:"txs_hash"`
+	KeyType          string `json:"key_type,omitempty"`
+	DomainTag        string `json:"domain_tag,omitempty"`
+	ProviderChainID  string `json:"provider_chain_id,omitempty"`
+	ConsumerID       string `json:"consumer_id,omitempty"`
+	Signature        []byte `json:"signature"`
+}
+
+// SignBytes returns the bytes that should be signed by the validator key,
+// honoring the request's KeyType, DomainTag and consumer chain.
+func (r *ConfirmRequest) SignBytes() []byte {
+	signBytes := bindKeyType(r.KeyType, ConfirmRequestSignBytes(r.ChainID, r.Height, r.ValidatorAddress, r.AuctionID, r.TxsHash))
+	signBytes = bindDomainTag(r.DomainTag, signBytes)
+	return bindConsumerChain(r.ProviderChainID, r.ConsumerID, signBytes)
+}
+
+// ConfirmRequestSignBytes returns a stable byte representation of a build
+// confirmation.
+func ConfirmRequestSignBytes(chainID string, height int64, validatorAddr, auctionID string, txsHash []byte) []byte {
+	// XXX: As with BuildBlockRequestSignBytes, changing the order or the set
+	// of fields requires updating both the builder API and its clients.
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`build-confirmation`))
+	mustEncode(&sb, uint64(len([]byte(chainID))))
+	mustEncode(&sb, []byte(chainID))
+	mustEncode(&sb, height)
+	mustEncode(&sb, uint64(len([]byte(validatorAddr))))
+	mustEncode(&sb, []byte(validatorAddr))
+	mustEncode(&sb, uint64(len([]byte(auctionID))))
+	mustEncode(&sb, []byte(auctionID))
+	mustEncode(&sb, uint64(len(txsHash)))
+	mustEncode(&sb, txsHash)
+	return sb.Bytes()
+}
+
+// ConfirmResponse is returned by the confirmation endpoint of the builder API.
+type ConfirmResponse struct {
+	// AuctionID is the auction that will be settled for the height. It's
+	// the confirmed auction, unless another one was confirmed before.
+	AuctionID string `json:"auction_id"`
+	Result    string `json:"result"`
+}
+
+// ConfirmSigner is implemented by signers that can sign build confirmations.
+type ConfirmSigner interface {
+	SignConfirmRequest(*ConfirmRequest) error
+}
+
+var (
+	// ErrConfirmUnsupported is returned when a build can't be confirmed,
+	// because the builder API doesn't support CapabilityConfirmation or
+	// didn't return an auction ID, or the signer doesn't implement
+	// ConfirmSigner.
+	ErrConfirmUnsupported = errors.New("build confirmation unsupported")
+
+	// ErrAuctionConflict is returned when a different auction than the one
+	// being confirmed was already confirmed for the same height, typically
+	// because a retried build request hit a different auction outcome.
+	ErrAuctionConflict = errors.New("auction conflict")
+)
+
+// bindAuctionID binds the auction ID to the sign bytes of a build response.
+// Without an auction ID, the sign bytes are unchanged, so existing signatures
+// remain valid.
+func bindAuctionID(auctionID string, signBytes []byte) []byte {
+	if auctionID == "" {
+		return signBytes
+	}
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`auction-id-`))
+	mustEncode(&sb, uint64(len([]byte(auctionID))))
+	mustEncode(&sb, []byte(auctionID))
+	mustEncode(&sb, signBytes)
+	return sb.Bytes()
+}
+
+// SetConfirmBuilds enables or disables automatic confirmation. When enabled,
+// BuildBlock confirms every response from the builder API before returning
+// it, and a failed confirmation is handled like a failed build, i.e. the
+// block is assembled by the fallback, if there is one. It's disabled by
+// default.
+func (b *Builder) SetConfirmBuilds(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&b.confirmBuilds, 1)
+	} else {
+		atomic.StoreInt32(&b.confirmBuilds, 0)
+	}
+}
+
+// WithConfirmBuilds enables or disables automatic confirmation. See
+// SetConfirmBuilds.
+func WithConfirmBuilds(enabled bool) Option {
+	return func(b *Builder) error {
+		b.SetConfirmBuilds(enabled)
+		return nil
+	}
+}
+
+var confirmEndpoint = Endpoint{
+	Path: "/v0/confirm",
+	Sign: func(s Signer, req interface{}) error {
+		cs, ok := s.(ConfirmSigner)
+		if !ok {
+			return fmt.Errorf("%w: signer can't sign confirmations", ErrConfirmUnsupported)
+		}
+		return cs.SignConfirmRequest(req.(*ConfirmRequest))
+	},
+	Priority: PriorityProposal,
+}
+
+// ConfirmBuild confirms that the validator will propose resp, the response to
+// req, so the builder API settles its auction. Confirming the same auction
+// again is a no-op. It returns an error wrapping ErrAuctionConflict if
+// another auction was already confirmed for the height, and
+// ErrConfirmUnsupported if the build can't be confirmed at all.
+func (b *Builder) ConfirmBuild(ctx context.Context, req *BuildBlockRequest, resp *BuildBlockResponse) error {
+	if err := b.checkWritable("confirm build"); err != nil {
+		return err
+	}
+
+	if resp.Fallback {
+		return fmt.Errorf("%w: response was assembled by the fallback", ErrConfirmUnsupported)
+	}
+	if resp.AuctionID == "" {
+		return fmt.Errorf("%w: response has no auction ID", ErrConfirmUnsupported)
+	}
+	if caps, ok := b.Capabilities(); ok && !caps.Has(CapabilityConfirmation) {
+		return fmt.Errorf("%w: builder API doesn't support it", ErrConfirmUnsupported)
+	}
+
+	validatorAddr, err := NormalizeValidatorAddress(req.ValidatorAddress)
+	if err != nil {
+		return err
+	}
+
+	if confirmed, ok := b.confirmed.get(req.ChainID, req.Height, validatorAddr); ok {
+		if confirmed != resp.AuctionID {
+			return fmt.Errorf("%w: auction %s already confirmed for height %d, have %s", ErrAuctionConflict, confirmed, req.Height, resp.AuctionID)
+		}
+		return nil
+	}
+
+	txsHash, err := HashTxsVersion(req.TxsHashVersion, resp.Txs...)
+	if err != nil {
+		return err
+	}
+
+	creq := &ConfirmRequest{
+		ChainID:          req.ChainID,
+		Height:           req.Height,
+		ValidatorAddress: validatorAddr,
+		AuctionID:        resp.AuctionID,
+		TxsHash:          txsHash,
+		KeyType:          req.KeyType,
+		DomainTag:        req.DomainTag,
+		ProviderChainID:  req.ProviderChainID,
+		ConsumerID:       req.ConsumerID,
+	}
+
+	var cresp ConfirmResponse
+	if err := b.Call(ctx, confirmEndpoint, creq, &cresp); err != nil {
+		var se *StatusError
+		if errors.As(err, &se) && se.Code == http.StatusConflict {
+			return fmt.Errorf("%w: %v", ErrAuctionConflict, err)
+		}
+		return err
+	}
+	if cresp.AuctionID != resp.AuctionID {
+		return fmt.Errorf("%w: auction %s already confirmed for height %d, have %s", ErrAuctionConflict, cresp.AuctionID, req.Height, resp.AuctionID)
+	}
+
+	b.confirmed.put(req.ChainID, req.Height, validatorAddr, resp.AuctionID)
+	b.getLogger().Infof("build confirmed: chain_id=%s height=%d auction_id=%s", req.ChainID, req.Height, resp.AuctionID)
+	return nil
+}
+
+// confirmCache remembers the most recently confirmed auction, so confirming
+// it again doesn't hit the builder API, and a conflicting retry is caught
+// without one.
+type confirmCache struct {
+	mtx       sync.Mutex
+	id        string // chain ID and validator address
+	height    int64
+	auctionID string
+}
+
+func (c *confirmCache) get(chainID string, height int64, validatorAddr string) (string, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.id != chainID+":"+validatorAddr || c.height != height {
+		return "", false
+	}
+	return c.auctionID, true
+}
+
+func (c *confirmCache) put(chainID string, height int64, validatorAddr, auctionID string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.id, c.height, c.auctionID = chainID+":"+validatorAddr, height, auctionID
+}
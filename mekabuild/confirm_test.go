@@ -0,0 +1,152 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestConfirmBuild(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		key       = newMockKey(t, "validator", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		newReq    = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 7, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	req := newReq()
+	resp, err := builder.BuildBlock(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AuctionID == "" {
+		t.Fatalf("response has no auction ID")
+	}
+
+	if err := builder.ConfirmBuild(ctx, req, resp); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if err := builder.ConfirmBuild(ctx, req, resp); err != nil {
+		t.Fatalf("confirm again: %v", err)
+	}
+	if auctionID, ok := api.Confirmed(chainID, key.addr, 7); !ok || auctionID != resp.AuctionID {
+		t.Errorf("confirmed: want %s, have %q (%v)", resp.AuctionID, auctionID, ok)
+	}
+
+	// A retry at the same height hits a different auction.
+	retryReq := newReq()
+	retry, err := builder.BuildBlock(ctx, retryReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry.AuctionID == resp.AuctionID {
+		t.Fatalf("retry: want a different auction, have %s", retry.AuctionID)
+	}
+	if err := builder.ConfirmBuild(ctx, retryReq, retry); !errors.Is(err, mekabuild.ErrAuctionConflict) {
+		t.Errorf("retry: want %v, have %v", mekabuild.ErrAuctionConflict, err)
+	}
+
+	// A builder that didn't see the first confirmation, e.g. after a
+	// restart, learns about the conflict from the builder API.
+	restarted := mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	if err := restarted.ConfirmBuild(ctx, retryReq, retry); !errors.Is(err, mekabuild.ErrAuctionConflict) {
+		t.Errorf("restarted: want %v, have %v", mekabuild.ErrAuctionConflict, err)
+	}
+	if auctionID, _ := api.Confirmed(chainID, key.addr, 7); auctionID != resp.AuctionID {
+		t.Errorf("confirmed after conflicts: want %s, have %s", resp.AuctionID, auctionID)
+	}
+
+	unsupported := mekabuild.NewBuilder(&http.Client{}, apiURL, struct{ mekabuild.Signer }{key}, chainID, key.addr)
+	if err := unsupported.ConfirmBuild(ctx, retryReq, retry); !errors.Is(err, mekabuild.ErrConfirmUnsupported) {
+		t.Errorf("signer without ConfirmSigner: want %v, have %v", mekabuild.ErrConfirmUnsupported, err)
+	}
+	if err := builder.ConfirmBuild(ctx, retryReq, &mekabuild.BuildBlockResponse{Txs: retry.Txs}); !errors.Is(err, mekabuild.ErrConfirmUnsupported) {
+		t.Errorf("no auction ID: want %v, have %v", mekabuild.ErrConfirmUnsupported, err)
+	}
+}
+
+func TestConfirmBuilds(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		key       = newMockKey(t, "validator", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		newReq    = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 3, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithConfirmBuilds(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.SetFallback(mekabuild.NewMempoolFallback(nil))
+
+	resp, err := builder.BuildBlock(ctx, newReq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Fallback {
+		t.Fatalf("first build: want builder response, have fallback")
+	}
+	if auctionID, ok := api.Confirmed(chainID, key.addr, 3); !ok || auctionID != resp.AuctionID {
+		t.Errorf("confirmed: want %s, have %q (%v)", resp.AuctionID, auctionID, ok)
+	}
+
+	// The auction of the retry can't be settled, so the block is assembled
+	// locally.
+	retry, err := builder.BuildBlock(ctx, newReq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !retry.Fallback {
+		t.Errorf("retry: want fallback, have auction %s", retry.AuctionID)
+	}
+}
+
+func TestBuildBlockResponseAuctionID(t *testing.T) {
+	t.Parallel()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		req  = &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: "validator"}
+		resp = &mekabuild.BuildBlockResponse{Txs: [][]byte{[]byte("tx")}, AuctionID: "auction-1"}
+	)
+	if err := mekabuild.SignBuildBlockResponse(req, resp, privateKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := mekabuild.VerifyBuildBlockResponse(req, resp, publicKey); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	resp.AuctionID = "auction-2"
+	if err := mekabuild.VerifyBuildBlockResponse(req, resp, publicKey); !errors.Is(err, mekabuild.ErrBadResponseSignature) {
+		t.Errorf("changed auction ID: want %v, have %v", mekabuild.ErrBadResponseSignature, err)
+	}
+}
@@ -0,0 +1,163 @@
+// Package conformance provides a canonical corpus of builder API payloads, as
+// produced by this client, and a runner that checks a builder API server
+// against it. Alternative server implementations can use the corpus to prove
+// byte-level compatibility with the client.
+//
+// The corpus is also available as plain JSON files in the corpus directory,
+// one file per case, for implementations in other languages.
+package conformance
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"testing"
+)
+
+// Kinds of case.
+const (
+	KindBuildBlockRequest  = "build-block-request"
+	KindBuildBlockResponse = "build-block-response"
+	KindRegisterChallenge  = "register-challenge"
+)
+
+// Case is a single payload in the corpus.
+type Case struct {
+	Name    string `json:"name"`
+	Version string `json:"version"` // API version, e.g. "v0"
+	Kind    string `json:"kind"`
+	Path    string `json:"path,omitempty"` // API path the body is sent to
+
+	// Body is the exact JSON body sent by the client, uncompressed, and
+	// GzipBody the same body as sent with gzip content encoding. Servers
+	// must accept both. Body is kept as a string, rather than embedded
+	// JSON, so the corpus files preserve it byte for byte.
+	Body     string `json:"body"`
+	GzipBody []byte `json:"gzip_body,omitempty"`
+
+	// Request is the JSON request a response case responds to.
+	Request string `json:"request,omitempty"`
+
+	// SignBytes are the bytes covered by Signature, which is made by the
+	// key with PublicKey: the validator key for requests and challenges,
+	// and the builder API key for responses.
+	SignBytes []byte `json:"sign_bytes"`
+	Signature []byte `json:"signature"`
+	PublicKey []byte `json:"public_key"`
+
+	// Valid is false for cases that must be rejected, e.g. because the
+	// signature doesn't match the body.
+	Valid bool `json:"valid"`
+}
+
+// Identities used throughout the corpus. Servers under test must consider the
+// validator part of the chain's validator set.
+const (
+	ChainID          = "conformance-1"
+	ValidatorAddress = "5A3B1E6C9F2D4A8B7C0E1F2A3B4C5D6E7F8A9B0C"
+)
+
+// ValidatorKey and BuilderKey are the deterministic keys used to sign the
+// corpus. They're derived from fixed seeds, and must never be used for
+// anything else.
+var (
+	ValidatorKey = ed25519.NewKeyFromSeed(seed("validator"))
+	BuilderKey   = ed25519.NewKeyFromSeed(seed("builder"))
+)
+
+func seed(name string) []byte {
+	sum := sha256.Sum256([]byte("mekabuild conformance " + name))
+	return sum[:]
+}
+
+//go:embed corpus
+var corpus embed.FS
+
+// Cases returns every case in the corpus, sorted by version and name.
+func Cases() ([]Case, error) {
+	var cases []Case
+	err := fs.WalkDir(corpus, "corpus", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".json" {
+			return err
+		}
+
+		data, err := corpus.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		var c Case
+		if err := json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("decode %s: %w", p, err)
+		}
+
+		cases = append(cases, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(cases, func(i, j int) bool {
+		if cases[i].Version != cases[j].Version {
+			return cases[i].Version < cases[j].Version
+		}
+		return cases[i].Name < cases[j].Name
+	})
+
+	return cases, nil
+}
+
+// RunHandler sends every build request case in the corpus to h, both plain and
+// gzip encoded, and checks that valid cases are accepted with 200, and invalid
+// cases are rejected with a 4xx status. The handler must recognize ChainID and
+// ValidatorAddress, with the public key of ValidatorKey.
+//
+// Response and challenge cases aren't sent, as they depend on server state;
+// servers should check them against their own signing and verification code.
+func RunHandler(t testing.TB, h http.Handler) {
+	t.Helper()
+
+	cases, err := Cases()
+	if err != nil {
+		t.Fatalf("load corpus: %v", err)
+	}
+
+	for _, c := range cases {
+		if c.Kind != KindBuildBlockRequest {
+			continue
+		}
+
+		for _, encoding := range []string{"identity", "gzip"} {
+			body := []byte(c.Body)
+			if encoding == "gzip" {
+				body = c.GzipBody
+			}
+
+			r := httptest.NewRequest(http.MethodPost, c.Path, bytes.NewReader(body))
+			r.Header.Set("content-type", "application/json")
+			r.Header.Set("zenith-chain-id", ChainID)
+			if encoding == "gzip" {
+				r.Header.Set("content-encoding", "gzip")
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			switch code := w.Code; {
+			case c.Valid && code != http.StatusOK:
+				t.Errorf("%s/%s (%s): valid case rejected with %d: %s", c.Version, c.Name, encoding, code, w.Body.String())
+			case !c.Valid && (code < 400 || code > 499):
+				t.Errorf("%s/%s (%s): invalid case got %d, want 4xx", c.Version, c.Name, encoding, code)
+			}
+		}
+	}
+}
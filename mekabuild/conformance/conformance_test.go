@@ -0,0 +1,317 @@
+package conformance_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+	"github.com/meka-dev/mekatek-go/mekabuild/conformance"
+)
+
+var update = flag.Bool("update", false, "regenerate the corpus")
+
+func TestCorpus(t *testing.T) {
+	if *update {
+		generate(t)
+	}
+
+	cases, err := conformance.Cases()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cases) == 0 {
+		t.Fatal("empty corpus")
+	}
+
+	for _, c := range cases {
+		t.Run(c.Version+"/"+c.Name, func(t *testing.T) {
+			if !ed25519.Verify(c.PublicKey, c.SignBytes, c.Signature) {
+				t.Errorf("signature doesn't verify over sign bytes")
+			}
+
+			signBytes, canonical := decodeCase(t, c)
+
+			if want, have := c.Valid, bytes.Equal(c.SignBytes, signBytes); want != have {
+				t.Errorf("sign bytes match body: want %v, have %v", want, have)
+			}
+
+			if c.Body != string(canonical) {
+				t.Errorf("body isn't canonical\nwant %s\nhave %s", canonical, c.Body)
+			}
+
+			if c.GzipBody != nil {
+				zr, err := gzip.NewReader(bytes.NewReader(c.GzipBody))
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c.Body != string(body) {
+					t.Errorf("gzip body doesn't match body")
+				}
+			}
+		})
+	}
+}
+
+func TestRunHandler(t *testing.T) {
+	conformance.RunHandler(t, mekabuild.GunzipRequestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req mekabuild.BuildBlockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.ChainID != conformance.ChainID || req.ValidatorAddress != conformance.ValidatorAddress {
+			http.Error(w, "validator not in valset", http.StatusBadRequest)
+			return
+		}
+
+		if err := mekabuild.VerifyBuildBlockRequest(&req, conformance.ValidatorKey.Public().(ed25519.PublicKey)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(mekabuild.BuildBlockResponse{Txs: req.Txs})
+	})))
+}
+
+// decodeCase decodes the case body, and returns the sign bytes computed from
+// it, and its canonical encoding.
+func decodeCase(t *testing.T, c conformance.Case) (signBytes, canonical []byte) {
+	t.Helper()
+
+	var (
+		v   interface{}
+		msg func() ([]byte, error)
+	)
+	switch c.Kind {
+	case conformance.KindBuildBlockRequest:
+		var req mekabuild.BuildBlockRequest
+		v, msg = &req, req.SignBytes
+	case conformance.KindRegisterChallenge:
+		var req mekabuild.RegisterRequest
+		v, msg = &req, func() ([]byte, error) { return mekabuild.ChallengeSignBytes(req.Challenge), nil }
+	case conformance.KindBuildBlockResponse:
+		var (
+			req  mekabuild.BuildBlockRequest
+			resp mekabuild.BuildBlockResponse
+		)
+		if err := json.Unmarshal([]byte(c.Request), &req); err != nil {
+			t.Fatal(err)
+		}
+		v, msg = &resp, func() ([]byte, error) { return resp.SignBytes(&req) }
+	default:
+		t.Fatalf("unknown kind %q", c.Kind)
+	}
+
+	if err := json.Unmarshal([]byte(c.Body), v); err != nil {
+		t.Fatal(err)
+	}
+
+	signBytes, err := msg()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canonical, err = json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signBytes, append(canonical, '\n')
+}
+
+//
+//
+//
+
+// generate regenerates the corpus. Build requests are sent through a real
+// Builder, and captured, so the corpus reflects the bytes the client sends.
+func generate(t *testing.T) {
+	t.Helper()
+
+	var (
+		basic = mekabuild.BuildBlockRequest{
+			ChainID:          conformance.ChainID,
+			Height:           100,
+			ValidatorAddress: conformance.ValidatorAddress,
+			MaxBytes:         22020096,
+			MaxGas:           -1,
+			Txs:              [][]byte{[]byte("tx-1"), []byte("tx-2"), []byte("tx-3")},
+			Hint:             &mekabuild.AuctionHint{RTTMillis: 25, TimeBudgetMillis: 800},
+		}
+		cases []conformance.Case
+	)
+
+	for _, tc := range []struct {
+		name   string
+		modify func(*mekabuild.BuildBlockRequest)
+	}{
+		{"build-basic", func(*mekabuild.BuildBlockRequest) {}},
+		{"build-empty-txs", func(r *mekabuild.BuildBlockRequest) { r.Txs = nil }},
+		{"build-merkle-txs-hash", func(r *mekabuild.BuildBlockRequest) { r.TxsHashVersion = mekabuild.TxsHashMerkle }},
+		{"build-replay-protection", func(r *mekabuild.BuildBlockRequest) { r.Nonce, r.Timestamp = 1660000000000000000, 1660000000000 }},
+		{"build-fee-market", func(r *mekabuild.BuildBlockRequest) {
+			r.FeeMarket = &mekabuild.FeeMarket{MinGasPrices: "0.0025uatom", BaseFee: "0.001uatom"}
+		}},
+	} {
+		req := basic
+		tc.modify(&req)
+		cases = append(cases, captureBuildCase(t, tc.name, req))
+	}
+
+	// A request whose body was modified after signing.
+	bad := captureBuildCase(t, "build-bad-signature", basic)
+	var tampered mekabuild.BuildBlockRequest
+	json.Unmarshal([]byte(bad.Body), &tampered)
+	tampered.Height++
+	bad.Body = mustEncode(t, &tampered)
+	bad.GzipBody = mustGzip(t, []byte(bad.Body))
+	bad.Valid = false
+	cases = append(cases, bad)
+
+	challenge := []byte("conformance challenge 0123456789")
+	register := mekabuild.RegisterRequest{
+		ChainID:          conformance.ChainID,
+		ValidatorAddress: conformance.ValidatorAddress,
+		PaymentAddress:   "cosmos1payment",
+		Challenge:        challenge,
+		Signature:        ed25519.Sign(conformance.ValidatorKey, mekabuild.ChallengeSignBytes(challenge)),
+	}
+	cases = append(cases, conformance.Case{
+		Name:      "register-challenge",
+		Version:   "v0",
+		Kind:      conformance.KindRegisterChallenge,
+		Path:      "/v0/register",
+		Body:      mustEncode(t, &register),
+		SignBytes: mekabuild.ChallengeSignBytes(challenge),
+		Signature: register.Signature,
+		PublicKey: conformance.ValidatorKey.Public().(ed25519.PublicKey),
+		Valid:     true,
+	})
+
+	resp := mekabuild.BuildBlockResponse{Txs: [][]byte{[]byte("bundle-tx"), []byte("tx-1")}, ValidatorPayment: "1000uatom"}
+	if err := mekabuild.SignBuildBlockResponse(&basic, &resp, conformance.BuilderKey); err != nil {
+		t.Fatal(err)
+	}
+	respSignBytes, _ := resp.SignBytes(&basic)
+	cases = append(cases, conformance.Case{
+		Name:      "build-response-signed",
+		Version:   "v0",
+		Kind:      conformance.KindBuildBlockResponse,
+		Path:      "/v0/build",
+		Body:      mustEncode(t, &resp),
+		Request:   mustEncode(t, &basic),
+		SignBytes: respSignBytes,
+		Signature: resp.Signature,
+		PublicKey: conformance.BuilderKey.Public().(ed25519.PublicKey),
+		Valid:     true,
+	})
+
+	dir := filepath.Join("corpus", "v0")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		data, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, c.Name+".json"), append(data, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Logf("regenerated %d cases; rerun without -update to verify the embedded corpus", len(cases))
+}
+
+// captureBuildCase sends req through a Builder, with and without compression,
+// and captures the request bodies.
+func captureBuildCase(t *testing.T, name string, req mekabuild.BuildBlockRequest) conformance.Case {
+	t.Helper()
+
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+		fmt.Fprintln(w, `{}`)
+	}))
+	defer server.Close()
+
+	apiURL, _ := url.Parse(server.URL)
+	builder := mekabuild.NewBuilder(&http.Client{}, apiURL, validatorSigner{}, conformance.ChainID, conformance.ValidatorAddress)
+
+	c := conformance.Case{
+		Name:      name,
+		Version:   "v0",
+		Kind:      conformance.KindBuildBlockRequest,
+		Path:      "/v0/build",
+		PublicKey: conformance.ValidatorKey.Public().(ed25519.PublicKey),
+		Valid:     true,
+	}
+
+	for _, compress := range []bool{false, true} {
+		r := req
+		builder.SetCompression(compress)
+		if _, err := builder.BuildBlock(context.Background(), &r); err != nil {
+			t.Fatal(err)
+		}
+
+		if compress {
+			c.GzipBody = <-bodies
+		} else {
+			c.Body = string(<-bodies)
+			c.SignBytes, _ = r.SignBytes()
+			c.Signature = r.Signature
+		}
+	}
+
+	return c
+}
+
+type validatorSigner struct{}
+
+func (validatorSigner) SignBuildBlockRequest(req *mekabuild.BuildBlockRequest) error {
+	msg, err := req.SignBytes()
+	if err != nil {
+		return err
+	}
+	req.Signature = ed25519.Sign(conformance.ValidatorKey, msg)
+	return nil
+}
+
+func mustEncode(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data) + "\n"
+}
+
+func mustGzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,38 @@
+package mekabuild
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers conveying consensus state to the builder API, so it can adapt the
+// auction duration per round.
+const (
+	ConsensusRoundHeader = "mekatek-consensus-round"
+	TimeoutProposeHeader = "mekatek-timeout-propose-ms"
+)
+
+// WithConsensusState returns a context carrying the current consensus round,
+// and the node's configured timeout_propose. Tendermint integrations should
+// pass it to BuildBlock, which forwards both values to the builder API.
+func WithConsensusState(ctx context.Context, round int32, timeoutPropose time.Duration) context.Context {
+	return context.WithValue(ctx, consensusStateKey{}, consensusState{round, timeoutPropose})
+}
+
+type consensusState struct {
+	round          int32
+	timeoutPropose time.Duration
+}
+
+type consensusStateKey struct{}
+
+func setConsensusHeaders(ctx context.Context, hdr http.Header) {
+	cs, ok := ctx.Value(consensusStateKey{}).(consensusState)
+	if !ok {
+		return
+	}
+	hdr.Set(ConsensusRoundHeader, strconv.FormatInt(int64(cs.round), 10))
+	hdr.Set(TimeoutProposeHeader, strconv.FormatInt(cs.timeoutPropose.Milliseconds(), 10))
+}
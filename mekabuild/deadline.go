@@ -0,0 +1,78 @@
+package mekabuild
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TimeoutHeader carries the time remaining before the builder gives up on a
+// request, in milliseconds, like gRPC's grpc-timeout. It's set on every
+// attempt with a deadline, from the earliest of the caller's deadline, the
+// builder's timeout, and the retry policy's per-attempt timeout, so a retry or
+// a failover to another endpoint carries only the time that's left. The value
+// is relative, so it's unaffected by clock skew between the builder and the
+// builder API.
+//
+// The builder API shouldn't spend longer than that on the request, e.g. on an
+// auction, since the builder won't wait for the response. See
+// TimeoutMiddleware.
+const TimeoutHeader = "mekatek-timeout-ms"
+
+// setTimeoutHeader sets the timeout header from the deadline of ctx, if any.
+func (b *Builder) setTimeoutHeader(ctx context.Context, hdr http.Header) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	remaining := b.until(deadline)
+	if remaining <= 0 {
+		return // the request fails anyway
+	}
+	hdr.Set(TimeoutHeader, strconv.FormatInt(remaining.Milliseconds(), 10))
+}
+
+// RequestTimeout returns the timeout carried by the request's TimeoutHeader.
+// It returns false if the header is missing or malformed.
+func RequestTimeout(r *http.Request) (time.Duration, bool) {
+	s := r.Header.Get(TimeoutHeader)
+	if s == "" {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ms < 0 || ms > int64(maxRequestTimeout/time.Millisecond) {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// maxRequestTimeout bounds timeouts accepted by RequestTimeout, to rule out
+// overflows.
+const maxRequestTimeout = 24 * time.Hour
+
+// TimeoutMiddleware applies the timeout of each request's TimeoutHeader to the
+// request context, so handlers stop working on requests the builder has
+// already given up on. Requests without a valid header are served with their
+// context unchanged.
+func TimeoutMiddleware(h http.Handler) http.Handler {
+	return TimeoutMiddlewareReserve(0)(h)
+}
+
+// TimeoutMiddlewareReserve is like TimeoutMiddleware, but shortens each
+// timeout by reserve, e.g. the time needed to send the response back to the
+// builder. Timeouts shorter than reserve expire immediately.
+func TimeoutMiddlewareReserve(reserve time.Duration) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout, ok := RequestTimeout(r)
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout-reserve)
+			defer cancel()
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package mekabuild_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+// timeoutRecorder records the timeout header of each request, and fails the
+// first failures requests with 503 Service Unavailable.
+type timeoutRecorder struct {
+	http.Handler
+	failures int
+
+	mtx      sync.Mutex
+	timeouts []int64 // -1 if missing
+}
+
+func (rec *timeoutRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	timeout := int64(-1)
+	if s := r.Header.Get(mekabuild.TimeoutHeader); s != "" {
+		timeout, _ = strconv.ParseInt(s, 10, 64)
+	}
+	rec.mtx.Lock()
+	rec.timeouts = append(rec.timeouts, timeout)
+	fail := len(rec.timeouts) <= rec.failures
+	rec.mtx.Unlock()
+
+	if fail {
+		http.Error(w, "injected failure", http.StatusServiceUnavailable)
+		return
+	}
+	rec.Handler.ServeHTTP(w, r)
+}
+
+func (rec *timeoutRecorder) recorded() []int64 {
+	rec.mtx.Lock()
+	defer rec.mtx.Unlock()
+	return append([]int64(nil), rec.timeouts...)
+}
+
+func TestTimeoutHeader(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		key       = newMockKey(t, "validator", nil)
+		api       = newMockAPI()
+		rec       = &timeoutRecorder{Handler: api, failures: 2}
+		server    = newTestServer(t, rec)
+		apiURL, _ = url.Parse(server.URL)
+		req       = &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: key.addr}
+	)
+	api.AddPublicKey("chain-id", key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, "chain-id", key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithTimeout(2*time.Second),
+		mekabuild.WithRetry(mekabuild.RetryPolicy{MaxAttempts: 3, BaseBackoff: 20 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builder.BuildBlock(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every attempt carries the time left of the call timeout.
+	timeouts := rec.recorded()
+	if want, have := 3, len(timeouts); want != have {
+		t.Fatalf("attempts: want %d, have %v", want, timeouts)
+	}
+	for i, timeout := range timeouts {
+		if timeout <= 0 || timeout > 2000 {
+			t.Errorf("attempt %d: want timeout in (0, 2000], have %d", i+1, timeout)
+		}
+		if i > 0 && timeout > timeouts[i-1]-20 {
+			t.Errorf("attempt %d: want timeout at least the backoff below %d, have %d", i+1, timeouts[i-1], timeout)
+		}
+	}
+
+	// The caller's deadline applies, if it's earlier.
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	req.Height = 2
+	if _, err := builder.BuildBlock(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if timeout := rec.recorded()[3]; timeout <= 0 || timeout > 500 {
+		t.Errorf("caller deadline: want timeout in (0, 500], have %d", timeout)
+	}
+}
+
+func TestTimeoutHeaderFailover(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx        = context.Background()
+		key        = newMockKey(t, "validator", nil)
+		api        = newMockAPI()
+		slow       = &timeoutRecorder{Handler: api, failures: 1}
+		healthy    = &timeoutRecorder{Handler: api}
+		slowURL, _ = url.Parse(newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			slow.ServeHTTP(w, r)
+		})).URL)
+		healthyURL, _ = url.Parse(newTestServer(t, healthy).URL)
+	)
+	api.AddPublicKey("chain-id", key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, "chain-id", key.addr,
+		mekabuild.WithEndpoints(slowURL, healthyURL),
+		mekabuild.WithRetry(mekabuild.RetryPolicy{MaxAttempts: 1, PerAttemptTimeout: time.Second}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 1050*time.Millisecond)
+	defer cancel()
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: key.addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each attempt is bound by the per-attempt timeout, and the failover
+	// attempt by the time left of the caller's deadline, once it's earlier.
+	first, second := slow.recorded(), healthy.recorded()
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("attempts: want 1 per endpoint, have %v and %v", first, second)
+	}
+	if first[0] <= 900 || first[0] > 1000 {
+		t.Errorf("first attempt: want per-attempt timeout, have %d", first[0])
+	}
+	if second[0] <= 0 || second[0] > 950 {
+		t.Errorf("failover attempt: want time left of the deadline, have %d", second[0])
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	t.Parallel()
+
+	var (
+		deadline time.Time
+		ok       bool
+	)
+	h := mekabuild.TimeoutMiddlewareReserve(100 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	}))
+
+	r := httptest.NewRequest("POST", "/v0/build", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if ok {
+		t.Errorf("no header: want no deadline, have %s", deadline)
+	}
+
+	for _, s := range []string{"soon", "-5", "1e3"} {
+		r.Header.Set(mekabuild.TimeoutHeader, s)
+		if _, ok := mekabuild.RequestTimeout(r); ok {
+			t.Errorf("%q: want invalid timeout", s)
+		}
+	}
+
+	r.Header.Set(mekabuild.TimeoutHeader, "600")
+	begin := time.Now()
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if !ok {
+		t.Fatalf("want deadline, have none")
+	}
+	if d := deadline.Sub(begin); d < 450*time.Millisecond || d > 550*time.Millisecond {
+		t.Errorf("deadline: want about 500ms, have %s", d)
+	}
+}
@@ -0,0 +1,152 @@
+package mekabuild
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// txSlabSize is the size of the buffers that decoded txs are packed into.
+// Packing txs into a few large buffers, rather than allocating each one
+// separately, keeps the number of live objects low, and with it the cost of
+// garbage collection right before the validator proposes.
+const txSlabSize = 1 << 20
+
+// decodeBuildBlockResponseJSON decodes a JSON build response from r in a
+// streaming fashion. The txs array is walked token by token, and each tx is
+// decoded from base64 straight into a slab, so neither the whole JSON document
+// nor an intermediate copy of every tx is held in memory. Other fields are
+// decoded as usual.
+func decodeBuildBlockResponseJSON(r io.Reader, m *BuildBlockResponse) error {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil // like json.Unmarshal, null is a no-op
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("want object, have %v", tok)
+	}
+
+	var (
+		fields = map[string]json.RawMessage{}
+		txs    [][]byte
+		hasTxs bool
+	)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("invalid object key %v", tok)
+		}
+
+		if key != "txs" {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return fmt.Errorf("decode %s: %w", key, err)
+			}
+			fields[key] = raw
+			continue
+		}
+
+		if txs, err = decodeTxsJSON(dec); err != nil {
+			return fmt.Errorf("decode txs: %w", err)
+		}
+		hasTxs = true
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+
+	if len(fields) > 0 {
+		rest, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(rest, m); err != nil {
+			return err
+		}
+	}
+	if hasTxs {
+		m.Txs = txs
+	}
+	return nil
+}
+
+// decodeTxsJSON decodes an array of base64 encoded txs, or null.
+func decodeTxsJSON(dec *json.Decoder) ([][]byte, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("want array, have %v", tok)
+	}
+
+	var (
+		txs  = [][]byte{}
+		slab []byte
+		raw  json.RawMessage // reused, each tx is decoded out of it
+	)
+	for dec.More() {
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+
+		var tx []byte
+		switch {
+		case string(raw) == "null":
+		case len(raw) >= 2 && raw[0] == '"':
+			s := raw[1 : len(raw)-1]
+			if bytes.IndexByte(s, '\\') >= 0 { // escaped, e.g. "\/"
+				var unescaped string
+				if err := json.Unmarshal(raw, &unescaped); err != nil {
+					return nil, err
+				}
+				s = []byte(unescaped)
+			}
+			n := base64.StdEncoding.DecodedLen(len(s))
+			if n > cap(slab)-len(slab) {
+				size := txSlabSize
+				if n > size {
+					size = n
+				}
+				slab = make([]byte, 0, size)
+			}
+			tx = slab[len(slab) : len(slab)+n]
+			if n, err = base64.StdEncoding.Decode(tx, s); err != nil {
+				return nil, fmt.Errorf("tx %d: %w", len(txs), err)
+			}
+			tx = tx[:n:n] // appends to the tx mustn't overwrite the next
+			slab = slab[:len(slab)+n]
+		default:
+			return nil, fmt.Errorf("tx %d: want string, have %s", len(txs), raw)
+		}
+		txs = append(txs, tx)
+	}
+
+	return txs, expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("want %v, have %v", want, tok)
+	}
+	return nil
+}
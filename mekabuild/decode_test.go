@@ -0,0 +1,137 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"encoding/json"
+	mathrand "math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestJSONCodecDecodeBuildBlockResponse(t *testing.T) {
+	t.Parallel()
+
+	rng := mathrand.New(mathrand.NewSource(1))
+	large := make([]byte, 3<<20) // larger than a slab
+	rng.Read(large)
+
+	for _, tc := range []struct {
+		name string
+		body string
+	}{
+		{"empty", `{}`},
+		{"null", `null`},
+		{"null txs", `{"txs":null,"validator_payment":"1uatom"}`},
+		{"empty txs", `{"txs":[]}`},
+		{"null tx", `{"txs":["dHgx",null,""]}`},
+		{"escaped", `{"txs":["P\/8=","dHgy"]}`},
+		{"unknown fields", `{"unknown":{"nested":[1,2]},"txs":["dHgx"],"signature":"c2ln","validator_payment":"2uatom"}`},
+		{"large", string(mustMarshal(t, mekabuild.BuildBlockResponse{Txs: [][]byte{[]byte("small"), large, []byte("after")}, ValidatorPayment: "3uatom"}))},
+		{"random", string(mustMarshal(t, randomResponse(rng, 1000)))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var want mekabuild.BuildBlockResponse
+			if err := json.Unmarshal([]byte(tc.body), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			var have mekabuild.BuildBlockResponse
+			if err := mekabuild.JSONCodec.Decode(strings.NewReader(tc.body), &have); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(want, have) {
+				t.Errorf("want %+v, have %+v", want, have)
+			}
+		})
+	}
+
+	for _, body := range []string{
+		``,
+		`[]`,
+		`{"txs":{}}`,
+		`{"txs":[1]}`,
+		`{"txs":["not base64!"]}`,
+		`{"txs":["dHgx"]`,
+		`{"validator_payment":1}`,
+	} {
+		var resp mekabuild.BuildBlockResponse
+		if err := mekabuild.JSONCodec.Decode(strings.NewReader(body), &resp); err == nil {
+			t.Errorf("%q: want error, have none", body)
+		}
+	}
+}
+
+func TestCodecDecodeTxsIndependent(t *testing.T) {
+	t.Parallel()
+
+	for _, codec := range []mekabuild.Codec{mekabuild.JSONCodec, mekabuild.ProtoCodec} {
+		var buf bytes.Buffer
+		if err := codec.Encode(&buf, &mekabuild.BuildBlockResponse{Txs: [][]byte{[]byte("tx1"), []byte("tx2")}}); err != nil {
+			t.Fatal(err)
+		}
+
+		var resp mekabuild.BuildBlockResponse
+		if err := codec.Decode(&buf, &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		// Txs share a buffer, but appending to one mustn't overwrite
+		// another.
+		_ = append(resp.Txs[0], "overwritten"...)
+		if want, have := "tx2", string(resp.Txs[1]); want != have {
+			t.Errorf("%s: tx 1: want %q, have %q", codec.ContentType(), want, have)
+		}
+	}
+}
+
+func BenchmarkJSONCodecDecodeBuildBlockResponse(b *testing.B) {
+	var (
+		rng  = mathrand.New(mathrand.NewSource(1))
+		body = mustMarshal(b, randomResponse(rng, 20000))
+	)
+
+	b.Run("streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			var resp mekabuild.BuildBlockResponse
+			if err := mekabuild.JSONCodec.Decode(bytes.NewReader(body), &resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			var resp mekabuild.BuildBlockResponse
+			if err := json.NewDecoder(bytes.NewReader(body)).Decode(&resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func randomResponse(rng *mathrand.Rand, n int) mekabuild.BuildBlockResponse {
+	resp := mekabuild.BuildBlockResponse{ValidatorPayment: "1uatom"}
+	for i := 0; i < n; i++ {
+		tx := make([]byte, rng.Intn(2000))
+		rng.Read(tx)
+		resp.Txs = append(resp.Txs, tx)
+	}
+	return resp
+}
+
+func mustMarshal(tb testing.TB, v interface{}) []byte {
+	tb.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
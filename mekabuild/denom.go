@@ -0,0 +1,167 @@
+package mekabuild
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// DenomTrace is the origin of an IBC voucher denom: the ports and channels
+// the tokens were transferred through, and their denom on the source chain.
+type DenomTrace struct {
+	Path      string `json:"path"`       // e.g. "transfer/channel-0", empty for native denoms
+	BaseDenom string `json:"base_denom"` // e.g. "uatom"
+}
+
+// FullPath returns the full denom path, e.g. "transfer/channel-0/uatom".
+func (t DenomTrace) FullPath() string {
+	if t.Path == "" {
+		return t.BaseDenom
+	}
+	return t.Path + "/" + t.BaseDenom
+}
+
+// IBCDenom returns the voucher denom for the trace, i.e. "ibc/" followed by
+// the uppercase hex SHA-256 hash of the full path, or the base denom if the
+// trace has no path.
+func (t DenomTrace) IBCDenom() string {
+	if t.Path == "" {
+		return t.BaseDenom
+	}
+	sum := sha256.Sum256([]byte(t.FullPath()))
+	return ibcDenomPrefix + strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+const ibcDenomPrefix = "ibc/"
+
+// DenomResolver resolves the hash of an IBC voucher denom, i.e. the part after
+// "ibc/", to its denom trace. It's typically a query of the chain's IBC
+// transfer module, e.g. the DenomTrace gRPC query of ibc-go, made through the
+// node's own query client.
+//
+// Implementations must be safe for concurrent use.
+type DenomResolver interface {
+	DenomTrace(ctx context.Context, hash string) (DenomTrace, error)
+}
+
+// DenomResolverFunc adapts a function to a DenomResolver.
+type DenomResolverFunc func(ctx context.Context, hash string) (DenomTrace, error)
+
+// DenomTrace implements DenomResolver.
+func (f DenomResolverFunc) DenomTrace(ctx context.Context, hash string) (DenomTrace, error) {
+	return f(ctx, hash)
+}
+
+// ErrDenomUnresolved is returned when an IBC denom can't be resolved to its
+// denom trace.
+var ErrDenomUnresolved = errors.New("IBC denom unresolved")
+
+// SetDenomResolver sets the resolver used to map IBC voucher denoms to their
+// base denoms, see ResolveDenom. Resolved traces are cached for the lifetime
+// of the builder, as a denom trace never changes. By default, no resolver is
+// set, and IBC denoms are left unresolved.
+func (b *Builder) SetDenomResolver(r DenomResolver) {
+	b.denomResolver.Store(denomResolverBox{r})
+}
+
+// WithDenomResolver sets the denom resolver. See SetDenomResolver.
+func WithDenomResolver(r DenomResolver) Option {
+	return func(b *Builder) error {
+		b.SetDenomResolver(r)
+		return nil
+	}
+}
+
+type denomResolverBox struct{ DenomResolver }
+
+func (b *Builder) getDenomResolver() DenomResolver {
+	box, _ := b.denomResolver.Load().(denomResolverBox)
+	return box.DenomResolver
+}
+
+// ResolveDenom returns the denom trace of denom. Native denoms resolve to
+// themselves, without a path. IBC denoms are resolved with the resolver set
+// by SetDenomResolver, and the returned trace is checked against the hash, so
+// a faulty resolver can't misattribute payments. It returns an error wrapping
+// ErrDenomUnresolved if the denom can't be resolved.
+func (b *Builder) ResolveDenom(ctx context.Context, denom string) (DenomTrace, error) {
+	if !strings.HasPrefix(denom, ibcDenomPrefix) {
+		return DenomTrace{BaseDenom: denom}, nil
+	}
+
+	if trace, ok := b.denomTraces.get(denom); ok {
+		return trace, nil
+	}
+
+	r := b.getDenomResolver()
+	if r == nil {
+		return DenomTrace{}, fmt.Errorf("%w: %s: no denom resolver", ErrDenomUnresolved, denom)
+	}
+
+	hash := strings.TrimPrefix(denom, ibcDenomPrefix)
+	trace, err := r.DenomTrace(ctx, hash)
+	if err != nil {
+		return DenomTrace{}, fmt.Errorf("%w: %s: %v", ErrDenomUnresolved, denom, err)
+	}
+	if have := trace.IBCDenom(); !strings.EqualFold(have, denom) {
+		return DenomTrace{}, fmt.Errorf("%w: %s: resolver returned trace %q for %s", ErrDenomUnresolved, denom, trace.FullPath(), have)
+	}
+
+	b.denomTraces.put(denom, trace)
+	return trace, nil
+}
+
+// CoinsByBaseDenom returns the coins with every IBC voucher denom replaced by
+// its base denom, so that e.g. ATOM received over different channels sums to
+// a single amount of uatom. Denoms which can't be resolved are kept as they
+// are, and the first resolution error is returned along with the result.
+func (b *Builder) CoinsByBaseDenom(ctx context.Context, cs Coins) (Coins, error) {
+	var (
+		out      = make(Coins, 0, len(cs))
+		firstErr error
+	)
+	for _, c := range cs {
+		trace, err := b.ResolveDenom(ctx, c.Denom)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			out = append(out, Coin{Denom: c.Denom, Amount: new(big.Int).Set(c.amount())})
+			continue
+		}
+		out = append(out, Coin{Denom: trace.BaseDenom, Amount: new(big.Int).Set(c.amount())})
+	}
+	return normalizeCoins(out), firstErr
+}
+
+//
+//
+//
+
+type denomTraceCache struct {
+	mtx    sync.Mutex
+	traces map[string]DenomTrace // by upper-cased IBC denom
+}
+
+func (c *denomTraceCache) get(denom string) (DenomTrace, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	trace, ok := c.traces[strings.ToUpper(denom)]
+	return trace, ok
+}
+
+func (c *denomTraceCache) put(denom string, trace DenomTrace) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.traces == nil {
+		c.traces = map[string]DenomTrace{}
+	}
+	c.traces[strings.ToUpper(denom)] = trace
+}
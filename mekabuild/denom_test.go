@@ -0,0 +1,129 @@
+package mekabuild_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestDenomTraceIBCDenom(t *testing.T) {
+	t.Parallel()
+
+	trace := mekabuild.DenomTrace{Path: "transfer/channel-0", BaseDenom: "uatom"}
+	if want, have := "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2", trace.IBCDenom(); want != have {
+		t.Errorf("IBC denom: want %q, have %q", want, have)
+	}
+	if want, have := "uosmo", (mekabuild.DenomTrace{BaseDenom: "uosmo"}).IBCDenom(); want != have {
+		t.Errorf("native denom: want %q, have %q", want, have)
+	}
+}
+
+func TestBuilderCoinsByBaseDenom(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx      = context.Background()
+		channel0 = mekabuild.DenomTrace{Path: "transfer/channel-0", BaseDenom: "uatom"}
+		channel1 = mekabuild.DenomTrace{Path: "transfer/channel-1", BaseDenom: "uatom"}
+		bogus    = mekabuild.DenomTrace{Path: "transfer/channel-2", BaseDenom: "uatom"}
+		traces   = map[string]mekabuild.DenomTrace{}
+		queries  int32
+		resolver = mekabuild.DenomResolverFunc(func(ctx context.Context, hash string) (mekabuild.DenomTrace, error) {
+			atomic.AddInt32(&queries, 1)
+			trace, ok := traces[hash]
+			if !ok {
+				return mekabuild.DenomTrace{}, errors.New("not found")
+			}
+			return trace, nil
+		})
+		builder = mekabuild.NewBuilder(&http.Client{}, &url.URL{}, nil, "chain-id", "")
+	)
+
+	for _, trace := range []mekabuild.DenomTrace{channel0, channel1} {
+		traces[trace.IBCDenom()[len("ibc/"):]] = trace
+	}
+	traces[channel1.IBCDenom()[len("ibc/"):]+"00"] = channel0 // mismatched hash
+
+	coins := mekabuild.Coins{
+		{Denom: channel0.IBCDenom(), Amount: bigInt(100)},
+		{Denom: channel1.IBCDenom(), Amount: bigInt(20)},
+		{Denom: "uatom", Amount: bigInt(3)},
+		{Denom: "uosmo", Amount: bigInt(5)},
+	}
+
+	if _, err := builder.CoinsByBaseDenom(ctx, coins); !errors.Is(err, mekabuild.ErrDenomUnresolved) {
+		t.Errorf("without resolver: want %v, have %v", mekabuild.ErrDenomUnresolved, err)
+	}
+
+	builder.SetDenomResolver(resolver)
+	for i := 0; i < 2; i++ {
+		byBase, err := builder.CoinsByBaseDenom(ctx, coins)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := "123uatom,5uosmo", byBase.String(); want != have {
+			t.Errorf("by base denom: want %q, have %q", want, have)
+		}
+	}
+	if want, have := int32(2), atomic.LoadInt32(&queries); want != have {
+		t.Errorf("resolver queries: want %d (cached), have %d", want, have)
+	}
+
+	mismatched := "ibc/" + channel1.IBCDenom()[len("ibc/"):] + "00"
+	if _, err := builder.ResolveDenom(ctx, mismatched); !errors.Is(err, mekabuild.ErrDenomUnresolved) {
+		t.Errorf("mismatched trace: want %v, have %v", mekabuild.ErrDenomUnresolved, err)
+	}
+
+	byBase, err := builder.CoinsByBaseDenom(ctx, append(coins, mekabuild.Coin{Denom: bogus.IBCDenom(), Amount: bigInt(7)}))
+	if !errors.Is(err, mekabuild.ErrDenomUnresolved) {
+		t.Errorf("unknown denom: want %v, have %v", mekabuild.ErrDenomUnresolved, err)
+	}
+	if want, have := bigInt(7), byBase.AmountOf(bogus.IBCDenom()); want.Cmp(have) != 0 {
+		t.Errorf("unresolved amount: want %v, have %v", want, have)
+	}
+}
+
+func TestBuilderAuctionStatsByBaseDenom(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx    = context.Background()
+		trace  = mekabuild.DenomTrace{Path: "transfer/channel-0", BaseDenom: "uatom"}
+		server = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(mekabuild.AuctionStatsResponse{
+				Auctions:      1,
+				TotalPayments: mekabuild.Coins{{Denom: trace.IBCDenom(), Amount: bigInt(10)}, {Denom: "uatom", Amount: bigInt(1)}},
+			})
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, nil, "chain-id", "")
+	)
+
+	stats, err := builder.AuctionStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalPaymentsByBaseDenom != nil {
+		t.Errorf("without resolver: want no payments by base denom, have %v", stats.TotalPaymentsByBaseDenom)
+	}
+
+	builder.SetDenomResolver(mekabuild.DenomResolverFunc(func(context.Context, string) (mekabuild.DenomTrace, error) {
+		return trace, nil
+	}))
+	stats, err = builder.AuctionStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "11uatom", stats.TotalPaymentsByBaseDenom.String(); want != have {
+		t.Errorf("payments by base denom: want %q, have %q", want, have)
+	}
+}
+
+func bigInt(n int64) *big.Int { return big.NewInt(n) }
@@ -0,0 +1,151 @@
+package mekabuild
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// Deprecation describes usage of a deprecated feature, e.g. an environment
+// variable or API endpoint, along with guidance on how to migrate away.
+type Deprecation struct {
+	// ID uniquely identifies the deprecated feature.
+	ID string
+
+	// Message describes the deprecated usage.
+	Message string
+
+	// Migration describes how to migrate away from the deprecated usage.
+	Migration string
+
+	// Stage is how far along its removal the feature is. It's only set
+	// for deprecated APIs of this module, see DeprecatedAPIs.
+	Stage DeprecationStage
+}
+
+// DeprecationStage is how far along its removal a deprecated API is. APIs
+// move through the stages in order, one minor version at a time at most, so
+// forks get at least one release of compile-time guidance, via the
+// "Deprecated:" doc comments flagged by staticcheck and gopls, before an API
+// is removed.
+type DeprecationStage int
+
+const (
+	// DeprecationNotice APIs work as before, but are documented as
+	// deprecated, and reported once per process when used.
+	DeprecationNotice DeprecationStage = iota + 1
+
+	// DeprecationFrozen APIs still work, but don't get new features, which
+	// are only added to their replacements.
+	DeprecationFrozen
+
+	// DeprecationScheduled APIs are removed in the next minor version.
+	DeprecationScheduled
+)
+
+// String returns the name of the stage.
+func (s DeprecationStage) String() string {
+	switch s {
+	case DeprecationNotice:
+		return "notice"
+	case DeprecationFrozen:
+		return "frozen"
+	case DeprecationScheduled:
+		return "scheduled"
+	default:
+		return fmt.Sprintf("DeprecationStage(%d)", int(s))
+	}
+}
+
+// deprecatedAPIs are the deprecated Go APIs of this module, by name.
+var deprecatedAPIs = map[string]Deprecation{
+	"NewBuilder": {
+		ID:        "api:NewBuilder",
+		Message:   "mekabuild.NewBuilder is deprecated",
+		Migration: "use mekabuild.New with WithHTTPClient and WithEndpoints",
+		Stage:     DeprecationNotice,
+	},
+}
+
+// DeprecatedAPIs returns the deprecated Go APIs of this module, sorted by ID,
+// with their stage and migration, e.g. for migration tooling in forks.
+func DeprecatedAPIs() []Deprecation {
+	ds := make([]Deprecation, 0, len(deprecatedAPIs))
+	for _, d := range deprecatedAPIs {
+		ds = append(ds, d)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].ID < ds[j].ID })
+	return ds
+}
+
+// String returns a human-readable description of the deprecation.
+func (d Deprecation) String() string {
+	return fmt.Sprintf("DEPRECATED: %s: %s", d.Message, d.Migration)
+}
+
+// SetDeprecationHandler sets the function called when usage of a deprecated
+// feature is detected. Each deprecation is reported at most once per process.
+// By default, deprecations are printed with the standard library logger. A
+// nil handler discards deprecations. Setting a handler resets the set of
+// reported deprecations, so the new handler sees each of them once.
+func SetDeprecationHandler(h func(Deprecation)) {
+	deprecations.mtx.Lock()
+	defer deprecations.mtx.Unlock()
+	if h == nil {
+		h = func(Deprecation) {}
+	}
+	deprecations.handler = h
+	deprecations.reported = map[string]bool{}
+}
+
+var deprecations = struct {
+	mtx      sync.Mutex
+	handler  func(Deprecation)
+	reported map[string]bool
+}{
+	handler:  func(d Deprecation) { log.Print(d) },
+	reported: map[string]bool{},
+}
+
+func reportDeprecation(d Deprecation) {
+	deprecations.mtx.Lock()
+	if deprecations.reported[d.ID] {
+		deprecations.mtx.Unlock()
+		return
+	}
+	deprecations.reported[d.ID] = true
+	h := deprecations.handler
+	deprecations.mtx.Unlock()
+
+	h(d)
+}
+
+func reportDeprecatedAPI(name string) {
+	reportDeprecation(deprecatedAPIs[name])
+}
+
+func reportDeprecatedEnv(name, replacement string) {
+	reportDeprecation(Deprecation{
+		ID:        "env:" + name,
+		Message:   fmt.Sprintf("environment variable %s is deprecated", name),
+		Migration: fmt.Sprintf("rename it to %s", replacement),
+	})
+}
+
+// reportDeprecatedEndpoint reports a deprecation signaled by the builder API
+// via the Deprecation and Sunset response headers (RFC 8594).
+func reportDeprecatedEndpoint(path, deprecation, sunset, link string) {
+	migration := "upgrade the mekatek-go module"
+	if sunset != "" {
+		migration += fmt.Sprintf(" before %s", sunset)
+	}
+	if link != "" {
+		migration += fmt.Sprintf(", see %s", link)
+	}
+	reportDeprecation(Deprecation{
+		ID:        "endpoint:" + path,
+		Message:   fmt.Sprintf("builder API endpoint %s is deprecated (%s)", path, deprecation),
+		Migration: migration,
+	})
+}
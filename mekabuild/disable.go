@@ -0,0 +1,180 @@
+package mekabuild
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDisabled is returned by BuildBlock while the builder is disabled, see
+// Disable. Like other build failures, it's passed to the fallback.
+var ErrDisabled = errors.New("builder disabled")
+
+// DisabledState describes why and since when a builder is disabled.
+type DisabledState struct {
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// Disable stops the builder from sending build requests to the builder API,
+// without restarting the node, e.g. during an incident on the builder side.
+// Until Enable is called, BuildBlock fails fast with ErrDisabled, so blocks
+// are assembled by the fallback, if any. Skipped builds are counted in the
+// builder's Health, and audited like failed builds, see SetStore and
+// SetRecorder. Other calls, e.g. registration and status, are unaffected.
+// Disabling a disabled builder updates the reason.
+func (b *Builder) Disable(reason string) {
+	state := &DisabledState{Reason: reason, Since: b.now().UTC()}
+	if prev, ok := b.Disabled(); ok {
+		state.Since = prev.Since
+	}
+	b.disabled.Store(disabledBox{state})
+	b.getLogger().Infof("builder disabled: chain_id=%s reason=%q", b.chainID, reason)
+}
+
+// Enable resumes sending build requests after Disable. It's a no-op if the
+// builder isn't disabled.
+func (b *Builder) Enable() {
+	prev, ok := b.Disabled()
+	if !ok {
+		return
+	}
+	b.disabled.Store(disabledBox{})
+	b.getLogger().Infof("builder enabled: chain_id=%s disabled_for=%s", b.chainID, b.since(prev.Since))
+}
+
+// WithDisabled starts the builder disabled. See Disable.
+func WithDisabled(reason string) Option {
+	return func(b *Builder) error {
+		b.Disable(reason)
+		return nil
+	}
+}
+
+// Disabled returns the state of the builder, and true if it's disabled.
+func (b *Builder) Disabled() (DisabledState, bool) {
+	box, _ := b.disabled.Load().(disabledBox)
+	if box.DisabledState == nil {
+		return DisabledState{}, false
+	}
+	return *box.DisabledState, true
+}
+
+type disabledBox struct{ *DisabledState }
+
+// checkEnabled returns ErrDisabled, with the reason, if the builder is
+// disabled, or ErrPaused if the validator is paused, and counts and audits the
+// skipped build of req.
+func (b *Builder) checkEnabled(req *BuildBlockRequest) error {
+	var err error
+	if state, ok := b.Disabled(); ok {
+		err = ErrDisabled
+		if state.Reason != "" {
+			err = fmt.Errorf("%w: %s", ErrDisabled, state.Reason)
+		}
+	} else if until, ok := b.PausedUntil(); ok {
+		err = fmt.Errorf("%w until %s", ErrPaused, until.UTC())
+	}
+	if err == nil {
+		return nil
+	}
+
+	atomic.AddUint64(&b.skippedBuilds, 1)
+	b.audit(b.now(), "", req, nil, err)
+	b.getLogger().Debugf("build block skipped: chain_id=%s height=%d err=%v", req.ChainID, req.Height, err)
+	return err
+}
+
+// AdminHandler returns an http.Handler to disable and enable the builder at
+// runtime, see BuilderSet.AdminHandler. It only accepts the builder's chain
+// ID.
+func (b *Builder) AdminHandler() http.Handler {
+	return adminHandler(
+		func(chainID string) (*Builder, bool) { return b, chainID == "" || chainID == b.chainID },
+		func() []*Builder { return []*Builder{b} },
+	)
+}
+
+// AdminHandler returns an http.Handler to disable and enable the builders of
+// the set at runtime, per chain, for incident response. Like HealthHandler,
+// it's intended to be mounted on the node's admin port, which shouldn't be
+// reachable by anyone but the operator, since it has no authentication.
+//
+// GET responds with the Health of every builder, as a JSON array. POST takes
+// the form values action, "disable" or "enable", chain_id and, optionally,
+// reason, and responds with the Health of the chain's builder, e.g.
+//
+//	curl -d action=disable -d chain_id=cosmoshub-4 -d reason=incident-42 localhost:26660/mekabuild/admin
+func (s *BuilderSet) AdminHandler() http.Handler {
+	return adminHandler(s.Builder, func() []*Builder {
+		var builders []*Builder
+		for _, chainID := range s.ChainIDs() {
+			if b, ok := s.Builder(chainID); ok {
+				builders = append(builders, b)
+			}
+		}
+		return builders
+	})
+}
+
+// Disable disables the builder of a chain. It returns an error wrapping
+// ErrUnknownChain if there's none. See Builder.Disable.
+func (s *BuilderSet) Disable(chainID, reason string) error {
+	b, ok := s.Builder(chainID)
+	if !ok {
+		return fmt.Errorf("%w %s", ErrUnknownChain, chainID)
+	}
+	b.Disable(reason)
+	return nil
+}
+
+// Enable enables the builder of a chain. It returns an error wrapping
+// ErrUnknownChain if there's none. See Builder.Enable.
+func (s *BuilderSet) Enable(chainID string) error {
+	b, ok := s.Builder(chainID)
+	if !ok {
+		return fmt.Errorf("%w %s", ErrUnknownChain, chainID)
+	}
+	b.Enable()
+	return nil
+}
+
+func adminHandler(lookup func(chainID string) (*Builder, bool), all func() []*Builder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			health := []Health{}
+			for _, b := range all() {
+				health = append(health, b.Health())
+			}
+			w.Header().Set("content-type", "application/json")
+			json.NewEncoder(w).Encode(health)
+
+		case http.MethodPost:
+			chainID := r.FormValue("chain_id")
+			b, ok := lookup(chainID)
+			if !ok {
+				http.Error(w, fmt.Sprintf("%v %s", ErrUnknownChain, chainID), http.StatusNotFound)
+				return
+			}
+			switch action := r.FormValue("action"); action {
+			case "disable":
+				b.Disable(r.FormValue("reason"))
+			case "enable":
+				b.Enable()
+			default:
+				http.Error(w, fmt.Sprintf("unknown action %q", action), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("content-type", "application/json")
+			json.NewEncoder(w).Encode(b.Health())
+
+		default:
+			w.Header().Set("allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderDisable(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		causes    = make(chan error, 1)
+		audit     bytes.Buffer
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithRecorder(mekabuild.NewRecorder(&audit)),
+		mekabuild.WithDisabled("incident-42"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.SetFallback(mekabuild.FallbackFunc(func(req *mekabuild.BuildBlockRequest, cause error) (*mekabuild.BuildBlockResponse, error) {
+		causes <- cause
+		return &mekabuild.BuildBlockResponse{Txs: req.Txs}, nil
+	}))
+
+	resp, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cause := <-causes; !resp.Fallback || !errors.Is(cause, mekabuild.ErrDisabled) || !strings.Contains(cause.Error(), "incident-42") {
+		t.Errorf("disabled build: fallback %v, cause %v", resp.Fallback, cause)
+	}
+	if want, have := 0, len(api.Builds()); want != have {
+		t.Errorf("builds sent while disabled: want %d, have %d", want, have)
+	}
+
+	h := builder.Health()
+	if h.Disabled == nil || h.Disabled.Reason != "incident-42" || h.SkippedBuilds != 1 {
+		t.Errorf("health: have %+v", h)
+	}
+	var rec mekabuild.AuditRecord
+	if err := json.Unmarshal(audit.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Request == nil || rec.Request.Height != 1 || !strings.Contains(rec.Error, mekabuild.ErrDisabled.Error()) {
+		t.Errorf("audit record: have %+v", rec)
+	}
+
+	builder.Enable()
+	if _, ok := builder.Disabled(); ok {
+		t.Errorf("enabled builder is disabled")
+	}
+	if resp, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 2, ValidatorAddress: key.addr}); err != nil || resp.Fallback {
+		t.Errorf("enabled build: fallback %v, err %v", resp != nil && resp.Fallback, err)
+	}
+	if want, have := 1, len(api.Builds()); want != have {
+		t.Errorf("builds sent while enabled: want %d, have %d", want, have)
+	}
+}
+
+func TestBuilderSetAdminHandler(t *testing.T) {
+	t.Parallel()
+
+	var (
+		hub       = newMockKey(t, "hub", nil)
+		consumer  = newMockKey(t, "consumer", nil)
+		apiURL, _ = url.Parse("http://localhost:1")
+	)
+	set, err := mekabuild.NewBuilderSet(nil, mekabuild.WithEndpoints(apiURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []mekabuild.ChainConfig{
+		{ChainID: "hub-1", Signer: hub, ValidatorAddress: hub.addr},
+		{ChainID: "consumer-1", Signer: consumer, ValidatorAddress: consumer.addr},
+	} {
+		if _, err := set.Add(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := set.Disable("other-1", "no"); !errors.Is(err, mekabuild.ErrUnknownChain) {
+		t.Errorf("unknown chain: want %v, have %v", mekabuild.ErrUnknownChain, err)
+	}
+
+	var (
+		h    = set.AdminHandler()
+		post = func(form string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(form))
+			r.Header.Set("content-type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w
+		}
+	)
+
+	if w := post("action=disable&chain_id=hub-1&reason=incident"); w.Code != http.StatusOK {
+		t.Fatalf("disable: status %d: %s", w.Code, w.Body)
+	}
+	if state, ok := mustBuilder(t, set, "hub-1").Disabled(); !ok || state.Reason != "incident" {
+		t.Errorf("hub-1: want disabled, have %+v", state)
+	}
+	if _, ok := mustBuilder(t, set, "consumer-1").Disabled(); ok {
+		t.Errorf("consumer-1: want enabled, have disabled")
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	var health []mekabuild.Health
+	if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	if len(health) != 2 || health[0].ChainID != "consumer-1" || health[0].Disabled != nil || health[1].Disabled == nil {
+		t.Errorf("health: have %+v", health)
+	}
+
+	if w := post("action=enable&chain_id=hub-1"); w.Code != http.StatusOK {
+		t.Fatalf("enable: status %d: %s", w.Code, w.Body)
+	}
+	if _, ok := mustBuilder(t, set, "hub-1").Disabled(); ok {
+		t.Errorf("hub-1: want enabled, have disabled")
+	}
+
+	if w := post("action=disable&chain_id=other-1"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown chain: want status %d, have %d", http.StatusNotFound, w.Code)
+	}
+	if w := post("action=explode&chain_id=hub-1"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown action: want status %d, have %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func mustBuilder(t *testing.T, set *mekabuild.BuilderSet, chainID string) *mekabuild.Builder {
+	t.Helper()
+	b, ok := set.Builder(chainID)
+	if !ok {
+		t.Fatalf("no builder for %s", chainID)
+	}
+	return b
+}
@@ -0,0 +1,112 @@
+package mekabuild
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Some appchains bind the signatures of their validators to a namespace of
+// their own, so a signature made for one chain's builder integration can't be
+// reused in another context, even one with the same chain ID. A domain tag is
+// a chain-specific string that's prefixed to every payload the validator key
+// signs for the builder API, i.e. build requests, presignatures and build
+// confirmations.
+//
+// The tag is negotiated at registration: the apply and register requests
+// carry it, the builder API binds it to the registration challenge, and
+// verifies that every subsequent signed request from the validator carries
+// the registered tag. Domain tags require CapabilityDomainTags. See
+// SetDomainTag.
+
+// MaxDomainTagLength is the maximum length of a domain tag, in bytes.
+const MaxDomainTagLength = 64
+
+// ErrDomainTagUnsupported is returned when the builder has a domain tag, and
+// the builder API doesn't support CapabilityDomainTags.
+var ErrDomainTagUnsupported = errors.New("builder API doesn't support domain tags")
+
+// ValidateDomainTag checks that tag is a valid domain tag, i.e. at most
+// MaxDomainTagLength bytes of ASCII letters, digits, and any of "-._:/". The
+// empty tag is valid, and means no tag.
+func ValidateDomainTag(tag string) error {
+	if len(tag) > MaxDomainTagLength {
+		return fmt.Errorf("domain tag too long, %d bytes, max %d", len(tag), MaxDomainTagLength)
+	}
+	for _, c := range tag {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == ':', c == '/':
+		default:
+			return fmt.Errorf("invalid character %q in domain tag %q", c, tag)
+		}
+	}
+	return nil
+}
+
+// bindDomainTag prefixes sign bytes with the domain tag. Without a tag, the
+// sign bytes are unchanged, so signatures remain compatible with builder APIs
+// that don't support CapabilityDomainTags.
+func bindDomainTag(tag string, signBytes []byte) []byte {
+	if tag == "" {
+		return signBytes
+	}
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`domain-tag-`))
+	mustEncode(&sb, uint64(len([]byte(tag))))
+	mustEncode(&sb, []byte(tag))
+	mustEncode(&sb, signBytes)
+	return sb.Bytes()
+}
+
+// SetDomainTag sets the domain tag that's included in, and bound to the
+// signature of, every request signed by the builder, and sent when applying
+// for registration. The tag must match the one the validator registered with,
+// so changing it requires registering again. An empty tag, the default,
+// removes it.
+func (b *Builder) SetDomainTag(tag string) error {
+	if err := ValidateDomainTag(tag); err != nil {
+		return err
+	}
+	b.domainTag.Store(tag)
+	return nil
+}
+
+// WithDomainTag sets the domain tag of the builder. See SetDomainTag.
+func WithDomainTag(tag string) Option {
+	return func(b *Builder) error {
+		return b.SetDomainTag(tag)
+	}
+}
+
+func (b *Builder) getDomainTag() string {
+	tag, _ := b.domainTag.Load().(string)
+	return tag
+}
+
+// checkDomainTag returns ErrDomainTagUnsupported if tag is set, and the
+// negotiated capabilities exclude domain tags. Before negotiation, requests
+// are sent optimistically, and rejected by builder APIs that don't know the
+// tag's domain.
+func (b *Builder) checkDomainTag(tag string) error {
+	if tag == "" {
+		return nil
+	}
+	if caps, ok := b.Capabilities(); ok && !caps.Has(CapabilityDomainTags) {
+		return ErrDomainTagUnsupported
+	}
+	return nil
+}
+
+// setDomainTag sets the request's domain tag to the builder's, unless the
+// caller has set one already.
+func (b *Builder) setDomainTag(req *BuildBlockRequest) error {
+	if req.DomainTag == "" {
+		req.DomainTag = b.getDomainTag()
+	}
+	if err := ValidateDomainTag(req.DomainTag); err != nil {
+		return err
+	}
+	return b.checkDomainTag(req.DomainTag)
+}
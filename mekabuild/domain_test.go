@@ -0,0 +1,126 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestDomainTag(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		tag       = "appchain/v1"
+		key       = newMockKey(t, "validator", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		newReq    = func(height int64) *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithEndpoints(apiURL), mekabuild.WithDomainTag(tag), mekabuild.WithConfirmBuilds(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := builder.Apply(ctx, "payment-address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.Register(ctx, "payment-address", applied.Challenge, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := tag, api.DomainTag(chainID, key.addr); want != have {
+		t.Fatalf("registered domain tag: want %q, have %q", want, have)
+	}
+
+	if _, err := builder.BuildBlock(ctx, newReq(1)); err != nil {
+		t.Fatal(err)
+	}
+	if builds := api.Builds(); len(builds) != 1 || builds[0].DomainTag != tag {
+		t.Errorf("builds: want 1 with domain tag %q, have %+v", tag, builds)
+	}
+	if _, ok := api.Confirmed(chainID, key.addr, 1); !ok {
+		t.Errorf("build wasn't confirmed")
+	}
+
+	// Signatures without the registered tag, or with another, are rejected.
+	untagged := mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	if _, err := untagged.BuildBlock(ctx, newReq(2)); err == nil || !strings.Contains(err.Error(), "domain tag") {
+		t.Errorf("untagged: want domain tag error, have %v", err)
+	}
+	if err := untagged.SetDomainTag("other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := untagged.BuildBlock(ctx, newReq(2)); err == nil || !strings.Contains(err.Error(), "domain tag") {
+		t.Errorf("other tag: want domain tag error, have %v", err)
+	}
+}
+
+func TestDomainTagSignBytes(t *testing.T) {
+	t.Parallel()
+
+	key := newMockKey(t, "validator", nil)
+	req := &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}
+	untagged, err := req.SignBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.DomainTag = "appchain"
+	tagged, err := req.SignBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(tagged) == string(untagged) {
+		t.Fatalf("domain tag isn't bound to the sign bytes")
+	}
+	if !mekabuild.IsValidatorSignBytes(tagged) {
+		t.Errorf("tagged sign bytes aren't validator sign bytes")
+	}
+
+	if err := key.SignBuildBlockRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := mekabuild.VerifyBuildBlockRequest(req, key.PublicKey); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	req.DomainTag = "otherchain"
+	if err := mekabuild.VerifyBuildBlockRequest(req, key.PublicKey); !errors.Is(err, mekabuild.ErrBadSignature) {
+		t.Errorf("verify with another tag: want %v, have %v", mekabuild.ErrBadSignature, err)
+	}
+}
+
+func TestValidateDomainTag(t *testing.T) {
+	t.Parallel()
+
+	for tag, valid := range map[string]bool{
+		"":                      true,
+		"appchain":              true,
+		"osmosis-1/zenith:v2.0": true,
+		"my chain":              false,
+		"chain\x00":             false,
+		"ŧag":                   false,
+		strings.Repeat("a", 64): true,
+		strings.Repeat("a", 65): false,
+	} {
+		if err := mekabuild.ValidateDomainTag(tag); (err == nil) != valid {
+			t.Errorf("%q: want valid %v, have error %v", tag, valid, err)
+		}
+	}
+
+	key := newMockKey(t, "validator", nil)
+	if _, err := mekabuild.New(key, "chain-id", key.addr, mekabuild.WithDomainTag("my chain")); err == nil {
+		t.Errorf("invalid domain tag option: want error, have none")
+	}
+}
@@ -0,0 +1,119 @@
+package mekabuild
+
+import (
+	"context"
+	"time"
+)
+
+// StatusRequest is sent to the status endpoint of the builder API, to query
+// the registration of a validator.
+type StatusRequest struct {
+	ChainID          string `json:"chain_id"`
+	ValidatorAddress string `json:"validator_address"`
+}
+
+// StatusResponse is returned by the status endpoint of the builder API. It
+// describes the validator's registration as recorded by the API.
+type StatusResponse struct {
+	ChainID          string `json:"chain_id"`
+	ValidatorAddress string `json:"validator_address"`
+	Registered       bool   `json:"registered"`
+	PaymentAddress   string `json:"payment_address,omitempty"`
+}
+
+// RegistrationStatus queries the builder API for the validator's
+// registration, and updates the registration status reported by Health.
+func (b *Builder) RegistrationStatus(ctx context.Context) (*StatusResponse, error) {
+	return b.status(ctx)
+}
+
+// status queries the builder API for the validator's registration, and
+// updates the registration status reported by Health.
+func (b *Builder) status(ctx context.Context) (*StatusResponse, error) {
+	if b.addrErr != nil {
+		return nil, b.addrErr
+	}
+
+	req := &StatusRequest{
+		ChainID:          b.chainID,
+		ValidatorAddress: b.validatorAddr,
+	}
+
+	var resp StatusResponse
+	if _, err := b.do(ctx, "/v0/status", req, &resp, nil); err != nil {
+		return nil, err
+	}
+
+	if resp.Registered {
+		b.registration.Store(RegistrationRegistered)
+	} else {
+		b.registration.Store(RegistrationUnregistered)
+	}
+
+	return &resp, nil
+}
+
+// RegistrationDrift is a difference between the local configuration of a
+// validator, and its registration as recorded by the builder API.
+type RegistrationDrift struct {
+	Field  string `json:"field"`
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+}
+
+// Registration fields that may drift.
+const (
+	DriftFieldRegistered     = "registered"
+	DriftFieldChainID        = "chain_id"
+	DriftFieldPaymentAddress = "payment_address"
+)
+
+// CheckRegistration compares the builder's chain ID, and the given payment
+// address, with the validator's registration as recorded by the builder API.
+// It returns the differences, if any. Drift typically means the validator has
+// been re-registered elsewhere, and payments are being routed to an address
+// the operator doesn't expect.
+func (b *Builder) CheckRegistration(ctx context.Context, paymentAddress string) ([]RegistrationDrift, error) {
+	status, err := b.status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !status.Registered {
+		return []RegistrationDrift{{Field: DriftFieldRegistered, Local: "true", Remote: "false"}}, nil
+	}
+
+	var drift []RegistrationDrift
+	if status.ChainID != b.chainID {
+		drift = append(drift, RegistrationDrift{Field: DriftFieldChainID, Local: b.chainID, Remote: status.ChainID})
+	}
+	if status.PaymentAddress != paymentAddress {
+		drift = append(drift, RegistrationDrift{Field: DriftFieldPaymentAddress, Local: paymentAddress, Remote: status.PaymentAddress})
+	}
+	return drift, nil
+}
+
+// WatchRegistration calls CheckRegistration every interval until ctx is done,
+// and calls onDrift whenever drift is detected. Failed checks are logged, and
+// retried at the next interval. WatchRegistration blocks, so it's typically
+// run in its own goroutine.
+func (b *Builder) WatchRegistration(ctx context.Context, paymentAddress string, interval time.Duration, onDrift func([]RegistrationDrift)) {
+	for {
+		drift, err := b.CheckRegistration(ctx, paymentAddress)
+		switch {
+		case err != nil:
+			b.getLogger().Errorf("check registration failed: chain_id=%s err=%v", b.chainID, err)
+		case len(drift) > 0:
+			for _, d := range drift {
+				b.getLogger().Errorf("registration drift: chain_id=%s field=%s local=%q remote=%q", b.chainID, d.Field, d.Local, d.Remote)
+			}
+			onDrift(drift)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.getClock().After(interval):
+		}
+	}
+}
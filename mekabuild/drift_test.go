@@ -0,0 +1,76 @@
+package mekabuild_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderCheckRegistration(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		key       = newMockKey(t, "validator", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	drift, err := builder.CheckRegistration(ctx, "payment-address")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := []mekabuild.RegistrationDrift{{Field: mekabuild.DriftFieldRegistered, Local: "true", Remote: "false"}}, drift; !reflect.DeepEqual(want, have) {
+		t.Errorf("unregistered: want %+v, have %+v", want, have)
+	}
+
+	if want, have := mekabuild.RegistrationUnregistered, builder.Health().Registration; want != have {
+		t.Errorf("registration status: want %q, have %q", want, have)
+	}
+
+	apply, err := builder.Apply(ctx, "payment-address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.Register(ctx, "payment-address", apply.Challenge, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if drift, err := builder.CheckRegistration(ctx, "payment-address"); err != nil || len(drift) > 0 {
+		t.Errorf("registered: want no drift, have %+v (%v)", drift, err)
+	}
+
+	// Someone re-registers the validator with another payment address.
+	api.SetRegistered(chainID, key.addr, "other-address")
+
+	var (
+		watchCtx, cancel = context.WithCancel(ctx)
+		events           = make(chan []mekabuild.RegistrationDrift, 1)
+	)
+	defer cancel()
+
+	go builder.WatchRegistration(watchCtx, "payment-address", time.Hour, func(drift []mekabuild.RegistrationDrift) {
+		events <- drift
+	})
+
+	want := []mekabuild.RegistrationDrift{{Field: mekabuild.DriftFieldPaymentAddress, Local: "payment-address", Remote: "other-address"}}
+	select {
+	case have := <-events:
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("re-registered: want %+v, have %+v", want, have)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for drift event")
+	}
+}
@@ -0,0 +1,110 @@
+package mekabuild
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// BlockBuilder builds blocks. It's implemented by Builder, MultiBuilder, and
+// DryRunBuilder, so integrations can switch between them, e.g. based on
+// DryRunMode.
+type BlockBuilder interface {
+	BuildBlock(ctx context.Context, req *BuildBlockRequest) (*BuildBlockResponse, error)
+}
+
+var (
+	_ BlockBuilder = (*Builder)(nil)
+	_ BlockBuilder = (*MultiBuilder)(nil)
+	_ BlockBuilder = (*DryRunBuilder)(nil)
+)
+
+// DryRunRequest is a build request recorded by a DryRunBuilder, exactly as it
+// would have been sent to the builder API.
+type DryRunRequest struct {
+	Time    time.Time
+	Request BuildBlockRequest
+	Bytes   int // size of the encoded request body, before compression
+}
+
+// DryRunBuilder is a BlockBuilder that never sends anything to the builder
+// API. Each build request is prepared like the wrapped Builder would prepare
+// it, including policy evaluation, tx injection, and signing, then logged and
+// recorded instead of sent. The response is the request's txs, unchanged, so
+// validators can soak-test an integration on mainnet without affecting their
+// blocks.
+type DryRunBuilder struct {
+	builder *Builder
+	limit   int
+
+	mtx      sync.Mutex
+	requests []DryRunRequest
+}
+
+// DefaultDryRunRequests is the number of requests retained in memory by a
+// dry-run builder, unless configured otherwise.
+const DefaultDryRunRequests = 1000
+
+// NewDryRunBuilder returns a dry-run builder that prepares requests via b.
+// The most recent limit requests are retained in memory; a limit of zero
+// means DefaultDryRunRequests.
+func NewDryRunBuilder(b *Builder, limit int) *DryRunBuilder {
+	if limit <= 0 {
+		limit = DefaultDryRunRequests
+	}
+	return &DryRunBuilder{builder: b, limit: limit}
+}
+
+// BuildBlock implements BlockBuilder. The request isn't modified. It returns
+// an error only if the request couldn't be prepared, e.g. signed, in which
+// case sending it would have failed as well.
+func (d *DryRunBuilder) BuildBlock(ctx context.Context, req *BuildBlockRequest) (*BuildBlockResponse, error) {
+	var (
+		b     = d.builder
+		begin = b.now()
+		dreq  = *req
+	)
+
+	_, prepared, _, err := b.prepareBuild(ctx, &dreq)
+	if err != nil {
+		b.getLogger().Errorf("dry run build failed: chain_id=%s height=%d err=%v", req.ChainID, req.Height, err)
+		return nil, err
+	}
+
+	var (
+		codec = b.requestCodec(endpointName(b.orderedEndpoints()[0]), prepared)
+		body  bytes.Buffer
+	)
+	if err := codec.Encode(&body, prepared); err != nil {
+		return nil, err
+	}
+
+	d.record(DryRunRequest{Time: begin.UTC(), Request: *prepared, Bytes: body.Len()})
+	b.getLogger().Infof("dry run build: chain_id=%s height=%d txs=%d mandatory_txs=%d content_type=%s bytes=%d took=%s", prepared.ChainID, prepared.Height, len(prepared.Txs), len(prepared.MandatoryTxs), codec.ContentType(), body.Len(), b.since(begin))
+
+	return &BuildBlockResponse{Txs: append([][]byte(nil), req.Txs...)}, nil
+}
+
+// Requests returns the retained requests, oldest first.
+func (d *DryRunBuilder) Requests() []DryRunRequest {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return append([]DryRunRequest(nil), d.requests...)
+}
+
+// Reset discards the retained requests.
+func (d *DryRunBuilder) Reset() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.requests = nil
+}
+
+func (d *DryRunBuilder) record(r DryRunRequest) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.requests = append(d.requests, r)
+	if n := len(d.requests); n > d.limit {
+		d.requests = append(d.requests[:0], d.requests[n-d.limit:]...)
+	}
+}
@@ -0,0 +1,81 @@
+package mekabuild_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestDryRunBuilder(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx     = context.Background()
+		chainID = "chain-id"
+		key     = newMockKey(t, "validator", nil)
+		hits    int32
+		server  = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		dryRun    = mekabuild.NewDryRunBuilder(builder, 2)
+		newReq    = func(height int64) *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1, Txs: [][]byte{[]byte("tx1"), []byte("long tx")}}
+		}
+	)
+
+	// The policy drops the long tx from the request, but not the response.
+	if err := builder.SetPolicy(&mekabuild.Policy{MaxTxBytes: 3}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var bb mekabuild.BlockBuilder = dryRun
+	for height := int64(1); height <= 3; height++ {
+		req := newReq(height)
+		resp, err := bb.BuildBlock(ctx, req)
+		if err != nil {
+			t.Fatalf("height %d: %v", height, err)
+		}
+		if want, have := newReq(height), req; !reflect.DeepEqual(want, have) {
+			t.Errorf("height %d: request modified: want %+v, have %+v", height, want, have)
+		}
+		if want, have := newReq(height).Txs, resp.Txs; !reflect.DeepEqual(want, have) {
+			t.Errorf("height %d: txs: want %q, have %q", height, want, have)
+		}
+	}
+
+	if want, have := int32(0), atomic.LoadInt32(&hits); want != have {
+		t.Errorf("requests to the builder API: want %d, have %d", want, have)
+	}
+
+	requests := dryRun.Requests()
+	if want, have := 2, len(requests); want != have {
+		t.Fatalf("retained requests: want %d, have %d", want, have)
+	}
+
+	for i, r := range requests {
+		if want, have := int64(i+2), r.Request.Height; want != have {
+			t.Errorf("request %d: height: want %d, have %d", i, want, have)
+		}
+		if want, have := [][]byte{[]byte("tx1")}, r.Request.Txs; !reflect.DeepEqual(want, have) {
+			t.Errorf("request %d: txs: want %q, have %q", i, want, have)
+		}
+		if err := mekabuild.VerifyBuildBlockRequest(&r.Request, key.PublicKey); err != nil {
+			t.Errorf("request %d: verify: %v", i, err)
+		}
+		if r.Bytes <= 0 {
+			t.Errorf("request %d: bytes: want positive, have %d", i, r.Bytes)
+		}
+	}
+
+	dryRun.Reset()
+	if want, have := 0, len(dryRun.Requests()); want != have {
+		t.Errorf("after reset: want %d requests, have %d", want, have)
+	}
+}
@@ -0,0 +1,173 @@
+package mekabuild
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDuplicateTxs is returned when a build response includes the same tx more
+// than once, and duplicates are rejected, see SetDuplicateTxsPolicy.
+var ErrDuplicateTxs = errors.New("duplicate txs in response")
+
+// DuplicateTxsPolicy decides what happens to build responses which include the
+// same tx more than once, which the app would reject, or execute twice.
+type DuplicateTxsPolicy string
+
+// Duplicate txs policies. The zero value only observes duplicates.
+const (
+	// DuplicateTxsObserve logs and reports duplicates, and keeps the
+	// response as is. It's the default.
+	DuplicateTxsObserve DuplicateTxsPolicy = ""
+
+	// DuplicateTxsStrip removes every occurrence of a tx but the first.
+	// Responses are rejected instead if stripping would drop a mandatory
+	// tx, or an attested tx.
+	DuplicateTxsStrip DuplicateTxsPolicy = "strip"
+
+	// DuplicateTxsReject rejects responses with duplicates, with
+	// ErrDuplicateTxs.
+	DuplicateTxsReject DuplicateTxsPolicy = "reject"
+)
+
+// DuplicateTxs returns the indices of the txs which repeat an earlier tx, by
+// hash, in order.
+func DuplicateTxs(txs [][]byte) []int {
+	var (
+		seen = make(map[string]bool, len(txs))
+		dups []int
+	)
+	for i, tx := range txs {
+		h := string(HashTxs(tx))
+		if seen[h] {
+			dups = append(dups, i)
+			continue
+		}
+		seen[h] = true
+	}
+	return dups
+}
+
+// DuplicateTxsMetrics is optionally implemented by Metrics, to observe build
+// responses with duplicate txs.
+type DuplicateTxsMetrics interface {
+	ObserveDuplicateTxs(DuplicateTxsEvent)
+}
+
+// DuplicateTxsEvent describes the duplicate txs of a build response.
+type DuplicateTxsEvent struct {
+	ChainID string
+	Height  int64
+
+	// Duplicates is the number of txs of the response which repeat an
+	// earlier tx of the response.
+	Duplicates int
+
+	// InMempool is the number of txs of a top-of-block response which are
+	// also in the request's txs, i.e. the validator's mempool. They're
+	// only included once in the merged block, see MergeTopOfBlock. It's
+	// always zero for full builds, whose responses include the request's
+	// txs by design.
+	InMempool int
+
+	Policy DuplicateTxsPolicy
+}
+
+// SetDuplicateTxsPolicy sets what happens to build responses with duplicate
+// txs. Duplicates are observed regardless, see DuplicateTxsMetrics.
+func (b *Builder) SetDuplicateTxsPolicy(p DuplicateTxsPolicy) error {
+	switch p {
+	case DuplicateTxsObserve, DuplicateTxsStrip, DuplicateTxsReject:
+	default:
+		return fmt.Errorf("unknown duplicate txs policy %q", string(p))
+	}
+	b.duplicateTxs.Store(p)
+	return nil
+}
+
+// WithDuplicateTxsPolicy sets what happens to build responses with duplicate
+// txs. See SetDuplicateTxsPolicy.
+func WithDuplicateTxsPolicy(p DuplicateTxsPolicy) Option {
+	return func(b *Builder) error {
+		return b.SetDuplicateTxsPolicy(p)
+	}
+}
+
+func (b *Builder) getDuplicateTxsPolicy() DuplicateTxsPolicy {
+	p, _ := b.duplicateTxs.Load().(DuplicateTxsPolicy)
+	return p
+}
+
+// checkDuplicateTxs detects duplicate txs in resp, following its attestation
+// tx, if any, and in a top-of-block response, txs already in the request, and
+// applies the builder's duplicate txs policy. It must follow response
+// verification, whose signatures cover the txs as returned.
+func (b *Builder) checkDuplicateTxs(req *BuildBlockRequest, resp *BuildBlockResponse) error {
+	a, txs, err := SplitAttestation(resp.Txs)
+	if err != nil {
+		return err
+	}
+
+	var (
+		policy = b.getDuplicateTxsPolicy()
+		dups   = DuplicateTxs(txs)
+		ev     = DuplicateTxsEvent{ChainID: req.ChainID, Height: req.Height, Duplicates: len(dups), Policy: policy}
+	)
+	if req.Mode == BuildModeTopOfBlock {
+		mempool := make(map[string]bool, len(req.Txs))
+		for _, tx := range req.Txs {
+			mempool[string(HashTxs(tx))] = true
+		}
+		for _, tx := range txs {
+			if mempool[string(HashTxs(tx))] {
+				ev.InMempool++
+			}
+		}
+	}
+	if ev.Duplicates == 0 && ev.InMempool == 0 {
+		return nil
+	}
+
+	if dm, ok := b.getMetrics().(DuplicateTxsMetrics); ok {
+		dm.ObserveDuplicateTxs(ev)
+	}
+	if ev.Duplicates == 0 {
+		b.getLogger().Debugf("build response includes mempool txs: chain_id=%s height=%d in_mempool=%d", req.ChainID, req.Height, ev.InMempool)
+		return nil
+	}
+	b.getLogger().Errorf("build response includes duplicate txs: chain_id=%s height=%d txs=%d duplicates=%d policy=%q", req.ChainID, req.Height, len(txs), ev.Duplicates, string(policy))
+
+	if policy == DuplicateTxsReject {
+		return fmt.Errorf("%w: %d of %d txs, first at index %d", ErrDuplicateTxs, len(dups), len(txs), dups[0])
+	}
+	if policy != DuplicateTxsStrip {
+		return nil
+	}
+
+	if a != nil {
+		attested, err := a.AttestedTxs(txs)
+		if err != nil {
+			return err
+		}
+		if dups[0] < len(attested) {
+			return fmt.Errorf("%w: stripping would drop attested txs", ErrDuplicateTxs)
+		}
+	}
+
+	kept := make([][]byte, 0, len(txs)-len(dups))
+	for i, tx := range txs {
+		if len(dups) > 0 && dups[0] == i {
+			dups = dups[1:]
+			continue
+		}
+		kept = append(kept, tx)
+	}
+	if err := VerifyMandatoryTxs(req.MandatoryTxs, kept); err != nil {
+		return fmt.Errorf("%w: stripping would drop mandatory txs", ErrDuplicateTxs)
+	}
+
+	if a != nil {
+		kept = append([][]byte{resp.Txs[0]}, kept...)
+	}
+	resp.Txs = kept
+	return nil
+}
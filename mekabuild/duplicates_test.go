@@ -0,0 +1,86 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestDuplicateTxs(t *testing.T) {
+	t.Parallel()
+
+	txs := [][]byte{[]byte("a"), []byte("b"), []byte("a"), []byte("c"), []byte("b"), []byte("a")}
+	if want, have := []int{2, 4, 5}, mekabuild.DuplicateTxs(txs); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if have := mekabuild.DuplicateTxs(txs[:2]); len(have) != 0 {
+		t.Errorf("no duplicates: have %v", have)
+	}
+}
+
+func TestBuilderDuplicateTxs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		metrics   = &mockMetrics{}
+		b         *mekabuild.Builder
+		height    int64
+		build     = func(txs ...[]byte) (*mekabuild.BuildBlockResponse, error) {
+			height++
+			return b.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, Txs: txs})
+		}
+		tx1, tx2 = []byte("tx-1"), []byte("tx-2")
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	b, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithEndpoints(apiURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetMetrics(metrics)
+
+	// The mock API returns the request's txs, duplicates included.
+	if resp, err := build(tx1, tx2, tx1); err != nil || len(resp.Txs) != 3 {
+		t.Errorf("observe: want 3 txs, have %v, %v", resp, err)
+	}
+
+	if err := b.SetDuplicateTxsPolicy(mekabuild.DuplicateTxsStrip); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := build(tx1, tx2, tx1); err != nil || !reflect.DeepEqual([][]byte{tx1, tx2}, resp.Txs) {
+		t.Errorf("strip: want %q, have %v, %v", [][]byte{tx1, tx2}, resp, err)
+	}
+
+	if err := b.SetDuplicateTxsPolicy(mekabuild.DuplicateTxsReject); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := build(tx1, tx2, tx1); !errors.Is(err, mekabuild.ErrDuplicateTxs) {
+		t.Errorf("reject: want %v, have %v", mekabuild.ErrDuplicateTxs, err)
+	}
+	if _, err := build(tx1, tx2); err != nil {
+		t.Errorf("reject without duplicates: %v", err)
+	}
+
+	metrics.mtx.Lock()
+	defer metrics.mtx.Unlock()
+	if want, have := 3, len(metrics.duplicates); want != have {
+		t.Fatalf("events: want %d, have %d", want, have)
+	}
+	if ev := metrics.duplicates[1]; ev.Duplicates != 1 || ev.InMempool != 0 || ev.Policy != mekabuild.DuplicateTxsStrip || ev.Height != 2 {
+		t.Errorf("event: have %+v", ev)
+	}
+
+	if err := b.SetDuplicateTxsPolicy("explode"); err == nil {
+		t.Errorf("unknown policy: want error, have none")
+	}
+}
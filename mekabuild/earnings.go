@@ -0,0 +1,97 @@
+package mekabuild
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// EarningsRequest is sent to the earnings endpoint of the builder API, to
+// query a page of the historical payments to a validator.
+type EarningsRequest struct {
+	ChainID          string `json:"chain_id"`
+	ValidatorAddress string `json:"validator_address"`
+
+	// FromMillis and ToMillis bound the block times of the payments, in
+	// Unix milliseconds, from inclusive to exclusive. A zero ToMillis means
+	// no upper bound.
+	FromMillis int64 `json:"from_ms"`
+	ToMillis   int64 `json:"to_ms,omitempty"`
+
+	// PageToken is the NextPageToken of the previous page, or empty for
+	// the first page.
+	PageToken string `json:"page_token,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+}
+
+// EarningsResponse is returned by the earnings endpoint of the builder API.
+type EarningsResponse struct {
+	Records []EarningsRecord `json:"records"`
+
+	// NextPageToken is empty on the last page.
+	NextPageToken string `json:"next_page_token,omitempty"`
+}
+
+// EarningsRecord is the payment to a validator for a block.
+type EarningsRecord struct {
+	Height int64 `json:"height"`
+	Amount Coins `json:"amount"`
+
+	// TxHash is the hash of the payment tx, in uppercase hex.
+	TxHash string `json:"tx_hash"`
+
+	// TimeMillis is the time of the block, in Unix milliseconds.
+	TimeMillis int64 `json:"time_ms"`
+}
+
+// Time returns the time of the block.
+func (r *EarningsRecord) Time() time.Time {
+	return time.Unix(0, r.TimeMillis*int64(time.Millisecond))
+}
+
+// earningsPageSize is the number of records requested per page.
+const earningsPageSize = 500
+
+var earningsEndpoint = Endpoint{Path: "/v0/earnings"}
+
+// Earnings queries the builder API for the payments to the builder's
+// validator in blocks from time from, inclusive, to time to, exclusive, in
+// order. A zero to means up to now. Every page is fetched, so long periods
+// take several requests. The payments are public on-chain, so requests are
+// unsigned.
+func (b *Builder) Earnings(ctx context.Context, from, to time.Time) ([]EarningsRecord, error) {
+	if !to.IsZero() && !to.After(from) {
+		return nil, fmt.Errorf("end time %s must be after start time %s", to, from)
+	}
+
+	req := &EarningsRequest{
+		ChainID:          b.chainID,
+		ValidatorAddress: b.validatorAddr,
+		FromMillis:       from.UnixNano() / int64(time.Millisecond),
+		Limit:            earningsPageSize,
+	}
+	if !to.IsZero() {
+		req.ToMillis = to.UnixNano() / int64(time.Millisecond)
+	}
+
+	var (
+		records []EarningsRecord
+		seen    = map[string]bool{}
+	)
+	for {
+		var resp EarningsResponse
+		if err := b.Call(ctx, earningsEndpoint, req, &resp); err != nil {
+			return nil, err
+		}
+		records = append(records, resp.Records...)
+
+		if resp.NextPageToken == "" {
+			return records, nil
+		}
+		if seen[resp.NextPageToken] {
+			return nil, fmt.Errorf("builder API repeated page token %q", resp.NextPageToken)
+		}
+		seen[resp.NextPageToken] = true
+		req.PageToken = resp.NextPageToken
+	}
+}
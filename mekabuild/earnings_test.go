@@ -0,0 +1,90 @@
+package mekabuild_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderEarnings(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		start     = time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	// One block per minute, for a day.
+	for i := int64(0); i < 24*60; i++ {
+		api.AddEarnings(chainID, key.addr, mekabuild.EarningsRecord{
+			Height:     i + 1,
+			Amount:     mekabuild.Coins{{Denom: "uatom", Amount: bigInt(i + 1)}},
+			TxHash:     "ABCD",
+			TimeMillis: start.Add(time.Duration(i)*time.Minute).UnixNano() / int64(time.Millisecond),
+		})
+	}
+
+	b, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithEndpoints(apiURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := b.Earnings(ctx, start, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 24*60, len(records); want != have {
+		t.Fatalf("all pages: want %d records, have %d", want, have)
+	}
+	for i, r := range records {
+		if want, have := int64(i+1), r.Height; want != have {
+			t.Fatalf("record %d: want height %d, have %d", i, want, have)
+		}
+	}
+	if want, have := start, records[0].Time(); !want.Equal(have) {
+		t.Errorf("time: want %s, have %s", want, have)
+	}
+
+	records, err = b.Earnings(ctx, start.Add(time.Hour), start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 60, len(records); want != have || records[0].Height != 61 {
+		t.Errorf("one hour: want %d records from height 61, have %d", want, have)
+	}
+
+	if _, err := b.Earnings(ctx, start, start); err == nil {
+		t.Errorf("empty period: want error, have none")
+	}
+}
+
+func TestBuilderEarningsRepeatedPageToken(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx    = context.Background()
+		key    = newMockKey(t, "validator", nil)
+		server = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(mekabuild.EarningsResponse{
+				Records:       []mekabuild.EarningsRecord{{Height: 1}},
+				NextPageToken: "same",
+			})
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-id", key.addr)
+	)
+
+	if _, err := builder.Earnings(ctx, time.Unix(0, 0), time.Time{}); err == nil {
+		t.Errorf("repeated page token: want error, have none")
+	}
+}
@@ -0,0 +1,87 @@
+package mekabuild
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Endpoint declares a route of the builder API. Calls to every endpoint share
+// the builder's transport, i.e. its retry policy, failover, rate limiting,
+// request queue, compression, codecs, and metrics, so adding a route takes a
+// declaration and a thin typed method around Call, rather than another
+// bespoke variant of the request logic.
+//
+// This module supports Go versions without generics, so requests and
+// responses are passed to Call as interface{} values, and typed methods
+// provide the type safety.
+type Endpoint struct {
+	// Path is the v0 route, e.g. "/v0/auction_status", which is mapped to
+	// the negotiated API version.
+	Path string
+
+	// Method is the HTTP method of the route, http.MethodPost,
+	// http.MethodPut or http.MethodPatch. Empty means http.MethodPost,
+	// which every route of the v0 API uses. Requests are always sent as an
+	// encoded body, so methods without a body, e.g. GET and DELETE, which
+	// proxies may strip the body of, aren't supported.
+	Method string
+
+	// Sign signs the request with the builder's signer before it's sent,
+	// e.g. by asserting an optional signer interface. It's called with the
+	// builder's signer lock held. Nil means requests are unsigned. Calls to
+	// endpoints that sign fail with ErrReadOnly on read-only builders.
+	Sign func(s Signer, req interface{}) error
+
+	// Priority is the default priority of requests in the request queue,
+	// which can be overridden with WithPriority. Zero means
+	// PriorityBackground.
+	Priority Priority
+}
+
+// Call sends req to the endpoint, and decodes the response into resp, which
+// must be a pointer.
+func (b *Builder) Call(ctx context.Context, e Endpoint, req, resp interface{}) error {
+	if e.Path == "" {
+		return errors.New("endpoint path must not be empty")
+	}
+
+	method := e.Method
+	switch method {
+	case "":
+		method = http.MethodPost
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("unsupported endpoint method %q", e.Method)
+	}
+
+	if e.Sign != nil {
+		if err := b.checkWritable(e.Path); err != nil {
+			return err
+		}
+		b.signMtx.Lock()
+		err := e.Sign(b.signer, req)
+		b.signMtx.Unlock()
+		if err != nil {
+			return fmt.Errorf("sign request: %w", err)
+		}
+	}
+
+	ctx = WithPriority(ctx, priorityFrom(ctx, e.Priority))
+	ctx = context.WithValue(ctx, methodKey{}, method)
+
+	_, err := b.do(ctx, e.Path, req, resp, nil)
+	return err
+}
+
+type methodKey struct{}
+
+// methodFrom returns the HTTP method of the request, as set by Call, or
+// http.MethodPost.
+func methodFrom(ctx context.Context) string {
+	if m, ok := ctx.Value(methodKey{}).(string); ok {
+		return m
+	}
+	return http.MethodPost
+}
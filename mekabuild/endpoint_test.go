@@ -0,0 +1,94 @@
+package mekabuild_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+type echoRequest struct {
+	Message   string `json:"message"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+type echoResponse struct {
+	Message string `json:"message"`
+	Signed  bool   `json:"signed"`
+}
+
+func TestBuilderCall(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx    = context.Background()
+		key    = newMockKey(t, "validator", nil)
+		paths  = make(chan string, 2)
+		server = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths <- r.Method + " " + r.URL.Path
+			var req echoRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(echoResponse{Message: req.Message, Signed: len(req.Signature) > 0})
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-id", key.addr)
+		echo      = mekabuild.Endpoint{
+			Path: "/v0/echo",
+			Sign: func(s mekabuild.Signer, req interface{}) error {
+				cs, ok := s.(mekabuild.ChallengeSigner)
+				if !ok {
+					return errors.New("can't sign")
+				}
+				r := req.(*echoRequest)
+				sig, err := cs.SignChallenge([]byte(r.Message))
+				r.Signature = sig
+				return err
+			},
+		}
+	)
+
+	var resp echoResponse
+	if err := builder.Call(ctx, echo, &echoRequest{Message: "hello"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := (echoResponse{Message: "hello", Signed: true}), resp; want != have {
+		t.Errorf("response: want %+v, have %+v", want, have)
+	}
+	if want, have := "POST /v0/echo", <-paths; want != have {
+		t.Errorf("route: want %q, have %q", want, have)
+	}
+
+	if err := builder.Call(ctx, mekabuild.Endpoint{Path: "/v0/echo"}, &echoRequest{Message: "unsigned"}, &resp); err != nil || resp.Signed {
+		t.Errorf("unsigned endpoint: have %+v (%v)", resp, err)
+	}
+	<-paths
+
+	if err := builder.Call(ctx, mekabuild.Endpoint{Path: "/v0/echo", Method: http.MethodPut}, &echoRequest{Message: "put"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "PUT /v0/echo", <-paths; want != have {
+		t.Errorf("route: want %q, have %q", want, have)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete, "BREW"} {
+		if err := builder.Call(ctx, mekabuild.Endpoint{Path: "/v0/echo", Method: method}, &echoRequest{}, &resp); err == nil {
+			t.Errorf("%s: want error, have none", method)
+		}
+	}
+
+	builder.SetReadOnly(true)
+	if err := builder.Call(ctx, echo, &echoRequest{Message: "hello"}, &resp); !errors.Is(err, mekabuild.ErrReadOnly) {
+		t.Errorf("read-only: want %v, have %v", mekabuild.ErrReadOnly, err)
+	}
+
+	if err := builder.Call(ctx, mekabuild.Endpoint{}, &echoRequest{}, &resp); err == nil {
+		t.Errorf("empty path: want error, have none")
+	}
+}
@@ -0,0 +1,182 @@
+package mekabuild
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GetBuilderAPIURL, DryRunMode and friends are lenient: a malformed variable
+// is ignored, and the default is used, so a typo only shows up when the
+// validator proposes, if at all. ValidateEnv and the Lookup functions report
+// malformed variables instead, so integrations can fail at startup.
+
+// EnvError is a malformed environment variable.
+type EnvError struct {
+	Name  string
+	Value string // redacted
+	Err   error
+}
+
+// Error implements error.
+func (e *EnvError) Error() string {
+	return fmt.Sprintf("env:%s=%q: %v", e.Name, e.Value, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *EnvError) Unwrap() error { return e.Err }
+
+// EnvErrors are the malformed environment variables found by ValidateEnv.
+type EnvErrors []*EnvError
+
+// Error implements error.
+func (e EnvErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "invalid environment: " + strings.Join(msgs, "; ")
+}
+
+// envVars are the environment variables read by this package, and the
+// functions that check their values.
+var envVars = []struct {
+	name  string
+	check func(name, value string) error
+}{
+	{"ZENITH_API_URL", checkBuilderAPIURL},
+	{"MEKATEK_BUILDER_API_URL", checkBuilderAPIURL},
+	{"MEKATEK_BUILDER_API_SANDBOX", checkBool},
+	{"ZENITH_DRY_RUN", checkBool},
+	{"MEKATEK_BUILDER_API_DRY_RUN", checkBool},
+	{"ZENITH_STATE_KEY", checkStateKey},
+	{"MEKATEK_BUILDER_API_STATE_KEY", checkStateKey},
+	{"MEKATEK_BUILDER_API_TIMEOUT", checkConfigEnv},
+	{"MEKATEK_BUILDER_API_PAYMENT_ADDRESS", checkConfigEnv},
+	{"MEKATEK_BUILDER_API_COMPRESSION", checkConfigEnv},
+	{"MEKATEK_BUILDER_API_FORMAT", checkConfigEnv},
+	{"MEKATEK_BUILDER_API_RETRIES", checkConfigEnv},
+	{"MEKATEK_BUILDER_API_FALLBACK", checkConfigEnv},
+	{"MEKATEK_BUILDER_API_TELEMETRY", checkConfigEnv},
+}
+
+// ValidateEnv checks every environment variable read by this package that's
+// set, including ones that are overridden by others, and returns EnvErrors
+// describing the malformed ones, or nil. Integrations should call it at
+// startup.
+func ValidateEnv() error {
+	return validateEnv(func(string) bool { return true })
+}
+
+func validateEnv(include func(name string) bool) error {
+	var errs EnvErrors
+	for _, v := range envVars {
+		s := os.Getenv(v.name)
+		if s == "" || !include(v.name) {
+			continue
+		}
+		if err := v.check(v.name, s); err != nil {
+			value := redact(s)
+			if strings.HasSuffix(v.name, "_STATE_KEY") {
+				value = "REDACTED"
+			}
+			errs = append(errs, &EnvError{Name: v.name, Value: value, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// LookupBuilderAPIURL is like GetBuilderAPIURL, but returns EnvErrors if a URL
+// or sandbox variable is malformed, rather than ignoring it.
+func LookupBuilderAPIURL() (*url.URL, error) {
+	err := validateEnv(func(name string) bool {
+		return strings.HasSuffix(name, "_API_URL") || name == "MEKATEK_BUILDER_API_SANDBOX"
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetBuilderAPIURL(), nil
+}
+
+// MustGetBuilderAPIURL is like LookupBuilderAPIURL, but panics on error.
+func MustGetBuilderAPIURL() *url.URL {
+	u, err := LookupBuilderAPIURL()
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// LookupDryRunMode is like DryRunMode, but returns EnvErrors if a dry run
+// variable is malformed, rather than ignoring it.
+func LookupDryRunMode() (bool, error) {
+	err := validateEnv(func(name string) bool {
+		return strings.HasSuffix(name, "_DRY_RUN")
+	})
+	if err != nil {
+		return false, err
+	}
+	return DryRunMode(), nil
+}
+
+// checkBuilderAPIURL checks a URL variable, as interpreted by ResolveEndpoint.
+func checkBuilderAPIURL(_, s string) error {
+	if strings.TrimSpace(s) != s {
+		return errors.New("URL has surrounding whitespace")
+	}
+	if i := strings.Index(s, "://"); i >= 0 && !strings.HasPrefix(s, "http://") && !strings.HasPrefix(s, "https://") {
+		return fmt.Errorf("unsupported scheme %q, want http or https", s[:i])
+	}
+	if !strings.HasPrefix(s, "http") {
+		s = defaultBuilderAPIURL.Scheme + "://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err // without the unredacted URL
+		}
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Hostname() == "" {
+		return errors.New("URL has no host")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q, want http or https", u.Scheme)
+	}
+	return nil
+}
+
+func checkBool(_, s string) error {
+	if _, err := strconv.ParseBool(s); err != nil {
+		return errors.New("invalid boolean, want true or false")
+	}
+	return nil
+}
+
+func checkStateKey(_, s string) error {
+	_, err := parseStateKey(s)
+	return err
+}
+
+// checkConfigEnv checks a variable overriding a config setting, see
+// LoadConfig.
+func checkConfigEnv(name, s string) error {
+	for _, env := range configEnv {
+		if env.name != name {
+			continue
+		}
+		var c Config
+		if err := c.set(env.key, tomlValue{raw: s, env: name}); err != nil {
+			return errors.Unwrap(err) // without the location, which is name
+		}
+		return c.Validate()
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package mekabuild_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func clearEnv(t *testing.T) {
+	t.Helper()
+	clearConfigEnv(t)
+	setenv(t, "ZENITH_STATE_KEY", "")
+	setenv(t, "MEKATEK_BUILDER_API_STATE_KEY", "")
+}
+
+func TestValidateEnv(t *testing.T) {
+	clearEnv(t)
+
+	if err := mekabuild.ValidateEnv(); err != nil {
+		t.Fatalf("empty environment: %v", err)
+	}
+
+	setenv(t, "MEKATEK_BUILDER_API_URL", "builder.example.com")
+	setenv(t, "MEKATEK_BUILDER_API_SANDBOX", "false")
+	setenv(t, "MEKATEK_BUILDER_API_DRY_RUN", "1")
+	setenv(t, "MEKATEK_BUILDER_API_STATE_KEY", strings.Repeat("ab", 32))
+	setenv(t, "MEKATEK_BUILDER_API_TIMEOUT", "2s")
+	if err := mekabuild.ValidateEnv(); err != nil {
+		t.Fatalf("valid environment: %v", err)
+	}
+
+	for name, value := range map[string]string{
+		"ZENITH_API_URL":                  "htps://builder.example.com",
+		"MEKATEK_BUILDER_API_URL":         "https://user:secret@:8080",
+		"MEKATEK_BUILDER_API_SANDBOX":     "yes please",
+		"MEKATEK_BUILDER_API_DRY_RUN":     "on",
+		"MEKATEK_BUILDER_API_STATE_KEY":   "deadbeef",
+		"MEKATEK_BUILDER_API_TIMEOUT":     "2 seconds",
+		"MEKATEK_BUILDER_API_COMPRESSION": "zip",
+		"MEKATEK_BUILDER_API_RETRIES":     "-1",
+	} {
+		setenv(t, name, value)
+	}
+
+	err := mekabuild.ValidateEnv()
+	var errs mekabuild.EnvErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("want EnvErrors, have %v", err)
+	}
+	if want, have := 8, len(errs); want != have {
+		t.Fatalf("errors: want %d, have %d: %v", want, have, err)
+	}
+	for _, s := range []string{"secret", "deadbeef"} {
+		if strings.Contains(err.Error(), s) {
+			t.Errorf("error isn't redacted: %v", err)
+		}
+	}
+	if !strings.Contains(err.Error(), `env:ZENITH_API_URL="htps://builder.example.com": unsupported scheme "htps"`) {
+		t.Errorf("error doesn't describe the bad scheme: %v", err)
+	}
+}
+
+func TestLookupBuilderAPIURL(t *testing.T) {
+	clearEnv(t)
+
+	setenv(t, "MEKATEK_BUILDER_API_URL", "builder.example.com")
+	setenv(t, "MEKATEK_BUILDER_API_DRY_RUN", "on") // irrelevant
+	u, err := mekabuild.LookupBuilderAPIURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "https://builder.example.com", u.String(); want != have {
+		t.Errorf("URL: want %q, have %q", want, have)
+	}
+
+	if _, err := mekabuild.LookupDryRunMode(); err == nil {
+		t.Errorf("dry run mode: want error, have none")
+	}
+
+	setenv(t, "MEKATEK_BUILDER_API_SANDBOX", "ture")
+	if _, err := mekabuild.LookupBuilderAPIURL(); err == nil || !strings.Contains(err.Error(), "MEKATEK_BUILDER_API_SANDBOX") {
+		t.Errorf("bad sandbox: want error naming the variable, have %v", err)
+	}
+	if want, have := "https://builder.example.com", mekabuild.GetBuilderAPIURL().String(); want != have {
+		t.Errorf("lenient URL: want %q, have %q", want, have)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("MustGetBuilderAPIURL didn't panic")
+		}
+	}()
+	mekabuild.MustGetBuilderAPIURL()
+}
@@ -0,0 +1,65 @@
+package mekabuild
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+// SetEndpoints sets the builder API URLs used by the builder, in order of
+// preference, replacing the URL provided to NewBuilder. Requests go to the
+// most preferred endpoint that hasn't failed recently. When a request fails
+// with a connection error or 5xx response, it's immediately sent to the next
+// endpoint. A failed endpoint is skipped for FailoverCooldown, after which it's
+// preferred again if it comes earlier in the list.
+func (b *Builder) SetEndpoints(apiURLs ...*url.URL) error {
+	if len(apiURLs) == 0 {
+		return errors.New("at least one endpoint is required")
+	}
+	for _, u := range apiURLs {
+		if u == nil || u.Host == "" {
+			return errors.New("endpoint URLs must be absolute")
+		}
+	}
+	b.endpoints.Store(append([]*url.URL(nil), apiURLs...))
+	return nil
+}
+
+// Endpoints returns the builder API URLs, in order of preference.
+func (b *Builder) Endpoints() []*url.URL {
+	return append([]*url.URL(nil), b.endpoints.Load().([]*url.URL)...)
+}
+
+// FailoverCooldown is how long an endpoint is deprioritized after a failure.
+const FailoverCooldown = 30 * time.Second
+
+// orderedEndpoints returns the endpoints in the order they should be tried:
+// healthy endpoints in order of preference, followed by recently failed
+// endpoints in order of preference. The result is never empty. With a peer
+// exchange, healthy endpoints are ranked by observations, see
+// SetPeerExchange.
+func (b *Builder) orderedEndpoints() []*url.URL {
+	var (
+		all     = b.endpoints.Load().([]*url.URL)
+		peers   = b.getPeerStats()
+		healthy = make([]*url.URL, 0, len(all))
+		failed  []*url.URL
+	)
+	for _, u := range all {
+		lastFailure := b.stats.lastFailure(endpointName(u))
+		if peers != nil {
+			if _, ok := b.stats.lookup(endpointName(u)); !ok {
+				lastFailure = peers.lastFailure(endpointName(u))
+			}
+		}
+		if b.since(lastFailure) < FailoverCooldown {
+			failed = append(failed, u)
+		} else {
+			healthy = append(healthy, u)
+		}
+	}
+	if peers != nil {
+		b.rankByPeers(healthy, peers)
+	}
+	return append(healthy, failed...)
+}
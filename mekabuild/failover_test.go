@@ -0,0 +1,105 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderFailover(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		chainID = "test-chain-id"
+		key     = newMockKey(t, "foo", rand.Reader)
+		api     = newMockAPI()
+		badHits int32
+		bad     = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&badHits, 1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		good       = newTestServer(t, api)
+		badURL, _  = url.Parse(bad.URL)
+		goodURL, _ = url.Parse(good.URL)
+		builder    = mekabuild.NewBuilder(&http.Client{}, badURL, key, chainID, key.addr)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	if err := builder.SetEndpoints(badURL, goodURL); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	builder.SetLogger(mekabuild.NewStdLogger(log.New(&logs, "", 0), false))
+
+	for height := int64(1); height <= 3; height++ {
+		if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr}); err != nil {
+			t.Fatalf("height %d: %v", height, err)
+		}
+	}
+
+	if want, have := int32(1), atomic.LoadInt32(&badHits); want != have {
+		t.Errorf("requests to failed endpoint: want %d, have %d", want, have)
+	}
+
+	if want, have := good.URL, builder.EndpointStats()[0].Endpoint; want != have {
+		t.Errorf("best endpoint: want %s, have %s", want, have)
+	}
+
+	if want, have := 1, strings.Count(logs.String(), "INFO failing over"); want != have {
+		t.Errorf("failover log lines: want %d, have %d\n%s", want, have, logs.String())
+	}
+}
+
+func TestBuilderNoFailoverOnBadRequest(t *testing.T) {
+	var (
+		ctx         = context.Background()
+		chainID     = "test-chain-id"
+		key         = newMockKey(t, "foo", rand.Reader)
+		api         = newMockAPI()
+		primaryHits int32
+		primary     = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&primaryHits, 1) == 1 {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			api.ServeHTTP(w, r)
+		}))
+		secondaryHits int32
+		secondary     = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&secondaryHits, 1)
+			api.ServeHTTP(w, r)
+		}))
+		primaryURL, _   = url.Parse(primary.URL)
+		secondaryURL, _ = url.Parse(secondary.URL)
+		builder         = mekabuild.NewBuilder(&http.Client{}, primaryURL, key, chainID, key.addr)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	if err := builder.SetEndpoints(primaryURL, secondaryURL); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}); err == nil {
+		t.Fatal("400: want error, have none")
+	}
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 2, ValidatorAddress: key.addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := int32(2), atomic.LoadInt32(&primaryHits); want != have {
+		t.Errorf("requests to primary: want %d, have %d", want, have)
+	}
+	if want, have := int32(0), atomic.LoadInt32(&secondaryHits); want != have {
+		t.Errorf("requests to secondary: want %d, have %d", want, have)
+	}
+}
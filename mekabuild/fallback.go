@@ -0,0 +1,202 @@
+package mekabuild
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+)
+
+// Fallback assembles a block locally, when a build request to the builder API
+// fails. It receives the original request, and the error that caused the
+// failure. Returning an error declines to assemble a block, and BuildBlock
+// returns the original error.
+type Fallback interface {
+	AssembleBlock(req *BuildBlockRequest, cause error) (*BuildBlockResponse, error)
+}
+
+// FallbackFunc adapts a function to a Fallback.
+type FallbackFunc func(req *BuildBlockRequest, cause error) (*BuildBlockResponse, error)
+
+// AssembleBlock implements Fallback.
+func (f FallbackFunc) AssembleBlock(req *BuildBlockRequest, cause error) (*BuildBlockResponse, error) {
+	return f(req, cause)
+}
+
+// TxOrder orders transactions for inclusion in a locally assembled block. It
+// may reorder the given slice in place.
+type TxOrder func(txs [][]byte) [][]byte
+
+// MempoolOrder keeps transactions in the order provided by the mempool.
+func MempoolOrder(txs [][]byte) [][]byte { return txs }
+
+// SmallestFirstOrder orders transactions by size, smallest first, which
+// maximizes the number of transactions that fit in the block. It ignores
+// senders, so it may place a tx before an earlier tx from the same sender,
+// which the app rejects. Prefer PriorityOrder when sequences matter.
+func SmallestFirstOrder(txs [][]byte) [][]byte {
+	sort.SliceStable(txs, func(i, j int) bool { return len(txs[i]) < len(txs[j]) })
+	return txs
+}
+
+// TxOrderInfo is what PriorityOrder knows about a tx, typically taken from the
+// app's CheckTx response.
+type TxOrderInfo struct {
+	Priority int64  // CheckTx priority, higher first
+	Sender   string // CheckTx sender, or empty if unknown
+	Sequence uint64 // sender's account sequence, or nonce
+}
+
+// TxOrderInfoFunc returns the ordering info of a tx, e.g. from the mempool's
+// cached CheckTx responses, which this package doesn't depend on.
+type TxOrderInfoFunc func(tx []byte) (TxOrderInfo, error)
+
+// PriorityOrder returns an order compatible with the Tendermint priority
+// mempool: txs are ordered by priority, highest first, but never ahead of an
+// earlier tx from the same sender, so sequences are never inverted. Among
+// the txs of a sender, a tx is ordered by its sequence, and ties in priority
+// are broken by mempool order, so the order is deterministic.
+//
+// Txs without a sender are ordered by priority alone. Txs whose info can't be
+// determined are placed last, in mempool order.
+func PriorityOrder(info TxOrderInfoFunc) TxOrder {
+	return func(txs [][]byte) [][]byte {
+		var (
+			queues  = map[string]*senderQueue{}
+			pending = &senderHeap{}
+			unknown [][]byte
+		)
+		for i, tx := range txs {
+			ti, err := info(tx)
+			if err != nil {
+				unknown = append(unknown, tx)
+				continue
+			}
+			ptx := prioritizedTx{tx: tx, info: ti, index: i}
+			if ti.Sender == "" {
+				heap.Push(pending, &senderQueue{txs: []prioritizedTx{ptx}})
+				continue
+			}
+			q, ok := queues[ti.Sender]
+			if !ok {
+				q = &senderQueue{}
+				queues[ti.Sender] = q
+			}
+			q.txs = append(q.txs, ptx)
+		}
+		for _, q := range queues {
+			sort.SliceStable(q.txs, func(i, j int) bool { return q.txs[i].info.Sequence < q.txs[j].info.Sequence })
+			heap.Push(pending, q)
+		}
+
+		ordered := txs[:0]
+		for pending.Len() > 0 {
+			q := (*pending)[0]
+			ordered = append(ordered, q.txs[0].tx)
+			if q.txs = q.txs[1:]; len(q.txs) > 0 {
+				heap.Fix(pending, 0)
+			} else {
+				heap.Pop(pending)
+			}
+		}
+		return append(ordered, unknown...)
+	}
+}
+
+type prioritizedTx struct {
+	tx    []byte
+	info  TxOrderInfo
+	index int // in mempool order
+}
+
+// senderQueue holds the remaining txs of a sender, by sequence.
+type senderQueue struct{ txs []prioritizedTx }
+
+// senderHeap orders senders by the priority of their next tx.
+type senderHeap []*senderQueue
+
+func (h senderHeap) Len() int { return len(h) }
+
+func (h senderHeap) Less(i, j int) bool {
+	a, b := h[i].txs[0], h[j].txs[0]
+	if a.info.Priority != b.info.Priority {
+		return a.info.Priority > b.info.Priority
+	}
+	return a.index < b.index
+}
+
+func (h senderHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *senderHeap) Push(x interface{}) { *h = append(*h, x.(*senderQueue)) }
+
+func (h *senderHeap) Pop() interface{} {
+	old := *h
+	q := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return q
+}
+
+// NewMempoolFallback returns a fallback that proposes the validator's own
+// mempool transactions, i.e. the transactions in the build request, ordered by
+// the given strategy, and truncated to the request's MaxBytes. A nil order is
+// equivalent to MempoolOrder.
+//
+// MaxBytes is compared against the sum of raw transaction sizes, which slightly
+// underestimates the encoded size of the block. Gas isn't accounted for. The
+// ordered txs are truncated, never skipped, so the block preserves the order's
+// guarantees, e.g. PriorityOrder's sender sequences.
+func NewMempoolFallback(order TxOrder) Fallback {
+	if order == nil {
+		order = MempoolOrder
+	}
+	return FallbackFunc(func(req *BuildBlockRequest, _ error) (*BuildBlockResponse, error) {
+		txs := order(append([][]byte(nil), req.Txs...))
+
+		var size int64
+		for i, tx := range txs {
+			if size += int64(len(tx)); req.MaxBytes > 0 && size > req.MaxBytes {
+				txs = txs[:i]
+				break
+			}
+		}
+
+		return &BuildBlockResponse{Txs: txs}, nil
+	})
+}
+
+// SetFallback configures the builder to assemble blocks locally via f when a
+// build request fails. Responses from the fallback have Fallback set. By
+// default, BuildBlock returns the error, and the caller must handle it.
+func (b *Builder) SetFallback(f Fallback) {
+	b.fallback.Store(fallbackBox{f})
+}
+
+func (b *Builder) getFallback() Fallback {
+	box, _ := b.fallback.Load().(fallbackBox)
+	return box.Fallback
+}
+
+type fallbackBox struct{ Fallback }
+
+// assembleFallback invokes the fallback, if one is set, after a failed build
+// request. It returns the original error if there's no fallback, or if the
+// fallback fails.
+func (b *Builder) assembleFallback(req *BuildBlockRequest, cause error) (*BuildBlockResponse, error) {
+	f := b.getFallback()
+	if f == nil {
+		return nil, cause
+	}
+
+	resp, err := f.AssembleBlock(req, cause)
+	if err == nil && resp == nil {
+		err = errors.New("no response")
+	}
+	if err != nil {
+		b.getLogger().Errorf("fallback failed: chain_id=%s height=%d cause=%v err=%v", req.ChainID, req.Height, cause, err)
+		return nil, cause
+	}
+
+	resp.Txs = PlaceMandatoryTxs(resp.Txs, req.MandatoryTxs)
+	resp.Fallback = true
+	b.getLogger().Infof("build block used fallback: chain_id=%s height=%d txs_in=%d txs_out=%d cause=%v", req.ChainID, req.Height, len(req.Txs), len(resp.Txs), cause)
+	return resp, nil
+}
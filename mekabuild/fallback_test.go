@@ -0,0 +1,242 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderFallback(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx    = context.Background()
+		key    = newMockKey(t, "validator", nil)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-id", key.addr)
+		newReq    = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{
+				ChainID:          "chain-id",
+				ValidatorAddress: key.addr,
+				MaxBytes:         6,
+				Txs:              [][]byte{[]byte("aaa"), []byte("b"), []byte("cc"), []byte("dddd")},
+			}
+		}
+	)
+	defer server.Close()
+
+	var statusErr *mekabuild.StatusError
+	if _, err := builder.BuildBlock(ctx, newReq()); !errors.As(err, &statusErr) {
+		t.Fatalf("without fallback: want %T, have %v", statusErr, err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		order mekabuild.TxOrder
+		want  [][]byte
+	}{
+		{"mempool", nil, [][]byte{[]byte("aaa"), []byte("b"), []byte("cc")}},
+		{"smallest first", mekabuild.SmallestFirstOrder, [][]byte{[]byte("b"), []byte("cc"), []byte("aaa")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			builder.SetFallback(mekabuild.NewMempoolFallback(tc.order))
+
+			req := newReq()
+			resp, err := builder.BuildBlock(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !resp.Fallback {
+				t.Errorf("response not marked as fallback")
+			}
+
+			if want, have := tc.want, resp.Txs; !reflect.DeepEqual(want, have) {
+				t.Errorf("txs: want %q, have %q", want, have)
+			}
+
+			if want, have := newReq().Txs, req.Txs; !reflect.DeepEqual(want, have) {
+				t.Errorf("request txs modified: want %q, have %q", want, have)
+			}
+		})
+	}
+
+	declined := errors.New("declined")
+	builder.SetFallback(mekabuild.FallbackFunc(func(*mekabuild.BuildBlockRequest, error) (*mekabuild.BuildBlockResponse, error) {
+		return nil, declined
+	}))
+	if _, err := builder.BuildBlock(ctx, newReq()); !errors.As(err, &statusErr) {
+		t.Errorf("declined fallback: want %T, have %v", statusErr, err)
+	}
+}
+
+func TestPriorityOrder(t *testing.T) {
+	t.Parallel()
+
+	order := mekabuild.PriorityOrder(decodeOrderTx)
+
+	// alice's txs keep their sequence order, even though her second tx
+	// has the highest priority.
+	txs := [][]byte{
+		orderTx("alice", 1, 1, 0),
+		orderTx("alice", 2, 9, 1),
+		orderTx("bob", 1, 5, 2),
+		orderTx("", 0, 3, 3),
+		[]byte("undecodable"),
+	}
+	want := [][]byte{txs[2], txs[3], txs[0], txs[1], txs[4]}
+	if have := order(append([][]byte(nil), txs...)); !reflect.DeepEqual(want, have) {
+		t.Errorf("order: want %q, have %q", want, have)
+	}
+}
+
+func TestPriorityOrderProperties(t *testing.T) {
+	t.Parallel()
+
+	order := mekabuild.PriorityOrder(decodeOrderTx)
+
+	for seed := int64(0); seed < 500; seed++ {
+		var (
+			rng     = mathrand.New(mathrand.NewSource(seed))
+			mempool = randomMempool(rng)
+			have    = order(append([][]byte(nil), mempool...))
+		)
+
+		if want := sortedCopy(mempool); !reflect.DeepEqual(want, sortedCopy(have)) {
+			t.Fatalf("seed %d: output isn't a permutation of the mempool", seed)
+		}
+
+		if again := order(append([][]byte(nil), mempool...)); !reflect.DeepEqual(have, again) {
+			t.Fatalf("seed %d: order isn't deterministic", seed)
+		}
+
+		// Every truncation of the order, as taken by the fallback, must
+		// keep each sender's sequences in order, and pick the highest
+		// priority tx available at each step.
+		var (
+			sequences = map[string]uint64{}
+			remaining = map[string][]mekabuild.TxOrderInfo{}
+			unknown   = false
+		)
+		for _, tx := range mempool {
+			if info, err := decodeOrderTx(tx); err == nil && info.Sender != "" {
+				remaining[info.Sender] = append(remaining[info.Sender], info)
+			}
+		}
+		for _, infos := range remaining {
+			sort.Slice(infos, func(i, j int) bool { return infos[i].Sequence < infos[j].Sequence })
+		}
+
+		for i, tx := range have {
+			info, err := decodeOrderTx(tx)
+			if err != nil {
+				unknown = true
+				continue
+			}
+			if unknown {
+				t.Fatalf("seed %d: tx %d follows an undecodable tx", seed, i)
+			}
+			if info.Sender == "" {
+				continue
+			}
+			if seq, ok := sequences[info.Sender]; ok && info.Sequence < seq {
+				t.Fatalf("seed %d: tx %d: %s sequence %d after %d", seed, i, info.Sender, info.Sequence, seq)
+			}
+			sequences[info.Sender] = info.Sequence
+
+			for sender, infos := range remaining {
+				if sender != info.Sender && infos[0].Priority > info.Priority {
+					t.Fatalf("seed %d: tx %d: priority %d ahead of available priority %d", seed, i, info.Priority, infos[0].Priority)
+				}
+			}
+			if remaining[info.Sender] = remaining[info.Sender][1:]; len(remaining[info.Sender]) == 0 {
+				delete(remaining, info.Sender)
+			}
+		}
+	}
+}
+
+func TestMempoolFallbackPriorityOrder(t *testing.T) {
+	t.Parallel()
+
+	var (
+		rng      = mathrand.New(mathrand.NewSource(1))
+		mempool  = randomMempool(rng)
+		fallback = mekabuild.NewMempoolFallback(mekabuild.PriorityOrder(decodeOrderTx))
+	)
+
+	var size int64
+	for _, tx := range mempool {
+		size += int64(len(tx))
+	}
+
+	resp, err := fallback.AssembleBlock(&mekabuild.BuildBlockRequest{Txs: mempool, MaxBytes: size / 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := mekabuild.PriorityOrder(decodeOrderTx)(append([][]byte(nil), mempool...))[:len(resp.Txs)]
+	if !reflect.DeepEqual(want, resp.Txs) {
+		t.Errorf("fallback txs aren't a prefix of the priority order")
+	}
+}
+
+func orderTx(sender string, sequence uint64, priority int64, id int) []byte {
+	return []byte(fmt.Sprintf("%s/%d/%d/%d", sender, sequence, priority, id))
+}
+
+func decodeOrderTx(tx []byte) (mekabuild.TxOrderInfo, error) {
+	var info mekabuild.TxOrderInfo
+	parts := strings.SplitN(string(tx), "/", 2)
+	if len(parts) != 2 {
+		return info, errors.New("invalid tx")
+	}
+	var id int
+	if _, err := fmt.Sscanf(parts[1], "%d/%d/%d", &info.Sequence, &info.Priority, &id); err != nil {
+		return info, err
+	}
+	info.Sender = parts[0]
+	return info, nil
+}
+
+// randomMempool returns txs from a few senders with random priorities, in
+// mempool order, where each sender's sequences are shuffled.
+func randomMempool(rng *mathrand.Rand) [][]byte {
+	var txs [][]byte
+	for s := 0; s < 1+rng.Intn(5); s++ {
+		sender := fmt.Sprintf("sender-%d", s)
+		for seq := 0; seq < rng.Intn(6); seq++ {
+			txs = append(txs, orderTx(sender, uint64(seq), rng.Int63n(4), len(txs)))
+		}
+	}
+	for i := 0; i < rng.Intn(3); i++ {
+		txs = append(txs, orderTx("", 0, rng.Int63n(4), len(txs)))
+	}
+	for i := 0; i < rng.Intn(2); i++ {
+		txs = append(txs, []byte(fmt.Sprintf("undecodable-%d", i)))
+	}
+	rng.Shuffle(len(txs), func(i, j int) { txs[i], txs[j] = txs[j], txs[i] })
+	return txs
+}
+
+func sortedCopy(txs [][]byte) []string {
+	s := make([]string, len(txs))
+	for i, tx := range txs {
+		s[i] = string(tx)
+	}
+	sort.Strings(s)
+	return s
+}
@@ -0,0 +1,64 @@
+package mekabuild
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FeeMarket conveys the chain's current fee requirements to the builder API,
+// so it can exclude transactions that would be rejected by the validator's
+// mempool, or fail in DeliverTx, and waste block space.
+//
+// Prices are Cosmos SDK DecCoins strings, e.g. "0.025uatom,0.1uosmo".
+type FeeMarket struct {
+	// MinGasPrices are the validator's configured minimum gas prices.
+	MinGasPrices string `json:"min_gas_prices,omitempty"`
+
+	// BaseFee is the current base fee per unit of gas, on chains with a
+	// dynamic fee market, e.g. x/feemarket. Empty means no fee market.
+	BaseFee string `json:"base_fee,omitempty"`
+}
+
+// Validate returns an error if any of the prices are malformed.
+func (fm *FeeMarket) Validate() error {
+	if err := validateDecCoins(fm.MinGasPrices); err != nil {
+		return fmt.Errorf("min gas prices: %w", err)
+	}
+	if err := validateDecCoins(fm.BaseFee); err != nil {
+		return fmt.Errorf("base fee: %w", err)
+	}
+	return nil
+}
+
+// WithFeeMarket returns a context carrying the chain's fee market state.
+// BuildBlock forwards it to the builder API, unless the request already has a
+// fee market set.
+func WithFeeMarket(ctx context.Context, fm FeeMarket) context.Context {
+	return context.WithValue(ctx, feeMarketKey{}, fm)
+}
+
+type feeMarketKey struct{}
+
+func feeMarketFrom(ctx context.Context) *FeeMarket {
+	fm, ok := ctx.Value(feeMarketKey{}).(FeeMarket)
+	if !ok {
+		return nil
+	}
+	return &fm
+}
+
+var decCoinRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[a-zA-Z][a-zA-Z0-9/:._-]{2,127}$`)
+
+func validateDecCoins(s string) error {
+	if s == "" {
+		return nil
+	}
+	for _, coin := range strings.Split(s, ",") {
+		if !decCoinRegexp.MatchString(strings.TrimSpace(coin)) {
+			return fmt.Errorf("invalid coin %q", coin)
+		}
+	}
+	return nil
+}
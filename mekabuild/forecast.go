@@ -0,0 +1,154 @@
+package mekabuild
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// AuctionStatsRequest is sent to the auction stats endpoint of the builder
+// API, to query recent auction outcomes on a chain.
+type AuctionStatsRequest struct {
+	ChainID string `json:"chain_id"`
+}
+
+// AuctionStatsResponse is returned by the auction stats endpoint of the
+// builder API. It summarizes auctions over a recent window of heights.
+type AuctionStatsResponse struct {
+	ChainID    string `json:"chain_id"`
+	FromHeight int64  `json:"from_height"`
+	ToHeight   int64  `json:"to_height"`
+
+	// BlockTimeMillis is the average block time over the window.
+	BlockTimeMillis int64 `json:"block_time_ms"`
+
+	// Auctions is the number of heights in the window for which the
+	// builder API held an auction, and TotalPayments the sum of the
+	// payments offered to validators in those auctions.
+	Auctions      int64 `json:"auctions"`
+	TotalPayments Coins `json:"total_payments"`
+
+	// TotalPaymentsByBaseDenom is TotalPayments with IBC voucher denoms
+	// resolved to their base denoms. It's computed by the client, and only
+	// set if the builder has a denom resolver, see SetDenomResolver.
+	TotalPaymentsByBaseDenom Coins `json:"total_payments_by_base_denom,omitempty"`
+}
+
+var auctionStatsEndpoint = Endpoint{Path: "/v0/auction_stats"}
+
+// AuctionStats queries the builder API for recent auction statistics on the
+// builder's chain.
+func (b *Builder) AuctionStats(ctx context.Context) (*AuctionStatsResponse, error) {
+	req := &AuctionStatsRequest{ChainID: b.chainID}
+
+	var resp AuctionStatsResponse
+	if err := b.Call(ctx, auctionStatsEndpoint, req, &resp); err != nil {
+		return nil, err
+	}
+
+	if b.getDenomResolver() != nil {
+		byBase, err := b.CoinsByBaseDenom(ctx, resp.TotalPayments)
+		if err != nil {
+			b.getLogger().Errorf("resolve payment denoms failed: chain_id=%s err=%v", b.chainID, err)
+		}
+		resp.TotalPaymentsByBaseDenom = byBase
+	}
+
+	return &resp, nil
+}
+
+// Forecast periods.
+const (
+	ForecastWeek  = 7 * 24 * time.Hour
+	ForecastMonth = 30 * 24 * time.Hour
+)
+
+// EarningsForecast estimates a validator's builder earnings, assuming it
+// proposes in proportion to its voting power, and that future auctions pay
+// like recent ones. It's an estimate, not a commitment.
+type EarningsForecast struct {
+	VotingPower      int64 `json:"voting_power"`
+	TotalVotingPower int64 `json:"total_voting_power"`
+
+	// ProposalsPerWeek and ProposalsPerMonth are the expected number of
+	// blocks proposed by the validator per period.
+	ProposalsPerWeek  float64 `json:"proposals_per_week"`
+	ProposalsPerMonth float64 `json:"proposals_per_month"`
+
+	// Weekly and Monthly are the expected earnings per period, rounded
+	// down to whole units of each denom.
+	Weekly  Coins `json:"weekly"`
+	Monthly Coins `json:"monthly"`
+
+	// Stats are the auction statistics the forecast is based on.
+	Stats *AuctionStatsResponse `json:"stats"`
+}
+
+// ForecastEarnings queries recent auction statistics from the builder API, and
+// forecasts the earnings of a validator with the given share of the chain's
+// voting power. See ForecastEarnings for details.
+func (b *Builder) ForecastEarnings(ctx context.Context, votingPower, totalVotingPower int64) (*EarningsForecast, error) {
+	stats, err := b.AuctionStats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get auction stats: %w", err)
+	}
+	return ForecastEarnings(stats, votingPower, totalVotingPower)
+}
+
+// ForecastEarnings forecasts the earnings of a validator with the given share
+// of the chain's voting power, from the given auction statistics. The expected
+// payment per proposal is the average payment per auction, and the expected
+// number of proposals per period is the validator's share of the blocks
+// produced at the average block time.
+func ForecastEarnings(stats *AuctionStatsResponse, votingPower, totalVotingPower int64) (*EarningsForecast, error) {
+	switch {
+	case votingPower < 0:
+		return nil, fmt.Errorf("voting power must not be negative, have %d", votingPower)
+	case totalVotingPower <= 0:
+		return nil, fmt.Errorf("total voting power must be positive, have %d", totalVotingPower)
+	case votingPower > totalVotingPower:
+		return nil, fmt.Errorf("voting power %d exceeds total voting power %d", votingPower, totalVotingPower)
+	case stats.BlockTimeMillis <= 0:
+		return nil, errors.New("auction stats have no block time")
+	}
+
+	proposals := func(period time.Duration) float64 {
+		blocks := float64(period.Milliseconds()) / float64(stats.BlockTimeMillis)
+		return blocks * float64(votingPower) / float64(totalVotingPower)
+	}
+
+	return &EarningsForecast{
+		VotingPower:       votingPower,
+		TotalVotingPower:  totalVotingPower,
+		ProposalsPerWeek:  proposals(ForecastWeek),
+		ProposalsPerMonth: proposals(ForecastMonth),
+		Weekly:            forecastPayments(stats, votingPower, totalVotingPower, ForecastWeek),
+		Monthly:           forecastPayments(stats, votingPower, totalVotingPower, ForecastMonth),
+		Stats:             stats,
+	}, nil
+}
+
+// forecastPayments computes the expected payments over the period exactly, as
+// total payments / auctions * period / block time * voting power share, and
+// rounds down.
+func forecastPayments(stats *AuctionStatsResponse, votingPower, totalVotingPower int64, period time.Duration) Coins {
+	if stats.Auctions <= 0 {
+		return Coins{}
+	}
+
+	var (
+		num = new(big.Int).Mul(big.NewInt(period.Milliseconds()), big.NewInt(votingPower))
+		den = new(big.Int).Mul(big.NewInt(stats.BlockTimeMillis), big.NewInt(stats.Auctions))
+	)
+	den.Mul(den, big.NewInt(totalVotingPower))
+
+	out := make(Coins, 0, len(stats.TotalPayments))
+	for _, c := range stats.TotalPayments {
+		amount := new(big.Int).Mul(c.amount(), num)
+		amount.Quo(amount, den)
+		out = append(out, Coin{Denom: c.Denom, Amount: amount})
+	}
+	return normalizeCoins(out)
+}
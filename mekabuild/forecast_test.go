@@ -0,0 +1,79 @@
+package mekabuild_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderForecastEarnings(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx     = context.Background()
+		chainID = "test-chain-id"
+		payment = mustParseCoins(t, "1000000uatom,5uosmo")
+		server  = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req mekabuild.AuctionStatsRequest
+			if r.URL.Path != "/v0/auction_stats" || json.NewDecoder(r.Body).Decode(&req) != nil {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(mekabuild.AuctionStatsResponse{
+				ChainID:         req.ChainID,
+				FromHeight:      1,
+				ToHeight:        100,
+				BlockTimeMillis: 6000,
+				Auctions:        100,
+				TotalPayments:   payment,
+			})
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, nil, chainID, "")
+	)
+
+	forecast, err := builder.ForecastEarnings(ctx, 10, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := 10080.0, forecast.ProposalsPerWeek; want != have {
+		t.Errorf("proposals per week: want %v, have %v", want, have)
+	}
+	if want, have := 43200.0, forecast.ProposalsPerMonth; want != have {
+		t.Errorf("proposals per month: want %v, have %v", want, have)
+	}
+
+	// 10000uatom per auction, and 0.05uosmo, rounded down.
+	if want, have := "100800000uatom,504uosmo", forecast.Weekly.String(); want != have {
+		t.Errorf("weekly: want %q, have %q", want, have)
+	}
+	if want, have := "432000000uatom,2160uosmo", forecast.Monthly.String(); want != have {
+		t.Errorf("monthly: want %q, have %q", want, have)
+	}
+
+	if _, err := mekabuild.ForecastEarnings(forecast.Stats, 101, 100); err == nil {
+		t.Errorf("voting power above total: want error, have none")
+	}
+
+	empty, err := mekabuild.ForecastEarnings(&mekabuild.AuctionStatsResponse{BlockTimeMillis: 6000}, 10, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 0, len(empty.Monthly); want != have {
+		t.Errorf("no auctions: want %d coins, have %d", want, have)
+	}
+}
+
+func mustParseCoins(t *testing.T, s string) mekabuild.Coins {
+	t.Helper()
+	coins, err := mekabuild.ParseCoins(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return coins
+}
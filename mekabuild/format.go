@@ -0,0 +1,305 @@
+package mekabuild
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// WireFormat is a named pairing of a request codec and compressor, like
+// "proto+gzip". Formats are registered in a FormatRegistry, and the builder
+// picks the format of each request from its preferred formats, by the
+// capabilities negotiated with the builder API and the request type. See
+// SetFormats and ForceFormat.
+type WireFormat struct {
+	// Name identifies the format, by convention the codec name, followed
+	// by "+" and the compressor's encoding, if any, e.g. "json+gzip".
+	Name string
+
+	Codec Codec
+
+	// Compressor is nil for uncompressed formats.
+	Compressor Compressor
+}
+
+// Capabilities returns the capabilities the builder API must advertise
+// before the format is used.
+func (f WireFormat) Capabilities() Capabilities {
+	c := f.Codec.Capability()
+	if f.Compressor != nil {
+		c |= f.Compressor.Capability()
+	}
+	return c
+}
+
+// supports returns true if the format's codec can encode req.
+func (f WireFormat) supports(req interface{}) bool {
+	s, ok := f.Codec.(interface{ Supports(interface{}) bool })
+	return !ok || s.Supports(req)
+}
+
+// FormatRegistry holds the wire formats available to builders, by name, and
+// the preferred formats of chains. It's safe for concurrent use.
+type FormatRegistry struct {
+	mtx     sync.RWMutex
+	formats map[string]WireFormat
+	chains  map[string][]string // chain ID to preferred format names
+}
+
+// NewFormatRegistry returns a registry with the formats of the codecs and
+// compressors of this package: "json", "json+gzip", "json+snappy",
+// "msgpack", "msgpack+gzip", "proto", "proto+gzip" and "proto+snappy". Zstd
+// formats must be registered with RegisterZstd, since this package doesn't
+// implement zstd.
+func NewFormatRegistry() *FormatRegistry {
+	r := &FormatRegistry{
+		formats: map[string]WireFormat{},
+		chains:  map[string][]string{},
+	}
+	gz := gzipCompressor{level: gzip.DefaultCompression}
+	for _, f := range []WireFormat{
+		{Name: "json", Codec: JSONCodec},
+		{Name: "json+gzip", Codec: JSONCodec, Compressor: gz},
+		{Name: "json+snappy", Codec: JSONCodec, Compressor: SnappyCompressor},
+		{Name: "msgpack", Codec: MsgpackCodec},
+		{Name: "msgpack+gzip", Codec: MsgpackCodec, Compressor: gz},
+		{Name: "proto", Codec: ProtoCodec},
+		{Name: "proto+gzip", Codec: ProtoCodec, Compressor: gz},
+		{Name: "proto+snappy", Codec: ProtoCodec, Compressor: SnappyCompressor},
+	} {
+		r.formats[f.Name] = f
+	}
+	return r
+}
+
+// DefaultFormatRegistry is the registry used by builders, unless another is
+// set with SetFormatRegistry.
+var DefaultFormatRegistry = NewFormatRegistry()
+
+// Register adds a format to the registry. It returns an error if the format
+// has no name or codec, or if a format with the same name is already
+// registered.
+func (r *FormatRegistry) Register(f WireFormat) error {
+	if f.Name == "" || strings.ContainsAny(f.Name, ", \t") {
+		return fmt.Errorf("invalid format name %q", f.Name)
+	}
+	if f.Codec == nil {
+		return fmt.Errorf("format %s has no codec", f.Name)
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.formats[f.Name]; ok {
+		return fmt.Errorf("format %s already registered", f.Name)
+	}
+	r.formats[f.Name] = f
+	return nil
+}
+
+// RegisterZstd registers the "json+zstd" and "proto+zstd" formats, with the
+// zstd writer and reader constructors, see NewZstdCompressor.
+func (r *FormatRegistry) RegisterZstd(newWriter func(io.Writer) (io.WriteCloser, error), newReader func(io.Reader) (io.ReadCloser, error)) error {
+	zstd := NewZstdCompressor(newWriter, newReader)
+	for _, f := range []WireFormat{
+		{Name: "json+zstd", Codec: JSONCodec, Compressor: zstd},
+		{Name: "proto+zstd", Codec: ProtoCodec, Compressor: zstd},
+	} {
+		if err := r.Register(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lookup returns the format with the given name.
+func (r *FormatRegistry) Lookup(name string) (WireFormat, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	f, ok := r.formats[name]
+	return f, ok
+}
+
+// Names returns the names of the registered formats, sorted.
+func (r *FormatRegistry) Names() []string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	names := make([]string, 0, len(r.formats))
+	for name := range r.formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetChainDefaults sets the preferred formats of builders for a chain, most
+// preferred first, which don't set their own with SetFormats. No names
+// removes the chain's defaults. It returns an error if a format isn't
+// registered.
+func (r *FormatRegistry) SetChainDefaults(chainID string, names ...string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, name := range names {
+		if _, ok := r.formats[name]; !ok {
+			return fmt.Errorf("%w %q", ErrUnknownFormat, name)
+		}
+	}
+	if len(names) == 0 {
+		delete(r.chains, chainID)
+		return nil
+	}
+	r.chains[chainID] = append([]string(nil), names...)
+	return nil
+}
+
+// ChainDefaults returns the preferred formats of a chain, if any.
+func (r *FormatRegistry) ChainDefaults(chainID string) []string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return append([]string(nil), r.chains[chainID]...)
+}
+
+// lookupAll returns the formats with the given names.
+func (r *FormatRegistry) lookupAll(names []string) ([]WireFormat, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	formats := make([]WireFormat, 0, len(names))
+	for _, name := range names {
+		f, ok := r.formats[name]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownFormat, name)
+		}
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+// ErrUnknownFormat is returned for format names which aren't registered.
+var ErrUnknownFormat = errors.New("unknown wire format")
+
+// SetFormatRegistry sets the registry the builder looks up formats in. It
+// should precede SetFormats and ForceFormat. A nil registry restores
+// DefaultFormatRegistry.
+func (b *Builder) SetFormatRegistry(r *FormatRegistry) {
+	b.formatRegistry.Store(formatRegistryBox{r})
+}
+
+// WithFormatRegistry sets the format registry. See SetFormatRegistry.
+func WithFormatRegistry(r *FormatRegistry) Option {
+	return func(b *Builder) error {
+		b.SetFormatRegistry(r)
+		return nil
+	}
+}
+
+type formatRegistryBox struct{ *FormatRegistry }
+
+func (b *Builder) getFormatRegistry() *FormatRegistry {
+	box, _ := b.formatRegistry.Load().(formatRegistryBox)
+	if box.FormatRegistry == nil {
+		return DefaultFormatRegistry
+	}
+	return box.FormatRegistry
+}
+
+// SetFormats sets the preferred wire formats of requests, most preferred
+// first, overriding the chain defaults of the registry. Each request uses the
+// first format whose capabilities the builder API has advertised, and whose
+// codec supports the request type. Compressed formats are skipped while
+// compression is disabled, see SetCompression. If no format qualifies, or
+// none are set, requests are encoded as set by SetCodec and SetCompressor.
+//
+// The capabilities of the formats' compressors are added to the
+// capabilities advertised by the builder, see SetCapabilities. It returns an
+// error if a format isn't registered.
+func (b *Builder) SetFormats(names ...string) error {
+	formats, err := b.getFormatRegistry().lookupAll(names)
+	if err != nil {
+		return err
+	}
+	for _, f := range formats {
+		if f.Compressor != nil {
+			b.advertise(f.Compressor.Capability())
+		}
+	}
+	b.formats.Store(append([]string(nil), names...))
+	return nil
+}
+
+// WithFormats sets the preferred wire formats. See SetFormats.
+func WithFormats(names ...string) Option {
+	return func(b *Builder) error {
+		return b.SetFormats(names...)
+	}
+}
+
+// ForceFormat makes every request use the named format, regardless of the
+// negotiated capabilities, e.g. "json" when middleboxes mangle other
+// encodings. Requests of types the format's codec doesn't support are sent
+// as JSON, with the format's compressor. An empty name restores negotiation.
+// It returns an error if the format isn't registered.
+func (b *Builder) ForceFormat(name string) error {
+	if name != "" {
+		if _, ok := b.getFormatRegistry().Lookup(name); !ok {
+			return fmt.Errorf("%w %q", ErrUnknownFormat, name)
+		}
+	}
+	b.forcedFormat.Store(name)
+	return nil
+}
+
+// WithForcedFormat forces the wire format of requests. See ForceFormat.
+func WithForcedFormat(name string) Option {
+	return func(b *Builder) error {
+		return b.ForceFormat(name)
+	}
+}
+
+// advertise adds capabilities to the ones advertised by the builder.
+func (b *Builder) advertise(c Capabilities) {
+	for {
+		advertised := atomic.LoadUint64(&b.capabilities)
+		if atomic.CompareAndSwapUint64(&b.capabilities, advertised, advertised|uint64(c)) {
+			return
+		}
+	}
+}
+
+// requestFormat returns the wire format to encode req with: the forced format,
+// the first qualifying preferred format, or the builder's codec and
+// compressor, when sent to the endpoint.
+func (b *Builder) requestFormat(endpoint string, req interface{}) WireFormat {
+	registry := b.getFormatRegistry()
+
+	if name, _ := b.forcedFormat.Load().(string); name != "" {
+		if f, ok := registry.Lookup(name); ok {
+			if !f.supports(req) {
+				f.Codec = JSONCodec
+			}
+			return f
+		}
+	}
+
+	names, _ := b.formats.Load().([]string)
+	if len(names) == 0 {
+		names = registry.ChainDefaults(b.chainID)
+	}
+	if len(names) > 0 {
+		var (
+			negotiated = b.endpointCapabilities(endpoint)
+			compress   = atomic.LoadInt32(&b.disableCompression) == 0
+		)
+		formats, _ := registry.lookupAll(names)
+		for _, f := range formats {
+			if (f.Compressor == nil || compress) && negotiated.Has(f.Capabilities()) && f.supports(req) {
+				return f
+			}
+		}
+	}
+
+	return WireFormat{Codec: b.requestCodec(endpoint, req), Compressor: b.requestCompressor(endpoint)}
+}
@@ -0,0 +1,167 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderFormats(t *testing.T) {
+	t.Parallel()
+
+	type format struct{ contentType, encoding string }
+
+	var (
+		ctx     = context.Background()
+		chainID = "chain-id"
+		key     = newMockKey(t, "validator", nil)
+		formats = make(chan format, 10)
+		server  = newTestServer(t, mekabuild.DecompressRequestMiddleware(mekabuild.SnappyCompressor)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(mekabuild.CapabilitiesHeader, (mekabuild.CapabilityProto | mekabuild.CapabilitySnappy).String())
+
+			c := mekabuild.JSONCodec
+			if r.Header.Get("content-type") == mekabuild.ProtoCodec.ContentType() {
+				c = mekabuild.ProtoCodec
+			}
+			var req mekabuild.BuildBlockRequest
+			if err := c.Decode(r.Body, &req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := mekabuild.VerifyBuildBlockRequest(&req, key.PublicKey); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			mekabuild.JSONCodec.Encode(w, mekabuild.BuildBlockResponse{Txs: req.Txs, ValidatorPayment: "1uatom"})
+		})))
+		apiURL, _ = url.Parse(server.URL)
+		client    = &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			formats <- format{r.Header.Get("content-type"), r.Header.Get("content-encoding")}
+			return http.DefaultTransport.RoundTrip(r)
+		})}
+		builder = mekabuild.NewBuilder(client, apiURL, key, chainID, key.addr)
+		build   = func(want format) {
+			t.Helper()
+			if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}); err != nil {
+				t.Fatal(err)
+			}
+			if have := <-formats; want != have {
+				t.Errorf("format: want %+v, have %+v", want, have)
+			}
+		}
+		jsonGzip    = format{"application/json", "gzip"}
+		protoSnappy = format{"application/x-protobuf", "snappy"}
+	)
+
+	if err := builder.SetFormats("proto+zstd"); !errors.Is(err, mekabuild.ErrUnknownFormat) {
+		t.Errorf("unknown format: want %v, have %v", mekabuild.ErrUnknownFormat, err)
+	}
+	if err := builder.SetFormats("proto+snappy", "json+gzip"); err != nil {
+		t.Fatal(err)
+	}
+
+	build(jsonGzip)    // not negotiated yet
+	build(protoSnappy) // negotiated
+
+	builder.SetCompression(false)
+	build(format{"application/json", ""}) // the builder's codec and compressor
+	builder.SetCompression(true)
+
+	if err := builder.ForceFormat("json"); err != nil {
+		t.Fatal(err)
+	}
+	build(format{"application/json", ""})
+	if err := builder.ForceFormat(""); err != nil {
+		t.Fatal(err)
+	}
+	build(protoSnappy)
+}
+
+func TestFormatRegistryChainDefaults(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		key       = newMockKey(t, "validator", nil)
+		encodings = make(chan string, 10)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		client    = &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			encodings <- r.Header.Get("content-encoding")
+			return http.DefaultTransport.RoundTrip(r)
+		})}
+		registry = mekabuild.NewFormatRegistry()
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	if err := registry.SetChainDefaults(chainID, "xml"); !errors.Is(err, mekabuild.ErrUnknownFormat) {
+		t.Errorf("unknown format: want %v, have %v", mekabuild.ErrUnknownFormat, err)
+	}
+	if err := registry.SetChainDefaults(chainID, "json"); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := []string{"json"}, registry.ChainDefaults(chainID); !reflect.DeepEqual(want, have) {
+		t.Errorf("chain defaults: want %v, have %v", want, have)
+	}
+
+	builder, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithHTTPClient(client), mekabuild.WithEndpoints(apiURL), mekabuild.WithFormatRegistry(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "", <-encodings; want != have {
+		t.Errorf("chain default encoding: want %q, have %q", want, have)
+	}
+
+	if err := builder.SetFormats("json+gzip"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 2, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "gzip", <-encodings; want != have {
+		t.Errorf("builder format encoding: want %q, have %q", want, have)
+	}
+}
+
+func TestFormatRegistryRegister(t *testing.T) {
+	t.Parallel()
+
+	r := mekabuild.NewFormatRegistry()
+	if want, have := []string{"json", "json+gzip", "json+snappy", "msgpack", "msgpack+gzip", "proto", "proto+gzip", "proto+snappy"}, r.Names(); !reflect.DeepEqual(want, have) {
+		t.Errorf("names: want %v, have %v", want, have)
+	}
+
+	if err := r.Register(mekabuild.WireFormat{Name: "json", Codec: mekabuild.JSONCodec}); err == nil {
+		t.Errorf("duplicate: want error, have none")
+	}
+	if err := r.Register(mekabuild.WireFormat{Name: "json xml", Codec: mekabuild.JSONCodec}); err == nil {
+		t.Errorf("bad name: want error, have none")
+	}
+	if err := r.Register(mekabuild.WireFormat{Name: "nothing"}); err == nil {
+		t.Errorf("no codec: want error, have none")
+	}
+
+	newWriter := func(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil }
+	newReader := func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil }
+	if err := r.RegisterZstd(newWriter, newReader); err != nil {
+		t.Fatal(err)
+	}
+	f, ok := r.Lookup("proto+zstd")
+	if !ok {
+		t.Fatalf("proto+zstd isn't registered")
+	}
+	if want, have := mekabuild.CapabilityProto|mekabuild.CapabilityZstd, f.Capabilities(); want != have {
+		t.Errorf("capabilities: want %s, have %s", want, have)
+	}
+}
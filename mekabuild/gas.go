@@ -0,0 +1,61 @@
+package mekabuild
+
+import (
+	"errors"
+	"fmt"
+)
+
+// GasEstimator returns the gas a tx uses, typically its gas limit, decoded
+// from the tx by the chain integration, since this package can't decode txs.
+type GasEstimator func(tx []byte) (int64, error)
+
+// ErrBlockBudgetExceeded is returned by BlockBudget when a tx doesn't fit the
+// remaining bytes or gas of a block.
+var ErrBlockBudgetExceeded = errors.New("block budget exceeded")
+
+// BlockBudget accounts for the bytes and gas used by the txs of a block,
+// against the block's limits, e.g. the MaxBytes and MaxGas of a build request.
+// Like NewMempoolFallback, it counts raw tx sizes, which slightly
+// underestimate the encoded size of the block.
+type BlockBudget struct {
+	// MaxBytes and MaxGas are the limits of the block. Zero or negative
+	// values mean unlimited.
+	MaxBytes int64
+	MaxGas   int64
+
+	// Gas estimates the gas of each tx. If it's nil, gas isn't accounted
+	// for, and MaxGas is ignored.
+	Gas GasEstimator
+
+	// UsedBytes and UsedGas are the bytes and gas of the txs added so far.
+	UsedBytes int64
+	UsedGas   int64
+}
+
+// Add accounts for tx, if it fits the remaining budget. Otherwise, the budget
+// is unchanged, and it returns an error wrapping ErrBlockBudgetExceeded, or
+// the error of the gas estimator.
+func (bb *BlockBudget) Add(tx []byte) error {
+	size := int64(len(tx))
+	if bb.MaxBytes > 0 && bb.UsedBytes+size > bb.MaxBytes {
+		return fmt.Errorf("%w: %d bytes, %d of %d used", ErrBlockBudgetExceeded, size, bb.UsedBytes, bb.MaxBytes)
+	}
+
+	var gas int64
+	if bb.Gas != nil {
+		var err error
+		if gas, err = bb.Gas(tx); err != nil {
+			return fmt.Errorf("estimate gas: %w", err)
+		}
+		if gas < 0 {
+			return fmt.Errorf("estimate gas: negative gas %d", gas)
+		}
+		if bb.MaxGas > 0 && bb.UsedGas+gas > bb.MaxGas {
+			return fmt.Errorf("%w: %d gas, %d of %d used", ErrBlockBudgetExceeded, gas, bb.UsedGas, bb.MaxGas)
+		}
+	}
+
+	bb.UsedBytes += size
+	bb.UsedGas += gas
+	return nil
+}
@@ -0,0 +1,90 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestHashTxsMerkle(t *testing.T) {
+	var (
+		leaf = func(tx []byte) []byte {
+			s := sha256.Sum256(tx)
+			l := sha256.Sum256(append([]byte{0}, s[:]...))
+			return l[:]
+		}
+		inner = func(l, r []byte) []byte { s := sha256.Sum256(append(append([]byte{1}, l...), r...)); return s[:] }
+		a, b  = []byte("a"), []byte("b")
+		c     = []byte("c")
+	)
+
+	for _, tc := range []struct {
+		name string
+		txs  [][]byte
+		want []byte
+	}{
+		{"one", [][]byte{a}, leaf(a)},
+		{"two", [][]byte{a, b}, inner(leaf(a), leaf(b))},
+		{"three", [][]byte{a, b, c}, inner(inner(leaf(a), leaf(b)), leaf(c))},
+	} {
+		if have := mekabuild.HashTxsMerkle(tc.txs...); !bytes.Equal(tc.want, have) {
+			t.Errorf("%s: want %x, have %x", tc.name, tc.want, have)
+		}
+	}
+
+	// Large, odd-sized sets exercise the parallel path and odd promotion.
+	var split func(txs [][]byte) []byte
+	split = func(txs [][]byte) []byte {
+		if len(txs) == 1 {
+			return leaf(txs[0])
+		}
+		k := 1
+		for k*2 < len(txs) {
+			k *= 2
+		}
+		return inner(split(txs[:k]), split(txs[k:]))
+	}
+
+	txs := makeTxs(5001, 100)
+	if want, have := split(txs), mekabuild.HashTxsMerkle(txs...); !bytes.Equal(want, have) {
+		t.Errorf("5001 txs: want %x, have %x", want, have)
+	}
+}
+
+func TestBuildBlockRequestSignBytesVersion(t *testing.T) {
+	v0 := mekabuild.BuildBlockRequestSignBytes("chain", 1, "addr", 2, 3, []byte("hash"))
+	if want, have := v0, mekabuild.BuildBlockRequestSignBytesVersion(mekabuild.TxsHashSequential, "chain", 1, "addr", 2, 3, []byte("hash")); !bytes.Equal(want, have) {
+		t.Errorf("sequential version changed sign bytes")
+	}
+
+	if v1 := mekabuild.BuildBlockRequestSignBytesVersion(mekabuild.TxsHashMerkle, "chain", 1, "addr", 2, 3, []byte("hash")); bytes.Equal(v0, v1) {
+		t.Errorf("merkle version isn't domain separated")
+	}
+}
+
+func BenchmarkHashTxs(b *testing.B) {
+	for _, count := range []int{100, 10_000, 50_000} {
+		txs := makeTxs(count, 250)
+		b.Run(fmt.Sprintf("sequential/%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				mekabuild.HashTxs(txs...)
+			}
+		})
+		b.Run(fmt.Sprintf("merkle/%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				mekabuild.HashTxsMerkle(txs...)
+			}
+		})
+	}
+}
+
+func makeTxs(count, size int) [][]byte {
+	txs := make([][]byte, count)
+	for i := range txs {
+		txs[i] = bytes.Repeat([]byte{byte(i)}, size)
+	}
+	return txs
+}
@@ -0,0 +1,164 @@
+package mekabuild
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Health describes the state of a builder, for health checks.
+type Health struct {
+	Ready     bool        `json:"ready"`
+	ChainID   string      `json:"chain_id"`
+	LastBuild *BuildEvent `json:"last_build,omitempty"`
+
+	// Registration is the registration status of the validator, or
+	// RegistrationUnknown if it hasn't been determined.
+	Registration string `json:"registration"`
+
+	HealthyEndpoints int `json:"healthy_endpoints"`
+	TotalEndpoints   int `json:"total_endpoints"`
+
+	// CircuitOpen is true while the circuit breaker fails build requests
+	// fast, see SetCircuitBreaker.
+	CircuitOpen bool `json:"circuit_open"`
+
+	// Disabled is set while the builder is disabled, see Disable, and
+	// PausedUntil while the validator is paused, see Pause. SkippedBuilds
+	// counts the builds skipped while either was.
+	Disabled      *DisabledState `json:"disabled,omitempty"`
+	PausedUntil   *time.Time     `json:"paused_until,omitempty"`
+	SkippedBuilds uint64         `json:"skipped_builds,omitempty"`
+}
+
+// BuildEvent describes the outcome of a single build.
+type BuildEvent struct {
+	Time     time.Time     `json:"time"`
+	Height   int64         `json:"height"`
+	Endpoint string        `json:"endpoint"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Health returns the current health of the builder. A builder is ready when
+// at least one endpoint hasn't failed recently, and its circuit breaker isn't
+// open.
+func (b *Builder) Health() Health {
+	h := Health{
+		ChainID:      b.chainID,
+		Registration: RegistrationUnknown,
+	}
+
+	if status, ok := b.registration.Load().(string); ok {
+		h.Registration = status
+	}
+
+	if ev, ok := b.lastBuild.Load().(BuildEvent); ok {
+		h.LastBuild = &ev
+	}
+
+	for _, u := range b.endpoints.Load().([]*url.URL) {
+		h.TotalEndpoints++
+		if b.since(b.stats.lastFailure(endpointName(u))) >= FailoverCooldown {
+			h.HealthyEndpoints++
+		}
+	}
+
+	h.CircuitOpen = b.CircuitOpen()
+	if state, ok := b.Disabled(); ok {
+		h.Disabled = &state
+	}
+	if until, ok := b.PausedUntil(); ok {
+		until = until.UTC()
+		h.PausedUntil = &until
+	}
+	h.SkippedBuilds = atomic.LoadUint64(&b.skippedBuilds)
+	h.Ready = h.HealthyEndpoints > 0 && !h.CircuitOpen
+
+	return h
+}
+
+func (b *Builder) recordBuild(ev BuildEvent) {
+	b.lastBuild.Store(ev)
+	b.observeTelemetry(ev)
+}
+
+// HealthHandler returns an http.Handler reporting the builder's health,
+// intended to be mounted on the node's existing metrics or admin port for load
+// balancers and orchestrators. It responds with 200 when the builder is ready,
+// and 503 otherwise. The body is JSON, or Prometheus text exposition format if
+// the format=prometheus query parameter is given.
+func (b *Builder) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := b.Health()
+
+		code := http.StatusOK
+		if !h.Ready {
+			code = http.StatusServiceUnavailable
+		}
+
+		if r.URL.Query().Get("format") == "prometheus" {
+			w.Header().Set("content-type", "text/plain; version=0.0.4")
+			w.WriteHeader(code)
+			writeHealthGauges(w, h)
+			return
+		}
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(h)
+	})
+}
+
+func writeHealthGauges(w http.ResponseWriter, h Health) {
+	var (
+		labels    = fmt.Sprintf(`{chain_id=%q}`, h.ChainID)
+		lastOK    = 0
+		lastTime  float64
+		lastBuild float64
+	)
+	if h.LastBuild != nil {
+		if h.LastBuild.Error == "" {
+			lastOK = 1
+		}
+		lastTime = float64(h.LastBuild.Time.UnixNano()) / 1e9
+		lastBuild = h.LastBuild.Duration.Seconds()
+	}
+
+	var sb strings.Builder
+	gauge := func(name, help string, v float64) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s gauge\n%s%s %v\n", name, help, name, name, labels, v)
+	}
+	gauge("mekabuild_ready", "Whether the builder is ready.", boolFloat(h.Ready))
+	gauge("mekabuild_circuit_open", "Whether the circuit breaker is open.", boolFloat(h.CircuitOpen))
+	gauge("mekabuild_disabled", "Whether the builder is disabled by the operator.", boolFloat(h.Disabled != nil))
+	gauge("mekabuild_skipped_builds", "Number of builds skipped while the builder was disabled, or the validator paused.", float64(h.SkippedBuilds))
+	gauge("mekabuild_healthy_endpoints", "Number of builder API endpoints without recent failures.", float64(h.HealthyEndpoints))
+	gauge("mekabuild_last_build_success", "Whether the last build succeeded.", float64(lastOK))
+	gauge("mekabuild_last_build_timestamp_seconds", "Time of the last build.", lastTime)
+	gauge("mekabuild_last_build_duration_seconds", "Duration of the last build.", lastBuild)
+	gauge("mekabuild_registered", "Whether the validator is registered, or -1 if unknown.", registrationGauge(h.Registration))
+	w.Write([]byte(sb.String()))
+}
+
+func registrationGauge(status string) float64 {
+	switch status {
+	case RegistrationRegistered:
+		return 1
+	case RegistrationUnregistered:
+		return 0
+	default:
+		return -1
+	}
+}
+
+func boolFloat(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
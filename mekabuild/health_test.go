@@ -0,0 +1,56 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderHealthHandler(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", rand.Reader)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		handler   = builder.HealthHandler()
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 42, ValidatorAddress: key.addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if want, have := http.StatusOK, rec.Code; want != have {
+		t.Fatalf("status: want %d, have %d", want, have)
+	}
+
+	var h mekabuild.Health
+	if err := json.NewDecoder(rec.Body).Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+
+	if h.LastBuild == nil || h.LastBuild.Height != 42 || h.LastBuild.Error != "" {
+		t.Errorf("last build: want successful build at height 42, have %+v", h.LastBuild)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/?format=prometheus", nil))
+
+	if want, body := `mekabuild_last_build_success{chain_id="test-chain-id"} 1`, rec.Body.String(); !strings.Contains(body, want) {
+		t.Errorf("prometheus output missing %q\n%s", want, body)
+	}
+}
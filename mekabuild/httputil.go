@@ -2,28 +2,176 @@ package mekabuild
 
 import (
 	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 )
 
 // GunzipRequestMiddleware inspects the Content-Encoding header of the incoming
 // request. If it specifies a supported compression scheme i.e. gzip, the body
-// will be wrapped with a decompressor i.e. gzip.Reader.
+// will be decompressed. Decompressed bodies larger than
+// DefaultMaxDecompressedBytes are rejected with 413 Request Entity Too Large.
 func GunzipRequestMiddleware(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.Contains(r.Header.Get("content-encoding"), "gzip") {
-			zr, err := gzip.NewReader(r.Body)
-			if err != nil {
-				http.Error(w, fmt.Errorf("gzip reader: %w", err).Error(), http.StatusBadRequest)
+	return GunzipRequestMiddlewareLimit(DefaultMaxDecompressedBytes)(h)
+}
+
+// GunzipRequestMiddlewareLimit is like GunzipRequestMiddleware, but rejects
+// requests whose decompressed body exceeds maxBytes. The body is decompressed
+// as the wrapped handler reads it, so the middleware itself doesn't buffer it.
+// Once the handler reads past maxBytes, its read fails, and the request is
+// rejected with 413 Request Entity Too Large, unless the handler has already
+// responded.
+func GunzipRequestMiddlewareLimit(maxBytes int64) func(http.Handler) http.Handler {
+	gzipDefault := gzipCompressor{level: gzip.DefaultCompression}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.Contains(r.Header.Get("content-encoding"), "gzip") {
+				h.ServeHTTP(w, r)
+				return
+			}
+			decompressBody(w, r, h, gzipDefault, maxBytes)
+		})
+	}
+}
+
+// DecompressRequestMiddleware is like GunzipRequestMiddleware, but decodes
+// request bodies with any of the given compressors, by Content-Encoding, in
+// addition to gzip. Bodies with other encodings are rejected with 415
+// Unsupported Media Type.
+func DecompressRequestMiddleware(compressors ...Compressor) func(http.Handler) http.Handler {
+	return DecompressRequestMiddlewareLimit(DefaultMaxDecompressedBytes, compressors...)
+}
+
+// DecompressRequestMiddlewareLimit is like DecompressRequestMiddleware, but
+// rejects requests whose decompressed body exceeds maxBytes. See
+// GunzipRequestMiddlewareLimit.
+func DecompressRequestMiddlewareLimit(maxBytes int64, compressors ...Compressor) func(http.Handler) http.Handler {
+	byEncoding := map[string]Compressor{"gzip": gzipCompressor{level: gzip.DefaultCompression}}
+	for _, c := range compressors {
+		byEncoding[c.Encoding()] = c
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.TrimSpace(strings.ToLower(r.Header.Get("content-encoding")))
+			if encoding == "" || encoding == "identity" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			c, ok := byEncoding[encoding]
+			if !ok {
+				http.Error(w, fmt.Sprintf("unsupported content encoding %q", encoding), http.StatusUnsupportedMediaType)
 				return
 			}
-			r.Body = zr
-		}
-		h.ServeHTTP(w, r)
-	})
+
+			decompressBody(w, r, h, c, maxBytes)
+		})
+	}
+}
+
+// decompressBody invokes h with the request body decoded by c, or responds
+// with an error.
+func decompressBody(w http.ResponseWriter, r *http.Request, h http.Handler, c Compressor, maxBytes int64) {
+	encoding := c.Encoding()
+
+	zr, err := c.NewReader(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Errorf("%s reader: %w", encoding, err).Error(), http.StatusBadRequest)
+		return
+	}
+	defer zr.Close()
+
+	lw := &limitResponseWriter{ResponseWriter: w}
+	r.Body = &limitBody{r: zr, c: r.Body, remaining: maxBytes, max: maxBytes, w: lw}
+	r.ContentLength = -1
+	r.Header.Del("content-encoding")
+	h.ServeHTTP(lw, r)
+}
+
+// errBodyTooLarge is returned by reads past the decompressed body limit.
+var errBodyTooLarge = errors.New("decompressed body too large")
+
+// limitBody is a decompressed request body, like http.MaxBytesReader. Once
+// it's read past its limit, it rejects the request with 413, and every read
+// fails.
+type limitBody struct {
+	r         io.Reader
+	c         io.Closer
+	remaining int64
+	max       int64
+	w         *limitResponseWriter
 }
 
+func (b *limitBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1] // one more byte tells exactly max from too large
+	}
+
+	n, err := b.r.Read(p)
+	if int64(n) > b.remaining {
+		n, b.remaining = int(b.remaining), -1
+		b.w.reject(fmt.Sprintf("decompressed body exceeds %d bytes", b.max), http.StatusRequestEntityTooLarge)
+		return n, errBodyTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitBody) Close() error {
+	return b.c.Close()
+}
+
+// limitResponseWriter lets limitBody reject a request, if the handler hasn't
+// responded yet. Once rejected, the handler's response is discarded.
+type limitResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	rejected    bool
+}
+
+func (w *limitResponseWriter) reject(msg string, code int) {
+	if !w.wroteHeader {
+		http.Error(w.ResponseWriter, msg, code)
+		w.rejected = true
+	}
+}
+
+func (w *limitResponseWriter) WriteHeader(code int) {
+	if w.rejected || w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *limitResponseWriter) Write(p []byte) (int, error) {
+	if w.rejected {
+		return len(p), nil
+	}
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, for streaming handlers.
+func (w *limitResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.rejected {
+		f.Flush()
+	}
+}
+
+// DefaultMaxDecompressedBytes is the decompressed body size limit applied by
+// GunzipRequestMiddleware, and by decoders of compressed or binary bodies. It
+// exceeds the JSON encoding of a block at Tendermint's default max_bytes of
+// 21 MiB. Chains with larger blocks can raise it on the server with
+// GunzipRequestMiddlewareLimit.
+const DefaultMaxDecompressedBytes = 32 << 20
+
 // UserAgentDecorator sets the given User-Agent header on outgoing requests.
 // It's intended to decorate the HTTP client provided to the builder.
 func UserAgentDecorator(userAgent string) func(http.RoundTripper) http.RoundTripper {
@@ -0,0 +1,87 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestGunzipRequestMiddlewareLimit(t *testing.T) {
+	var received []byte
+	h := mekabuild.GunzipRequestMiddlewareLimit(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	}))
+
+	for _, tc := range []struct {
+		name string
+		size int
+		want int
+	}{
+		{"small", 1000, http.StatusOK},
+		{"exact", 1024, http.StatusOK},
+		{"bomb", 10 << 20, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			received = nil
+
+			var body bytes.Buffer
+			zw := gzip.NewWriter(&body)
+			zw.Write(bytes.Repeat([]byte{'a'}, tc.size))
+			zw.Close()
+
+			req := httptest.NewRequest("POST", "/", &body)
+			req.Header.Set("content-encoding", "gzip")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if want, have := tc.want, rec.Code; want != have {
+				t.Fatalf("status: want %d, have %d", want, have)
+			}
+
+			if tc.want == http.StatusOK && len(received) != tc.size {
+				t.Fatalf("body size: want %d, have %d", tc.size, len(received))
+			}
+		})
+	}
+}
+
+// TestGunzipRequestMiddlewareStreams isn't parallel, so that it measures only
+// its own allocations.
+func TestGunzipRequestMiddlewareStreams(t *testing.T) {
+	const size = 64 << 20
+
+	var received int64
+	h := mekabuild.GunzipRequestMiddlewareLimit(size)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.Copy(io.Discard, r.Body)
+	}))
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write(make([]byte, size))
+	zw.Close()
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("content-encoding", "gzip")
+	rec := httptest.NewRecorder()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	h.ServeHTTP(rec, req)
+	runtime.ReadMemStats(&after)
+
+	if want, have := http.StatusOK, rec.Code; want != have {
+		t.Fatalf("status: want %d, have %d", want, have)
+	}
+	if want, have := int64(size), received; want != have {
+		t.Fatalf("body size: want %d, have %d", want, have)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 4<<20 {
+		t.Errorf("allocated %d bytes for a %d byte body", allocated, size)
+	}
+}
@@ -0,0 +1,186 @@
+package mekabuild
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// With Interchain Security (ICS), validators of a provider chain, e.g. the
+// Cosmos Hub, also validate its consumer chains. A validator either uses its
+// provider chain consensus key on a consumer chain, or a key assigned to it
+// for that chain. Either way, it's known to the builder API by its provider
+// chain validator, so the builder of a consumer chain can register and sign
+// with the provider chain key, rather than holding another key for the
+// builder API per consumer chain.
+//
+// Requests signed with the provider chain key identify the provider chain and
+// the consumer chain, which are bound to the signature, so a signature for a
+// consumer chain can't be used for the provider chain, or another consumer
+// chain. Registration additionally identifies the provider chain validator,
+// which lets the builder API verify the key assignment against provider
+// chain state. Consumer chains require CapabilityConsumerChains. See
+// SetConsumerChain.
+
+// ConsumerChain identifies the provider chain validator that signs for a
+// consumer chain validator.
+type ConsumerChain struct {
+	// ProviderChainID is the chain ID of the provider chain, e.g.
+	// "cosmoshub-4".
+	ProviderChainID string
+
+	// ConsumerID identifies the consumer chain on the provider chain. It's
+	// optional for provider chains that identify consumer chains by chain
+	// ID.
+	ConsumerID string
+
+	// ProviderAddress is the consensus address of the validator on the
+	// provider chain, whose key signs requests. See KeyAssignments.
+	ProviderAddress string
+}
+
+// Validate checks that the provider chain ID and address are set, and that
+// the address is a consensus address.
+func (c ConsumerChain) Validate() error {
+	if c.ProviderChainID == "" {
+		return errors.New("provider chain ID must not be empty")
+	}
+	if c.ProviderAddress == "" {
+		return errors.New("provider address must not be empty")
+	}
+	if _, err := NormalizeValidatorAddress(c.ProviderAddress); err != nil {
+		return fmt.Errorf("provider address: %w", err)
+	}
+	return nil
+}
+
+// ErrConsumerChainsUnsupported is returned when the builder is configured for
+// a consumer chain, and the builder API doesn't support
+// CapabilityConsumerChains.
+var ErrConsumerChainsUnsupported = errors.New("builder API doesn't support consumer chains")
+
+// bindConsumerChain binds the provider chain ID and consumer ID to sign bytes.
+// Requests that aren't for a consumer chain produce the original sign bytes.
+func bindConsumerChain(providerChainID, consumerID string, signBytes []byte) []byte {
+	if providerChainID == "" && consumerID == "" {
+		return signBytes
+	}
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`ics-consumer-`))
+	mustEncode(&sb, uint64(len([]byte(providerChainID))))
+	mustEncode(&sb, []byte(providerChainID))
+	mustEncode(&sb, uint64(len([]byte(consumerID))))
+	mustEncode(&sb, []byte(consumerID))
+	mustEncode(&sb, signBytes)
+	return sb.Bytes()
+}
+
+// SetConsumerChain configures the builder to build blocks for a consumer chain
+// with the key of the provider chain validator, which must be the key of the
+// builder's signer. The builder's validator address remains the validator's
+// address on the consumer chain. Changing it requires registering again. A
+// zero c, the default, means the builder's chain isn't a consumer chain.
+func (b *Builder) SetConsumerChain(c ConsumerChain) error {
+	if c != (ConsumerChain{}) {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+		c.ProviderAddress, _ = NormalizeValidatorAddress(c.ProviderAddress)
+	}
+	b.consumerChain.Store(c)
+	return nil
+}
+
+// WithConsumerChain configures the builder for a consumer chain. See
+// SetConsumerChain.
+func WithConsumerChain(c ConsumerChain) Option {
+	return func(b *Builder) error {
+		return b.SetConsumerChain(c)
+	}
+}
+
+// ConsumerChain returns the builder's consumer chain configuration, and false
+// if the builder's chain isn't a consumer chain.
+func (b *Builder) ConsumerChain() (ConsumerChain, bool) {
+	c, _ := b.consumerChain.Load().(ConsumerChain)
+	return c, c != (ConsumerChain{})
+}
+
+// checkConsumerChain returns ErrConsumerChainsUnsupported if the builder is
+// configured for a consumer chain, and the negotiated capabilities exclude
+// consumer chains.
+func (b *Builder) checkConsumerChain() error {
+	if _, ok := b.ConsumerChain(); !ok {
+		return nil
+	}
+	if caps, ok := b.Capabilities(); ok && !caps.Has(CapabilityConsumerChains) {
+		return ErrConsumerChainsUnsupported
+	}
+	return nil
+}
+
+// setConsumerChain identifies the consumer chain in the request, if the
+// builder is configured for one, and the caller hasn't done so already.
+func (b *Builder) setConsumerChain(req *BuildBlockRequest) error {
+	c, ok := b.ConsumerChain()
+	if !ok || req.ProviderChainID != "" || req.ConsumerID != "" {
+		return nil
+	}
+	if err := b.checkConsumerChain(); err != nil {
+		return err
+	}
+	req.ProviderChainID, req.ConsumerID = c.ProviderChainID, c.ConsumerID
+	return nil
+}
+
+// KeyAssignments maps the consensus addresses of provider chain validators to
+// the consensus addresses of the keys assigned to them on a consumer chain,
+// e.g. from the provider chain's validator-consumer-key queries. Validators
+// without an assignment use their provider chain key on the consumer chain,
+// so their consumer chain address is their provider chain address. Addresses
+// may be hex or Bech32 consensus addresses.
+type KeyAssignments map[string]string
+
+// ConsumerAddress returns the hex consensus address of the provider chain
+// validator on the consumer chain.
+func (ka KeyAssignments) ConsumerAddress(providerAddr string) (string, error) {
+	providerAddr, err := NormalizeValidatorAddress(providerAddr)
+	if err != nil {
+		return "", err
+	}
+	for provider, consumer := range ka {
+		if p, err := NormalizeValidatorAddress(provider); err == nil && p == providerAddr {
+			return NormalizeValidatorAddress(consumer)
+		}
+	}
+	return providerAddr, nil
+}
+
+// ProviderAddress returns the hex consensus address on the provider chain of
+// the consumer chain validator. A consumer chain address that's the provider
+// chain address of a validator with an assigned key doesn't identify any
+// validator, and returns an error.
+func (ka KeyAssignments) ProviderAddress(consumerAddr string) (string, error) {
+	consumerAddr, err := NormalizeValidatorAddress(consumerAddr)
+	if err != nil {
+		return "", err
+	}
+	for provider, consumer := range ka {
+		p, err := NormalizeValidatorAddress(provider)
+		if err != nil {
+			return "", err
+		}
+		c, err := NormalizeValidatorAddress(consumer)
+		if err != nil {
+			return "", err
+		}
+		switch consumerAddr {
+		case c:
+			return p, nil
+		case p:
+			return "", fmt.Errorf("validator %s uses an assigned key on the consumer chain", p)
+		}
+	}
+	return consumerAddr, nil
+}
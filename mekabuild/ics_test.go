@@ -0,0 +1,200 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestConsumerChain(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx             = context.Background()
+		providerChainID = "provider-1"
+		consumerChainID = "consumer-1"
+		providerAddr    = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+		consumerAddr    = "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB"
+		key             = newMockKey(t, providerAddr, nil)
+		api             = newMockAPI()
+		server          = newTestServer(t, api)
+		apiURL, _       = url.Parse(server.URL)
+		consumer        = mekabuild.ConsumerChain{ProviderChainID: providerChainID, ConsumerID: "7", ProviderAddress: providerAddr}
+		newReq          = func(height int64) *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: consumerChainID, Height: height, ValidatorAddress: consumerAddr, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+	api.AddPublicKey(providerChainID, providerAddr, key.PublicKey)
+	api.AddConsumerChain(consumerChainID, providerChainID, "7")
+	api.AssignConsumerKey(consumerChainID, providerAddr, consumerAddr)
+	api.RequireFreshRequests(time.Minute) // advertises CapabilityConsumerChains
+
+	builder, err := mekabuild.New(key, consumerChainID, consumerAddr, mekabuild.WithEndpoints(apiURL), mekabuild.WithConsumerChain(consumer), mekabuild.WithConfirmBuilds(true), mekabuild.WithReplayProtection(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := builder.Apply(ctx, "payment-address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.Register(ctx, "payment-address", applied.Challenge, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := api.Registered(consumerChainID, consumerAddr); !ok {
+		t.Fatalf("consumer chain validator isn't registered")
+	}
+
+	if _, err := builder.BuildBlock(ctx, newReq(1)); err != nil {
+		t.Fatal(err)
+	}
+	if builds := api.Builds(); len(builds) != 1 || builds[0].ProviderChainID != providerChainID || builds[0].ConsumerID != "7" {
+		t.Errorf("builds: want 1 for consumer chain, have %+v", builds)
+	}
+	if _, ok := api.Confirmed(consumerChainID, consumerAddr, 1); !ok {
+		t.Errorf("build wasn't confirmed")
+	}
+
+	// Requests for another consumer chain are rejected.
+	other, err := mekabuild.New(key, consumerChainID, consumerAddr, mekabuild.WithEndpoints(apiURL), mekabuild.WithConsumerChain(mekabuild.ConsumerChain{ProviderChainID: providerChainID, ConsumerID: "8", ProviderAddress: providerAddr}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.BuildBlock(ctx, newReq(2)); err == nil || !strings.Contains(err.Error(), "consumer chain") {
+		t.Errorf("other consumer chain: want consumer chain error, have %v", err)
+	}
+
+	// Registration with the wrong provider chain validator is rejected.
+	if err := other.SetConsumerChain(mekabuild.ConsumerChain{ProviderChainID: providerChainID, ConsumerID: "7", ProviderAddress: consumerAddr}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Apply(ctx, "payment-address"); err == nil || !strings.Contains(err.Error(), "provider address") {
+		t.Errorf("wrong provider address: want provider address error, have %v", err)
+	}
+}
+
+func TestConsumerChainUnsupported(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx    = context.Background()
+		key    = newMockKey(t, "validator", nil)
+		api    = newMockAPI()
+		server = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(mekabuild.CapabilitiesHeader, mekabuild.CapabilityProto.String())
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+	)
+	api.AddPublicKey("chain-id", key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, "chain-id", key.addr, mekabuild.WithEndpoints(apiURL), mekabuild.WithConsumerChain(mekabuild.ConsumerChain{ProviderChainID: "provider-1", ProviderAddress: key.addr}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.Ping(ctx); err != nil { // negotiate
+		t.Fatal(err)
+	}
+	if _, err := builder.Apply(ctx, "payment-address"); !errors.Is(err, mekabuild.ErrConsumerChainsUnsupported) {
+		t.Errorf("apply: want %v, have %v", mekabuild.ErrConsumerChainsUnsupported, err)
+	}
+	req := &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}
+	if _, err := builder.BuildBlock(ctx, req); !errors.Is(err, mekabuild.ErrConsumerChainsUnsupported) {
+		t.Errorf("build: want %v, have %v", mekabuild.ErrConsumerChainsUnsupported, err)
+	}
+}
+
+func TestConsumerChainSignBytes(t *testing.T) {
+	t.Parallel()
+
+	key := newMockKey(t, "validator", nil)
+	req := &mekabuild.BuildBlockRequest{ChainID: "consumer-1", Height: 1, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}
+	plain, err := req.SignBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.ProviderChainID, req.ConsumerID = "provider-1", "7"
+	bound, err := req.SignBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bound) == string(plain) {
+		t.Fatalf("consumer chain isn't bound to the sign bytes")
+	}
+	if !mekabuild.IsValidatorSignBytes(bound) {
+		t.Errorf("consumer chain sign bytes aren't validator sign bytes")
+	}
+
+	if err := key.SignBuildBlockRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := mekabuild.VerifyBuildBlockRequest(req, key.PublicKey); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	req.ConsumerID = "8"
+	if err := mekabuild.VerifyBuildBlockRequest(req, key.PublicKey); !errors.Is(err, mekabuild.ErrBadSignature) {
+		t.Errorf("verify with another consumer ID: want %v, have %v", mekabuild.ErrBadSignature, err)
+	}
+}
+
+func TestKeyAssignments(t *testing.T) {
+	t.Parallel()
+
+	var (
+		provider = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		assigned = "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB"
+		same     = "CCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCC"
+		ka       = mekabuild.KeyAssignments{provider: assigned}
+	)
+
+	if have, err := ka.ConsumerAddress(provider); err != nil || have != assigned {
+		t.Errorf("consumer address of assigned: want %s, have %s, %v", assigned, have, err)
+	}
+	if have, err := ka.ConsumerAddress(same); err != nil || have != same {
+		t.Errorf("consumer address of unassigned: want %s, have %s, %v", same, have, err)
+	}
+	if have, err := ka.ProviderAddress(strings.ToLower(assigned)); err != nil || have != strings.ToUpper(provider) {
+		t.Errorf("provider address of assigned: want %s, have %s, %v", strings.ToUpper(provider), have, err)
+	}
+	if have, err := ka.ProviderAddress(same); err != nil || have != same {
+		t.Errorf("provider address of unassigned: want %s, have %s, %v", same, have, err)
+	}
+	if _, err := ka.ProviderAddress(provider); err == nil {
+		t.Errorf("provider address of replaced key: want error, have none")
+	}
+
+	bech32, err := mekabuild.ConsensusAddressToBech32("cosmosvalcons", assigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, err := ka.ProviderAddress(bech32); err != nil || have != strings.ToUpper(provider) {
+		t.Errorf("provider address of Bech32: want %s, have %s, %v", strings.ToUpper(provider), have, err)
+	}
+	operator, err := mekabuild.ConsensusAddressToBech32("cosmosvaloper", provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ka.ConsumerAddress(operator); err == nil {
+		t.Errorf("consumer address of operator address: want error, have none")
+	}
+}
+
+func TestConsumerChainValidate(t *testing.T) {
+	t.Parallel()
+
+	key := newMockKey(t, "validator", nil)
+	for _, c := range []mekabuild.ConsumerChain{
+		{ConsumerID: "7", ProviderAddress: key.addr},
+		{ProviderChainID: "provider-1"},
+	} {
+		if _, err := mekabuild.New(key, "consumer-1", key.addr, mekabuild.WithConsumerChain(c)); err == nil {
+			t.Errorf("%+v: want error, have none", c)
+		}
+	}
+}
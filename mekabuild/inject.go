@@ -0,0 +1,240 @@
+package mekabuild
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// TxPosition is a preference for where in the block a transaction is placed.
+type TxPosition string
+
+// Known transaction positions.
+const (
+	TxPositionAny    TxPosition = ""       // anywhere in the block
+	TxPositionTop    TxPosition = "top"    // before any other transaction
+	TxPositionBottom TxPosition = "bottom" // after any other transaction
+)
+
+// MandatoryTx is a transaction that the builder API must include in the block,
+// at the given position. Mandatory transactions are covered by the request
+// signature.
+type MandatoryTx struct {
+	Tx       []byte     `json:"tx"`
+	Position TxPosition `json:"position,omitempty"`
+}
+
+// InjectedTx is a transaction that the application adds to the submitted set,
+// e.g. an operator rebalancing tx.
+type InjectedTx struct {
+	Tx []byte
+
+	// Mandatory guarantees inclusion. Mandatory txs are sent to the builder
+	// API as MandatoryTxs, and responses that don't include them at the
+	// preferred position are rejected, see VerifyMandatoryTxs. Otherwise,
+	// the tx is added to Txs, and competes with every other tx.
+	Mandatory bool
+
+	// Position is the preferred position of the tx. It's only binding for
+	// mandatory txs.
+	Position TxPosition
+}
+
+var (
+	// ErrMandatoryTxsMissing is returned when a build response doesn't
+	// include the request's mandatory txs at their preferred positions.
+	ErrMandatoryTxsMissing = errors.New("mandatory txs missing from response")
+
+	// ErrMandatoryTxsUnsupported is returned when a request has mandatory
+	// txs, and the builder API doesn't support CapabilityMandatoryTxs.
+	ErrMandatoryTxsUnsupported = errors.New("builder API doesn't support mandatory txs")
+)
+
+// WithInjectedTxs returns a context carrying transactions to inject into the
+// build request. Injected txs accumulate, so nested calls add to, rather than
+// replace, the txs injected by the parent context.
+//
+// BuildBlock adds the injected txs to the request before signing it. If the
+// request fails, and a fallback is set, mandatory txs are also placed in the
+// fallback block, see PlaceMandatoryTxs.
+func WithInjectedTxs(ctx context.Context, txs ...InjectedTx) context.Context {
+	parent := injectedTxsFrom(ctx)
+	all := make([]InjectedTx, 0, len(parent)+len(txs))
+	all = append(all, parent...)
+	all = append(all, txs...)
+	return context.WithValue(ctx, injectedTxsKey{}, all)
+}
+
+type injectedTxsKey struct{}
+
+func injectedTxsFrom(ctx context.Context) []InjectedTx {
+	txs, _ := ctx.Value(injectedTxsKey{}).([]InjectedTx)
+	return txs
+}
+
+// injectTxs adds the txs injected via the context to the request. Optional
+// txs are placed in Txs at their preferred positions, and mandatory txs are
+// added to MandatoryTxs.
+func injectTxs(ctx context.Context, req *BuildBlockRequest) error {
+	injected := injectedTxsFrom(ctx)
+	if len(injected) == 0 {
+		return nil
+	}
+
+	var optional []MandatoryTx
+	for _, itx := range injected {
+		if err := itx.Position.validate(); err != nil {
+			return err
+		}
+		mtx := MandatoryTx{Tx: itx.Tx, Position: itx.Position}
+		switch {
+		case !itx.Mandatory:
+			optional = append(optional, mtx)
+		case !containsMandatoryTx(req.MandatoryTxs, itx.Tx):
+			req.MandatoryTxs = append(req.MandatoryTxs, mtx)
+		}
+	}
+
+	if len(optional) > 0 {
+		req.Txs = PlaceMandatoryTxs(req.Txs, optional)
+	}
+	return nil
+}
+
+func (p TxPosition) validate() error {
+	switch p {
+	case TxPositionAny, TxPositionTop, TxPositionBottom:
+		return nil
+	default:
+		return fmt.Errorf("invalid tx position %q", p)
+	}
+}
+
+func containsMandatoryTx(mandatory []MandatoryTx, tx []byte) bool {
+	for _, mtx := range mandatory {
+		if bytes.Equal(mtx.Tx, tx) {
+			return true
+		}
+	}
+	return false
+}
+
+// PlaceMandatoryTxs returns txs with the mandatory txs placed at their
+// preferred positions: top txs first, followed by txs without a preference,
+// the remaining txs, and finally bottom txs. Mandatory txs keep their relative
+// order, and are removed from their original position in txs, if present.
+//
+// It's used by the Builder to place mandatory txs in fallback blocks, and can
+// be used by builder API implementations.
+func PlaceMandatoryTxs(txs [][]byte, mandatory []MandatoryTx) [][]byte {
+	if len(mandatory) == 0 {
+		return txs
+	}
+
+	var top, anywhere, bottom [][]byte
+	for _, mtx := range mandatory {
+		switch mtx.Position {
+		case TxPositionTop:
+			top = append(top, mtx.Tx)
+		case TxPositionBottom:
+			bottom = append(bottom, mtx.Tx)
+		default:
+			anywhere = append(anywhere, mtx.Tx)
+		}
+	}
+
+	placed := make([][]byte, 0, len(txs)+len(mandatory))
+	placed = append(placed, top...)
+	placed = append(placed, anywhere...)
+	for _, tx := range txs {
+		if !containsMandatoryTx(mandatory, tx) {
+			placed = append(placed, tx)
+		}
+	}
+	placed = append(placed, bottom...)
+	return placed
+}
+
+// VerifyMandatoryTxs returns ErrMandatoryTxsMissing unless txs include every
+// mandatory tx at its preferred position. Top txs must be the first txs, and
+// bottom txs the last, each in the order given. Txs without a preference may
+// be anywhere.
+func VerifyMandatoryTxs(mandatory []MandatoryTx, txs [][]byte) error {
+	var top, bottom [][]byte
+	for _, mtx := range mandatory {
+		switch mtx.Position {
+		case TxPositionTop:
+			top = append(top, mtx.Tx)
+		case TxPositionBottom:
+			bottom = append(bottom, mtx.Tx)
+		default:
+			if !containsTx(txs, mtx.Tx) {
+				return fmt.Errorf("%w: tx %X not included", ErrMandatoryTxsMissing, HashTxs(mtx.Tx))
+			}
+		}
+	}
+
+	if len(top)+len(bottom) > len(txs) {
+		return fmt.Errorf("%w: have %d txs, want at least %d", ErrMandatoryTxsMissing, len(txs), len(top)+len(bottom))
+	}
+	for i, tx := range top {
+		if !bytes.Equal(txs[i], tx) {
+			return fmt.Errorf("%w: tx %X not at top position %d", ErrMandatoryTxsMissing, HashTxs(tx), i)
+		}
+	}
+	offset := len(txs) - len(bottom)
+	for i, tx := range bottom {
+		if !bytes.Equal(txs[offset+i], tx) {
+			return fmt.Errorf("%w: tx %X not at bottom position %d", ErrMandatoryTxsMissing, HashTxs(tx), i)
+		}
+	}
+	return nil
+}
+
+func containsTx(txs [][]byte, tx []byte) bool {
+	for _, t := range txs {
+		if bytes.Equal(t, tx) {
+			return true
+		}
+	}
+	return false
+}
+
+// bindMandatoryTxs prefixes sign bytes with the request's mandatory txs.
+// Requests without mandatory txs produce the original sign bytes.
+func bindMandatoryTxs(mandatory []MandatoryTx, signBytes []byte) []byte {
+	if len(mandatory) == 0 {
+		return signBytes
+	}
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`mandatory-txs-`))
+	mustEncode(&sb, uint64(len(mandatory)))
+	for _, mtx := range mandatory {
+		mustEncode(&sb, uint64(len([]byte(mtx.Position))))
+		mustEncode(&sb, []byte(mtx.Position))
+		mustEncode(&sb, uint64(len(mtx.Tx)))
+		mustEncode(&sb, mtx.Tx)
+	}
+	mustEncode(&sb, signBytes)
+	return sb.Bytes()
+}
+
+// checkMandatoryTxs returns ErrMandatoryTxsUnsupported if the request has
+// mandatory txs, and the negotiated capabilities exclude them. Before
+// negotiation, requests are sent optimistically, and responses are verified.
+func (b *Builder) checkMandatoryTxs(req *BuildBlockRequest) error {
+	if len(req.MandatoryTxs) == 0 {
+		return nil
+	}
+	if caps, ok := b.Capabilities(); ok && !caps.Has(CapabilityMandatoryTxs) {
+		return ErrMandatoryTxsUnsupported
+	}
+	for _, mtx := range req.MandatoryTxs {
+		if err := mtx.Position.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderInjectedTxs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		chainID  = "chain-id"
+		key      = newMockKey(t, "validator", nil)
+		api      = newMockAPI()
+		received = make(chan *mekabuild.BuildBlockRequest, 10)
+		server   = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			var req mekabuild.BuildBlockRequest
+			if err := json.Unmarshal(body, &req); err == nil {
+				received <- &req
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	ctx := mekabuild.WithInjectedTxs(context.Background(),
+		mekabuild.InjectedTx{Tx: []byte("rebalance"), Mandatory: true, Position: mekabuild.TxPositionTop},
+		mekabuild.InjectedTx{Tx: []byte("settle"), Mandatory: true, Position: mekabuild.TxPositionBottom},
+	)
+	ctx = mekabuild.WithInjectedTxs(ctx, mekabuild.InjectedTx{Tx: []byte("optional"), Position: mekabuild.TxPositionTop})
+
+	resp, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{
+		ChainID:          chainID,
+		Height:           1,
+		ValidatorAddress: key.addr,
+		MaxBytes:         1000,
+		MaxGas:           -1,
+		Txs:              [][]byte{[]byte("a"), []byte("b")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]byte{[]byte("rebalance"), []byte("optional"), []byte("a"), []byte("b"), []byte("settle")}
+	if have := resp.Txs; !reflect.DeepEqual(want, have) {
+		t.Errorf("txs: want %q, have %q", want, have)
+	}
+
+	req := <-received
+	if want, have := [][]byte{[]byte("optional"), []byte("a"), []byte("b")}, req.Txs; !reflect.DeepEqual(want, have) {
+		t.Errorf("request txs: want %q, have %q", want, have)
+	}
+	if want, have := 2, len(req.MandatoryTxs); want != have {
+		t.Fatalf("request mandatory txs: want %d, have %d", want, have)
+	}
+
+	tampered := *req
+	tampered.MandatoryTxs = tampered.MandatoryTxs[:1]
+	if err := mekabuild.VerifyBuildBlockRequest(&tampered, key.PublicKey); !errors.Is(err, mekabuild.ErrBadSignature) {
+		t.Errorf("tampered mandatory txs: want %v, have %v", mekabuild.ErrBadSignature, err)
+	}
+}
+
+func TestBuilderMandatoryTxsMissing(t *testing.T) {
+	t.Parallel()
+
+	var (
+		chainID = "chain-id"
+		key     = newMockKey(t, "validator", nil)
+		server  = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req mekabuild.BuildBlockRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(mekabuild.BuildBlockResponse{Txs: req.Txs, ValidatorPayment: "1uatom"})
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		ctx       = mekabuild.WithInjectedTxs(context.Background(), mekabuild.InjectedTx{Tx: []byte("rebalance"), Mandatory: true})
+		newReq    = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1, Txs: [][]byte{[]byte("a")}}
+		}
+	)
+
+	if _, err := builder.BuildBlock(ctx, newReq()); !errors.Is(err, mekabuild.ErrMandatoryTxsMissing) {
+		t.Fatalf("want %v, have %v", mekabuild.ErrMandatoryTxsMissing, err)
+	}
+
+	builder.SetFallback(mekabuild.NewMempoolFallback(nil))
+
+	resp, err := builder.BuildBlock(ctx, newReq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Fallback {
+		t.Errorf("response not marked as fallback")
+	}
+	if want, have := [][]byte{[]byte("rebalance"), []byte("a")}, resp.Txs; !reflect.DeepEqual(want, have) {
+		t.Errorf("fallback txs: want %q, have %q", want, have)
+	}
+}
+
+func TestVerifyMandatoryTxs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		top      = mekabuild.MandatoryTx{Tx: []byte("top"), Position: mekabuild.TxPositionTop}
+		bottom   = mekabuild.MandatoryTx{Tx: []byte("bottom"), Position: mekabuild.TxPositionBottom}
+		anywhere = mekabuild.MandatoryTx{Tx: []byte("any")}
+		txs      = func(ss ...string) [][]byte {
+			var txs [][]byte
+			for _, s := range ss {
+				txs = append(txs, []byte(s))
+			}
+			return txs
+		}
+	)
+
+	for _, tc := range []struct {
+		name      string
+		mandatory []mekabuild.MandatoryTx
+		txs       [][]byte
+		wantErr   bool
+	}{
+		{"none", nil, txs("a"), false},
+		{"placed", []mekabuild.MandatoryTx{top, anywhere, bottom}, txs("top", "a", "any", "bottom"), false},
+		{"top not first", []mekabuild.MandatoryTx{top}, txs("a", "top"), true},
+		{"bottom not last", []mekabuild.MandatoryTx{bottom}, txs("bottom", "a"), true},
+		{"any missing", []mekabuild.MandatoryTx{anywhere}, txs("a"), true},
+		{"too few txs", []mekabuild.MandatoryTx{top, bottom}, txs("top"), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := mekabuild.VerifyMandatoryTxs(tc.mandatory, tc.txs)
+			if want, have := tc.wantErr, errors.Is(err, mekabuild.ErrMandatoryTxsMissing); want != have {
+				t.Errorf("want error %v, have %v", want, err)
+			}
+
+			placed := mekabuild.PlaceMandatoryTxs(tc.txs, tc.mandatory)
+			if err := mekabuild.VerifyMandatoryTxs(tc.mandatory, placed); err != nil {
+				t.Errorf("placed txs: %v", err)
+			}
+		})
+	}
+}
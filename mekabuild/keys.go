@@ -0,0 +1,110 @@
+package mekabuild
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+)
+
+// Key types supported for validator signatures.
+const (
+	KeyTypeEd25519   = "ed25519"
+	KeyTypeSecp256k1 = "secp256k1"
+)
+
+// VerifySignature verifies a signature over msg by a key of the given type.
+// Ed25519 public keys are 32 bytes. Secp256k1 public keys are 33 bytes in
+// compressed form, and signatures are 64 byte r || s over the sha256 of msg,
+// with low s, as produced by Tendermint's secp256k1 private validators.
+func VerifySignature(keyType string, publicKey, msg, sig []byte) (bool, error) {
+	switch keyType {
+	case "", KeyTypeEd25519:
+		if len(publicKey) != ed25519.PublicKeySize {
+			return false, fmt.Errorf("invalid ed25519 public key size %d", len(publicKey))
+		}
+		return ed25519.Verify(publicKey, msg, sig), nil
+	case KeyTypeSecp256k1:
+		if len(publicKey) != 33 {
+			return false, fmt.Errorf("invalid secp256k1 public key size %d", len(publicKey))
+		}
+		return verifySecp256k1(publicKey, msg, sig), nil
+	default:
+		return false, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
+
+// VerifyBuildBlockRequest verifies the signature of the request against the
+// validator's public key, honoring the request's key type and txs hash version.
+// Presigned requests are verified against the validator's presignature, and
+// the session key's signature over the txs.
+func VerifyBuildBlockRequest(req *BuildBlockRequest, publicKey []byte) error {
+	if req.Presign != nil {
+		return verifyPresigned(req, publicKey)
+	}
+
+	msg, err := req.SignBytes()
+	if err != nil {
+		return err
+	}
+
+	ok, err := VerifySignature(req.KeyType, publicKey, msg, req.Signature)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrBadSignature
+	}
+
+	return nil
+}
+
+// ErrBadSignature is returned when a signature doesn't verify.
+var ErrBadSignature = errors.New("bad signature")
+
+// validatorSignBytesDomains are the prefixes of every payload signed by a
+// validator key for the builder API.
+var validatorSignBytesDomains = []string{
+	`build-block-request`,
+	`presigned-build-block-request`,
+	`versioned-`,
+	`key-type-`,
+	`replay-protection-`,
+	`mandatory-txs-`,
+	`threshold-cosigners-`,
+	`register-challenge`,
+	`build-confirmation`,
+	`domain-tag-`,
+	`ics-consumer-`,
+	`build-mode-`,
+	`validator-pause`,
+}
+
+// IsValidatorSignBytes returns true if msg is domain-separated as a builder
+// payload to be signed by a validator key. Signers can use it as a last line
+// of defense against being induced to sign arbitrary bytes, e.g. consensus
+// votes.
+func IsValidatorSignBytes(msg []byte) bool {
+	for _, domain := range validatorSignBytesDomains {
+		if bytes.HasPrefix(msg, []byte(domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// bindKeyType domain-separates sign bytes by key type. Ed25519 sign bytes are
+// left unchanged, so existing signatures remain valid.
+func bindKeyType(keyType string, signBytes []byte) []byte {
+	if keyType == "" || keyType == KeyTypeEd25519 {
+		return signBytes
+	}
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`key-type-`))
+	mustEncode(&sb, uint64(len([]byte(keyType))))
+	mustEncode(&sb, []byte(keyType))
+	mustEncode(&sb, signBytes)
+	return sb.Bytes()
+}
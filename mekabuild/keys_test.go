@@ -0,0 +1,73 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestVerifySignatureSecp256k1(t *testing.T) {
+	var (
+		publicKey, _ = hex.DecodeString("02bb50e2d89a4ed70663d080659fe0ad4b9bc3e06c17a227433966cb59ceee020d")
+		sig, _       = hex.DecodeString("8bf5447ae65c5ebbeb7e474cf4e8a5c255dbfd33763d93535bfb4d970de72fc45ea36d6fe878b9ae89ba92930e09753badfbd0edb14a54c288eae185032dbac4")
+		msg          = []byte("hello secp256k1")
+	)
+
+	for _, tc := range []struct {
+		name string
+		msg  []byte
+		sig  []byte
+		want bool
+	}{
+		{"valid", msg, sig, true},
+		{"wrong message", []byte("goodbye secp256k1"), sig, false},
+		{"corrupt signature", msg, append([]byte{sig[0] ^ 1}, sig[1:]...), false},
+		{"truncated signature", msg, sig[:63], false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			have, err := mekabuild.VerifySignature(mekabuild.KeyTypeSecp256k1, publicKey, tc.msg, tc.sig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tc.want; want != have {
+				t.Fatalf("want %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func TestBuildBlockRequestSignBytesKeyType(t *testing.T) {
+	var (
+		req       = mekabuild.BuildBlockRequest{ChainID: "chain", Height: 1}
+		legacy, _ = req.SignBytes()
+	)
+
+	req.KeyType = mekabuild.KeyTypeEd25519
+	if explicit, _ := req.SignBytes(); !bytes.Equal(legacy, explicit) {
+		t.Errorf("explicit ed25519 key type changed sign bytes")
+	}
+
+	req.KeyType = mekabuild.KeyTypeSecp256k1
+	if secp, _ := req.SignBytes(); bytes.Equal(legacy, secp) {
+		t.Errorf("secp256k1 key type isn't bound in sign bytes")
+	}
+}
+
+func TestIsValidatorSignBytes(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		msg  []byte
+		want bool
+	}{
+		{"build request", mekabuild.BuildBlockRequestSignBytes("chain-id", 1, "ADDR", 0, 0, nil), true},
+		{"versioned build request", mekabuild.BuildBlockRequestSignBytesVersion(mekabuild.TxsHashMerkle, "chain-id", 1, "ADDR", 0, 0, nil), true},
+		{"challenge", mekabuild.ChallengeSignBytes([]byte("challenge")), true},
+		{"arbitrary", []byte(`{"type":"vote"}`), false},
+	} {
+		if want, have := tc.want, mekabuild.IsValidatorSignBytes(tc.msg); want != have {
+			t.Errorf("%s: want %v, have %v", tc.name, want, have)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package mekabuild
+
+import (
+	"bytes"
+	"context"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// KeyManager is a validator key held by a key management service or HSM, so
+// that it never enters node memory. It's implemented by thin adapters over
+// the service's client, which this package doesn't depend on:
+//
+//   - GCP Cloud KMS: an EC_SIGN_ED25519 key, signing msg with AsymmetricSign
+//     Data, and returning the public key parsed from GetPublicKey's PEM.
+//   - AWS KMS: an ECC_SECG_P256K1 key, signing msg with the ECDSA_SHA_256
+//     algorithm and a RAW message type, and returning the DER signature as is.
+//   - PKCS#11: an Ed25519 key signed with CKM_EDDSA over msg, or a secp256k1
+//     key signed with CKM_ECDSA over the SHA-256 digest of msg.
+//
+// Implementations must be safe for concurrent use.
+type KeyManager interface {
+	// PublicKey returns the type of the key, KeyTypeEd25519 or
+	// KeyTypeSecp256k1, and the public key. Secp256k1 public keys may be
+	// compressed or uncompressed.
+	PublicKey(ctx context.Context) (keyType string, publicKey []byte, err error)
+
+	// Sign signs msg. Secp256k1 signatures may be DER encoded, or 64 byte
+	// r || s, with any s; they're normalized by KMSSigner.
+	Sign(ctx context.Context, msg []byte) ([]byte, error)
+}
+
+// KMSSigner is a Signer backed by a KeyManager. Every signature is verified
+// against the key's public key before it's returned, so a misconfigured key
+// is caught before a request is sent. Signatures are rate limited, see
+// SigningLimits.
+type KMSSigner struct {
+	km      KeyManager
+	keyType string
+	pubKey  []byte
+
+	mtx     sync.Mutex
+	timeout time.Duration
+	observe func(KMSMetrics)
+	health  KMSHealth
+	limits  *signingGuard
+}
+
+var (
+	_ Signer          = (*KMSSigner)(nil)
+	_ ChallengeSigner = (*KMSSigner)(nil)
+	_ PresignSigner   = (*KMSSigner)(nil)
+	_ ConfirmSigner   = (*KMSSigner)(nil)
+	_ PauseSigner     = (*KMSSigner)(nil)
+)
+
+// DefaultKMSTimeout bounds each call to the key manager.
+const DefaultKMSTimeout = 2 * time.Second
+
+// ErrKMS is returned when the key manager fails, or returns an invalid
+// signature.
+var ErrKMS = errors.New("key manager error")
+
+// KMSMetrics describes a single call to the key manager.
+type KMSMetrics struct {
+	Operation string // "sign" or "public_key"
+	Duration  time.Duration
+	Err       error
+}
+
+// KMSHealth describes the state of a KMSSigner, for health checks.
+type KMSHealth struct {
+	Healthy     bool          `json:"healthy"`
+	KeyType     string        `json:"key_type"`
+	Signatures  uint64        `json:"signatures"`
+	Failures    uint64        `json:"failures"`
+	LastSuccess time.Time     `json:"last_success"`
+	LastFailure time.Time     `json:"last_failure"`
+	LastError   string        `json:"last_error,omitempty"`
+	LastLatency time.Duration `json:"last_latency"`
+}
+
+// NewKMSSigner returns a signer backed by km, after fetching its public key.
+func NewKMSSigner(ctx context.Context, km KeyManager) (*KMSSigner, error) {
+	s := &KMSSigner{km: km, timeout: DefaultKMSTimeout, limits: newSigningGuard()}
+
+	keyType, pubKey, err := s.publicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.keyType, s.pubKey = keyType, pubKey
+	s.health.KeyType = keyType
+	return s, nil
+}
+
+// SetTimeout sets the timeout for each call to the key manager. The default
+// is DefaultKMSTimeout.
+func (s *KMSSigner) SetTimeout(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("timeout must be positive, have %s", d)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.timeout = d
+	return nil
+}
+
+// SetSigningLimits caps the rate of each kind of signature. The default is
+// DefaultSigningLimits.
+func (s *KMSSigner) SetSigningLimits(l SigningLimits) error {
+	return s.limits.setLimits(l)
+}
+
+// SetMetrics sets a function called after every call to the key manager, e.g.
+// to export signing latency. It's called synchronously, and must not block.
+func (s *KMSSigner) SetMetrics(fn func(KMSMetrics)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.observe = fn
+}
+
+// PublicKey returns the key type and public key of the signer.
+func (s *KMSSigner) PublicKey() (keyType string, publicKey []byte) {
+	return s.keyType, append([]byte(nil), s.pubKey...)
+}
+
+// Health returns the state of the signer. It's healthy unless the most recent
+// call to the key manager failed.
+func (s *KMSSigner) Health() KMSHealth {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	h := s.health
+	h.Healthy = h.LastFailure.IsZero() || h.LastSuccess.After(h.LastFailure)
+	return h
+}
+
+// Check checks that the key manager is reachable, and still holds the same
+// key, without signing anything.
+func (s *KMSSigner) Check(ctx context.Context) error {
+	keyType, pubKey, err := s.publicKey(ctx)
+	if err != nil {
+		return err
+	}
+	if keyType != s.keyType || !bytes.Equal(pubKey, s.pubKey) {
+		err := fmt.Errorf("%w: public key changed", ErrKMS)
+		s.record("public_key", 0, err)
+		return err
+	}
+	return nil
+}
+
+// SignBuildBlockRequest implements Signer. Requests without a KeyType are
+// assigned the key's type.
+func (s *KMSSigner) SignBuildBlockRequest(req *BuildBlockRequest) error {
+	if req.KeyType == "" && s.keyType != KeyTypeEd25519 {
+		req.KeyType = s.keyType
+	}
+	if err := s.limits.allow(signBuildRequest); err != nil {
+		return err
+	}
+
+	msg, err := req.SignBytes()
+	if err != nil {
+		return err
+	}
+	sig, err := s.sign(msg)
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return nil
+}
+
+// SignChallenge implements ChallengeSigner.
+func (s *KMSSigner) SignChallenge(challenge []byte) ([]byte, error) {
+	if err := s.limits.allow(signChallenge); err != nil {
+		return nil, err
+	}
+	return s.sign(ChallengeSignBytes(challenge))
+}
+
+// SignPresignRequest implements PresignSigner.
+func (s *KMSSigner) SignPresignRequest(req *PresignRequest) error {
+	if err := s.limits.allow(signPresign); err != nil {
+		return err
+	}
+
+	sig, err := s.sign(req.SignBytes())
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return nil
+}
+
+// SignConfirmRequest implements ConfirmSigner.
+func (s *KMSSigner) SignConfirmRequest(req *ConfirmRequest) error {
+	if req.KeyType == "" && s.keyType != KeyTypeEd25519 {
+		req.KeyType = s.keyType
+	}
+	if err := s.limits.allow(signConfirmation); err != nil {
+		return err
+	}
+
+	sig, err := s.sign(req.SignBytes())
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return nil
+}
+
+// SignPauseRequest implements PauseSigner.
+func (s *KMSSigner) SignPauseRequest(req *PauseRequest) error {
+	if req.KeyType == "" && s.keyType != KeyTypeEd25519 {
+		req.KeyType = s.keyType
+	}
+	if err := s.limits.allow(signPause); err != nil {
+		return err
+	}
+
+	sig, err := s.sign(req.SignBytes())
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return nil
+}
+
+func (s *KMSSigner) sign(msg []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.getTimeout())
+	defer cancel()
+
+	begin := time.Now()
+	sig, err := s.km.Sign(ctx, msg)
+	if err == nil && s.keyType == KeyTypeSecp256k1 {
+		sig, err = normalizeSecp256k1Signature(sig)
+	}
+	if err == nil {
+		var ok bool
+		ok, err = VerifySignature(s.keyType, s.pubKey, msg, sig)
+		if err == nil && !ok {
+			err = ErrBadSignature
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: sign: %v", ErrKMS, err)
+	}
+
+	s.record("sign", time.Since(begin), err)
+	if err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func (s *KMSSigner) publicKey(ctx context.Context) (string, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.getTimeout())
+	defer cancel()
+
+	begin := time.Now()
+	keyType, pubKey, err := s.km.PublicKey(ctx)
+	if err == nil {
+		switch keyType {
+		case KeyTypeEd25519:
+			if len(pubKey) != 32 {
+				err = fmt.Errorf("invalid ed25519 public key size %d", len(pubKey))
+			}
+		case KeyTypeSecp256k1:
+			pubKey, err = compressSecp256k1PublicKey(pubKey)
+		default:
+			err = fmt.Errorf("unsupported key type %q", keyType)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: public key: %v", ErrKMS, err)
+	}
+
+	s.record("public_key", time.Since(begin), err)
+	if err != nil {
+		return "", nil, err
+	}
+	return keyType, pubKey, nil
+}
+
+func (s *KMSSigner) getTimeout() time.Duration {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.timeout
+}
+
+func (s *KMSSigner) record(op string, took time.Duration, err error) {
+	s.mtx.Lock()
+	now := time.Now()
+	if err == nil {
+		if op == "sign" {
+			s.health.Signatures++
+		}
+		s.health.LastSuccess = now
+	} else {
+		s.health.Failures++
+		s.health.LastFailure = now
+		s.health.LastError = err.Error()
+	}
+	if took > 0 {
+		s.health.LastLatency = took
+	}
+	observe := s.observe
+	s.mtx.Unlock()
+
+	if observe != nil && took > 0 {
+		observe(KMSMetrics{Operation: op, Duration: took, Err: err})
+	}
+}
+
+// normalizeSecp256k1Signature converts a DER or 64 byte r || s signature to
+// 64 byte r || s with low s, as expected by Tendermint.
+func normalizeSecp256k1Signature(sig []byte) ([]byte, error) {
+	var r, s *big.Int
+	if len(sig) == 64 {
+		r, s = new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	} else {
+		var der struct{ R, S *big.Int }
+		rest, err := asn1.Unmarshal(sig, &der)
+		if err != nil || len(rest) > 0 {
+			return nil, fmt.Errorf("invalid secp256k1 signature encoding")
+		}
+		r, s = der.R, der.S
+	}
+
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(secp256k1.n) >= 0 || s.Cmp(secp256k1.n) >= 0 {
+		return nil, fmt.Errorf("invalid secp256k1 signature values")
+	}
+	if s.Cmp(secp256k1.halfN) > 0 {
+		s = new(big.Int).Sub(secp256k1.n, s)
+	}
+
+	out := make([]byte, 64)
+	r.FillBytes(out[:32])
+	s.FillBytes(out[32:])
+	return out, nil
+}
+
+// compressSecp256k1PublicKey returns the 33 byte compressed form of a
+// secp256k1 public key, which may be compressed, uncompressed (65 bytes), or
+// a DER SubjectPublicKeyInfo, as returned by AWS KMS.
+func compressSecp256k1PublicKey(pubKey []byte) ([]byte, error) {
+	if len(pubKey) != 33 && len(pubKey) != 65 {
+		var spki struct {
+			Algorithm asn1.RawValue
+			PublicKey asn1.BitString
+		}
+		if rest, err := asn1.Unmarshal(pubKey, &spki); err == nil && len(rest) == 0 {
+			pubKey = spki.PublicKey.Bytes
+		}
+	}
+
+	switch {
+	case len(pubKey) == 33 && (pubKey[0] == 2 || pubKey[0] == 3):
+		return pubKey, nil
+	case len(pubKey) == 65 && pubKey[0] == 4:
+		out := make([]byte, 33)
+		out[0] = 2 | pubKey[64]&1
+		copy(out[1:], pubKey[1:33])
+		return out, nil
+	default:
+		return nil, fmt.Errorf("invalid secp256k1 public key size %d", len(pubKey))
+	}
+}
@@ -0,0 +1,254 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestKMSSignerEd25519(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx             = context.Background()
+		public, private = mustGenerateEd25519(t)
+		km              = &mockKeyManager{keyType: mekabuild.KeyTypeEd25519, publicKey: public, sign: func(msg []byte) []byte { return ed25519.Sign(private, msg) }}
+		observed        []mekabuild.KMSMetrics
+		observedMtx     sync.Mutex
+		req             = &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: "validator", MaxBytes: 1000, MaxGas: -1}
+	)
+
+	signer, err := mekabuild.NewKMSSigner(ctx, km)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.SetMetrics(func(m mekabuild.KMSMetrics) {
+		observedMtx.Lock()
+		defer observedMtx.Unlock()
+		observed = append(observed, m)
+	})
+
+	if err := signer.SignBuildBlockRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := mekabuild.VerifyBuildBlockRequest(req, public); err != nil {
+		t.Errorf("verify build block request: %v", err)
+	}
+	if want, have := 1, len(observed); want != have || observed[0].Operation != "sign" {
+		t.Errorf("metrics: want %d sign observation, have %+v", want, observed)
+	}
+	if health := signer.Health(); !health.Healthy || health.Signatures != 1 {
+		t.Errorf("health: want healthy with 1 signature, have %+v", health)
+	}
+
+	km.setSign(func(msg []byte) []byte { return make([]byte, ed25519.SignatureSize) })
+	if _, err := signer.SignChallenge([]byte("challenge")); !errors.Is(err, mekabuild.ErrKMS) {
+		t.Errorf("bad signature: want %v, have %v", mekabuild.ErrKMS, err)
+	}
+	if health := signer.Health(); health.Healthy || health.Failures != 1 {
+		t.Errorf("health: want unhealthy with 1 failure, have %+v", health)
+	}
+
+	other, _ := mustGenerateEd25519(t)
+	km.setPublicKey(other)
+	if err := signer.Check(ctx); !errors.Is(err, mekabuild.ErrKMS) {
+		t.Errorf("changed key: want %v, have %v", mekabuild.ErrKMS, err)
+	}
+}
+
+func TestKMSSignerLimits(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx             = context.Background()
+		public, private = mustGenerateEd25519(t)
+		km              = &mockKeyManager{keyType: mekabuild.KeyTypeEd25519, publicKey: public, sign: func(msg []byte) []byte { return ed25519.Sign(private, msg) }}
+		req             = &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: "validator", MaxBytes: 1000, MaxGas: -1}
+	)
+
+	signer, err := mekabuild.NewKMSSigner(ctx, km)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.SetSigningLimits(mekabuild.SigningLimits{BuildRequestsPerMinute: -1}); err == nil {
+		t.Errorf("negative limit: want error, have none")
+	}
+	if err := signer.SetSigningLimits(mekabuild.SigningLimits{BuildRequestsPerMinute: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := signer.SignBuildBlockRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.SignBuildBlockRequest(req); !errors.Is(err, mekabuild.ErrSigningRateLimited) {
+		t.Errorf("build request 2: want %v, have %v", mekabuild.ErrSigningRateLimited, err)
+	}
+	if _, err := signer.SignChallenge([]byte("challenge")); err != nil {
+		t.Errorf("unlimited challenge: %v", err)
+	}
+	if health := signer.Health(); health.Signatures != 2 || health.Failures != 0 {
+		t.Errorf("health: want 2 signatures and no failures, have %+v", health)
+	}
+}
+
+func TestKMSSignerSecp256k1(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx = context.Background()
+		d   = big.NewInt(0x6d656b61) // private key
+		q   = testSecp256k1.mul(testSecp256k1.g, d)
+		km  = &mockKeyManager{
+			keyType:   mekabuild.KeyTypeSecp256k1,
+			publicKey: append(append([]byte{4}, q.x.FillBytes(make([]byte, 32))...), q.y.FillBytes(make([]byte, 32))...), // uncompressed
+			sign: func(msg []byte) []byte {
+				r, s := testSecp256k1.sign(d, msg)
+				s = new(big.Int).Sub(testSecp256k1.n, s) // high s, as AWS KMS may return
+				der, _ := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+				return der
+			},
+		}
+		req = &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: "validator", MaxBytes: 1000, MaxGas: -1}
+	)
+
+	signer, err := mekabuild.NewKMSSigner(ctx, km)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyType, publicKey := signer.PublicKey()
+	if want, have := 33, len(publicKey); want != have {
+		t.Fatalf("compressed public key size: want %d, have %d", want, have)
+	}
+
+	if err := signer.SignBuildBlockRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := keyType, req.KeyType; want != have {
+		t.Errorf("key type: want %q, have %q", want, have)
+	}
+	if err := mekabuild.VerifyBuildBlockRequest(req, publicKey); err != nil {
+		t.Errorf("verify build block request: %v", err)
+	}
+}
+
+func mustGenerateEd25519(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public, private
+}
+
+type mockKeyManager struct {
+	mtx       sync.Mutex
+	keyType   string
+	publicKey []byte
+	sign      func([]byte) []byte
+}
+
+func (m *mockKeyManager) PublicKey(ctx context.Context) (string, []byte, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.keyType, m.publicKey, nil
+}
+
+func (m *mockKeyManager) Sign(ctx context.Context, msg []byte) ([]byte, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.sign(msg), nil
+}
+
+func (m *mockKeyManager) setSign(fn func([]byte) []byte) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.sign = fn
+}
+
+func (m *mockKeyManager) setPublicKey(publicKey []byte) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.publicKey = publicKey
+}
+
+// testSecp256k1 is a minimal, variable time secp256k1 implementation for
+// signing test vectors, as the standard library has no secp256k1 support.
+var testSecp256k1 = func() testCurve {
+	hex := func(s string) *big.Int { v, _ := new(big.Int).SetString(s, 16); return v }
+	return testCurve{
+		p: hex("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f"),
+		n: hex("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"),
+		g: testPoint{
+			x: hex("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+			y: hex("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+		},
+	}
+}()
+
+type testCurve struct {
+	p, n *big.Int
+	g    testPoint
+}
+
+type testPoint struct{ x, y *big.Int } // nil x is the point at infinity
+
+func (c testCurve) add(a, b testPoint) testPoint {
+	switch {
+	case a.x == nil:
+		return b
+	case b.x == nil:
+		return a
+	}
+
+	var m *big.Int
+	if a.x.Cmp(b.x) == 0 {
+		if new(big.Int).Add(a.y, b.y).Cmp(c.p) == 0 || a.y.Sign() == 0 {
+			return testPoint{}
+		}
+		m = new(big.Int).Mul(big.NewInt(3), new(big.Int).Mul(a.x, a.x))
+		m.Mul(m, new(big.Int).ModInverse(new(big.Int).Lsh(a.y, 1), c.p))
+	} else {
+		m = new(big.Int).Sub(b.y, a.y)
+		m.Mul(m, new(big.Int).ModInverse(new(big.Int).Mod(new(big.Int).Sub(b.x, a.x), c.p), c.p))
+	}
+	m.Mod(m, c.p)
+
+	x := new(big.Int).Sub(new(big.Int).Mul(m, m), new(big.Int).Add(a.x, b.x))
+	x.Mod(x, c.p)
+	y := new(big.Int).Sub(new(big.Int).Mul(m, new(big.Int).Sub(a.x, x)), a.y)
+	y.Mod(y, c.p)
+	return testPoint{x, y}
+}
+
+func (c testCurve) mul(a testPoint, k *big.Int) testPoint {
+	var r testPoint
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = c.add(r, r)
+		if k.Bit(i) == 1 {
+			r = c.add(r, a)
+		}
+	}
+	return r
+}
+
+// sign returns an ECDSA signature over the SHA-256 digest of msg, with a
+// nonce derived from the digest, which is only safe for tests.
+func (c testCurve) sign(d *big.Int, msg []byte) (r, s *big.Int) {
+	digest := sha256.Sum256(msg)
+	e := new(big.Int).SetBytes(digest[:])
+	k := new(big.Int).Mod(new(big.Int).Add(e, d), c.n)
+
+	r = new(big.Int).Mod(c.mul(c.g, k).x, c.n)
+	s = new(big.Int).Mul(r, d)
+	s.Add(s, e)
+	s.Mul(s, new(big.Int).ModInverse(k, c.n))
+	s.Mod(s, c.n)
+	return r, s
+}
@@ -0,0 +1,241 @@
+package mekabuild
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StoreNamespaceReceipts is the namespace of the payment receipts kept by a
+// Ledger.
+const StoreNamespaceReceipts = "receipts"
+
+// Ledger keeps the payment receipts of the blocks built for a validator in a
+// Store, and reconciles them against the bank transfers observed on-chain.
+// Each receipt is kept under its chain ID and height, so if the validator
+// builds several blocks at a height, e.g. over several rounds, the receipt of
+// the last one is kept, and reconciliation shows whether it was committed.
+//
+// It's safe for concurrent use.
+type Ledger struct {
+	store keyStore
+}
+
+// NewLedger returns a ledger backed by the store, which must have a Keys
+// method returning the keys of a namespace, like MemoryStore and FileStore.
+func NewLedger(s Store) (*Ledger, error) {
+	ks, ok := s.(keyStore)
+	if !ok {
+		return nil, fmt.Errorf("store %T can't list its keys", s)
+	}
+	return &Ledger{store: ks}, nil
+}
+
+// Record persists the receipt.
+func (l *Ledger) Record(r *PaymentReceipt) error {
+	if r.ChainID == "" {
+		return errors.New("receipt without chain ID")
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encode receipt: %w", err)
+	}
+	return l.store.Put(StoreNamespaceReceipts, receiptKey(r.ChainID, r.Height), data)
+}
+
+// Receipt returns the receipt of the block at the given height, or an error
+// wrapping ErrNotFound.
+func (l *Ledger) Receipt(chainID string, height int64) (*PaymentReceipt, error) {
+	data, err := l.store.Get(StoreNamespaceReceipts, receiptKey(chainID, height))
+	if err != nil {
+		return nil, err
+	}
+	var r PaymentReceipt
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("decode receipt: %w", err)
+	}
+	return &r, nil
+}
+
+// Receipts returns the receipts of the chain from height from to height to,
+// inclusive, ordered by height. A to of zero means no upper bound.
+func (l *Ledger) Receipts(chainID string, from, to int64) ([]*PaymentReceipt, error) {
+	var heights []int64
+	for _, key := range l.store.Keys(StoreNamespaceReceipts) {
+		keyChainID, height, ok := parseReceiptKey(key)
+		if !ok || keyChainID != chainID || height < from || (to > 0 && height > to) {
+			continue
+		}
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	receipts := make([]*PaymentReceipt, 0, len(heights))
+	for _, height := range heights {
+		r, err := l.Receipt(chainID, height)
+		if err != nil {
+			return nil, fmt.Errorf("height %d: %w", height, err)
+		}
+		receipts = append(receipts, r)
+	}
+	return receipts, nil
+}
+
+// Total returns the sum of the receipts of the chain from height from to
+// height to, inclusive. A to of zero means no upper bound.
+func (l *Ledger) Total(chainID string, from, to int64) (Coins, error) {
+	receipts, err := l.Receipts(chainID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	total := Coins{}
+	for _, r := range receipts {
+		coin, err := r.Coin()
+		if err != nil {
+			return nil, fmt.Errorf("height %d: %w", r.Height, err)
+		}
+		total = total.Add(Coins{coin})
+	}
+	return total, nil
+}
+
+// BankTransfer is a transfer to the validator's payment address observed
+// on-chain, e.g. by querying a node for the txs sending to it. This package
+// doesn't query chains, so transfers are provided by the caller.
+type BankTransfer struct {
+	Height int64
+	TxHash string // in hex, of any case
+	Amount Coins
+}
+
+// Reconciliation is the outcome of reconciling receipts against bank
+// transfers.
+type Reconciliation struct {
+	// Matched are the receipts whose payment tx transferred the receipt's
+	// amount at the receipt's height.
+	Matched []*PaymentReceipt
+
+	// Missing are the receipts whose payment tx wasn't observed, e.g.
+	// because their block wasn't committed.
+	Missing []*PaymentReceipt
+
+	// Mismatched are the receipts whose payment tx transferred another
+	// amount, or was committed at another height.
+	Mismatched []ReceiptMismatch
+
+	// Unreceipted are the transfers without a receipt.
+	Unreceipted []BankTransfer
+}
+
+// ReceiptMismatch is a receipt, and the transfer of its payment tx, which
+// disagree.
+type ReceiptMismatch struct {
+	Receipt  *PaymentReceipt
+	Transfer BankTransfer
+}
+
+// OK returns true if every receipt matched a transfer, and every transfer a
+// receipt.
+func (r *Reconciliation) OK() bool {
+	return len(r.Missing) == 0 && len(r.Mismatched) == 0 && len(r.Unreceipted) == 0
+}
+
+// Reconcile matches the receipts of the chain from height from to height to,
+// inclusive, against the given transfers, by payment tx hash. Transfers
+// outside of the heights are ignored. A to of zero means no upper bound.
+func (l *Ledger) Reconcile(chainID string, from, to int64, transfers []BankTransfer) (*Reconciliation, error) {
+	receipts, err := l.Receipts(chainID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		rec     = &Reconciliation{}
+		byHash  = map[string]int{}
+		matched = map[int]bool{}
+	)
+	for i, t := range transfers {
+		byHash[strings.ToUpper(t.TxHash)] = i
+	}
+
+	for _, r := range receipts {
+		i, ok := byHash[strings.ToUpper(r.PaymentTxHash)]
+		if !ok {
+			rec.Missing = append(rec.Missing, r)
+			continue
+		}
+		matched[i] = true
+
+		t := transfers[i]
+		coin, err := r.Coin()
+		if err != nil || t.Height != r.Height || t.Amount.AmountOf(coin.Denom).Cmp(coin.Amount) != 0 {
+			rec.Mismatched = append(rec.Mismatched, ReceiptMismatch{Receipt: r, Transfer: t})
+			continue
+		}
+		rec.Matched = append(rec.Matched, r)
+	}
+
+	for i, t := range transfers {
+		if matched[i] || t.Height < from || (to > 0 && t.Height > to) {
+			continue
+		}
+		rec.Unreceipted = append(rec.Unreceipted, t)
+	}
+
+	return rec, nil
+}
+
+// receiptKey sorts the receipts of a chain by height.
+func receiptKey(chainID string, height int64) string {
+	return fmt.Sprintf("%s-%020d", chainID, height)
+}
+
+func parseReceiptKey(key string) (chainID string, height int64, ok bool) {
+	i := strings.LastIndexByte(key, '-')
+	if i < 0 {
+		return "", 0, false
+	}
+	height, err := strconv.ParseInt(key[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return key[:i], height, true
+}
+
+// SetLedger records the payment receipts of successful builds in the ledger.
+// Receipts are recorded after they're checked, see VerifyPaymentReceipt, but
+// their signature is only verified if a builder public key is pinned. A nil
+// ledger disables recording, which is the default.
+func (b *Builder) SetLedger(l *Ledger) {
+	b.ledger.Store(ledgerBox{l})
+}
+
+// WithLedger records payment receipts in the ledger. See SetLedger.
+func WithLedger(l *Ledger) Option {
+	return func(b *Builder) error {
+		b.SetLedger(l)
+		return nil
+	}
+}
+
+type ledgerBox struct{ *Ledger }
+
+func (b *Builder) getLedger() *Ledger {
+	box, _ := b.ledger.Load().(ledgerBox)
+	return box.Ledger
+}
+
+// recordReceipt records the payment receipt of resp in the ledger, if both are
+// set.
+func (b *Builder) recordReceipt(resp *BuildBlockResponse) {
+	l := b.getLedger()
+	if l == nil || resp.Receipt == nil {
+		return
+	}
+	if err := l.Record(resp.Receipt); err != nil {
+		b.getLogger().Errorf("record payment receipt failed: chain_id=%s height=%d err=%v", resp.Receipt.ChainID, resp.Receipt.Height, err)
+	}
+}
@@ -0,0 +1,65 @@
+package mekabuild_test
+
+import (
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestLedgerReconcile(t *testing.T) {
+	t.Parallel()
+
+	store, err := mekabuild.NewFileStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger, err := mekabuild.NewLedger(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []*mekabuild.PaymentReceipt{
+		{ChainID: "chain-1", Height: 10, Amount: "100", Denom: "uatom", PaymentTxHash: "AA"},
+		{ChainID: "chain-1", Height: 11, Amount: "200", Denom: "uatom", PaymentTxHash: "BB"},
+		{ChainID: "chain-1", Height: 12, Amount: "300", Denom: "uatom", PaymentTxHash: "CC"},
+		{ChainID: "chain-1", Height: 13, Amount: "400", Denom: "uatom", PaymentTxHash: "DD"},
+		{ChainID: "chain-1-testnet", Height: 10, Amount: "1", Denom: "uatom", PaymentTxHash: "EE"},
+	} {
+		if err := ledger.Record(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	total, err := ledger.Total("chain-1", 10, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "600uatom", total.String(); want != have {
+		t.Errorf("total: want %s, have %s", want, have)
+	}
+
+	rec, err := ledger.Reconcile("chain-1", 10, 13, []mekabuild.BankTransfer{
+		{Height: 10, TxHash: "aa", Amount: mekabuild.Coins{{Denom: "uatom", Amount: bigInt(100)}}},
+		{Height: 11, TxHash: "BB", Amount: mekabuild.Coins{{Denom: "uatom", Amount: bigInt(150)}}},
+		{Height: 13, TxHash: "FF", Amount: mekabuild.Coins{{Denom: "uatom", Amount: bigInt(400)}}},
+		{Height: 20, TxHash: "00", Amount: mekabuild.Coins{{Denom: "uatom", Amount: bigInt(1)}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.OK() {
+		t.Errorf("reconciliation: want discrepancies, have none")
+	}
+	if want, have := 1, len(rec.Matched); want != have || rec.Matched[0].Height != 10 {
+		t.Errorf("matched: want height 10, have %+v", rec.Matched)
+	}
+	if want, have := 1, len(rec.Mismatched); want != have || rec.Mismatched[0].Receipt.Height != 11 {
+		t.Errorf("mismatched: want height 11, have %+v", rec.Mismatched)
+	}
+	if want, have := 2, len(rec.Missing); want != have {
+		t.Errorf("missing: want %d, have %+v", want, rec.Missing)
+	}
+	if want, have := 1, len(rec.Unreceipted); want != have || rec.Unreceipted[0].TxHash != "FF" {
+		t.Errorf("unreceipted: want FF, have %+v", rec.Unreceipted)
+	}
+}
@@ -0,0 +1,117 @@
+package mekabuild
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrResponseTooLarge is returned when the txs of a build response exceed the
+// MaxBytes or MaxGas of the request, and can't be truncated, see
+// SetResponseLimits.
+var ErrResponseTooLarge = errors.New("response exceeds block limits")
+
+// ResponseLimits configures the check that the txs of build responses fit the
+// MaxBytes and MaxGas of the request, so a buggy builder API can't make the
+// proposer produce an invalid block.
+type ResponseLimits struct {
+	// Gas estimates the gas of each tx. If it's nil, only MaxBytes is
+	// checked.
+	Gas GasEstimator
+
+	// Truncate drops the txs which don't fit, from the first one on,
+	// rather than rejecting the response. Responses are still rejected if
+	// truncation would drop a mandatory tx, or an attested tx, since the
+	// block would be invalid either way.
+	Truncate bool
+}
+
+// SetResponseLimits enables checking the txs of build responses against the
+// MaxBytes and MaxGas of the request, per BlockBudget. Oversize responses are
+// truncated or rejected with ErrResponseTooLarge, in which case BuildBlock
+// falls back, as with other invalid responses. A nil rl disables the check,
+// which is the default.
+func (b *Builder) SetResponseLimits(rl *ResponseLimits) {
+	if rl == nil {
+		b.responseLimits.Store(responseLimitsBox{})
+		return
+	}
+	c := *rl
+	b.responseLimits.Store(responseLimitsBox{&c})
+}
+
+// WithResponseLimits enables checking build responses against the request's
+// block limits. See SetResponseLimits.
+func WithResponseLimits(rl ResponseLimits) Option {
+	return func(b *Builder) error {
+		b.SetResponseLimits(&rl)
+		return nil
+	}
+}
+
+type responseLimitsBox struct{ *ResponseLimits }
+
+func (b *Builder) getResponseLimits() *ResponseLimits {
+	box, _ := b.responseLimits.Load().(responseLimitsBox)
+	return box.ResponseLimits
+}
+
+// enforceResponseLimits checks that the txs of resp fit the limits of req, if
+// response limits are set, and truncates them if configured to. The
+// attestation tx, if any, counts against the block's bytes, but not its gas.
+// It must follow response verification, whose signatures cover the txs as
+// returned, and precede build confirmation, so oversize blocks aren't
+// confirmed.
+func (b *Builder) enforceResponseLimits(req *BuildBlockRequest, resp *BuildBlockResponse) error {
+	rl := b.getResponseLimits()
+	if rl == nil {
+		return nil
+	}
+
+	a, txs, err := SplitAttestation(resp.Txs)
+	if err != nil {
+		return err
+	}
+
+	budget := BlockBudget{MaxBytes: req.MaxBytes, MaxGas: req.MaxGas, Gas: rl.Gas}
+	if a != nil {
+		budget.UsedBytes = int64(len(resp.Txs[0]))
+		if budget.MaxBytes > 0 && budget.UsedBytes > budget.MaxBytes {
+			return fmt.Errorf("%w: attestation tx, %d bytes, max %d", ErrResponseTooLarge, budget.UsedBytes, budget.MaxBytes)
+		}
+	}
+
+	fit := len(txs)
+	for i, tx := range txs {
+		err := budget.Add(tx)
+		if errors.Is(err, ErrBlockBudgetExceeded) {
+			if !rl.Truncate {
+				return fmt.Errorf("%w: tx %d of %d: %v", ErrResponseTooLarge, i, len(txs), err)
+			}
+			fit = i
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("tx %d of %d: %w", i, len(txs), err)
+		}
+	}
+	if fit == len(txs) {
+		return nil
+	}
+
+	if a != nil {
+		attested, err := a.AttestedTxs(txs)
+		if err != nil {
+			return err
+		}
+		if fit < len(attested) {
+			return fmt.Errorf("%w: truncating to %d txs would drop attested txs", ErrResponseTooLarge, fit)
+		}
+	}
+	if err := VerifyMandatoryTxs(req.MandatoryTxs, txs[:fit]); err != nil {
+		return fmt.Errorf("%w: truncating to %d txs would drop mandatory txs", ErrResponseTooLarge, fit)
+	}
+
+	b.getLogger().Errorf("build response exceeds block limits, truncated: chain_id=%s height=%d txs=%d truncated_to=%d max_bytes=%d max_gas=%d", req.ChainID, req.Height, len(txs), fit, req.MaxBytes, req.MaxGas)
+	resp.Txs = resp.Txs[:len(resp.Txs)-len(txs)+fit]
+	return nil
+}
@@ -0,0 +1,79 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderResponseLimits(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		mempool   = [][]byte{[]byte("tx-1"), []byte("tx-2"), []byte("tx-3")}
+		b         *mekabuild.Builder
+		height    int64
+		build     = func(maxBytes, maxGas int64) (*mekabuild.BuildBlockResponse, error) {
+			height++
+			return b.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, MaxBytes: maxBytes, MaxGas: maxGas, Txs: mempool})
+		}
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	b, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithEndpoints(apiURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The mock API returns every tx, regardless of MaxBytes.
+	if resp, err := build(8, 0); err != nil || len(resp.Txs) != 3 {
+		t.Fatalf("without limits: want 3 txs, have %v, %v", resp, err)
+	}
+
+	b.SetResponseLimits(&mekabuild.ResponseLimits{})
+	if _, err := build(8, 0); !errors.Is(err, mekabuild.ErrResponseTooLarge) {
+		t.Errorf("reject: want %v, have %v", mekabuild.ErrResponseTooLarge, err)
+	}
+	if resp, err := build(12, 0); err != nil || len(resp.Txs) != 3 {
+		t.Errorf("fitting response: want 3 txs, have %v, %v", resp, err)
+	}
+
+	b.SetResponseLimits(&mekabuild.ResponseLimits{Truncate: true})
+	if resp, err := build(8, 0); err != nil || !reflect.DeepEqual(mempool[:2], resp.Txs) {
+		t.Errorf("truncate bytes: want %q, have %v, %v", mempool[:2], resp, err)
+	}
+
+	b.SetResponseLimits(&mekabuild.ResponseLimits{Truncate: true, Gas: func([]byte) (int64, error) { return 10, nil }})
+	if resp, err := build(0, 15); err != nil || !reflect.DeepEqual(mempool[:1], resp.Txs) {
+		t.Errorf("truncate gas: want %q, have %v, %v", mempool[:1], resp, err)
+	}
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.SetBuilderKey(private)
+	api.SetAttestations(true)
+	if err := b.SetBuilderPublicKey(public); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := build(1000, 15); !errors.Is(err, mekabuild.ErrResponseTooLarge) {
+		t.Errorf("truncate attested txs: want %v, have %v", mekabuild.ErrResponseTooLarge, err)
+	}
+
+	b.SetResponseLimits(nil)
+	if resp, err := build(0, 15); err != nil || len(resp.Txs) != 4 {
+		t.Errorf("disabled: want 4 txs, have %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,62 @@
+package mekabuild
+
+import (
+	"log"
+)
+
+// Logger receives log events from the builder. Every build attempt, retry,
+// failover and outcome is logged, so that failures are visible even when the
+// returned errors are swallowed by the caller.
+//
+// Implementations must be safe for concurrent use. Adapting a structured
+// logger, e.g. the Tendermint logger, usually takes a few lines.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// NewStdLogger returns a Logger writing to the provided standard library
+// logger. Debug events are discarded unless debug is true.
+func NewStdLogger(l *log.Logger, debug bool) Logger {
+	return &stdLogger{l: l, debug: debug}
+}
+
+type stdLogger struct {
+	l     *log.Logger
+	debug bool
+}
+
+func (s *stdLogger) Debugf(format string, args ...interface{}) {
+	if s.debug {
+		s.l.Printf("DEBUG "+format, args...)
+	}
+}
+
+func (s *stdLogger) Infof(format string, args ...interface{}) {
+	s.l.Printf("INFO "+format, args...)
+}
+
+func (s *stdLogger) Errorf(format string, args ...interface{}) {
+	s.l.Printf("ERROR "+format, args...)
+}
+
+// SetLogger configures the builder to log to l. By default, nothing is logged.
+func (b *Builder) SetLogger(l Logger) {
+	b.logger.Store(loggerBox{l})
+}
+
+func (b *Builder) getLogger() Logger {
+	if box, _ := b.logger.Load().(loggerBox); box.Logger != nil {
+		return box.Logger
+	}
+	return nopLogger{}
+}
+
+type loggerBox struct{ Logger }
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
@@ -0,0 +1,891 @@
+// Package mekatest provides a fake builder API for tests.
+//
+// The fake implements the registration, status, ping, support, build, and
+// confirmation endpoints of the builder API in memory. Build requests are verified against
+// the validator keys added to the fake, exactly like the real API, so it
+// catches signing bugs in integrations, e.g. in patched Tendermint proposers.
+// Latency, failures, payments, and the API's clock are configurable, so
+// timeouts, retries, and request expiry can be tested deterministically.
+//
+//	api := mekatest.NewAPI()
+//	api.AddPublicKey(chainID, validatorAddr, publicKey)
+//	server := mekatest.NewServer(t, api)
+//	apiURL, _ := url.Parse(server.URL)
+//	builder, err := mekabuild.New(signer, chainID, validatorAddr, mekabuild.WithEndpoints(apiURL))
+package mekatest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+// API is a fake builder API. It's an http.Handler, typically served by
+// NewServer. It's safe for concurrent use.
+type API struct {
+	mtx        sync.Mutex
+	keys       map[string]validatorKey
+	challenges map[string]challenge
+	registered map[string]string        // ID to payment address
+	domainTags map[string]string        // ID to registered domain tag
+	consumers  map[string]consumerChain // chain ID to consumer chain
+	builderKey ed25519.PrivateKey
+	attest     bool
+	receipts   bool
+	topOfBlock [][]byte // nil unless top-of-block builds are enabled
+	builds     []mekabuild.BuildBlockRequest
+	bundles    []mekabuild.SupportBundle
+	telemetry  []mekabuild.TelemetryReport
+	auctions   map[string]auction                    // auction ID to outcome
+	confirmed  map[string]string                     // ID and height to auction ID
+	earnings   map[string][]mekabuild.EarningsRecord // ID to payments
+	paused     map[string]time.Time                  // ID to end of pause
+
+	requireRegistration bool
+	chains              []string
+	latency             func(*http.Request) time.Duration
+	failure             func(*http.Request) int
+	retryAfter          time.Duration
+	payment             PaymentFunc
+	clockSkew           time.Duration
+	replayGuard         *mekabuild.ReplayGuard
+}
+
+// PaymentFunc returns the validator payment for a build request.
+type PaymentFunc func(req *mekabuild.BuildBlockRequest) string
+
+// DefaultPayment pays one coin of the chain per tx, e.g. "3 chain-id coins".
+func DefaultPayment(req *mekabuild.BuildBlockRequest) string {
+	return fmt.Sprintf("%d %s coins", len(req.Txs), req.ChainID)
+}
+
+type auction struct {
+	id     string // chain ID and validator address
+	height int64
+}
+
+// challenge is a registration challenge, bound to the domain tag and consumer
+// chain of the application it was issued for.
+type challenge struct {
+	value           []byte
+	domainTag       string
+	providerChainID string
+	consumerID      string
+	update          bool   // for UpdateRegistration, rather than registration
+	paymentAddress  string // the new payment address, for updates
+}
+
+// consumerChain is an ICS consumer chain, whose validators are the validators
+// of its provider chain, and sign with their provider chain keys.
+type consumerChain struct {
+	providerChainID string
+	consumerID      string
+	assignments     mekabuild.KeyAssignments
+}
+
+type validatorKey struct {
+	keyType   string
+	publicKey []byte
+}
+
+// NewAPI returns an empty fake builder API.
+func NewAPI() *API {
+	return &API{
+		keys:       map[string]validatorKey{},
+		challenges: map[string]challenge{},
+		registered: map[string]string{},
+		domainTags: map[string]string{},
+		consumers:  map[string]consumerChain{},
+		auctions:   map[string]auction{},
+		confirmed:  map[string]string{},
+		earnings:   map[string][]mekabuild.EarningsRecord{},
+		paused:     map[string]time.Time{},
+		payment:    DefaultPayment,
+	}
+}
+
+// NewServer serves h, typically an API, over HTTP, accepting gzipped request
+// bodies and honoring request timeouts like the real API. The server is closed
+// when the test ends.
+func NewServer(tb testing.TB, h http.Handler) *httptest.Server {
+	tb.Helper()
+	server := httptest.NewServer(mekabuild.GunzipRequestMiddleware(mekabuild.TimeoutMiddleware(h)))
+	tb.Cleanup(server.Close)
+	return server
+}
+
+// AddPublicKey adds a validator with an ed25519 key to the valset of a chain.
+func (a *API) AddPublicKey(chainID, addr string, publicKey []byte) {
+	a.AddKey(chainID, addr, mekabuild.KeyTypeEd25519, publicKey)
+}
+
+// AddKey adds a validator with a key of the given type to the valset of a
+// chain.
+func (a *API) AddKey(chainID, addr, keyType string, publicKey []byte) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.keys[makeID(chainID, addr)] = validatorKey{keyType, publicKey}
+}
+
+// SetRegistered registers a validator with the given payment address, as if
+// it had completed the registration flow. An empty payment address
+// unregisters the validator.
+func (a *API) SetRegistered(chainID, addr, paymentAddress string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if paymentAddress == "" {
+		delete(a.registered, makeID(chainID, addr))
+		delete(a.domainTags, makeID(chainID, addr))
+		return
+	}
+	a.registered[makeID(chainID, addr)] = paymentAddress
+}
+
+// SetDomainTag sets the domain tag of a validator, as if it had registered
+// with it. Signed requests from the validator must carry the tag, and
+// requests with a different tag, or with a tag when none is set, are rejected
+// with 400 Bad Request. An empty tag removes it.
+func (a *API) SetDomainTag(chainID, addr, tag string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if tag == "" {
+		delete(a.domainTags, makeID(chainID, addr))
+		return
+	}
+	a.domainTags[makeID(chainID, addr)] = tag
+}
+
+// DomainTag returns the domain tag a validator registered with, if any.
+func (a *API) DomainTag(chainID, addr string) string {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.domainTags[makeID(chainID, addr)]
+}
+
+// AddConsumerChain makes a chain an ICS consumer chain of the provider chain,
+// identified on it by consumerID. Validators of the provider chain, see
+// AddKey, are validators of the consumer chain, and requests for it signed
+// with their provider chain keys must identify the provider chain and
+// consumer ID. See AssignConsumerKey.
+func (a *API) AddConsumerChain(chainID, providerChainID, consumerID string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.consumers[chainID] = consumerChain{
+		providerChainID: providerChainID,
+		consumerID:      consumerID,
+		assignments:     mekabuild.KeyAssignments{},
+	}
+}
+
+// AssignConsumerKey assigns a consensus key to a provider chain validator on a
+// consumer chain, so the validator's consumer chain address is consumerAddr
+// rather than its provider chain address. The chain must have been added with
+// AddConsumerChain.
+func (a *API) AssignConsumerKey(chainID, providerAddr, consumerAddr string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.consumers[chainID].assignments[providerAddr] = consumerAddr
+}
+
+// Registered returns the payment address of a registered validator.
+func (a *API) Registered(chainID, addr string) (paymentAddress string, ok bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	paymentAddress, ok = a.registered[makeID(chainID, addr)]
+	return paymentAddress, ok
+}
+
+// RequireRegistration controls whether builds from unregistered validators
+// are rejected with 403 Forbidden. It's disabled by default.
+func (a *API) RequireRegistration(require bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.requireRegistration = require
+}
+
+// SetChains sets the chains reported by the ping endpoint.
+func (a *API) SetChains(chains ...string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.chains = chains
+}
+
+// SetBuilderKey sets the key used to sign build responses. By default,
+// responses are unsigned.
+func (a *API) SetBuilderKey(key ed25519.PrivateKey) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.builderKey = key
+}
+
+// SetAttestations makes the fake prepend a builder attestation to the txs of
+// build responses, see mekabuild.AttestBuildBlockResponse. It requires a
+// builder key, see SetBuilderKey. By default, blocks aren't attested.
+func (a *API) SetAttestations(enabled bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.attest = enabled
+}
+
+// PausedUntil returns the end of the validator's pause, and true if it's
+// paused.
+func (a *API) PausedUntil(chainID, addr string) (time.Time, bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	until, ok := a.paused[makeID(chainID, addr)]
+	if !ok || !a.now().Before(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// AddEarnings adds payments to the validator, served by the earnings
+// endpoint, which pages through them in the order they were added.
+func (a *API) AddEarnings(chainID, addr string, records ...mekabuild.EarningsRecord) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	id := makeID(chainID, addr)
+	a.earnings[id] = append(a.earnings[id], records...)
+}
+
+// SetReceipts makes the fake issue payment receipts with build responses, see
+// mekabuild.IssuePaymentReceipt, for a payment tx whose hash is derived from
+// the auction ID. It requires a builder key, see SetBuilderKey, and payments
+// of a single coin, see SetPayment. By default, receipts aren't issued.
+func (a *API) SetReceipts(enabled bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.receipts = enabled
+}
+
+// SetTopOfBlock makes the fake advertise mekabuild.CapabilityTopOfBlock, and
+// answer top-of-block build requests with the given txs, and the request's
+// mandatory txs. A nil slice disables top-of-block builds, the default.
+func (a *API) SetTopOfBlock(txs ...[]byte) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.topOfBlock = txs
+}
+
+// SetPayment sets the payment formula for build responses. A nil function
+// restores DefaultPayment.
+func (a *API) SetPayment(fn PaymentFunc) {
+	if fn == nil {
+		fn = DefaultPayment
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.payment = fn
+}
+
+// SetLatency delays every response by d. Delays end early if the request is
+// canceled.
+func (a *API) SetLatency(d time.Duration) {
+	a.SetLatencyFunc(func(*http.Request) time.Duration { return d })
+}
+
+// SetLatencyFunc delays every response by the duration returned by fn, e.g.
+// to add jitter, or slow down specific routes. A nil function removes the
+// delay.
+func (a *API) SetLatencyFunc(fn func(r *http.Request) time.Duration) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.latency = fn
+}
+
+// ProgressiveLatency returns a latency function for SetLatencyFunc that
+// simulates a progressively slower API: the first request is delayed by base,
+// and every following request by step more than the previous one, up to max.
+// A max of zero means no limit.
+func ProgressiveLatency(base, step, max time.Duration) func(*http.Request) time.Duration {
+	var (
+		mtx  sync.Mutex
+		next = base
+	)
+	return func(*http.Request) time.Duration {
+		mtx.Lock()
+		defer mtx.Unlock()
+		d := next
+		if max > 0 && d > max {
+			d = max
+		}
+		next += step
+		return d
+	}
+}
+
+// SetFailure injects failures: every request for which fn returns a nonzero
+// status code fails with that status code, before it's handled. A nil
+// function removes the failures.
+func (a *API) SetFailure(fn func(r *http.Request) int) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.failure = fn
+	a.retryAfter = 0
+}
+
+// FailNextRetryAfter fails the next n requests with the given status code,
+// and a Retry-After header of d, rounded up to whole seconds, like a rate
+// limited or overloaded API.
+func (a *API) FailNextRetryAfter(n int, status int, d time.Duration) {
+	a.FailNext(n, status)
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.retryAfter = d
+}
+
+// SetClockSkew offsets the API's clock from the system clock by d, e.g. a
+// positive d for an API whose clock runs ahead of the validator's. The API's
+// clock is reported in the Date header of every response, and is used to
+// check the timestamps of build requests, see RequireFreshRequests.
+func (a *API) SetClockSkew(d time.Duration) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.clockSkew = d
+}
+
+// Now returns the current time of the API's clock.
+func (a *API) Now() time.Time {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.now()
+}
+
+func (a *API) now() time.Time {
+	return time.Now().Add(a.clockSkew)
+}
+
+// RequireFreshRequests makes the build endpoint reject replayed requests, and
+// requests whose timestamp is more than maxSkew from the API's clock, with 409
+// Conflict, like an API using mekabuild.ReplayGuard. Requests without a nonce
+// are rejected, so builders must enable replay protection. While enabled, the
+// API advertises mekabuild.CapabilityReplayProtection, along with the other
+// capabilities it implements. Zero, the default, disables the check.
+func (a *API) RequireFreshRequests(maxSkew time.Duration) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if maxSkew <= 0 {
+		a.replayGuard = nil
+		return
+	}
+	a.replayGuard = mekabuild.NewReplayGuard(maxSkew)
+}
+
+// FailNext fails the next n requests with the given status code.
+func (a *API) FailNext(n int, status int) {
+	var mtx sync.Mutex
+	a.SetFailure(func(*http.Request) int {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if n <= 0 {
+			return 0
+		}
+		n--
+		return status
+	})
+}
+
+// Builds returns the verified build requests received so far.
+func (a *API) Builds() []mekabuild.BuildBlockRequest {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return append([]mekabuild.BuildBlockRequest(nil), a.builds...)
+}
+
+// SupportBundles returns the support bundles uploaded so far.
+func (a *API) SupportBundles() []mekabuild.SupportBundle {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return append([]mekabuild.SupportBundle(nil), a.bundles...)
+}
+
+// TelemetryReports returns the telemetry reports received so far.
+func (a *API) TelemetryReports() []mekabuild.TelemetryReport {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return append([]mekabuild.TelemetryReport(nil), a.telemetry...)
+}
+
+// Confirmed returns the confirmed auction ID for a validator and height.
+func (a *API) Confirmed(chainID, addr string, height int64) (auctionID string, ok bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	auctionID, ok = a.confirmed[fmt.Sprintf("%s:%d", makeID(chainID, addr), height)]
+	return auctionID, ok
+}
+
+// ServeHTTP implements http.Handler.
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mtx.Lock()
+	latency, failure, retryAfter := a.latency, a.failure, a.retryAfter
+	w.Header().Set("Date", a.now().UTC().Format(http.TimeFormat))
+	var caps mekabuild.Capabilities
+	if a.replayGuard != nil {
+		caps |= freshCapabilities
+	}
+	if a.topOfBlock != nil {
+		caps |= mekabuild.CapabilityTopOfBlock
+	}
+	if caps != 0 {
+		w.Header().Set(mekabuild.CapabilitiesHeader, caps.String())
+	}
+	a.mtx.Unlock()
+
+	if latency != nil {
+		if d := latency(r); d > 0 {
+			select {
+			case <-time.After(d):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	if failure != nil {
+		if status := failure(r); status != 0 {
+			if retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+			}
+			http.Error(w, "injected failure", status)
+			return
+		}
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	switch r.URL.Path {
+	case "/v0/apply":
+		var req mekabuild.ApplyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		id := makeID(req.ChainID, req.ValidatorAddress)
+		if _, err := a.validatorKey(req.ChainID, req.ValidatorAddress, req.ProviderChainID, req.ConsumerID); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if req.ProviderChainID != "" {
+			providerAddr, _ := a.consumers[req.ChainID].assignments.ProviderAddress(req.ValidatorAddress)
+			if addr, err := mekabuild.NormalizeValidatorAddress(req.ProviderAddress); err != nil || addr != providerAddr {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("provider address %q doesn't match consumer address %s", req.ProviderAddress, req.ValidatorAddress)})
+				return
+			}
+		}
+		if err := mekabuild.ValidateDomainTag(req.DomainTag); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, registered := a.registered[id]; req.Update && !registered {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "validator not registered"})
+			return
+		}
+
+		value := make([]byte, 32)
+		rand.Read(value)
+		a.challenges[id] = challenge{
+			value:           value,
+			domainTag:       req.DomainTag,
+			providerChainID: req.ProviderChainID,
+			consumerID:      req.ConsumerID,
+			update:          req.Update,
+			paymentAddress:  req.PaymentAddress,
+		}
+
+		json.NewEncoder(w).Encode(mekabuild.ApplyResponse{Challenge: value})
+
+	case "/v0/register":
+		var req mekabuild.RegisterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		id := makeID(req.ChainID, req.ValidatorAddress)
+		ch, ok := a.challenges[id]
+		if !ok || !bytes.Equal(ch.value, req.Challenge) || ch.update {
+			http.Error(w, "unknown challenge", http.StatusBadRequest)
+			return
+		}
+		if req.DomainTag != ch.domainTag {
+			http.Error(w, fmt.Sprintf("domain tag %q doesn't match application domain tag %q", req.DomainTag, ch.domainTag), http.StatusBadRequest)
+			return
+		}
+
+		if req.ProviderChainID != ch.providerChainID || req.ConsumerID != ch.consumerID {
+			http.Error(w, "consumer chain doesn't match application consumer chain", http.StatusBadRequest)
+			return
+		}
+
+		key, err := a.validatorKey(req.ChainID, req.ValidatorAddress, req.ProviderChainID, req.ConsumerID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ok, err := mekabuild.VerifySignature(key.keyType, key.publicKey, mekabuild.ChallengeSignBytes(ch.value), req.Signature); err != nil || !ok {
+			http.Error(w, "bad signature", http.StatusBadRequest)
+			return
+		}
+
+		delete(a.challenges, id)
+		a.registered[id] = req.PaymentAddress
+		if req.DomainTag != "" {
+			a.domainTags[id] = req.DomainTag
+		} else {
+			delete(a.domainTags, id)
+		}
+
+		json.NewEncoder(w).Encode(mekabuild.RegisterResponse{Result: "registered"})
+
+	case "/v0/update_registration":
+		var req mekabuild.UpdateRegistrationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		id := makeID(req.ChainID, req.ValidatorAddress)
+		ch, ok := a.challenges[id]
+		if !ok || !bytes.Equal(ch.value, req.Challenge) || !ch.update {
+			http.Error(w, "unknown challenge", http.StatusBadRequest)
+			return
+		}
+		if req.PaymentAddress != ch.paymentAddress {
+			http.Error(w, fmt.Sprintf("payment address %q doesn't match application payment address %q", req.PaymentAddress, ch.paymentAddress), http.StatusBadRequest)
+			return
+		}
+		if req.DomainTag != ch.domainTag || req.ProviderChainID != ch.providerChainID || req.ConsumerID != ch.consumerID {
+			http.Error(w, "request doesn't match application", http.StatusBadRequest)
+			return
+		}
+		if err := a.checkDomainTag(id, req.DomainTag); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		key, err := a.validatorKey(req.ChainID, req.ValidatorAddress, req.ProviderChainID, req.ConsumerID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ok, err := mekabuild.VerifySignature(key.keyType, key.publicKey, mekabuild.ChallengeSignBytes(ch.value), req.Signature); err != nil || !ok {
+			http.Error(w, "bad signature", http.StatusBadRequest)
+			return
+		}
+
+		delete(a.challenges, id)
+		if _, registered := a.registered[id]; !registered {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "validator not registered"})
+			return
+		}
+		a.registered[id] = req.PaymentAddress
+
+		json.NewEncoder(w).Encode(mekabuild.RegisterResponse{Result: "updated"})
+
+	case "/v0/status":
+		var req mekabuild.StatusRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		paymentAddress, registered := a.registered[makeID(req.ChainID, req.ValidatorAddress)]
+		json.NewEncoder(w).Encode(mekabuild.StatusResponse{
+			ChainID:          req.ChainID,
+			ValidatorAddress: req.ValidatorAddress,
+			Registered:       registered,
+			PaymentAddress:   paymentAddress,
+		})
+
+	case "/v0/support":
+		var bundle mekabuild.SupportBundle
+		if err := json.NewDecoder(r.Body).Decode(&bundle); err != nil {
+			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+		a.bundles = append(a.bundles, bundle)
+		json.NewEncoder(w).Encode(mekabuild.SupportBundleResponse{TicketID: fmt.Sprintf("ticket-%d", len(a.bundles))})
+
+	case "/v0/telemetry":
+		var report mekabuild.TelemetryReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+		a.telemetry = append(a.telemetry, report)
+		json.NewEncoder(w).Encode(struct{}{})
+
+	case "/v0/earnings":
+		var req mekabuild.EarningsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		var records []mekabuild.EarningsRecord
+		for _, rec := range a.earnings[makeID(req.ChainID, req.ValidatorAddress)] {
+			if rec.TimeMillis >= req.FromMillis && (req.ToMillis == 0 || rec.TimeMillis < req.ToMillis) {
+				records = append(records, rec)
+			}
+		}
+
+		offset, _ := strconv.Atoi(req.PageToken)
+		if offset < 0 || offset > len(records) {
+			http.Error(w, "invalid page token", http.StatusBadRequest)
+			return
+		}
+		records = records[offset:]
+
+		var resp mekabuild.EarningsResponse
+		if req.Limit > 0 && len(records) > req.Limit {
+			records = records[:req.Limit]
+			resp.NextPageToken = strconv.Itoa(offset + req.Limit)
+		}
+		resp.Records = records
+		json.NewEncoder(w).Encode(resp)
+
+	case "/v0/ping":
+		json.NewEncoder(w).Encode(mekabuild.PingResponse{APIVersion: "mock", Chains: a.chains})
+
+	case "/v0/build":
+		var req mekabuild.BuildBlockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		id := makeID(req.ChainID, req.ValidatorAddress)
+		key, err := a.validatorKey(req.ChainID, req.ValidatorAddress, req.ProviderChainID, req.ConsumerID)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		keyType := req.KeyType
+		if keyType == "" {
+			keyType = mekabuild.KeyTypeEd25519
+		}
+		if keyType != key.keyType {
+			http.Error(w, fmt.Sprintf("key type %s doesn't match validator key type %s", keyType, key.keyType), http.StatusBadRequest)
+			return
+		}
+
+		if err := mekabuild.VerifyBuildBlockRequest(&req, key.publicKey); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := a.checkDomainTag(id, req.DomainTag); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		if a.replayGuard != nil {
+			if err := a.replayGuard.Check(&req, a.now()); err != nil {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+		}
+
+		if _, registered := a.registered[id]; a.requireRegistration && !registered {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "validator not registered"})
+			return
+		}
+		if until, ok := a.paused[id]; ok && a.now().Before(until) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "validator paused"})
+			return
+		}
+
+		txs := req.Txs
+		if req.Mode == mekabuild.BuildModeTopOfBlock {
+			if a.topOfBlock == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "top-of-block builds not supported"})
+				return
+			}
+			txs = a.topOfBlock
+		}
+
+		a.builds = append(a.builds, req)
+
+		auctionID := fmt.Sprintf("auction-%d", len(a.builds))
+		a.auctions[auctionID] = auction{id: id, height: req.Height}
+
+		resp := mekabuild.BuildBlockResponse{
+			Txs:              mekabuild.PlaceMandatoryTxs(txs, req.MandatoryTxs),
+			ValidatorPayment: a.payment(&req),
+			AuctionID:        auctionID,
+		}
+
+		if a.builderKey != nil && a.receipts {
+			hash := sha256.Sum256([]byte(auctionID))
+			if err := mekabuild.IssuePaymentReceipt(&req, &resp, strings.ToUpper(hex.EncodeToString(hash[:])), a.builderKey); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if a.builderKey != nil && a.attest {
+			if err := mekabuild.AttestBuildBlockResponse(&req, &resp, a.builderKey); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if a.builderKey != nil {
+			if err := mekabuild.SignBuildBlockResponse(&req, &resp, a.builderKey); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		json.NewEncoder(w).Encode(resp)
+
+	case "/v0/pause":
+		var req mekabuild.PauseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		id := makeID(req.ChainID, req.ValidatorAddress)
+		key, err := a.validatorKey(req.ChainID, req.ValidatorAddress, req.ProviderChainID, req.ConsumerID)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if ok, err := mekabuild.VerifySignature(key.keyType, key.publicKey, req.SignBytes(), req.Signature); err != nil || !ok {
+			http.Error(w, "bad signature", http.StatusBadRequest)
+			return
+		}
+		if err := a.checkDomainTag(id, req.DomainTag); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if skew := a.now().Sub(time.Unix(0, req.Timestamp*int64(time.Millisecond))); skew > time.Minute || skew < -time.Minute {
+			http.Error(w, "stale request", http.StatusBadRequest)
+			return
+		}
+
+		var resp mekabuild.PauseResponse
+		if req.UntilMillis == 0 {
+			delete(a.paused, id)
+		} else {
+			a.paused[id] = time.Unix(0, req.UntilMillis*int64(time.Millisecond))
+			resp.PausedUntilMillis = req.UntilMillis
+		}
+		json.NewEncoder(w).Encode(resp)
+
+	case "/v0/confirm":
+		var req mekabuild.ConfirmRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		id := makeID(req.ChainID, req.ValidatorAddress)
+		key, err := a.validatorKey(req.ChainID, req.ValidatorAddress, req.ProviderChainID, req.ConsumerID)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if ok, err := mekabuild.VerifySignature(key.keyType, key.publicKey, req.SignBytes(), req.Signature); err != nil || !ok {
+			http.Error(w, "bad signature", http.StatusBadRequest)
+			return
+		}
+		if err := a.checkDomainTag(id, req.DomainTag); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		if auc, ok := a.auctions[req.AuctionID]; !ok || auc.id != id || auc.height != req.Height {
+			http.Error(w, fmt.Sprintf("unknown auction %s", req.AuctionID), http.StatusBadRequest)
+			return
+		}
+
+		heightID := fmt.Sprintf("%s:%d", id, req.Height)
+		if confirmed, ok := a.confirmed[heightID]; ok && confirmed != req.AuctionID {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("auction %s already confirmed", confirmed)})
+			return
+		}
+		a.confirmed[heightID] = req.AuctionID
+
+		json.NewEncoder(w).Encode(mekabuild.ConfirmResponse{AuctionID: req.AuctionID, Result: "confirmed"})
+
+	default:
+		http.Error(w, fmt.Sprintf("unknown mock API route %s", r.URL.Path), http.StatusNotFound)
+	}
+}
+
+// checkDomainTag returns an error if tag isn't the domain tag the validator
+// registered with.
+func (a *API) checkDomainTag(id, tag string) error {
+	if registered := a.domainTags[id]; tag != registered {
+		return fmt.Errorf("domain tag %q doesn't match registered domain tag %q", tag, registered)
+	}
+	return nil
+}
+
+// validatorKey returns the key that signs requests for a validator. Requests
+// that identify a provider chain are signed by the key of the provider chain
+// validator, which is mapped from the consumer chain address by the key
+// assignments of the consumer chain.
+func (a *API) validatorKey(chainID, addr, providerChainID, consumerID string) (validatorKey, error) {
+	if providerChainID == "" && consumerID == "" {
+		key, ok := a.keys[makeID(chainID, addr)]
+		if !ok {
+			return validatorKey{}, errors.New("validator not in valset")
+		}
+		return key, nil
+	}
+
+	cc, ok := a.consumers[chainID]
+	if !ok {
+		return validatorKey{}, fmt.Errorf("chain %s isn't a consumer chain", chainID)
+	}
+	if providerChainID != cc.providerChainID || consumerID != cc.consumerID {
+		return validatorKey{}, fmt.Errorf("consumer chain %s/%s doesn't match %s/%s", providerChainID, consumerID, cc.providerChainID, cc.consumerID)
+	}
+	providerAddr, err := cc.assignments.ProviderAddress(addr)
+	if err != nil {
+		return validatorKey{}, err
+	}
+	key, ok := a.keys[makeID(cc.providerChainID, providerAddr)]
+	if !ok {
+		return validatorKey{}, errors.New("validator not in provider chain valset")
+	}
+	return key, nil
+}
+
+// freshCapabilities are advertised while RequireFreshRequests is enabled.
+const freshCapabilities = mekabuild.CapabilityReplayProtection | mekabuild.CapabilityPresigning | mekabuild.CapabilityMandatoryTxs | mekabuild.CapabilityConfirmation | mekabuild.CapabilityDomainTags | mekabuild.CapabilityConsumerChains
+
+func makeID(chainID, addr string) string {
+	return chainID + ":" + addr
+}
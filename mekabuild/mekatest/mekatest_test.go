@@ -0,0 +1,203 @@
+package mekatest_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+	"github.com/meka-dev/mekatek-go/mekabuild/mekatest"
+)
+
+func TestAPI(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		key       = newKey(t, "validator")
+		api       = mekatest.NewAPI()
+		server    = mekatest.NewServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		newReq    = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1, Txs: [][]byte{[]byte("tx-1"), []byte("tx-2")}}
+		}
+	)
+	builder.SetRetryPolicy(mekabuild.RetryPolicy{MaxAttempts: 1})
+
+	if _, err := builder.BuildBlock(ctx, newReq()); err == nil {
+		t.Fatalf("unknown validator: want error, have none")
+	}
+
+	api.AddPublicKey(chainID, key.addr, key.public)
+
+	resp, err := builder.BuildBlock(ctx, newReq())
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if want, have := "2 chain-id coins", resp.ValidatorPayment; want != have {
+		t.Errorf("default payment: want %q, have %q", want, have)
+	}
+	if want, have := 1, len(api.Builds()); want != have {
+		t.Errorf("builds: want %d, have %d", want, have)
+	}
+
+	api.SetPayment(func(req *mekabuild.BuildBlockRequest) string {
+		return fmt.Sprintf("%duatom", 100*len(req.Txs))
+	})
+	if resp, err := builder.BuildBlock(ctx, newReq()); err != nil || resp.ValidatorPayment != "200uatom" {
+		t.Errorf("payment formula: want 200uatom, have %+v (%v)", resp, err)
+	}
+
+	api.FailNext(1, http.StatusServiceUnavailable)
+	var statusErr *mekabuild.StatusError
+	if _, err := builder.BuildBlock(ctx, newReq()); !errors.As(err, &statusErr) || statusErr.Code != http.StatusServiceUnavailable {
+		t.Errorf("injected failure: want status 503, have %v", err)
+	}
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Errorf("after injected failure: %v", err)
+	}
+
+	api.SetLatency(50 * time.Millisecond)
+	begin := time.Now()
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Errorf("with latency: %v", err)
+	}
+	if took := time.Since(begin); took < 50*time.Millisecond {
+		t.Errorf("latency: want at least 50ms, took %s", took)
+	}
+	api.SetLatencyFunc(nil)
+
+	api.RequireRegistration(true)
+	if _, err := builder.BuildBlock(ctx, newReq()); !mekabuild.IsNotRegistered(err) {
+		t.Errorf("unregistered: want not registered error, have %v", err)
+	}
+	api.SetRegistered(chainID, key.addr, "payment-address")
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Errorf("registered: %v", err)
+	}
+
+	other := newKey(t, "validator")
+	api.AddPublicKey(chainID, key.addr, other.public)
+	if _, err := builder.BuildBlock(ctx, newReq()); err == nil {
+		t.Errorf("bad signature: want error, have none")
+	}
+}
+
+func TestAPIClock(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		key       = newKey(t, "validator")
+		api       = mekatest.NewAPI()
+		server    = mekatest.NewServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		newReq    = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+	builder.SetRetryPolicy(mekabuild.RetryPolicy{MaxAttempts: 1})
+	builder.SetReplayProtection(true)
+	api.AddPublicKey(chainID, key.addr, key.public)
+	api.RequireFreshRequests(time.Minute)
+
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Fatalf("no skew: %v", err)
+	}
+
+	api.SetClockSkew(time.Hour)
+	var statusErr *mekabuild.StatusError
+	if _, err := builder.BuildBlock(ctx, newReq()); !errors.As(err, &statusErr) || statusErr.Code != http.StatusConflict {
+		t.Errorf("skewed: want status 409, have %v", err)
+	}
+
+	resp, err := http.Get(server.URL + "/v0/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skew := time.Until(date); skew < 59*time.Minute || skew > 61*time.Minute {
+		t.Errorf("Date header: want an hour ahead, have %s", skew)
+	}
+
+	api.SetClockSkew(0)
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Errorf("skew removed: %v", err)
+	}
+}
+
+func TestAPIRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	var (
+		api    = mekatest.NewAPI()
+		server = mekatest.NewServer(t, api)
+	)
+
+	api.FailNextRetryAfter(1, http.StatusTooManyRequests, 1500*time.Millisecond)
+	for i, want := range []struct {
+		status     int
+		retryAfter string
+	}{
+		{http.StatusTooManyRequests, "2"},
+		{http.StatusOK, ""},
+	} {
+		resp, err := http.Get(server.URL + "/v0/ping")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want.status || resp.Header.Get("Retry-After") != want.retryAfter {
+			t.Errorf("request %d: want %d with Retry-After %q, have %d with %q", i, want.status, want.retryAfter, resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	}
+}
+
+func TestProgressiveLatency(t *testing.T) {
+	t.Parallel()
+
+	latency := mekatest.ProgressiveLatency(10*time.Millisecond, 20*time.Millisecond, 45*time.Millisecond)
+	for i, want := range []time.Duration{10 * time.Millisecond, 30 * time.Millisecond, 45 * time.Millisecond, 45 * time.Millisecond} {
+		if have := latency(nil); want != have {
+			t.Errorf("request %d: want %s, have %s", i, want, have)
+		}
+	}
+}
+
+type key struct {
+	addr    string
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+func newKey(t *testing.T, addr string) *key {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &key{addr: addr, public: public, private: private}
+}
+
+func (k *key) SignBuildBlockRequest(req *mekabuild.BuildBlockRequest) error {
+	msg, err := req.SignBytes()
+	if err != nil {
+		return err
+	}
+	req.Signature, err = k.private.Sign(nil, msg, crypto.Hash(0))
+	return err
+}
@@ -0,0 +1,112 @@
+package mekabuild
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives observations from the builder, for export to a metrics
+// system. It's intended to be implemented by the Tendermint integration, e.g.
+// with Prometheus collectors registered against the node's registry, so that
+// this package doesn't depend on any particular metrics library.
+//
+// Implementations must be safe for concurrent use, and shouldn't block. They
+// may also implement ThrottleMetrics and DuplicateTxsMetrics.
+type Metrics interface {
+	// ObserveRequest is called after every request to the builder API,
+	// including each retry and failover attempt.
+	ObserveRequest(RequestMetrics)
+
+	// ObservePayment is called after every successful build, with the
+	// payment offered to the validator.
+	ObservePayment(chainID string, height int64, payment string)
+}
+
+// RequestMetrics describes a single request to the builder API.
+type RequestMetrics struct {
+	ChainID  string
+	Endpoint string
+	Path     string
+	Duration time.Duration
+
+	// Err is the error returned by the request, or nil on success.
+	Err error
+
+	// StatusCode is the HTTP status of the response, or 0 if there was no
+	// response, e.g. because of a connection error.
+	StatusCode int
+
+	// RequestBytes is the size of the request body before compression,
+	// and WireBytes the size actually sent.
+	RequestBytes int64
+	WireBytes    int64
+
+	// CompressedBytes is WireBytes if the request was compressed, or 0.
+	CompressedBytes int64
+
+	// ResponseBytes is the size of the response body.
+	ResponseBytes int64
+}
+
+// CompressionRatio returns RequestBytes divided by CompressedBytes, or 0 if the
+// request wasn't compressed.
+func (m RequestMetrics) CompressionRatio() float64 {
+	if m.CompressedBytes == 0 {
+		return 0
+	}
+	return float64(m.RequestBytes) / float64(m.CompressedBytes)
+}
+
+// SetMetrics configures the builder to report observations to m. By default,
+// no metrics are reported.
+func (b *Builder) SetMetrics(m Metrics) {
+	b.metrics.Store(metricsBox{m})
+}
+
+func (b *Builder) getMetrics() Metrics {
+	box, _ := b.metrics.Load().(metricsBox)
+	return box.Metrics
+}
+
+type metricsBox struct{ Metrics }
+
+//
+//
+//
+
+// transfer tracks the bytes transferred by a single request.
+type transfer struct {
+	raw, wire, response int64 // atomic
+	compress            bool
+	statusCode          int
+}
+
+func (t *transfer) compressed() int64 {
+	if !t.compress {
+		return 0
+	}
+	return atomic.LoadInt64(&t.wire)
+}
+
+type countingWriter struct {
+	io.Writer
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
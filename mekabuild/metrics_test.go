@@ -0,0 +1,92 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderMetrics(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", rand.Reader)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		metrics   = &mockMetrics{}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	builder.SetMetrics(metrics)
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{
+		ChainID:          chainID,
+		Height:           7,
+		ValidatorAddress: key.addr,
+		Txs:              [][]byte{bytes.Repeat([]byte("a"), 10000)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := 1, len(metrics.requests); want != have {
+		t.Fatalf("requests: want %d, have %d", want, have)
+	}
+
+	r := metrics.requests[0]
+
+	if want, have := http.StatusOK, r.StatusCode; want != have {
+		t.Errorf("status code: want %d, have %d", want, have)
+	}
+
+	if r.CompressionRatio() <= 10 {
+		t.Errorf("compression ratio: want > 10, have %.2f (%d/%d)", r.CompressionRatio(), r.RequestBytes, r.CompressedBytes)
+	}
+
+	if r.ResponseBytes <= 0 {
+		t.Errorf("response bytes: want > 0, have %d", r.ResponseBytes)
+	}
+
+	if want, have := []string{"1 test-chain-id coins"}, metrics.payments; len(have) != 1 || want[0] != have[0] {
+		t.Errorf("payments: want %q, have %q", want, have)
+	}
+}
+
+type mockMetrics struct {
+	mtx        sync.Mutex
+	requests   []mekabuild.RequestMetrics
+	payments   []string
+	throttles  []mekabuild.ThrottleEvent
+	duplicates []mekabuild.DuplicateTxsEvent
+}
+
+func (m *mockMetrics) ObserveRequest(r mekabuild.RequestMetrics) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.requests = append(m.requests, r)
+}
+
+func (m *mockMetrics) ObservePayment(chainID string, height int64, payment string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.payments = append(m.payments, payment)
+}
+
+func (m *mockMetrics) ObserveThrottle(e mekabuild.ThrottleEvent) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.throttles = append(m.throttles, e)
+}
+
+func (m *mockMetrics) ObserveDuplicateTxs(e mekabuild.DuplicateTxsEvent) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.duplicates = append(m.duplicates, e)
+}
@@ -0,0 +1,729 @@
+package mekabuild
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// MsgpackCodec encodes bodies as MessagePack. Structs are encoded as maps,
+// keyed by their JSON field names, and honor the omitempty and "-" JSON tag
+// options. Types implementing encoding.TextMarshaler, e.g. big.Int and
+// time.Time, are encoded as strings. Byte slices are encoded as binary, so txs
+// aren't inflated by base64, as they are in JSON.
+var MsgpackCodec Codec = msgpackCodec{}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string      { return "application/msgpack" }
+func (msgpackCodec) Capability() Capabilities { return CapabilityMsgpack }
+
+func (msgpackCodec) Encode(w io.Writer, v interface{}) error {
+	bw := bufio.NewWriter(w)
+	e := &msgpackEncoder{w: bw}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (msgpackCodec) Decode(r io.Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("decode into non-pointer %T", v)
+	}
+	d := &msgpackDecoder{r: bufio.NewReader(r)}
+	return d.decode(rv.Elem())
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// jsonField is a struct field, as seen by encoding/json.
+type jsonField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // unexported
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, jsonField{name: name, index: i, omitEmpty: strings.Contains(","+opts+",", ",omitempty,")})
+	}
+	return fields
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+//
+//
+//
+
+type msgpackEncoder struct {
+	w   *bufio.Writer
+	buf [9]byte
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		return e.w.WriteByte(0xc0)
+	}
+
+	if v.Type().Implements(textMarshalerType) && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		return e.encodeString(string(text))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return e.w.WriteByte(0xc0)
+		}
+		return e.encode(v.Elem())
+
+	case reflect.Bool:
+		if v.Bool() {
+			return e.w.WriteByte(0xc3)
+		}
+		return e.w.WriteByte(0xc2)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return e.encodeInt(v.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return e.encodeUint(v.Uint())
+
+	case reflect.Float32, reflect.Float64:
+		e.buf[0] = 0xcb
+		binary.BigEndian.PutUint64(e.buf[1:], math.Float64bits(v.Float()))
+		_, err := e.w.Write(e.buf[:9])
+		return err
+
+	case reflect.String:
+		return e.encodeString(v.String())
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return e.w.WriteByte(0xc0)
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return e.encodeBytes(v)
+		}
+		if err := e.encodeHeader(v.Len(), 0x90, 0xdc, 0xdd, 16); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return e.w.WriteByte(0xc0)
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("%w: map key %s", ErrCodecUnsupported, v.Type().Key())
+		}
+		if err := e.encodeHeader(v.Len(), 0x80, 0xde, 0xdf, 16); err != nil {
+			return err
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.encodeString(iter.Key().String()); err != nil {
+				return err
+			}
+			if err := e.encode(iter.Value()); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Struct:
+		fields := jsonFields(v.Type())
+		present := fields[:0:0]
+		for _, f := range fields {
+			if f.omitEmpty && isEmptyValue(v.Field(f.index)) {
+				continue
+			}
+			present = append(present, f)
+		}
+		if err := e.encodeHeader(len(present), 0x80, 0xde, 0xdf, 16); err != nil {
+			return err
+		}
+		for _, f := range present {
+			if err := e.encodeString(f.name); err != nil {
+				return err
+			}
+			if err := e.encode(v.Field(f.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("%w: %s", ErrCodecUnsupported, v.Type())
+	}
+}
+
+func (e *msgpackEncoder) encodeInt(n int64) error {
+	switch {
+	case n >= 0:
+		return e.encodeUint(uint64(n))
+	case n >= -32:
+		return e.w.WriteByte(byte(n))
+	case n >= math.MinInt8:
+		return e.write(0xd0, uint64(uint8(n)), 1)
+	case n >= math.MinInt16:
+		return e.write(0xd1, uint64(uint16(n)), 2)
+	case n >= math.MinInt32:
+		return e.write(0xd2, uint64(uint32(n)), 4)
+	default:
+		return e.write(0xd3, uint64(n), 8)
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(n uint64) error {
+	switch {
+	case n <= 0x7f:
+		return e.w.WriteByte(byte(n))
+	case n <= math.MaxUint8:
+		return e.write(0xcc, n, 1)
+	case n <= math.MaxUint16:
+		return e.write(0xcd, n, 2)
+	case n <= math.MaxUint32:
+		return e.write(0xce, n, 4)
+	default:
+		return e.write(0xcf, n, 8)
+	}
+}
+
+func (e *msgpackEncoder) encodeString(s string) error {
+	var err error
+	switch n := len(s); {
+	case n <= 31:
+		err = e.w.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		err = e.write(0xd9, uint64(n), 1)
+	case n <= math.MaxUint16:
+		err = e.write(0xda, uint64(n), 2)
+	default:
+		err = e.write(0xdb, uint64(n), 4)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = e.w.WriteString(s)
+	return err
+}
+
+func (e *msgpackEncoder) encodeBytes(v reflect.Value) error {
+	var err error
+	switch n := v.Len(); {
+	case n <= math.MaxUint8:
+		err = e.write(0xc4, uint64(n), 1)
+	case n <= math.MaxUint16:
+		err = e.write(0xc5, uint64(n), 2)
+	default:
+		err = e.write(0xc6, uint64(n), 4)
+	}
+	if err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Slice {
+		_, err = e.w.Write(v.Bytes())
+		return err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := e.w.WriteByte(byte(v.Index(i).Uint())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeHeader writes an array or map header for n elements.
+func (e *msgpackEncoder) encodeHeader(n int, fix, code16, code32 byte, fixMax int) error {
+	switch {
+	case n < fixMax:
+		return e.w.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		return e.write(code16, uint64(n), 2)
+	default:
+		return e.write(code32, uint64(n), 4)
+	}
+}
+
+// write writes the code followed by the size least significant bytes of n,
+// big endian.
+func (e *msgpackEncoder) write(code byte, n uint64, size int) error {
+	e.buf[0] = code
+	binary.BigEndian.PutUint64(e.buf[1:], n<<(8*(8-uint(size))))
+	_, err := e.w.Write(e.buf[:1+size])
+	return err
+}
+
+//
+//
+//
+
+type msgpackDecoder struct {
+	r *bufio.Reader
+}
+
+var errMsgpackTruncated = errors.New("msgpack: truncated input")
+
+func (d *msgpackDecoder) readByte() (byte, error) {
+	c, err := d.r.ReadByte()
+	if err == io.EOF {
+		return 0, errMsgpackTruncated
+	}
+	return c, err
+}
+
+func (d *msgpackDecoder) readN(size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, errMsgpackTruncated
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *msgpackDecoder) readBytes(n uint64) ([]byte, error) {
+	if n > uint64(DefaultMaxDecompressedBytes) {
+		return nil, fmt.Errorf("msgpack: length %d too large", n)
+	}
+	if n <= msgpackMaxPrealloc {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(d.r, buf); err != nil {
+			return nil, errMsgpackTruncated
+		}
+		return buf, nil
+	}
+
+	// Longer lengths are read into a growing buffer, so allocations follow
+	// the bytes actually received, rather than the sender's header.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		return nil, errMsgpackTruncated
+	}
+	return buf.Bytes(), nil
+}
+
+// msgpackMaxPrealloc is the largest length, in bytes or array elements,
+// allocated up front from a header.
+const msgpackMaxPrealloc = 4096
+
+// msgpackValue is a decoded scalar or header.
+type msgpackValue struct {
+	kind  reflect.Kind // Bool, Int64, Uint64, Float64, String, Slice (bin), Array, Map, or Invalid (nil)
+	i     int64
+	u     uint64
+	f     float64
+	b     []byte // string or bin
+	count uint64 // array or map length
+}
+
+func (d *msgpackDecoder) next() (msgpackValue, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return msgpackValue{}, err
+	}
+
+	sized := func(kind reflect.Kind, size int) (msgpackValue, error) {
+		n, err := d.readN(size)
+		if err != nil {
+			return msgpackValue{}, err
+		}
+		switch kind {
+		case reflect.String, reflect.Slice:
+			b, err := d.readBytes(n)
+			return msgpackValue{kind: kind, b: b}, err
+		case reflect.Array, reflect.Map:
+			return msgpackValue{kind: kind, count: n}, nil
+		case reflect.Uint64:
+			return msgpackValue{kind: kind, u: n}, nil
+		default: // signed, sign extend
+			shift := uint(64 - 8*size)
+			return msgpackValue{kind: reflect.Int64, i: int64(n<<shift) >> shift}, nil
+		}
+	}
+
+	switch {
+	case c <= 0x7f:
+		return msgpackValue{kind: reflect.Uint64, u: uint64(c)}, nil
+	case c >= 0xe0:
+		return msgpackValue{kind: reflect.Int64, i: int64(int8(c))}, nil
+	case c&0xf0 == 0x80:
+		return msgpackValue{kind: reflect.Map, count: uint64(c & 0x0f)}, nil
+	case c&0xf0 == 0x90:
+		return msgpackValue{kind: reflect.Array, count: uint64(c & 0x0f)}, nil
+	case c&0xe0 == 0xa0:
+		b, err := d.readBytes(uint64(c & 0x1f))
+		return msgpackValue{kind: reflect.String, b: b}, err
+	}
+
+	switch c {
+	case 0xc0:
+		return msgpackValue{kind: reflect.Invalid}, nil
+	case 0xc2, 0xc3:
+		return msgpackValue{kind: reflect.Bool, u: uint64(c & 1)}, nil
+	case 0xc4:
+		return sized(reflect.Slice, 1)
+	case 0xc5:
+		return sized(reflect.Slice, 2)
+	case 0xc6:
+		return sized(reflect.Slice, 4)
+	case 0xca:
+		n, err := d.readN(4)
+		return msgpackValue{kind: reflect.Float64, f: float64(math.Float32frombits(uint32(n)))}, err
+	case 0xcb:
+		n, err := d.readN(8)
+		return msgpackValue{kind: reflect.Float64, f: math.Float64frombits(n)}, err
+	case 0xcc:
+		return sized(reflect.Uint64, 1)
+	case 0xcd:
+		return sized(reflect.Uint64, 2)
+	case 0xce:
+		return sized(reflect.Uint64, 4)
+	case 0xcf:
+		return sized(reflect.Uint64, 8)
+	case 0xd0:
+		return sized(reflect.Int64, 1)
+	case 0xd1:
+		return sized(reflect.Int64, 2)
+	case 0xd2:
+		return sized(reflect.Int64, 4)
+	case 0xd3:
+		return sized(reflect.Int64, 8)
+	case 0xd9:
+		return sized(reflect.String, 1)
+	case 0xda:
+		return sized(reflect.String, 2)
+	case 0xdb:
+		return sized(reflect.String, 4)
+	case 0xdc:
+		return sized(reflect.Array, 2)
+	case 0xdd:
+		return sized(reflect.Array, 4)
+	case 0xde:
+		return sized(reflect.Map, 2)
+	case 0xdf:
+		return sized(reflect.Map, 4)
+	default:
+		return msgpackValue{}, fmt.Errorf("%w: msgpack type 0x%02x", ErrCodecUnsupported, c)
+	}
+}
+
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	mv, err := d.next()
+	if err != nil {
+		return err
+	}
+	return d.decodeValue(mv, v)
+}
+
+func (d *msgpackDecoder) decodeValue(mv msgpackValue, v reflect.Value) error {
+	if mv.kind == reflect.Invalid {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if !v.Type().Implements(textUnmarshalerType) {
+			return d.decodeValue(mv, v.Elem())
+		}
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		v = v.Addr()
+	}
+	if v.Type().Implements(textUnmarshalerType) && mv.kind == reflect.String {
+		return v.Interface().(encoding.TextUnmarshaler).UnmarshalText(mv.b)
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("msgpack: can't decode %s into %s", mv.kind, v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return mismatch()
+		}
+		x, err := d.generic(mv)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+
+	case reflect.Bool:
+		if mv.kind != reflect.Bool {
+			return mismatch()
+		}
+		v.SetBool(mv.u == 1)
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch mv.kind {
+		case reflect.Int64:
+			n = mv.i
+		case reflect.Uint64:
+			if mv.u > math.MaxInt64 {
+				return mismatch()
+			}
+			n = int64(mv.u)
+		default:
+			return mismatch()
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("msgpack: %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch {
+		case mv.kind == reflect.Uint64:
+			n = mv.u
+		case mv.kind == reflect.Int64 && mv.i >= 0:
+			n = uint64(mv.i)
+		default:
+			return mismatch()
+		}
+		if v.OverflowUint(n) {
+			return fmt.Errorf("msgpack: %d overflows %s", n, v.Type())
+		}
+		v.SetUint(n)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		switch mv.kind {
+		case reflect.Float64:
+			v.SetFloat(mv.f)
+		case reflect.Int64:
+			v.SetFloat(float64(mv.i))
+		case reflect.Uint64:
+			v.SetFloat(float64(mv.u))
+		default:
+			return mismatch()
+		}
+		return nil
+
+	case reflect.String:
+		if mv.kind != reflect.String {
+			return mismatch()
+		}
+		v.SetString(string(mv.b))
+		return nil
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if mv.kind != reflect.Slice && mv.kind != reflect.String {
+				return mismatch()
+			}
+			v.SetBytes(mv.b)
+			return nil
+		}
+		if mv.kind != reflect.Array {
+			return mismatch()
+		}
+		if mv.count > uint64(DefaultMaxDecompressedBytes) {
+			return fmt.Errorf("msgpack: length %d too large", mv.count)
+		}
+		prealloc := mv.count
+		if prealloc > msgpackMaxPrealloc {
+			prealloc = msgpackMaxPrealloc
+		}
+		s := reflect.MakeSlice(v.Type(), 0, int(prealloc))
+		for i := uint64(0); i < mv.count; i++ {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(elem); err != nil {
+				return err
+			}
+			s = reflect.Append(s, elem)
+		}
+		v.Set(s)
+		return nil
+
+	case reflect.Map:
+		if mv.kind != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return mismatch()
+		}
+		m := reflect.MakeMap(v.Type())
+		for i := uint64(0); i < mv.count; i++ {
+			key, err := d.mapKey()
+			if err != nil {
+				return err
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(elem); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		v.Set(m)
+		return nil
+
+	case reflect.Struct:
+		if mv.kind != reflect.Map {
+			return mismatch()
+		}
+		fields := jsonFields(v.Type())
+		for i := uint64(0); i < mv.count; i++ {
+			key, err := d.mapKey()
+			if err != nil {
+				return err
+			}
+			target := reflect.Value{}
+			for _, f := range fields {
+				if f.name == key {
+					target = v.Field(f.index)
+					break
+				}
+			}
+			if !target.IsValid() {
+				if err := d.skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(target); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("%w: %s", ErrCodecUnsupported, v.Type())
+	}
+}
+
+func (d *msgpackDecoder) mapKey() (string, error) {
+	mv, err := d.next()
+	if err != nil {
+		return "", err
+	}
+	if mv.kind != reflect.String {
+		return "", fmt.Errorf("msgpack: map key is %s, not string", mv.kind)
+	}
+	return string(mv.b), nil
+}
+
+// generic decodes mv into the types used by encoding/json for interface{}
+// values, except that binary is decoded as []byte.
+func (d *msgpackDecoder) generic(mv msgpackValue) (interface{}, error) {
+	switch mv.kind {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Bool:
+		return mv.u == 1, nil
+	case reflect.Int64:
+		return float64(mv.i), nil
+	case reflect.Uint64:
+		return float64(mv.u), nil
+	case reflect.Float64:
+		return mv.f, nil
+	case reflect.String:
+		return string(mv.b), nil
+	case reflect.Slice:
+		return mv.b, nil
+	case reflect.Array:
+		var out []interface{}
+		for i := uint64(0); i < mv.count; i++ {
+			next, err := d.next()
+			if err != nil {
+				return nil, err
+			}
+			x, err := d.generic(next)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, x)
+		}
+		return out, nil
+	default: // map
+		out := map[string]interface{}{}
+		for i := uint64(0); i < mv.count; i++ {
+			key, err := d.mapKey()
+			if err != nil {
+				return nil, err
+			}
+			next, err := d.next()
+			if err != nil {
+				return nil, err
+			}
+			x, err := d.generic(next)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = x
+		}
+		return out, nil
+	}
+}
+
+// skip discards the next value, including any nested values.
+func (d *msgpackDecoder) skip() error {
+	mv, err := d.next()
+	if err != nil {
+		return err
+	}
+	_, err = d.generic(mv)
+	return err
+}
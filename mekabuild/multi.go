@@ -0,0 +1,168 @@
+package mekabuild
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MultiBuilder fans out build requests to several builders concurrently, e.g.
+// one per regional builder API endpoint, for redundancy.
+type MultiBuilder struct {
+	builders []*Builder
+}
+
+// NewMultiBuilder returns a multi-builder over the provided builders, which
+// should be given in order of preference.
+func NewMultiBuilder(builders ...*Builder) *MultiBuilder {
+	return &MultiBuilder{builders: builders}
+}
+
+// BuildBlock submits the build request to every builder concurrently, and
+// returns the response from the most preferred successful builder, as soon as
+// every more preferred builder has failed. Less preferred builders still
+// running at that point are left to finish in the background, and reported as
+// pending.
+//
+// If every builder fails, BuildBlock returns a nil response and a *MultiError.
+// If some builders fail but at least one succeeds, BuildBlock returns the
+// chosen response AND a *MultiError describing the degraded redundancy. Use
+// IsPartialFailure to distinguish that case from total failure.
+func (m *MultiBuilder) BuildBlock(ctx context.Context, req *BuildBlockRequest) (*BuildBlockResponse, error) {
+	if len(m.builders) == 0 {
+		return nil, errors.New("no builders configured")
+	}
+
+	type result struct {
+		index    int
+		endpoint string
+		resp     *BuildBlockResponse
+		err      error
+	}
+
+	results := make(chan result, len(m.builders)) // buffered, so abandoned builders don't block
+	for i, b := range m.builders {
+		go func(i int, b *Builder, req BuildBlockRequest) {
+			var endpoint string
+			resp, err := b.BuildBlock(withEndpointRecorder(ctx, &endpoint), &req)
+			results <- result{i, endpoint, resp, err}
+		}(i, b, *req) // each builder signs its own copy
+	}
+
+	outcomes := make([]EndpointOutcome, len(m.builders))
+	for i := range outcomes {
+		outcomes[i].Pending = true
+	}
+
+	var (
+		chosen *BuildBlockResponse
+		failed bool
+		next   int // most preferred builder that hasn't settled
+	)
+	for next < len(outcomes) && chosen == nil {
+		r := <-results
+		outcomes[r.index] = EndpointOutcome{Endpoint: r.endpoint, Response: r.resp, Err: r.err}
+
+		for ; next < len(outcomes) && !outcomes[next].Pending; next++ {
+			if outcomes[next].Err != nil {
+				failed = true
+				continue
+			}
+			chosen = outcomes[next].Response
+			outcomes[next].Chosen = true
+			break
+		}
+	}
+
+	for _, o := range outcomes {
+		failed = failed || o.Err != nil // less preferred builders that already failed
+	}
+
+	if !failed {
+		return chosen, nil
+	}
+
+	return chosen, &MultiError{Outcomes: outcomes}
+}
+
+// endpointRecorderKey is the context key of the endpoint recorded by
+// Builder.BuildBlock, see withEndpointRecorder.
+type endpointRecorderKey struct{}
+
+// withEndpointRecorder returns a context in which Builder.BuildBlock records
+// the builder API endpoint the build request was last sent to in *endpoint.
+func withEndpointRecorder(ctx context.Context, endpoint *string) context.Context {
+	return context.WithValue(ctx, endpointRecorderKey{}, endpoint)
+}
+
+func recordEndpoint(ctx context.Context, endpoint string) {
+	if p, ok := ctx.Value(endpointRecorderKey{}).(*string); ok {
+		*p = endpoint
+	}
+}
+
+// EndpointOutcome is the result of a build request to a single endpoint.
+type EndpointOutcome struct {
+	// Endpoint is the builder API endpoint the build request was last sent
+	// to, which is empty if it wasn't sent, e.g. if the builder was
+	// disabled, or if the builder is pending.
+	Endpoint string
+	Response *BuildBlockResponse
+	Err      error
+	Chosen   bool
+
+	// Pending is set if the builder hadn't responded when the response was
+	// chosen.
+	Pending bool
+}
+
+// MultiError is returned by MultiBuilder.BuildBlock when at least one builder
+// failed. It details the outcome for every builder, in order of preference.
+type MultiError struct {
+	Outcomes []EndpointOutcome
+}
+
+// Error implements the error interface.
+func (e *MultiError) Error() string {
+	var (
+		failures []string
+		chosen   string
+		partial  bool
+	)
+	for i, o := range e.Outcomes {
+		name := o.Endpoint
+		if name == "" {
+			name = fmt.Sprintf("builder %d", i)
+		}
+		if o.Err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, o.Err))
+		}
+		if o.Chosen {
+			chosen, partial = name, true
+		}
+	}
+
+	if partial {
+		return fmt.Sprintf("%d/%d builders failed, used %s (%s)", len(failures), len(e.Outcomes), chosen, strings.Join(failures, "; "))
+	}
+
+	return fmt.Sprintf("all %d builders failed (%s)", len(e.Outcomes), strings.Join(failures, "; "))
+}
+
+// Partial returns true if at least one builder succeeded.
+func (e *MultiError) Partial() bool {
+	for _, o := range e.Outcomes {
+		if o.Chosen {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPartialFailure returns true if err is a *MultiError where at least one
+// builder succeeded, meaning a response is available despite the error.
+func IsPartialFailure(err error) bool {
+	var me *MultiError
+	return errors.As(err, &me) && me.Partial()
+}
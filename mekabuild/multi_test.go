@@ -0,0 +1,139 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestMultiBuilderPartialFailure(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		chainID = "test-chain-id"
+		key     = newMockKey(t, "foo", rand.Reader)
+		api     = newMockAPI()
+		good    = newTestServer(t, api)
+		bad     = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		badURL, _  = url.Parse(bad.URL)
+		goodURL, _ = url.Parse(good.URL)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	multi := mekabuild.NewMultiBuilder(
+		mekabuild.NewBuilder(&http.Client{}, badURL, key, chainID, key.addr),
+		mekabuild.NewBuilder(&http.Client{}, goodURL, key, chainID, key.addr),
+	)
+
+	resp, err := multi.BuildBlock(ctx, &mekabuild.BuildBlockRequest{
+		ChainID:          chainID,
+		Height:           1,
+		ValidatorAddress: key.addr,
+		Txs:              [][]byte{[]byte(`tx1`)},
+	})
+	if resp == nil {
+		t.Fatalf("want response, have none (%v)", err)
+	}
+
+	if !mekabuild.IsPartialFailure(err) {
+		t.Fatalf("want partial failure, have %v", err)
+	}
+
+	var me *mekabuild.MultiError
+	errors.As(err, &me)
+
+	if want, have := false, me.Outcomes[0].Err == nil; want != have {
+		t.Errorf("outcome 0 success: want %v, have %v", want, have)
+	}
+
+	if want, have := true, me.Outcomes[1].Chosen; want != have {
+		t.Errorf("outcome 1 chosen: want %v, have %v", want, have)
+	}
+}
+
+func TestMultiBuilderFailoverEndpoint(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		chainID = "test-chain-id"
+		key     = newMockKey(t, "foo", rand.Reader)
+		api     = newMockAPI()
+		good    = newTestServer(t, api)
+		bad     = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		badURL, _  = url.Parse(bad.URL)
+		goodURL, _ = url.Parse(good.URL)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	failover := mekabuild.NewBuilder(&http.Client{}, badURL, key, chainID, key.addr)
+	if err := failover.SetEndpoints(badURL, goodURL); err != nil {
+		t.Fatal(err)
+	}
+
+	multi := mekabuild.NewMultiBuilder(
+		mekabuild.NewBuilder(&http.Client{}, badURL, key, chainID, key.addr),
+		failover,
+	)
+
+	_, err := multi.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr})
+	var me *mekabuild.MultiError
+	if !errors.As(err, &me) || !me.Partial() {
+		t.Fatalf("want partial failure, have %v", err)
+	}
+
+	if want, have := bad.URL, me.Outcomes[0].Endpoint; want != have {
+		t.Errorf("outcome 0 endpoint: want %s, have %s", want, have)
+	}
+	if want, have := good.URL, me.Outcomes[1].Endpoint; want != have {
+		t.Errorf("outcome 1 endpoint: want %s, have %s", want, have)
+	}
+}
+
+func TestMultiBuilderDoesntWaitForLessPreferred(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		chainID = "test-chain-id"
+		key     = newMockKey(t, "foo", rand.Reader)
+		api     = newMockAPI()
+		good    = newTestServer(t, api)
+		release = make(chan struct{})
+		slow    = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		goodURL, _ = url.Parse(good.URL)
+		slowURL, _ = url.Parse(slow.URL)
+	)
+	t.Cleanup(func() { close(release) }) // before the servers are closed
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	multi := mekabuild.NewMultiBuilder(
+		mekabuild.NewBuilder(&http.Client{}, goodURL, key, chainID, key.addr),
+		mekabuild.NewBuilder(&http.Client{}, slowURL, key, chainID, key.addr),
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	resp, err := multi.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil {
+		t.Fatal("want response, have none")
+	}
+	if ctx.Err() != nil {
+		t.Errorf("waited for the less preferred builder")
+	}
+}
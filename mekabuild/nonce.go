@@ -0,0 +1,188 @@
+package mekabuild
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// bindReplayProtection prefixes sign bytes with the request nonce and
+// timestamp. Requests without either produce the original sign bytes, so
+// signatures remain compatible with builder APIs that don't support replay
+// protection.
+func bindReplayProtection(nonce uint64, timestamp int64, signBytes []byte) []byte {
+	if nonce == 0 && timestamp == 0 {
+		return signBytes
+	}
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`replay-protection-`))
+	mustEncode(&sb, nonce)
+	mustEncode(&sb, timestamp)
+	mustEncode(&sb, signBytes)
+	return sb.Bytes()
+}
+
+// SetReplayProtection enables or disables replay protection. When enabled,
+// build and presign requests carry a nonce and timestamp, which are covered by
+// their signature, so the builder API can reject captured requests that are
+// sent again, see ReplayGuard. Retries and failovers are signed afresh, with a
+// new nonce. It's disabled by default, and should only be enabled once the
+// builder API accepts nonces.
+//
+// Replay protection is enabled locally, rather than negotiated, as
+// capabilities are advertised in unauthenticated headers, which an attacker
+// could strip to downgrade requests.
+func (b *Builder) SetReplayProtection(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&b.replayProtection, 1)
+	} else {
+		atomic.StoreInt32(&b.replayProtection, 0)
+	}
+}
+
+// WithReplayProtection enables or disables replay protection. See
+// SetReplayProtection.
+func WithReplayProtection(enabled bool) Option {
+	return func(b *Builder) error {
+		b.SetReplayProtection(enabled)
+		return nil
+	}
+}
+
+func (b *Builder) replayProtected() bool {
+	return atomic.LoadInt32(&b.replayProtection) != 0
+}
+
+// nextNonce returns a nonce greater than any previously returned by the
+// builder. Nonces are derived from the current time, so they keep increasing
+// across restarts, as long as the clock doesn't move backwards.
+func (b *Builder) nextNonce(now time.Time) uint64 {
+	for {
+		prev := atomic.LoadUint64(&b.nonce)
+		next := uint64(now.UnixNano())
+		if next <= prev {
+			next = prev + 1
+		}
+		if atomic.CompareAndSwapUint64(&b.nonce, prev, next) {
+			return next
+		}
+	}
+}
+
+// setReplayProtection sets the request nonce and timestamp, if replay
+// protection is enabled, and the caller hasn't set them already.
+func (b *Builder) setReplayProtection(req *BuildBlockRequest) {
+	if !b.replayProtected() {
+		return
+	}
+	if req.Nonce != 0 || req.Timestamp != 0 {
+		return
+	}
+	now := b.now()
+	req.Nonce = b.nextNonce(now)
+	req.Timestamp = now.UnixNano() / int64(time.Millisecond)
+}
+
+// buildAttempts provides the build request of every attempt to doAttempts.
+// Requests with a nonce are signed afresh, with a new nonce, for every attempt
+// after the first, as the first may have reached the builder API even if its
+// response was lost, in which case resending it would be rejected as a replay.
+// Presigned requests are signed with the session key of their presignature,
+// see represign, so retries don't wait on the validator key either.
+type buildAttempts struct {
+	b   *Builder
+	req *BuildBlockRequest // the last sent
+	hdr http.Header
+}
+
+func (a *buildAttempts) next(attempt int) (interface{}, http.Header, error) {
+	if attempt == 1 || a.req.Nonce == 0 {
+		return a.req, a.hdr, nil
+	}
+
+	var (
+		req = *a.req
+		now = a.b.now()
+	)
+	nonce, timestamp := a.b.nextNonce(now), now.UnixNano()/int64(time.Millisecond)
+
+	var presigned bool
+	if a.req.Presign != nil {
+		var err error
+		if presigned, err = a.b.represign(&req, a.req.Presign, nonce, timestamp); err != nil {
+			return nil, nil, fmt.Errorf("presign request: %w", err)
+		}
+	}
+	if !presigned {
+		req.Nonce, req.Timestamp = nonce, timestamp
+		req.Signature, req.Presign, req.Cosigners = nil, nil, nil
+		if err := a.b.signBuild(&req); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	hdr := a.hdr.Clone()
+	if hdr == nil {
+		hdr = http.Header{}
+	}
+	a.req, a.hdr = a.b.applySignatureScheme(&req, hdr), hdr
+	return a.req, a.hdr, nil
+}
+
+// Errors returned by ReplayGuard.
+var (
+	ErrReplayedRequest = errors.New("replayed request")
+	ErrStaleRequest    = errors.New("stale request")
+)
+
+// ReplayGuard rejects replayed build requests in the builder API. It tracks
+// the highest nonce seen per chain and validator, and rejects requests whose
+// nonce isn't higher, or whose timestamp is too far from the current time.
+// Requests must be checked after their signature has been verified. Requests
+// without a nonce are rejected, so a guard should only be used for validators
+// that have enabled replay protection, see Builder.SetReplayProtection.
+//
+// State is kept in memory, so a guard should be shared by all handlers in a
+// process.
+type ReplayGuard struct {
+	maxSkew time.Duration
+
+	mtx   sync.Mutex
+	nonce map[string]uint64
+}
+
+// NewReplayGuard returns a guard that accepts timestamps up to maxSkew before
+// or after the current time.
+func NewReplayGuard(maxSkew time.Duration) *ReplayGuard {
+	return &ReplayGuard{maxSkew: maxSkew, nonce: map[string]uint64{}}
+}
+
+// Check returns an error wrapping ErrReplayedRequest or ErrStaleRequest if the
+// request should be rejected. Otherwise, it records the request's nonce, and
+// returns nil.
+func (g *ReplayGuard) Check(req *BuildBlockRequest, now time.Time) error {
+	if req.Nonce == 0 || req.Timestamp == 0 {
+		return fmt.Errorf("%w: missing nonce or timestamp", ErrStaleRequest)
+	}
+
+	signed := time.Unix(0, req.Timestamp*int64(time.Millisecond))
+	if skew := now.Sub(signed); skew > g.maxSkew || skew < -g.maxSkew {
+		return fmt.Errorf("%w: signed at %s, %s from now", ErrStaleRequest, signed.UTC().Format(time.RFC3339Nano), skew)
+	}
+
+	key := req.ChainID + "/" + req.ValidatorAddress
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if last := g.nonce[key]; req.Nonce <= last {
+		return fmt.Errorf("%w: nonce %d not above %d", ErrReplayedRequest, req.Nonce, last)
+	}
+	g.nonce[key] = req.Nonce
+	return nil
+}
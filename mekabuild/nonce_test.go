@@ -0,0 +1,167 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderReplayProtection(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx     = context.Background()
+		chainID = "chain-id"
+		key     = newMockKey(t, "validator", nil)
+		api     = newMockAPI()
+		guard   = mekabuild.NewReplayGuard(time.Minute)
+
+		mtx      sync.Mutex
+		captured [][]byte
+
+		server = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mtx.Lock()
+			captured = append(captured, body)
+			mtx.Unlock()
+
+			var req mekabuild.BuildBlockRequest
+			if err := json.Unmarshal(body, &req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := guard.Check(&req, time.Now()); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	builder.SetReplayProtection(true)
+
+	var nonces []uint64
+	for i := 0; i < 3; i++ {
+		req := &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}
+		if _, err := builder.BuildBlock(ctx, req); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		nonces = append(nonces, req.Nonce)
+	}
+
+	if nonces[0] == 0 || nonces[1] <= nonces[0] || nonces[2] <= nonces[1] {
+		t.Errorf("nonces not increasing from the first request: %v", nonces)
+	}
+
+	resp, err := http.Post(server.URL+"/v0/build", "application/json", bytes.NewReader(captured[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if want, have := http.StatusConflict, resp.StatusCode; want != have {
+		t.Errorf("replayed request: want status %d, have %d", want, have)
+	}
+}
+
+func TestBuilderReplayProtectionRetry(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx     = context.Background()
+		chainID = "chain-id"
+		key     = newMockKey(t, "validator", nil)
+		api     = newMockAPI()
+		server  = newTestServer(t, api)
+		lost    int32
+		lossy   = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			api.ServeHTTP(httptest.NewRecorder(), r) // accepted, but the response is lost
+			atomic.AddInt32(&lost, 1)
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}))
+		apiURL, _   = url.Parse(server.URL)
+		lossyURL, _ = url.Parse(lossy.URL)
+		builder     = mekabuild.NewBuilder(&http.Client{}, lossyURL, key, chainID, key.addr)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	api.RequireFreshRequests(time.Minute)
+	builder.SetReplayProtection(true)
+	if err := builder.SetEndpoints(lossyURL, apiURL); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}); err != nil {
+		t.Fatalf("failover: %v", err)
+	}
+	if want, have := int32(1), atomic.LoadInt32(&lost); want != have {
+		t.Errorf("lost responses: want %d, have %d", want, have)
+	}
+	if want, have := 2, len(api.Builds()); want != have {
+		t.Errorf("builds accepted: want %d, have %d", want, have)
+	}
+}
+
+func TestReplayGuard(t *testing.T) {
+	var (
+		now   = time.Now()
+		guard = mekabuild.NewReplayGuard(time.Second)
+		ts    = func(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+	)
+
+	for _, tc := range []struct {
+		name  string
+		nonce uint64
+		ts    int64
+		want  error
+	}{
+		{"first", 10, ts(now), nil},
+		{"higher nonce", 11, ts(now), nil},
+		{"same nonce", 11, ts(now), mekabuild.ErrReplayedRequest},
+		{"lower nonce", 5, ts(now), mekabuild.ErrReplayedRequest},
+		{"too old", 12, ts(now.Add(-time.Minute)), mekabuild.ErrStaleRequest},
+		{"too new", 13, ts(now.Add(time.Minute)), mekabuild.ErrStaleRequest},
+		{"missing", 0, 0, mekabuild.ErrStaleRequest},
+	} {
+		req := &mekabuild.BuildBlockRequest{ChainID: "chain-id", ValidatorAddress: "validator", Nonce: tc.nonce, Timestamp: tc.ts}
+		if err := guard.Check(req, now); !errors.Is(err, tc.want) {
+			t.Errorf("%s: want %v, have %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestBuildBlockRequestSignBytesNonce(t *testing.T) {
+	var (
+		req       = mekabuild.BuildBlockRequest{ChainID: "chain", Height: 1}
+		legacy, _ = req.SignBytes()
+	)
+
+	req.Nonce = 1
+	withNonce, _ := req.SignBytes()
+	if bytes.Equal(legacy, withNonce) {
+		t.Errorf("nonce isn't bound in sign bytes")
+	}
+
+	req.Timestamp = 1
+	withTimestamp, _ := req.SignBytes()
+	if bytes.Equal(withNonce, withTimestamp) {
+		t.Errorf("timestamp isn't bound in sign bytes")
+	}
+}
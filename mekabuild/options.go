@@ -0,0 +1,102 @@
+package mekabuild
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option configures a builder constructed via New.
+type Option func(*Builder) error
+
+// New returns a usable builder, configured by the given options. Unlike
+// NewBuilder, it returns an error if the validator address or any option is
+// invalid, rather than failing each request.
+//
+// By default, the builder uses a zero value http.Client, see
+// WithTransportConfig for a tuned one, and sends requests to the URL returned
+// by GetBuilderAPIURL. The provenance of the URL is logged,
+// and reported by SelfTest, see ResolveEndpoint.
+func New(s Signer, chainID, validatorAddr string, opts ...Option) (*Builder, error) {
+	res := ResolveEndpoint()
+	b := newBuilder(&http.Client{}, res.URL, s, chainID, validatorAddr)
+	if b.addrErr != nil {
+		return nil, b.addrErr
+	}
+	b.resolution = &res
+
+	for _, opt := range opts {
+		if err := opt(b); err != nil {
+			return nil, err
+		}
+	}
+
+	b.getLogger().Infof("resolved builder API endpoint: chain_id=%s %s", b.chainID, b.EndpointResolution())
+	return b, nil
+}
+
+// WithHTTPClient sets the HTTP client used to make requests to the builder
+// API. Options that decorate the client, like WithUserAgent, should follow it.
+func WithHTTPClient(cli *http.Client) Option {
+	return func(b *Builder) error {
+		if cli == nil {
+			return errors.New("HTTP client must not be nil")
+		}
+		b.client = cli
+		return nil
+	}
+}
+
+// WithEndpoints sets the builder API endpoints. See SetEndpoints.
+func WithEndpoints(urls ...*url.URL) Option {
+	return func(b *Builder) error {
+		return b.SetEndpoints(urls...)
+	}
+}
+
+// WithTimeout bounds each call to the builder API. See SetTimeout.
+func WithTimeout(d time.Duration) Option {
+	return func(b *Builder) error {
+		return b.SetTimeout(d)
+	}
+}
+
+// WithCompression enables or disables request compression, and sets the gzip
+// compression level. See SetCompression and SetCompressionLevel.
+func WithCompression(enabled bool, level int) Option {
+	return func(b *Builder) error {
+		b.SetCompression(enabled)
+		return b.SetCompressionLevel(level)
+	}
+}
+
+// WithLogger sets the builder's logger. See SetLogger.
+func WithLogger(l Logger) Option {
+	return func(b *Builder) error {
+		b.SetLogger(l)
+		return nil
+	}
+}
+
+// WithRetry sets the builder's retry policy. See SetRetryPolicy.
+func WithRetry(p RetryPolicy) Option {
+	return func(b *Builder) error {
+		return b.SetRetryPolicy(p)
+	}
+}
+
+// WithUserAgent sets the User-Agent header on requests to the builder API. The
+// HTTP client is copied, so the client passed to WithHTTPClient isn't modified.
+func WithUserAgent(userAgent string) Option {
+	return func(b *Builder) error {
+		cli := *b.client
+		rt := cli.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		cli.Transport = UserAgentDecorator(userAgent)(rt)
+		b.client = &cli
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestNewOptions(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		key       = newMockKey(t, "validator", nil)
+		api       = newMockAPI()
+		userAgent = make(chan string, 1)
+		server    = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case userAgent <- r.UserAgent():
+			default:
+			}
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		client    = &http.Client{}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithHTTPClient(client),
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithTimeout(time.Second),
+		mekabuild.WithCompression(true, 1),
+		mekabuild.WithRetry(mekabuild.DefaultRetryPolicy),
+		mekabuild.WithUserAgent("mekatek-test/1.0"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, ValidatorAddress: key.addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := "mekatek-test/1.0", <-userAgent; want != have {
+		t.Errorf("user agent: want %q, have %q", want, have)
+	}
+
+	if client.Transport != nil {
+		t.Errorf("WithUserAgent modified the provided HTTP client")
+	}
+}
+
+func TestNewTimeout(t *testing.T) {
+	t.Parallel()
+
+	var (
+		release = make(chan struct{})
+		server  = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		key       = newMockKey(t, "validator", nil)
+	)
+	defer server.Close()
+	defer close(release)
+
+	builder, err := mekabuild.New(key, "chain-id", key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithTimeout(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = builder.BuildBlock(context.Background(), &mekabuild.BuildBlockRequest{ChainID: "chain-id", ValidatorAddress: key.addr})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want %v, have %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	t.Parallel()
+
+	key := newMockKey(t, "validator", nil)
+
+	operatorAddr, err := mekabuild.ConsensusAddressToBech32("cosmosvaloper", "0123456789ABCDEF0123456789ABCDEF01234567")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mekabuild.New(key, "chain-id", operatorAddr); !errors.Is(err, mekabuild.ErrAddressKind) {
+		t.Errorf("operator address: want %v, have %v", mekabuild.ErrAddressKind, err)
+	}
+
+	if _, err := mekabuild.New(key, "chain-id", key.addr, mekabuild.WithTimeout(-time.Second)); err == nil {
+		t.Errorf("negative timeout: want error, have none")
+	}
+
+	if _, err := mekabuild.New(key, "chain-id", key.addr, mekabuild.WithCompression(true, 42)); err == nil {
+		t.Errorf("invalid compression level: want error, have none")
+	}
+}
@@ -0,0 +1,162 @@
+package mekabuild
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Pausing opts a registered validator out of the builder API for a while,
+// e.g. during maintenance: the builder API stops running auctions for it, and
+// rejects its build requests, until the pause ends or the validator resumes.
+// Unlike deregistering, the registration, and its payment address, are kept.
+//
+// Pausing requires CapabilityPause, and a signer that implements PauseSigner.
+// While paused, BuildBlock fails fast with an error wrapping ErrPaused, so
+// blocks are assembled by the fallback, if any.
+
+// PauseRequest is sent to the pause endpoint of the builder API, to pause or
+// resume a validator. Like BuildBlockRequest, it contains a Signature field
+// that needs to be set by signers.
+type PauseRequest struct {
+	ChainID          string `json:"chain_id"`
+	ValidatorAddress string `json:"validator_address"`
+
+	// UntilMillis is the end of the pause, in Unix milliseconds, or zero
+	// to resume.
+	UntilMillis int64 `json:"until_ms"`
+
+	// Timestamp is the signing time in Unix milliseconds, so captured
+	// requests can't be replayed later, e.g. to resume a paused validator.
+	Timestamp int64 `json:"timestamp"`
+
+	KeyType         string `json:"key_type,omitempty"`
+	DomainTag       string `json:"domain_tag,omitempty"`
+	ProviderChainID string `json:"provider_chain_id,omitempty"`
+	ConsumerID      string `json:"consumer_id,omitempty"`
+	Signature       []byte `json:"signature"`
+}
+
+// SignBytes returns the bytes that should be signed by the validator key,
+// honoring the request's KeyType, DomainTag and consumer chain.
+func (r *PauseRequest) SignBytes() []byte {
+	signBytes := bindKeyType(r.KeyType, PauseRequestSignBytes(r.ChainID, r.ValidatorAddress, r.UntilMillis, r.Timestamp))
+	signBytes = bindDomainTag(r.DomainTag, signBytes)
+	return bindConsumerChain(r.ProviderChainID, r.ConsumerID, signBytes)
+}
+
+// PauseRequestSignBytes returns a stable byte representation of a pause, or,
+// with a zero untilMillis, a resume.
+func PauseRequestSignBytes(chainID, validatorAddr string, untilMillis, timestamp int64) []byte {
+	// XXX: As with BuildBlockRequestSignBytes, changing the order or the set
+	// of fields requires updating both the builder API and its clients.
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`validator-pause`))
+	mustEncode(&sb, uint64(len([]byte(chainID))))
+	mustEncode(&sb, []byte(chainID))
+	mustEncode(&sb, uint64(len([]byte(validatorAddr))))
+	mustEncode(&sb, []byte(validatorAddr))
+	mustEncode(&sb, untilMillis)
+	mustEncode(&sb, timestamp)
+	return sb.Bytes()
+}
+
+// PauseResponse is returned by the pause endpoint of the builder API.
+type PauseResponse struct {
+	// PausedUntilMillis is the end of the pause, in Unix milliseconds, or
+	// zero if the validator isn't paused.
+	PausedUntilMillis int64 `json:"paused_until_ms,omitempty"`
+}
+
+// PauseSigner is implemented by signers that can sign pause requests.
+type PauseSigner interface {
+	SignPauseRequest(*PauseRequest) error
+}
+
+var (
+	// ErrPauseUnsupported is returned when the validator can't be paused,
+	// because the builder API doesn't support CapabilityPause, or the
+	// signer doesn't implement PauseSigner.
+	ErrPauseUnsupported = errors.New("pause unsupported")
+
+	// ErrPaused is returned by BuildBlock while the validator is paused.
+	// Like other build failures, it's passed to the fallback.
+	ErrPaused = errors.New("validator paused")
+)
+
+var pauseEndpoint = Endpoint{
+	Path: "/v0/pause",
+	Sign: func(s Signer, req interface{}) error {
+		ps, ok := s.(PauseSigner)
+		if !ok {
+			return fmt.Errorf("%w: signer can't sign pause requests", ErrPauseUnsupported)
+		}
+		return ps.SignPauseRequest(req.(*PauseRequest))
+	},
+}
+
+// Pause pauses the validator until the given time, which must be in the
+// future. Pausing a paused validator moves the end of the pause.
+func (b *Builder) Pause(ctx context.Context, until time.Time) error {
+	if !until.After(b.now()) {
+		return fmt.Errorf("end of pause %s must be in the future", until)
+	}
+	return b.pause(ctx, until)
+}
+
+// Resume ends a pause early. Resuming a validator that isn't paused is a
+// no-op.
+func (b *Builder) Resume(ctx context.Context) error {
+	return b.pause(ctx, time.Time{})
+}
+
+// PausedUntil returns the end of the pause, as of the last successful Pause
+// or Resume, and true if the validator is still paused.
+func (b *Builder) PausedUntil() (time.Time, bool) {
+	until := atomic.LoadInt64(&b.pausedUntil)
+	if until == 0 || b.now().UnixNano() >= until {
+		return time.Time{}, false
+	}
+	return time.Unix(0, until), true
+}
+
+func (b *Builder) pause(ctx context.Context, until time.Time) error {
+	if caps, ok := b.Capabilities(); ok && !caps.Has(CapabilityPause) {
+		return fmt.Errorf("%w: builder API doesn't support it", ErrPauseUnsupported)
+	}
+
+	validatorAddr, err := NormalizeValidatorAddress(b.validatorAddr)
+	if err != nil {
+		return err
+	}
+
+	req := &PauseRequest{
+		ChainID:          b.chainID,
+		ValidatorAddress: validatorAddr,
+		Timestamp:        b.now().UnixNano() / int64(time.Millisecond),
+		DomainTag:        b.getDomainTag(),
+	}
+	if !until.IsZero() {
+		req.UntilMillis = until.UnixNano() / int64(time.Millisecond)
+	}
+	if c, ok := b.ConsumerChain(); ok {
+		req.ProviderChainID, req.ConsumerID = c.ProviderChainID, c.ConsumerID
+	}
+
+	var resp PauseResponse
+	if err := b.Call(ctx, pauseEndpoint, req, &resp); err != nil {
+		return err
+	}
+
+	atomic.StoreInt64(&b.pausedUntil, resp.PausedUntilMillis*int64(time.Millisecond))
+	if resp.PausedUntilMillis == 0 {
+		b.getLogger().Infof("validator resumed: chain_id=%s", b.chainID)
+	} else {
+		b.getLogger().Infof("validator paused: chain_id=%s until=%s", b.chainID, time.Unix(0, resp.PausedUntilMillis*int64(time.Millisecond)).UTC())
+	}
+	return nil
+}
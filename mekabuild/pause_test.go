@@ -0,0 +1,78 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderPause(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		height    int64
+		build     = func() error {
+			height++
+			_, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1})
+			return err
+		}
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	if err := build(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.Pause(ctx, time.Now().Add(-time.Minute)); err == nil {
+		t.Errorf("pause in the past: want error, have none")
+	}
+
+	until := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	if err := builder.Pause(ctx, until); err != nil {
+		t.Fatal(err)
+	}
+	if have, ok := api.PausedUntil(chainID, key.addr); !ok || !have.Equal(until) {
+		t.Errorf("API: want paused until %s, have %s, %v", until, have, ok)
+	}
+	if have, ok := builder.PausedUntil(); !ok || !have.Equal(until) {
+		t.Errorf("builder: want paused until %s, have %s, %v", until, have, ok)
+	}
+
+	builds := len(api.Builds())
+	if err := build(); !errors.Is(err, mekabuild.ErrPaused) {
+		t.Errorf("paused: want %v, have %v", mekabuild.ErrPaused, err)
+	}
+	if want, have := builds, len(api.Builds()); want != have {
+		t.Errorf("paused: want %d builds sent, have %d", want, have)
+	}
+	if h := builder.Health(); h.PausedUntil == nil || h.SkippedBuilds != 1 {
+		t.Errorf("health: want paused, 1 skipped build, have %v, %d", h.PausedUntil, h.SkippedBuilds)
+	}
+
+	if err := builder.Resume(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := api.PausedUntil(chainID, key.addr); ok {
+		t.Errorf("API: want resumed, have paused")
+	}
+	if err := build(); err != nil {
+		t.Errorf("resumed: %v", err)
+	}
+
+	unsupported := mekabuild.NewBuilder(&http.Client{}, apiURL, struct{ mekabuild.Signer }{key}, chainID, key.addr)
+	if err := unsupported.Pause(ctx, until); !errors.Is(err, mekabuild.ErrPauseUnsupported) {
+		t.Errorf("signer without PauseSigner: want %v, have %v", mekabuild.ErrPauseUnsupported, err)
+	}
+}
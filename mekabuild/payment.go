@@ -0,0 +1,154 @@
+package mekabuild
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Coin is an amount of a single denomination, e.g. 1000uatom.
+type Coin struct {
+	Denom  string
+	Amount *big.Int
+}
+
+// coinJSON is the stable JSON schema for a Coin. The amount is a decimal
+// string, as in the Cosmos SDK, so it survives JSON decoders that parse
+// numbers as float64.
+type coinJSON struct {
+	Denom  string `json:"denom"`
+	Amount string `json:"amount"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Coin) MarshalJSON() ([]byte, error) {
+	return json.Marshal(coinJSON{Denom: c.Denom, Amount: c.amount().String()})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Coin) UnmarshalJSON(data []byte) error {
+	var cj coinJSON
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return err
+	}
+
+	amount, ok := new(big.Int).SetString(cj.Amount, 10)
+	if !ok || amount.Sign() < 0 {
+		return fmt.Errorf("%w: invalid amount %q", ErrInvalidCoins, cj.Amount)
+	}
+	if !denomRegexp.MatchString(cj.Denom) {
+		return fmt.Errorf("%w: invalid denom %q", ErrInvalidCoins, cj.Denom)
+	}
+
+	c.Denom, c.Amount = cj.Denom, amount
+	return nil
+}
+
+// String returns the coin in Cosmos SDK format, e.g. "1000uatom".
+func (c Coin) String() string {
+	return c.amount().String() + c.Denom
+}
+
+func (c Coin) amount() *big.Int {
+	if c.Amount == nil {
+		return new(big.Int)
+	}
+	return c.Amount
+}
+
+// Coins is a set of coins of distinct denominations, sorted by denom.
+type Coins []Coin
+
+// String returns the coins in Cosmos SDK format, e.g. "1000uatom,5uosmo".
+func (cs Coins) String() string {
+	parts := make([]string, len(cs))
+	for i, c := range cs {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// AmountOf returns the amount of the given denom, or zero.
+func (cs Coins) AmountOf(denom string) *big.Int {
+	for _, c := range cs {
+		if c.Denom == denom {
+			return new(big.Int).Set(c.amount())
+		}
+	}
+	return new(big.Int)
+}
+
+// Add returns the sum of both sets of coins. Neither input is modified.
+func (cs Coins) Add(other Coins) Coins {
+	sum := make(Coins, 0, len(cs)+len(other))
+	sum = append(sum, cs...)
+	sum = append(sum, other...)
+	return normalizeCoins(sum)
+}
+
+// ErrInvalidCoins is returned when a payment can't be parsed as coins.
+var ErrInvalidCoins = errors.New("invalid coins")
+
+// denomRegexp matches Cosmos SDK denominations, including IBC denoms like
+// "ibc/27394FB0...".
+var denomRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9/:._-]{2,127}$`)
+
+var coinRegexp = regexp.MustCompile(`^([0-9]+)\s*([a-zA-Z][a-zA-Z0-9/:._-]{2,127})$`)
+
+// ParseCoins parses a Cosmos SDK coins string, e.g. "1000uatom,5uosmo".
+// Amounts must be non-negative integers. Coins of the same denom are summed,
+// and the result is sorted by denom. An empty string parses as no coins.
+func ParseCoins(s string) (Coins, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Coins{}, nil
+	}
+
+	var cs Coins
+	for _, part := range strings.Split(s, ",") {
+		m := coinRegexp.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCoins, part)
+		}
+		amount, _ := new(big.Int).SetString(m[1], 10)
+		cs = append(cs, Coin{Denom: m[2], Amount: amount})
+	}
+
+	return normalizeCoins(cs), nil
+}
+
+// normalizeCoins sums coins of the same denom, drops zero amounts, and sorts
+// by denom. It doesn't modify its input.
+func normalizeCoins(cs Coins) Coins {
+	byDenom := map[string]*big.Int{}
+	for _, c := range cs {
+		sum, ok := byDenom[c.Denom]
+		if !ok {
+			sum = new(big.Int)
+			byDenom[c.Denom] = sum
+		}
+		sum.Add(sum, c.amount())
+	}
+
+	out := make(Coins, 0, len(byDenom))
+	for denom, amount := range byDenom {
+		if amount.Sign() == 0 {
+			continue
+		}
+		out = append(out, Coin{Denom: denom, Amount: amount})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Denom < out[j].Denom })
+	return out
+}
+
+// Payment parses the response's ValidatorPayment as coins. It returns an
+// error wrapping ErrInvalidCoins if the builder API returned a payment that
+// isn't in Cosmos SDK coins format.
+func (r *BuildBlockResponse) Payment() (Coins, error) {
+	return ParseCoins(r.ValidatorPayment)
+}
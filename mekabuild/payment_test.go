@@ -0,0 +1,97 @@
+package mekabuild_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestParseCoins(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{in: "", want: ""},
+		{in: "1000uatom", want: "1000uatom"},
+		{in: "5uosmo, 1000uatom", want: "1000uatom,5uosmo"},
+		{in: "1uatom,2uatom", want: "3uatom"},
+		{in: "0uatom,1uosmo", want: "1uosmo"},
+		{in: "123456789012345678901234567890uatom", want: "123456789012345678901234567890uatom"},
+		{in: "10ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2", want: "10ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"},
+		{in: "1 test-chain-id coins", err: mekabuild.ErrInvalidCoins},
+		{in: "-1uatom", err: mekabuild.ErrInvalidCoins},
+		{in: "1.5uatom", err: mekabuild.ErrInvalidCoins},
+		{in: "uatom", err: mekabuild.ErrInvalidCoins},
+	} {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			coins, err := mekabuild.ParseCoins(tc.in)
+			if want, have := tc.err, err; !errors.Is(have, want) {
+				t.Fatalf("error: want %v, have %v", want, have)
+			}
+			if tc.err != nil {
+				return
+			}
+			if want, have := tc.want, coins.String(); want != have {
+				t.Errorf("coins: want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestCoinsJSON(t *testing.T) {
+	t.Parallel()
+
+	coins, err := mekabuild.ParseCoins("123456789012345678901234567890uatom,5uosmo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(coins)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := `[{"denom":"uatom","amount":"123456789012345678901234567890"},{"denom":"uosmo","amount":"5"}]`, string(data); want != have {
+		t.Fatalf("JSON: want %s, have %s", want, have)
+	}
+
+	var decoded mekabuild.Coins
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := coins.String(), decoded.String(); want != have {
+		t.Errorf("round trip: want %q, have %q", want, have)
+	}
+
+	if err := json.Unmarshal([]byte(`[{"denom":"uatom","amount":"-1"}]`), &decoded); !errors.Is(err, mekabuild.ErrInvalidCoins) {
+		t.Errorf("negative amount: want %v, have %v", mekabuild.ErrInvalidCoins, err)
+	}
+}
+
+func TestCoinsAdd(t *testing.T) {
+	t.Parallel()
+
+	a, _ := mekabuild.ParseCoins("1uatom,2uosmo")
+	b, _ := mekabuild.ParseCoins("3uatom,4ujuno")
+
+	sum := a.Add(b)
+	if want, have := "4uatom,4ujuno,2uosmo", sum.String(); want != have {
+		t.Errorf("sum: want %q, have %q", want, have)
+	}
+	if want, have := "1uatom,2uosmo", a.String(); want != have {
+		t.Errorf("input modified: want %q, have %q", want, have)
+	}
+	if want, have := int64(4), sum.AmountOf("uatom").Int64(); want != have {
+		t.Errorf("amount of uatom: want %d, have %d", want, have)
+	}
+	if want, have := int64(0), sum.AmountOf("ustars").Int64(); want != have {
+		t.Errorf("amount of ustars: want %d, have %d", want, have)
+	}
+}
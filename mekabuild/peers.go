@@ -0,0 +1,325 @@
+package mekabuild
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// PeerReport is a node's observations of the builder API endpoints, shared
+// with the other nodes run by the same operator, so a newly started node
+// picks the best endpoint for its region from the start, rather than learning
+// it from its own requests.
+type PeerReport struct {
+	// Node identifies the reporting node, e.g. its moniker.
+	Node string `json:"node"`
+
+	// Time is when the report was published.
+	Time time.Time `json:"time"`
+
+	Endpoints []EndpointStats `json:"endpoints"`
+}
+
+// PeerExchange shares peer reports between the nodes of an operator.
+// Implementations must be safe for concurrent use.
+type PeerExchange interface {
+	// Publish shares the report of this node. It's called in the
+	// background after requests, with a timeout.
+	Publish(ctx context.Context, r PeerReport) error
+
+	// Reports returns the most recent report of every node, which may
+	// include this node's.
+	Reports(ctx context.Context) ([]PeerReport, error)
+}
+
+const (
+	// PeerPublishInterval is the minimum interval between reports
+	// published by a builder.
+	PeerPublishInterval = 10 * time.Second
+
+	// PeerReportMaxAge is the age after which peer reports are ignored, as
+	// the endpoints they describe may have changed since.
+	PeerReportMaxAge = 10 * time.Minute
+)
+
+// peerPublishTimeout bounds publishing a report, which happens in the
+// background, after a request.
+const peerPublishTimeout = 5 * time.Second
+
+// SetPeerExchange shares the builder's endpoint observations with the other
+// nodes of the operator, as the given node, and loads theirs. Until the
+// builder has made requests to an endpoint, the endpoint is ranked by the
+// observations of its peers: endpoints which failed recently for a peer are
+// skipped for FailoverCooldown, and the remaining endpoints are tried in
+// order of their success rate and mean latency, rather than in order of
+// preference. Once the builder has made its own requests to an endpoint, its
+// own observations take precedence.
+//
+// Peer reports are loaded once, here, as they mostly matter to nodes which
+// haven't made requests yet. Long running nodes can call RefreshPeers
+// periodically. Failing to load peer reports isn't an error, since nodes
+// start in no particular order: it's logged, and the builder starts without
+// them. The builder publishes its report at most once per
+// PeerPublishInterval, after requests. By default, nothing is shared.
+func (b *Builder) SetPeerExchange(p PeerExchange, node string) error {
+	if p == nil {
+		return errors.New("peer exchange is required")
+	}
+	if node == "" {
+		return errors.New("node name must not be empty")
+	}
+
+	b.peerExchange.Store(peerExchangeBox{p, node})
+	if err := b.RefreshPeers(context.Background()); err != nil {
+		b.getLogger().Infof("load peer reports failed, starting without them: chain_id=%s node=%s err=%v", b.chainID, node, err)
+	}
+	return nil
+}
+
+// WithPeerExchange shares endpoint observations with peers. See
+// SetPeerExchange.
+func WithPeerExchange(p PeerExchange, node string) Option {
+	return func(b *Builder) error {
+		return b.SetPeerExchange(p, node)
+	}
+}
+
+// RefreshPeers reloads the reports of the builder's peers, replacing the ones
+// loaded before. It's a no-op if no peer exchange is set.
+func (b *Builder) RefreshPeers(ctx context.Context) error {
+	box, _ := b.peerExchange.Load().(peerExchangeBox)
+	if box.PeerExchange == nil {
+		return nil
+	}
+
+	reports, err := box.Reports(ctx)
+	if err != nil && len(reports) == 0 {
+		return fmt.Errorf("load peer reports: %w", err)
+	}
+
+	peers := newStatsRegistry()
+	for _, r := range reports {
+		if r.Node == box.node || b.since(r.Time) > PeerReportMaxAge {
+			continue
+		}
+		peers.merge(r.Endpoints)
+	}
+	b.peerStats.Store(peers)
+	return nil
+}
+
+// PeerReport returns the builder's current report, as published to its
+// peers. The node is empty if no peer exchange is set.
+func (b *Builder) PeerReport() PeerReport {
+	box, _ := b.peerExchange.Load().(peerExchangeBox)
+	return PeerReport{Node: box.node, Time: b.now().UTC(), Endpoints: b.stats.ranked()}
+}
+
+// PeerReportHandler returns an http.Handler serving the builder's report as
+// JSON, to be polled by peers with an HTTPPeerExchange. Like HealthHandler,
+// it's intended to be mounted on the node's admin port, which shouldn't be
+// reachable by anyone but the operator.
+func (b *Builder) PeerReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(b.PeerReport())
+	})
+}
+
+type peerExchangeBox struct {
+	PeerExchange
+	node string
+}
+
+func (b *Builder) getPeerStats() *statsRegistry {
+	peers, _ := b.peerStats.Load().(*statsRegistry)
+	return peers
+}
+
+// publishPeerReport publishes the builder's report in the background, if a
+// peer exchange is set and the last report is older than PeerPublishInterval.
+// It's best effort.
+func (b *Builder) publishPeerReport() {
+	box, _ := b.peerExchange.Load().(peerExchangeBox)
+	if box.PeerExchange == nil {
+		return
+	}
+
+	var (
+		now  = b.now()
+		last = atomic.LoadInt64(&b.peerPublishedAt)
+	)
+	if last != 0 && now.Sub(time.Unix(0, last)) < PeerPublishInterval {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&b.peerPublishedAt, last, now.UnixNano()) {
+		return // another request is publishing
+	}
+
+	r := b.PeerReport()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), peerPublishTimeout)
+		defer cancel()
+		if err := box.Publish(ctx, r); err != nil {
+			b.getLogger().Debugf("publish peer report failed: chain_id=%s node=%s err=%v", b.chainID, box.node, err)
+		}
+	}()
+}
+
+// rankByPeers orders the healthy endpoints by the builder's observations, or
+// its peers' for endpoints it hasn't made requests to. Endpoints nobody has
+// observed come last, in order of preference.
+func (b *Builder) rankByPeers(endpoints []*url.URL, peers *statsRegistry) {
+	type ranked struct {
+		stats    EndpointStats
+		observed bool
+	}
+	rank := make(map[*url.URL]ranked, len(endpoints))
+	for _, u := range endpoints {
+		s, ok := b.stats.lookup(endpointName(u))
+		if !ok {
+			s, ok = peers.lookup(endpointName(u))
+		}
+		rank[u] = ranked{s, ok}
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		ri, rj := rank[endpoints[i]], rank[endpoints[j]]
+		if ri.observed != rj.observed {
+			return ri.observed
+		}
+		return ri.observed && betterEndpoint(ri.stats, rj.stats)
+	})
+}
+
+//
+//
+//
+
+// StorePeerExchange shares peer reports through a Store shared by the nodes
+// of an operator, e.g. a FileStore on a shared volume, or an implementation
+// backed by the operator's database. Each node's report is kept under its
+// name, in the StoreNamespacePeers namespace.
+type StorePeerExchange struct {
+	store keyStore
+}
+
+var _ PeerExchange = (*StorePeerExchange)(nil)
+
+// keyStore is a Store which can list its keys, like MemoryStore and FileStore.
+type keyStore interface {
+	Store
+	Keys(ns string) []string
+}
+
+// NewStorePeerExchange returns a peer exchange backed by the store, which must
+// have a Keys method returning the keys of a namespace, like MemoryStore and
+// FileStore.
+func NewStorePeerExchange(s Store) (*StorePeerExchange, error) {
+	ks, ok := s.(keyStore)
+	if !ok {
+		return nil, fmt.Errorf("store %T can't list its keys", s)
+	}
+	return &StorePeerExchange{store: ks}, nil
+}
+
+// Publish implements PeerExchange.
+func (e *StorePeerExchange) Publish(ctx context.Context, r PeerReport) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encode peer report: %w", err)
+	}
+	return e.store.Put(StoreNamespacePeers, r.Node, data)
+}
+
+// Reports implements PeerExchange. Reports which can't be read or decoded are
+// skipped, and the first such error is returned with the other reports.
+func (e *StorePeerExchange) Reports(ctx context.Context) ([]PeerReport, error) {
+	var (
+		reports  []PeerReport
+		firstErr error
+	)
+	for _, node := range e.store.Keys(StoreNamespacePeers) {
+		var r PeerReport
+		data, err := e.store.Get(StoreNamespacePeers, node)
+		if err == nil {
+			err = json.Unmarshal(data, &r)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("peer %s: %w", node, err)
+			}
+			continue
+		}
+		reports = append(reports, r)
+	}
+	return reports, firstErr
+}
+
+// HTTPPeerExchange shares peer reports by polling the PeerReportHandler of
+// each peer. Publishing is a no-op, since peers serve their own reports.
+type HTTPPeerExchange struct {
+	client *http.Client
+	peers  []*url.URL
+}
+
+var _ PeerExchange = (*HTTPPeerExchange)(nil)
+
+// NewHTTPPeerExchange returns a peer exchange polling the report handlers at
+// the given URLs with the HTTP client.
+func NewHTTPPeerExchange(client *http.Client, peerURLs ...*url.URL) *HTTPPeerExchange {
+	return &HTTPPeerExchange{client: client, peers: append([]*url.URL(nil), peerURLs...)}
+}
+
+// Publish implements PeerExchange.
+func (e *HTTPPeerExchange) Publish(ctx context.Context, r PeerReport) error {
+	return nil
+}
+
+// Reports implements PeerExchange. Peers which can't be reached are skipped,
+// and the first such error is returned with the other reports.
+func (e *HTTPPeerExchange) Reports(ctx context.Context) ([]PeerReport, error) {
+	var (
+		reports  []PeerReport
+		firstErr error
+	)
+	for _, u := range e.peers {
+		r, err := e.get(ctx, u)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("peer %s: %w", u.Host, err)
+			}
+			continue
+		}
+		reports = append(reports, r)
+	}
+	return reports, firstErr
+}
+
+func (e *HTTPPeerExchange) get(ctx context.Context, u *url.URL) (PeerReport, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return PeerReport{}, err
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return PeerReport{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return PeerReport{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var r PeerReport
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return PeerReport{}, fmt.Errorf("decode report: %w", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,204 @@
+package mekabuild_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestStorePeerExchange(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx      = context.Background()
+		chainID  = "test-chain-id"
+		key      = newMockKey(t, "foo", nil)
+		api      = newMockAPI()
+		slowHits int32
+		slow     = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&slowHits, 1)
+			api.ServeHTTP(w, r)
+		}))
+		fast       = newTestServer(t, api)
+		slowURL, _ = url.Parse(slow.URL)
+		fastURL, _ = url.Parse(fast.URL)
+		store      = mekabuild.NewMemoryStore()
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	exchange, err := mekabuild.NewStorePeerExchange(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exchange.Publish(ctx, mekabuild.PeerReport{
+		Node: "peer",
+		Time: time.Now(),
+		Endpoints: []mekabuild.EndpointStats{
+			{Endpoint: slow.URL, Successes: 10, TotalLatency: 5 * time.Second},
+			{Endpoint: fast.URL, Successes: 10, TotalLatency: 100 * time.Millisecond},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithEndpoints(slowURL, fastURL), mekabuild.WithPeerExchange(exchange, "node"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int32(0), atomic.LoadInt32(&slowHits); want != have {
+		t.Errorf("requests to slow endpoint: want %d, have %d", want, have)
+	}
+
+	var reports []mekabuild.PeerReport
+	deadline := time.Now().Add(5 * time.Second)
+	for len(reports) < 2 { // published in the background
+		if time.Now().After(deadline) {
+			t.Fatalf("reports: want 2, have %d", len(reports))
+		}
+		time.Sleep(10 * time.Millisecond)
+		if reports, err = exchange.Reports(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range reports {
+		if r.Node == "node" && (len(r.Endpoints) != 1 || r.Endpoints[0].Endpoint != fast.URL) {
+			t.Errorf("node report: have %+v", r)
+		}
+	}
+
+	if _, err := mekabuild.NewStorePeerExchange(struct{ mekabuild.Store }{store}); err == nil {
+		t.Errorf("store without keys: want error, have none")
+	}
+}
+
+func TestPeerExchangeSlowPublish(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx          = context.Background()
+		chainID      = "test-chain-id"
+		key          = newMockKey(t, "foo", nil)
+		api          = newMockAPI()
+		server       = newTestServer(t, api)
+		serverURL, _ = url.Parse(server.URL)
+		exchange     = &blockingPeerExchange{published: make(chan struct{}, 1), release: make(chan struct{})}
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	t.Cleanup(func() { close(exchange.release) })
+
+	builder, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithEndpoints(serverURL), mekabuild.WithPeerExchange(exchange, "node"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("build block blocked on publishing the peer report")
+	}
+
+	select {
+	case <-exchange.published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer report wasn't published")
+	}
+}
+
+// blockingPeerExchange blocks in Publish until released.
+type blockingPeerExchange struct {
+	published chan struct{}
+	release   chan struct{}
+}
+
+func (e *blockingPeerExchange) Publish(ctx context.Context, r mekabuild.PeerReport) error {
+	select {
+	case e.published <- struct{}{}:
+	default:
+	}
+	select {
+	case <-e.release:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+func (e *blockingPeerExchange) Reports(ctx context.Context) ([]mekabuild.PeerReport, error) {
+	return nil, nil
+}
+
+func TestHTTPPeerExchange(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx     = context.Background()
+		chainID = "test-chain-id"
+		key     = newMockKey(t, "foo", nil)
+		api     = newMockAPI()
+		badHits int32
+		bad     = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&badHits, 1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		good       = newTestServer(t, api)
+		badURL, _  = url.Parse(bad.URL)
+		goodURL, _ = url.Parse(good.URL)
+		build      = func(b *mekabuild.Builder) {
+			t.Helper()
+			if _, err := b.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	first, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithEndpoints(badURL, goodURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	build(first)
+	if want, have := int32(1), atomic.LoadInt32(&badHits); want != have {
+		t.Fatalf("first builder requests to failed endpoint: want %d, have %d", want, have)
+	}
+
+	peer := httptest.NewServer(first.PeerReportHandler())
+	t.Cleanup(peer.Close)
+	var (
+		peerURL, _     = url.Parse(peer.URL)
+		unreachable, _ = url.Parse("http://127.0.0.1:1")
+		exchange       = mekabuild.NewHTTPPeerExchange(&http.Client{}, unreachable, peerURL)
+	)
+	reports, err := exchange.Reports(ctx)
+	if err == nil {
+		t.Errorf("unreachable peer: want error, have none")
+	}
+	if want, have := 1, len(reports); want != have {
+		t.Fatalf("reports: want %d, have %d", want, have)
+	}
+
+	second, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithEndpoints(badURL, goodURL), mekabuild.WithPeerExchange(exchange, "second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	build(second)
+	if want, have := int32(1), atomic.LoadInt32(&badHits); want != have {
+		t.Errorf("second builder requests to failed endpoint: want %d, have %d", want, have)
+	}
+}
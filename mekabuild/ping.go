@@ -0,0 +1,75 @@
+package mekabuild
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PingRequest is sent to the ping endpoint of the builder API.
+type PingRequest struct {
+	ChainID string `json:"chain_id"`
+}
+
+// PingResponse is returned by the ping endpoint of the builder API.
+type PingResponse struct {
+	// APIVersion is the version of the builder API, e.g. "v0.4.2".
+	APIVersion string `json:"api_version"`
+
+	// Chains are the chain IDs the builder API builds blocks for.
+	Chains []string `json:"chains"`
+}
+
+// PingResult describes a successful ping.
+type PingResult struct {
+	PingResponse
+
+	// Endpoint is the builder API endpoint that responded.
+	Endpoint string
+
+	// RTT is the round-trip time of the ping, including any retries.
+	RTT time.Duration
+}
+
+// ErrChainUnsupported is returned by Ping when the builder API doesn't build
+// blocks for the builder's chain.
+var ErrChainUnsupported = errors.New("chain not supported by builder API")
+
+// Ping checks connectivity to the builder API, and returns its version, the
+// chains it supports, and the round-trip time. It's intended to be called at
+// startup, so that a misconfigured API URL or chain ID is discovered then,
+// rather than when proposing. It returns an error wrapping ErrChainUnsupported
+// if the API lists its chains, and the builder's chain isn't among them.
+//
+// Ping doesn't use the signer, and is permitted for read-only builders.
+func (b *Builder) Ping(ctx context.Context) (*PingResult, error) {
+	var (
+		begin = b.now()
+		req   = &PingRequest{ChainID: b.chainID}
+		resp  PingResponse
+	)
+	endpoint, err := b.do(ctx, "/v0/ping", req, &resp, nil)
+	if err != nil {
+		b.getLogger().Errorf("ping failed: chain_id=%s endpoint=%s took=%s err=%v", b.chainID, endpoint, b.since(begin), err)
+		return nil, err
+	}
+
+	result := &PingResult{PingResponse: resp, Endpoint: endpoint, RTT: b.since(begin)}
+	b.getLogger().Infof("ping succeeded: chain_id=%s endpoint=%s api_version=%s took=%s", b.chainID, endpoint, resp.APIVersion, result.RTT)
+
+	if len(resp.Chains) > 0 && !containsString(resp.Chains, b.chainID) {
+		return result, fmt.Errorf("%w: %s, supported chains are %v", ErrChainUnsupported, b.chainID, resp.Chains)
+	}
+
+	return result, nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderPing(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		key       = newMockKey(t, "validator", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+	)
+
+	api.SetChains("chain-a", "chain-b")
+
+	builder := mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-b", key.addr)
+	builder.SetReadOnly(true)
+
+	result, err := builder.Ping(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "mock", result.APIVersion; want != have {
+		t.Errorf("API version: want %q, have %q", want, have)
+	}
+	if want, have := server.URL, result.Endpoint; want != have {
+		t.Errorf("endpoint: want %q, have %q", want, have)
+	}
+	if result.RTT <= 0 {
+		t.Errorf("RTT: want > 0, have %s", result.RTT)
+	}
+
+	other := mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-c", key.addr)
+	if _, err := other.Ping(ctx); !errors.Is(err, mekabuild.ErrChainUnsupported) {
+		t.Errorf("unsupported chain: want %v, have %v", mekabuild.ErrChainUnsupported, err)
+	}
+
+	unreachableURL, _ := url.Parse("http://127.0.0.1:1")
+	unreachable := mekabuild.NewBuilder(&http.Client{}, unreachableURL, key, "chain-b", key.addr)
+	if _, err := unreachable.Ping(ctx); err == nil {
+		t.Errorf("unreachable API: want error, have none")
+	}
+}
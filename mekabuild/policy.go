@@ -0,0 +1,270 @@
+package mekabuild
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Policy is a local transaction inclusion policy, e.g. to codify compliance
+// constraints. It's evaluated against the txs submitted to the builder API,
+// and against the txs in returned blocks. Policies are written in JSON:
+//
+//	{
+//	  "max_tx_bytes": 100000,
+//	  "default": "allow",
+//	  "rules": [
+//	    {"name": "sanctioned", "action": "deny", "senders": ["cosmos1..."]},
+//	    {"name": "transfers", "action": "allow", "msg_types": ["/ibc.applications.transfer.*"]},
+//	    {"name": "no-ibc", "action": "deny", "msg_types": ["/ibc.*"]}
+//	  ]
+//	}
+//
+// Txs larger than MaxTxBytes are denied. Otherwise, the first rule matching
+// the tx decides, and txs matching no rule get the default action.
+type Policy struct {
+	MaxTxBytes int64        `json:"max_tx_bytes,omitempty"`
+	Default    PolicyAction `json:"default,omitempty"`
+	Rules      []PolicyRule `json:"rules,omitempty"`
+}
+
+// PolicyAction is the outcome of a policy rule.
+type PolicyAction string
+
+// Policy actions. The zero value means PolicyAllow.
+const (
+	PolicyAllow PolicyAction = "allow"
+	PolicyDeny  PolicyAction = "deny"
+)
+
+// PolicyRule matches txs by their messages. A rule matches a tx if every
+// condition that's set matches: MsgTypes if any message of the tx has one of
+// the types, and Senders if any signer of the tx is one of the senders. A rule
+// without conditions matches every tx. Message types ending in "*" match by
+// prefix.
+type PolicyRule struct {
+	Name     string       `json:"name"`
+	Action   PolicyAction `json:"action"`
+	MsgTypes []string     `json:"msg_types,omitempty"`
+	Senders  []string     `json:"senders,omitempty"`
+}
+
+// TxInfo is what a policy knows about a tx.
+type TxInfo struct {
+	MsgTypes []string // type URLs, e.g. "/cosmos.bank.v1beta1.MsgSend"
+	Senders  []string // signer addresses
+}
+
+// TxDecoder decodes a tx for policy evaluation, typically with the chain's
+// own tx decoder, which this package doesn't depend on.
+type TxDecoder func(tx []byte) (TxInfo, error)
+
+// PolicyDecision is the outcome of evaluating a policy against a tx.
+type PolicyDecision struct {
+	Allowed bool
+	Rule    string // name of the deciding rule, empty for the default
+	Reason  string
+}
+
+// ErrPolicyViolation is returned when a block from the builder API includes
+// a tx that the local policy denies.
+var ErrPolicyViolation = errors.New("policy violation")
+
+// ParsePolicy parses and validates a JSON policy. Unknown fields are rejected,
+// so a typo can't silently disable a rule.
+func ParsePolicy(data []byte) (*Policy, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("decode policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate checks that the policy is well-formed.
+func (p *Policy) Validate() error {
+	if p.MaxTxBytes < 0 {
+		return fmt.Errorf("max_tx_bytes must not be negative, have %d", p.MaxTxBytes)
+	}
+	if !p.Default.valid() {
+		return fmt.Errorf("invalid default action %q", p.Default)
+	}
+	for i, r := range p.Rules {
+		if !r.Action.valid() || r.Action == "" {
+			return fmt.Errorf("rule %d (%s): invalid action %q", i, r.Name, r.Action)
+		}
+		for _, t := range r.MsgTypes {
+			if t == "" || strings.Contains(strings.TrimSuffix(t, "*"), "*") {
+				return fmt.Errorf("rule %d (%s): invalid message type %q", i, r.Name, t)
+			}
+		}
+	}
+	return nil
+}
+
+// needsDecoder returns true if any rule inspects the contents of txs.
+func (p *Policy) needsDecoder() bool {
+	for _, r := range p.Rules {
+		if len(r.MsgTypes) > 0 || len(r.Senders) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate decides whether the policy allows tx. Txs that can't be decoded are
+// denied. A nil decoder is only valid for policies whose rules don't inspect
+// txs.
+func (p *Policy) Evaluate(tx []byte, decode TxDecoder) PolicyDecision {
+	if p.MaxTxBytes > 0 && int64(len(tx)) > p.MaxTxBytes {
+		return PolicyDecision{Reason: fmt.Sprintf("tx of %d bytes exceeds max_tx_bytes %d", len(tx), p.MaxTxBytes)}
+	}
+
+	var info TxInfo
+	if p.needsDecoder() {
+		if decode == nil {
+			return PolicyDecision{Reason: "no tx decoder"}
+		}
+		var err error
+		if info, err = decode(tx); err != nil {
+			return PolicyDecision{Reason: fmt.Sprintf("decode tx: %v", err)}
+		}
+	}
+
+	for _, r := range p.Rules {
+		if r.matches(info) {
+			return PolicyDecision{Allowed: r.Action == PolicyAllow, Rule: r.Name, Reason: fmt.Sprintf("rule %s: %s", r.Name, r.Action)}
+		}
+	}
+
+	return PolicyDecision{Allowed: p.Default != PolicyDeny, Reason: fmt.Sprintf("default: %s", p.Default.orAllow())}
+}
+
+// Filter returns the txs allowed by the policy, in order, and the decisions
+// for the denied txs, by index.
+func (p *Policy) Filter(txs [][]byte, decode TxDecoder) ([][]byte, map[int]PolicyDecision) {
+	var (
+		allowed = make([][]byte, 0, len(txs))
+		denied  = map[int]PolicyDecision{}
+	)
+	for i, tx := range txs {
+		if d := p.Evaluate(tx, decode); d.Allowed {
+			allowed = append(allowed, tx)
+		} else {
+			denied[i] = d
+		}
+	}
+	return allowed, denied
+}
+
+func (r PolicyRule) matches(info TxInfo) bool {
+	if len(r.MsgTypes) > 0 && !matchesAny(info.MsgTypes, r.MsgTypes) {
+		return false
+	}
+	if len(r.Senders) > 0 && !matchesAny(info.Senders, r.Senders) {
+		return false
+	}
+	return true
+}
+
+func matchesAny(values, patterns []string) bool {
+	for _, v := range values {
+		for _, p := range patterns {
+			if prefix := strings.TrimSuffix(p, "*"); (prefix != p && strings.HasPrefix(v, prefix)) || v == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a PolicyAction) valid() bool {
+	return a == "" || a == PolicyAllow || a == PolicyDeny
+}
+
+func (a PolicyAction) orAllow() PolicyAction {
+	if a == "" {
+		return PolicyAllow
+	}
+	return a
+}
+
+// SetPolicy sets the local inclusion policy, and the decoder used to inspect
+// txs. Submitted txs denied by the policy are dropped from build requests,
+// and blocks from the builder API including a denied tx are rejected with an
+// error wrapping ErrPolicyViolation, so BuildBlock falls back. Mandatory txs
+// are exempt. A nil policy disables policy evaluation.
+func (b *Builder) SetPolicy(p *Policy, decode TxDecoder) error {
+	if p != nil {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		if p.needsDecoder() && decode == nil {
+			return errors.New("policy inspects txs, but no tx decoder is set")
+		}
+	}
+	b.policy.Store(policyBox{p, decode})
+	return nil
+}
+
+// WithPolicy sets the local inclusion policy. See SetPolicy.
+func WithPolicy(p *Policy, decode TxDecoder) Option {
+	return func(b *Builder) error {
+		return b.SetPolicy(p, decode)
+	}
+}
+
+type policyBox struct {
+	policy *Policy
+	decode TxDecoder
+}
+
+func (b *Builder) getPolicy() policyBox {
+	box, _ := b.policy.Load().(policyBox)
+	return box
+}
+
+// applyPolicy drops the submitted txs denied by the policy from req.
+func (b *Builder) applyPolicy(req *BuildBlockRequest) {
+	box := b.getPolicy()
+	if box.policy == nil {
+		return
+	}
+
+	allowed, denied := box.policy.Filter(req.Txs, box.decode)
+	for i, d := range denied {
+		b.getLogger().Infof("policy dropped tx: chain_id=%s height=%d index=%d reason=%q", req.ChainID, req.Height, i, d.Reason)
+	}
+	req.Txs = allowed
+}
+
+// checkPolicy returns an error if the txs of a response include a tx denied
+// by the policy, other than a mandatory tx.
+func (b *Builder) checkPolicy(req *BuildBlockRequest, txs [][]byte) error {
+	box := b.getPolicy()
+	if box.policy == nil {
+		return nil
+	}
+
+	mandatory := make(map[string]bool, len(req.MandatoryTxs))
+	for _, m := range req.MandatoryTxs {
+		mandatory[string(m.Tx)] = true
+	}
+
+	for i, tx := range txs {
+		if mandatory[string(tx)] {
+			continue
+		}
+		if d := box.policy.Evaluate(tx, box.decode); !d.Allowed {
+			return fmt.Errorf("%w: tx %d: %s", ErrPolicyViolation, i, d.Reason)
+		}
+	}
+	return nil
+}
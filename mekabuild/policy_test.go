@@ -0,0 +1,113 @@
+package mekabuild_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+const testPolicy = `{
+	"max_tx_bytes": 64,
+	"rules": [
+		{"name": "sanctioned", "action": "deny", "senders": ["cosmos1bad"]},
+		{"name": "transfers", "action": "allow", "msg_types": ["/ibc.applications.transfer.*"]},
+		{"name": "no-ibc", "action": "deny", "msg_types": ["/ibc.*"]}
+	]
+}`
+
+// decodeTestTx decodes txs of the form "<msg type>|<sender>".
+func decodeTestTx(tx []byte) (mekabuild.TxInfo, error) {
+	parts := strings.SplitN(string(tx), "|", 2)
+	if len(parts) != 2 {
+		return mekabuild.TxInfo{}, errors.New("malformed tx")
+	}
+	return mekabuild.TxInfo{MsgTypes: []string{parts[0]}, Senders: []string{parts[1]}}, nil
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	t.Parallel()
+
+	policy, err := mekabuild.ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		tx      string
+		allowed bool
+		rule    string
+	}{
+		{"/cosmos.bank.v1beta1.MsgSend|cosmos1good", true, ""},
+		{"/cosmos.bank.v1beta1.MsgSend|cosmos1bad", false, "sanctioned"},
+		{"/ibc.applications.transfer.v1.MsgTransfer|cosmos1good", true, "transfers"},
+		{"/ibc.core.client.v1.MsgUpdateClient|cosmos1good", false, "no-ibc"},
+		{"/cosmos.bank.v1beta1.MsgSend|" + strings.Repeat("x", 64), false, ""},
+		{"malformed", false, ""},
+	} {
+		d := policy.Evaluate([]byte(tc.tx), decodeTestTx)
+		if want, have := tc.allowed, d.Allowed; want != have {
+			t.Errorf("%s: allowed: want %v, have %v (%s)", tc.tx, want, have, d.Reason)
+		}
+		if want, have := tc.rule, d.Rule; want != have {
+			t.Errorf("%s: rule: want %q, have %q", tc.tx, want, have)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{"max_tx_byte": 64}`,
+		`{"default": "maybe"}`,
+		`{"rules": [{"name": "no-action"}]}`,
+		`{"rules": [{"name": "glob", "action": "deny", "msg_types": ["/ibc.*.MsgTransfer"]}]}`,
+	} {
+		if _, err := mekabuild.ParsePolicy([]byte(invalid)); err == nil {
+			t.Errorf("%s: want error, have none", invalid)
+		}
+	}
+}
+
+func TestBuilderPolicy(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		key       = newMockKey(t, "validator", nil)
+		submitted = make(chan [][]byte, 1)
+		server    = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req mekabuild.BuildBlockRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			submitted <- req.Txs
+			json.NewEncoder(w).Encode(mekabuild.BuildBlockResponse{Txs: append(req.Txs, []byte("/ibc.core.client.v1.MsgUpdateClient|cosmos1builder"))})
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-id", key.addr)
+	)
+
+	policy, err := mekabuild.ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.SetPolicy(policy, nil); err == nil {
+		t.Errorf("policy without decoder: want error, have none")
+	}
+	if err := builder.SetPolicy(policy, decodeTestTx); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1, Txs: [][]byte{
+		[]byte("/cosmos.bank.v1beta1.MsgSend|cosmos1good"),
+		[]byte("/cosmos.bank.v1beta1.MsgSend|cosmos1bad"),
+	}}
+	_, err = builder.BuildBlock(ctx, req)
+	if !errors.Is(err, mekabuild.ErrPolicyViolation) {
+		t.Errorf("denied tx in block: want %v, have %v", mekabuild.ErrPolicyViolation, err)
+	}
+	if want, have := 1, len(<-submitted); want != have {
+		t.Errorf("submitted txs: want %d, have %d", want, have)
+	}
+}
@@ -0,0 +1,71 @@
+package mekabuild
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// Request encoding reuses gzip writers and buffers across requests, so that
+// proposers of large blocks don't produce garbage, and GC pauses, on the
+// critical path of a proposal.
+
+// gzipWriterPools holds gzip writers by compression level, offset by
+// gzip.HuffmanOnly, since writers can't change their level once created.
+var gzipWriterPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+// getGzipWriter returns a gzip writer with the given level, writing to w.
+func getGzipWriter(w io.Writer, level int) (*gzip.Writer, error) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return gzip.NewWriterLevel(w, level) // returns the error
+	}
+	if zw, ok := gzipWriterPools[level-gzip.HuffmanOnly].Get().(*gzip.Writer); ok {
+		zw.Reset(w)
+		return zw, nil
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// putGzipWriter returns a closed gzip writer with the given level to its pool.
+func putGzipWriter(zw *gzip.Writer, level int) {
+	zw.Reset(io.Discard) // don't retain the destination
+	gzipWriterPools[level-gzip.HuffmanOnly].Put(zw)
+}
+
+var bufioWriterPool sync.Pool
+
+// getBufioWriter returns a buffered writer of the given size, writing to w.
+func getBufioWriter(w io.Writer, size int) *bufio.Writer {
+	if bw, ok := bufioWriterPool.Get().(*bufio.Writer); ok && bw.Size() == size {
+		bw.Reset(w)
+		return bw
+	}
+	return bufio.NewWriterSize(w, size)
+}
+
+func putBufioWriter(bw *bufio.Writer) {
+	bw.Reset(nil)
+	bufioWriterPool.Put(bw)
+}
+
+// maxPooledBufferSize bounds the capacity of pooled buffers, so that a single
+// huge request doesn't pin its memory for the lifetime of the process.
+const maxPooledBufferSize = 16 << 20
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
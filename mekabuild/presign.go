@@ -0,0 +1,364 @@
+package mekabuild
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Presigning takes the validator key off the critical path of a build. Early
+// in the round, the validator key signs the static portion of the request,
+// i.e. chain, height, validator and limits, together with a fresh single-use
+// session key. Once the txs are known, the session key, which is held in
+// memory by the builder, signs a commitment to the txs hash. Signing with the
+// session key is fast even if the validator key lives in a slow remote signer.
+//
+// Presigned requests are only sent to builder APIs that support
+// CapabilityPresigning, and are verified by VerifyBuildBlockRequest.
+//
+// With replay protection, a retried presigned request needs a fresh nonce,
+// which the presignature doesn't cover. Then the session key signs the fresh
+// nonce along with the txs commitment, and the presignature carries the nonce
+// it was made with, so retries stay off the validator key too.
+
+// Presignature accompanies a presigned build request. The request's Signature
+// is the session key's signature over TxsCommitmentSignBytes.
+type Presignature struct {
+	// SessionKey is the ed25519 public key that signs the txs commitment.
+	SessionKey []byte `json:"session_key"`
+
+	// Signature is the validator's signature over PresignRequest.SignBytes.
+	Signature []byte `json:"signature"`
+
+	// Nonce and Timestamp are the replay protection of the presign request,
+	// set if they differ from the build request's, i.e. for retries. Then the
+	// session key's signature also covers the build request's nonce and
+	// timestamp.
+	Nonce     uint64 `json:"nonce,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+}
+
+// PresignRequest is the static portion of a build request, signed by the
+// validator key ahead of time. Like BuildBlockRequest, it contains a Signature
+// field that needs to be set by signers.
+type PresignRequest struct {
+	ChainID          string         `json:"chain_id"`
+	Height           int64          `json:"height"`
+	ValidatorAddress string         `json:"validator_address"`
+	MaxBytes         int64          `json:"max_bytes"`
+	MaxGas           int64          `json:"max_gas"`
+	TxsHashVersion   TxsHashVersion `json:"txs_hash_version,omitempty"`
+	KeyType          string         `json:"key_type,omitempty"`
+	Nonce            uint64         `json:"nonce,omitempty"`
+	Timestamp        int64          `json:"timestamp,omitempty"`
+	DomainTag        string         `json:"domain_tag,omitempty"`
+	ProviderChainID  string         `json:"provider_chain_id,omitempty"`
+	ConsumerID       string         `json:"consumer_id,omitempty"`
+	SessionKey       []byte         `json:"session_key"`
+	Signature        []byte         `json:"signature"`
+}
+
+// SignBytes returns the bytes that should be signed by the validator key,
+// honoring the request's KeyType, DomainTag, consumer chain and replay
+// protection.
+func (r *PresignRequest) SignBytes() []byte {
+	signBytes := PresignBuildBlockRequestSignBytes(r.TxsHashVersion, r.ChainID, r.Height, r.ValidatorAddress, r.MaxBytes, r.MaxGas, r.SessionKey)
+	signBytes = bindReplayProtection(r.Nonce, r.Timestamp, signBytes)
+	signBytes = bindKeyType(r.KeyType, signBytes)
+	signBytes = bindDomainTag(r.DomainTag, signBytes)
+	return bindConsumerChain(r.ProviderChainID, r.ConsumerID, signBytes)
+}
+
+// PresignBuildBlockRequestSignBytes returns a stable byte representation of
+// the static portion of a build request, and the session key which will
+// commit to its txs.
+func PresignBuildBlockRequestSignBytes(version TxsHashVersion, chainID string, height int64, validatorAddr string, maxBytes, maxGas int64, sessionKey []byte) []byte {
+	// XXX: As with BuildBlockRequestSignBytes, changing the order or the set
+	// of fields requires updating both the builder API and its clients.
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`presigned-build-block-request`))
+	mustEncode(&sb, uint64(version))
+	mustEncode(&sb, uint64(len([]byte(chainID))))
+	mustEncode(&sb, []byte(chainID))
+	mustEncode(&sb, height)
+	mustEncode(&sb, uint64(len([]byte(validatorAddr))))
+	mustEncode(&sb, []byte(validatorAddr))
+	mustEncode(&sb, maxBytes)
+	mustEncode(&sb, maxGas)
+	mustEncode(&sb, uint64(len(sessionKey)))
+	mustEncode(&sb, sessionKey)
+	return sb.Bytes()
+}
+
+// TxsCommitmentSignBytes returns the bytes signed by the session key of a
+// presigned build request, binding the txs hash to the request.
+func TxsCommitmentSignBytes(chainID string, height int64, validatorAddr string, txsHash []byte) []byte {
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`txs-commitment`))
+	mustEncode(&sb, uint64(len([]byte(chainID))))
+	mustEncode(&sb, []byte(chainID))
+	mustEncode(&sb, height)
+	mustEncode(&sb, uint64(len([]byte(validatorAddr))))
+	mustEncode(&sb, []byte(validatorAddr))
+	mustEncode(&sb, uint64(len(txsHash)))
+	mustEncode(&sb, txsHash)
+	return sb.Bytes()
+}
+
+// PresignSigner is implemented by signers that can sign the static portion of
+// build requests ahead of time. See Builder.Presign.
+type PresignSigner interface {
+	SignPresignRequest(*PresignRequest) error
+}
+
+// ErrPresignUnsupported is returned by Presign if the builder API hasn't
+// advertised CapabilityPresigning, or the signer doesn't implement
+// PresignSigner.
+var ErrPresignUnsupported = errors.New("presigning unsupported")
+
+// Presign signs the static portion of the build request for the given height
+// ahead of time. A subsequent BuildBlock call for the same chain, height,
+// validator and limits uses the presignature, and only signs the txs with the
+// session key. Presignatures are single use. Presigning again for the same
+// height replaces the previous presignature, and presignatures for lower
+// heights are dropped. With replay protection, the presignature carries the
+// nonce and timestamp of the time it was made, so it should be used before any
+// other build request is sent.
+func (b *Builder) Presign(height, maxBytes, maxGas int64) error {
+	if b.addrErr != nil {
+		return b.addrErr
+	}
+
+	if err := b.checkWritable("presign"); err != nil {
+		return err
+	}
+
+	if caps, _ := b.Capabilities(); !caps.Has(CapabilityPresigning) {
+		return fmt.Errorf("%w: builder API doesn't support it", ErrPresignUnsupported)
+	}
+
+	ps, ok := b.signer.(PresignSigner)
+	if !ok {
+		return fmt.Errorf("%w: signer can't presign", ErrPresignUnsupported)
+	}
+
+	domainTag := b.getDomainTag()
+	if err := b.checkDomainTag(domainTag); err != nil {
+		return err
+	}
+	if err := b.checkConsumerChain(); err != nil {
+		return err
+	}
+	consumer, _ := b.ConsumerChain()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(b.getRandom())
+	if err != nil {
+		return fmt.Errorf("generate session key: %w", err)
+	}
+
+	req := &PresignRequest{
+		ChainID:          b.chainID,
+		Height:           height,
+		ValidatorAddress: b.validatorAddr,
+		MaxBytes:         maxBytes,
+		MaxGas:           maxGas,
+		DomainTag:        domainTag,
+		ProviderChainID:  consumer.ProviderChainID,
+		ConsumerID:       consumer.ConsumerID,
+		SessionKey:       publicKey,
+	}
+	if b.replayProtected() {
+		now := b.now()
+		req.Nonce = b.nextNonce(now)
+		req.Timestamp = now.UnixNano() / int64(time.Millisecond)
+	}
+
+	b.signMtx.Lock()
+	err = ps.SignPresignRequest(req)
+	b.signMtx.Unlock()
+	if err != nil {
+		return fmt.Errorf("sign presign request: %w", err)
+	}
+
+	b.presigned.put(req, privateKey)
+	return nil
+}
+
+// presign signs the request with a matching presignature, if there is one.
+// It returns false if there isn't, and the request should be signed as usual.
+func (b *Builder) presign(req *BuildBlockRequest) (bool, error) {
+	if caps, _ := b.Capabilities(); !caps.Has(CapabilityPresigning) {
+		return false, nil
+	}
+	if req.Mode != BuildModeFull {
+		return false, nil // presignatures don't cover the build mode
+	}
+
+	pr, sessionKey := b.presigned.take(req)
+	if pr == nil {
+		return false, nil
+	}
+
+	txsHash, err := HashTxsVersion(pr.TxsHashVersion, req.Txs...)
+	if err != nil {
+		return false, err
+	}
+
+	req.KeyType = pr.KeyType
+	req.Nonce = pr.Nonce
+	req.Timestamp = pr.Timestamp
+	req.Presign = &Presignature{SessionKey: pr.SessionKey, Signature: pr.Signature}
+	req.Signature = ed25519.Sign(sessionKey, req.txsCommitmentSignBytes(txsHash))
+	return true, nil
+}
+
+// represign signs a retry of a presigned request, which has a fresh nonce and
+// timestamp, with the session key of its presignature. It returns false if the
+// session key is gone, e.g. because the height was presigned again, and the
+// request should be signed as usual.
+func (b *Builder) represign(req *BuildBlockRequest, presign *Presignature, nonce uint64, timestamp int64) (bool, error) {
+	sessionKey := b.presigned.sessionKey(req.Height, presign.SessionKey)
+	if sessionKey == nil {
+		return false, nil
+	}
+
+	txsHash, err := HashTxsVersion(req.TxsHashVersion, req.Txs...)
+	if err != nil {
+		return false, err
+	}
+
+	p := *presign
+	if p.Nonce == 0 && p.Timestamp == 0 {
+		p.Nonce, p.Timestamp = req.Nonce, req.Timestamp
+	}
+	req.Nonce, req.Timestamp = nonce, timestamp
+	req.Presign = &p
+	req.Signature = ed25519.Sign(sessionKey, req.txsCommitmentSignBytes(txsHash))
+	return true, nil
+}
+
+// txsCommitmentSignBytes returns the bytes signed by the session key of a
+// presigned build request.
+func (r *BuildBlockRequest) txsCommitmentSignBytes(txsHash []byte) []byte {
+	signBytes := bindMandatoryTxs(r.MandatoryTxs, TxsCommitmentSignBytes(r.ChainID, r.Height, r.ValidatorAddress, txsHash))
+	if p := r.Presign; p.Nonce != 0 || p.Timestamp != 0 {
+		signBytes = bindReplayProtection(r.Nonce, r.Timestamp, signBytes)
+	}
+	return signBytes
+}
+
+// presignRequest returns the static portion of a presigned build request.
+func (r *BuildBlockRequest) presignRequest() *PresignRequest {
+	nonce, timestamp := r.Nonce, r.Timestamp
+	if p := r.Presign; p.Nonce != 0 || p.Timestamp != 0 {
+		nonce, timestamp = p.Nonce, p.Timestamp
+	}
+	return &PresignRequest{
+		ChainID:          r.ChainID,
+		Height:           r.Height,
+		ValidatorAddress: r.ValidatorAddress,
+		MaxBytes:         r.MaxBytes,
+		MaxGas:           r.MaxGas,
+		TxsHashVersion:   r.TxsHashVersion,
+		KeyType:          r.KeyType,
+		Nonce:            nonce,
+		Timestamp:        timestamp,
+		DomainTag:        r.DomainTag,
+		ProviderChainID:  r.ProviderChainID,
+		ConsumerID:       r.ConsumerID,
+		SessionKey:       r.Presign.SessionKey,
+	}
+}
+
+// verifyPresigned verifies a presigned build request: the validator signature
+// over the static portion, and the session key signature over the txs.
+func verifyPresigned(req *BuildBlockRequest, publicKey []byte) error {
+	if len(req.Presign.SessionKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid session key size %d", len(req.Presign.SessionKey))
+	}
+
+	ok, err := VerifySignature(req.KeyType, publicKey, req.presignRequest().SignBytes(), req.Presign.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrBadSignature
+	}
+
+	txsHash, err := HashTxsVersion(req.TxsHashVersion, req.Txs...)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(req.Presign.SessionKey, req.txsCommitmentSignBytes(txsHash), req.Signature) {
+		return ErrBadSignature
+	}
+
+	return nil
+}
+
+// presignCache holds presignatures, and their session keys, by height. Taken
+// presignatures keep their session keys, to sign retries.
+type presignCache struct {
+	mtx     sync.Mutex
+	entries map[int64]presignEntry
+}
+
+type presignEntry struct {
+	req        *PresignRequest
+	sessionKey ed25519.PrivateKey
+	taken      bool
+}
+
+func (c *presignCache) put(req *PresignRequest, sessionKey ed25519.PrivateKey) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[int64]presignEntry{}
+	}
+	for height := range c.entries {
+		if height < req.Height {
+			delete(c.entries, height)
+		}
+	}
+	c.entries[req.Height] = presignEntry{req: req, sessionKey: sessionKey}
+}
+
+// take marks as taken, and returns, the presignature matching the build
+// request.
+func (c *presignCache) take(req *BuildBlockRequest) (*PresignRequest, ed25519.PrivateKey) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.entries[req.Height]
+	if !ok || e.taken {
+		return nil, nil
+	}
+
+	pr := e.req
+	if pr.ChainID != req.ChainID || pr.ValidatorAddress != req.ValidatorAddress || pr.MaxBytes != req.MaxBytes || pr.MaxGas != req.MaxGas || pr.TxsHashVersion != req.TxsHashVersion || pr.DomainTag != req.DomainTag || pr.ProviderChainID != req.ProviderChainID || pr.ConsumerID != req.ConsumerID {
+		return nil, nil
+	}
+
+	e.taken = true
+	c.entries[req.Height] = e
+	return pr, e.sessionKey
+}
+
+// sessionKey returns the session key of the taken presignature for the given
+// height and session public key, if it's still held.
+func (c *presignCache) sessionKey(height int64, publicKey []byte) ed25519.PrivateKey {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.entries[height]
+	if !ok || !e.taken || !bytes.Equal(e.req.SessionKey, publicKey) {
+		return nil
+	}
+	return e.sessionKey
+}
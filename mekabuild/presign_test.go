@@ -0,0 +1,206 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderPresign(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		key       = &presignKey{mockKey: newMockKey(t, "validator", nil)}
+		api       = newMockAPI()
+		presigned = make(chan *mekabuild.BuildBlockRequest, 10)
+		server    = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(mekabuild.CapabilitiesHeader, mekabuild.CapabilityPresigning.String())
+
+			body, _ := io.ReadAll(r.Body)
+			var req mekabuild.BuildBlockRequest
+			if err := json.Unmarshal(body, &req); err == nil && req.Presign != nil {
+				presigned <- &req
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		newReq    = func(height int64) *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	if err := builder.Presign(1, 1000, -1); !errors.Is(err, mekabuild.ErrPresignUnsupported) {
+		t.Fatalf("before negotiation: want %v, have %v", mekabuild.ErrPresignUnsupported, err)
+	}
+
+	if _, err := builder.BuildBlock(ctx, newReq(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.Presign(2, 1000, -1); err != nil {
+		t.Fatalf("presign: %v", err)
+	}
+
+	signs := atomic.LoadInt32(&key.signs)
+
+	if _, err := builder.BuildBlock(ctx, newReq(2)); err != nil {
+		t.Fatalf("presigned build: %v", err)
+	}
+
+	if want, have := signs, atomic.LoadInt32(&key.signs); want != have {
+		t.Errorf("validator signatures during presigned build: want %d, have %d", want, have)
+	}
+
+	req := <-presigned
+	if err := mekabuild.VerifyBuildBlockRequest(req, key.PublicKey); err != nil {
+		t.Errorf("verify presigned request: %v", err)
+	}
+
+	tampered := *req
+	tampered.Txs = [][]byte{[]byte("other tx")}
+	if err := mekabuild.VerifyBuildBlockRequest(&tampered, key.PublicKey); !errors.Is(err, mekabuild.ErrBadSignature) {
+		t.Errorf("tampered txs: want %v, have %v", mekabuild.ErrBadSignature, err)
+	}
+
+	tampered = *req
+	tampered.MaxBytes++
+	if err := mekabuild.VerifyBuildBlockRequest(&tampered, key.PublicKey); !errors.Is(err, mekabuild.ErrBadSignature) {
+		t.Errorf("tampered limits: want %v, have %v", mekabuild.ErrBadSignature, err)
+	}
+
+	// Presignatures are single use, and limits must match.
+	if err := builder.Presign(3, 2000, -1); err != nil {
+		t.Fatalf("presign: %v", err)
+	}
+	if _, err := builder.BuildBlock(ctx, newReq(3)); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := signs+1, atomic.LoadInt32(&key.signs); want != have {
+		t.Errorf("validator signatures with mismatched limits: want %d, have %d", want, have)
+	}
+	if want, have := 0, len(presigned); want != have {
+		t.Errorf("presigned requests with mismatched limits: want %d, have %d", want, have)
+	}
+
+	if !mekabuild.IsValidatorSignBytes((&mekabuild.PresignRequest{}).SignBytes()) {
+		t.Errorf("presign sign bytes aren't recognized as validator sign bytes")
+	}
+}
+
+// presignKey is a mockKey which can presign, and counts build request
+// signatures.
+type presignKey struct {
+	*mockKey
+	signs int32
+}
+
+func (k *presignKey) SignBuildBlockRequest(r *mekabuild.BuildBlockRequest) error {
+	atomic.AddInt32(&k.signs, 1)
+	return k.mockKey.SignBuildBlockRequest(r)
+}
+
+func (k *presignKey) SignPresignRequest(r *mekabuild.PresignRequest) error {
+	r.Signature = ed25519.Sign(k.mockKey.PrivateKey, r.SignBytes())
+	return nil
+}
+
+func TestBuilderPresignRetry(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx     = context.Background()
+		chainID = "chain-id"
+		key     = &presignKey{mockKey: newMockKey(t, "validator", nil)}
+		api     = newMockAPI()
+		retried = make(chan *mekabuild.BuildBlockRequest, 10)
+		server  = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			var req mekabuild.BuildBlockRequest
+			if err := json.Unmarshal(body, &req); err == nil && req.Presign != nil {
+				retried <- &req
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			api.ServeHTTP(w, r)
+		}))
+		lossy = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			var req mekabuild.BuildBlockRequest
+			if err := json.Unmarshal(body, &req); err != nil || req.Presign == nil {
+				api.ServeHTTP(w, r)
+				return
+			}
+
+			api.ServeHTTP(httptest.NewRecorder(), r) // accepted, but the response is lost
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}))
+		apiURL, _   = url.Parse(server.URL)
+		lossyURL, _ = url.Parse(lossy.URL)
+		builder     = mekabuild.NewBuilder(&http.Client{}, lossyURL, key, chainID, key.addr)
+		newReq      = func(height int64) *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	api.RequireFreshRequests(time.Minute)
+	builder.SetReplayProtection(true)
+	if err := builder.SetEndpoints(lossyURL, apiURL); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builder.BuildBlock(ctx, newReq(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.Presign(2, 1000, -1); err != nil {
+		t.Fatalf("presign: %v", err)
+	}
+
+	signs := atomic.LoadInt32(&key.signs)
+	if _, err := builder.BuildBlock(ctx, newReq(2)); err != nil {
+		t.Fatalf("presigned build with retry: %v", err)
+	}
+	if want, have := signs, atomic.LoadInt32(&key.signs); want != have {
+		t.Errorf("validator signatures during presigned retry: want %d, have %d", want, have)
+	}
+
+	if want, have := 3, len(api.Builds()); want != have {
+		t.Errorf("builds accepted: want %d, have %d", want, have)
+	}
+	if want, have := 1, len(retried); want != have {
+		t.Fatalf("presigned retries: want %d, have %d", want, have)
+	}
+	req := <-retried
+	if req.Presign.Nonce == 0 || req.Presign.Nonce >= req.Nonce {
+		t.Errorf("retry nonce: want greater than presign nonce %d, have %d", req.Presign.Nonce, req.Nonce)
+	}
+	if err := mekabuild.VerifyBuildBlockRequest(req, key.PublicKey); err != nil {
+		t.Errorf("verify presigned retry: %v", err)
+	}
+
+	tampered := *req
+	tampered.Nonce++
+	if err := mekabuild.VerifyBuildBlockRequest(&tampered, key.PublicKey); !errors.Is(err, mekabuild.ErrBadSignature) {
+		t.Errorf("tampered nonce: want %v, have %v", mekabuild.ErrBadSignature, err)
+	}
+}
@@ -0,0 +1,168 @@
+package mekabuild
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// UploadProgress reports the progress of a request body upload. Progress is
+// measured as the HTTP client reads the body, which it does as fast as the
+// connection accepts it, so a slow link shows up as slow progress.
+type UploadProgress struct {
+	Endpoint string
+	Path     string
+	Sent     int64 // bytes sent so far, after compression
+	Total    int64 // bytes in the body, after compression
+	Elapsed  time.Duration
+}
+
+// Rate returns the average upload rate so far, in bytes per second.
+func (p UploadProgress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Sent) / p.Elapsed.Seconds()
+}
+
+// Remaining estimates the time to send the rest of the body at the average
+// rate so far, or returns -1 if nothing has been sent yet.
+func (p UploadProgress) Remaining() time.Duration {
+	rate := p.Rate()
+	if rate <= 0 {
+		return -1
+	}
+	return time.Duration(float64(p.Total-p.Sent) / rate * float64(time.Second))
+}
+
+// ErrUploadTooSlow is returned when an upload is aborted because, at the rate
+// observed so far, it can't complete before the request deadline. It isn't
+// retried, so BuildBlock falls back right away. See SetUploadAbort.
+var ErrUploadTooSlow = errors.New("upload can't complete before deadline")
+
+// SetUploadProgress sets a function called with the progress of each request
+// body upload, after every read of the body by the HTTP client. It's called
+// from the HTTP client's goroutine, and must not block. A nil function
+// disables progress reporting.
+//
+// While progress is reported, or uploads may be aborted, compressed request
+// bodies are encoded up front, rather than streamed, so their total size is
+// known.
+func (b *Builder) SetUploadProgress(fn func(UploadProgress)) {
+	b.uploadProgress.Store(uploadProgressBox{fn})
+}
+
+// WithUploadProgress sets the upload progress function. See SetUploadProgress.
+func WithUploadProgress(fn func(UploadProgress)) Option {
+	return func(b *Builder) error {
+		b.SetUploadProgress(fn)
+		return nil
+	}
+}
+
+// SetUploadAbort controls whether uploads are aborted early, with
+// ErrUploadTooSlow, once the rate observed so far shows that they can't
+// complete before the request deadline. That lets the caller fall back before
+// the deadline, rather than after a timeout. Requests without a deadline are
+// never aborted. It's disabled by default.
+func (b *Builder) SetUploadAbort(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&b.uploadAbort, v)
+}
+
+// WithUploadAbort controls whether slow uploads are aborted early. See
+// SetUploadAbort.
+func WithUploadAbort(enabled bool) Option {
+	return func(b *Builder) error {
+		b.SetUploadAbort(enabled)
+		return nil
+	}
+}
+
+type uploadProgressBox struct{ fn func(UploadProgress) }
+
+func (b *Builder) getUploadProgress() func(UploadProgress) {
+	box, _ := b.uploadProgress.Load().(uploadProgressBox)
+	return box.fn
+}
+
+// trackingUploads returns true if request bodies must be wrapped by
+// trackUpload.
+func (b *Builder) trackingUploads() bool {
+	return b.getUploadProgress() != nil || atomic.LoadInt32(&b.uploadAbort) != 0
+}
+
+// Uploads are only aborted once enough has been sent to estimate the rate.
+const (
+	uploadAbortMinBytes   = 32 << 10
+	uploadAbortMinElapsed = 10 * time.Millisecond
+)
+
+// trackUpload wraps the body of r, and its GetBody, to report progress and
+// abort slow uploads. The body must have a known length.
+func (b *Builder) trackUpload(ctx context.Context, r *http.Request) {
+	var (
+		fn       = b.getUploadProgress()
+		abort    = atomic.LoadInt32(&b.uploadAbort) != 0
+		progress = UploadProgress{Endpoint: endpointName(r.URL), Path: r.URL.Path, Total: r.ContentLength}
+	)
+
+	wrap := func(body io.ReadCloser) io.ReadCloser {
+		return &uploadTracker{ReadCloser: body, b: b, ctx: ctx, fn: fn, abort: abort, progress: progress, begin: b.now()}
+	}
+
+	r.Body = wrap(r.Body)
+	if getBody := r.GetBody; getBody != nil {
+		r.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return wrap(body), nil
+		}
+	}
+}
+
+type uploadTracker struct {
+	io.ReadCloser
+	b        *Builder
+	ctx      context.Context
+	fn       func(UploadProgress)
+	abort    bool
+	progress UploadProgress
+	begin    time.Time
+}
+
+func (t *uploadTracker) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+
+	t.progress.Sent += int64(n)
+	t.progress.Elapsed = t.b.since(t.begin)
+	if t.fn != nil {
+		t.fn(t.progress)
+	}
+
+	if t.abort && err == nil && t.tooSlow() {
+		t.b.getLogger().Infof("aborting upload, deadline too close: chain_id=%s endpoint=%s path=%s sent=%d total=%d remaining=%s", t.b.chainID, t.progress.Endpoint, t.progress.Path, t.progress.Sent, t.progress.Total, t.progress.Remaining())
+		return n, ErrUploadTooSlow
+	}
+
+	return n, err
+}
+
+func (t *uploadTracker) tooSlow() bool {
+	if t.progress.Sent < uploadAbortMinBytes || t.progress.Elapsed < uploadAbortMinElapsed || t.progress.Sent >= t.progress.Total {
+		return false
+	}
+	deadline, ok := t.ctx.Deadline()
+	if !ok {
+		return false
+	}
+	return t.progress.Remaining() > t.b.until(deadline)
+}
@@ -0,0 +1,117 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderUploadProgress(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx           = context.Background()
+		builder, addr = newSlowUploadBuilder(t, 0)
+		progress      []mekabuild.UploadProgress
+	)
+	builder.SetUploadProgress(func(p mekabuild.UploadProgress) { progress = append(progress, p) })
+
+	if _, err := builder.BuildBlock(ctx, newLargeBuildBlockRequest(addr)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(progress) < 2 {
+		t.Fatalf("progress reports: want several, have %d", len(progress))
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i].Sent < progress[i-1].Sent {
+			t.Errorf("report %d: sent decreased from %d to %d", i, progress[i-1].Sent, progress[i].Sent)
+		}
+	}
+	last := progress[len(progress)-1]
+	if last.Total <= 0 || last.Sent != last.Total {
+		t.Errorf("final report: want all of a known total sent, have %d of %d", last.Sent, last.Total)
+	}
+	if want, have := "/v0/build", last.Path; want != have {
+		t.Errorf("path: want %q, have %q", want, have)
+	}
+}
+
+func TestBuilderUploadAbort(t *testing.T) {
+	t.Parallel()
+
+	var (
+		timeout       = 200 * time.Millisecond
+		builder, addr = newSlowUploadBuilder(t, 10*time.Millisecond)
+	)
+	builder.SetUploadAbort(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	begin := time.Now()
+	_, err := builder.BuildBlock(ctx, newLargeBuildBlockRequest(addr))
+	if !errors.Is(err, mekabuild.ErrUploadTooSlow) {
+		t.Fatalf("want %v, have %v", mekabuild.ErrUploadTooSlow, err)
+	}
+	if took := time.Since(begin); took >= timeout {
+		t.Errorf("abort took %s, want less than the %s timeout", took, timeout)
+	}
+}
+
+// newSlowUploadBuilder returns a builder whose HTTP client reads request bodies
+// in 16 KiB chunks, pausing for delay after each.
+func newSlowUploadBuilder(t *testing.T, delay time.Duration) (*mekabuild.Builder, string) {
+	t.Helper()
+
+	var (
+		key       = newMockKey(t, "validator", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		rt        = server.Client().Transport
+		client    = &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			var (
+				buf   bytes.Buffer
+				chunk = make([]byte, 16<<10)
+			)
+			for {
+				n, err := r.Body.Read(chunk)
+				buf.Write(chunk[:n])
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				time.Sleep(delay)
+			}
+			r.Body = io.NopCloser(&buf)
+			return rt.RoundTrip(r)
+		})}
+	)
+
+	api.AddPublicKey("chain-id", key.addr, key.PublicKey)
+	return mekabuild.NewBuilder(client, apiURL, key, "chain-id", key.addr), key.addr
+}
+
+// newLargeBuildBlockRequest returns a request with about 512 KiB of
+// incompressible txs.
+func newLargeBuildBlockRequest(addr string) *mekabuild.BuildBlockRequest {
+	rng := mathrand.New(mathrand.NewSource(1))
+	txs := make([][]byte, 32)
+	for i := range txs {
+		txs[i] = make([]byte, 16<<10)
+		rng.Read(txs[i])
+	}
+
+	return &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: addr, MaxBytes: 10 << 20, MaxGas: -1, Txs: txs}
+}
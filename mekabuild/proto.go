@@ -0,0 +1,561 @@
+package mekabuild
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ProtoCodec encodes build requests and responses as protobuf, per the schema
+// below. Other request types are sent as JSON. The messages are encoded by
+// hand, to keep this package free of dependencies.
+//
+//	syntax = "proto3";
+//
+//	message BuildBlockRequest {
+//	  string chain_id = 1;
+//	  int64 height = 2;
+//	  string validator_address = 3;
+//	  int64 max_bytes = 4;
+//	  int64 max_gas = 5;
+//	  repeated bytes txs = 6;
+//	  int32 txs_hash_version = 7;
+//	  string key_type = 8;
+//	  uint64 nonce = 9;
+//	  int64 timestamp = 10;
+//	  bytes signature = 11;
+//	  Presignature presign = 12;
+//	  AuctionHint hint = 13;
+//	  FeeMarket fee_market = 14;
+//	  repeated MandatoryTx mandatory_txs = 15;
+//	  CosignerSet cosigners = 16;
+//	  string domain_tag = 17;
+//	  string provider_chain_id = 18;
+//	  string consumer_id = 19;
+//	  string mode = 20;
+//	}
+//
+//	message CosignerSet {
+//	  uint32 threshold = 1;
+//	  uint32 total = 2;
+//	  repeated uint32 ids = 3;
+//	}
+//
+//	message MandatoryTx {
+//	  bytes tx = 1;
+//	  string position = 2;
+//	}
+//
+//	message Presignature {
+//	  bytes session_key = 1;
+//	  bytes signature = 2;
+//	  uint64 nonce = 3;
+//	  int64 timestamp = 4;
+//	}
+//
+//	message AuctionHint {
+//	  int64 rtt_ms = 1;
+//	  int64 time_budget_ms = 2;
+//	}
+//
+//	message FeeMarket {
+//	  string min_gas_prices = 1;
+//	  string base_fee = 2;
+//	}
+//
+//	message BuildBlockResponse {
+//	  repeated bytes txs = 1;
+//	  string validator_payment = 2;
+//	  bytes signature = 3;
+//	  string auction_id = 4;
+//	  PaymentReceipt receipt = 5;
+//	}
+//
+//	message PaymentReceipt {
+//	  string chain_id = 1;
+//	  int64 height = 2;
+//	  string validator_address = 3;
+//	  string amount = 4;
+//	  string denom = 5;
+//	  string payment_tx_hash = 6;
+//	  bytes signature = 7;
+//	}
+var ProtoCodec Codec = protoCodec{}
+
+type protoCodec struct{}
+
+func (protoCodec) ContentType() string      { return "application/x-protobuf" }
+func (protoCodec) Capability() Capabilities { return CapabilityProto }
+
+// Supports returns true for build requests and responses.
+func (protoCodec) Supports(v interface{}) bool {
+	switch v.(type) {
+	case *BuildBlockRequest, BuildBlockRequest, *BuildBlockResponse, BuildBlockResponse:
+		return true
+	default:
+		return false
+	}
+}
+
+func (protoCodec) Encode(w io.Writer, v interface{}) error {
+	var e protoEncoder
+	switch m := v.(type) {
+	case *BuildBlockRequest:
+		e.buildBlockRequest(m)
+	case BuildBlockRequest:
+		e.buildBlockRequest(&m)
+	case *BuildBlockResponse:
+		e.buildBlockResponse(m)
+	case BuildBlockResponse:
+		e.buildBlockResponse(&m)
+	default:
+		return fmt.Errorf("%w: %T", ErrCodecUnsupported, v)
+	}
+	_, err := w.Write(e.buf)
+	return err
+}
+
+func (protoCodec) Decode(r io.Reader, v interface{}) error {
+	data, err := io.ReadAll(io.LimitReader(r, DefaultMaxDecompressedBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > DefaultMaxDecompressedBytes {
+		return fmt.Errorf("protobuf message exceeds %d bytes", DefaultMaxDecompressedBytes)
+	}
+
+	switch m := v.(type) {
+	case *BuildBlockRequest:
+		*m = BuildBlockRequest{}
+		return decodeBuildBlockRequest(data, m)
+	case *BuildBlockResponse:
+		*m = BuildBlockResponse{}
+		return decodeBuildBlockResponse(data, m)
+	default:
+		return fmt.Errorf("%w: %T", ErrCodecUnsupported, v)
+	}
+}
+
+// Protobuf wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+type protoEncoder struct {
+	buf []byte
+}
+
+func (e *protoEncoder) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func (e *protoEncoder) tag(field, wireType int) {
+	e.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (e *protoEncoder) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, protoVarint)
+	e.varint(v)
+}
+
+func (e *protoEncoder) int(field int, v int64) {
+	e.uint(field, uint64(v)) // negative int64s are 10 byte varints
+}
+
+func (e *protoEncoder) bytes(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	e.repeatedBytes(field, v)
+}
+
+func (e *protoEncoder) repeatedBytes(field int, v []byte) {
+	e.tag(field, protoBytes)
+	e.varint(uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *protoEncoder) string(field int, v string) {
+	e.bytes(field, []byte(v))
+}
+
+func (e *protoEncoder) message(field int, encode func(*protoEncoder)) {
+	var sub protoEncoder
+	encode(&sub)
+	e.repeatedBytes(field, sub.buf)
+}
+
+func (e *protoEncoder) buildBlockRequest(m *BuildBlockRequest) {
+	e.string(1, m.ChainID)
+	e.int(2, m.Height)
+	e.string(3, m.ValidatorAddress)
+	e.int(4, m.MaxBytes)
+	e.int(5, m.MaxGas)
+	for _, tx := range m.Txs {
+		e.repeatedBytes(6, tx)
+	}
+	e.int(7, int64(m.TxsHashVersion))
+	e.string(8, m.KeyType)
+	e.uint(9, m.Nonce)
+	e.int(10, m.Timestamp)
+	e.bytes(11, m.Signature)
+	if p := m.Presign; p != nil {
+		e.message(12, func(e *protoEncoder) {
+			e.bytes(1, p.SessionKey)
+			e.bytes(2, p.Signature)
+			e.uint(3, p.Nonce)
+			e.int(4, p.Timestamp)
+		})
+	}
+	if h := m.Hint; h != nil {
+		e.message(13, func(e *protoEncoder) {
+			e.int(1, h.RTTMillis)
+			e.int(2, h.TimeBudgetMillis)
+		})
+	}
+	if fm := m.FeeMarket; fm != nil {
+		e.message(14, func(e *protoEncoder) {
+			e.string(1, fm.MinGasPrices)
+			e.string(2, fm.BaseFee)
+		})
+	}
+	for _, mtx := range m.MandatoryTxs {
+		mtx := mtx
+		e.message(15, func(e *protoEncoder) {
+			e.bytes(1, mtx.Tx)
+			e.string(2, string(mtx.Position))
+		})
+	}
+	if c := m.Cosigners; c != nil {
+		e.message(16, func(e *protoEncoder) {
+			e.uint(1, uint64(c.Threshold))
+			e.uint(2, uint64(c.Total))
+			if len(c.IDs) > 0 {
+				var ids protoEncoder
+				for _, id := range c.IDs {
+					ids.varint(uint64(id))
+				}
+				e.repeatedBytes(3, ids.buf) // packed
+			}
+		})
+	}
+	e.string(17, m.DomainTag)
+	e.string(18, m.ProviderChainID)
+	e.string(19, m.ConsumerID)
+	e.string(20, string(m.Mode))
+}
+
+func (e *protoEncoder) buildBlockResponse(m *BuildBlockResponse) {
+	for _, tx := range m.Txs {
+		e.repeatedBytes(1, tx)
+	}
+	e.string(2, m.ValidatorPayment)
+	e.bytes(3, m.Signature)
+	e.string(4, m.AuctionID)
+	if r := m.Receipt; r != nil {
+		e.message(5, func(e *protoEncoder) {
+			e.string(1, r.ChainID)
+			e.int(2, r.Height)
+			e.string(3, r.ValidatorAddress)
+			e.string(4, r.Amount)
+			e.string(5, r.Denom)
+			e.string(6, r.PaymentTxHash)
+			e.bytes(7, r.Signature)
+		})
+	}
+}
+
+var errProtoTruncated = errors.New("protobuf: truncated message")
+
+// protoField is a decoded field. Varints are in n, and length-delimited
+// fields in b, which aliases the message.
+type protoField struct {
+	num      int
+	wireType int
+	n        uint64
+	b        []byte
+}
+
+// decodeProto calls fn for each field of the message, skipping fixed-size
+// fields, which aren't used by the schema.
+func decodeProto(data []byte, fn func(protoField) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		data = data[n:]
+
+		f := protoField{num: int(key >> 3), wireType: int(key & 7)}
+		if f.num <= 0 || key>>3 > math.MaxInt32 {
+			return fmt.Errorf("protobuf: invalid field number %d", key>>3)
+		}
+
+		switch f.wireType {
+		case protoVarint:
+			if f.n, n = binary.Uvarint(data); n <= 0 {
+				return errProtoTruncated
+			}
+			data = data[n:]
+		case protoBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return errProtoTruncated
+			}
+			f.b, data = data[n:n+int(size)], data[n+int(size):]
+		case protoFixed64:
+			if len(data) < 8 {
+				return errProtoTruncated
+			}
+			data = data[8:]
+			continue
+		case protoFixed32:
+			if len(data) < 4 {
+				return errProtoTruncated
+			}
+			data = data[4:]
+			continue
+		default:
+			return fmt.Errorf("protobuf: unsupported wire type %d", f.wireType)
+		}
+
+		if err := fn(f); err != nil {
+			return fmt.Errorf("field %d: %w", f.num, err)
+		}
+	}
+	return nil
+}
+
+func (f protoField) expect(wireType int) error {
+	if f.wireType != wireType {
+		return fmt.Errorf("protobuf: wire type %d, want %d", f.wireType, wireType)
+	}
+	return nil
+}
+
+func (f protoField) int64(dst *int64) error {
+	*dst = int64(f.n)
+	return f.expect(protoVarint)
+}
+
+func (f protoField) uint64(dst *uint64) error {
+	*dst = f.n
+	return f.expect(protoVarint)
+}
+
+func (f protoField) int(dst *int) error {
+	if err := f.expect(protoVarint); err != nil {
+		return err
+	}
+	if f.n > math.MaxInt32 {
+		return fmt.Errorf("protobuf: value %d out of range", f.n)
+	}
+	*dst = int(f.n)
+	return nil
+}
+
+// packedInts appends a repeated uint32 field, which may be packed or not.
+func (f protoField) packedInts(dst *[]int) error {
+	if f.wireType == protoVarint {
+		var v int
+		err := f.int(&v)
+		*dst = append(*dst, v)
+		return err
+	}
+	if err := f.expect(protoBytes); err != nil {
+		return err
+	}
+	for data := f.b; len(data) > 0; {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		if v > math.MaxInt32 {
+			return fmt.Errorf("protobuf: value %d out of range", v)
+		}
+		*dst = append(*dst, int(v))
+		data = data[n:]
+	}
+	return nil
+}
+
+func (f protoField) string(dst *string) error {
+	*dst = string(f.b)
+	return f.expect(protoBytes)
+}
+
+func (f protoField) bytes(dst *[]byte) error {
+	*dst = append([]byte(nil), f.b...)
+	return f.expect(protoBytes)
+}
+
+func decodeBuildBlockRequest(data []byte, m *BuildBlockRequest) error {
+	return decodeProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			return f.string(&m.ChainID)
+		case 2:
+			return f.int64(&m.Height)
+		case 3:
+			return f.string(&m.ValidatorAddress)
+		case 4:
+			return f.int64(&m.MaxBytes)
+		case 5:
+			return f.int64(&m.MaxGas)
+		case 6:
+			var tx []byte
+			err := f.bytes(&tx)
+			m.Txs = append(m.Txs, tx)
+			return err
+		case 7:
+			var v int64
+			err := f.int64(&v)
+			m.TxsHashVersion = TxsHashVersion(v)
+			return err
+		case 8:
+			return f.string(&m.KeyType)
+		case 9:
+			return f.uint64(&m.Nonce)
+		case 10:
+			return f.int64(&m.Timestamp)
+		case 11:
+			return f.bytes(&m.Signature)
+		case 12:
+			m.Presign = &Presignature{}
+			return decodeMessage(f, func(f protoField) error {
+				switch f.num {
+				case 1:
+					return f.bytes(&m.Presign.SessionKey)
+				case 2:
+					return f.bytes(&m.Presign.Signature)
+				case 3:
+					return f.uint64(&m.Presign.Nonce)
+				case 4:
+					return f.int64(&m.Presign.Timestamp)
+				}
+				return nil
+			})
+		case 13:
+			m.Hint = &AuctionHint{}
+			return decodeMessage(f, func(f protoField) error {
+				switch f.num {
+				case 1:
+					return f.int64(&m.Hint.RTTMillis)
+				case 2:
+					return f.int64(&m.Hint.TimeBudgetMillis)
+				}
+				return nil
+			})
+		case 14:
+			m.FeeMarket = &FeeMarket{}
+			return decodeMessage(f, func(f protoField) error {
+				switch f.num {
+				case 1:
+					return f.string(&m.FeeMarket.MinGasPrices)
+				case 2:
+					return f.string(&m.FeeMarket.BaseFee)
+				}
+				return nil
+			})
+		case 15:
+			var mtx MandatoryTx
+			err := decodeMessage(f, func(f protoField) error {
+				switch f.num {
+				case 1:
+					return f.bytes(&mtx.Tx)
+				case 2:
+					var position string
+					err := f.string(&position)
+					mtx.Position = TxPosition(position)
+					return err
+				}
+				return nil
+			})
+			m.MandatoryTxs = append(m.MandatoryTxs, mtx)
+			return err
+		case 16:
+			m.Cosigners = &CosignerSet{}
+			return decodeMessage(f, func(f protoField) error {
+				switch f.num {
+				case 1:
+					return f.int(&m.Cosigners.Threshold)
+				case 2:
+					return f.int(&m.Cosigners.Total)
+				case 3:
+					return f.packedInts(&m.Cosigners.IDs)
+				}
+				return nil
+			})
+		case 17:
+			return f.string(&m.DomainTag)
+		case 18:
+			return f.string(&m.ProviderChainID)
+		case 19:
+			return f.string(&m.ConsumerID)
+		case 20:
+			var mode string
+			if err := f.string(&mode); err != nil {
+				return err
+			}
+			m.Mode = BuildMode(mode)
+		}
+		return nil // unknown field
+	})
+}
+
+func decodeBuildBlockResponse(data []byte, m *BuildBlockResponse) error {
+	return decodeProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			// Txs alias the message, rather than being copied out of
+			// it, to halve the memory used by very large blocks.
+			m.Txs = append(m.Txs, f.b[:len(f.b):len(f.b)])
+			return f.expect(protoBytes)
+		case 2:
+			return f.string(&m.ValidatorPayment)
+		case 3:
+			return f.bytes(&m.Signature)
+		case 4:
+			return f.string(&m.AuctionID)
+		case 5:
+			r := &PaymentReceipt{}
+			m.Receipt = r
+			return decodeMessage(f, func(f protoField) error {
+				switch f.num {
+				case 1:
+					return f.string(&r.ChainID)
+				case 2:
+					return f.int64(&r.Height)
+				case 3:
+					return f.string(&r.ValidatorAddress)
+				case 4:
+					return f.string(&r.Amount)
+				case 5:
+					return f.string(&r.Denom)
+				case 6:
+					return f.string(&r.PaymentTxHash)
+				case 7:
+					return f.bytes(&r.Signature)
+				}
+				return nil
+			})
+		}
+		return nil // unknown field
+	})
+}
+
+func decodeMessage(f protoField, fn func(protoField) error) error {
+	if err := f.expect(protoBytes); err != nil {
+		return err
+	}
+	return decodeProto(f.b, fn)
+}
@@ -0,0 +1,158 @@
+package mekabuild
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+)
+
+// Priority orders requests waiting for a slot in a RequestQueue. Higher
+// priorities are served first.
+type Priority int
+
+// Request priorities used by the builder.
+const (
+	// PriorityBackground is the default priority, used for e.g. status
+	// polls and analytics.
+	PriorityBackground Priority = 0
+
+	// PriorityProposal is used for build requests, which block a proposal.
+	PriorityProposal Priority = 100
+)
+
+// WithPriority returns a context which sets the priority of builder requests
+// made with it, overriding the default for the request type.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+func priorityFrom(ctx context.Context, def Priority) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return def
+}
+
+type priorityKey struct{}
+
+// RequestQueue limits the number of concurrent requests to the builder API,
+// and serves waiting requests in priority order, so that an imminent proposal
+// isn't stuck behind background traffic. A single queue is typically shared
+// by every builder using the same transport, e.g. across chains.
+type RequestQueue struct {
+	mtx     sync.Mutex
+	limit   int
+	active  int
+	seq     uint64
+	waiters waiterHeap
+}
+
+// NewRequestQueue returns a queue allowing at most maxConcurrent requests in
+// flight at once.
+func NewRequestQueue(maxConcurrent int) (*RequestQueue, error) {
+	if maxConcurrent < 1 {
+		return nil, errors.New("max concurrent requests must be at least 1")
+	}
+	return &RequestQueue{limit: maxConcurrent}, nil
+}
+
+// SetRequestQueue makes the builder acquire a slot from q before each request
+// to the builder API. By default, requests aren't limited.
+func (b *Builder) SetRequestQueue(q *RequestQueue) {
+	b.queue.Store(queueBox{q})
+}
+
+func (b *Builder) getRequestQueue() *RequestQueue {
+	box, _ := b.queue.Load().(queueBox)
+	return box.RequestQueue
+}
+
+type queueBox struct{ *RequestQueue }
+
+// acquire blocks until a slot is available for a request with priority p, or
+// the context is done. On success, the returned function must be called to
+// release the slot.
+func (q *RequestQueue) acquire(ctx context.Context, p Priority) (func(), error) {
+	q.mtx.Lock()
+	if q.active < q.limit && len(q.waiters) == 0 {
+		q.active++
+		q.mtx.Unlock()
+		return q.release, nil
+	}
+
+	q.seq++
+	w := &waiter{priority: p, seq: q.seq, ready: make(chan struct{})}
+	heap.Push(&q.waiters, w)
+	q.mtx.Unlock()
+
+	select {
+	case <-w.ready:
+		return q.release, nil
+
+	case <-ctx.Done():
+		q.mtx.Lock()
+		defer q.mtx.Unlock()
+		select {
+		case <-w.ready: // granted concurrently, pass it on
+			q.active--
+			q.grant()
+		default:
+			heap.Remove(&q.waiters, w.index)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (q *RequestQueue) release() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.active--
+	q.grant()
+}
+
+// grant hands free slots to the highest priority waiters. q.mtx must be held.
+func (q *RequestQueue) grant() {
+	for q.active < q.limit && len(q.waiters) > 0 {
+		w := heap.Pop(&q.waiters).(*waiter)
+		q.active++
+		close(w.ready)
+	}
+}
+
+type waiter struct {
+	priority Priority
+	seq      uint64
+	index    int
+	ready    chan struct{}
+}
+
+type waiterHeap []*waiter
+
+func (h waiterHeap) Len() int { return len(h) }
+
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq // FIFO within a priority
+}
+
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waiterHeap) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *waiterHeap) Pop() interface{} {
+	old := *h
+	w := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return w
+}
@@ -0,0 +1,67 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestRequestQueuePriority(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		chainID = "test-chain-id"
+		key     = newMockKey(t, "foo", rand.Reader)
+		unblock = make(chan struct{})
+		mtx     sync.Mutex
+		order   []int64
+		server  = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req mekabuild.BuildBlockRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			mtx.Lock()
+			order = append(order, req.Height)
+			mtx.Unlock()
+			if req.Height == 1 {
+				<-unblock
+			}
+			json.NewEncoder(w).Encode(mekabuild.BuildBlockResponse{})
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		wg        sync.WaitGroup
+	)
+
+	queue, err := mekabuild.NewRequestQueue(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.SetRequestQueue(queue)
+
+	build := func(height int64, p mekabuild.Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := mekabuild.WithPriority(ctx, p)
+			if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height}); err != nil {
+				t.Errorf("height %d: %v", height, err)
+			}
+		}()
+		time.Sleep(50 * time.Millisecond) // let it reach the server or the queue
+	}
+
+	build(1, mekabuild.PriorityBackground) // occupies the only slot
+	build(2, mekabuild.PriorityBackground)
+	build(3, mekabuild.PriorityProposal)
+	close(unblock)
+	wg.Wait()
+
+	if want, have := []int64{1, 3, 2}, order; len(want) != len(have) || want[1] != have[1] || want[2] != have[2] {
+		t.Fatalf("order: want %v, have %v", want, have)
+	}
+}
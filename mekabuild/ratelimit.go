@@ -0,0 +1,132 @@
+package mekabuild
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a request to the builder API is throttled by
+// the client-side rate limiter. Throttled requests aren't retried.
+var ErrRateLimited = errors.New("client rate limit exceeded")
+
+// RateLimiter is a token bucket limiting the rate of requests to the builder
+// API, so a misconfigured integration, e.g. one calling BuildBlock in a tight
+// retry loop, can't hammer the API and get the validator's IP banned. Every
+// request, including each retry and failover attempt, takes a token, and
+// requests are throttled, rather than delayed, when the bucket is empty. A
+// single limiter is typically shared by every builder on the same host, e.g.
+// across chains.
+type RateLimiter struct {
+	mtx    sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rate requests per second on
+// average, and bursts of up to burst requests. The bucket starts full.
+func NewRateLimiter(rate float64, burst int) (*RateLimiter, error) {
+	if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return nil, fmt.Errorf("invalid rate %v", rate)
+	}
+	if burst < 1 {
+		return nil, errors.New("burst must be at least 1")
+	}
+	return &RateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst)}, nil
+}
+
+// Allow takes a token, and returns true, if one is available now. Otherwise
+// it returns false, and how long until a token is available. It lets other
+// packages, e.g. signerd, limit their own operations with a RateLimiter.
+func (l *RateLimiter) Allow() (bool, time.Duration) {
+	return l.allow(time.Now())
+}
+
+// allow takes a token, and returns true, if one is available at time now.
+// Otherwise it returns false, and how long until a token is available.
+func (l *RateLimiter) allow(now time.Time) (bool, time.Duration) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	if now.After(l.last) {
+		l.last = now
+	}
+
+	if l.tokens < 1 {
+		return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	}
+	l.tokens--
+	return true, 0
+}
+
+// SetRateLimiter makes the builder take a token from l before each request to
+// the builder API. A nil limiter, the default, means requests aren't rate
+// limited.
+func (b *Builder) SetRateLimiter(l *RateLimiter) {
+	b.rateLimiter.Store(rateLimiterBox{l})
+}
+
+// WithRateLimit limits the rate of requests to the builder API with a new
+// limiter, see NewRateLimiter and SetRateLimiter. To share a limiter between
+// builders, use SetRateLimiter.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(b *Builder) error {
+		l, err := NewRateLimiter(rate, burst)
+		if err != nil {
+			return err
+		}
+		b.SetRateLimiter(l)
+		return nil
+	}
+}
+
+func (b *Builder) getRateLimiter() *RateLimiter {
+	box, _ := b.rateLimiter.Load().(rateLimiterBox)
+	return box.RateLimiter
+}
+
+type rateLimiterBox struct{ *RateLimiter }
+
+// ThrottleMetrics is optionally implemented by Metrics, to observe requests
+// throttled by the rate limiter.
+type ThrottleMetrics interface {
+	ObserveThrottle(ThrottleEvent)
+}
+
+// ThrottleEvent describes a request throttled by the rate limiter.
+type ThrottleEvent struct {
+	ChainID string
+	Path    string
+
+	// RetryAfter is how long until the limiter would allow a request.
+	RetryAfter time.Duration
+}
+
+// rateLimit returns an error wrapping ErrRateLimited if the request to path
+// is throttled.
+func (b *Builder) rateLimit(path string) error {
+	l := b.getRateLimiter()
+	if l == nil {
+		return nil
+	}
+
+	ok, retryAfter := l.allow(b.now())
+	if ok {
+		return nil
+	}
+
+	if tm, ok := b.getMetrics().(ThrottleMetrics); ok {
+		tm.ObserveThrottle(ThrottleEvent{ChainID: b.chainID, Path: path, RetryAfter: retryAfter})
+	}
+	return fmt.Errorf("%w: retry after %s", ErrRateLimited, retryAfter)
+}
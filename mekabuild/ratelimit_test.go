@@ -0,0 +1,96 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		key       = newMockKey(t, "validator", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		clock     = newFakeClock(time.Now())
+		metrics   = &mockMetrics{}
+		newReq    = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithClock(clock),
+		mekabuild.WithRetry(mekabuild.RetryPolicy{MaxAttempts: 3, BaseBackoff: 100 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}),
+		mekabuild.WithRateLimit(2, 2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.SetMetrics(metrics)
+
+	for i := 0; i < 2; i++ {
+		if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+			t.Fatalf("build %d: %v", i, err)
+		}
+	}
+	if _, err := builder.BuildBlock(ctx, newReq()); !errors.Is(err, mekabuild.ErrRateLimited) {
+		t.Fatalf("burst exhausted: want %v, have %v", mekabuild.ErrRateLimited, err)
+	}
+	if want, have := 2, len(api.Builds()); want != have {
+		t.Errorf("builds: want %d, have %d", want, have)
+	}
+
+	metrics.mtx.Lock()
+	throttles := append([]mekabuild.ThrottleEvent(nil), metrics.throttles...)
+	metrics.mtx.Unlock()
+	if want, have := 1, len(throttles); want != have {
+		t.Fatalf("throttles: want %d, have %d", want, have)
+	}
+	if want, have := "/v0/build", throttles[0].Path; want != have {
+		t.Errorf("throttle path: want %q, have %q", want, have)
+	}
+	if want, have := 500*time.Millisecond, throttles[0].RetryAfter; want != have {
+		t.Errorf("throttle retry after: want %s, have %s", want, have)
+	}
+
+	<-clock.After(500 * time.Millisecond)
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Fatalf("after refill: %v", err)
+	}
+
+	// Retries take tokens too, so a failing API isn't hammered either.
+	<-clock.After(time.Second)
+	api.FailNext(3, http.StatusServiceUnavailable)
+	if _, err := builder.BuildBlock(ctx, newReq()); !errors.Is(err, mekabuild.ErrRateLimited) {
+		t.Errorf("retries: want %v, have %v", mekabuild.ErrRateLimited, err)
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		rate  float64
+		burst int
+	}{
+		{0, 1},
+		{-1, 1},
+		{1, 0},
+	} {
+		if _, err := mekabuild.NewRateLimiter(tc.rate, tc.burst); err == nil {
+			t.Errorf("rate %v burst %d: want error, have none", tc.rate, tc.burst)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package mekabuild
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrReadOnly is returned by operations that would use the signer of a
+// read-only builder, see SetReadOnly.
+var ErrReadOnly = errors.New("builder is read-only")
+
+// SetReadOnly restricts the builder to status and analytics calls, e.g.
+// Health, RegistrationStatus, AuctionStats and AuctionStatus. Operations that
+// would use the signer, i.e. building blocks, presigning, and registration,
+// fail with ErrReadOnly, even if a signer is configured. It's intended for
+// dashboards and monitoring agents that must never trigger key usage.
+//
+// A read-only builder may be constructed with a nil signer.
+func (b *Builder) SetReadOnly(readOnly bool) {
+	if readOnly {
+		atomic.StoreInt32(&b.readOnly, 1)
+	} else {
+		atomic.StoreInt32(&b.readOnly, 0)
+	}
+}
+
+// WithReadOnly restricts the builder to status and analytics calls. See
+// SetReadOnly.
+func WithReadOnly() Option {
+	return func(b *Builder) error {
+		b.SetReadOnly(true)
+		return nil
+	}
+}
+
+// ReadOnly returns true if the builder is read-only.
+func (b *Builder) ReadOnly() bool {
+	return atomic.LoadInt32(&b.readOnly) != 0
+}
+
+// checkWritable returns ErrReadOnly, naming the refused operation, if the
+// builder is read-only.
+func (b *Builder) checkWritable(op string) error {
+	if b.ReadOnly() {
+		return fmt.Errorf("%s: %w", op, ErrReadOnly)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package mekabuild_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderReadOnly(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx     = context.Background()
+		chainID = "chain-id"
+		key     = newMockKey(t, "validator", nil)
+		api     = newMockAPI()
+		paths   = make(chan string, 10)
+		server  = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths <- r.URL.Path
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(nil, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithReadOnly(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.SetFallback(mekabuild.NewMempoolFallback(nil))
+
+	if _, err := builder.RegistrationStatus(ctx); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if want, have := "/v0/status", <-paths; want != have {
+		t.Errorf("path: want %q, have %q", want, have)
+	}
+
+	for name, fn := range map[string]func() error{
+		"build block": func() error {
+			_, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr})
+			return err
+		},
+		"presign": func() error {
+			return builder.Presign(1, 1000, -1)
+		},
+		"apply": func() error {
+			_, err := builder.Apply(ctx, "payment-address")
+			return err
+		},
+		"register": func() error {
+			_, err := builder.Register(ctx, "payment-address", []byte("challenge"), nil)
+			return err
+		},
+		"update registration": func() error {
+			_, err := builder.UpdateRegistration(ctx, "payment-address")
+			return err
+		},
+	} {
+		if err := fn(); !errors.Is(err, mekabuild.ErrReadOnly) {
+			t.Errorf("%s: want %v, have %v", name, mekabuild.ErrReadOnly, err)
+		}
+	}
+
+	if want, have := 0, len(paths); want != have {
+		t.Errorf("requests by refused operations: want %d, have %d", want, have)
+	}
+
+	builder.SetReadOnly(false)
+	if builder.ReadOnly() {
+		t.Errorf("builder still read-only")
+	}
+}
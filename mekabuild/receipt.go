@@ -0,0 +1,150 @@
+package mekabuild
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// PaymentReceipt is the builder API's signed record of the payment to the
+// proposer of a block, so validators can keep auditable records of their
+// earnings, see Ledger. The payment is a single coin, paid by the tx with
+// PaymentTxHash, which is included in the block.
+type PaymentReceipt struct {
+	ChainID          string `json:"chain_id"`
+	Height           int64  `json:"height"`
+	ValidatorAddress string `json:"validator_address"`
+
+	// Amount is a non-negative integer, in decimal, of Denom.
+	Amount string `json:"amount"`
+	Denom  string `json:"denom"`
+
+	// PaymentTxHash is the hash of the payment tx, in uppercase hex, as in
+	// block explorers.
+	PaymentTxHash string `json:"payment_tx_hash"`
+
+	// Signature is the builder API's signature over
+	// PaymentReceiptSignBytes.
+	Signature []byte `json:"signature"`
+}
+
+// ErrBadReceipt is returned when a payment receipt doesn't match its build
+// response, or isn't signed by the builder API's pinned public key.
+var ErrBadReceipt = errors.New("bad payment receipt")
+
+// PaymentReceiptSignBytes returns the bytes signed by the builder API to issue
+// a payment receipt for the given parameters.
+func PaymentReceiptSignBytes(chainID string, height int64, validatorAddr, amount, denom, paymentTxHash string) []byte {
+	// XXX: As with BuildBlockResponseSignBytes, changing the order or the set
+	// of fields requires updating both the builder API and every verifier.
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`payment-receipt`))
+	mustEncode(&sb, uint64(len([]byte(chainID))))
+	mustEncode(&sb, []byte(chainID))
+	mustEncode(&sb, height)
+	mustEncode(&sb, uint64(len([]byte(validatorAddr))))
+	mustEncode(&sb, []byte(validatorAddr))
+	mustEncode(&sb, uint64(len([]byte(amount))))
+	mustEncode(&sb, []byte(amount))
+	mustEncode(&sb, uint64(len([]byte(denom))))
+	mustEncode(&sb, []byte(denom))
+	mustEncode(&sb, uint64(len([]byte(paymentTxHash))))
+	mustEncode(&sb, []byte(paymentTxHash))
+	return sb.Bytes()
+}
+
+// SignBytes returns the bytes signed by the builder API for the receipt.
+func (r *PaymentReceipt) SignBytes() []byte {
+	return PaymentReceiptSignBytes(r.ChainID, r.Height, r.ValidatorAddress, r.Amount, r.Denom, r.PaymentTxHash)
+}
+
+// Coin returns the payment of the receipt.
+func (r *PaymentReceipt) Coin() (Coin, error) {
+	amount, ok := new(big.Int).SetString(r.Amount, 10)
+	if !ok || amount.Sign() < 0 {
+		return Coin{}, fmt.Errorf("%w: invalid amount %q", ErrInvalidCoins, r.Amount)
+	}
+	if !denomRegexp.MatchString(r.Denom) {
+		return Coin{}, fmt.Errorf("%w: invalid denom %q", ErrInvalidCoins, r.Denom)
+	}
+	return Coin{Denom: r.Denom, Amount: amount}, nil
+}
+
+// Verify checks the signature of the receipt against the public key of the
+// builder API. It returns an error wrapping ErrBadReceipt if the receipt is
+// unsigned, or the signature doesn't verify.
+func (r *PaymentReceipt) Verify(publicKey ed25519.PublicKey) error {
+	if len(r.Signature) == 0 {
+		return fmt.Errorf("%w: receipt is unsigned", ErrBadReceipt)
+	}
+	if !ed25519.Verify(publicKey, r.SignBytes(), r.Signature) {
+		return fmt.Errorf("%w: bad signature", ErrBadReceipt)
+	}
+	return nil
+}
+
+// IssuePaymentReceipt sets the payment receipt of resp, for the payment tx
+// with the given hash, signed with the builder API's key. The validator
+// payment of resp must be a single coin. It's intended for use by builder API
+// implementations.
+func IssuePaymentReceipt(req *BuildBlockRequest, resp *BuildBlockResponse, paymentTxHash string, privateKey ed25519.PrivateKey) error {
+	payment, err := resp.Payment()
+	if err != nil {
+		return err
+	}
+	if len(payment) != 1 {
+		return fmt.Errorf("receipts need a payment of a single coin, have %q", resp.ValidatorPayment)
+	}
+
+	r := &PaymentReceipt{
+		ChainID:          req.ChainID,
+		Height:           req.Height,
+		ValidatorAddress: req.ValidatorAddress,
+		Amount:           payment[0].Amount.String(),
+		Denom:            payment[0].Denom,
+		PaymentTxHash:    paymentTxHash,
+	}
+	r.Signature = ed25519.Sign(privateKey, r.SignBytes())
+	resp.Receipt = r
+	return nil
+}
+
+// VerifyPaymentReceipt checks that the payment receipt of resp matches req,
+// and the validator payment of resp, and verifies it against the builder API's
+// public key. A nil public key skips the signature check. Responses without a
+// receipt are valid. Errors wrap ErrBadReceipt.
+func VerifyPaymentReceipt(req *BuildBlockRequest, resp *BuildBlockResponse, publicKey ed25519.PublicKey) error {
+	r := resp.Receipt
+	if r == nil {
+		return nil
+	}
+
+	switch {
+	case r.ChainID != req.ChainID:
+		return fmt.Errorf("%w: chain ID %q, want %q", ErrBadReceipt, r.ChainID, req.ChainID)
+	case r.Height != req.Height:
+		return fmt.Errorf("%w: height %d, want %d", ErrBadReceipt, r.Height, req.Height)
+	case r.ValidatorAddress != req.ValidatorAddress:
+		return fmt.Errorf("%w: validator address %q, want %q", ErrBadReceipt, r.ValidatorAddress, req.ValidatorAddress)
+	}
+
+	coin, err := r.Coin()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadReceipt, err)
+	}
+	payment, err := resp.Payment()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadReceipt, err)
+	}
+	if paid := payment.AmountOf(coin.Denom); paid.Cmp(coin.Amount) != 0 {
+		return fmt.Errorf("%w: receipt for %s, payment %q", ErrBadReceipt, coin, resp.ValidatorPayment)
+	}
+
+	if len(publicKey) == 0 {
+		return nil
+	}
+	return r.Verify(publicKey)
+}
@@ -0,0 +1,128 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestVerifyPaymentReceipt(t *testing.T) {
+	t.Parallel()
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		req  = &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 42, ValidatorAddress: "validator"}
+		resp = func() *mekabuild.BuildBlockResponse {
+			resp := &mekabuild.BuildBlockResponse{ValidatorPayment: "1000uatom"}
+			if err := mekabuild.IssuePaymentReceipt(req, resp, "ABCD", private); err != nil {
+				t.Fatal(err)
+			}
+			return resp
+		}
+	)
+
+	if err := mekabuild.VerifyPaymentReceipt(req, resp(), public); err != nil {
+		t.Errorf("valid receipt: %v", err)
+	}
+	if err := mekabuild.VerifyPaymentReceipt(req, &mekabuild.BuildBlockResponse{}, public); err != nil {
+		t.Errorf("no receipt: %v", err)
+	}
+	if err := mekabuild.IssuePaymentReceipt(req, &mekabuild.BuildBlockResponse{ValidatorPayment: "1uatom,1uosmo"}, "ABCD", private); err == nil {
+		t.Errorf("receipt for several coins: want error, have none")
+	}
+
+	for name, tc := range map[string]struct {
+		modify    func(*mekabuild.BuildBlockResponse)
+		publicKey ed25519.PublicKey
+	}{
+		"wrong key":      {func(*mekabuild.BuildBlockResponse) {}, otherPublic},
+		"wrong height":   {func(r *mekabuild.BuildBlockResponse) { r.Receipt.Height++ }, nil},
+		"wrong payment":  {func(r *mekabuild.BuildBlockResponse) { r.ValidatorPayment = "999uatom" }, nil},
+		"tampered hash":  {func(r *mekabuild.BuildBlockResponse) { r.Receipt.PaymentTxHash = "EF01" }, public},
+		"unsigned":       {func(r *mekabuild.BuildBlockResponse) { r.Receipt.Signature = nil }, public},
+		"invalid amount": {func(r *mekabuild.BuildBlockResponse) { r.Receipt.Amount = "-1" }, nil},
+	} {
+		r := resp()
+		tc.modify(r)
+		if err := mekabuild.VerifyPaymentReceipt(req, r, tc.publicKey); !errors.Is(err, mekabuild.ErrBadReceipt) {
+			t.Errorf("%s: want %v, have %v", name, mekabuild.ErrBadReceipt, err)
+		}
+	}
+}
+
+func TestBuilderPaymentReceipts(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		store     = mekabuild.NewMemoryStore()
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	api.SetPayment(func(req *mekabuild.BuildBlockRequest) string { return "100uatom" })
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.SetBuilderKey(private)
+	api.SetReceipts(true)
+
+	ledger, err := mekabuild.NewLedger(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithEndpoints(apiURL), mekabuild.WithBuilderPublicKey(public), mekabuild.WithLedger(ledger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for height := int64(1); height <= 3; height++ {
+		resp, err := b.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Receipt == nil || resp.Receipt.Height != height {
+			t.Fatalf("height %d: want receipt, have %+v", height, resp.Receipt)
+		}
+	}
+
+	receipts, err := ledger.Receipts(chainID, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 2, len(receipts); want != have {
+		t.Fatalf("receipts: want %d, have %d", want, have)
+	}
+	for _, r := range receipts {
+		if err := r.Verify(public); err != nil {
+			t.Errorf("height %d: %v", r.Height, err)
+		}
+	}
+
+	if err := b.SetBuilderPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 4, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1}); err == nil {
+		t.Errorf("wrong builder key: want error, have none")
+	}
+	if _, err := ledger.Receipt(chainID, 4); !errors.Is(err, mekabuild.ErrNotFound) {
+		t.Errorf("rejected build: want %v, have %v", mekabuild.ErrNotFound, err)
+	}
+}
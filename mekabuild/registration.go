@@ -0,0 +1,393 @@
+package mekabuild
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ApplyRequest is sent by a validator to the apply endpoint of the builder API
+// to begin registration. The API responds with a challenge, which must be
+// signed by the validator key and submitted via a RegisterRequest. The API
+// binds the challenge to the domain tag, if any, so the signed challenge
+// registers the tag along with the validator. Likewise, it binds the
+// challenge to the consumer chain, if any, whose challenge is signed by the
+// provider chain validator, see SetConsumerChain.
+type ApplyRequest struct {
+	ChainID          string `json:"chain_id"`
+	ValidatorAddress string `json:"validator_address"`
+	PaymentAddress   string `json:"payment_address"`
+	DomainTag        string `json:"domain_tag,omitempty"`
+	ProviderChainID  string `json:"provider_chain_id,omitempty"`
+	ConsumerID       string `json:"consumer_id,omitempty"`
+	ProviderAddress  string `json:"provider_address,omitempty"`
+
+	// Update requests a challenge for UpdateRegistration, rather than for
+	// registration. The builder API binds the challenge to the update, and
+	// only issues update challenges to registered validators.
+	Update bool `json:"update,omitempty"`
+}
+
+// ApplyResponse is returned by the apply endpoint of the builder API.
+type ApplyResponse struct {
+	Challenge []byte `json:"challenge"`
+}
+
+// RegisterRequest completes registration, by proving control of the validator
+// key with a signature over the challenge. See ChallengeSignBytes.
+type RegisterRequest struct {
+	ChainID          string         `json:"chain_id"`
+	ValidatorAddress string         `json:"validator_address"`
+	PaymentAddress   string         `json:"payment_address"`
+	DomainTag        string         `json:"domain_tag,omitempty"`
+	ProviderChainID  string         `json:"provider_chain_id,omitempty"`
+	ConsumerID       string         `json:"consumer_id,omitempty"`
+	ProviderAddress  string         `json:"provider_address,omitempty"`
+	Challenge        []byte         `json:"challenge"`
+	Signature        []byte         `json:"signature"`
+	OperatorProof    *OperatorProof `json:"operator_proof,omitempty"`
+}
+
+// RegisterResponse is returned by the register endpoint of the builder API.
+type RegisterResponse struct {
+	Result string `json:"result"`
+}
+
+// UpdateRegistrationRequest changes the payment address of a registered
+// validator, by proving control of the validator key with a signature over an
+// update challenge, see ApplyRequest.Update and ChallengeSignBytes. The domain
+// tag and consumer chain of the registration can't be changed.
+type UpdateRegistrationRequest struct {
+	ChainID          string `json:"chain_id"`
+	ValidatorAddress string `json:"validator_address"`
+	PaymentAddress   string `json:"payment_address"`
+	DomainTag        string `json:"domain_tag,omitempty"`
+	ProviderChainID  string `json:"provider_chain_id,omitempty"`
+	ConsumerID       string `json:"consumer_id,omitempty"`
+	ProviderAddress  string `json:"provider_address,omitempty"`
+	Challenge        []byte `json:"challenge"`
+	Signature        []byte `json:"signature"`
+}
+
+// Apply begins registration of the builder's validator, with the given payment
+// address, and returns the challenge issued by the builder API.
+func (b *Builder) Apply(ctx context.Context, paymentAddress string) (*ApplyResponse, error) {
+	ctx, span := b.startSpan(ctx, SpanApply, Attribute{AttributeChainID, b.chainID})
+	resp, err := b.apply(ctx, paymentAddress, false)
+	endSpan(span, err)
+	return resp, err
+}
+
+func (b *Builder) apply(ctx context.Context, paymentAddress string, update bool) (*ApplyResponse, error) {
+	if b.addrErr != nil {
+		return nil, b.addrErr
+	}
+
+	if err := b.checkWritable("apply"); err != nil {
+		return nil, err
+	}
+
+	domainTag := b.getDomainTag()
+	if err := b.checkDomainTag(domainTag); err != nil {
+		return nil, err
+	}
+	if err := b.checkConsumerChain(); err != nil {
+		return nil, err
+	}
+	consumer, _ := b.ConsumerChain()
+
+	req := &ApplyRequest{
+		ChainID:          b.chainID,
+		ValidatorAddress: b.validatorAddr,
+		PaymentAddress:   paymentAddress,
+		DomainTag:        domainTag,
+		ProviderChainID:  consumer.ProviderChainID,
+		ConsumerID:       consumer.ConsumerID,
+		ProviderAddress:  consumer.ProviderAddress,
+		Update:           update,
+	}
+
+	begin := b.now()
+	var resp ApplyResponse
+	if _, err := b.do(ctx, "/v0/apply", req, &resp, nil); err != nil {
+		b.getLogger().Errorf("apply failed: chain_id=%s took=%s err=%v", b.chainID, b.since(begin), err)
+		return nil, err
+	}
+
+	b.getLogger().Infof("apply succeeded: chain_id=%s took=%s", b.chainID, b.since(begin))
+	return &resp, nil
+}
+
+// Register completes registration of the builder's validator, by signing the
+// challenge returned by Apply. The builder's signer must implement
+// ChallengeSigner. The operator proof is optional.
+func (b *Builder) Register(ctx context.Context, paymentAddress string, challenge []byte, proof *OperatorProof) (*RegisterResponse, error) {
+	ctx, span := b.startSpan(ctx, SpanRegister, Attribute{AttributeChainID, b.chainID})
+	resp, err := b.register(ctx, paymentAddress, challenge, proof)
+	endSpan(span, err)
+	return resp, err
+}
+
+func (b *Builder) register(ctx context.Context, paymentAddress string, challenge []byte, proof *OperatorProof) (*RegisterResponse, error) {
+	if b.addrErr != nil {
+		return nil, b.addrErr
+	}
+
+	if err := b.checkWritable("register"); err != nil {
+		return nil, err
+	}
+
+	cs, ok := b.signer.(ChallengeSigner)
+	if !ok {
+		return nil, errors.New("signer can't sign challenges")
+	}
+
+	if proof != nil {
+		if err := proof.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid operator proof: %w", err)
+		}
+	}
+
+	sig, err := b.signChallenge(cs, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("sign challenge: %w", err)
+	}
+
+	consumer, _ := b.ConsumerChain()
+	req := &RegisterRequest{
+		ChainID:          b.chainID,
+		ValidatorAddress: b.validatorAddr,
+		PaymentAddress:   paymentAddress,
+		DomainTag:        b.getDomainTag(),
+		ProviderChainID:  consumer.ProviderChainID,
+		ConsumerID:       consumer.ConsumerID,
+		ProviderAddress:  consumer.ProviderAddress,
+		Challenge:        challenge,
+		Signature:        sig,
+		OperatorProof:    proof,
+	}
+
+	begin := b.now()
+	var resp RegisterResponse
+	if _, err := b.do(ctx, "/v0/register", req, &resp, nil); err != nil {
+		b.getLogger().Errorf("register failed: chain_id=%s took=%s err=%v", b.chainID, b.since(begin), err)
+		return nil, err
+	}
+
+	b.registration.Store(RegistrationRegistered)
+	b.getLogger().Infof("register succeeded: chain_id=%s took=%s result=%q", b.chainID, b.since(begin), resp.Result)
+	return &resp, nil
+}
+
+// UpdateRegistration changes the payment address of the builder's validator,
+// which must be registered, e.g. to rotate a compromised address. Like
+// registration, it takes a challenge from the builder API, signed by the
+// validator key, so the builder's signer must implement ChallengeSigner. If
+// automatic registration is enabled, it's updated to the new address, see
+// SetAutoRegister.
+func (b *Builder) UpdateRegistration(ctx context.Context, paymentAddress string) (*RegisterResponse, error) {
+	ctx, span := b.startSpan(ctx, SpanUpdateRegistration, Attribute{AttributeChainID, b.chainID})
+	resp, err := b.updateRegistration(ctx, paymentAddress)
+	endSpan(span, err)
+	return resp, err
+}
+
+// updateRegistrationEndpoint is unsigned as an Endpoint: the request carries
+// the validator's signature over an apply challenge, made before it's sent.
+var updateRegistrationEndpoint = Endpoint{Path: "/v0/update_registration"}
+
+func (b *Builder) updateRegistration(ctx context.Context, paymentAddress string) (*RegisterResponse, error) {
+	if b.addrErr != nil {
+		return nil, b.addrErr
+	}
+
+	if err := b.checkWritable("update registration"); err != nil {
+		return nil, err
+	}
+
+	if paymentAddress == "" {
+		return nil, errors.New("payment address is required")
+	}
+
+	cs, ok := b.signer.(ChallengeSigner)
+	if !ok {
+		return nil, errors.New("signer can't sign challenges")
+	}
+
+	// Serialize with automatic registration, so it can't register the
+	// previous address concurrently.
+	b.registerMtx.Lock()
+	defer b.registerMtx.Unlock()
+
+	apply, err := b.apply(ctx, paymentAddress, true)
+	if err != nil {
+		return nil, fmt.Errorf("apply: %w", err)
+	}
+
+	sig, err := b.signChallenge(cs, apply.Challenge)
+	if err != nil {
+		return nil, fmt.Errorf("sign challenge: %w", err)
+	}
+
+	consumer, _ := b.ConsumerChain()
+	req := &UpdateRegistrationRequest{
+		ChainID:          b.chainID,
+		ValidatorAddress: b.validatorAddr,
+		PaymentAddress:   paymentAddress,
+		DomainTag:        b.getDomainTag(),
+		ProviderChainID:  consumer.ProviderChainID,
+		ConsumerID:       consumer.ConsumerID,
+		ProviderAddress:  consumer.ProviderAddress,
+		Challenge:        apply.Challenge,
+		Signature:        sig,
+	}
+
+	begin := b.now()
+	var resp RegisterResponse
+	if err := b.Call(ctx, updateRegistrationEndpoint, req, &resp); err != nil {
+		b.getLogger().Errorf("update registration failed: chain_id=%s took=%s err=%v", b.chainID, b.since(begin), err)
+		return nil, err
+	}
+
+	b.registration.Store(RegistrationRegistered)
+	if prev, _ := b.autoRegister.Load().(string); prev != "" {
+		b.autoRegister.Store(paymentAddress)
+	}
+	b.getLogger().Infof("update registration succeeded: chain_id=%s took=%s payment_address=%s result=%q", b.chainID, b.since(begin), paymentAddress, resp.Result)
+	return &resp, nil
+}
+
+// IsNotRegistered returns true if err is the builder API's rejection of a
+// request from a validator that isn't registered.
+func IsNotRegistered(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusForbidden && strings.Contains(se.Message, "not registered")
+}
+
+// SetAutoRegister enables automatic registration. When a build request is
+// rejected because the validator isn't registered, e.g. after the builder API
+// dropped its registration, the builder runs Apply and Register with the given
+// payment address, and retries the request once. That requires the builder's
+// signer to implement ChallengeSigner. An empty payment address disables auto
+// registration, which is the default.
+func (b *Builder) SetAutoRegister(paymentAddress string) {
+	b.autoRegister.Store(paymentAddress)
+}
+
+// WithAutoRegister enables automatic registration. See SetAutoRegister.
+func WithAutoRegister(paymentAddress string) Option {
+	return func(b *Builder) error {
+		b.SetAutoRegister(paymentAddress)
+		return nil
+	}
+}
+
+// reregister registers the validator with the given payment address. Concurrent
+// calls are serialized, and a call is skipped if another call registered the
+// validator while it was waiting.
+func (b *Builder) reregister(ctx context.Context, paymentAddress string) error {
+	b.registerMtx.Lock()
+	defer b.registerMtx.Unlock()
+
+	if status, _ := b.registration.Load().(string); status == RegistrationRegistered {
+		return nil
+	}
+
+	b.getLogger().Infof("registering automatically: chain_id=%s payment_address=%s", b.chainID, paymentAddress)
+
+	apply, err := b.Apply(ctx, paymentAddress)
+	if err != nil {
+		return fmt.Errorf("apply: %w", err)
+	}
+
+	if _, err := b.Register(ctx, paymentAddress, apply.Challenge, nil); err != nil {
+		return fmt.Errorf("register: %w", err)
+	}
+
+	return nil
+}
+
+// Registration statuses, as reported by Health.
+const (
+	RegistrationUnknown      = "unknown"
+	RegistrationRegistered   = "registered"
+	RegistrationUnregistered = "unregistered"
+)
+
+// OperatorProof optionally accompanies a registration, and proves that the
+// registrant controls the operator account of the validator. That lets the
+// builder API gate registration on real validators, and prevents squatting on
+// validator addresses.
+type OperatorProof struct {
+	// Kind is either OperatorProofSignature or OperatorProofQuery.
+	Kind string `json:"kind"`
+
+	// OperatorAddress is the Bech32 operator (valoper) address.
+	OperatorAddress string `json:"operator_address"`
+
+	// PubKeyType and PubKey identify the operator account key, and are
+	// only set for OperatorProofSignature. PubKeyType is e.g. "secp256k1".
+	PubKeyType string `json:"pub_key_type,omitempty"`
+	PubKey     []byte `json:"pub_key,omitempty"`
+
+	// Signature is the operator account key's signature over
+	// OperatorProofSignBytes, only set for OperatorProofSignature.
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Kinds of operator proof.
+const (
+	// OperatorProofSignature proves control of the operator account via a
+	// signature by its key.
+	OperatorProofSignature = "signature"
+
+	// OperatorProofQuery asks the builder API to verify, by querying the
+	// chain, that the operator address belongs to the validator.
+	OperatorProofQuery = "query"
+)
+
+// Validate checks that the proof is well-formed. It doesn't verify the
+// signature, which is done by the builder API.
+func (p *OperatorProof) Validate() error {
+	if p.OperatorAddress == "" {
+		return errors.New("operator address is required")
+	}
+
+	switch p.Kind {
+	case OperatorProofSignature:
+		if p.PubKeyType == "" || len(p.PubKey) == 0 || len(p.Signature) == 0 {
+			return errors.New("signature proof requires public key and signature")
+		}
+	case OperatorProofQuery:
+		if len(p.PubKey) != 0 || len(p.Signature) != 0 {
+			return errors.New("query proof must not carry a public key or signature")
+		}
+	default:
+		return errors.New("unknown operator proof kind")
+	}
+
+	return nil
+}
+
+// OperatorProofSignBytes returns a stable byte representation of an operator
+// proof, to be signed by the operator account key. The challenge is issued by
+// the builder API during registration, and prevents replay of old proofs.
+func OperatorProofSignBytes(chainID, validatorAddr, operatorAddr string, challenge []byte) []byte {
+	// SECURITY 🚨 As with BuildBlockRequestSignBytes, the constant prefix
+	// prevents the proof from being used to sign arbitrary bytes.
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`operator-proof`))
+	mustEncode(&sb, uint64(len([]byte(chainID))))
+	mustEncode(&sb, []byte(chainID))
+	mustEncode(&sb, uint64(len([]byte(validatorAddr))))
+	mustEncode(&sb, []byte(validatorAddr))
+	mustEncode(&sb, uint64(len([]byte(operatorAddr))))
+	mustEncode(&sb, []byte(operatorAddr))
+	mustEncode(&sb, uint64(len(challenge)))
+	mustEncode(&sb, challenge)
+	return sb.Bytes()
+}
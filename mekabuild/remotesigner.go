@@ -0,0 +1,476 @@
+package mekabuild
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RemoteSigner is a Signer which delegates signing to a remote signer, so the
+// node never holds the validator key. Like the node's own
+// priv_validator_laddr, it listens for the remote signer to connect, and then
+// speaks the Tendermint privval framing: length-prefixed protobuf messages,
+// over a unix socket, or a TCP connection secured by the caller, see
+// ListenRemoteSigner.
+//
+// RemoteSigner is experimental, and requires signer-side support that no
+// existing remote signer provides. The privval protocol can only sign
+// consensus votes and proposals, so builder payloads are sent in
+// SignBytesRequest and SignedBytesResponse messages, an extension of the
+// privval Message oneof defined by this package, at fields 100 and 101.
+// Remote signers that don't implement it, which today includes tmkms and
+// horcrux, close the connection or reply with an error, and RemoteSigner
+// returns an error wrapping ErrRemoteSignerUnsupported. The payloads are
+// domain-separated, see IsValidatorSignBytes, so that a signer implementing
+// the extension can tell them apart from consensus messages.
+//
+// Signatures are rate limited, see SigningLimits, and verified against the
+// remote signer's public key before they're returned. Requests are serialized
+// over a single connection, which is reestablished on the next request after
+// any I/O error.
+type RemoteSigner struct {
+	ln      net.Listener
+	upgrade func(net.Conn) (net.Conn, error)
+	chainID string
+	timeout time.Duration
+
+	mtx     sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	keyType string
+	pubKey  []byte
+	limits  *signingGuard
+}
+
+var (
+	_ Signer          = (*RemoteSigner)(nil)
+	_ ChallengeSigner = (*RemoteSigner)(nil)
+	_ PresignSigner   = (*RemoteSigner)(nil)
+	_ ConfirmSigner   = (*RemoteSigner)(nil)
+	_ PauseSigner     = (*RemoteSigner)(nil)
+)
+
+// Errors returned by RemoteSigner.
+var (
+	ErrRemoteSignerUnsupported = errors.New("remote signer doesn't support builder payloads")
+	ErrRemoteSigner            = errors.New("remote signer error")
+)
+
+// DefaultRemoteSignerTimeout bounds waiting for the remote signer to connect,
+// and each request to it.
+const DefaultRemoteSignerTimeout = 3 * time.Second
+
+// ListenRemoteSigner listens on addr, either unix:///path/to/socket or
+// tcp://host:port, for a remote signer signing for chainID. Connections over
+// TCP must be secured with upgrade, typically wrapping Tendermint's
+// p2p/conn.MakeSecretConnection with the node key, as this package doesn't
+// implement the secret connection handshake. Connections over unix sockets
+// are used as is, unless upgrade is set.
+func ListenRemoteSigner(addr, chainID string, upgrade func(net.Conn) (net.Conn, error)) (*RemoteSigner, error) {
+	network, address := "unix", addr
+	if i := strings.Index(addr, "://"); i >= 0 {
+		network, address = addr[:i], addr[i+3:]
+	}
+
+	switch {
+	case network != "unix" && network != "tcp":
+		return nil, fmt.Errorf("unsupported remote signer network %q", network)
+	case network == "tcp" && upgrade == nil:
+		return nil, errors.New("remote signer connections over TCP require a secret connection upgrade")
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("listen for remote signer: %w", err)
+	}
+
+	return NewRemoteSigner(ln, chainID, upgrade), nil
+}
+
+// NewRemoteSigner returns a remote signer accepting connections from ln. If
+// upgrade is non-nil, it's applied to each accepted connection.
+func NewRemoteSigner(ln net.Listener, chainID string, upgrade func(net.Conn) (net.Conn, error)) *RemoteSigner {
+	return &RemoteSigner{
+		ln:      ln,
+		upgrade: upgrade,
+		chainID: chainID,
+		timeout: DefaultRemoteSignerTimeout,
+		limits:  newSigningGuard(),
+	}
+}
+
+// SetTimeout sets the timeout for the remote signer to connect, and for each
+// request to it. The default is DefaultRemoteSignerTimeout.
+func (s *RemoteSigner) SetTimeout(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("timeout must be positive, have %s", d)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.timeout = d
+	return nil
+}
+
+// SetSigningLimits caps the rate of each kind of signature. The default is
+// DefaultSigningLimits.
+func (s *RemoteSigner) SetSigningLimits(l SigningLimits) error {
+	return s.limits.setLimits(l)
+}
+
+// Close closes the listener, and the connection to the remote signer, if any.
+func (s *RemoteSigner) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.disconnect()
+	return s.ln.Close()
+}
+
+// PublicKey returns the key type and public key of the remote signer, waiting
+// for it to connect if necessary.
+func (s *RemoteSigner) PublicKey() (keyType string, publicKey []byte, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := s.connect(); err != nil {
+		return "", nil, err
+	}
+	return s.keyType, append([]byte(nil), s.pubKey...), nil
+}
+
+// Ping checks that the remote signer is connected and responsive.
+func (s *RemoteSigner) Ping() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	_, err := s.roundTrip(privvalPingRequest, nil, privvalPingResponse)
+	return err
+}
+
+// SignBuildBlockRequest implements Signer. Requests without a KeyType are
+// assigned the remote signer's key type.
+func (s *RemoteSigner) SignBuildBlockRequest(req *BuildBlockRequest) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+	if req.KeyType == "" && s.keyType != KeyTypeEd25519 {
+		req.KeyType = s.keyType
+	}
+	if err := s.limits.allow(signBuildRequest); err != nil {
+		return err
+	}
+
+	msg, err := req.SignBytes()
+	if err != nil {
+		return err
+	}
+	sig, err := s.signBytes(msg)
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return nil
+}
+
+// SignChallenge implements ChallengeSigner.
+func (s *RemoteSigner) SignChallenge(challenge []byte) ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := s.limits.allow(signChallenge); err != nil {
+		return nil, err
+	}
+	return s.signBytes(ChallengeSignBytes(challenge))
+}
+
+// SignPresignRequest implements PresignSigner.
+func (s *RemoteSigner) SignPresignRequest(req *PresignRequest) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := s.limits.allow(signPresign); err != nil {
+		return err
+	}
+
+	sig, err := s.signBytes(req.SignBytes())
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return nil
+}
+
+// SignConfirmRequest implements ConfirmSigner.
+func (s *RemoteSigner) SignConfirmRequest(req *ConfirmRequest) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if req.KeyType == "" && s.keyType != KeyTypeEd25519 {
+		req.KeyType = s.keyType
+	}
+	if err := s.limits.allow(signConfirmation); err != nil {
+		return err
+	}
+
+	sig, err := s.signBytes(req.SignBytes())
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return nil
+}
+
+// SignPauseRequest implements PauseSigner.
+func (s *RemoteSigner) SignPauseRequest(req *PauseRequest) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if req.KeyType == "" && s.keyType != KeyTypeEd25519 {
+		req.KeyType = s.keyType
+	}
+	if err := s.limits.allow(signPause); err != nil {
+		return err
+	}
+
+	sig, err := s.signBytes(req.SignBytes())
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return nil
+}
+
+func (s *RemoteSigner) signBytes(msg []byte) ([]byte, error) {
+	resp, err := s.roundTrip(privvalSignBytesRequest, func(e *protoEncoder) {
+		e.string(1, s.chainID)
+		e.bytes(2, msg)
+	}, privvalSignedBytesResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig []byte
+	if err := decodeProto(resp, func(f protoField) error {
+		if f.num == 1 {
+			return f.bytes(&sig)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("decode signed bytes response: %w", err)
+	}
+
+	ok, err := VerifySignature(s.keyType, s.pubKey, msg, sig)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("verify remote signature: %w", err)
+	case !ok:
+		return nil, fmt.Errorf("verify remote signature: %w", ErrBadSignature)
+	}
+	return sig, nil
+}
+
+// connect waits for the remote signer to connect, if it isn't connected, and
+// fetches its public key.
+func (s *RemoteSigner) connect() error {
+	if s.conn != nil {
+		return nil
+	}
+
+	type deadliner interface{ SetDeadline(time.Time) error }
+	if d, ok := s.ln.(deadliner); ok {
+		d.SetDeadline(time.Now().Add(s.timeout))
+		defer d.SetDeadline(time.Time{})
+	}
+
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return fmt.Errorf("accept remote signer connection: %w", err)
+	}
+	if s.upgrade != nil {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+		upgraded, err := s.upgrade(conn)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("upgrade remote signer connection: %w", err)
+		}
+		conn = upgraded
+	}
+	s.conn, s.r = conn, bufio.NewReader(conn)
+
+	resp, err := s.roundTrip(privvalPubKeyRequest, func(e *protoEncoder) {
+		e.string(1, s.chainID)
+	}, privvalPubKeyResponse)
+	if err != nil {
+		s.disconnect()
+		return fmt.Errorf("get remote signer public key: %w", err)
+	}
+
+	var keyType string
+	var pubKey []byte
+	if err := decodeProto(resp, func(f protoField) error {
+		if f.num != 1 {
+			return nil
+		}
+		return decodeMessage(f, func(f protoField) error {
+			switch f.num {
+			case 1:
+				keyType = KeyTypeEd25519
+				return f.bytes(&pubKey)
+			case 2:
+				keyType = KeyTypeSecp256k1
+				return f.bytes(&pubKey)
+			}
+			return nil
+		})
+	}); err != nil {
+		s.disconnect()
+		return fmt.Errorf("decode remote signer public key: %w", err)
+	}
+	if keyType == "" {
+		s.disconnect()
+		return fmt.Errorf("%w: unsupported public key type", ErrRemoteSigner)
+	}
+
+	s.keyType, s.pubKey = keyType, pubKey
+	return nil
+}
+
+func (s *RemoteSigner) disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn, s.r = nil, nil
+	}
+}
+
+// roundTrip sends a privval message with the given field, connecting first
+// if necessary, and returns the body of the response, which must be of the
+// wanted field. Remote signer errors in the response are returned as errors.
+func (s *RemoteSigner) roundTrip(field int, encode func(*protoEncoder), want int) ([]byte, error) {
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	if encode == nil {
+		encode = func(*protoEncoder) {}
+	}
+	var msg protoEncoder
+	msg.message(field, encode)
+
+	var frame protoEncoder
+	frame.varint(uint64(len(msg.buf)))
+	frame.buf = append(frame.buf, msg.buf...)
+
+	s.conn.SetDeadline(time.Now().Add(s.timeout))
+	defer func() {
+		if s.conn != nil {
+			s.conn.SetDeadline(time.Time{})
+		}
+	}()
+
+	if _, err := s.conn.Write(frame.buf); err != nil {
+		s.disconnect()
+		return nil, fmt.Errorf("write to remote signer: %w", err)
+	}
+
+	resp, err := s.readMessage()
+	if err != nil {
+		s.disconnect()
+		if field == privvalSignBytesRequest && errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: connection closed", ErrRemoteSignerUnsupported)
+		}
+		return nil, fmt.Errorf("read from remote signer: %w", err)
+	}
+
+	var (
+		body  []byte
+		found bool
+	)
+	if err := decodeProto(resp, func(f protoField) error {
+		if f.num != want {
+			return nil
+		}
+		found = true
+		return f.bytes(&body)
+	}); err != nil {
+		s.disconnect()
+		return nil, fmt.Errorf("decode remote signer response: %w", err)
+	}
+	if !found {
+		if field == privvalSignBytesRequest {
+			return nil, fmt.Errorf("%w: unexpected response", ErrRemoteSignerUnsupported)
+		}
+		return nil, fmt.Errorf("%w: unexpected response", ErrRemoteSigner)
+	}
+
+	if err := remoteSignerError(body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// readMessage reads a length-prefixed privval message.
+func (s *RemoteSigner) readMessage() ([]byte, error) {
+	size, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > privvalMaxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds limit", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(s.r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// remoteSignerError returns the RemoteSignerError in field 2 of a response,
+// if any. Every privval response has its error in field 2.
+func remoteSignerError(body []byte) error {
+	var (
+		code        int64
+		description string
+		found       bool
+	)
+	decodeProto(body, func(f protoField) error {
+		if f.num != 2 {
+			return nil
+		}
+		found = true
+		return decodeMessage(f, func(f protoField) error {
+			switch f.num {
+			case 1:
+				return f.int64(&code)
+			case 2:
+				return f.string(&description)
+			}
+			return nil
+		})
+	})
+	if !found {
+		return nil
+	}
+	return fmt.Errorf("%w: code %d: %s", ErrRemoteSigner, code, description)
+}
+
+// Fields of the tendermint.privval.Message oneof. SignBytesRequest and
+// SignedBytesResponse aren't part of the privval protocol: they're this
+// package's experimental extension for builder payloads, see RemoteSigner.
+const (
+	privvalPubKeyRequest       = 1
+	privvalPubKeyResponse      = 2
+	privvalPingRequest         = 7
+	privvalPingResponse        = 8
+	privvalSignBytesRequest    = 100
+	privvalSignedBytesResponse = 101
+
+	privvalMaxMessageSize = 1 << 20
+)
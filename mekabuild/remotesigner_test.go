@@ -0,0 +1,153 @@
+package mekabuild_test
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestRemoteSigner(t *testing.T) {
+	t.Parallel()
+
+	signer, addr := newTestRemoteSigner(t)
+	public, private, _ := ed25519.GenerateKey(nil)
+	go serveRemoteSigner(t, addr, private, true)
+
+	keyType, publicKey, err := signer.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := mekabuild.KeyTypeEd25519, keyType; want != have {
+		t.Errorf("key type: want %q, have %q", want, have)
+	}
+	if !public.Equal(ed25519.PublicKey(publicKey)) {
+		t.Errorf("public key: want %x, have %x", public, publicKey)
+	}
+
+	if err := signer.Ping(); err != nil {
+		t.Errorf("ping: %v", err)
+	}
+
+	req := &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: "validator", MaxBytes: 1000, MaxGas: -1}
+	if err := signer.SignBuildBlockRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := mekabuild.VerifyBuildBlockRequest(req, public); err != nil {
+		t.Errorf("verify build block request: %v", err)
+	}
+
+	challenge := []byte("challenge")
+	sig, err := signer.SignChallenge(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(public, mekabuild.ChallengeSignBytes(challenge), sig) {
+		t.Errorf("challenge signature doesn't verify")
+	}
+}
+
+func TestRemoteSignerUnsupported(t *testing.T) {
+	t.Parallel()
+
+	signer, addr := newTestRemoteSigner(t)
+	_, private, _ := ed25519.GenerateKey(nil)
+	go serveRemoteSigner(t, addr, private, false)
+
+	req := &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: "validator", MaxBytes: 1000, MaxGas: -1}
+	if err := signer.SignBuildBlockRequest(req); !errors.Is(err, mekabuild.ErrRemoteSignerUnsupported) {
+		t.Errorf("want %v, have %v", mekabuild.ErrRemoteSignerUnsupported, err)
+	}
+}
+
+func newTestRemoteSigner(t *testing.T) (*mekabuild.RemoteSigner, string) {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "mekabuild") // short, as socket paths are limited
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	addr := filepath.Join(dir, "signer.sock")
+	signer, err := mekabuild.ListenRemoteSigner("unix://"+addr, "chain-id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { signer.Close() })
+
+	return signer, addr
+}
+
+// serveRemoteSigner dials the listening RemoteSigner like a remote signer, and
+// answers privval requests. Signers without the builder extension close the
+// connection on sign bytes requests.
+func serveRemoteSigner(t *testing.T, addr string, key ed25519.PrivateKey, extension bool) {
+	conn, err := net.Dial("unix", addr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return
+		}
+
+		field, body, _ := readTestProtoField(msg)
+		var resp []byte
+		switch field {
+		case 1: // PubKeyRequest
+			pubKey := appendTestProtoField(nil, 1, key.Public().(ed25519.PublicKey))
+			resp = appendTestProtoField(nil, 2, appendTestProtoField(nil, 1, pubKey))
+		case 7: // PingRequest
+			resp = appendTestProtoField(nil, 8, nil)
+		case 100: // SignBytesRequest
+			if !extension {
+				return
+			}
+			_, _, rest := readTestProtoField(body) // chain ID
+			_, signBytes, _ := readTestProtoField(rest)
+			resp = appendTestProtoField(nil, 101, appendTestProtoField(nil, 1, ed25519.Sign(key, signBytes)))
+		default:
+			return
+		}
+
+		conn.Write(append(appendTestUvarint(nil, uint64(len(resp))), resp...))
+	}
+}
+
+// appendTestProtoField appends a length-delimited protobuf field.
+func appendTestProtoField(dst []byte, field int, value []byte) []byte {
+	dst = appendTestUvarint(dst, uint64(field)<<3|2)
+	dst = appendTestUvarint(dst, uint64(len(value)))
+	return append(dst, value...)
+}
+
+// readTestProtoField reads a length-delimited protobuf field, returning the
+// field number, its value, and the remaining data.
+func readTestProtoField(data []byte) (int, []byte, []byte) {
+	key, n := binary.Uvarint(data)
+	size, m := binary.Uvarint(data[n:])
+	end := n + m + int(size)
+	return int(key >> 3), data[n+m : end], data[end:]
+}
+
+func appendTestUvarint(dst []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(dst, buf[:binary.PutUvarint(buf[:], v)]...)
+}
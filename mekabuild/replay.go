@@ -0,0 +1,204 @@
+package mekabuild
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AuditRecord is a single recorded exchange with the builder API. Audit logs
+// are streams of JSON encoded records, one per line.
+type AuditRecord struct {
+	Time     time.Time           `json:"time"`
+	Duration time.Duration       `json:"duration,omitempty"`
+	Endpoint string              `json:"endpoint,omitempty"`
+	Request  *BuildBlockRequest  `json:"request"`
+	Response *BuildBlockResponse `json:"response,omitempty"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// WriteAuditRecord appends the record to the audit log w.
+func WriteAuditRecord(w io.Writer, rec AuditRecord) error {
+	return json.NewEncoder(w).Encode(rec)
+}
+
+// Recorder writes an audit log of every build request sent by a builder, and
+// its outcome, e.g. to a file, so the traffic can be inspected and replayed
+// after an incident. See SetRecorder.
+type Recorder struct {
+	mtx sync.Mutex
+	w   io.Writer
+}
+
+// NewRecorder returns a recorder that writes JSON lines to w. Writes are
+// serialized, so w needn't be safe for concurrent use.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Record appends the record to the audit log.
+func (r *Recorder) Record(rec AuditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, err = r.w.Write(append(data, '\n'))
+	return err
+}
+
+// SetRecorder records every build request sent to the builder API, with its
+// timing and outcome, via r. Requests are recorded as sent, i.e. signed. A nil
+// recorder disables recording. Unlike the audit records kept in the builder's
+// store, recordings can be replayed directly, see Replayer.
+func (b *Builder) SetRecorder(r *Recorder) {
+	b.recorder.Store(recorderBox{r})
+}
+
+// WithRecorder sets the builder's recorder. See SetRecorder.
+func WithRecorder(r *Recorder) Option {
+	return func(b *Builder) error {
+		b.SetRecorder(r)
+		return nil
+	}
+}
+
+type recorderBox struct{ *Recorder }
+
+func (b *Builder) getRecorder() *Recorder {
+	box, _ := b.recorder.Load().(recorderBox)
+	return box.Recorder
+}
+
+// ReplayResult describes the outcome of replaying a single audit record.
+type ReplayResult struct {
+	Record   AuditRecord
+	Response *BuildBlockResponse
+	Err      error
+	Duration time.Duration
+
+	// Equivalent is true when the replayed outcome matches the recorded
+	// outcome: both succeeded with the same txs and payment, or both failed.
+	Equivalent bool
+}
+
+// Replay reads audit records from r and sends each recorded request, as-is and
+// without re-signing, to the builder API. It returns one result per record, so
+// operators can verify that a client or server upgrade behaves equivalently
+// before deploying it to validators. See Replayer for more options.
+//
+// Replay stops at the first malformed record, or when ctx is canceled.
+func (b *Builder) Replay(ctx context.Context, r io.Reader) ([]ReplayResult, error) {
+	return (&Replayer{Builder: b}).Replay(ctx, r)
+}
+
+// Replayer re-drives recorded build requests against the endpoints of a
+// builder, e.g. a builder configured with a new endpoint, or a local build of
+// the builder API, to reproduce an incident.
+type Replayer struct {
+	Builder *Builder
+
+	// Resign re-signs each request, and each retry of it, with the
+	// builder's signer, with fresh replay protection if the builder has it
+	// enabled, so it's accepted by endpoints that reject replayed requests.
+	// Otherwise, requests are sent as recorded.
+	Resign bool
+
+	// Pace waits between requests as long as between the recorded
+	// requests, to reproduce the timing of the original traffic.
+	Pace bool
+}
+
+// Replay reads audit records from r, and replays each of them. It returns one
+// result per record. It stops at the first malformed record, or when ctx is
+// canceled.
+func (p *Replayer) Replay(ctx context.Context, r io.Reader) ([]ReplayResult, error) {
+	var (
+		b       = p.Builder
+		dec     = json.NewDecoder(r)
+		results []ReplayResult
+		prev    time.Time
+	)
+	for {
+		var rec AuditRecord
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			return results, nil
+		}
+		if err != nil {
+			return results, fmt.Errorf("decode record %d: %w", len(results)+1, err)
+		}
+
+		if rec.Request == nil {
+			return results, fmt.Errorf("record %d: missing request", len(results)+1)
+		}
+
+		if gap := rec.Time.Sub(prev); p.Pace && !prev.IsZero() && gap > 0 {
+			select {
+			case <-b.getClock().After(gap):
+			case <-ctx.Done():
+			}
+		}
+		prev = rec.Time
+
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		req := rec.Request
+		if p.Resign {
+			resigned := *req
+			resigned.Signature, resigned.Nonce, resigned.Timestamp, resigned.Presign = nil, 0, 0, nil
+			b.setReplayProtection(&resigned)
+			if err := b.signRequest(&resigned); err != nil {
+				return results, fmt.Errorf("record %d: sign request: %w", len(results)+1, err)
+			}
+			req = &resigned
+		}
+
+		var (
+			resp   BuildBlockResponse
+			result = ReplayResult{Record: rec}
+			begin  = b.now()
+		)
+		next := func(int) (interface{}, http.Header, error) { return req, nil, nil }
+		if p.Resign {
+			next = (&buildAttempts{b: b, req: req}).next
+		}
+		if _, result.Err = b.doAttempts(ctx, "/v0/build", next, &resp); result.Err == nil {
+			result.Response = &resp
+		}
+		result.Duration = b.since(begin)
+		result.Equivalent = equivalentOutcome(rec, result.Response)
+		results = append(results, result)
+
+		b.getLogger().Infof("replayed build request: chain_id=%s height=%d recorded_took=%s took=%s equivalent=%v err=%v", req.ChainID, req.Height, rec.Duration, result.Duration, result.Equivalent, result.Err)
+	}
+}
+
+func equivalentOutcome(rec AuditRecord, resp *BuildBlockResponse) bool {
+	switch {
+	case rec.Response == nil && resp == nil:
+		return true
+	case rec.Response == nil || resp == nil:
+		return false
+	case rec.Response.ValidatorPayment != resp.ValidatorPayment:
+		return false
+	case len(rec.Response.Txs) != len(resp.Txs):
+		return false
+	}
+	for i := range resp.Txs {
+		if !bytes.Equal(rec.Response.Txs[i], resp.Txs[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderReplay(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", rand.Reader)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		log       bytes.Buffer
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	req := &mekabuild.BuildBlockRequest{
+		ChainID:          chainID,
+		Height:           1,
+		ValidatorAddress: key.addr,
+		Txs:              [][]byte{[]byte(`tx1`)},
+	}
+	resp, err := builder.BuildBlock(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := mekabuild.AuditRecord{Time: time.Now(), Request: req, Response: resp}
+	drifted := mekabuild.AuditRecord{Time: time.Now(), Request: req, Response: &mekabuild.BuildBlockResponse{Txs: resp.Txs, ValidatorPayment: "0 coins"}}
+	for _, rec := range []mekabuild.AuditRecord{good, drifted} {
+		if err := mekabuild.WriteAuditRecord(&log, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := builder.Replay(ctx, &log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := 2, len(results); want != have {
+		t.Fatalf("result count: want %d, have %d", want, have)
+	}
+
+	if want, have := true, results[0].Equivalent; want != have {
+		t.Errorf("result 0 equivalent: want %v, have %v (%v)", want, have, results[0].Err)
+	}
+
+	if want, have := false, results[1].Equivalent; want != have {
+		t.Errorf("result 1 equivalent: want %v, have %v", want, have)
+	}
+}
+
+func TestBuilderRecorder(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		key       = newMockKey(t, "validator", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		log       bytes.Buffer
+		newReq    = func(height int64) *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	builder.SetRecorder(mekabuild.NewRecorder(&log))
+	builder.SetRetryPolicy(mekabuild.RetryPolicy{MaxAttempts: 1})
+
+	if _, err := builder.BuildBlock(ctx, newReq(1)); err != nil {
+		t.Fatal(err)
+	}
+	api.FailNext(1, http.StatusServiceUnavailable)
+	if _, err := builder.BuildBlock(ctx, newReq(2)); err == nil {
+		t.Fatalf("injected failure: want error, have none")
+	}
+
+	var records []mekabuild.AuditRecord
+	dec := json.NewDecoder(bytes.NewReader(log.Bytes()))
+	for dec.More() {
+		var rec mekabuild.AuditRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	if want, have := 2, len(records); want != have {
+		t.Fatalf("records: want %d, have %d", want, have)
+	}
+	if records[0].Response == nil || records[0].Error != "" {
+		t.Errorf("record 0: want response, have error %q", records[0].Error)
+	}
+	if records[1].Response != nil || records[1].Error == "" {
+		t.Errorf("record 1: want error, have response %+v", records[1].Response)
+	}
+	for i, rec := range records {
+		if rec.Time.IsZero() || rec.Endpoint == "" {
+			t.Errorf("record %d: missing time or endpoint: %+v", i, rec)
+		}
+		if err := mekabuild.VerifyBuildBlockRequest(rec.Request, key.PublicKey); err != nil {
+			t.Errorf("record %d: verify: %v", i, err)
+		}
+	}
+
+	// Replay the recording against a new endpoint, re-signed.
+	var (
+		newAPI       = newMockAPI()
+		newServer    = newTestServer(t, newAPI)
+		newURL, _    = url.Parse(newServer.URL)
+		newBuilder   = mekabuild.NewBuilder(&http.Client{}, newURL, key, chainID, key.addr)
+		replayer     = &mekabuild.Replayer{Builder: newBuilder, Resign: true, Pace: true}
+		results, err = replayer.Replay(ctx, bytes.NewReader(log.Bytes()))
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 2, len(results); want != have {
+		t.Fatalf("results: want %d, have %d", want, have)
+	}
+	if results[0].Err == nil || results[1].Err == nil {
+		t.Errorf("unknown validator: want errors, have %v, %v", results[0].Err, results[1].Err)
+	}
+
+	newAPI.AddPublicKey(chainID, key.addr, key.PublicKey)
+	results, err = replayer.Replay(ctx, bytes.NewReader(log.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Equivalent {
+		t.Errorf("result 0: want equivalent, have %v", results[0].Err)
+	}
+	if results[1].Equivalent || results[1].Err != nil {
+		t.Errorf("result 1: want success, not equivalent to the recorded failure, have %v", results[1].Err)
+	}
+	if want, have := 2, len(newAPI.Builds()); want != have {
+		t.Errorf("replayed builds: want %d, have %d", want, have)
+	}
+}
@@ -0,0 +1,120 @@
+package mekabuild
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+)
+
+// BuildBlockResponseSignBytes returns the bytes signed by the builder API to
+// authenticate a build response for the given request parameters, so clients
+// can detect transactions or payments injected by a man-in-the-middle or a
+// compromised relay.
+func BuildBlockResponseSignBytes(chainID string, height int64, validatorAddr string, txsHash []byte, payment string) []byte {
+	// XXX: As with BuildBlockRequestSignBytes, changing the order or the set
+	// of fields requires updating both the builder API and its clients.
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`build-block-response`))
+	mustEncode(&sb, uint64(len([]byte(chainID))))
+	mustEncode(&sb, []byte(chainID))
+	mustEncode(&sb, height)
+	mustEncode(&sb, uint64(len([]byte(validatorAddr))))
+	mustEncode(&sb, []byte(validatorAddr))
+	mustEncode(&sb, uint64(len(txsHash)))
+	mustEncode(&sb, txsHash)
+	mustEncode(&sb, uint64(len([]byte(payment))))
+	mustEncode(&sb, []byte(payment))
+	return sb.Bytes()
+}
+
+// SignBytes returns the bytes signed by the builder API for a response to req.
+// The txs are hashed with the request's txs hash version, and the auction ID is
+// bound, if there is one.
+func (r *BuildBlockResponse) SignBytes(req *BuildBlockRequest) ([]byte, error) {
+	txsHash, err := HashTxsVersion(req.TxsHashVersion, r.Txs...)
+	if err != nil {
+		return nil, err
+	}
+	return bindAuctionID(r.AuctionID, BuildBlockResponseSignBytes(req.ChainID, req.Height, req.ValidatorAddress, txsHash, r.ValidatorPayment)), nil
+}
+
+// SignBuildBlockResponse signs the response to req with the builder API's key.
+// It's intended for use by builder API implementations.
+func SignBuildBlockResponse(req *BuildBlockRequest, resp *BuildBlockResponse, privateKey ed25519.PrivateKey) error {
+	msg, err := resp.SignBytes(req)
+	if err != nil {
+		return err
+	}
+	resp.Signature = ed25519.Sign(privateKey, msg)
+	return nil
+}
+
+// VerifyBuildBlockResponse verifies the response to req against the builder
+// API's public key. It returns an error wrapping ErrBadResponseSignature if
+// the response is unsigned, or the signature doesn't verify.
+func VerifyBuildBlockResponse(req *BuildBlockRequest, resp *BuildBlockResponse, publicKey ed25519.PublicKey) error {
+	if len(resp.Signature) == 0 {
+		return fmt.Errorf("%w: response is unsigned", ErrBadResponseSignature)
+	}
+
+	msg, err := resp.SignBytes(req)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey, msg, resp.Signature) {
+		return ErrBadResponseSignature
+	}
+
+	return nil
+}
+
+// ErrBadResponseSignature is returned when a build response isn't signed by
+// the builder API's pinned public key.
+var ErrBadResponseSignature = errors.New("bad response signature")
+
+// SetBuilderPublicKey pins the public key of the builder API. Once set, every
+// build response must be signed by it, see VerifyBuildBlockResponse, or the
+// request fails. A nil key disables verification, which is the default.
+func (b *Builder) SetBuilderPublicKey(publicKey ed25519.PublicKey) error {
+	if publicKey != nil && len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid ed25519 public key size %d", len(publicKey))
+	}
+	b.builderKey.Store(append(ed25519.PublicKey(nil), publicKey...))
+	return nil
+}
+
+// WithBuilderPublicKey pins the public key of the builder API. See
+// SetBuilderPublicKey.
+func WithBuilderPublicKey(publicKey ed25519.PublicKey) Option {
+	return func(b *Builder) error {
+		return b.SetBuilderPublicKey(publicKey)
+	}
+}
+
+// verifyResponse checks that resp includes the mandatory txs of the request,
+// following its attestation tx, if any, checks its payment receipt, if any,
+// and verifies resp if a builder public key is pinned.
+func (b *Builder) verifyResponse(req *BuildBlockRequest, resp *BuildBlockResponse) error {
+	_, txs, err := SplitAttestation(resp.Txs)
+	if err != nil {
+		return err
+	}
+	if err := VerifyMandatoryTxs(req.MandatoryTxs, txs); err != nil {
+		return err
+	}
+	if err := b.checkPolicy(req, txs); err != nil {
+		return err
+	}
+
+	publicKey, _ := b.builderKey.Load().(ed25519.PublicKey)
+	if err := VerifyPaymentReceipt(req, resp, publicKey); err != nil {
+		return err
+	}
+	if len(publicKey) == 0 {
+		return nil
+	}
+	return VerifyBuildBlockResponse(req, resp, publicKey)
+}
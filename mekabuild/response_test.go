@@ -0,0 +1,88 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderResponseSignature(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx                   = context.Background()
+		chainID               = "chain-id"
+		key                   = newMockKey(t, "validator", nil)
+		api                   = newMockAPI()
+		server                = newTestServer(t, api)
+		apiURL, _             = url.Parse(server.URL)
+		builderPublic, _, _   = ed25519.GenerateKey(nil)
+		otherPublic, other, _ = ed25519.GenerateKey(nil)
+		newReq                = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithBuilderPublicKey(builderPublic),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unsigned responses are rejected.
+	if _, err := builder.BuildBlock(ctx, newReq()); !errors.Is(err, mekabuild.ErrBadResponseSignature) {
+		t.Errorf("unsigned: want %v, have %v", mekabuild.ErrBadResponseSignature, err)
+	}
+
+	// Responses signed by another key are rejected.
+	api.SetBuilderKey(other)
+	if _, err := builder.BuildBlock(ctx, newReq()); !errors.Is(err, mekabuild.ErrBadResponseSignature) {
+		t.Errorf("wrong key: want %v, have %v", mekabuild.ErrBadResponseSignature, err)
+	}
+
+	// Responses signed by the pinned key are accepted.
+	if err := builder.SetBuilderPublicKey(otherPublic); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Errorf("pinned key: %v", err)
+	}
+}
+
+func TestVerifyBuildBlockResponseTampered(t *testing.T) {
+	var (
+		public, private, _ = ed25519.GenerateKey(nil)
+		req                = &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: "validator"}
+		resp               = &mekabuild.BuildBlockResponse{Txs: [][]byte{[]byte("tx")}, ValidatorPayment: "1uatom"}
+	)
+
+	if err := mekabuild.SignBuildBlockResponse(req, resp, private); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mekabuild.VerifyBuildBlockResponse(req, resp, public); err != nil {
+		t.Fatalf("valid: %v", err)
+	}
+
+	for name, tamper := range map[string]func(*mekabuild.BuildBlockRequest, *mekabuild.BuildBlockResponse){
+		"txs": func(_ *mekabuild.BuildBlockRequest, r *mekabuild.BuildBlockResponse) {
+			r.Txs = append(r.Txs, []byte("injected"))
+		},
+		"payment": func(_ *mekabuild.BuildBlockRequest, r *mekabuild.BuildBlockResponse) { r.ValidatorPayment = "0uatom" },
+		"height":  func(r *mekabuild.BuildBlockRequest, _ *mekabuild.BuildBlockResponse) { r.Height++ },
+	} {
+		req, resp := *req, *resp
+		tamper(&req, &resp)
+		if err := mekabuild.VerifyBuildBlockResponse(&req, &resp, public); !errors.Is(err, mekabuild.ErrBadResponseSignature) {
+			t.Errorf("%s: want %v, have %v", name, mekabuild.ErrBadResponseSignature, err)
+		}
+	}
+}
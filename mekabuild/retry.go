@@ -0,0 +1,145 @@
+package mekabuild
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how the builder retries failed requests to the builder
+// API. Only transient failures are retried: connection errors, and 5xx
+// responses. Retries are never attempted if the backoff would exceed the
+// deadline of the caller's context.
+//
+// Independently of the policy, a request whose connection was lost, e.g. to an
+// HTTP/2 GOAWAY or a connection reset, is retried once, immediately, on a
+// fresh connection.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts per request, including
+	// the first. Values less than 2 disable retries.
+	MaxAttempts int
+
+	// BaseBackoff is the delay before the first retry. Subsequent delays
+	// double, up to MaxBackoff.
+	BaseBackoff time.Duration
+
+	// MaxBackoff caps the delay between attempts. Zero means no cap.
+	MaxBackoff time.Duration
+
+	// Jitter randomizes each delay by up to the given fraction in either
+	// direction, e.g. 0.2 for ±20%.
+	Jitter float64
+
+	// PerAttemptTimeout bounds each individual attempt. Zero means attempts
+	// are only bound by the caller's context.
+	PerAttemptTimeout time.Duration
+}
+
+// DefaultRetryPolicy is a reasonable retry policy for typical proposal
+// timeouts. Builders don't retry unless a policy is set.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseBackoff: 50 * time.Millisecond,
+	MaxBackoff:  250 * time.Millisecond,
+	Jitter:      0.2,
+}
+
+// SetRetryPolicy sets the retry policy for requests to the builder API.
+func (b *Builder) SetRetryPolicy(p RetryPolicy) error {
+	if p.BaseBackoff < 0 || p.MaxBackoff < 0 || p.PerAttemptTimeout < 0 {
+		return errors.New("durations must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1, have %v", p.Jitter)
+	}
+	b.retryPolicy.Store(p)
+	return nil
+}
+
+func (b *Builder) getRetryPolicy() RetryPolicy {
+	p, _ := b.retryPolicy.Load().(RetryPolicy)
+	return p
+}
+
+// backoffLimit caps delays, including without a MaxBackoff, so that doubling
+// and jitter can't overflow.
+const backoffLimit = time.Duration(math.MaxInt64 / 4)
+
+// backoff returns the delay after the given (1-indexed) failed attempt. The
+// random number in [0, 1) determines the jitter.
+func (p RetryPolicy) backoff(attempt int, random float64) time.Duration {
+	limit := p.MaxBackoff
+	if limit == 0 || limit > backoffLimit {
+		limit = backoffLimit
+	}
+	d := p.BaseBackoff
+	for i := 1; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*random-1)))
+	}
+	return d
+}
+
+// retryable returns true if err is a transient failure worth retrying.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false // caller gave up
+	}
+
+	if errors.Is(err, ErrUploadTooSlow) {
+		return false // a retry would be just as slow
+	}
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= http.StatusInternalServerError
+	}
+
+	var ue *url.Error
+	return errors.As(err, &ue) // transport errors from http.Client.Do
+}
+
+// connectionLost returns true if err means the connection the request was
+// sent on went away, e.g. an HTTP/2 GOAWAY or a TCP reset when a load balancer
+// drains connections during a deploy. Such requests are retried immediately,
+// on a fresh connection, regardless of the retry policy. See Builder.do.
+func connectionLost(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		return false // e.g. a StatusError
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// The HTTP/2 and idle connection errors are unexported by net/http.
+	msg := err.Error()
+	for _, s := range []string{
+		"server sent GOAWAY",
+		"client connection lost",
+		"server closed idle connection",
+		"connection reset by peer",
+	} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		failures int32
+		code     int
+		attempts int32
+		success  bool
+	}{
+		{"recovers from 5xx", 2, http.StatusBadGateway, 3, true},
+		{"gives up after max attempts", 5, http.StatusServiceUnavailable, 3, false},
+		{"doesn't retry 4xx", 5, http.StatusBadRequest, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				ctx      = context.Background()
+				chainID  = "test-chain-id"
+				key      = newMockKey(t, "foo", rand.Reader)
+				api      = newMockAPI()
+				attempts int32
+				server   = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if atomic.AddInt32(&attempts, 1) <= tc.failures {
+						http.Error(w, "injected failure", tc.code)
+						return
+					}
+					api.ServeHTTP(w, r)
+				}))
+				apiURL, _ = url.Parse(server.URL)
+				builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+			)
+
+			api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+			if err := builder.SetRetryPolicy(mekabuild.RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, Jitter: 0.5}); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, ValidatorAddress: key.addr})
+			if want, have := tc.success, err == nil; want != have {
+				t.Errorf("success: want %v, have %v (%v)", want, have, err)
+			}
+
+			if want, have := tc.attempts, atomic.LoadInt32(&attempts); want != have {
+				t.Errorf("attempts: want %d, have %d", want, have)
+			}
+		})
+	}
+}
+
+func TestBuilderConnectionLostRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		fail     func(http.ResponseWriter)
+		attempts int32
+		success  bool
+	}{
+		{"connection closed", func(w http.ResponseWriter) { hijack(t, w).Close() }, 2, true},
+		{"connection reset", func(w http.ResponseWriter) {
+			conn := hijack(t, w)
+			conn.(*net.TCPConn).SetLinger(0) // send RST
+			conn.Close()
+		}, 2, true},
+		{"no fast retry for 5xx", func(w http.ResponseWriter) { http.Error(w, "injected failure", http.StatusBadGateway) }, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				ctx      = context.Background()
+				chainID  = "test-chain-id"
+				key      = newMockKey(t, "foo", rand.Reader)
+				api      = newMockAPI()
+				attempts int32
+				server   = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if atomic.AddInt32(&attempts, 1) == 1 {
+						tc.fail(w)
+						return
+					}
+					api.ServeHTTP(w, r)
+				}))
+				apiURL, _ = url.Parse(server.URL)
+				builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr) // no retry policy
+			)
+
+			api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+			_, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, ValidatorAddress: key.addr})
+			if want, have := tc.success, err == nil; want != have {
+				t.Errorf("success: want %v, have %v (%v)", want, have, err)
+			}
+
+			if want, have := tc.attempts, atomic.LoadInt32(&attempts); want != have {
+				t.Errorf("attempts: want %d, have %d", want, have)
+			}
+		})
+	}
+}
+
+func hijack(t *testing.T, w http.ResponseWriter) net.Conn {
+	t.Helper()
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestBuilderRetryBackoffWithoutCap(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		chainID  = "test-chain-id"
+		key      = newMockKey(t, "foo", rand.Reader)
+		clock    = newFakeClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+		attempts = 100 // enough doublings of BaseBackoff to overflow
+		server   = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "injected failure", http.StatusServiceUnavailable)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+	)
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithClock(clock),
+		mekabuild.WithRetry(mekabuild.RetryPolicy{MaxAttempts: attempts, BaseBackoff: time.Millisecond, Jitter: 0.5}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, ValidatorAddress: key.addr}); err == nil {
+		t.Fatal("want error, have none")
+	}
+
+	if want, have := attempts-1, len(clock.sleeps); want != have {
+		t.Fatalf("backoffs: want %d, have %d", want, have)
+	}
+	for i, d := range clock.sleeps {
+		if d < time.Millisecond/2 {
+			t.Fatalf("backoff %d: want at least %s, have %s", i, time.Millisecond/2, d)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package mekabuild
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// The sandbox builder API holds fake auctions, with fake payments, and
+// otherwise behaves like the production API: validators register, builds are
+// signed and verified, and status is reported as usual. It lets new operators
+// and CI pipelines exercise the full flow without any mainnet risk.
+var sandboxBuilderAPIURL = &url.URL{Scheme: "https", Host: "sandbox.api.mekatek.xyz"}
+
+// SandboxMode returns true if the MEKATEK_BUILDER_API_SANDBOX environment
+// variable is set to true. In sandbox mode, GetBuilderAPIURL returns the URL
+// of the sandbox builder API, unless the URL is explicitly overridden.
+func SandboxMode() bool {
+	b, err := strconv.ParseBool(os.Getenv("MEKATEK_BUILDER_API_SANDBOX"))
+	return err == nil && b
+}
+
+// SandboxBuilderAPIURL returns the URL of the sandbox builder API.
+func SandboxBuilderAPIURL() *url.URL {
+	u := *sandboxBuilderAPIURL
+	return &u
+}
+
+// WithSandbox routes all requests to the sandbox builder API, replacing any
+// endpoints set by earlier options. Options that set endpoints, like
+// WithEndpoints, must not follow it.
+func WithSandbox() Option {
+	return func(b *Builder) error {
+		if err := b.SetEndpoints(SandboxBuilderAPIURL()); err != nil {
+			return err
+		}
+		b.getLogger().Infof("sandbox mode: chain_id=%s endpoint=%s", b.chainID, endpointName(sandboxBuilderAPIURL))
+		return nil
+	}
+}
+
+// Sandbox returns true if every endpoint of the builder is the sandbox builder
+// API, see WithSandbox.
+func (b *Builder) Sandbox() bool {
+	endpoints := b.Endpoints()
+	for _, u := range endpoints {
+		if u.Host != sandboxBuilderAPIURL.Host {
+			return false
+		}
+	}
+	return len(endpoints) > 0
+}
@@ -0,0 +1,57 @@
+package mekabuild_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestSandboxMode(t *testing.T) {
+	key := newMockKey(t, "validator", nil)
+
+	setenv(t, "MEKATEK_BUILDER_API_SANDBOX", "true")
+	if want, have := mekabuild.SandboxBuilderAPIURL().String(), mekabuild.GetBuilderAPIURL().String(); want != have {
+		t.Errorf("sandbox URL: want %q, have %q", want, have)
+	}
+
+	builder, err := mekabuild.New(key, "chain-id", key.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !builder.Sandbox() {
+		t.Errorf("builder from environment: want sandbox, have %v", builder.Endpoints())
+	}
+
+	setenv(t, "MEKATEK_BUILDER_API_URL", "builder.example.com")
+	if want, have := "https://builder.example.com", mekabuild.GetBuilderAPIURL().String(); want != have {
+		t.Errorf("explicit URL: want %q, have %q", want, have)
+	}
+}
+
+func TestWithSandbox(t *testing.T) {
+	t.Parallel()
+
+	var (
+		key        = newMockKey(t, "validator", nil)
+		production = &url.URL{Scheme: "https", Host: "builder.example.com"}
+	)
+
+	builder, err := mekabuild.New(key, "chain-id", key.addr, mekabuild.WithEndpoints(production), mekabuild.WithSandbox())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !builder.Sandbox() {
+		t.Errorf("with sandbox: want sandbox, have %v", builder.Endpoints())
+	}
+	if want, have := 1, len(builder.Endpoints()); want != have {
+		t.Errorf("endpoints: want %d, have %d", want, have)
+	}
+
+	if err := builder.SetEndpoints(mekabuild.SandboxBuilderAPIURL(), production); err != nil {
+		t.Fatal(err)
+	}
+	if builder.Sandbox() {
+		t.Errorf("with production endpoint: want no sandbox, have sandbox")
+	}
+}
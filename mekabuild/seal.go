@@ -0,0 +1,118 @@
+package mekabuild
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Sealer encrypts and decrypts state that the builder client persists to
+// local storage, e.g. registration details or audit records. Operators may
+// consider that data sensitive, as it can contain payment routing information.
+//
+// Sealed data is AES-256-GCM ciphertext, prefixed with a version byte and a
+// random nonce.
+type Sealer struct {
+	aead cipher.AEAD
+	rand io.Reader
+}
+
+// NewSealer returns a sealer using the provided 32 byte key.
+func NewSealer(key []byte) (*Sealer, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, have %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create GCM: %w", err)
+	}
+
+	return &Sealer{aead: aead, rand: rand.Reader}, nil
+}
+
+// Seal encrypts the plaintext.
+func (s *Sealer) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(s.rand, nonce); err != nil {
+		return nil, fmt.Errorf("read nonce: %w", err)
+	}
+
+	out := make([]byte, 0, 1+len(nonce)+len(plaintext)+s.aead.Overhead())
+	out = append(out, sealVersion)
+	out = append(out, nonce...)
+	return s.aead.Seal(out, nonce, plaintext, []byte{sealVersion}), nil
+}
+
+// Open decrypts ciphertext previously produced by Seal.
+func (s *Sealer) Open(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 1+s.aead.NonceSize() {
+		return nil, ErrSealedDataInvalid
+	}
+
+	if ciphertext[0] != sealVersion {
+		return nil, fmt.Errorf("%w: unknown version %d", ErrSealedDataInvalid, ciphertext[0])
+	}
+
+	nonce := ciphertext[1 : 1+s.aead.NonceSize()]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext[1+len(nonce):], []byte{sealVersion})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSealedDataInvalid, err)
+	}
+
+	return plaintext, nil
+}
+
+// ErrSealedDataInvalid is returned by Open when the ciphertext is malformed,
+// or was sealed with a different key.
+var ErrSealedDataInvalid = errors.New("sealed data invalid")
+
+const sealVersion = 1
+
+// GetStateKey returns the key used to seal persisted state, as configured via
+// the MEKATEK_BUILDER_API_STATE_KEY or ZENITH_STATE_KEY environment variable.
+// The value should be a hex encoded 32 byte key. If neither variable is set,
+// GetStateKey returns nil, which means state is persisted unencrypted.
+func GetStateKey() ([]byte, error) {
+	var s string
+	for _, v := range []string{
+		"ZENITH_STATE_KEY",
+		"MEKATEK_BUILDER_API_STATE_KEY",
+	} {
+		if s = os.Getenv(v); s != "" {
+			checkDeprecatedEnv(v)
+			break
+		}
+	}
+
+	if s == "" {
+		return nil, nil
+	}
+
+	return parseStateKey(s)
+}
+
+// parseStateKey decodes a hex encoded 32 byte state key.
+func parseStateKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decode state key: %w", err)
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("state key must be 32 bytes, have %d", len(key))
+	}
+
+	return key, nil
+}
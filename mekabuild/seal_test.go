@@ -0,0 +1,44 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestSealer(t *testing.T) {
+	s, err := mekabuild.NewSealer(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte(`{"payment_address":"cosmos1abc"}`)
+	ciphertext, err := s.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Fatalf("ciphertext contains plaintext")
+	}
+
+	have, err := s.Open(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := plaintext; !bytes.Equal(want, have) {
+		t.Fatalf("want %q, have %q", want, have)
+	}
+
+	other, err := mekabuild.NewSealer(bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := other.Open(ciphertext); !errors.Is(err, mekabuild.ErrSealedDataInvalid) {
+		t.Fatalf("open with wrong key: want %v, have %v", mekabuild.ErrSealedDataInvalid, err)
+	}
+}
@@ -0,0 +1,157 @@
+package mekabuild
+
+import (
+	"crypto/sha256"
+	"math/big"
+)
+
+// verifySecp256k1 verifies a Tendermint-style secp256k1 signature: a 64 byte
+// r || s ECDSA signature over the sha256 of msg, with s in the lower half of
+// the curve order. The public key must be in 33 byte compressed form.
+//
+// It's implemented with math/big to avoid a dependency, and isn't constant
+// time, which is fine for verification of public data.
+func verifySecp256k1(publicKey, msg, sig []byte) bool {
+	if len(sig) != 64 {
+		return false
+	}
+
+	q, ok := decompressSecp256k1(publicKey)
+	if !ok {
+		return false
+	}
+
+	var (
+		n = secp256k1.n
+		r = new(big.Int).SetBytes(sig[:32])
+		s = new(big.Int).SetBytes(sig[32:])
+	)
+	if r.Sign() == 0 || r.Cmp(n) >= 0 || s.Sign() == 0 || s.Cmp(secp256k1.halfN) > 0 {
+		return false
+	}
+
+	digest := sha256.Sum256(msg)
+	e := new(big.Int).SetBytes(digest[:])
+
+	w := new(big.Int).ModInverse(s, n)
+	u1 := new(big.Int).Mul(e, w)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(r, w)
+	u2.Mod(u2, n)
+
+	x := secp256k1.add(secp256k1.mul(secp256k1.g, u1), secp256k1.mul(q, u2))
+	if x.inf {
+		return false
+	}
+
+	v := new(big.Int).Mod(x.x, n)
+	return v.Cmp(r) == 0
+}
+
+func decompressSecp256k1(b []byte) (point, bool) {
+	if len(b) != 33 || (b[0] != 0x02 && b[0] != 0x03) {
+		return point{}, false
+	}
+
+	p := secp256k1.p
+	x := new(big.Int).SetBytes(b[1:])
+	if x.Cmp(p) >= 0 {
+		return point{}, false
+	}
+
+	// y² = x³ + 7, and since p ≡ 3 mod 4, y = (y²)^((p+1)/4).
+	y2 := new(big.Int).Exp(x, big.NewInt(3), p)
+	y2.Add(y2, big.NewInt(7))
+	y2.Mod(y2, p)
+
+	y := new(big.Int).Exp(y2, secp256k1.sqrtExp, p)
+	if new(big.Int).Exp(y, big.NewInt(2), p).Cmp(y2) != 0 {
+		return point{}, false // not on the curve
+	}
+
+	if y.Bit(0) != uint(b[0]&1) {
+		y.Sub(p, y)
+	}
+
+	return point{x: x, y: y}, true
+}
+
+type point struct {
+	x, y *big.Int
+	inf  bool
+}
+
+type curve struct {
+	p, n, halfN, sqrtExp *big.Int
+	g                    point
+}
+
+var secp256k1 = func() curve {
+	hex := func(s string) *big.Int {
+		v, _ := new(big.Int).SetString(s, 16)
+		return v
+	}
+	c := curve{
+		p: hex("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F"),
+		n: hex("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141"),
+		g: point{
+			x: hex("79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798"),
+			y: hex("483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8"),
+		},
+	}
+	c.halfN = new(big.Int).Rsh(c.n, 1)
+	c.sqrtExp = new(big.Int).Rsh(new(big.Int).Add(c.p, big.NewInt(1)), 2)
+	return c
+}()
+
+// add returns a + b in affine coordinates.
+func (c curve) add(a, b point) point {
+	switch {
+	case a.inf:
+		return b
+	case b.inf:
+		return a
+	}
+
+	var lambda *big.Int
+	if a.x.Cmp(b.x) == 0 {
+		if new(big.Int).Add(a.y, b.y).Mod(new(big.Int).Add(a.y, b.y), c.p).Sign() == 0 {
+			return point{inf: true}
+		}
+		// λ = 3x² / 2y
+		num := new(big.Int).Mul(a.x, a.x)
+		num.Mul(num, big.NewInt(3))
+		den := new(big.Int).Lsh(a.y, 1)
+		lambda = num.Mul(num, den.ModInverse(den.Mod(den, c.p), c.p))
+	} else {
+		// λ = (y₂ - y₁) / (x₂ - x₁)
+		num := new(big.Int).Sub(b.y, a.y)
+		den := new(big.Int).Sub(b.x, a.x)
+		lambda = num.Mul(num, den.ModInverse(den.Mod(den, c.p), c.p))
+	}
+	lambda.Mod(lambda, c.p)
+
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, a.x)
+	x.Sub(x, b.x)
+	x.Mod(x, c.p)
+
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, lambda)
+	y.Sub(y, a.y)
+	y.Mod(y, c.p)
+
+	return point{x: x, y: y}
+}
+
+// mul returns k·a by double-and-add.
+func (c curve) mul(a point, k *big.Int) point {
+	r := point{inf: true}
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = c.add(r, r)
+		if k.Bit(i) == 1 {
+			r = c.add(r, a)
+		}
+	}
+	return r
+}
@@ -0,0 +1,182 @@
+package signerd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+// Errors returned by Guard.
+var (
+	ErrOutOfScope  = errors.New("payload out of scope")
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// GuardConfig restricts what a Guard signs.
+type GuardConfig struct {
+	// ChainID and ValidatorAddress, if set, restrict payloads to the given
+	// chain and validator.
+	ChainID          string
+	ValidatorAddress string
+
+	// Limits caps the rate of each kind of signature, typically
+	// mekabuild.DefaultSigningLimits. Zero means unlimited.
+	Limits mekabuild.SigningLimits
+}
+
+// Guard wraps a signer, and refuses to sign payloads that are out of scope, or
+// that exceed the configured rates, so that a compromised builder client can't
+// induce the key to sign for another chain or validator, or to sign
+// excessively.
+type Guard struct {
+	signer       mekabuild.Signer
+	cfg          GuardConfig
+	build        *mekabuild.RateLimiter // nil means unlimited, like the others
+	challenge    *mekabuild.RateLimiter
+	presign      *mekabuild.RateLimiter
+	confirmation *mekabuild.RateLimiter
+	pause        *mekabuild.RateLimiter
+}
+
+var (
+	_ mekabuild.Signer          = (*Guard)(nil)
+	_ mekabuild.ChallengeSigner = (*Guard)(nil)
+	_ mekabuild.PresignSigner   = (*Guard)(nil)
+	_ mekabuild.ConfirmSigner   = (*Guard)(nil)
+	_ mekabuild.PauseSigner     = (*Guard)(nil)
+)
+
+// NewGuard returns a guard for s, configured by cfg.
+func NewGuard(s mekabuild.Signer, cfg GuardConfig) (*Guard, error) {
+	g := &Guard{signer: s, cfg: cfg}
+	for _, l := range []struct {
+		limiter **mekabuild.RateLimiter
+		name    string
+		n       int
+	}{
+		{&g.build, "build requests", cfg.Limits.BuildRequestsPerMinute},
+		{&g.challenge, "challenges", cfg.Limits.ChallengesPerMinute},
+		{&g.presign, "presignatures", cfg.Limits.PresignsPerMinute},
+		{&g.confirmation, "confirmations", cfg.Limits.ConfirmationsPerMinute},
+		{&g.pause, "pauses", cfg.Limits.PausesPerMinute},
+	} {
+		if l.n < 0 {
+			return nil, fmt.Errorf("%s per minute must not be negative, have %d", l.name, l.n)
+		}
+		if l.n == 0 {
+			continue
+		}
+		limiter, err := mekabuild.NewRateLimiter(float64(l.n)/time.Minute.Seconds(), l.n)
+		if err != nil {
+			return nil, err
+		}
+		*l.limiter = limiter
+	}
+	return g, nil
+}
+
+// SignBuildBlockRequest implements mekabuild.Signer.
+func (g *Guard) SignBuildBlockRequest(req *mekabuild.BuildBlockRequest) error {
+	if err := g.checkScope(req.ChainID, req.ValidatorAddress); err != nil {
+		return err
+	}
+
+	if err := allow(g.build, "build requests"); err != nil {
+		return err
+	}
+
+	return g.signer.SignBuildBlockRequest(req)
+}
+
+// SignChallenge implements mekabuild.ChallengeSigner.
+func (g *Guard) SignChallenge(challenge []byte) ([]byte, error) {
+	cs, ok := g.signer.(mekabuild.ChallengeSigner)
+	if !ok {
+		return nil, errors.New("signer can't sign challenges")
+	}
+
+	if err := allow(g.challenge, "challenges"); err != nil {
+		return nil, err
+	}
+
+	return cs.SignChallenge(challenge)
+}
+
+// SignPresignRequest implements mekabuild.PresignSigner.
+func (g *Guard) SignPresignRequest(req *mekabuild.PresignRequest) error {
+	ps, ok := g.signer.(mekabuild.PresignSigner)
+	if !ok {
+		return errors.New("signer can't sign presign requests")
+	}
+
+	if err := g.checkScope(req.ChainID, req.ValidatorAddress); err != nil {
+		return err
+	}
+
+	if err := allow(g.presign, "presign requests"); err != nil {
+		return err
+	}
+
+	return ps.SignPresignRequest(req)
+}
+
+// SignConfirmRequest implements mekabuild.ConfirmSigner.
+func (g *Guard) SignConfirmRequest(req *mekabuild.ConfirmRequest) error {
+	cs, ok := g.signer.(mekabuild.ConfirmSigner)
+	if !ok {
+		return errors.New("signer can't sign confirm requests")
+	}
+
+	if err := g.checkScope(req.ChainID, req.ValidatorAddress); err != nil {
+		return err
+	}
+
+	if err := allow(g.confirmation, "confirm requests"); err != nil {
+		return err
+	}
+
+	return cs.SignConfirmRequest(req)
+}
+
+// SignPauseRequest implements mekabuild.PauseSigner.
+func (g *Guard) SignPauseRequest(req *mekabuild.PauseRequest) error {
+	ps, ok := g.signer.(mekabuild.PauseSigner)
+	if !ok {
+		return errors.New("signer can't sign pause requests")
+	}
+
+	if err := g.checkScope(req.ChainID, req.ValidatorAddress); err != nil {
+		return err
+	}
+
+	if err := allow(g.pause, "pause requests"); err != nil {
+		return err
+	}
+
+	return ps.SignPauseRequest(req)
+}
+
+func (g *Guard) checkScope(chainID, validatorAddress string) error {
+	if g.cfg.ChainID != "" && chainID != g.cfg.ChainID {
+		return fmt.Errorf("%w: chain ID %q", ErrOutOfScope, chainID)
+	}
+
+	if g.cfg.ValidatorAddress != "" && validatorAddress != g.cfg.ValidatorAddress {
+		return fmt.Errorf("%w: validator address %q", ErrOutOfScope, validatorAddress)
+	}
+
+	return nil
+}
+
+// allow takes a token from l, or returns an error wrapping ErrRateLimited.
+func allow(l *mekabuild.RateLimiter, what string) error {
+	if l == nil {
+		return nil
+	}
+	if ok, wait := l.Allow(); !ok {
+		return fmt.Errorf("%w: %s, retry in %s", ErrRateLimited, what, wait)
+	}
+	return nil
+}
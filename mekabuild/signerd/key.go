@@ -0,0 +1,71 @@
+package signerd
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+// KeySigner signs builder payloads with an ed25519 private key held in memory.
+type KeySigner struct {
+	Address    string
+	PrivateKey ed25519.PrivateKey
+}
+
+var (
+	_ mekabuild.Signer          = (*KeySigner)(nil)
+	_ mekabuild.ChallengeSigner = (*KeySigner)(nil)
+)
+
+// LoadPrivValidatorKey reads a Tendermint priv_validator_key.json file, which
+// must contain an ed25519 key.
+func LoadPrivValidatorKey(path string) (*KeySigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+
+	var f struct {
+		Address string `json:"address"`
+		PrivKey struct {
+			Type  string `json:"type"`
+			Value []byte `json:"value"`
+		} `json:"priv_key"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decode key file: %w", err)
+	}
+
+	if want, have := "tendermint/PrivKeyEd25519", f.PrivKey.Type; want != have {
+		return nil, fmt.Errorf("unsupported key type %q", have)
+	}
+
+	if want, have := ed25519.PrivateKeySize, len(f.PrivKey.Value); want != have {
+		return nil, fmt.Errorf("invalid key size %d", have)
+	}
+
+	return &KeySigner{Address: f.Address, PrivateKey: f.PrivKey.Value}, nil
+}
+
+// SignBuildBlockRequest implements mekabuild.Signer.
+func (k *KeySigner) SignBuildBlockRequest(req *mekabuild.BuildBlockRequest) error {
+	msg, err := req.SignBytes()
+	if err != nil {
+		return err
+	}
+	sig, err := k.PrivateKey.Sign(nil, msg, crypto.Hash(0))
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return nil
+}
+
+// SignChallenge implements mekabuild.ChallengeSigner.
+func (k *KeySigner) SignChallenge(challenge []byte) ([]byte, error) {
+	return k.PrivateKey.Sign(nil, mekabuild.ChallengeSignBytes(challenge), crypto.Hash(0))
+}
@@ -0,0 +1,233 @@
+// Package signerd implements a small signing daemon for the builder client.
+//
+// The daemon holds the validator key, or fronts a remote signer, and exposes
+// only the builder-specific signing operations over an authenticated local
+// socket. That lets the network-facing builder client run unprivileged, without
+// access to the key itself. Callers can only request signatures over
+// domain-separated builder payloads, never arbitrary bytes.
+package signerd
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+// Server is an http.Handler which signs builder payloads with the wrapped
+// signer. Every request must carry the configured bearer token.
+type Server struct {
+	signer mekabuild.Signer
+	token  string
+}
+
+// NewServer returns a server signing with s. If s also implements
+// mekabuild.ChallengeSigner, challenge signing is supported.
+func NewServer(s mekabuild.Signer, token string) (*Server, error) {
+	if token == "" {
+		return nil, errors.New("token is required")
+	}
+	return &Server{signer: s, token: token}, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	given := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	switch r.URL.Path {
+	case pathSignBuildBlockRequest:
+		var req mekabuild.BuildBlockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+			return
+		}
+
+		if err := s.signer.SignBuildBlockRequest(&req); err != nil {
+			writeError(w, signErrorCode(err), fmt.Errorf("sign build block request: %w", err))
+			return
+		}
+
+		json.NewEncoder(w).Encode(signResponse{Signature: req.Signature, Cosigners: req.Cosigners})
+
+	case pathSignChallenge:
+		cs, ok := s.signer.(mekabuild.ChallengeSigner)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, errors.New("challenge signing not supported"))
+			return
+		}
+
+		var req signChallengeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+			return
+		}
+
+		sig, err := cs.SignChallenge(req.Challenge)
+		if err != nil {
+			writeError(w, signErrorCode(err), fmt.Errorf("sign challenge: %w", err))
+			return
+		}
+
+		json.NewEncoder(w).Encode(signResponse{Signature: sig})
+
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown route %s", r.URL.Path))
+	}
+}
+
+//
+//
+//
+
+// Client is a mekabuild.Signer and mekabuild.ChallengeSigner which delegates
+// signing to a Server listening on a unix socket.
+type Client struct {
+	client  *http.Client
+	token   string
+	timeout int64 // atomic, nanoseconds
+}
+
+// DefaultClientTimeout bounds each request to the server. Signing happens
+// while proposing, so a hung server shouldn't block the builder for longer.
+const DefaultClientTimeout = 3 * time.Second
+
+var (
+	_ mekabuild.Signer          = (*Client)(nil)
+	_ mekabuild.ChallengeSigner = (*Client)(nil)
+)
+
+// NewClient returns a client of the server listening on the unix socket at
+// socketPath, authenticating with token.
+func NewClient(socketPath, token string) *Client {
+	var d net.Dialer
+	return &Client{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+		token:   token,
+		timeout: int64(DefaultClientTimeout),
+	}
+}
+
+// SetTimeout sets the timeout for each request to the server. The default is
+// DefaultClientTimeout.
+func (c *Client) SetTimeout(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("timeout must be positive, have %s", d)
+	}
+	atomic.StoreInt64(&c.timeout, int64(d))
+	return nil
+}
+
+// SignBuildBlockRequest implements mekabuild.Signer.
+func (c *Client) SignBuildBlockRequest(req *mekabuild.BuildBlockRequest) error {
+	resp, err := c.sign(pathSignBuildBlockRequest, req)
+	if err != nil {
+		return err
+	}
+	req.Signature, req.Cosigners = resp.Signature, resp.Cosigners
+	return nil
+}
+
+// SignChallenge implements mekabuild.ChallengeSigner.
+func (c *Client) SignChallenge(challenge []byte) ([]byte, error) {
+	resp, err := c.sign(pathSignChallenge, signChallengeRequest{Challenge: challenge})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
+
+func (c *Client) sign(path string, req interface{}) (*signResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(atomic.LoadInt64(&c.timeout)))
+	defer cancel()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://signerd"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	r.Header.Set("content-type", "application/json")
+	r.Header.Set("authorization", "Bearer "+c.token)
+
+	res, err := c.client.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	var resp signResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("response code %d (%s)", res.StatusCode, resp.Error)
+	}
+
+	return &resp, nil
+}
+
+//
+//
+//
+
+const (
+	pathSignBuildBlockRequest = "/v0/sign-build-block-request"
+	pathSignChallenge         = "/v0/sign-challenge"
+)
+
+type signChallengeRequest struct {
+	Challenge []byte `json:"challenge"`
+}
+
+type signResponse struct {
+	Signature []byte                 `json:"signature,omitempty"`
+	Cosigners *mekabuild.CosignerSet `json:"cosigners,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+func signErrorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrOutOfScope):
+		return http.StatusForbidden
+	case errors.Is(err, ErrRateLimited), errors.Is(err, mekabuild.ErrSigningRateLimited):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(signResponse{Error: err.Error()})
+}
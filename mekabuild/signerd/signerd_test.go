@@ -0,0 +1,183 @@
+package signerd_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+	"github.com/meka-dev/mekatek-go/mekabuild/signerd"
+)
+
+func TestClientServer(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := signerd.NewServer(&signerd.KeySigner{Address: "ADDR", PrivateKey: private}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "signerd.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &http.Server{Handler: server}
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+
+	req := &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: "ADDR", Txs: [][]byte{[]byte("tx")}}
+	if err := signerd.NewClient(socket, "secret").SignBuildBlockRequest(req); err != nil {
+		t.Fatalf("sign build block request: %v", err)
+	}
+
+	msg := mekabuild.BuildBlockRequestSignBytes(req.ChainID, req.Height, req.ValidatorAddress, req.MaxBytes, req.MaxGas, mekabuild.HashTxs(req.Txs...))
+	if !ed25519.Verify(public, msg, req.Signature) {
+		t.Errorf("build block request signature doesn't verify")
+	}
+
+	sig, err := signerd.NewClient(socket, "secret").SignChallenge([]byte("challenge"))
+	if err != nil {
+		t.Fatalf("sign challenge: %v", err)
+	}
+
+	if !ed25519.Verify(public, mekabuild.ChallengeSignBytes([]byte("challenge")), sig) {
+		t.Errorf("challenge signature doesn't verify")
+	}
+
+	if _, err := signerd.NewClient(socket, "wrong").SignChallenge([]byte("challenge")); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("wrong token: want 401 error, have %v", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "signerd.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hung := make(chan struct{})
+	s := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-hung })}
+	go s.Serve(ln)
+	t.Cleanup(func() { close(hung); s.Close() })
+
+	client := signerd.NewClient(socket, "secret")
+	if err := client.SetTimeout(0); err == nil {
+		t.Errorf("zero timeout: want error, have none")
+	}
+	if err := client.SetTimeout(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	begin := time.Now()
+	if _, err := client.SignChallenge([]byte("challenge")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("hung server: want %v, have %v", context.DeadlineExceeded, err)
+	}
+	if took := time.Since(begin); took > 5*time.Second {
+		t.Errorf("hung server: took %s", took)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guard, err := signerd.NewGuard(&mockSigner{KeySigner: signerd.KeySigner{Address: "ADDR", PrivateKey: private}}, signerd.GuardConfig{
+		ChainID:          "chain-id",
+		ValidatorAddress: "ADDR",
+		Limits: mekabuild.SigningLimits{
+			BuildRequestsPerMinute: 2,
+			ChallengesPerMinute:    1,
+			PresignsPerMinute:      1,
+			ConfirmationsPerMinute: 1,
+			PausesPerMinute:        1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, req := range []*mekabuild.BuildBlockRequest{
+		{ChainID: "other-chain", ValidatorAddress: "ADDR"},
+		{ChainID: "chain-id", ValidatorAddress: "OTHER"},
+	} {
+		if err := guard.SignBuildBlockRequest(req); !errors.Is(err, signerd.ErrOutOfScope) {
+			t.Errorf("%s/%s: want %v, have %v", req.ChainID, req.ValidatorAddress, signerd.ErrOutOfScope, err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := guard.SignBuildBlockRequest(&mekabuild.BuildBlockRequest{ChainID: "chain-id", ValidatorAddress: "ADDR"}); err != nil {
+			t.Fatalf("build request %d: %v", i+1, err)
+		}
+	}
+
+	if err := guard.SignBuildBlockRequest(&mekabuild.BuildBlockRequest{ChainID: "chain-id", ValidatorAddress: "ADDR"}); !errors.Is(err, signerd.ErrRateLimited) {
+		t.Errorf("build request 3: want %v, have %v", signerd.ErrRateLimited, err)
+	}
+
+	if _, err := guard.SignChallenge([]byte("challenge")); err != nil {
+		t.Fatalf("challenge 1: %v", err)
+	}
+
+	if _, err := guard.SignChallenge([]byte("challenge")); !errors.Is(err, signerd.ErrRateLimited) {
+		t.Errorf("challenge 2: want %v, have %v", signerd.ErrRateLimited, err)
+	}
+
+	for name, sign := range map[string]func(chainID string) error{
+		"presign": func(chainID string) error {
+			return guard.SignPresignRequest(&mekabuild.PresignRequest{ChainID: chainID, ValidatorAddress: "ADDR"})
+		},
+		"confirm": func(chainID string) error {
+			return guard.SignConfirmRequest(&mekabuild.ConfirmRequest{ChainID: chainID, ValidatorAddress: "ADDR"})
+		},
+		"pause": func(chainID string) error {
+			return guard.SignPauseRequest(&mekabuild.PauseRequest{ChainID: chainID, ValidatorAddress: "ADDR"})
+		},
+	} {
+		if err := sign("other-chain"); !errors.Is(err, signerd.ErrOutOfScope) {
+			t.Errorf("%s other chain: want %v, have %v", name, signerd.ErrOutOfScope, err)
+		}
+		if err := sign("chain-id"); err != nil {
+			t.Errorf("%s 1: %v", name, err)
+		}
+		if err := sign("chain-id"); !errors.Is(err, signerd.ErrRateLimited) {
+			t.Errorf("%s 2: want %v, have %v", name, signerd.ErrRateLimited, err)
+		}
+	}
+
+	unsupported, err := signerd.NewGuard(&signerd.KeySigner{Address: "ADDR", PrivateKey: private}, signerd.GuardConfig{Limits: mekabuild.DefaultSigningLimits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unsupported.SignPauseRequest(&mekabuild.PauseRequest{ChainID: "chain-id", ValidatorAddress: "ADDR"}); err == nil {
+		t.Errorf("pause with unsupported signer: want error, have none")
+	}
+
+	if _, err := signerd.NewGuard(&mockSigner{}, signerd.GuardConfig{Limits: mekabuild.SigningLimits{PausesPerMinute: -1}}); err == nil {
+		t.Errorf("negative limit: want error, have none")
+	}
+}
+
+// mockSigner adds no-op presign, confirm and pause signing to a KeySigner.
+type mockSigner struct {
+	signerd.KeySigner
+}
+
+func (s *mockSigner) SignPresignRequest(req *mekabuild.PresignRequest) error { return nil }
+func (s *mockSigner) SignConfirmRequest(req *mekabuild.ConfirmRequest) error { return nil }
+func (s *mockSigner) SignPauseRequest(req *mekabuild.PauseRequest) error     { return nil }
@@ -0,0 +1,114 @@
+package mekabuild
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SigningLimits caps the rate of each kind of signature made by the signer
+// adapters of this package, RemoteSigner and KMSSigner, so a compromised
+// builder client or endpoint can't induce the key to sign excessive material.
+// Zero means unlimited.
+type SigningLimits struct {
+	BuildRequestsPerMinute int
+	ChallengesPerMinute    int
+	PresignsPerMinute      int
+	ConfirmationsPerMinute int
+	PausesPerMinute        int
+}
+
+// DefaultSigningLimits allows several build requests, presignatures and
+// confirmations per block at typical block times, which leaves room for
+// retries, but not much more. Challenges and pauses are rare.
+var DefaultSigningLimits = SigningLimits{
+	BuildRequestsPerMinute: 120,
+	ChallengesPerMinute:    6,
+	PresignsPerMinute:      120,
+	ConfirmationsPerMinute: 120,
+	PausesPerMinute:        6,
+}
+
+// ErrSigningRateLimited is returned by the signer adapters of this package
+// when a signature would exceed their SigningLimits.
+var ErrSigningRateLimited = errors.New("signing rate limit exceeded")
+
+// signKind is a kind of signature, limited separately.
+type signKind int
+
+const (
+	signBuildRequest signKind = iota
+	signChallenge
+	signPresign
+	signConfirmation
+	signPause
+)
+
+var signKindNames = map[signKind]string{
+	signBuildRequest: "build requests",
+	signChallenge:    "challenges",
+	signPresign:      "presignatures",
+	signConfirmation: "confirmations",
+	signPause:        "pauses",
+}
+
+// signingGuard enforces SigningLimits. It's safe for concurrent use.
+type signingGuard struct {
+	mtx      sync.Mutex
+	limiters map[signKind]*RateLimiter // nil means unlimited
+}
+
+func newSigningGuard() *signingGuard {
+	g := &signingGuard{}
+	if err := g.setLimits(DefaultSigningLimits); err != nil {
+		panic(err)
+	}
+	return g
+}
+
+func (g *signingGuard) setLimits(l SigningLimits) error {
+	limits := map[signKind]int{
+		signBuildRequest: l.BuildRequestsPerMinute,
+		signChallenge:    l.ChallengesPerMinute,
+		signPresign:      l.PresignsPerMinute,
+		signConfirmation: l.ConfirmationsPerMinute,
+		signPause:        l.PausesPerMinute,
+	}
+
+	limiters := make(map[signKind]*RateLimiter, len(limits))
+	for kind, n := range limits {
+		if n < 0 {
+			return fmt.Errorf("%s per minute must not be negative, have %d", signKindNames[kind], n)
+		}
+		if n == 0 {
+			continue
+		}
+		l, err := NewRateLimiter(float64(n)/time.Minute.Seconds(), n)
+		if err != nil {
+			return err
+		}
+		limiters[kind] = l
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.limiters = limiters
+	return nil
+}
+
+// allow takes a token for a signature of the given kind, or returns an error
+// wrapping ErrSigningRateLimited.
+func (g *signingGuard) allow(kind signKind) error {
+	g.mtx.Lock()
+	l := g.limiters[kind]
+	g.mtx.Unlock()
+
+	if l == nil {
+		return nil
+	}
+	if ok, wait := l.allow(time.Now()); !ok {
+		return fmt.Errorf("%w: %s, retry in %s", ErrSigningRateLimited, signKindNames[kind], wait)
+	}
+	return nil
+}
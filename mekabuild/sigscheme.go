@@ -0,0 +1,109 @@
+package mekabuild
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SignatureScheme describes how a request signature is transmitted from the
+// builder client to the builder API.
+type SignatureScheme int32
+
+const (
+	// SignatureSchemeBody sends the signature in the request body, as the
+	// Signature field of e.g. BuildBlockRequest. This is the default.
+	SignatureSchemeBody SignatureScheme = iota
+
+	// SignatureSchemeHeader sends the signature and validator address as
+	// HTTP headers only, as expected by older and self-hosted endpoints.
+	SignatureSchemeHeader
+
+	// SignatureSchemeBoth sends the signature in the body and the headers.
+	// It's intended for migrations between the two schemes.
+	SignatureSchemeBoth
+)
+
+func (s SignatureScheme) body() bool { return s == SignatureSchemeBody || s == SignatureSchemeBoth }
+
+func (s SignatureScheme) header() bool { return s == SignatureSchemeHeader || s == SignatureSchemeBoth }
+
+const (
+	// ProposerAddressHeader carries the validator address in the header
+	// signature scheme.
+	ProposerAddressHeader = "mekatek-proposer-address"
+
+	// RequestSignatureHeader carries the base64 encoded request signature
+	// in the header signature scheme.
+	RequestSignatureHeader = "mekatek-request-signature"
+)
+
+func setSignatureHeaders(hdr http.Header, validatorAddr string, signature []byte) {
+	hdr.Set(ProposerAddressHeader, validatorAddr)
+	hdr.Set(RequestSignatureHeader, base64.StdEncoding.EncodeToString(signature))
+}
+
+// SignatureHeaderMiddleware allows servers to accept build requests signed
+// with either signature scheme. If the request carries signature headers and
+// the JSON body has no signature, the signature (and, if missing, the
+// validator address) from the headers is moved into the body, so downstream
+// handlers only need to support SignatureSchemeBody.
+//
+// SignatureHeaderMiddleware expects uncompressed request bodies, and so should
+// be installed inside GunzipRequestMiddleware.
+func SignatureHeaderMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sigHeader := r.Header.Get(RequestSignatureHeader)
+		if sigHeader == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(sigHeader)
+		if err != nil {
+			http.Error(w, fmt.Errorf("decode signature header: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Errorf("read request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			http.Error(w, fmt.Errorf("decode request: %w", err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		if isEmptyJSON(fields["signature"]) {
+			fields["signature"], _ = json.Marshal(sig)
+		}
+
+		if addr := r.Header.Get(ProposerAddressHeader); addr != "" && isEmptyJSON(fields["validator_address"]) {
+			fields["validator_address"], _ = json.Marshal(addr)
+		}
+
+		if body, err = json.Marshal(fields); err != nil {
+			http.Error(w, fmt.Errorf("encode request: %w", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		h.ServeHTTP(w, r)
+	})
+}
+
+func isEmptyJSON(m json.RawMessage) bool {
+	switch string(bytes.TrimSpace(m)) {
+	case "", "null", `""`:
+		return true
+	default:
+		return false
+	}
+}
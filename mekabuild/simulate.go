@@ -0,0 +1,169 @@
+package mekabuild
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StoreNamespaceSimulations holds simulation results recorded by a Simulator.
+const StoreNamespaceSimulations = "simulations"
+
+// SimulationResult compares the block the builder API would have produced for
+// a height with the block the validator assembled locally.
+type SimulationResult struct {
+	Time     time.Time     `json:"time"`
+	ChainID  string        `json:"chain_id"`
+	Height   int64         `json:"height"`
+	Duration time.Duration `json:"duration"`
+
+	LocalTxs   int   `json:"local_txs"`
+	LocalBytes int64 `json:"local_bytes"`
+
+	BuilderTxs   int    `json:"builder_txs,omitempty"`
+	BuilderBytes int64  `json:"builder_bytes,omitempty"`
+	Payment      string `json:"payment,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// SimulationSummary aggregates simulation results.
+type SimulationSummary struct {
+	Heights   int `json:"heights"`
+	Successes int `json:"successes"`
+	Failures  int `json:"failures"`
+
+	// PaidHeights counts successful simulations where the builder offered a
+	// payment, i.e. where proposing the builder's block would have earned
+	// revenue in excess of the locally assembled block.
+	PaidHeights int `json:"paid_heights"`
+
+	// Payments counts offered payments, keyed by payment string.
+	Payments map[string]int `json:"payments,omitempty"`
+}
+
+// Simulator runs build requests against the builder API in simulation mode.
+// The resulting blocks are never proposed; they're compared with the block
+// assembled locally, so prospective users can quantify expected revenue
+// before relying on the builder.
+//
+// Simulation requests bypass the builder's response cache and fallback.
+type Simulator struct {
+	builder *Builder
+	local   Fallback
+	limit   int
+
+	mtx     sync.Mutex
+	results []SimulationResult
+}
+
+// DefaultSimulationResults is the number of results retained in memory by a
+// simulator, unless configured otherwise.
+const DefaultSimulationResults = 1000
+
+// NewSimulator returns a simulator that sends requests via b, and assembles
+// local blocks via local. A nil local is equivalent to NewMempoolFallback(nil).
+// The most recent limit results are retained in memory; a limit of zero means
+// DefaultSimulationResults. If the builder has a store, every result is also
+// persisted to StoreNamespaceSimulations.
+func NewSimulator(b *Builder, local Fallback, limit int) *Simulator {
+	if local == nil {
+		local = NewMempoolFallback(nil)
+	}
+	if limit <= 0 {
+		limit = DefaultSimulationResults
+	}
+	return &Simulator{builder: b, local: local, limit: limit}
+}
+
+// Simulate requests a block for the given height, and compares it with the
+// locally assembled block. The request isn't modified. Simulate blocks until
+// the builder API responds, so integrations should typically call it in a
+// separate goroutine, and never wait on it while proposing.
+func (s *Simulator) Simulate(ctx context.Context, req *BuildBlockRequest) SimulationResult {
+	res := SimulationResult{
+		Time:    s.builder.now().UTC(),
+		ChainID: req.ChainID,
+		Height:  req.Height,
+	}
+
+	if local, err := s.local.AssembleBlock(req, nil); err == nil && local != nil {
+		res.LocalTxs, res.LocalBytes = len(local.Txs), txsSize(local.Txs)
+	}
+
+	sreq := *req
+	resp, err := s.builder.buildBlock(ctx, &sreq)
+	res.Duration = s.builder.since(res.Time)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.BuilderTxs, res.BuilderBytes = len(resp.Txs), txsSize(resp.Txs)
+		res.Payment = resp.ValidatorPayment
+	}
+
+	s.record(res)
+	return res
+}
+
+// Results returns the retained simulation results, oldest first.
+func (s *Simulator) Results() []SimulationResult {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]SimulationResult(nil), s.results...)
+}
+
+// Summary aggregates the retained simulation results.
+func (s *Simulator) Summary() SimulationSummary {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	sum := SimulationSummary{Heights: len(s.results), Payments: map[string]int{}}
+	for _, res := range s.results {
+		switch {
+		case res.Error != "":
+			sum.Failures++
+		case res.Payment != "":
+			sum.Successes++
+			sum.PaidHeights++
+			sum.Payments[res.Payment]++
+		default:
+			sum.Successes++
+		}
+	}
+	return sum
+}
+
+func (s *Simulator) record(res SimulationResult) {
+	s.mtx.Lock()
+	s.results = append(s.results, res)
+	if n := len(s.results); n > s.limit {
+		s.results = append(s.results[:0], s.results[n-s.limit:]...)
+	}
+	s.mtx.Unlock()
+
+	if store := s.builder.getStore(); store != nil {
+		if err := putSimulationResult(store, res); err != nil {
+			s.builder.getLogger().Errorf("record simulation failed: chain_id=%s height=%d err=%v", res.ChainID, res.Height, err)
+		}
+	}
+
+	s.builder.getLogger().Infof("simulation: chain_id=%s height=%d took=%s local_txs=%d builder_txs=%d payment=%q err=%q", res.ChainID, res.Height, res.Duration, res.LocalTxs, res.BuilderTxs, res.Payment, res.Error)
+}
+
+func putSimulationResult(s Store, res SimulationResult) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s-%020d-%d", res.ChainID, res.Height, res.Time.UnixNano())
+	return s.Put(StoreNamespaceSimulations, key, data)
+}
+
+func txsSize(txs [][]byte) int64 {
+	var n int64
+	for _, tx := range txs {
+		n += int64(len(tx))
+	}
+	return n
+}
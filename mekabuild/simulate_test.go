@@ -0,0 +1,71 @@
+package mekabuild_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestSimulator(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "chain-id"
+		key       = newMockKey(t, "validator", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		store     = mekabuild.NewMemoryStore()
+		simulator = mekabuild.NewSimulator(builder, nil, 2)
+		txs       = [][]byte{[]byte("tx1"), []byte("tx2")}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	if err := builder.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+
+	for height := int64(1); height <= 3; height++ {
+		req := &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, Txs: txs}
+		res := simulator.Simulate(ctx, req)
+		if res.Error != "" {
+			t.Fatalf("height %d: %s", height, res.Error)
+		}
+
+		if req.Signature != nil {
+			t.Errorf("height %d: request was modified", height)
+		}
+
+		if want, have := 2, res.LocalTxs; want != have {
+			t.Errorf("height %d: local txs: want %d, have %d", height, want, have)
+		}
+	}
+
+	results := simulator.Results()
+	if want, have := 2, len(results); want != have {
+		t.Fatalf("retained results: want %d, have %d", want, have)
+	}
+
+	if want, have := int64(2), results[0].Height; want != have {
+		t.Errorf("oldest retained height: want %d, have %d", want, have)
+	}
+
+	sum := simulator.Summary()
+	if want, have := 2, sum.Successes; want != have {
+		t.Errorf("successes: want %d, have %d", want, have)
+	}
+
+	if want, have := 2, sum.PaidHeights; want != have {
+		t.Errorf("paid heights: want %d, have %d", want, have)
+	}
+
+	if want, have := 3, len(store.Keys(mekabuild.StoreNamespaceSimulations)); want != have {
+		t.Errorf("persisted results: want %d, have %d", want, have)
+	}
+}
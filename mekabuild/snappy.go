@@ -0,0 +1,263 @@
+package mekabuild
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SnappyCompressor compresses request bodies with the snappy block format,
+// i.e. a varint of the decompressed length followed by the compressed blocks,
+// as described in https://github.com/google/snappy/blob/main/format_description.txt.
+// It trades compression ratio for very fast encoding. The format is encoded
+// and decoded by hand, to keep this package free of dependencies.
+var SnappyCompressor Compressor = snappyCompressor{}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Encoding() string         { return "snappy" }
+func (snappyCompressor) Capability() Capabilities { return CapabilitySnappy }
+
+// NewWriter buffers the whole body, since the block format starts with its
+// decompressed length, and compresses it on Close.
+func (snappyCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return &snappyWriter{w: w, buf: getBuffer()}, nil
+}
+
+// NewReader decompresses the whole body up front. Bodies which decompress to
+// more than DefaultMaxDecompressedBytes are rejected.
+func (snappyCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	src, err := io.ReadAll(io.LimitReader(r, snappyMaxEncodedLen(DefaultMaxDecompressedBytes)+1))
+	if err != nil {
+		return nil, err
+	}
+	dst, err := snappyDecode(src, DefaultMaxDecompressedBytes)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(dst)), nil
+}
+
+type snappyWriter struct {
+	w   io.Writer
+	buf *bytes.Buffer
+}
+
+func (sw *snappyWriter) Write(p []byte) (int, error) {
+	if sw.buf == nil {
+		return 0, errors.New("snappy: write after close")
+	}
+	return sw.buf.Write(p)
+}
+
+func (sw *snappyWriter) Close() error {
+	if sw.buf == nil {
+		return nil
+	}
+	defer func() { putBuffer(sw.buf); sw.buf = nil }()
+
+	dst := getBuffer()
+	defer putBuffer(dst)
+	dst.Grow(int(snappyMaxEncodedLen(int64(sw.buf.Len()))))
+
+	_, err := sw.w.Write(snappyEncode(dst.Bytes()[:0], sw.buf.Bytes()))
+	return err
+}
+
+const (
+	snappyMaxBlockSize = 1 << 16
+	snappyMinMatch     = 4
+	snappyTableBits    = 14
+
+	snappyTagLiteral = 0
+	snappyTagCopy1   = 1
+	snappyTagCopy2   = 2
+	snappyTagCopy4   = 3
+)
+
+var (
+	errSnappyCorrupt  = errors.New("snappy: corrupt input")
+	errSnappyTooLarge = errors.New("snappy: decompressed length too large")
+)
+
+// snappyMaxEncodedLen bounds the encoded length of n bytes.
+func snappyMaxEncodedLen(n int64) int64 {
+	return 32 + n + n/6
+}
+
+// snappyEncode appends the encoding of src to dst.
+func snappyEncode(dst, src []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	dst = append(dst, buf[:binary.PutUvarint(buf[:], uint64(len(src)))]...)
+
+	for len(src) > 0 {
+		block := src
+		if len(block) > snappyMaxBlockSize {
+			block = block[:snappyMaxBlockSize]
+		}
+		src = src[len(block):]
+		dst = snappyEncodeBlock(dst, block)
+	}
+	return dst
+}
+
+// snappyEncodeBlock appends the encoding of a block of at most
+// snappyMaxBlockSize bytes to dst, so that every copy offset fits in 2 bytes.
+func snappyEncodeBlock(dst, src []byte) []byte {
+	var (
+		table [1 << snappyTableBits]int32 // position+1 of the last occurrence of a hash
+		lit   int                         // start of the pending literal
+	)
+	for i := 0; i+snappyMinMatch <= len(src); {
+		h := snappyHash(binary.LittleEndian.Uint32(src[i:]))
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != binary.LittleEndian.Uint32(src[i:]) {
+			i += 1 + (i-lit)>>5 // skip faster through incompressible data
+			continue
+		}
+
+		end := i + snappyMinMatch
+		for end < len(src) && src[end] == src[candidate+end-i] {
+			end++
+		}
+
+		dst = snappyEmitLiteral(dst, src[lit:i])
+		dst = snappyEmitCopy(dst, i-candidate, end-i)
+		i, lit = end, end
+	}
+	return snappyEmitLiteral(dst, src[lit:])
+}
+
+func snappyHash(u uint32) uint32 {
+	return (u * 0x1e35a7bd) >> (32 - snappyTableBits)
+}
+
+func snappyEmitLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	switch n := uint32(len(lit) - 1); {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|snappyTagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|snappyTagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|snappyTagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// snappyEmitCopy appends copies of length bytes, at least snappyMinMatch, from
+// offset bytes back.
+func snappyEmitCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length >= 12 || offset >= 2048 {
+		return append(dst, byte(length-1)<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|snappyTagCopy1, byte(offset))
+}
+
+// snappyMaxDecodedLen bounds the decoded length of n encoded bytes. The
+// densest element is a 3 byte copy of 64 bytes.
+func snappyMaxDecodedLen(n int) uint64 {
+	return uint64(n) * 64 / 3
+}
+
+// snappyDecode returns the decoding of src, or an error if it's malformed, or
+// decompresses to more than maxLen bytes.
+func snappyDecode(src []byte, maxLen int64) ([]byte, error) {
+	n, k := binary.Uvarint(src)
+	if k <= 0 {
+		return nil, errSnappyCorrupt
+	}
+	if n > uint64(maxLen) {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", errSnappyTooLarge, n, maxLen)
+	}
+	if n > snappyMaxDecodedLen(len(src)-k) {
+		return nil, errSnappyCorrupt // the header is sender controlled, don't allocate by it
+	}
+
+	dst := make([]byte, 0, n)
+	for s := src[k:]; len(s) > 0; {
+		var offset, length int
+
+		switch tag := s[0]; tag & 3 {
+		case snappyTagLiteral:
+			size := uint64(tag >> 2)
+			s = s[1:]
+			if size >= 60 {
+				nb := int(size) - 59
+				if len(s) < nb {
+					return nil, errSnappyCorrupt
+				}
+				size = 0
+				for i := nb - 1; i >= 0; i-- {
+					size = size<<8 | uint64(s[i])
+				}
+				s = s[nb:]
+			}
+			size++
+			if size > uint64(len(s)) || size > n-uint64(len(dst)) {
+				return nil, errSnappyCorrupt
+			}
+			dst = append(dst, s[:size]...)
+			s = s[size:]
+			continue
+
+		case snappyTagCopy1:
+			if len(s) < 2 {
+				return nil, errSnappyCorrupt
+			}
+			length = 4 + int(tag>>2&7)
+			offset = int(tag&0xe0)<<3 | int(s[1])
+			s = s[2:]
+
+		case snappyTagCopy2:
+			if len(s) < 3 {
+				return nil, errSnappyCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(s[1:]))
+			s = s[3:]
+
+		case snappyTagCopy4:
+			if len(s) < 5 {
+				return nil, errSnappyCorrupt
+			}
+			length = 1 + int(tag>>2)
+			o := binary.LittleEndian.Uint32(s[1:])
+			if uint64(o) > uint64(len(dst)) {
+				return nil, errSnappyCorrupt
+			}
+			offset = int(o)
+			s = s[5:]
+		}
+
+		if offset <= 0 || offset > len(dst) || uint64(length) > n-uint64(len(dst)) {
+			return nil, errSnappyCorrupt
+		}
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+
+	if uint64(len(dst)) != n {
+		return nil, errSnappyCorrupt
+	}
+	return dst, nil
+}
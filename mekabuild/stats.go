@@ -0,0 +1,219 @@
+package mekabuild
+
+import (
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets returns the upper bounds of the latency histogram maintained
+// for each builder API endpoint, which telemetry reports share. Observations
+// greater than the last bound are counted in an implicit overflow bucket.
+func LatencyBuckets() []time.Duration {
+	return append([]time.Duration(nil), latencyBuckets...)
+}
+
+var latencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// EndpointStats summarizes the requests made by a builder to a single builder
+// API endpoint.
+type EndpointStats struct {
+	Endpoint     string        `json:"endpoint"`
+	Successes    uint64        `json:"successes"`
+	Failures     uint64        `json:"failures"`
+	TotalLatency time.Duration `json:"total_latency"`
+
+	// RTT is the most recently observed network round-trip time to the
+	// endpoint, measured as the duration of the TCP handshake.
+	RTT time.Duration `json:"rtt"`
+
+	// LastFailure is the time of the most recent request that failed with a
+	// connection error or 5xx response, or zero. Other failures, e.g. 4xx
+	// responses, don't cause a failover, and don't set it.
+	LastFailure time.Time `json:"last_failure"`
+
+	// Latency counts requests per latency bucket. Latency[i] counts requests
+	// that took at most LatencyBuckets()[i], and more than the previous
+	// bound.
+	// The final element counts requests slower than every bucket.
+	Latency []uint64 `json:"latency"`
+}
+
+// Requests returns the total number of requests made to the endpoint.
+func (s EndpointStats) Requests() uint64 {
+	return s.Successes + s.Failures
+}
+
+// SuccessRate returns the fraction of requests to the endpoint that succeeded.
+// Endpoints without any requests have a success rate of 1.
+func (s EndpointStats) SuccessRate() float64 {
+	if s.Requests() == 0 {
+		return 1
+	}
+	return float64(s.Successes) / float64(s.Requests())
+}
+
+// MeanLatency returns the mean latency of requests to the endpoint.
+func (s EndpointStats) MeanLatency() time.Duration {
+	if s.Requests() == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Requests())
+}
+
+// EndpointStats returns statistics for every endpoint the builder has made
+// requests to, ranked from best to worst: by success rate, and then by mean
+// latency.
+func (b *Builder) EndpointStats() []EndpointStats {
+	return b.stats.ranked()
+}
+
+//
+//
+//
+
+type statsRegistry struct {
+	mtx       sync.Mutex
+	endpoints map[string]*EndpointStats
+}
+
+func newStatsRegistry() *statsRegistry {
+	return &statsRegistry{
+		endpoints: map[string]*EndpointStats{},
+	}
+}
+
+func (r *statsRegistry) get(endpoint string) *EndpointStats {
+	s, ok := r.endpoints[endpoint]
+	if !ok {
+		s = &EndpointStats{Endpoint: endpoint, Latency: make([]uint64, len(latencyBuckets)+1)}
+		r.endpoints[endpoint] = s
+	}
+	return s
+}
+
+// observe records a request to the endpoint. Only failures that should fail
+// over to the next endpoint, i.e. that aren't the request's or the caller's
+// fault, set LastFailure.
+func (r *statsRegistry) observe(endpoint string, took time.Duration, err error, failover bool, now time.Time) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	s := r.get(endpoint)
+	switch {
+	case err == nil:
+		s.Successes++
+	case failover:
+		s.Failures++
+		s.LastFailure = now
+	default:
+		s.Failures++
+	}
+
+	s.TotalLatency += took
+	s.Latency[sort.Search(len(latencyBuckets), func(i int) bool { return took <= latencyBuckets[i] })]++
+}
+
+func (r *statsRegistry) observeRTT(endpoint string, rtt time.Duration) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.get(endpoint).RTT = rtt
+}
+
+func (r *statsRegistry) rtt(endpoint string) time.Duration {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if s, ok := r.endpoints[endpoint]; ok {
+		return s.RTT
+	}
+	return 0
+}
+
+func (r *statsRegistry) merge(stats []EndpointStats) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, prev := range stats {
+		s := r.get(prev.Endpoint)
+		s.Successes += prev.Successes
+		s.Failures += prev.Failures
+		s.TotalLatency += prev.TotalLatency
+		if s.RTT == 0 {
+			s.RTT = prev.RTT
+		}
+		if prev.LastFailure.After(s.LastFailure) {
+			s.LastFailure = prev.LastFailure
+		}
+		for i := range s.Latency {
+			if i < len(prev.Latency) {
+				s.Latency[i] += prev.Latency[i]
+			}
+		}
+	}
+}
+
+func (r *statsRegistry) lastFailure(endpoint string) time.Time {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if s, ok := r.endpoints[endpoint]; ok {
+		return s.LastFailure
+	}
+	return time.Time{}
+}
+
+func (r *statsRegistry) lookup(endpoint string) (EndpointStats, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	s, ok := r.endpoints[endpoint]
+	if !ok || s.Requests() == 0 {
+		return EndpointStats{}, false
+	}
+	c := *s
+	c.Latency = append([]uint64(nil), s.Latency...)
+	return c, true
+}
+
+func (r *statsRegistry) ranked() []EndpointStats {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	res := make([]EndpointStats, 0, len(r.endpoints))
+	for _, s := range r.endpoints {
+		c := *s
+		c.Latency = append([]uint64(nil), s.Latency...)
+		res = append(res, c)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return betterEndpoint(res[i], res[j]) })
+
+	return res
+}
+
+func betterEndpoint(a, b EndpointStats) bool {
+	if ar, br := a.SuccessRate(), b.SuccessRate(); ar != br {
+		return ar > br
+	}
+	if al, bl := a.MeanLatency(), b.MeanLatency(); al != bl {
+		return al < bl
+	}
+	return a.Endpoint < b.Endpoint
+}
+
+func endpointName(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,232 @@
+package mekabuild
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store persists state on behalf of the builder client, e.g. endpoint
+// statistics and audit records. Values are grouped into namespaces. Embedders
+// with their own database can provide their own implementation.
+//
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the value for key in namespace ns, or ErrNotFound.
+	Get(ns, key string) ([]byte, error)
+
+	// Put sets the value for key in namespace ns.
+	Put(ns, key string, value []byte) error
+
+	// Delete removes key from namespace ns. Deleting a key that doesn't
+	// exist isn't an error.
+	Delete(ns, key string) error
+}
+
+// ErrNotFound is returned by a Store when a key doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// Namespaces used by the builder client.
+const (
+	StoreNamespaceStats = "stats"
+	StoreNamespaceAudit = "audit"
+	StoreNamespacePeers = "peers"
+)
+
+//
+//
+//
+
+// MemoryStore is an in-memory Store.
+type MemoryStore struct {
+	mtx    sync.Mutex
+	values map[string]map[string][]byte
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: map[string]map[string][]byte{}}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(ns, key string) ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	v, ok := s.values[ns][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(ns, key string, value []byte) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.values[ns] == nil {
+		s.values[ns] = map[string][]byte{}
+	}
+	s.values[ns][key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(ns, key string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	delete(s.values[ns], key)
+	return nil
+}
+
+// Keys returns the keys in namespace ns, in no particular order.
+func (s *MemoryStore) Keys(ns string) []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	keys := make([]string, 0, len(s.values[ns]))
+	for k := range s.values[ns] {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+//
+//
+//
+
+// FileStore is a Store which keeps each value in a separate file, at
+// dir/namespace/key. If a sealer is provided, values are encrypted at rest.
+type FileStore struct {
+	dir    string
+	sealer *Sealer
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore returns a file store rooted at dir, which is created if it
+// doesn't exist. The sealer may be nil, in which case values are stored in
+// plaintext.
+func NewFileStore(dir string, sealer *Sealer) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create store directory: %w", err)
+	}
+	return &FileStore{dir: dir, sealer: sealer}, nil
+}
+
+// Get implements Store.
+func (s *FileStore) Get(ns, key string) ([]byte, error) {
+	path, err := s.path(ns, key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read value: %w", err)
+	}
+
+	if s.sealer != nil {
+		if data, err = s.sealer.Open(data); err != nil {
+			return nil, fmt.Errorf("open value: %w", err)
+		}
+	}
+
+	return data, nil
+}
+
+// Put implements Store. Values are written atomically.
+func (s *FileStore) Put(ns, key string, value []byte) error {
+	path, err := s.path(ns, key)
+	if err != nil {
+		return err
+	}
+
+	if s.sealer != nil {
+		if value, err = s.sealer.Seal(value); err != nil {
+			return fmt.Errorf("seal value: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create namespace directory: %w", err)
+	}
+
+	// Each write gets its own temporary file, so concurrent writes of a key
+	// can't interleave, and the last rename wins.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write value: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write value: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename value: %w", err)
+	}
+
+	return nil
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(ns, key string) error {
+	path, err := s.path(ns, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove value: %w", err)
+	}
+
+	return nil
+}
+
+// Keys returns the keys in namespace ns, in no particular order. Keys of
+// unreadable namespaces are omitted.
+func (s *FileStore) Keys(ns string) []string {
+	dir, err := s.path(ns, "keys")
+	if err != nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(dir))
+	if err != nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasSuffix(e.Name(), ".tmp") {
+			keys = append(keys, e.Name())
+		}
+	}
+	return keys
+}
+
+func (s *FileStore) path(ns, key string) (string, error) {
+	for _, name := range []string{ns, key} {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, ".tmp") {
+			return "", fmt.Errorf("invalid store name %q", name)
+		}
+	}
+	return filepath.Join(s.dir, ns, key), nil
+}
@@ -0,0 +1,157 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestFileStore(t *testing.T) {
+	sealer, err := mekabuild.NewSealer(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []*mekabuild.Sealer{nil, sealer} {
+		store, err := mekabuild.NewFileStore(t.TempDir(), s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testStore(t, store)
+
+		if err := store.Put("ns", "key", []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+		if want, have := []string{"key"}, store.Keys("ns"); len(have) != 1 || have[0] != want[0] {
+			t.Errorf("keys: want %v, have %v", want, have)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, mekabuild.NewMemoryStore())
+}
+
+func testStore(t *testing.T, store mekabuild.Store) {
+	t.Helper()
+
+	if _, err := store.Get("ns", "key"); !errors.Is(err, mekabuild.ErrNotFound) {
+		t.Fatalf("get missing key: want %v, have %v", mekabuild.ErrNotFound, err)
+	}
+
+	if err := store.Put("ns", "key", []byte("value")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	have, err := store.Get("ns", "key")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	if want := []byte("value"); !bytes.Equal(want, have) {
+		t.Fatalf("get: want %q, have %q", want, have)
+	}
+
+	if err := store.Delete("ns", "key"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if _, err := store.Get("ns", "key"); !errors.Is(err, mekabuild.ErrNotFound) {
+		t.Fatalf("get deleted key: want %v, have %v", mekabuild.ErrNotFound, err)
+	}
+}
+
+func TestBuilderStore(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", rand.Reader)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		store     = mekabuild.NewMemoryStore()
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	first := mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	if err := first.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := first.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := 1, len(store.Keys(mekabuild.StoreNamespaceAudit)); want != have {
+		t.Errorf("audit records: want %d, have %d", want, have)
+	}
+
+	deadline := time.Now().Add(5 * time.Second) // stats are persisted in the background
+	for len(store.Keys(mekabuild.StoreNamespaceStats)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("endpoint stats weren't persisted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	second := mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	if err := second.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := second.EndpointStats()
+	if want, have := 1, len(stats); want != have {
+		t.Fatalf("endpoint count: want %d, have %d", want, have)
+	}
+
+	if want, have := uint64(1), stats[0].Successes; want != have {
+		t.Errorf("successes: want %d, have %d", want, have)
+	}
+}
+
+func TestFileStoreConcurrentPut(t *testing.T) {
+	store, err := mekabuild.NewFileStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		values = make([][]byte, 16)
+	)
+	for i := range values {
+		values[i] = bytes.Repeat([]byte{byte('a' + i)}, 64<<10)
+		wg.Add(1)
+		go func(value []byte) {
+			defer wg.Done()
+			if err := store.Put("ns", "key", value); err != nil {
+				t.Errorf("put: %v", err)
+			}
+		}(values[i])
+	}
+	wg.Wait()
+
+	have, err := store.Get("ns", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, want := range values {
+		found = found || bytes.Equal(want, have)
+	}
+	if !found {
+		t.Errorf("want one of the values written, have a torn value")
+	}
+	if want, have := []string{"key"}, store.Keys("ns"); len(have) != 1 || have[0] != want[0] {
+		t.Errorf("keys: want %v, have %v", want, have)
+	}
+}
@@ -0,0 +1,111 @@
+package mekabuild
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StreamBuildBlock is like BuildBlock, but keeps the request open and receives
+// successive, improved transaction sets for the height from the builder API,
+// e.g. as late bundles arrive. Each update is passed to the optional update
+// function as it's received. The stream ends when the API closes it, or when
+// ctx is done, typically at the proposer's cancel deadline.
+//
+// StreamBuildBlock returns the last update received. It returns an error if no
+// update was received, or if the stream failed before ending, e.g. if an
+// update failed verification, in which case earlier updates are discarded.
+//
+// Updates are sent by the API as newline-delimited JSON BuildBlockResponses
+// over a single HTTP response, rather than over a WebSocket, so that no
+// dependencies beyond the standard library are required.
+func (b *Builder) StreamBuildBlock(ctx context.Context, req *BuildBlockRequest, update func(*BuildBlockResponse)) (*BuildBlockResponse, error) {
+	if err := b.checkEnabled(req); err != nil {
+		return nil, err
+	}
+
+	ctx, req, hdr, err := b.prepareBuild(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	hdr.Set("accept", "application/x-ndjson")
+
+	var (
+		begin = b.now()
+		sr    = &streamReceiver{update: update, verify: func(resp *BuildBlockResponse) error {
+			if err := b.verifyResponse(req, resp); err != nil {
+				return err
+			}
+			if err := b.checkDuplicateTxs(req, resp); err != nil {
+				return err
+			}
+			if err := b.filterResponse(req, resp); err != nil {
+				return err
+			}
+			if err := b.enforceResponseLimits(req, resp); err != nil {
+				return err
+			}
+			return b.mergeTopOfBlock(req, resp)
+		}}
+	)
+	attempts := &buildAttempts{b: b, req: req, hdr: hdr}
+	endpoint, err := b.doAttempts(ctx, "/v0/build/stream", attempts.next, sr)
+	req = attempts.req // as last sent
+	if sr.latest != nil && streamEnded(err) {
+		err = nil // cancellation is the normal end of a stream
+	}
+	b.breakerRecord(err)
+
+	b.audit(begin, endpoint, req, sr.latest, err)
+	b.recordBuild(b.newBuildEvent(begin, req.Height, endpoint, err))
+	if err != nil {
+		b.getLogger().Errorf("stream build block failed: chain_id=%s height=%d endpoint=%s took=%s updates=%d err=%v", req.ChainID, req.Height, endpoint, b.since(begin), sr.updates, err)
+		return nil, err
+	}
+
+	b.observePayment(req, sr.latest)
+
+	return sr.latest, nil
+}
+
+type streamReceiver struct {
+	update  func(*BuildBlockResponse)
+	verify  func(*BuildBlockResponse) error
+	latest  *BuildBlockResponse
+	updates int
+}
+
+// streamEnded returns true if err means the stream was ended by its context,
+// rather than failed.
+func streamEnded(err error) bool {
+	return err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (sr *streamReceiver) decodeStream(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var resp BuildBlockResponse
+		err := dec.Decode(&resp)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unmarshal stream update: %w", err)
+		}
+
+		if sr.verify != nil {
+			if err := sr.verify(&resp); err != nil {
+				return fmt.Errorf("verify stream update: %w", err)
+			}
+		}
+
+		sr.latest = &resp
+		sr.updates++
+		if sr.update != nil {
+			sr.update(&resp)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderStreamBuildBlock(t *testing.T) {
+	var (
+		key    = newMockKey(t, "foo", rand.Reader)
+		server = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if want, have := "/v0/build/stream", r.URL.Path; want != have {
+				http.Error(w, "wrong path "+have, http.StatusNotFound)
+				return
+			}
+			enc := json.NewEncoder(w)
+			for _, payment := range []string{"1 coin", "2 coins", "3 coins"} {
+				enc.Encode(mekabuild.BuildBlockResponse{ValidatorPayment: payment})
+				w.(http.Flusher).Flush()
+			}
+			<-r.Context().Done() // hold the stream open until the client gives up
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-id", key.addr)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	var updates int
+	resp, err := builder.StreamBuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: "chain-id"}, func(*mekabuild.BuildBlockResponse) { updates++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := 3, updates; want != have {
+		t.Errorf("updates: want %d, have %d", want, have)
+	}
+
+	if want, have := "3 coins", resp.ValidatorPayment; want != have {
+		t.Errorf("payment: want %q, have %q", want, have)
+	}
+}
+
+func TestBuilderStreamBuildBlockRejectedUpdate(t *testing.T) {
+	var (
+		key    = newMockKey(t, "foo", rand.Reader)
+		server = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			enc := json.NewEncoder(w)
+			enc.Encode(mekabuild.BuildBlockResponse{ValidatorPayment: "1 coin"})
+			w.(http.Flusher).Flush()
+			enc.Encode(mekabuild.BuildBlockResponse{Txs: [][]byte{[]byte("tx"), []byte("tx")}}) // duplicate txs
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-id", key.addr)
+	)
+
+	if err := builder.SetDuplicateTxsPolicy(mekabuild.DuplicateTxsReject); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	if _, err := builder.StreamBuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: "chain-id"}, nil); err == nil {
+		t.Fatal("rejected update: want error, have none")
+	}
+	if h := builder.Health(); h.LastBuild == nil || h.LastBuild.Error == "" {
+		t.Errorf("rejected update: want failed build in health, have %+v", h.LastBuild)
+	}
+}
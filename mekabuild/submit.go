@@ -0,0 +1,122 @@
+package mekabuild
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SubmitBudget bounds the mempool txs submitted with each build request, for
+// validators whose mempool is larger than what they can upload to the builder
+// API in time, or than the API accepts. Rather than truncating the mempool
+// arbitrarily, the txs are ordered by value, and the most valuable ones that
+// fit are submitted, see SelectTxs. The selection happens before the request
+// is signed, so the signed txs hash always matches the submitted txs.
+type SubmitBudget struct {
+	// MaxBytes bounds the sum of raw tx sizes. Zero means unlimited.
+	MaxBytes int64
+
+	// MaxTxs bounds the number of txs. Zero means unlimited.
+	MaxTxs int
+
+	// BytesPerSecond is the expected upload rate to the builder API. If
+	// set, the txs are also bounded to what can be uploaded at that rate
+	// before the call's timeout, or the caller's deadline. Zero ignores
+	// time.
+	BytesPerSecond float64
+
+	// Order orders the txs by value, highest first, e.g. by fee with
+	// PriorityOrder. Nil is equivalent to MempoolOrder.
+	Order TxOrder
+}
+
+// SelectTxs returns the most valuable txs which fit within maxBytes and maxTxs:
+// the txs are ordered by order, and truncated at the first tx that doesn't
+// fit, so the selection preserves the order's guarantees, e.g. PriorityOrder's
+// sender sequences. Zero limits mean unlimited. A nil order is equivalent to
+// MempoolOrder. The given slice isn't modified.
+func SelectTxs(txs [][]byte, maxBytes int64, maxTxs int, order TxOrder) [][]byte {
+	if order == nil {
+		order = MempoolOrder
+	}
+	selected := order(append([][]byte(nil), txs...))
+
+	var size int64
+	for i, tx := range selected {
+		if size += int64(len(tx)); (maxBytes > 0 && size > maxBytes) || (maxTxs > 0 && i >= maxTxs) {
+			return selected[:i]
+		}
+	}
+	return selected
+}
+
+// SetSubmitBudget bounds the txs submitted with each build request. See
+// SubmitBudget. A zero budget, the default, submits every tx.
+func (b *Builder) SetSubmitBudget(sb SubmitBudget) error {
+	if sb.MaxBytes < 0 || sb.MaxTxs < 0 || sb.BytesPerSecond < 0 {
+		return fmt.Errorf("submit budget limits must not be negative, have %d bytes, %d txs, %v bytes per second", sb.MaxBytes, sb.MaxTxs, sb.BytesPerSecond)
+	}
+	if sb.MaxBytes == 0 && sb.MaxTxs == 0 && sb.BytesPerSecond == 0 {
+		b.submitBudget.Store(submitBudgetBox{})
+		return nil
+	}
+	b.submitBudget.Store(submitBudgetBox{&sb})
+	return nil
+}
+
+// WithSubmitBudget bounds the txs submitted with each build request. See
+// SetSubmitBudget.
+func WithSubmitBudget(sb SubmitBudget) Option {
+	return func(b *Builder) error {
+		return b.SetSubmitBudget(sb)
+	}
+}
+
+type submitBudgetBox struct{ *SubmitBudget }
+
+func (b *Builder) getSubmitBudget() *SubmitBudget {
+	box, _ := b.submitBudget.Load().(submitBudgetBox)
+	return box.SubmitBudget
+}
+
+// applySubmitBudget replaces the txs of the request with the selection that
+// fits the builder's submit budget, if any. It must precede signing.
+func (b *Builder) applySubmitBudget(ctx context.Context, req *BuildBlockRequest) {
+	sb := b.getSubmitBudget()
+	if sb == nil {
+		return
+	}
+
+	maxBytes := sb.MaxBytes
+	if window, ok := b.uploadWindow(ctx); ok && sb.BytesPerSecond > 0 {
+		n := int64(sb.BytesPerSecond * window.Seconds())
+		if n <= 0 {
+			n = -1 // no time left to upload anything
+		}
+		if maxBytes == 0 || n < maxBytes {
+			maxBytes = n
+		}
+	}
+
+	var selected [][]byte
+	if maxBytes >= 0 {
+		selected = SelectTxs(req.Txs, maxBytes, sb.MaxTxs, sb.Order)
+	}
+	if dropped := len(req.Txs) - len(selected); dropped > 0 {
+		b.getLogger().Infof("submit budget dropped txs: chain_id=%s height=%d txs=%d dropped=%d max_bytes=%d max_txs=%d", req.ChainID, req.Height, len(req.Txs), dropped, maxBytes, sb.MaxTxs)
+	}
+	req.Txs = selected
+}
+
+// uploadWindow returns the time available to upload a request made with ctx,
+// i.e. the shorter of the call's timeout and the time until the caller's
+// deadline, and false if it's unbounded. The window is negative once the
+// deadline has passed.
+func (b *Builder) uploadWindow(ctx context.Context) (time.Duration, bool) {
+	window := b.callTimeout(ctx)
+	deadline, ok := ctx.Deadline()
+	if ok && (window == 0 || b.until(deadline) < window) {
+		window = b.until(deadline)
+	}
+	return window, ok || window != 0
+}
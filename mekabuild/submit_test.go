@@ -0,0 +1,94 @@
+package mekabuild_test
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestSelectTxs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		order = mekabuild.PriorityOrder(decodeOrderTx)
+		txs   = [][]byte{
+			orderTx("alice", 1, 1, 0),
+			orderTx("alice", 2, 9, 1),
+			orderTx("bob", 1, 5, 2),
+			orderTx("carol", 1, 7, 3),
+		}
+		orig = append([][]byte(nil), txs...)
+	)
+
+	if want, have := [][]byte{txs[3], txs[2]}, mekabuild.SelectTxs(txs, 0, 2, order); !reflect.DeepEqual(want, have) {
+		t.Errorf("max txs: want %q, have %q", want, have)
+	}
+	if want, have := [][]byte{txs[3]}, mekabuild.SelectTxs(txs, int64(len(txs[3])+len(txs[2])-1), 0, order); !reflect.DeepEqual(want, have) {
+		t.Errorf("max bytes: want %q, have %q", want, have)
+	}
+	if want, have := txs[:2], mekabuild.SelectTxs(txs, 0, 2, nil); !reflect.DeepEqual(want, have) {
+		t.Errorf("mempool order: want %q, have %q", want, have)
+	}
+	if want, have := 4, len(mekabuild.SelectTxs(txs, 0, 0, order)); want != have {
+		t.Errorf("unlimited: want %d txs, have %d", want, have)
+	}
+	if !reflect.DeepEqual(orig, txs) {
+		t.Errorf("input modified: have %q", txs)
+	}
+}
+
+func TestBuilderSubmitBudget(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		mempool   = [][]byte{
+			orderTx("alice", 1, 1, 0),
+			orderTx("bob", 1, 5, 1),
+			orderTx("carol", 1, 7, 2),
+		}
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithSubmitBudget(mekabuild.SubmitBudget{MaxTxs: 2, Order: mekabuild.PriorityOrder(decodeOrderTx)}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The mock API verifies the signature over the submitted txs.
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, Txs: mempool}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := [][]byte{mempool[2], mempool[1]}, api.Builds()[0].Txs; !reflect.DeepEqual(want, have) {
+		t.Errorf("submitted txs: want %q, have %q", want, have)
+	}
+
+	// At 1 byte per second, there's no time to upload any tx.
+	if err := builder.SetSubmitBudget(mekabuild.SubmitBudget{BytesPerSecond: 1}); err != nil {
+		t.Fatal(err)
+	}
+	tctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	if _, err := builder.BuildBlock(tctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 2, ValidatorAddress: key.addr, Txs: mempool}); err != nil {
+		t.Fatal(err)
+	}
+	if have := api.Builds()[1].Txs; len(have) != 0 {
+		t.Errorf("submitted txs without time: want none, have %q", have)
+	}
+
+	if err := builder.SetSubmitBudget(mekabuild.SubmitBudget{MaxTxs: -1}); err == nil {
+		t.Errorf("negative budget: want error, have none")
+	}
+}
@@ -0,0 +1,223 @@
+package mekabuild
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// SelfTestReport is the outcome of Builder.SelfTest.
+type SelfTestReport struct {
+	Time   time.Time       `json:"time"`
+	OK     bool            `json:"ok"`
+	Checks []SelfTestCheck `json:"checks"`
+}
+
+// SelfTestCheck is a single check of a self-test.
+type SelfTestCheck struct {
+	Name     string        `json:"name"`
+	OK       bool          `json:"ok"`
+	Detail   string        `json:"detail,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// SelfTest checks the builder's configuration, and its connectivity to the
+// builder API, without using the signer. Failed checks are reported, rather
+// than returned as errors, so every check runs.
+func (b *Builder) SelfTest(ctx context.Context) *SelfTestReport {
+	report := &SelfTestReport{Time: b.now().UTC(), OK: true}
+
+	check := func(name string, fn func() (string, error)) {
+		begin := b.now()
+		detail, err := fn()
+		c := SelfTestCheck{Name: name, OK: err == nil, Detail: detail, Duration: b.since(begin)}
+		if err != nil {
+			c.Detail = redact(err.Error())
+			report.OK = false
+		}
+		report.Checks = append(report.Checks, c)
+	}
+
+	check("validator_address", func() (string, error) {
+		return b.validatorAddr, b.addrErr
+	})
+	check("endpoint", func() (string, error) {
+		return b.EndpointResolution().String(), nil
+	})
+	check("signer", func() (string, error) {
+		switch {
+		case b.ReadOnly():
+			return "read-only", nil
+		case b.signer == nil:
+			return "", fmt.Errorf("no signer")
+		default:
+			_, challenges := b.signer.(ChallengeSigner)
+			_, presigns := b.signer.(PresignSigner)
+			_, confirms := b.signer.(ConfirmSigner)
+			_, pauses := b.signer.(PauseSigner)
+			return fmt.Sprintf("%T challenge_signer=%v presign_signer=%v confirm_signer=%v pause_signer=%v", b.signer, challenges, presigns, confirms, pauses), nil
+		}
+	})
+	check("ping", func() (string, error) {
+		result, err := b.Ping(ctx)
+		if result == nil {
+			return "", err
+		}
+		return fmt.Sprintf("endpoint=%s api_version=%s rtt=%s", result.Endpoint, result.APIVersion, result.RTT), err
+	})
+	check("registration", func() (string, error) {
+		status, err := b.status(ctx)
+		if err != nil {
+			return "", err
+		}
+		if !status.Registered {
+			return "", fmt.Errorf("validator not registered")
+		}
+		return "registered", nil
+	})
+
+	return report
+}
+
+// SupportBundle is a redacted diagnostics bundle, uploaded to the builder API
+// by UploadSupportBundle. It contains no keys, signatures, or transactions,
+// and URLs are stripped of credentials and query parameters.
+type SupportBundle struct {
+	ChainID          string          `json:"chain_id"`
+	ValidatorAddress string          `json:"validator_address"`
+	Note             string          `json:"note,omitempty"`
+	Version          VersionInfo     `json:"version"`
+	Health           Health          `json:"health"`
+	Capabilities     string          `json:"capabilities"`
+	Endpoints        []string        `json:"endpoints"`
+	Sandbox          bool            `json:"sandbox"`
+	SelfTest         *SelfTestReport `json:"self_test"`
+	RecentErrors     []ErrorSummary  `json:"recent_errors"`
+}
+
+// VersionInfo identifies the software running the builder.
+type VersionInfo struct {
+	Module    string `json:"module"` // version of this module, if known
+	Main      string `json:"main"`   // path and version of the main module
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// ErrorSummary describes a failed request to the builder API.
+type ErrorSummary struct {
+	Time     time.Time `json:"time"`
+	Endpoint string    `json:"endpoint"`
+	Path     string    `json:"path"`
+	Error    string    `json:"error"`
+}
+
+// SupportBundleResponse is returned by the support endpoint of the builder API.
+type SupportBundleResponse struct {
+	// TicketID identifies the bundle, and should be quoted when reporting
+	// issues to the builder API operators.
+	TicketID string `json:"ticket_id"`
+}
+
+// SupportBundle assembles a redacted diagnostics bundle, including a fresh
+// self-test, without uploading it. The note is free text from the operator.
+func (b *Builder) SupportBundle(ctx context.Context, note string) *SupportBundle {
+	var endpoints []string
+	for _, u := range b.Endpoints() {
+		endpoints = append(endpoints, endpointName(u))
+	}
+
+	caps, _ := b.Capabilities()
+
+	return &SupportBundle{
+		ChainID:          b.chainID,
+		ValidatorAddress: b.validatorAddr,
+		Note:             note,
+		Version:          versionInfo(),
+		Health:           b.Health(),
+		Capabilities:     caps.String(),
+		Endpoints:        endpoints,
+		Sandbox:          b.Sandbox(),
+		SelfTest:         b.SelfTest(ctx),
+		RecentErrors:     b.errorLog.summaries(),
+	}
+}
+
+// UploadSupportBundle uploads a redacted diagnostics bundle to the support
+// endpoint of the builder API, and returns the ticket ID assigned to it. It's
+// opt-in: nothing is uploaded unless it's called. Use SupportBundle to
+// inspect the bundle before uploading it.
+func (b *Builder) UploadSupportBundle(ctx context.Context, note string) (string, error) {
+	bundle := b.SupportBundle(ctx, note)
+
+	var resp SupportBundleResponse
+	endpoint, err := b.do(ctx, "/v0/support", bundle, &resp, nil)
+	if err != nil {
+		b.getLogger().Errorf("upload support bundle failed: chain_id=%s endpoint=%s err=%v", b.chainID, endpoint, err)
+		return "", err
+	}
+
+	b.getLogger().Infof("uploaded support bundle: chain_id=%s endpoint=%s ticket_id=%s", b.chainID, endpoint, resp.TicketID)
+	return resp.TicketID, nil
+}
+
+const modulePath = "github.com/meka-dev/mekatek-go"
+
+func versionInfo() VersionInfo {
+	v := VersionInfo{
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		v.Main = info.Main.Path + "@" + info.Main.Version
+		if info.Main.Path == modulePath {
+			v.Module = info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				v.Module = dep.Version
+			}
+		}
+	}
+	return v
+}
+
+var (
+	redactUserinfo = regexp.MustCompile(`(://)[^/@\s"]+@`)
+	redactQuery    = regexp.MustCompile(`(://[^\s"?]*)\?[^\s"]*`)
+)
+
+// redact strips credentials and query parameters from URLs in s.
+func redact(s string) string {
+	s = redactUserinfo.ReplaceAllString(s, "${1}REDACTED@")
+	return redactQuery.ReplaceAllString(s, "${1}?REDACTED")
+}
+
+// errorLogSize is the number of recent errors kept for support bundles.
+const errorLogSize = 32
+
+// errorLog keeps the most recent request errors, redacted.
+type errorLog struct {
+	mtx     sync.Mutex
+	entries []ErrorSummary
+}
+
+func (l *errorLog) add(e ErrorSummary) {
+	e.Error = redact(e.Error)
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if len(l.entries) >= errorLogSize {
+		l.entries = append(l.entries[:0], l.entries[1:]...)
+	}
+	l.entries = append(l.entries, e)
+}
+
+func (l *errorLog) summaries() []ErrorSummary {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return append([]ErrorSummary(nil), l.entries...)
+}
@@ -0,0 +1,220 @@
+package mekabuild
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTelemetryInterval is the interval between telemetry reports used by
+// Config.
+const DefaultTelemetryInterval = 10 * time.Minute
+
+// telemetryTimeout bounds sending a telemetry report, which happens in the
+// background, after a build.
+const telemetryTimeout = 10 * time.Second
+
+// ErrTelemetryDisabled is returned by ReportTelemetry unless telemetry is
+// enabled, see SetTelemetry.
+var ErrTelemetryDisabled = errors.New("telemetry disabled")
+
+// TelemetryReport aggregates the builds of a period.
+type TelemetryReport struct {
+	ChainID       string `json:"chain_id"`
+	ClientVersion string `json:"client_version"` // version of this module, if known
+
+	// PeriodSeconds is the length of the period, rounded to seconds.
+	PeriodSeconds int64 `json:"period_seconds"`
+
+	Builds   uint64 `json:"builds"`
+	Failures uint64 `json:"failures"`
+
+	// LatencyBuckets counts the builds of the period by duration, with the
+	// bounds of the endpoint latency histograms, see LatencyBuckets. The
+	// last bucket, with a zero upper bound, counts the builds slower than
+	// every bound.
+	LatencyBuckets []LatencyBucket `json:"latency_buckets"`
+}
+
+// LatencyBucket counts the builds which took at most UpperMillis, and more
+// than the bound of the previous bucket.
+type LatencyBucket struct {
+	UpperMillis int64  `json:"le_ms"` // zero for the unbounded bucket
+	Count       uint64 `json:"count"`
+}
+
+// SuccessRate returns the fraction of the builds of the report that succeeded,
+// or 1 if there were none.
+func (r *TelemetryReport) SuccessRate() float64 {
+	if r.Builds == 0 {
+		return 1
+	}
+	return float64(r.Builds-r.Failures) / float64(r.Builds)
+}
+
+var telemetryEndpoint = Endpoint{Path: "/v0/telemetry"}
+
+// SetTelemetry enables telemetry: opt-in reports of aggregate statistics about
+// the builder's builds, sent to the builder API to help tune the timing of
+// auctions server-side, at most once per interval, after a build. An interval
+// of zero, the default, disables telemetry, and discards the statistics
+// gathered so far.
+//
+// Reports only include the chain ID, the version of this module, and counts:
+// no validator addresses, heights, endpoints, payments, txs, or error
+// messages. They're aggregate, not anonymous: like every request to the
+// builder API, they're sent with the builder's API key and client
+// credentials, so the builder API can attribute them to the operator. Use
+// TelemetryReport to inspect what would be sent.
+func (b *Builder) SetTelemetry(interval time.Duration) error {
+	if interval < 0 {
+		return fmt.Errorf("telemetry interval must not be negative, have %s", interval)
+	}
+	prev := atomic.SwapInt64(&b.telemetryInterval, int64(interval))
+	if (prev == 0) != (interval == 0) {
+		now := b.now()
+		atomic.StoreInt64(&b.telemetrySentAt, now.UnixNano())
+		b.telemetry.reset(now)
+	}
+	return nil
+}
+
+// WithTelemetry enables telemetry reports. See SetTelemetry.
+func WithTelemetry(interval time.Duration) Option {
+	return func(b *Builder) error {
+		return b.SetTelemetry(interval)
+	}
+}
+
+// TelemetryReport returns the report that would be sent next, if telemetry is
+// enabled.
+func (b *Builder) TelemetryReport() *TelemetryReport {
+	return b.telemetry.report(b.chainID, b.now())
+}
+
+// ReportTelemetry sends the telemetry report of the current period right away,
+// and starts a new period. It returns ErrTelemetryDisabled unless telemetry is
+// enabled.
+func (b *Builder) ReportTelemetry(ctx context.Context) error {
+	if atomic.LoadInt64(&b.telemetryInterval) == 0 {
+		return ErrTelemetryDisabled
+	}
+	atomic.StoreInt64(&b.telemetrySentAt, b.now().UnixNano())
+	return b.sendTelemetry(ctx)
+}
+
+// observeTelemetry aggregates a build, if telemetry is enabled, and sends a
+// report in the background once the interval has elapsed.
+func (b *Builder) observeTelemetry(ev BuildEvent) {
+	interval := time.Duration(atomic.LoadInt64(&b.telemetryInterval))
+	if interval == 0 {
+		return
+	}
+	b.telemetry.observe(ev)
+
+	var (
+		now  = b.now()
+		last = atomic.LoadInt64(&b.telemetrySentAt)
+	)
+	if now.Sub(time.Unix(0, last)) < interval {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&b.telemetrySentAt, last, now.UnixNano()) {
+		return // another build is sending
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), telemetryTimeout)
+		defer cancel()
+		b.sendTelemetry(ctx) // best effort
+	}()
+}
+
+func (b *Builder) sendTelemetry(ctx context.Context) error {
+	var (
+		r    = b.telemetry.take(b.chainID, b.now())
+		resp struct{}
+	)
+	if err := b.Call(ctx, telemetryEndpoint, r, &resp); err != nil {
+		b.getLogger().Debugf("send telemetry failed: chain_id=%s err=%v", b.chainID, err)
+		return err
+	}
+	b.getLogger().Debugf("sent telemetry: chain_id=%s builds=%d failures=%d", b.chainID, r.Builds, r.Failures)
+	return nil
+}
+
+// telemetryStats aggregates builds for telemetry reports.
+type telemetryStats struct {
+	mtx      sync.Mutex
+	since    time.Time
+	builds   uint64
+	failures uint64
+	buckets  []uint64 // per latencyBuckets, and the unbounded bucket
+}
+
+func (s *telemetryStats) observe(ev BuildEvent) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(latencyBuckets)+1)
+	}
+	if s.since.IsZero() {
+		s.since = ev.Time
+	}
+	s.builds++
+	if ev.Error != "" {
+		s.failures++
+	}
+	s.buckets[sort.Search(len(latencyBuckets), func(i int) bool { return ev.Duration <= latencyBuckets[i] })]++
+}
+
+func (s *telemetryStats) report(chainID string, now time.Time) *TelemetryReport {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.reportLocked(chainID, now)
+}
+
+// take returns the report of the current period, and starts a new one.
+func (s *telemetryStats) take(chainID string, now time.Time) *TelemetryReport {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	r := s.reportLocked(chainID, now)
+	s.resetLocked(now)
+	return r
+}
+
+func (s *telemetryStats) reset(now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.resetLocked(now)
+}
+
+func (s *telemetryStats) resetLocked(now time.Time) {
+	s.since, s.builds, s.failures, s.buckets = now, 0, 0, nil
+}
+
+func (s *telemetryStats) reportLocked(chainID string, now time.Time) *TelemetryReport {
+	r := &TelemetryReport{
+		ChainID:        chainID,
+		ClientVersion:  versionInfo().Module,
+		Builds:         s.builds,
+		Failures:       s.failures,
+		LatencyBuckets: make([]LatencyBucket, len(latencyBuckets)+1),
+	}
+	if !s.since.IsZero() {
+		r.PeriodSeconds = int64(now.Sub(s.since).Round(time.Second) / time.Second)
+	}
+	for i := range r.LatencyBuckets {
+		if i < len(latencyBuckets) {
+			r.LatencyBuckets[i].UpperMillis = latencyBuckets[i].Milliseconds()
+		}
+		if s.buckets != nil {
+			r.LatencyBuckets[i].Count = s.buckets[i]
+		}
+	}
+	return r
+}
@@ -0,0 +1,200 @@
+package mekabuild_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestTelemetryOptIn(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithEndpoints(apiURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.ReportTelemetry(ctx); !errors.Is(err, mekabuild.ErrTelemetryDisabled) {
+		t.Errorf("report: want %v, have %v", mekabuild.ErrTelemetryDisabled, err)
+	}
+	if r := builder.TelemetryReport(); r.Builds != 0 {
+		t.Errorf("builds observed while disabled: have %d", r.Builds)
+	}
+	if reports := api.TelemetryReports(); len(reports) != 0 {
+		t.Errorf("reports sent while disabled: have %d", len(reports))
+	}
+}
+
+func TestTelemetryConfig(t *testing.T) {
+	clearConfigEnv(t)
+
+	c, err := mekabuild.LoadConfig(writeConfig(t, "[zenith]\nretries = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Telemetry {
+		t.Errorf("telemetry enabled by default")
+	}
+
+	if c, err = mekabuild.LoadConfig(writeConfig(t, "[zenith]\ntelemetry = true\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Telemetry {
+		t.Errorf("telemetry = true: not enabled")
+	}
+
+	setenv(t, "MEKATEK_BUILDER_API_TELEMETRY", "false")
+	if c, err = mekabuild.LoadConfig(writeConfig(t, "[zenith]\ntelemetry = true\n")); err != nil {
+		t.Fatal(err)
+	}
+	if c.Telemetry {
+		t.Errorf("env override: telemetry enabled")
+	}
+}
+
+func TestTelemetryRedaction(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		secretTx  = []byte("secret-tx-payload")
+		payment   = "cosmos1secretpayment"
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	api.SetFailure(func(r *http.Request) int {
+		if strings.HasSuffix(r.URL.Path, "/build") && len(api.Builds()) == 0 {
+			return http.StatusTeapot
+		}
+		return 0
+	})
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithAutoRegister(payment),
+		mekabuild.WithTelemetry(time.Hour),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, Txs: [][]byte{secretTx}}); err == nil {
+		t.Fatal("first build: want error, have none")
+	}
+	api.SetFailure(nil)
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 2, ValidatorAddress: key.addr, Txs: [][]byte{secretTx}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.ReportTelemetry(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reports := api.TelemetryReports()
+	if len(reports) != 1 {
+		t.Fatalf("reports: want 1, have %d", len(reports))
+	}
+	r := reports[0]
+	if r.ChainID != chainID || r.Builds != 2 || r.Failures != 1 || r.SuccessRate() != 0.5 {
+		t.Errorf("report: have %+v", r)
+	}
+	var (
+		bounds   = mekabuild.LatencyBuckets()
+		bucketed uint64
+	)
+	if want, have := len(bounds)+1, len(r.LatencyBuckets); want != have {
+		t.Fatalf("latency buckets: want %d, have %d", want, have)
+	}
+	for i, b := range r.LatencyBuckets {
+		if i < len(bounds) && b.UpperMillis != bounds[i].Milliseconds() {
+			t.Errorf("latency bucket %d: want bound %s, have %dms", i, bounds[i], b.UpperMillis)
+		}
+		bucketed += b.Count
+	}
+	if bucketed != 2 {
+		t.Errorf("latency buckets: want 2 builds, have %d", bucketed)
+	}
+
+	data, err := json.Marshal(builder.TelemetryReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{
+		key.addr,
+		fmt.Sprintf("%X", []byte(key.PublicKey)),
+		string(secretTx),
+		payment,
+		apiURL.Host,
+		"teapot",
+		fmt.Sprint(http.StatusTeapot),
+	} {
+		for _, s := range []string{string(data), string(sent)} {
+			if strings.Contains(strings.ToLower(s), strings.ToLower(secret)) {
+				t.Errorf("report includes %q: %s", secret, s)
+			}
+		}
+	}
+}
+
+func TestTelemetryInterval(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithTelemetry(time.Nanosecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(api.TelemetryReports()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no telemetry report sent after the interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r := api.TelemetryReports()[0]; r.Builds != 1 {
+		t.Errorf("report: want 1 build, have %+v", r)
+	}
+}
@@ -0,0 +1,112 @@
+package mekabuild
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// CosignerSet identifies the cosigners whose signature shares were aggregated
+// into a threshold signature, e.g. by a horcrux cluster. The aggregated
+// signature verifies under the validator's public key like any other, so the
+// builder API needs no knowledge of the shares, but the cosigner set is
+// covered by the signature, for accountability.
+type CosignerSet struct {
+	// Threshold is the number of shares required to sign, and Total the
+	// number of cosigners in the cluster.
+	Threshold int `json:"threshold"`
+	Total     int `json:"total"`
+
+	// IDs are the 1-based IDs of the cosigners that signed, in ascending
+	// order. There are at least Threshold of them.
+	IDs []int `json:"ids"`
+}
+
+// ThresholdSigner is implemented by signers whose signatures are aggregated
+// from the shares of a threshold of cosigners, e.g. horcrux clusters. When
+// signing a build request, they must set its Cosigners to the cosigners whose
+// shares were aggregated, before computing its SignBytes, so the cosigner set
+// is covered by the signature.
+//
+// Signers that proxy to a threshold signer, e.g. signerd clients, may set
+// Cosigners without implementing ThresholdSigner.
+type ThresholdSigner interface {
+	Signer
+
+	// Threshold returns the threshold and total number of cosigners.
+	Threshold() (threshold, total int)
+}
+
+var (
+	// ErrThresholdUnsupported is returned when a request carries a
+	// threshold signature, and the builder API doesn't support
+	// CapabilityThresholdSignatures.
+	ErrThresholdUnsupported = errors.New("builder API doesn't support threshold signatures")
+
+	// ErrInvalidCosigners is returned when a request's cosigner set is
+	// malformed, or doesn't match its signer.
+	ErrInvalidCosigners = errors.New("invalid cosigner set")
+)
+
+// Validate checks that the cosigner set is well-formed.
+func (c *CosignerSet) Validate() error {
+	if c.Threshold < 1 || c.Total < c.Threshold {
+		return fmt.Errorf("%w: threshold %d of %d", ErrInvalidCosigners, c.Threshold, c.Total)
+	}
+	if len(c.IDs) < c.Threshold {
+		return fmt.Errorf("%w: %d cosigners, threshold %d", ErrInvalidCosigners, len(c.IDs), c.Threshold)
+	}
+	for i, id := range c.IDs {
+		if id < 1 || id > c.Total {
+			return fmt.Errorf("%w: cosigner ID %d out of range 1-%d", ErrInvalidCosigners, id, c.Total)
+		}
+		if i > 0 && id <= c.IDs[i-1] {
+			return fmt.Errorf("%w: cosigner IDs not in ascending order", ErrInvalidCosigners)
+		}
+	}
+	return nil
+}
+
+// bindCosigners binds the cosigner set to the sign bytes. Without cosigners,
+// the sign bytes are unchanged, so existing signatures remain valid.
+func bindCosigners(c *CosignerSet, signBytes []byte) []byte {
+	if c == nil {
+		return signBytes
+	}
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`threshold-cosigners-`))
+	mustEncode(&sb, uint64(c.Threshold))
+	mustEncode(&sb, uint64(c.Total))
+	mustEncode(&sb, uint64(len(c.IDs)))
+	for _, id := range c.IDs {
+		mustEncode(&sb, uint64(id))
+	}
+	mustEncode(&sb, signBytes)
+	return sb.Bytes()
+}
+
+// checkCosigners checks the cosigner set of a signed request against the
+// signer, and the capabilities of the builder API.
+func (b *Builder) checkCosigners(req *BuildBlockRequest) error {
+	ts, isThreshold := b.signer.(ThresholdSigner)
+	if req.Cosigners == nil {
+		if isThreshold {
+			return fmt.Errorf("%w: threshold signer didn't set cosigners", ErrInvalidCosigners)
+		}
+		return nil
+	}
+
+	if err := req.Cosigners.Validate(); err != nil {
+		return err
+	}
+	if isThreshold {
+		if threshold, total := ts.Threshold(); req.Cosigners.Threshold != threshold || req.Cosigners.Total != total {
+			return fmt.Errorf("%w: threshold %d of %d, signer has %d of %d", ErrInvalidCosigners, req.Cosigners.Threshold, req.Cosigners.Total, threshold, total)
+		}
+	}
+	if caps, ok := b.Capabilities(); ok && !caps.Has(CapabilityThresholdSignatures) {
+		return ErrThresholdUnsupported
+	}
+	return nil
+}
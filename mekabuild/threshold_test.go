@@ -0,0 +1,161 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestCosignerSetValidate(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name  string
+		set   mekabuild.CosignerSet
+		valid bool
+	}{
+		{"2 of 3", mekabuild.CosignerSet{Threshold: 2, Total: 3, IDs: []int{1, 3}}, true},
+		{"all", mekabuild.CosignerSet{Threshold: 2, Total: 3, IDs: []int{1, 2, 3}}, true},
+		{"zero threshold", mekabuild.CosignerSet{Threshold: 0, Total: 3, IDs: []int{1}}, false},
+		{"threshold above total", mekabuild.CosignerSet{Threshold: 4, Total: 3, IDs: []int{1, 2, 3}}, false},
+		{"below threshold", mekabuild.CosignerSet{Threshold: 2, Total: 3, IDs: []int{2}}, false},
+		{"out of range", mekabuild.CosignerSet{Threshold: 2, Total: 3, IDs: []int{1, 4}}, false},
+		{"zero ID", mekabuild.CosignerSet{Threshold: 2, Total: 3, IDs: []int{0, 1}}, false},
+		{"unordered", mekabuild.CosignerSet{Threshold: 2, Total: 3, IDs: []int{3, 1}}, false},
+		{"duplicate", mekabuild.CosignerSet{Threshold: 2, Total: 3, IDs: []int{2, 2}}, false},
+	} {
+		err := tc.set.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("%s: want valid, have %v", tc.name, err)
+		}
+		if !tc.valid && !errors.Is(err, mekabuild.ErrInvalidCosigners) {
+			t.Errorf("%s: want %v, have %v", tc.name, mekabuild.ErrInvalidCosigners, err)
+		}
+	}
+}
+
+func TestThresholdSignBytes(t *testing.T) {
+	t.Parallel()
+
+	var (
+		key = newMockKey(t, "validator", nil)
+		req = &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1, Txs: [][]byte{[]byte("tx")}}
+	)
+
+	plain, err := req.SignBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Cosigners = &mekabuild.CosignerSet{Threshold: 2, Total: 3, IDs: []int{1, 2}}
+	if err := key.SignBuildBlockRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	bound, err := req.SignBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(plain, bound) {
+		t.Errorf("cosigners not bound to sign bytes")
+	}
+	if !mekabuild.IsValidatorSignBytes(bound) {
+		t.Errorf("sign bytes with cosigners aren't domain-separated")
+	}
+
+	if err := mekabuild.VerifyBuildBlockRequest(req, key.PublicKey); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	tampered := *req
+	tampered.Cosigners = &mekabuild.CosignerSet{Threshold: 2, Total: 3, IDs: []int{1, 3}}
+	if err := mekabuild.VerifyBuildBlockRequest(&tampered, key.PublicKey); !errors.Is(err, mekabuild.ErrBadSignature) {
+		t.Errorf("tampered cosigners: want %v, have %v", mekabuild.ErrBadSignature, err)
+	}
+}
+
+func TestBuilderThresholdSigner(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx      = context.Background()
+		chainID  = "chain-id"
+		key      = &thresholdKey{mockKey: newMockKey(t, "validator", nil), threshold: 2, total: 3, ids: []int{1, 3}}
+		api      = newMockAPI()
+		caps     = make(chan mekabuild.Capabilities, 1)
+		received = make(chan *mekabuild.BuildBlockRequest, 10)
+		server   = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := <-caps
+			caps <- c
+			w.Header().Set(mekabuild.CapabilitiesHeader, c.String())
+
+			body, _ := io.ReadAll(r.Body)
+			var req mekabuild.BuildBlockRequest
+			if err := json.Unmarshal(body, &req); err == nil && req.Txs != nil {
+				received <- &req
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+		newReq    = func(height int64) *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1, Txs: [][]byte{[]byte("tx")}}
+		}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	caps <- mekabuild.CapabilityThresholdSignatures
+
+	if _, err := builder.BuildBlock(ctx, newReq(1)); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	req := <-received
+	if req.Cosigners == nil {
+		t.Fatalf("request without cosigners")
+	}
+	if want, have := []int{1, 3}, req.Cosigners.IDs; len(want) != len(have) || want[0] != have[0] || want[1] != have[1] {
+		t.Errorf("cosigner IDs: want %v, have %v", want, have)
+	}
+	if err := mekabuild.VerifyBuildBlockRequest(req, key.PublicKey); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+
+	key.ids = []int{2}
+	if _, err := builder.BuildBlock(ctx, newReq(2)); !errors.Is(err, mekabuild.ErrInvalidCosigners) {
+		t.Errorf("below threshold: want %v, have %v", mekabuild.ErrInvalidCosigners, err)
+	}
+
+	key.ids = []int{1, 2}
+	<-caps
+	caps <- mekabuild.CapabilityProto
+	builder.BuildBlock(ctx, newReq(3)) // negotiate
+
+	if _, err := builder.BuildBlock(ctx, newReq(4)); !errors.Is(err, mekabuild.ErrThresholdUnsupported) {
+		t.Errorf("unsupported: want %v, have %v", mekabuild.ErrThresholdUnsupported, err)
+	}
+}
+
+type thresholdKey struct {
+	*mockKey
+	threshold, total int
+	ids              []int
+}
+
+func (k *thresholdKey) SignBuildBlockRequest(r *mekabuild.BuildBlockRequest) error {
+	r.Cosigners = &mekabuild.CosignerSet{Threshold: k.threshold, Total: k.total, IDs: k.ids}
+	return k.mockKey.SignBuildBlockRequest(r)
+}
+
+func (k *thresholdKey) Threshold() (threshold, total int) {
+	return k.threshold, k.total
+}
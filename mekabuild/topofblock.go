@@ -0,0 +1,193 @@
+package mekabuild
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// In a top-of-block build, the builder API returns only the segment of the
+// block it sells, i.e. bundles and its payment tx, rather than a full block,
+// and the validator fills the rest of the block with its own mempool txs, up
+// to the block's MaxBytes and MaxGas. The validator keeps control over most
+// of its block, and responses are smaller. Top-of-block builds require
+// CapabilityTopOfBlock. See SetTopOfBlock.
+
+// BuildMode selects what the builder API returns for a build request.
+type BuildMode string
+
+const (
+	// BuildModeFull requests a full block. It's the default.
+	BuildModeFull BuildMode = ""
+
+	// BuildModeTopOfBlock requests only the top-of-block segment, which
+	// the validator completes with its mempool txs, see MergeTopOfBlock.
+	BuildModeTopOfBlock BuildMode = "top-of-block"
+)
+
+// Validate returns an error if m isn't a known build mode.
+func (m BuildMode) Validate() error {
+	switch m {
+	case BuildModeFull, BuildModeTopOfBlock:
+		return nil
+	default:
+		return fmt.Errorf("unknown build mode %q", string(m))
+	}
+}
+
+// ErrBuildModeUnsupported is returned when a request sets a build mode, and
+// the builder API doesn't support it.
+var ErrBuildModeUnsupported = errors.New("builder API doesn't support build mode")
+
+// bindBuildMode binds the build mode to sign bytes, so a relay can't turn a
+// full build into a top-of-block build, or vice versa. Full builds produce the
+// original sign bytes.
+func bindBuildMode(mode BuildMode, signBytes []byte) []byte {
+	if mode == BuildModeFull {
+		return signBytes
+	}
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`build-mode-`))
+	mustEncode(&sb, uint64(len([]byte(mode))))
+	mustEncode(&sb, []byte(mode))
+	mustEncode(&sb, signBytes)
+	return sb.Bytes()
+}
+
+// MergeTopOfBlock returns the block made of the top-of-block txs returned by
+// the builder API, followed by the mempool txs, in order, truncated to the
+// block's maxBytes and maxGas, see BlockBudget. Mempool txs which are already
+// in top, e.g. included in a bundle, are skipped. Like NewMempoolFallback, the
+// mempool txs are truncated at the first one that doesn't fit, so the block
+// preserves the mempool's order. Gas is only accounted for if gas isn't nil.
+//
+// It returns an error wrapping ErrBlockBudgetExceeded if top alone doesn't fit
+// the block, or the error of gas, if any.
+func MergeTopOfBlock(top, mempool [][]byte, maxBytes, maxGas int64, gas GasEstimator) ([][]byte, error) {
+	var (
+		budget = BlockBudget{MaxBytes: maxBytes, MaxGas: maxGas, Gas: gas}
+		seen   = make(map[string]bool, len(top))
+		txs    = make([][]byte, 0, len(top)+len(mempool))
+	)
+	for _, tx := range top {
+		if err := budget.Add(tx); err != nil {
+			return nil, fmt.Errorf("top of block: %w", err)
+		}
+		seen[string(tx)] = true
+		txs = append(txs, tx)
+	}
+
+	for _, tx := range mempool {
+		if seen[string(tx)] {
+			continue
+		}
+		err := budget.Add(tx)
+		if errors.Is(err, ErrBlockBudgetExceeded) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mempool: %w", err)
+		}
+		seen[string(tx)] = true
+		txs = append(txs, tx)
+	}
+
+	return txs, nil
+}
+
+// SetTopOfBlock enables or disables top-of-block builds. While enabled, and
+// once the builder API advertises CapabilityTopOfBlock, build requests ask for
+// BuildModeTopOfBlock, and BuildBlock merges the returned segment with the
+// request's txs, see MergeTopOfBlock, so callers receive a full block either
+// way. Until capabilities are negotiated, full blocks are requested. The gas
+// estimator is used to honor the request's MaxGas, and may be nil, in which
+// case only MaxBytes is honored. Disabled by default.
+//
+// Presigned requests don't cover the build mode, so they're only used for full
+// builds, see Presign.
+func (b *Builder) SetTopOfBlock(enabled bool, gas GasEstimator) {
+	if !enabled {
+		b.topOfBlock.Store(topOfBlockBox{})
+		return
+	}
+	b.topOfBlock.Store(topOfBlockBox{&topOfBlock{gas: gas}})
+}
+
+// WithTopOfBlock enables top-of-block builds. See SetTopOfBlock.
+func WithTopOfBlock(gas GasEstimator) Option {
+	return func(b *Builder) error {
+		b.SetTopOfBlock(true, gas)
+		return nil
+	}
+}
+
+type topOfBlock struct {
+	gas GasEstimator
+}
+
+type topOfBlockBox struct{ *topOfBlock }
+
+func (b *Builder) getTopOfBlock() *topOfBlock {
+	box, _ := b.topOfBlock.Load().(topOfBlockBox)
+	return box.topOfBlock
+}
+
+// setBuildMode requests a top-of-block build, if it's enabled and supported by
+// the builder API, and the caller hasn't set a mode already. A mode set by the
+// caller must be supported, once capabilities are negotiated.
+func (b *Builder) setBuildMode(req *BuildBlockRequest) error {
+	if err := req.Mode.Validate(); err != nil {
+		return err
+	}
+
+	caps, negotiated := b.Capabilities()
+	if req.Mode == BuildModeFull {
+		if b.getTopOfBlock() != nil && negotiated && caps.Has(CapabilityTopOfBlock) {
+			req.Mode = BuildModeTopOfBlock
+		}
+		return nil
+	}
+
+	if negotiated && !caps.Has(CapabilityTopOfBlock) {
+		return fmt.Errorf("%w %s", ErrBuildModeUnsupported, req.Mode)
+	}
+	return nil
+}
+
+// mergeTopOfBlock completes the verified top-of-block segment in resp with the
+// request's txs. The attestation tx, if any, stays first, and counts against
+// the block's bytes, but not its gas. Full builds are left unchanged.
+func (b *Builder) mergeTopOfBlock(req *BuildBlockRequest, resp *BuildBlockResponse) error {
+	if req.Mode != BuildModeTopOfBlock {
+		return nil
+	}
+
+	var gas GasEstimator
+	if tob := b.getTopOfBlock(); tob != nil {
+		gas = tob.gas
+	}
+
+	a, top, err := SplitAttestation(resp.Txs)
+	if err != nil {
+		return err
+	}
+	maxBytes := req.MaxBytes
+	if a != nil && maxBytes > 0 {
+		if maxBytes -= int64(len(resp.Txs[0])); maxBytes <= 0 {
+			return fmt.Errorf("top of block: %w: attestation tx", ErrBlockBudgetExceeded)
+		}
+	}
+
+	txs, err := MergeTopOfBlock(top, req.Txs, maxBytes, req.MaxGas, gas)
+	if err != nil {
+		return err
+	}
+	if a != nil {
+		txs = append([][]byte{resp.Txs[0]}, txs...)
+	}
+
+	b.getLogger().Debugf("top of block merged: chain_id=%s height=%d txs_top=%d txs_out=%d", req.ChainID, req.Height, len(top), len(txs))
+	resp.Txs = txs
+	return nil
+}
@@ -0,0 +1,195 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestMergeTopOfBlock(t *testing.T) {
+	t.Parallel()
+
+	// Gas is the number after the last dash, e.g. 30 for "tx-1-30".
+	gas := func(tx []byte) (int64, error) {
+		s := string(tx)
+		return strconv.ParseInt(s[strings.LastIndex(s, "-")+1:], 10, 64)
+	}
+	txs := func(ss ...string) [][]byte {
+		var txs [][]byte
+		for _, s := range ss {
+			txs = append(txs, []byte(s))
+		}
+		return txs
+	}
+
+	for _, tc := range []struct {
+		name             string
+		top, mempool     [][]byte
+		maxBytes, maxGas int64
+		gas              mekabuild.GasEstimator
+		want             [][]byte
+		wantErr          error
+	}{
+		{
+			name:    "unlimited",
+			top:     txs("b-1-10"),
+			mempool: txs("m-1-10", "m-2-10"),
+			want:    txs("b-1-10", "m-1-10", "m-2-10"),
+		},
+		{
+			name:     "bytes",
+			top:      txs("b-1-10"),
+			mempool:  txs("m-1-10", "m-2-10", "m-3"),
+			maxBytes: 12,
+			want:     txs("b-1-10", "m-1-10"),
+		},
+		{
+			name:    "gas",
+			top:     txs("b-1-30"),
+			mempool: txs("m-1-50", "m-2-30", "m-3-10"),
+			maxGas:  100,
+			gas:     gas,
+			want:    txs("b-1-30", "m-1-50"),
+		},
+		{
+			name:    "gas without estimator",
+			top:     txs("b-1-30"),
+			mempool: txs("m-1-50", "m-2-30"),
+			maxGas:  10,
+			want:    txs("b-1-30", "m-1-50", "m-2-30"),
+		},
+		{
+			name:    "duplicates",
+			top:     txs("b-1-10", "m-2-10"),
+			mempool: txs("m-1-10", "m-2-10", "m-1-10"),
+			want:    txs("b-1-10", "m-2-10", "m-1-10"),
+		},
+		{
+			name:    "top exceeds block",
+			top:     txs("b-1-60", "b-2-60"),
+			mempool: txs("m-1-10"),
+			maxGas:  100,
+			gas:     gas,
+			wantErr: mekabuild.ErrBlockBudgetExceeded,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			have, err := mekabuild.MergeTopOfBlock(tc.top, tc.mempool, tc.maxBytes, tc.maxGas, tc.gas)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("error: want %v, have %v", tc.wantErr, err)
+			}
+			if !reflect.DeepEqual(tc.want, have) {
+				t.Errorf("txs: want %q, have %q", tc.want, have)
+			}
+		})
+	}
+
+	t.Run("gas error", func(t *testing.T) {
+		t.Parallel()
+		if _, err := mekabuild.MergeTopOfBlock(nil, txs("m-x"), 0, 100, gas); err == nil || errors.Is(err, mekabuild.ErrBlockBudgetExceeded) {
+			t.Errorf("want gas estimator error, have %v", err)
+		}
+	})
+}
+
+func TestBlockBudget(t *testing.T) {
+	t.Parallel()
+
+	bb := mekabuild.BlockBudget{MaxBytes: 10, MaxGas: 5, Gas: func([]byte) (int64, error) { return 2, nil }}
+	for _, tx := range []string{"1234", "5678"} {
+		if err := bb.Add([]byte(tx)); err != nil {
+			t.Fatalf("add %s: %v", tx, err)
+		}
+	}
+	if err := bb.Add([]byte("9")); !errors.Is(err, mekabuild.ErrBlockBudgetExceeded) {
+		t.Errorf("gas: want %v, have %v", mekabuild.ErrBlockBudgetExceeded, err)
+	}
+	bb.Gas = nil
+	if err := bb.Add([]byte("abc")); !errors.Is(err, mekabuild.ErrBlockBudgetExceeded) {
+		t.Errorf("bytes: want %v, have %v", mekabuild.ErrBlockBudgetExceeded, err)
+	}
+	if bb.UsedBytes != 8 || bb.UsedGas != 4 {
+		t.Errorf("used: want 8 bytes and 4 gas, have %d and %d", bb.UsedBytes, bb.UsedGas)
+	}
+}
+
+func TestBuilderTopOfBlock(t *testing.T) {
+	t.Parallel()
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		mempool   = [][]byte{[]byte("tx-1"), []byte("tx-2"), []byte("tx-3")}
+		metrics   = &mockMetrics{}
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	api.SetBuilderKey(private)
+	api.SetAttestations(true)
+	api.SetTopOfBlock([]byte("bundle-1"), []byte("tx-2"))
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithBuilderPublicKey(public),
+		mekabuild.WithTopOfBlock(nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.SetMetrics(metrics)
+
+	// Until capabilities are negotiated, full blocks are requested.
+	resp, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, Txs: mempool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := mempool, resp.Txs[1:]; !reflect.DeepEqual(want, have) {
+		t.Errorf("full build: want %q, have %q", want, have)
+	}
+
+	resp, err = builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 2, ValidatorAddress: key.addr, MaxBytes: 1000, Txs: mempool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if builds := api.Builds(); len(builds) != 2 || builds[0].Mode != mekabuild.BuildModeFull || builds[1].Mode != mekabuild.BuildModeTopOfBlock {
+		t.Fatalf("builds: have %+v", builds)
+	}
+
+	a, txs, err := mekabuild.SplitAttestation(resp.Txs)
+	if err != nil || a == nil {
+		t.Fatalf("split attestation: %v, %v", a, err)
+	}
+	if want, have := [][]byte{[]byte("bundle-1"), []byte("tx-2"), []byte("tx-1"), []byte("tx-3")}, txs; !reflect.DeepEqual(want, have) {
+		t.Errorf("merged block: want %q, have %q", want, have)
+	}
+	if want, have := 2, a.TopOfBlock; want != have {
+		t.Errorf("attested txs: want %d, have %d", want, have)
+	}
+	if err := mekabuild.VerifyBuilderAttestation(a, txs, public); err != nil {
+		t.Errorf("verify attestation: %v", err)
+	}
+
+	// tx-2 is in both the mempool and the builder's segment.
+	metrics.mtx.Lock()
+	defer metrics.mtx.Unlock()
+	if len(metrics.duplicates) != 1 || metrics.duplicates[0].InMempool != 1 || metrics.duplicates[0].Duplicates != 0 {
+		t.Errorf("duplicate txs events: have %+v", metrics.duplicates)
+	}
+}
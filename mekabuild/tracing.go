@@ -0,0 +1,117 @@
+package mekabuild
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer creates spans for builder operations, so that builder latency shows
+// up in the proposer's distributed traces. It's modeled on OpenTelemetry's
+// trace.Tracer, but defined here so that this package doesn't depend on any
+// particular tracing library. An OpenTelemetry adapter looks like
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string, attrs ...mekabuild.Attribute) (context.Context, mekabuild.Span) {
+//		ctx, span := t.Tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+//		span.SetAttributes(toOtel(attrs)...)
+//		return ctx, otelSpan{span}
+//	}
+//
+//	func (otelTracer) Inject(ctx context.Context, hdr http.Header) {
+//		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(hdr))
+//	}
+//
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span with the given name and attributes, as a child
+	// of the span in ctx, if any.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+
+	// Inject writes the trace context of ctx to the headers of an outgoing
+	// request, e.g. as a W3C traceparent header.
+	Inject(ctx context.Context, hdr http.Header)
+}
+
+// Span is a single traced operation, see Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key-value pair describing a span. Values are strings, bools,
+// int64s or float64s.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span attribute keys set by the builder.
+const (
+	AttributeChainID      = "chain_id"
+	AttributeHeight       = "height"
+	AttributeTxCount      = "tx_count"
+	AttributePayloadBytes = "payload_bytes"
+	AttributeWireBytes    = "wire_bytes"
+	AttributeEndpoint     = "endpoint"
+	AttributePath         = "path"
+	AttributeRequestID    = "request_id"
+	AttributeStatusCode   = "status_code"
+	AttributeFallback     = "fallback"
+)
+
+// Span names used by the builder.
+const (
+	SpanBuildBlock         = "mekabuild.BuildBlock"
+	SpanApply              = "mekabuild.Apply"
+	SpanRegister           = "mekabuild.Register"
+	SpanUpdateRegistration = "mekabuild.UpdateRegistration"
+	SpanRequest            = "mekabuild.request" // each attempt, including retries
+)
+
+// SetTracer configures the builder to trace builds, registration, and each
+// request to the builder API with t, and to propagate trace context to the
+// API. By default, nothing is traced.
+func (b *Builder) SetTracer(t Tracer) {
+	b.tracer.Store(tracerBox{t})
+}
+
+// WithTracer sets the tracer. See SetTracer.
+func WithTracer(t Tracer) Option {
+	return func(b *Builder) error {
+		b.SetTracer(t)
+		return nil
+	}
+}
+
+type tracerBox struct{ Tracer }
+
+func (b *Builder) getTracer() Tracer {
+	box, _ := b.tracer.Load().(tracerBox)
+	return box.Tracer
+}
+
+// startSpan starts a span if a tracer is set, and otherwise returns a span
+// that does nothing.
+func (b *Builder) startSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t := b.getTracer()
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	return t.Start(ctx, name, attrs...)
+}
+
+// endSpan records err, if any, and ends the span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
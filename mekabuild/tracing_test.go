@@ -0,0 +1,151 @@
+package mekabuild_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderTracing(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx          = context.Background()
+		chainID      = "chain-id"
+		key          = newMockKey(t, "validator", nil)
+		api          = newMockAPI()
+		tracer       = &mockTracer{}
+		traceparents = make(chan string, 10)
+		server       = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceparents <- r.Header.Get("traceparent")
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	builder.SetTracer(tracer)
+
+	if _, err := builder.BuildBlock(ctx, &mekabuild.BuildBlockRequest{
+		ChainID:          chainID,
+		Height:           7,
+		ValidatorAddress: key.addr,
+		Txs:              [][]byte{[]byte("a"), []byte("b")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.finished()
+	if want, have := 2, len(spans); want != have {
+		t.Fatalf("spans: want %d, have %d", want, have)
+	}
+
+	request, build := spans[0], spans[1] // in order of ending
+	if want, have := mekabuild.SpanRequest, request.name; want != have {
+		t.Errorf("request span name: want %q, have %q", want, have)
+	}
+	if want, have := mekabuild.SpanBuildBlock, build.name; want != have {
+		t.Errorf("build span name: want %q, have %q", want, have)
+	}
+	if want, have := build.id, request.parent; want != have {
+		t.Errorf("request span parent: want %d, have %d", want, have)
+	}
+
+	for _, tc := range []struct {
+		span  *mockSpan
+		key   string
+		value interface{}
+	}{
+		{build, mekabuild.AttributeChainID, chainID},
+		{build, mekabuild.AttributeHeight, int64(7)},
+		{build, mekabuild.AttributeTxCount, int64(2)},
+		{build, mekabuild.AttributeFallback, false},
+		{request, mekabuild.AttributeEndpoint, server.URL},
+		{request, mekabuild.AttributePath, "/v0/build"},
+		{request, mekabuild.AttributeStatusCode, int64(http.StatusOK)},
+	} {
+		if want, have := tc.value, tc.span.attrs[tc.key]; want != have {
+			t.Errorf("%s %s: want %v, have %v", tc.span.name, tc.key, want, have)
+		}
+	}
+	if payload, _ := request.attrs[mekabuild.AttributePayloadBytes].(int64); payload <= 0 {
+		t.Errorf("payload bytes: want > 0, have %d", payload)
+	}
+
+	if want, have := fmt.Sprintf("span-%d", request.id), <-traceparents; want != have {
+		t.Errorf("traceparent: want %q, have %q", want, have)
+	}
+
+	if _, err := builder.Register(ctx, "payment-address", []byte("challenge"), nil); err == nil {
+		t.Fatal("register with unknown challenge succeeded")
+	}
+	spans = tracer.finished()
+	register := spans[len(spans)-1]
+	if want, have := mekabuild.SpanRegister, register.name; want != have {
+		t.Errorf("register span name: want %q, have %q", want, have)
+	}
+	if register.err == nil {
+		t.Errorf("register span: error not recorded")
+	}
+}
+
+type mockTracer struct {
+	mtx   sync.Mutex
+	next  int
+	spans []*mockSpan
+}
+
+type mockSpanKey struct{}
+
+func (t *mockTracer) Start(ctx context.Context, name string, attrs ...mekabuild.Attribute) (context.Context, mekabuild.Span) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.next++
+	s := &mockSpan{tracer: t, id: t.next, name: name, attrs: map[string]interface{}{}}
+	if parent, ok := ctx.Value(mockSpanKey{}).(*mockSpan); ok {
+		s.parent = parent.id
+	}
+	s.SetAttributes(attrs...)
+	return context.WithValue(ctx, mockSpanKey{}, s), s
+}
+
+func (t *mockTracer) Inject(ctx context.Context, hdr http.Header) {
+	if s, ok := ctx.Value(mockSpanKey{}).(*mockSpan); ok {
+		hdr.Set("traceparent", fmt.Sprintf("span-%d", s.id))
+	}
+}
+
+func (t *mockTracer) finished() []*mockSpan {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return append([]*mockSpan(nil), t.spans...)
+}
+
+type mockSpan struct {
+	tracer     *mockTracer
+	id, parent int
+	name       string
+	attrs      map[string]interface{}
+	err        error
+}
+
+func (s *mockSpan) SetAttributes(attrs ...mekabuild.Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *mockSpan) RecordError(err error) { s.err = err }
+
+func (s *mockSpan) End() {
+	s.tracer.mtx.Lock()
+	defer s.tracer.mtx.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s)
+}
@@ -0,0 +1,160 @@
+package mekabuild
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig tunes the HTTP transport used to reach the builder API. A
+// validator only proposes every so often, so with the default transport, each
+// proposal typically pays for a new TCP connection and TLS handshake, which
+// adds 100–300ms to the build request. Keeping connections alive and idle for
+// longer avoids most of that.
+//
+// Zero values mean the corresponding value of DefaultTransportConfig.
+type TransportConfig struct {
+	// MaxIdleConns limits idle connections across all hosts, and
+	// MaxIdleConnsPerHost per host, e.g. per builder API endpoint.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept open.
+	IdleConnTimeout time.Duration
+
+	// DialTimeout bounds establishing a TCP connection, and
+	// TLSHandshakeTimeout the TLS handshake that follows.
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+
+	// KeepAlive is the interval between TCP keep-alive probes, which keep
+	// idle connections open through NATs and load balancers.
+	KeepAlive time.Duration
+
+	// ExpectContinueTimeout is how long to wait for a 100 Continue
+	// response, see SetExpectContinue.
+	ExpectContinueTimeout time.Duration
+
+	// DisableKeepAlives disables HTTP keep-alives, so every request uses a
+	// new connection. It's only useful behind misbehaving proxies.
+	DisableKeepAlives bool
+
+	// DisableHTTP2 disables HTTP/2, which is used by default if the builder
+	// API supports it.
+	DisableHTTP2 bool
+}
+
+// DefaultTransportConfig returns the transport configuration used by
+// NewHTTPClient for zero values.
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       10 * time.Minute,
+		DialTimeout:           5 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		KeepAlive:             30 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// Validate checks that no limit or timeout is negative.
+func (c TransportConfig) Validate() error {
+	for _, v := range []struct {
+		name  string
+		value int64
+	}{
+		{"max idle conns", int64(c.MaxIdleConns)},
+		{"max idle conns per host", int64(c.MaxIdleConnsPerHost)},
+		{"idle conn timeout", int64(c.IdleConnTimeout)},
+		{"dial timeout", int64(c.DialTimeout)},
+		{"TLS handshake timeout", int64(c.TLSHandshakeTimeout)},
+		{"keep-alive", int64(c.KeepAlive)},
+		{"expect continue timeout", int64(c.ExpectContinueTimeout)},
+	} {
+		if v.value < 0 {
+			return fmt.Errorf("%s must not be negative, have %d", v.name, v.value)
+		}
+	}
+	return nil
+}
+
+// withDefaults returns c with zero values replaced by the defaults.
+func (c TransportConfig) withDefaults() TransportConfig {
+	def := DefaultTransportConfig()
+	if c.MaxIdleConns == 0 {
+		c.MaxIdleConns = def.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost == 0 {
+		c.MaxIdleConnsPerHost = def.MaxIdleConnsPerHost
+	}
+	if c.IdleConnTimeout == 0 {
+		c.IdleConnTimeout = def.IdleConnTimeout
+	}
+	if c.DialTimeout == 0 {
+		c.DialTimeout = def.DialTimeout
+	}
+	if c.TLSHandshakeTimeout == 0 {
+		c.TLSHandshakeTimeout = def.TLSHandshakeTimeout
+	}
+	if c.KeepAlive == 0 {
+		c.KeepAlive = def.KeepAlive
+	}
+	if c.ExpectContinueTimeout == 0 {
+		c.ExpectContinueTimeout = def.ExpectContinueTimeout
+	}
+	return c
+}
+
+// NewTransport returns an HTTP transport configured by c. Proxies are taken
+// from the environment, like with http.DefaultTransport.
+func NewTransport(c TransportConfig) (*http.Transport, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	c = c.withDefaults()
+
+	dialer := &net.Dialer{Timeout: c.DialTimeout, KeepAlive: c.KeepAlive}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          c.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		IdleConnTimeout:       c.IdleConnTimeout,
+		TLSHandshakeTimeout:   c.TLSHandshakeTimeout,
+		ExpectContinueTimeout: c.ExpectContinueTimeout,
+		DisableKeepAlives:     c.DisableKeepAlives,
+		ForceAttemptHTTP2:     !c.DisableHTTP2,
+	}
+	if c.DisableHTTP2 {
+		// A non-nil, empty map disables HTTP/2, see net/http.
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t, nil
+}
+
+// NewHTTPClient returns an HTTP client with a transport configured by c,
+// suitable for use with NewBuilder or WithHTTPClient.
+func NewHTTPClient(c TransportConfig) (*http.Client, error) {
+	t, err := NewTransport(c)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: t}, nil
+}
+
+// WithTransportConfig sets the HTTP client used to make requests to the
+// builder API to one returned by NewHTTPClient. Like WithHTTPClient, it should
+// precede options that decorate the client.
+func WithTransportConfig(c TransportConfig) Option {
+	return func(b *Builder) error {
+		cli, err := NewHTTPClient(c)
+		if err != nil {
+			return err
+		}
+		b.client = cli
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+package mekabuild_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestNewTransport(t *testing.T) {
+	t.Parallel()
+
+	tr, err := mekabuild.NewTransport(mekabuild.TransportConfig{IdleConnTimeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := mekabuild.DefaultTransportConfig()
+	if want, have := time.Minute, tr.IdleConnTimeout; want != have {
+		t.Errorf("idle conn timeout: want %s, have %s", want, have)
+	}
+	if want, have := def.MaxIdleConnsPerHost, tr.MaxIdleConnsPerHost; want != have {
+		t.Errorf("max idle conns per host: want %d, have %d", want, have)
+	}
+	if !tr.ForceAttemptHTTP2 || tr.TLSNextProto != nil {
+		t.Errorf("HTTP/2: want enabled")
+	}
+
+	tr, err = mekabuild.NewTransport(mekabuild.TransportConfig{DisableHTTP2: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.ForceAttemptHTTP2 || tr.TLSNextProto == nil {
+		t.Errorf("HTTP/2: want disabled")
+	}
+
+	if _, err := mekabuild.NewTransport(mekabuild.TransportConfig{TLSHandshakeTimeout: -time.Second}); err == nil {
+		t.Errorf("negative timeout: want error, have none")
+	}
+}
+
+func TestWithTransportConfig(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx     = context.Background()
+		chainID = "chain-id"
+		key     = newMockKey(t, "validator", nil)
+		api     = newMockAPI()
+		conns   int32
+		server  = httptest.NewUnstartedServer(mekabuild.GunzipRequestMiddleware(api))
+	)
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+	apiURL, _ := url.Parse(server.URL)
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithTransportConfig(mekabuild.TransportConfig{}),
+		mekabuild.WithEndpoints(apiURL),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for height := int64(1); height <= 5; height++ {
+		req := &mekabuild.BuildBlockRequest{ChainID: chainID, Height: height, ValidatorAddress: key.addr, Txs: [][]byte{[]byte("tx")}}
+		if _, err := builder.BuildBlock(ctx, req); err != nil {
+			t.Fatalf("height %d: %v", height, err)
+		}
+	}
+	if want, have := int32(1), atomic.LoadInt32(&conns); want != have {
+		t.Errorf("connections: want %d, have %d", want, have)
+	}
+
+	if _, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithTransportConfig(mekabuild.TransportConfig{MaxIdleConns: -1})); err == nil {
+		t.Errorf("invalid config: want error, have none")
+	}
+}
@@ -0,0 +1,214 @@
+package mekabuild
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// TxDirection tells a TxFilter whether a tx is about to be sent to the builder
+// API, or was received from it.
+type TxDirection int
+
+// Tx directions.
+const (
+	// TxOutgoing is a mempool tx of a build request.
+	TxOutgoing TxDirection = iota
+
+	// TxIncoming is a tx of a build response.
+	TxIncoming
+)
+
+func (d TxDirection) String() string {
+	switch d {
+	case TxOutgoing:
+		return "outgoing"
+	case TxIncoming:
+		return "incoming"
+	default:
+		return fmt.Sprintf("TxDirection(%d)", int(d))
+	}
+}
+
+// TxFilter decides which txs are exchanged with the builder API. Outgoing txs
+// it drops, e.g. sensitive txs, are never sent, and incoming txs it drops,
+// e.g. txs matching a blocklist, are removed from the block. Unlike a Policy,
+// which rejects whole blocks, a filter only drops the txs it matches.
+//
+// FilterTx is called for every tx of every build, one tx after another, on
+// the goroutine making the request, so it should be fast. Concurrent builds
+// call it concurrently, so it must be safe for concurrent use.
+type TxFilter interface {
+	FilterTx(dir TxDirection, tx []byte) PolicyDecision
+}
+
+// TxFilterFunc adapts a function to a TxFilter.
+type TxFilterFunc func(dir TxDirection, tx []byte) PolicyDecision
+
+// FilterTx implements TxFilter.
+func (f TxFilterFunc) FilterTx(dir TxDirection, tx []byte) PolicyDecision {
+	return f(dir, tx)
+}
+
+// ErrTxFiltered is returned when the tx filter drops txs of a build response
+// which can't be removed from the block, see SetTxFilter.
+var ErrTxFiltered = errors.New("response txs filtered")
+
+// TxBlocklist is a TxFilter dropping txs in both directions, by sender, e.g.
+// per a sanctions list, or by content, e.g. per known spam patterns.
+type TxBlocklist struct {
+	// Senders are the blocked signer addresses. Entries ending in "*"
+	// match by prefix.
+	Senders []string
+
+	// Patterns are matched against the raw bytes of txs.
+	Patterns []*regexp.Regexp
+
+	// Decode is required if Senders is set. Txs that can't be decoded are
+	// dropped.
+	Decode TxDecoder
+}
+
+// NewTxBlocklist returns a blocklist of the given senders and patterns, which
+// are compiled as regular expressions.
+func NewTxBlocklist(senders, patterns []string, decode TxDecoder) (*TxBlocklist, error) {
+	if len(senders) > 0 && decode == nil {
+		return nil, errors.New("blocklist has senders, but no tx decoder is set")
+	}
+	l := &TxBlocklist{Senders: senders, Decode: decode}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", p, err)
+		}
+		l.Patterns = append(l.Patterns, re)
+	}
+	return l, nil
+}
+
+// FilterTx implements TxFilter.
+func (l *TxBlocklist) FilterTx(dir TxDirection, tx []byte) PolicyDecision {
+	for _, re := range l.Patterns {
+		if re.Match(tx) {
+			return PolicyDecision{Rule: "pattern", Reason: fmt.Sprintf("matches pattern %q", re.String())}
+		}
+	}
+
+	if len(l.Senders) > 0 {
+		if l.Decode == nil {
+			return PolicyDecision{Reason: "no tx decoder"}
+		}
+		info, err := l.Decode(tx)
+		if err != nil {
+			return PolicyDecision{Reason: fmt.Sprintf("decode tx: %v", err)}
+		}
+		if matchesAny(info.Senders, l.Senders) {
+			return PolicyDecision{Rule: "sender", Reason: "blocked sender"}
+		}
+	}
+
+	return PolicyDecision{Allowed: true}
+}
+
+// SetTxFilter sets the filter of the txs exchanged with the builder API.
+// Outgoing txs it drops are removed from build requests before signing, and
+// are therefore also left out of top-of-block merges. Incoming txs it drops
+// are removed from build responses, after verification. Mandatory txs are
+// exempt. Responses are rejected with an error wrapping ErrTxFiltered, so
+// BuildBlock falls back, if the filter drops an attested tx. A nil filter
+// disables filtering, which is the default.
+func (b *Builder) SetTxFilter(f TxFilter) {
+	b.txFilter.Store(txFilterBox{f})
+}
+
+// WithTxFilter sets the filter of the txs exchanged with the builder API. See
+// SetTxFilter.
+func WithTxFilter(f TxFilter) Option {
+	return func(b *Builder) error {
+		b.SetTxFilter(f)
+		return nil
+	}
+}
+
+type txFilterBox struct{ TxFilter }
+
+func (b *Builder) getTxFilter() TxFilter {
+	box, _ := b.txFilter.Load().(txFilterBox)
+	return box.TxFilter
+}
+
+// filterRequest drops the outgoing txs denied by the tx filter from req.
+func (b *Builder) filterRequest(req *BuildBlockRequest) {
+	f := b.getTxFilter()
+	if f == nil {
+		return
+	}
+
+	kept := make([][]byte, 0, len(req.Txs))
+	for i, tx := range req.Txs {
+		if d := f.FilterTx(TxOutgoing, tx); !d.Allowed {
+			b.getLogger().Infof("tx filter dropped tx: chain_id=%s height=%d direction=%s index=%d reason=%q", req.ChainID, req.Height, TxOutgoing, i, d.Reason)
+			continue
+		}
+		kept = append(kept, tx)
+	}
+	req.Txs = kept
+}
+
+// filterResponse drops the incoming txs denied by the tx filter from resp,
+// following its attestation tx, if any. It must follow response verification,
+// whose signatures cover the txs as returned.
+func (b *Builder) filterResponse(req *BuildBlockRequest, resp *BuildBlockResponse) error {
+	f := b.getTxFilter()
+	if f == nil {
+		return nil
+	}
+
+	a, txs, err := SplitAttestation(resp.Txs)
+	if err != nil {
+		return err
+	}
+
+	mandatory := make(map[string]bool, len(req.MandatoryTxs))
+	for _, m := range req.MandatoryTxs {
+		mandatory[string(m.Tx)] = true
+	}
+
+	var (
+		kept    = make([][]byte, 0, len(txs))
+		dropped = map[int]PolicyDecision{}
+		first   = -1
+	)
+	for i, tx := range txs {
+		if !mandatory[string(tx)] {
+			if d := f.FilterTx(TxIncoming, tx); !d.Allowed {
+				dropped[i] = d
+				if first < 0 {
+					first = i
+				}
+				continue
+			}
+		}
+		kept = append(kept, tx)
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+
+	if a != nil {
+		attested, err := a.AttestedTxs(txs)
+		if err != nil {
+			return err
+		}
+		if first < len(attested) {
+			return fmt.Errorf("%w: tx %d is attested: %s", ErrTxFiltered, first, dropped[first].Reason)
+		}
+		kept = append([][]byte{resp.Txs[0]}, kept...)
+	}
+
+	for i, d := range dropped {
+		b.getLogger().Infof("tx filter dropped tx: chain_id=%s height=%d direction=%s index=%d reason=%q", req.ChainID, req.Height, TxIncoming, i, d.Reason)
+	}
+	resp.Txs = kept
+	return nil
+}
@@ -0,0 +1,129 @@
+package mekabuild_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestTxBlocklist(t *testing.T) {
+	t.Parallel()
+
+	if _, err := mekabuild.NewTxBlocklist([]string{"cosmos1bad"}, nil, nil); err == nil {
+		t.Errorf("senders without decoder: want error, have none")
+	}
+	if _, err := mekabuild.NewTxBlocklist(nil, []string{"("}, nil); err == nil {
+		t.Errorf("invalid pattern: want error, have none")
+	}
+
+	l, err := mekabuild.NewTxBlocklist([]string{"cosmos1bad", "cosmos1evil*"}, []string{"(?i)airdrop"}, decodeTestTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		tx      string
+		allowed bool
+	}{
+		{"/cosmos.bank.v1beta1.MsgSend|cosmos1good", true},
+		{"/cosmos.bank.v1beta1.MsgSend|cosmos1bad", false},
+		{"/cosmos.bank.v1beta1.MsgSend|cosmos1evil42", false},
+		{"/cosmos.bank.v1beta1.MsgSend|cosmos1good|claim your AIRDROP", false},
+		{"malformed", false},
+	} {
+		for _, dir := range []mekabuild.TxDirection{mekabuild.TxOutgoing, mekabuild.TxIncoming} {
+			if want, have := tc.allowed, l.FilterTx(dir, []byte(tc.tx)).Allowed; want != have {
+				t.Errorf("%s: %s: allowed: want %v, have %v", tc.tx, dir, want, have)
+			}
+		}
+	}
+}
+
+func TestBuilderTxFilter(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		key       = newMockKey(t, "validator", nil)
+		submitted = make(chan [][]byte, 1)
+		server    = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req mekabuild.BuildBlockRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			submitted <- req.Txs
+			json.NewEncoder(w).Encode(mekabuild.BuildBlockResponse{Txs: append(req.Txs, []byte("/cosmos.bank.v1beta1.MsgSend|cosmos1bad"))})
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		builder   = mekabuild.NewBuilder(&http.Client{}, apiURL, key, "chain-id", key.addr)
+	)
+
+	l, err := mekabuild.NewTxBlocklist([]string{"cosmos1bad"}, nil, decodeTestTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.SetTxFilter(mekabuild.TxFilterFunc(func(dir mekabuild.TxDirection, tx []byte) mekabuild.PolicyDecision {
+		if dir == mekabuild.TxOutgoing && string(tx) == "/cosmos.bank.v1beta1.MsgSend|cosmos1private" {
+			return mekabuild.PolicyDecision{Reason: "private"}
+		}
+		return l.FilterTx(dir, tx)
+	}))
+
+	var (
+		good = []byte("/cosmos.bank.v1beta1.MsgSend|cosmos1good")
+		req  = &mekabuild.BuildBlockRequest{ChainID: "chain-id", Height: 1, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1, Txs: [][]byte{
+			good,
+			[]byte("/cosmos.bank.v1beta1.MsgSend|cosmos1private"),
+		}}
+	)
+	resp, err := builder.BuildBlock(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := [][]byte{good}, <-submitted; !reflect.DeepEqual(want, have) {
+		t.Errorf("submitted txs: want %q, have %q", want, have)
+	}
+	if want, have := [][]byte{good}, resp.Txs; !reflect.DeepEqual(want, have) {
+		t.Errorf("response txs: want %q, have %q", want, have)
+	}
+}
+
+func TestBuilderTxFilterAttested(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx       = context.Background()
+		chainID   = "test-chain-id"
+		key       = newMockKey(t, "foo", nil)
+		api       = newMockAPI()
+		server    = newTestServer(t, api)
+		apiURL, _ = url.Parse(server.URL)
+		mempool   = [][]byte{[]byte("tx-1"), []byte("tx-2")}
+	)
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.SetBuilderKey(private)
+	api.SetAttestations(true)
+
+	incoming := mekabuild.TxFilterFunc(func(dir mekabuild.TxDirection, tx []byte) mekabuild.PolicyDecision {
+		return mekabuild.PolicyDecision{Allowed: dir == mekabuild.TxOutgoing || string(tx) != "tx-2", Reason: "blocked"}
+	})
+	b, err := mekabuild.New(key, chainID, key.addr, mekabuild.WithEndpoints(apiURL), mekabuild.WithBuilderPublicKey(public), mekabuild.WithTxFilter(incoming))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = b.BuildBlock(ctx, &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1, Txs: mempool})
+	if !errors.Is(err, mekabuild.ErrTxFiltered) {
+		t.Errorf("attested tx filtered: want %v, have %v", mekabuild.ErrTxFiltered, err)
+	}
+}
@@ -14,6 +14,12 @@ type Signer interface {
 	SignBuildBlockRequest(*BuildBlockRequest) error
 }
 
+// ChallengeSigner is implemented by signers that can also sign registration
+// challenges issued by the builder API. See ChallengeSignBytes for detail.
+type ChallengeSigner interface {
+	SignChallenge(challenge []byte) ([]byte, error)
+}
+
 // BuildBlockRequest represents a request from a validator to the build endpoint
 // of the builder API. In order to meet the pattern used by other signable types
 // in Tendermint, it contains a Signature field that needs to be set by callers.
@@ -26,7 +32,93 @@ type BuildBlockRequest struct {
 	MaxGas           int64    `json:"max_gas"`
 	Txs              [][]byte `json:"txs"`
 
+	// TxsHashVersion selects how Txs are hashed for the signature. The
+	// zero value is the original sequential scheme.
+	TxsHashVersion TxsHashVersion `json:"txs_hash_version,omitempty"`
+
+	// KeyType identifies the type of the validator key that signs the
+	// request, e.g. KeyTypeSecp256k1. The zero value means KeyTypeEd25519.
+	KeyType string `json:"key_type,omitempty"`
+
+	// Nonce and Timestamp protect against replay of captured requests. The
+	// nonce increases monotonically per builder, and the timestamp is the
+	// signing time in Unix milliseconds. Both are covered by the signature
+	// when either is set, and are set by the Builder when replay protection
+	// is enabled, see SetReplayProtection.
+	Nonce     uint64 `json:"nonce,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+
+	// DomainTag is the chain-specific domain tag the validator registered
+	// with, if any. It's covered by the signature when set, and set by the
+	// Builder, see SetDomainTag.
+	DomainTag string `json:"domain_tag,omitempty"`
+
+	// ProviderChainID and ConsumerID identify the provider chain, and the
+	// consumer chain on it, for requests signed with the key of a provider
+	// chain validator. They're covered by the signature when set, and set
+	// by the Builder, see SetConsumerChain.
+	ProviderChainID string `json:"provider_chain_id,omitempty"`
+	ConsumerID      string `json:"consumer_id,omitempty"`
+
+	// Mode selects what the builder API returns, see BuildMode. It's
+	// covered by the signature when set, and set by the Builder, see
+	// SetTopOfBlock.
+	Mode BuildMode `json:"mode,omitempty"`
+
 	Signature []byte `json:"signature"`
+
+	// Presign is set for presigned requests, see Builder.Presign. Then
+	// Signature is the session key's signature over the txs commitment.
+	Presign *Presignature `json:"presign,omitempty"`
+
+	// MandatoryTxs must be included in the block by the builder API, at
+	// their preferred positions. They're covered by the signature when
+	// set. See WithInjectedTxs.
+	MandatoryTxs []MandatoryTx `json:"mandatory_txs,omitempty"`
+
+	// Cosigners is set by a ThresholdSigner to the cosigners whose shares
+	// were aggregated into Signature. It's covered by the signature when
+	// set.
+	Cosigners *CosignerSet `json:"cosigners,omitempty"`
+
+	// Hint is optional, and not covered by the signature. If it's nil,
+	// the Builder fills it in with its own measurements.
+	Hint *AuctionHint `json:"hint,omitempty"`
+
+	// FeeMarket is optional, and not covered by the signature. If it's nil,
+	// the Builder fills it in from the context, see WithFeeMarket.
+	FeeMarket *FeeMarket `json:"fee_market,omitempty"`
+}
+
+// AuctionHint lets the builder API tune how long it holds the auction for a
+// specific validator. Well-connected validators with time to spare can afford
+// longer auctions, and higher payments, than distant ones.
+type AuctionHint struct {
+	// RTTMillis is the measured round-trip time between the validator and
+	// the builder API endpoint, in milliseconds, or 0 if unknown.
+	RTTMillis int64 `json:"rtt_ms,omitempty"`
+
+	// TimeBudgetMillis is the time remaining before the validator stops
+	// waiting for a response, in milliseconds, or 0 if unbounded.
+	TimeBudgetMillis int64 `json:"time_budget_ms,omitempty"`
+}
+
+// SignBytes returns the bytes that should be signed for the request, honoring
+// its TxsHashVersion, KeyType, DomainTag, consumer chain and Mode. Signers
+// should prefer it to calling BuildBlockRequestSignBytes directly.
+func (r *BuildBlockRequest) SignBytes() ([]byte, error) {
+	txsHash, err := HashTxsVersion(r.TxsHashVersion, r.Txs...)
+	if err != nil {
+		return nil, err
+	}
+	signBytes := BuildBlockRequestSignBytesVersion(r.TxsHashVersion, r.ChainID, r.Height, r.ValidatorAddress, r.MaxBytes, r.MaxGas, txsHash)
+	signBytes = bindMandatoryTxs(r.MandatoryTxs, signBytes)
+	signBytes = bindCosigners(r.Cosigners, signBytes)
+	signBytes = bindReplayProtection(r.Nonce, r.Timestamp, signBytes)
+	signBytes = bindKeyType(r.KeyType, signBytes)
+	signBytes = bindDomainTag(r.DomainTag, signBytes)
+	signBytes = bindConsumerChain(r.ProviderChainID, r.ConsumerID, signBytes)
+	return bindBuildMode(r.Mode, signBytes), nil
 }
 
 // HashTxs returns the sha256 sum of all given txs.
@@ -64,10 +156,42 @@ func BuildBlockRequestSignBytes(chainID string, height int64, validatorAddr stri
 	return sb.Bytes()
 }
 
+// ChallengeSignBytes returns a stable byte representation of a registration
+// challenge issued by the builder API.
+func ChallengeSignBytes(challenge []byte) []byte {
+	// SECURITY 🚨 As with BuildBlockRequestSignBytes, the constant prefix
+	// prevents the challenge from being used to sign arbitrary bytes.
+
+	var sb bytes.Buffer
+	mustEncode(&sb, []byte(`register-challenge`))
+	mustEncode(&sb, uint64(len(challenge)))
+	mustEncode(&sb, challenge)
+	return sb.Bytes()
+}
+
 // BuildBlockResponse is returned by the build endpoint of the builder API.
 type BuildBlockResponse struct {
 	Txs              [][]byte `json:"txs"`
 	ValidatorPayment string   `json:"validator_payment,omitempty"`
+
+	// AuctionID identifies the auction outcome the response reflects. It's
+	// set by builder APIs that support CapabilityConfirmation, and is
+	// needed to confirm the build, see ConfirmBuild.
+	AuctionID string `json:"auction_id,omitempty"`
+
+	// Receipt is the builder API's signed receipt for ValidatorPayment, if
+	// it issues them. It's checked against the response, and its signature
+	// is verified if the Builder has a pinned builder public key.
+	Receipt *PaymentReceipt `json:"receipt,omitempty"`
+
+	// Signature is the builder API's signature over the response, see
+	// BuildBlockResponseSignBytes. It's verified if the Builder has a pinned
+	// builder public key.
+	Signature []byte `json:"signature,omitempty"`
+
+	// Fallback is set when the response was assembled locally by the
+	// builder's Fallback, rather than returned by the builder API.
+	Fallback bool `json:"-"`
 }
 
 func mustEncode(w io.Writer, v interface{}) {
@@ -1,6 +1,7 @@
 package mekabuild
 
 import (
+	"fmt"
 	"net/url"
 	"os"
 	"strconv"
@@ -9,13 +10,15 @@ import (
 
 // DryRunMode returns true if the MEKATEK_BUILDER_API_DRY_RUN or
 // ZENITH_DRY_RUN environment variable is set to true. This can control
-// behavior in the Tendermint integration.
+// behavior in the Tendermint integration, e.g. to use a DryRunBuilder.
+// Malformed values are ignored, see LookupDryRunMode.
 func DryRunMode() bool {
 	for _, v := range []string{
 		"ZENITH_DRY_RUN",
 		"MEKATEK_BUILDER_API_DRY_RUN",
 	} {
 		if b, err := strconv.ParseBool(os.Getenv(v)); err == nil {
+			checkDeprecatedEnv(v)
 			return b
 		}
 	}
@@ -24,32 +27,139 @@ func DryRunMode() bool {
 
 // GetBuilderAPIURL returns a url.URL that points to the Mekatek builder API. If
 // necessary, it can be overridden via the MEKATEK_BUILDER_API_URL or ZENITH_API_URL
-// environment variable.
+// environment variable. Otherwise, in sandbox mode, it points to the sandbox
+// builder API, see SandboxMode. Use ResolveEndpoint to learn why. Malformed
+// values are ignored, see LookupBuilderAPIURL.
 func GetBuilderAPIURL() *url.URL {
-	var s string
+	return ResolveEndpoint().URL
+}
+
+// EndpointResolution describes how the builder API URL was resolved from the
+// environment: which setting produced it, and which settings were ignored.
+type EndpointResolution struct {
+	URL     *url.URL
+	Source  string // e.g. "env:MEKATEK_BUILDER_API_URL", see EndpointSourceDefault
+	Ignored []IgnoredSetting
+}
+
+// IgnoredSetting is a setting that was present, but didn't affect the
+// resolved builder API URL.
+type IgnoredSetting struct {
+	Source string
+	Value  string // redacted
+	Reason string
+}
+
+// Endpoint sources which aren't environment variables.
+const (
+	EndpointSourceDefault  = "default"
+	EndpointSourceExplicit = "explicit" // set by NewBuilder, or an option
+)
+
+// ResolveEndpoint resolves the builder API URL from the environment, like
+// GetBuilderAPIURL, and reports its provenance. The first URL variable that's
+// set wins, then sandbox mode, then the default. If the winning URL is
+// invalid, the default is used.
+func ResolveEndpoint() EndpointResolution {
+	var (
+		res             EndpointResolution
+		winner, winning string // first URL variable that's set, and its value
+	)
+	ignore := func(source, value, reason string) {
+		res.Ignored = append(res.Ignored, IgnoredSetting{source, redact(value), reason})
+	}
+
 	for _, v := range []string{
 		"ZENITH_API_URL",
 		"MEKATEK_BUILDER_API_URL",
 	} {
-		if s = os.Getenv(v); s != "" {
-			break
+		s := os.Getenv(v)
+		switch {
+		case s == "":
+			continue
+		case winner != "":
+			ignore("env:"+v, s, "overridden by env:"+winner)
+			continue
 		}
+		checkDeprecatedEnv(v)
+		winner, winning = v, s
 	}
 
-	if s == "" {
-		return defaultBuilderAPIURL
+	if s := os.Getenv("MEKATEK_BUILDER_API_SANDBOX"); s != "" {
+		sandbox, err := strconv.ParseBool(s)
+		switch {
+		case err != nil:
+			ignore("env:MEKATEK_BUILDER_API_SANDBOX", s, "invalid boolean")
+		case sandbox && winner != "":
+			ignore("env:MEKATEK_BUILDER_API_SANDBOX", s, "overridden by env:"+winner)
+		case sandbox:
+			res.URL, res.Source = SandboxBuilderAPIURL(), "env:MEKATEK_BUILDER_API_SANDBOX"
+			return res
+		}
 	}
 
+	if winner == "" {
+		res.URL, res.Source = defaultURL(), EndpointSourceDefault
+		return res
+	}
+
+	s := winning
 	if !strings.HasPrefix(s, "http") {
 		s = defaultBuilderAPIURL.Scheme + "://" + s
 	}
 
 	u, err := url.Parse(s)
 	if err != nil {
-		return defaultBuilderAPIURL
+		ignore("env:"+winner, winning, "invalid URL")
+		res.URL, res.Source = defaultURL(), EndpointSourceDefault
+		return res
 	}
 
-	return u
+	res.URL, res.Source = u, "env:"+winner
+	return res
+}
+
+// String describes the resolution for logs, with redacted URLs.
+func (r EndpointResolution) String() string {
+	s := fmt.Sprintf("url=%s source=%s", redact(r.URL.String()), r.Source)
+	for _, i := range r.Ignored {
+		s += fmt.Sprintf(" ignored=%s(%q: %s)", i.Source, i.Value, i.Reason)
+	}
+	return s
+}
+
+// EndpointResolution reports the provenance of the builder's preferred
+// endpoint. It's the resolution from the environment if the builder was
+// constructed by New, and its endpoint wasn't changed since. Otherwise, the
+// source is EndpointSourceExplicit.
+func (b *Builder) EndpointResolution() EndpointResolution {
+	endpoint := b.Endpoints()[0]
+	if r := b.resolution; r != nil && r.URL.String() == endpoint.String() {
+		return *r
+	}
+	res := EndpointResolution{URL: endpoint, Source: EndpointSourceExplicit}
+	if r := b.resolution; r != nil {
+		res.Ignored = append(append(res.Ignored, r.Ignored...), IgnoredSetting{Source: r.Source, Value: redact(r.URL.String()), Reason: "overridden by " + EndpointSourceExplicit})
+	}
+	return res
+}
+
+func defaultURL() *url.URL {
+	u := *defaultBuilderAPIURL
+	return &u
+}
+
+// deprecatedEnv maps deprecated environment variables to their replacements.
+var deprecatedEnv = map[string]string{
+	"ZENITH_DRY_RUN":   "MEKATEK_BUILDER_API_DRY_RUN",
+	"ZENITH_API_URL":   "MEKATEK_BUILDER_API_URL",
+	"ZENITH_STATE_KEY": "MEKATEK_BUILDER_API_STATE_KEY",
+}
+
+func checkDeprecatedEnv(name string) {
+	if replacement, ok := deprecatedEnv[name]; ok {
+		reportDeprecatedEnv(name, replacement)
+	}
 }
 
 var defaultBuilderAPIURL = &url.URL{Scheme: "https", Host: "api.mekatek.xyz"}
@@ -0,0 +1,125 @@
+package mekabuild
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// APIVersion is a version of the builder API, which determines its routes and
+// request schemas.
+type APIVersion string
+
+// Known API versions. The v1 request schemas are currently identical to v0,
+// and v1 routes differ only in their prefix.
+const (
+	APIVersionV0 APIVersion = "v0"
+	APIVersionV1 APIVersion = "v1"
+)
+
+// API version headers. The builder sends the versions it accepts, in order of
+// preference, in AcceptVersionHeader on every request, and the builder API
+// responds with the version it selected in APIVersionHeader.
+const (
+	AcceptVersionHeader = "accept-version"
+	APIVersionHeader    = "mekatek-api-version"
+)
+
+// defaultAPIVersions are the versions implemented by this package, in order of
+// preference.
+var defaultAPIVersions = []APIVersion{APIVersionV1, APIVersionV0}
+
+// SetAPIVersions sets the API versions the builder accepts, in order of
+// preference. It should only be used to pin a version, e.g. during a staged
+// rollout. By default, every version implemented by this package is accepted,
+// newest first.
+func (b *Builder) SetAPIVersions(versions ...APIVersion) error {
+	if len(versions) == 0 {
+		return fmt.Errorf("at least one API version is required")
+	}
+	for _, v := range versions {
+		if !containsAPIVersion(defaultAPIVersions, v) {
+			return fmt.Errorf("unknown API version %q", v)
+		}
+	}
+	b.apiVersions.Store(append([]APIVersion(nil), versions...))
+	return nil
+}
+
+func (b *Builder) acceptedAPIVersions() []APIVersion {
+	versions, _ := b.apiVersions.Load().([]APIVersion)
+	if len(versions) == 0 {
+		return defaultAPIVersions
+	}
+	return versions
+}
+
+// APIVersion returns the API version negotiated with the builder API. The ok
+// return is false if no negotiation has taken place yet, in which case v0 is
+// used.
+func (b *Builder) APIVersion() (v APIVersion, ok bool) {
+	v, ok = b.apiVersion.Load().(APIVersion)
+	if !ok {
+		return APIVersionV0, false
+	}
+	return v, true
+}
+
+// NegotiateVersion pings the builder API to negotiate the API version, and
+// returns it. Versions are also negotiated on every response, so calling it is
+// optional, but it lets the first build use the negotiated version.
+func (b *Builder) NegotiateVersion(ctx context.Context) (APIVersion, error) {
+	if _, err := b.Ping(ctx); err != nil {
+		return "", fmt.Errorf("negotiate API version: %w", err)
+	}
+	v, _ := b.APIVersion()
+	return v, nil
+}
+
+// WithVersionNegotiation negotiates the API version when the builder is
+// constructed. See NegotiateVersion. It should follow options configuring the
+// HTTP client and endpoints.
+func WithVersionNegotiation(ctx context.Context) Option {
+	return func(b *Builder) error {
+		_, err := b.NegotiateVersion(ctx)
+		return err
+	}
+}
+
+// observeAPIVersion records the version selected by the builder API, if the
+// builder accepts it.
+func (b *Builder) observeAPIVersion(header string) {
+	v := APIVersion(strings.TrimSpace(header))
+	if containsAPIVersion(b.acceptedAPIVersions(), v) {
+		b.apiVersion.Store(v)
+	}
+}
+
+// acceptVersionHeader returns the value of AcceptVersionHeader.
+func (b *Builder) acceptVersionHeader() string {
+	versions := b.acceptedAPIVersions()
+	ss := make([]string, len(versions))
+	for i, v := range versions {
+		ss[i] = string(v)
+	}
+	return strings.Join(ss, ", ")
+}
+
+// versionedPath maps a v0 route, as used throughout the builder, to the route
+// of the negotiated API version.
+func (b *Builder) versionedPath(path string) string {
+	v, _ := b.APIVersion()
+	if v == APIVersionV0 || !strings.HasPrefix(path, "/v0/") {
+		return path
+	}
+	return "/" + string(v) + strings.TrimPrefix(path, "/v0")
+}
+
+func containsAPIVersion(versions []APIVersion, v APIVersion) bool {
+	for _, x := range versions {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package mekabuild_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestBuilderVersionNegotiation(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx     = context.Background()
+		chainID = "chain-id"
+		key     = newMockKey(t, "validator", nil)
+		api     = newMockAPI()
+		paths   = make(chan string, 10)
+		server  = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths <- r.URL.Path
+
+			// Select the client's most preferred version.
+			accepted := strings.Split(r.Header.Get(mekabuild.AcceptVersionHeader), ",")
+			w.Header().Set(mekabuild.APIVersionHeader, strings.TrimSpace(accepted[0]))
+
+			r.URL.Path = "/v0/" + strings.SplitN(r.URL.Path, "/", 3)[2]
+			api.ServeHTTP(w, r)
+		}))
+		apiURL, _ = url.Parse(server.URL)
+		newReq    = func() *mekabuild.BuildBlockRequest {
+			return &mekabuild.BuildBlockRequest{ChainID: chainID, Height: 1, ValidatorAddress: key.addr, MaxBytes: 1000, MaxGas: -1}
+		}
+	)
+
+	api.AddPublicKey(chainID, key.addr, key.PublicKey)
+
+	unnegotiated := mekabuild.NewBuilder(&http.Client{}, apiURL, key, chainID, key.addr)
+	if v, ok := unnegotiated.APIVersion(); ok || v != mekabuild.APIVersionV0 {
+		t.Errorf("before negotiation: want %q, false, have %q, %v", mekabuild.APIVersionV0, v, ok)
+	}
+
+	builder, err := mekabuild.New(key, chainID, key.addr,
+		mekabuild.WithEndpoints(apiURL),
+		mekabuild.WithVersionNegotiation(ctx),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "/v0/ping", <-paths; want != have {
+		t.Errorf("negotiation path: want %q, have %q", want, have)
+	}
+	if v, ok := builder.APIVersion(); !ok || v != mekabuild.APIVersionV1 {
+		t.Errorf("negotiated version: want %q, true, have %q, %v", mekabuild.APIVersionV1, v, ok)
+	}
+
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "/v1/build", <-paths; want != have {
+		t.Errorf("build path: want %q, have %q", want, have)
+	}
+
+	// Pinning v0 downgrades on the next response.
+	if err := builder.SetAPIVersions(mekabuild.APIVersionV0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Fatal(err)
+	}
+	<-paths
+	if v, _ := builder.APIVersion(); v != mekabuild.APIVersionV0 {
+		t.Errorf("pinned version: want %q, have %q", mekabuild.APIVersionV0, v)
+	}
+	if _, err := builder.BuildBlock(ctx, newReq()); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "/v0/build", <-paths; want != have {
+		t.Errorf("pinned build path: want %q, have %q", want, have)
+	}
+
+	if err := builder.SetAPIVersions("v9"); err == nil {
+		t.Errorf("unknown version: want error, have none")
+	}
+}
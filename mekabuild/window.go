@@ -0,0 +1,300 @@
+package mekabuild
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// A validator only earns the builder's payment if BuildBlock returns before
+// the proposal window closes. SimulateProposalWindow models whether it does,
+// from historical mempool sizes, network round-trip times and the consensus
+// timeouts of the chain, so operators can choose a timeout and compression
+// before going live, rather than tuning them on missed proposals.
+
+// CompressionProfile describes how a request compression performs on a
+// chain's txs. See MeasureCompression.
+type CompressionProfile struct {
+	// Name is the compression, e.g. "gzip", as used by Config.Compression.
+	Name string
+
+	// Ratio is the compressed size as a fraction of the original size, in
+	// (0, 1].
+	Ratio float64
+
+	// BytesPerSecond is the compression throughput, in uncompressed bytes.
+	// Zero means compression takes no time.
+	BytesPerSecond float64
+}
+
+// DefaultCompressionProfiles are rough profiles of the request compressions
+// supported by Config, for typical Cosmos SDK txs. Profiles measured on the
+// chain's own txs are more accurate.
+var DefaultCompressionProfiles = []CompressionProfile{
+	{Name: "none", Ratio: 1},
+	{Name: "gzip", Ratio: 0.35, BytesPerSecond: 40e6},
+	{Name: "snappy", Ratio: 0.55, BytesPerSecond: 400e6},
+}
+
+// MeasureCompression measures the profile of c on sample, e.g. the txs of a
+// recent block.
+func MeasureCompression(name string, c Compressor, sample [][]byte) (CompressionProfile, error) {
+	size := txsSize(sample)
+	if size == 0 {
+		return CompressionProfile{}, errors.New("empty sample")
+	}
+
+	var buf bytes.Buffer
+	begin := time.Now()
+	w, err := c.NewWriter(&buf)
+	if err != nil {
+		return CompressionProfile{}, err
+	}
+	for _, tx := range sample {
+		if _, err := w.Write(tx); err != nil {
+			return CompressionProfile{}, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return CompressionProfile{}, err
+	}
+	took := time.Since(begin)
+
+	p := CompressionProfile{Name: name, Ratio: float64(buf.Len()) / float64(size)}
+	if p.Ratio > 1 {
+		p.Ratio = 1 // incompressible, sending it uncompressed is better
+	}
+	if took > 0 {
+		p.BytesPerSecond = float64(size) / took.Seconds()
+	}
+	return p, nil
+}
+
+// ProposalWindowScenario describes the conditions under which a validator
+// proposes blocks.
+type ProposalWindowScenario struct {
+	// MempoolBytes are samples of the total size of the txs in the mempool
+	// when the validator proposed, e.g. one per recent height.
+	MempoolBytes []int64
+
+	// RTTs are samples of the round-trip time to the builder API, e.g. as
+	// measured by Ping.
+	RTTs []time.Duration
+
+	// TimeoutPropose is the chain's consensus timeout_propose.
+	TimeoutPropose time.Duration
+
+	// PropagationMargin is the part of TimeoutPropose needed to propagate
+	// the proposed block to the other validators, which isn't available to
+	// BuildBlock. Zero means DefaultPropagationMargin.
+	PropagationMargin time.Duration
+
+	// UploadBytesPerSecond is the validator's upload bandwidth to the
+	// builder API, and DownloadBytesPerSecond its download bandwidth. Zero
+	// download bandwidth means the upload bandwidth.
+	UploadBytesPerSecond   float64
+	DownloadBytesPerSecond float64
+
+	// AuctionTime is the time the builder API holds the auction, and
+	// SignTime the time taken to sign the build request.
+	AuctionTime time.Duration
+	SignTime    time.Duration
+
+	// Compressions are the profiles to compare. Nil means
+	// DefaultCompressionProfiles.
+	Compressions []CompressionProfile
+
+	// Percentiles to estimate, in (0, 100]. Nil means
+	// DefaultWindowPercentiles.
+	Percentiles []float64
+}
+
+// DefaultPropagationMargin is the default ProposalWindowScenario margin.
+const DefaultPropagationMargin = time.Second
+
+// DefaultWindowPercentiles are the default percentiles estimated by
+// SimulateProposalWindow.
+var DefaultWindowPercentiles = []float64{50, 90, 99}
+
+// WindowEstimate is the estimated duration of BuildBlock at a percentile of
+// the scenario, with a compression.
+type WindowEstimate struct {
+	Percentile   float64
+	Compression  string
+	MempoolBytes int64
+	RTT          time.Duration
+	Duration     time.Duration
+	Fits         bool
+}
+
+// ProposalWindowReport is the result of SimulateProposalWindow.
+type ProposalWindowReport struct {
+	// Window is the time available to BuildBlock.
+	Window time.Duration
+
+	// Estimates are the estimates of each compression, by percentile.
+	Estimates []WindowEstimate
+
+	// Compression is the recommended compression, the one with the
+	// shortest duration at the highest percentile.
+	Compression string
+
+	// Timeout is the recommended builder timeout, see SetTimeout. It allows
+	// for the highest percentile with the recommended compression, with
+	// some headroom, and is capped at Window.
+	Timeout time.Duration
+
+	// Fits is true if BuildBlock fits the window at every percentile with
+	// the recommended compression.
+	Fits bool
+}
+
+// timeoutHeadroom is the factor applied to the highest percentile duration to
+// recommend a timeout.
+const timeoutHeadroom = 1.25
+
+// Validate checks that the scenario has samples, a positive window and
+// bandwidth, and valid compressions and percentiles.
+func (s ProposalWindowScenario) Validate() error {
+	if len(s.MempoolBytes) == 0 {
+		return errors.New("no mempool size samples")
+	}
+	if len(s.RTTs) == 0 {
+		return errors.New("no RTT samples")
+	}
+	for _, n := range s.MempoolBytes {
+		if n < 0 {
+			return fmt.Errorf("mempool size must not be negative, have %d", n)
+		}
+	}
+	for _, rtt := range s.RTTs {
+		if rtt < 0 {
+			return fmt.Errorf("RTT must not be negative, have %s", rtt)
+		}
+	}
+	if s.TimeoutPropose <= 0 {
+		return fmt.Errorf("timeout propose must be positive, have %s", s.TimeoutPropose)
+	}
+	if s.PropagationMargin < 0 || s.AuctionTime < 0 || s.SignTime < 0 {
+		return errors.New("margin, auction and sign time must not be negative")
+	}
+	if s.UploadBytesPerSecond <= 0 {
+		return fmt.Errorf("upload bandwidth must be positive, have %v", s.UploadBytesPerSecond)
+	}
+	if s.DownloadBytesPerSecond < 0 {
+		return fmt.Errorf("download bandwidth must not be negative, have %v", s.DownloadBytesPerSecond)
+	}
+	for _, c := range s.Compressions {
+		if c.Ratio <= 0 || c.Ratio > 1 || c.BytesPerSecond < 0 {
+			return fmt.Errorf("invalid compression profile %+v", c)
+		}
+	}
+	for _, p := range s.Percentiles {
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("percentile must be in (0, 100], have %v", p)
+		}
+	}
+	return nil
+}
+
+// SimulateProposalWindow estimates the duration of BuildBlock in the scenario,
+// and recommends a compression and timeout.
+//
+// The estimate at a percentile pairs the mempool size and RTT at that
+// percentile, i.e. it assumes that large mempools and slow round trips
+// coincide, which is pessimistic. Each build is modeled as signing,
+// compressing and uploading the mempool txs, the auction, and downloading the
+// block, which is assumed to be as large as the request, plus one round trip.
+// Retries aren't modeled, and eat into the headroom of the recommended
+// timeout.
+func SimulateProposalWindow(s ProposalWindowScenario) (*ProposalWindowReport, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	margin := s.PropagationMargin
+	if margin == 0 {
+		margin = DefaultPropagationMargin
+	}
+	compressions := s.Compressions
+	if compressions == nil {
+		compressions = DefaultCompressionProfiles
+	}
+	percentiles := append([]float64(nil), s.Percentiles...)
+	if len(percentiles) == 0 {
+		percentiles = append(percentiles, DefaultWindowPercentiles...)
+	}
+	sort.Float64s(percentiles)
+
+	download := s.DownloadBytesPerSecond
+	if download == 0 {
+		download = s.UploadBytesPerSecond
+	}
+
+	mempool := append([]int64(nil), s.MempoolBytes...)
+	sort.Slice(mempool, func(i, j int) bool { return mempool[i] < mempool[j] })
+	rtts := append([]time.Duration(nil), s.RTTs...)
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+
+	report := &ProposalWindowReport{Window: s.TimeoutPropose - margin}
+	if report.Window <= 0 {
+		return nil, fmt.Errorf("propagation margin %s leaves no time in timeout propose %s", margin, s.TimeoutPropose)
+	}
+
+	var best time.Duration
+	for _, c := range compressions {
+		var worst time.Duration
+		for _, p := range percentiles {
+			size := mempool[percentileIndex(len(mempool), p)]
+			rtt := rtts[percentileIndex(len(rtts), p)]
+
+			wire := float64(size) * c.Ratio
+			d := s.SignTime + rtt + s.AuctionTime +
+				seconds(wire/s.UploadBytesPerSecond) +
+				seconds(wire/download)
+			if c.BytesPerSecond > 0 {
+				d += seconds(float64(size) / c.BytesPerSecond)
+			}
+
+			report.Estimates = append(report.Estimates, WindowEstimate{
+				Percentile:   p,
+				Compression:  c.Name,
+				MempoolBytes: size,
+				RTT:          rtt,
+				Duration:     d,
+				Fits:         d <= report.Window,
+			})
+			worst = d
+		}
+		if report.Compression == "" || worst < best {
+			report.Compression, best = c.Name, worst
+		}
+	}
+
+	report.Timeout = time.Duration(float64(best) * timeoutHeadroom)
+	if report.Timeout > report.Window {
+		report.Timeout = report.Window
+	}
+	report.Fits = best <= report.Window
+	return report, nil
+}
+
+// percentileIndex returns the index of percentile p in n sorted samples, by
+// the nearest-rank method.
+func percentileIndex(n int, p float64) int {
+	i := int(math.Ceil(p/100*float64(n))) - 1
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,93 @@
+package mekabuild_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/meka-dev/mekatek-go/mekabuild"
+)
+
+func TestSimulateProposalWindow(t *testing.T) {
+	t.Parallel()
+
+	s := mekabuild.ProposalWindowScenario{
+		MempoolBytes:         []int64{1e6, 2e6, 3e6, 4e6, 10e6},
+		RTTs:                 []time.Duration{100 * time.Millisecond, 50 * time.Millisecond},
+		TimeoutPropose:       3 * time.Second,
+		UploadBytesPerSecond: 10e6,
+		AuctionTime:          200 * time.Millisecond,
+		Compressions: []mekabuild.CompressionProfile{
+			{Name: "none", Ratio: 1},
+			{Name: "gzip", Ratio: 0.25, BytesPerSecond: 20e6},
+		},
+		Percentiles: []float64{99, 50},
+	}
+
+	report, err := mekabuild.SimulateProposalWindow(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// p50 is 3MB and 50ms, p99 10MB and 100ms. Without compression, 10MB
+	// take 1s each way, with gzip, 0.5s to compress and 0.25s each way.
+	want := []mekabuild.WindowEstimate{
+		{Percentile: 50, Compression: "none", MempoolBytes: 3e6, RTT: 50 * time.Millisecond, Duration: 850 * time.Millisecond, Fits: true},
+		{Percentile: 99, Compression: "none", MempoolBytes: 10e6, RTT: 100 * time.Millisecond, Duration: 2300 * time.Millisecond, Fits: false},
+		{Percentile: 50, Compression: "gzip", MempoolBytes: 3e6, RTT: 50 * time.Millisecond, Duration: 550 * time.Millisecond, Fits: true},
+		{Percentile: 99, Compression: "gzip", MempoolBytes: 10e6, RTT: 100 * time.Millisecond, Duration: 1300 * time.Millisecond, Fits: true},
+	}
+	if len(report.Estimates) != len(want) {
+		t.Fatalf("estimates: want %d, have %+v", len(want), report.Estimates)
+	}
+	for i := range want {
+		have := report.Estimates[i]
+		have.Duration = have.Duration.Round(time.Millisecond)
+		if want[i] != have {
+			t.Errorf("estimate %d: want %+v, have %+v", i, want[i], have)
+		}
+	}
+
+	if want, have := 2*time.Second, report.Window; want != have {
+		t.Errorf("window: want %s, have %s", want, have)
+	}
+	if want, have := "gzip", report.Compression; want != have {
+		t.Errorf("compression: want %s, have %s", want, have)
+	}
+	if want, have := 1625*time.Millisecond, report.Timeout.Round(time.Millisecond); want != have {
+		t.Errorf("timeout: want %s, have %s", want, have)
+	}
+	if !report.Fits {
+		t.Errorf("want fit")
+	}
+
+	s.TimeoutPropose = 2 * time.Second
+	if report, err = mekabuild.SimulateProposalWindow(s); err != nil {
+		t.Fatal(err)
+	}
+	if report.Fits || report.Timeout != time.Second {
+		t.Errorf("short window: want no fit and timeout capped at 1s, have %v and %s", report.Fits, report.Timeout)
+	}
+
+	s.RTTs = nil
+	if _, err := mekabuild.SimulateProposalWindow(s); err == nil {
+		t.Errorf("no RTT samples: want error, have none")
+	}
+}
+
+func TestMeasureCompression(t *testing.T) {
+	t.Parallel()
+
+	sample := [][]byte{bytes.Repeat([]byte("cosmos1"), 1000), bytes.Repeat([]byte("uatom"), 1000)}
+	p, err := mekabuild.MeasureCompression("snappy", mekabuild.SnappyCompressor, sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "snappy" || p.Ratio <= 0 || p.Ratio >= 0.5 {
+		t.Errorf("profile: want a good ratio for repetitive txs, have %+v", p)
+	}
+
+	if _, err := mekabuild.MeasureCompression("snappy", mekabuild.SnappyCompressor, nil); err == nil {
+		t.Errorf("empty sample: want error, have none")
+	}
+}